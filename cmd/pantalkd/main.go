@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/manpage"
 	"github.com/pantalk/pantalk/internal/server"
 	"github.com/pantalk/pantalk/internal/version"
 )
@@ -16,10 +17,20 @@ func main() {
 	socketPath := flag.String("socket", "", "override unix socket path (defaults to config value)")
 	databasePath := flag.String("db", "", "override pantalk sqlite database path (defaults to config value)")
 	debug := flag.Bool("debug", false, "enable verbose debug logging")
-	allowExec := flag.Bool("allow-exec", false, "allow agent commands outside the default allowlist")
+	allowExec := flag.Bool("allow-exec", false, "allow commands outside the default allowlist (agents, exec connectors, transcription, classifier, middleware)")
+	takeover := flag.Bool("takeover", false, "take the socket over from the pantalkd already running on it, for upgrades without downtime")
 	showVersion := flag.Bool("version", false, "print version and exit")
+	showMan := flag.Bool("man", false, "print the pantalkd(1) man page as roff and exit")
 	flag.Parse()
 
+	if *showMan {
+		if err := manpage.Write(os.Stdout, manPage()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	if *showVersion {
 		fmt.Printf("pantalkd %s\n", version.Version)
 
@@ -66,6 +77,7 @@ func main() {
 	srv := server.New(cfg, *configPath, *socketPath, *databasePath)
 	srv.SetDebug(*debug)
 	srv.SetAllowExec(*allowExec)
+	srv.SetTakeover(*takeover)
 	if err := srv.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "server error: %v\n", err)
 		os.Exit(1)
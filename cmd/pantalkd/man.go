@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/manpage"
+	"github.com/pantalk/pantalk/internal/version"
+)
+
+// manPage builds pantalkd(1) from the daemon's registered flags.
+func manPage() manpage.Page {
+	page := manpage.Page{
+		Name:     "pantalkd",
+		Summary:  "pantalk daemon bridging chat platforms to a local socket",
+		Synopsis: []string{"[--config PATH] [--socket PATH] [--db PATH] [--allow-exec] [--takeover] [--debug]"},
+		Description: `pantalkd connects to every bot in its config, stores events in SQLite and serves the pantalk protocol on a unix socket. Configured agents are launched when matching events arrive.
+
+SIGINT and SIGTERM shut the daemon down. SIGHUP reloads the config from --config, as does pantalk reload.
+
+To upgrade without downtime, start the new pantalkd with --takeover while the old one runs. The old daemon passes it the listening sockets, lets in-flight sends finish, ends subscriptions with a handoff event and exits; clients connecting meanwhile wait on the socket rather than failing. pantalk stream and watch resume on the new daemon by themselves. Under systemd, socket activation (LISTEN_FDS) keeps the socket open across restarts instead.`,
+		Flags: manpage.FlagsFrom(flag.CommandLine),
+		Files: []manpage.Item{
+			{Tag: "~/.config/pantalk/config.yaml", Text: "Default config file; override with --config or $PANTALK_CONFIG."},
+			{Tag: "$XDG_RUNTIME_DIR/pantalk.sock", Text: "Default socket path (server.socket_path)."},
+			{Tag: "~/.local/share/pantalk/pantalk.db", Text: "Default event database (server.db_path)."},
+		},
+		SeeAlso: []string{"pantalk(1)"},
+		Version: version.Version,
+	}
+
+	for resolved, symbolic := range config.SymbolicPaths() {
+		page.Replace(resolved, symbolic)
+	}
+
+	return page
+}
@@ -13,13 +13,18 @@
 package agent
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"os"
 	"os/exec"
 	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/expr-lang/expr"
@@ -38,6 +43,10 @@ var AllowedCommands = map[string]bool{
 	"gemini":   true,
 }
 
+// maxPendingEvents caps how many events wait for the next run while the
+// agent is running or in cooldown. The oldest are dropped beyond it.
+const maxPendingEvents = 500
+
 // Config describes a single agent definition from the YAML config.
 type Config struct {
 	Name     string  `yaml:"name"`
@@ -47,35 +56,48 @@ type Config struct {
 	Buffer   int     `yaml:"buffer"`   // seconds to batch notifications (default 30)
 	Timeout  int     `yaml:"timeout"`  // max runtime in seconds (default 120)
 	Cooldown int     `yaml:"cooldown"` // min seconds between runs (default 60)
-}
 
-// exprEnv is the environment exposed to "when" expressions. Field names are
-// lowercased automatically by expr-lang so they match the YAML examples
-// (e.g. notify, direct, channel).
-type exprEnv struct {
-	// Event fields
-	Notify   bool   `expr:"notify"`
-	Direct   bool   `expr:"direct"`
-	Mentions bool   `expr:"mentions"`
-	Channel  string `expr:"channel"`
-	Thread   string `expr:"thread"`
-	Bot      string `expr:"bot"`
-	Service  string `expr:"service"`
-	User     string `expr:"user"`
-	Text     string `expr:"text"`
-
-	// Time fields - populated on tick events, zero on message events.
-	Tick    bool   `expr:"tick"`
-	Hour    int    `expr:"hour"`
-	Minute  int    `expr:"minute"`
-	Weekday string `expr:"weekday"` // "mon", "tue", "wed", "thu", "fri", "sat", "sun"
-
-	// Time functions - set to closures that capture the env's time fields.
-	// Exposed as at() and every() in expressions via expr tags.
-	AtFn    func(times ...string) (bool, error) `expr:"at"`
-	EveryFn func(interval string) (bool, error) `expr:"every"`
+	// EventsFile writes the buffered triggering events to a temporary JSON
+	// file and passes its path in PANTALK_EVENTS_FILE.
+	EventsFile bool `yaml:"events_file"`
+
+	// Stdin selects what the command reads on stdin: "" (nothing) or
+	// StdinEvents for the buffered triggering events as JSON lines.
+	Stdin string `yaml:"stdin"`
+
+	// Context puts this many earlier messages of the triggering
+	// conversation ahead of the triggering events on stdin and in the
+	// events file, and their count in PANTALK_CONTEXT_COUNT.
+	Context int `yaml:"context"`
+
+	// Reply posts the command's stdout back to the conversation of the
+	// triggering message, rendered through ReplyTemplate (default
+	// "{{.Output}}", see ReplyData).
+	Reply         bool   `yaml:"reply"`
+	ReplyTemplate string `yaml:"reply_template"`
+
+	// ThreadReplies posts the reply onto the triggering message: into its
+	// thread, or a thread started from it where the service has threads.
+	ThreadReplies bool `yaml:"thread_replies"`
+
+	// MarkRead marks each conversation the run was triggered from as read
+	// upstream, up to the newest triggering message, once the command
+	// succeeds.
+	MarkRead bool `yaml:"mark_read"`
+
+	// IncludeSelf also offers the bot's own messages to the when
+	// expression, for agents that log or mirror what the bot says.
+	IncludeSelf bool `yaml:"include_self"`
+
+	// Lists are the named lists from the top-level config, exposed to the
+	// when expression as variables (e.g. user in admins).
+	Lists map[string][]string `yaml:"-"`
 }
 
+// StdinEvents writes the triggering events to the command's stdin, one JSON
+// object per line, then closes it.
+const StdinEvents = "events"
+
 // weekdayName converts a time.Weekday to a short lowercase name.
 func weekdayName(d time.Weekday) string {
 	switch d {
@@ -171,14 +193,20 @@ func everyFunc(tick bool, hour, minute int, interval string) (bool, error) {
 // Runner manages the lifecycle of a single agent: matching, buffering, and
 // launching. It is safe for concurrent use.
 type Runner struct {
-	cfg     Config
-	program *vm.Program
+	cfg           Config
+	program       *vm.Program
+	patterns      *patterns
+	replyTemplate *template.Template // nil unless reply is enabled
 
 	mu         sync.Mutex
 	running    bool
 	lastFinish time.Time
 	pending    []protocol.Event
 	timer      *time.Timer
+	reply      ReplyFunc
+	record     RecordFunc
+	context    ContextFunc
+	markRead   MarkReadFunc
 }
 
 // NewRunner creates a runner for the given agent config. Returns an error if
@@ -197,24 +225,28 @@ func NewRunner(cfg Config) (*Runner, error) {
 	if cfg.Cooldown <= 0 {
 		cfg.Cooldown = 60
 	}
-
-	// Compile the when expression. Default to "notify" if omitted.
-	whenExpr := cfg.When
-	if strings.TrimSpace(whenExpr) == "" {
-		whenExpr = "notify"
+	if cfg.Stdin != "" && cfg.Stdin != StdinEvents {
+		return nil, fmt.Errorf("agent %q: stdin must be %q or empty, got %q", cfg.Name, StdinEvents, cfg.Stdin)
+	}
+	if cfg.Context < 0 || cfg.Context > MaxContext {
+		return nil, fmt.Errorf("agent %q: context must be between 0 and %d, got %d", cfg.Name, MaxContext, cfg.Context)
 	}
 
-	program, err := expr.Compile(whenExpr,
-		expr.Env(exprEnv{}),
-		expr.AsBool(),
-	)
+	program, patterns, err := compileWhen(cfg.When, cfg.Lists)
 	if err != nil {
 		return nil, fmt.Errorf("agent %q: invalid when expression: %w", cfg.Name, err)
 	}
 
+	replyTemplate, err := compileReplyTemplate(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Runner{
-		cfg:     cfg,
-		program: program,
+		cfg:           cfg,
+		program:       program,
+		patterns:      patterns,
+		replyTemplate: replyTemplate,
 	}, nil
 }
 
@@ -228,54 +260,43 @@ func (r *Runner) Matches(event protocol.Event) bool {
 // time for tick fields (hour, minute, weekday). This allows deterministic
 // testing of time-based expressions.
 func (r *Runner) MatchesAt(event protocol.Event, now time.Time) bool {
-	isTick := event.Kind == "tick"
-	isMessage := event.Kind == "message" && event.Direction == "in"
-
-	// Accept inbound messages and tick events only.
-	if !isTick && !isMessage {
+	if skipReason(event, r.cfg.IncludeSelf) != "" {
 		return false
 	}
 
-	// Don't react to our own messages (not applicable to ticks).
-	if isMessage && event.Self {
+	result, err := expr.Run(r.program, newExprEnv(event, now, r.cfg.Lists, r.patterns))
+	if err != nil {
+		log.Printf("[agent:%s] when expression error: %v", r.cfg.Name, err)
 		return false
 	}
 
-	env := exprEnv{
-		Notify:   event.Notify,
-		Direct:   event.Direct,
-		Mentions: event.Mentions,
-		Channel:  event.Channel,
-		Thread:   event.Thread,
-		Bot:      event.Bot,
-		Service:  event.Service,
-		User:     event.User,
-		Text:     event.Text,
-	}
+	match, ok := result.(bool)
+	return ok && match
+}
 
-	if isTick {
-		env.Tick = true
-		env.Hour = now.Hour()
-		env.Minute = now.Minute()
-		env.Weekday = weekdayName(now.Weekday())
+// skipReason explains why an event can never trigger an agent, or returns ""
+// for inbound messages, interactions, edits, deletions and reactions from
+// others and tick events. With includeSelf the bot's own messages, sent
+// through pantalk or another client, are accepted too.
+func skipReason(event protocol.Event, includeSelf bool) string {
+	isTick := event.Kind == "tick"
+	var isMessage bool
+	switch event.Kind {
+	case "message", protocol.KindInteraction, protocol.KindEdit, protocol.KindDelete, protocol.KindReaction:
+		isMessage = event.Direction == "in" || (includeSelf && event.Self && event.Direction == "out")
 	}
 
-	// Set time function closures that capture the env's time fields.
-	env.AtFn = func(times ...string) (bool, error) {
-		return atFunc(env.Tick, env.Hour, env.Minute, times...)
-	}
-	env.EveryFn = func(interval string) (bool, error) {
-		return everyFunc(env.Tick, env.Hour, env.Minute, interval)
+	// Accept inbound messages, their changes, button clicks and tick
+	// events only.
+	if !isTick && !isMessage {
+		return fmt.Sprintf("only inbound messages, interactions, edits, deletions, reactions and ticks trigger agents (kind %q, direction %q)", event.Kind, event.Direction)
 	}
 
-	result, err := expr.Run(r.program, env)
-	if err != nil {
-		log.Printf("[agent:%s] when expression error: %v", r.cfg.Name, err)
-		return false
+	// Don't react to our own messages (not applicable to ticks).
+	if isMessage && event.Self && !includeSelf {
+		return "the bot's own messages never trigger agents"
 	}
-
-	match, ok := result.(bool)
-	return ok && match
+	return ""
 }
 
 // Handle accepts a matching event. Events are buffered for the configured
@@ -286,6 +307,9 @@ func (r *Runner) Handle(event protocol.Event) {
 	defer r.mu.Unlock()
 
 	r.pending = append(r.pending, event)
+	if extra := len(r.pending) - maxPendingEvents; extra > 0 {
+		r.pending = append(r.pending[:0], r.pending[extra:]...)
+	}
 
 	// If a timer is already ticking, let it fire - additional events just
 	// accumulate in the pending buffer.
@@ -301,16 +325,15 @@ func (r *Runner) Handle(event protocol.Event) {
 func (r *Runner) flush() {
 	r.mu.Lock()
 
-	count := len(r.pending)
-	r.pending = nil
 	r.timer = nil
 
-	if count == 0 {
+	if len(r.pending) == 0 {
 		r.mu.Unlock()
 		return
 	}
 
 	// Cooldown check: if the last run finished too recently, re-buffer.
+	// Pending events are kept so the eventual run sees all of them.
 	if !r.lastFinish.IsZero() {
 		elapsed := time.Since(r.lastFinish)
 		remaining := time.Duration(r.cfg.Cooldown)*time.Second - elapsed
@@ -330,15 +353,46 @@ func (r *Runner) flush() {
 		return
 	}
 
+	events := r.pending
+	r.pending = nil
 	r.running = true
 	r.mu.Unlock()
 
-	go r.run(count)
+	go r.run(events)
 }
 
-// run executes the agent command. The command is responsible for reading
-// notifications via the pantalk CLI - no events are passed on stdin.
-func (r *Runner) run(triggerCount int) {
+// Trigger launches the command now with the given events (possibly none),
+// bypassing the buffer. It fails if the agent is already running or, unless
+// force is set, still in cooldown. Buffered events are left for the next
+// regular run.
+func (r *Runner) Trigger(events []protocol.Event, force bool) error {
+	r.mu.Lock()
+
+	if r.running {
+		r.mu.Unlock()
+		return fmt.Errorf("agent %q is already running", r.cfg.Name)
+	}
+	if !force && !r.lastFinish.IsZero() {
+		remaining := time.Duration(r.cfg.Cooldown)*time.Second - time.Since(r.lastFinish)
+		if remaining > 0 {
+			r.mu.Unlock()
+			return fmt.Errorf("agent %q is in cooldown for another %s (force to override)", r.cfg.Name, remaining.Round(time.Second))
+		}
+	}
+
+	r.running = true
+	r.mu.Unlock()
+
+	log.Printf("[agent:%s] triggered manually", r.cfg.Name)
+	go r.run(events)
+	return nil
+}
+
+// run executes the agent command. The command gets the triggering context
+// through PANTALK_* environment variables (see commandEnv) and, with
+// stdin: events, the events themselves as JSON lines on stdin. Otherwise it
+// reads the notifications via the pantalk CLI.
+func (r *Runner) run(events []protocol.Event) {
 	defer func() {
 		r.mu.Lock()
 		r.running = false
@@ -351,33 +405,158 @@ func (r *Runner) run(triggerCount int) {
 		r.mu.Unlock()
 	}()
 
-	log.Printf("[agent:%s] launching (%d notification(s) triggered)", r.cfg.Name, triggerCount)
+	log.Printf("[agent:%s] launching (%d notification(s) triggered)", r.cfg.Name, len(events))
+	started := time.Now()
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Timeout)*time.Second)
 	defer cancel()
 
+	// Context messages come first so the input reads in conversation order.
+	earlier := r.conversationContext(events)
+	input := append(append([]protocol.Event(nil), earlier...), events...)
+
+	eventsFile := ""
+	if r.cfg.EventsFile {
+		path, err := writeEventsFile(input)
+		if err != nil {
+			log.Printf("[agent:%s] events file unavailable: %v", r.cfg.Name, err)
+		} else {
+			eventsFile = path
+			defer os.Remove(path)
+		}
+	}
+
 	// Direct exec - no shell interpretation.
 	cmd := exec.CommandContext(ctx, r.cfg.Command[0], r.cfg.Command[1:]...)
+	cmd.Env = append(os.Environ(), r.commandEnv(events, len(earlier), eventsFile)...)
 
 	if r.cfg.Workdir != "" {
 		cmd.Dir = r.cfg.Workdir
 	}
 
-	output, err := cmd.CombinedOutput()
+	if r.cfg.Stdin == StdinEvents {
+		cmd.Stdin = eventLines(input)
+	}
+
+	// stdout is kept apart from stderr so only the former is replied with.
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	output := stdout.String() + stderr.String()
+	r.recordRun(started, len(events), err, ctx.Err(), output)
 	if err != nil {
 		log.Printf("[agent:%s] command failed: %v", r.cfg.Name, err)
 		if len(output) > 0 {
-			log.Printf("[agent:%s] output: %s", r.cfg.Name, truncate(string(output), 500))
+			log.Printf("[agent:%s] output: %s", r.cfg.Name, truncate(output, 500))
 		}
 		return
 	}
 
 	log.Printf("[agent:%s] completed successfully", r.cfg.Name)
 	if len(output) > 0 {
-		log.Printf("[agent:%s] output: %s", r.cfg.Name, truncate(strings.TrimSpace(string(output)), 500))
+		log.Printf("[agent:%s] output: %s", r.cfg.Name, truncate(strings.TrimSpace(output), 500))
+	}
+
+	if r.cfg.Reply {
+		r.postReply(events, stdout.String())
+	}
+	if r.cfg.MarkRead {
+		r.markConversationsRead(events)
 	}
 }
 
+// commandEnv describes the run to the agent command:
+//
+//	PANTALK_AGENT          agent name
+//	PANTALK_TRIGGER_COUNT  number of buffered triggering events
+//	PANTALK_SERVICE, PANTALK_BOT, PANTALK_CHANNEL, PANTALK_THREAD
+//	                       where the most recent message came from, so a
+//	                       reply can go to the right place (empty for ticks)
+//	PANTALK_MESSAGE_ID     the platform's ID of the most recent message, for
+//	                       reacting to or editing it
+//	PANTALK_EVENT_ID       the stored ID of the most recent message, for
+//	                       pantalk send --reply-to
+//	PANTALK_SINCE_ID       one below the oldest triggering event ID, for
+//	                       pantalk history --since-id
+//	PANTALK_EVENTS_FILE    JSON array of the events, when events_file is set
+//	PANTALK_CONTEXT_COUNT  how many context messages precede the triggering
+//	                       events on stdin and in the events file
+func (r *Runner) commandEnv(events []protocol.Event, contextCount int, eventsFile string) []string {
+	env := []string{
+		"PANTALK_AGENT=" + r.cfg.Name,
+		"PANTALK_TRIGGER_COUNT=" + strconv.Itoa(len(events)),
+	}
+
+	var latest protocol.Event
+	var oldestID int64
+	for _, event := range events {
+		if event.Kind == "tick" {
+			continue
+		}
+		latest = event
+		if event.ID > 0 && (oldestID == 0 || event.ID < oldestID) {
+			oldestID = event.ID
+		}
+	}
+
+	env = append(env,
+		"PANTALK_SERVICE="+latest.Service,
+		"PANTALK_BOT="+latest.Bot,
+		"PANTALK_CHANNEL="+latest.Channel,
+		"PANTALK_THREAD="+latest.Thread,
+		"PANTALK_MESSAGE_ID="+latest.MessageID,
+	)
+	if latest.ID > 0 {
+		env = append(env, "PANTALK_EVENT_ID="+strconv.FormatInt(latest.ID, 10))
+	}
+	if oldestID > 0 {
+		env = append(env, "PANTALK_SINCE_ID="+strconv.FormatInt(oldestID-1, 10))
+	}
+	if eventsFile != "" {
+		env = append(env, "PANTALK_EVENTS_FILE="+eventsFile)
+	}
+	if r.cfg.Context > 0 {
+		env = append(env, "PANTALK_CONTEXT_COUNT="+strconv.Itoa(contextCount))
+	}
+
+	return env
+}
+
+// writeEventsFile stores events as a JSON array in a private temp file and
+// returns its path. The caller removes it after the run.
+func writeEventsFile(events []protocol.Event) (string, error) {
+	f, err := os.CreateTemp("", "pantalk-events-*.json")
+	if err != nil {
+		return "", err
+	}
+
+	if err := json.NewEncoder(f).Encode(events); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+// eventLines encodes events as JSON lines for the command's stdin. exec
+// closes stdin once the reader is drained, so the command sees EOF after
+// the last event.
+func eventLines(events []protocol.Event) io.Reader {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, event := range events {
+		_ = encoder.Encode(event)
+	}
+	return &buf
+}
+
 // NeedsTick reports whether this runner's when expression uses time-based
 // functions (at, every, tick, hour, minute, weekday). If no runners need
 // ticks, the server can skip the 1-minute ticker entirely.
@@ -419,6 +598,9 @@ func (r *Runner) Name() string { return r.cfg.Name }
 // When returns the agent's "when" expression string.
 func (r *Runner) When() string { return r.cfg.When }
 
+// IncludeSelf reports whether the bot's own messages can trigger the agent.
+func (r *Runner) IncludeSelf() bool { return r.cfg.IncludeSelf }
+
 func truncate(s string, max int) string {
 	if len(s) <= max {
 		return s
@@ -1,6 +1,10 @@
 package agent
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -251,6 +255,28 @@ func TestMatches_IgnoresOutbound(t *testing.T) {
 	}
 }
 
+func TestMatches_IncludeSelf(t *testing.T) {
+	r, err := NewRunner(Config{
+		Name:        "logger",
+		When:        `kind == "message"`,
+		Command:     Command{"claude"},
+		IncludeSelf: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Matches(makeEvent(func(e *protocol.Event) { e.Direction, e.Self = "out", true })) {
+		t.Error("should match the bot's own outbound messages")
+	}
+	if !r.Matches(makeEvent(func(e *protocol.Event) { e.Self = true })) {
+		t.Error("should match own messages")
+	}
+	if r.Matches(makeEvent(func(e *protocol.Event) { e.Direction = "out" })) {
+		t.Error("should not match outbound events that aren't the bot's")
+	}
+}
+
 func TestMatches_IgnoresNonMessage(t *testing.T) {
 	r, err := NewRunner(Config{
 		Name:    "test",
@@ -266,6 +292,27 @@ func TestMatches_IgnoresNonMessage(t *testing.T) {
 	}
 }
 
+func TestMatches_LifecycleKinds(t *testing.T) {
+	r, err := NewRunner(Config{
+		Name:    "test",
+		When:    `kind == "reaction" && text == "white_check_mark"`,
+		Command: Command{"claude"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reaction := makeEvent(func(e *protocol.Event) {
+		e.Kind, e.Notify, e.Text, e.Target = protocol.KindReaction, false, "white_check_mark", "post:P1"
+	})
+	if !r.Matches(reaction) {
+		t.Error("should match an inbound reaction")
+	}
+	if r.Matches(makeEvent(func(e *protocol.Event) { e.Kind, e.Text = protocol.KindEdit, "white_check_mark" })) {
+		t.Error("should not match an edit")
+	}
+}
+
 func TestNewRunner_InvalidExpression(t *testing.T) {
 	_, err := NewRunner(Config{
 		Name:    "test",
@@ -509,6 +556,33 @@ func TestHandle_AccumulatesEvents(t *testing.T) {
 	}
 }
 
+func TestHandle_CapsPendingEvents(t *testing.T) {
+	r, err := NewRunner(Config{
+		Name:    "test",
+		Command: Command{"claude"},
+		Buffer:  30,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	for i := 0; i < maxPendingEvents+10; i++ {
+		event := makeEvent()
+		event.ID = int64(i + 1)
+		r.Handle(event)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) != maxPendingEvents {
+		t.Fatalf("expected %d pending events, got %d", maxPendingEvents, len(r.pending))
+	}
+	if r.pending[0].ID != 11 {
+		t.Fatalf("expected the oldest events dropped, first pending is %d", r.pending[0].ID)
+	}
+}
+
 func TestStop_CancelsPendingTimer(t *testing.T) {
 	r, err := NewRunner(Config{
 		Name:    "test",
@@ -600,6 +674,46 @@ func TestFlush_EmptyPending(t *testing.T) {
 	}
 }
 
+func TestTrigger_CooldownAndForce(t *testing.T) {
+	r, err := NewRunner(Config{
+		Name:     "test",
+		Command:  Command{"sh", "-c", "exit 0"},
+		Cooldown: 600,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan protocol.AgentRun, 2)
+	r.SetRecordFunc(func(run protocol.AgentRun) { done <- run })
+
+	r.mu.Lock()
+	r.running = true
+	r.mu.Unlock()
+	if err := r.Trigger(nil, true); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Fatalf("expected already running error even with force, got %v", err)
+	}
+
+	r.mu.Lock()
+	r.running = false
+	r.lastFinish = time.Now()
+	r.mu.Unlock()
+	if err := r.Trigger(nil, false); err == nil || !strings.Contains(err.Error(), "cooldown") {
+		t.Fatalf("expected cooldown error, got %v", err)
+	}
+
+	if err := r.Trigger([]protocol.Event{makeEvent()}, true); err != nil {
+		t.Fatalf("forced trigger: %v", err)
+	}
+	select {
+	case run := <-done:
+		if run.Triggers != 1 || run.ExitCode != 0 {
+			t.Fatalf("unexpected run: %+v", run)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("triggered run did not finish")
+	}
+}
+
 // --- truncate tests ---
 
 func TestTruncate(t *testing.T) {
@@ -1145,7 +1259,7 @@ func TestRun_SuccessfulCommand(t *testing.T) {
 	}
 
 	// run directly and wait for it to finish
-	r.run(1)
+	r.run([]protocol.Event{makeEvent()})
 
 	// After run, running should be false and lastFinish should be set
 	r.mu.Lock()
@@ -1169,7 +1283,7 @@ func TestRun_FailingCommand(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	r.run(1)
+	r.run([]protocol.Event{makeEvent()})
 
 	r.mu.Lock()
 	if r.running {
@@ -1192,7 +1306,7 @@ func TestRun_CommandWithOutput(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	r.run(3)
+	r.run([]protocol.Event{makeEvent(), makeEvent(), makeEvent()})
 
 	r.mu.Lock()
 	if r.running {
@@ -1213,7 +1327,7 @@ func TestRun_WithWorkdir(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	r.run(1)
+	r.run([]protocol.Event{makeEvent()})
 
 	r.mu.Lock()
 	if r.lastFinish.IsZero() {
@@ -1239,7 +1353,7 @@ func TestRun_ReschedulesOnPendingEvents(t *testing.T) {
 	r.pending = append(r.pending, makeEvent())
 	r.mu.Unlock()
 
-	r.run(1)
+	r.run([]protocol.Event{makeEvent()})
 
 	r.mu.Lock()
 	if r.timer == nil {
@@ -1408,3 +1522,218 @@ func TestEveryFunc_Direct(t *testing.T) {
 		t.Error("expected no match at 9:07 for 15m interval")
 	}
 }
+
+func TestFlush_CooldownKeepsPendingEvents(t *testing.T) {
+	r, err := NewRunner(Config{
+		Name:     "test",
+		Command:  Command{"true"},
+		Cooldown: 60,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	r.mu.Lock()
+	r.lastFinish = time.Now()
+	r.pending = []protocol.Event{makeEvent(), makeEvent()}
+	r.mu.Unlock()
+
+	r.flush()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) != 2 {
+		t.Fatalf("expected events kept for the retry, got %d", len(r.pending))
+	}
+}
+
+func TestCommandEnv(t *testing.T) {
+	r, err := NewRunner(Config{Name: "triage", Command: Command{"claude"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := []protocol.Event{
+		makeEvent(func(e *protocol.Event) { e.ID = 42; e.Channel = "C1" }),
+		makeEvent(func(e *protocol.Event) {
+			e.ID = 40
+			e.Channel = "C2"
+			e.Thread = "T9"
+			e.MessageID = "1700000000.000200"
+		}),
+		makeTickEvent(),
+	}
+
+	env := strings.Join(r.commandEnv(events, 0, "/tmp/events.json"), "\n")
+	for _, want := range []string{
+		"PANTALK_AGENT=triage",
+		"PANTALK_TRIGGER_COUNT=3",
+		"PANTALK_SERVICE=slack",
+		"PANTALK_BOT=test-bot",
+		"PANTALK_CHANNEL=C2",
+		"PANTALK_THREAD=T9",
+		"PANTALK_MESSAGE_ID=1700000000.000200",
+		"PANTALK_EVENT_ID=40",
+		"PANTALK_SINCE_ID=39",
+		"PANTALK_EVENTS_FILE=/tmp/events.json",
+	} {
+		if !strings.Contains(env+"\n", want+"\n") {
+			t.Errorf("missing %s in env:\n%s", want, env)
+		}
+	}
+}
+
+func TestCommandEnv_TickOnly(t *testing.T) {
+	r, err := NewRunner(Config{Name: "cron", When: "every(\"15m\")", Command: Command{"claude"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := strings.Join(r.commandEnv([]protocol.Event{makeTickEvent()}, 0, ""), "\n")
+	if strings.Contains(env, "PANTALK_SINCE_ID") || strings.Contains(env, "PANTALK_EVENT_ID") || strings.Contains(env, "PANTALK_EVENTS_FILE") {
+		t.Fatalf("tick-only run should not carry since id, event id or events file:\n%s", env)
+	}
+	if !strings.Contains(env, "PANTALK_CHANNEL=\n") {
+		t.Fatalf("expected empty channel for ticks:\n%s", env)
+	}
+}
+
+func TestRun_InjectsEnvAndEventsFile(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "seen")
+	r, err := NewRunner(Config{
+		Name: "test",
+		// Copies the events file and records the env the command saw.
+		Command:    Command{"sh", "-c", `cp "$PANTALK_EVENTS_FILE" "$0.json" && echo "$PANTALK_BOT $PANTALK_CHANNEL $PANTALK_TRIGGER_COUNT" > "$0"`, out},
+		Timeout:    5,
+		EventsFile: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.run([]protocol.Event{makeEvent(func(e *protocol.Event) { e.ID = 7 })})
+
+	seen, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("command did not run: %v", err)
+	}
+	if got := strings.TrimSpace(string(seen)); got != "test-bot #general 1" {
+		t.Fatalf("unexpected env seen by command: %q", got)
+	}
+
+	data, err := os.ReadFile(out + ".json")
+	if err != nil {
+		t.Fatalf("events file not readable by command: %v", err)
+	}
+	var events []protocol.Event
+	if err := json.Unmarshal(data, &events); err != nil || len(events) != 1 || events[0].ID != 7 {
+		t.Fatalf("unexpected events file %s: %v", data, err)
+	}
+}
+
+func TestRun_PipesEventsToStdin(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "stdin")
+	r, err := NewRunner(Config{
+		Name:    "test",
+		Command: Command{"sh", "-c", `cat > "$0"`, out},
+		Timeout: 5,
+		Stdin:   StdinEvents,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.run([]protocol.Event{
+		makeEvent(func(e *protocol.Event) { e.ID = 7; e.Text = "first" }),
+		makeEvent(func(e *protocol.Event) { e.ID = 8; e.Text = "second" }),
+	})
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("command did not run: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one JSON line per event, got %q", data)
+	}
+	for i, want := range []string{"first", "second"} {
+		var event protocol.Event
+		if err := json.Unmarshal([]byte(lines[i]), &event); err != nil {
+			t.Fatalf("line %d is not an event: %v", i, err)
+		}
+		if event.Text != want {
+			t.Fatalf("line %d: expected %q, got %q", i, want, event.Text)
+		}
+	}
+}
+
+func TestRun_PrependsConversationContext(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "stdin")
+	r, err := NewRunner(Config{
+		Name:    "test",
+		Command: Command{"sh", "-c", `cat > "$0" && echo "$PANTALK_CONTEXT_COUNT" > "$0.count"`, out},
+		Timeout: 5,
+		Stdin:   StdinEvents,
+		Context: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotAnchor protocol.Event
+	var gotLimit int
+	r.SetContextFunc(func(event protocol.Event, limit int) ([]protocol.Event, error) {
+		gotAnchor, gotLimit = event, limit
+		return []protocol.Event{
+			makeEvent(func(e *protocol.Event) { e.ID = 3; e.Text = "earlier" }),
+			makeEvent(func(e *protocol.Event) { e.ID = 4; e.Text = "reply"; e.Direction = "out" }),
+		}, nil
+	})
+
+	r.run([]protocol.Event{
+		makeEvent(func(e *protocol.Event) { e.ID = 7; e.Text = "first" }),
+		makeEvent(func(e *protocol.Event) { e.ID = 8; e.Channel = "#other"; e.Text = "elsewhere" }),
+		makeEvent(func(e *protocol.Event) { e.ID = 9; e.Text = "second" }),
+	})
+
+	if gotAnchor.ID != 7 || gotLimit != 2 {
+		t.Fatalf("expected context before event 7 with limit 2, got event %d limit %d", gotAnchor.ID, gotLimit)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("command did not run: %v", err)
+	}
+	var texts []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var event protocol.Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("line is not an event: %v", err)
+		}
+		texts = append(texts, event.Text)
+	}
+	if got := strings.Join(texts, ","); got != "earlier,reply,first,elsewhere,second" {
+		t.Fatalf("unexpected stdin order: %s", got)
+	}
+
+	count, err := os.ReadFile(out + ".count")
+	if err != nil || strings.TrimSpace(string(count)) != "2" {
+		t.Fatalf("expected PANTALK_CONTEXT_COUNT=2, got %q (%v)", count, err)
+	}
+}
+
+func TestNewRunner_InvalidContext(t *testing.T) {
+	_, err := NewRunner(Config{Name: "test", Command: Command{"claude"}, Context: MaxContext + 1})
+	if err == nil || !strings.Contains(err.Error(), "context") {
+		t.Fatalf("expected context error, got: %v", err)
+	}
+}
+
+func TestNewRunner_InvalidStdin(t *testing.T) {
+	_, err := NewRunner(Config{Name: "test", Command: Command{"claude"}, Stdin: "notifications"})
+	if err == nil || !strings.Contains(err.Error(), "stdin") {
+		t.Fatalf("expected stdin error, got: %v", err)
+	}
+}
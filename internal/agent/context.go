@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"log"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// MaxContext caps the context option: how many earlier messages of the
+// conversation an agent can be given.
+const MaxContext = 200
+
+// ContextFunc returns up to limit messages, oldest first, that came before
+// event in its conversation. The server supplies it from the store.
+type ContextFunc func(event protocol.Event, limit int) ([]protocol.Event, error)
+
+// SetContextFunc sets where the runner reads conversation context from when
+// the context option is set. Without one, agents get no context.
+func (r *Runner) SetContextFunc(fn ContextFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.context = fn
+}
+
+// conversationContext returns the messages leading up to the triggering
+// events: the cfg.Context messages before the earliest trigger in the
+// conversation of the most recent one. Ticks have no conversation.
+func (r *Runner) conversationContext(events []protocol.Event) []protocol.Event {
+	r.mu.Lock()
+	fn := r.context
+	r.mu.Unlock()
+	if r.cfg.Context <= 0 || fn == nil {
+		return nil
+	}
+
+	var anchor protocol.Event
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Kind != "tick" {
+			anchor = events[i]
+			break
+		}
+	}
+	if anchor.Kind == "" {
+		return nil
+	}
+	for _, event := range events {
+		if event.Kind == "tick" || event.ID <= 0 || event.ID >= anchor.ID {
+			continue
+		}
+		if event.Service == anchor.Service && event.Bot == anchor.Bot &&
+			event.Channel == anchor.Channel && event.Thread == anchor.Thread {
+			anchor = event
+			break
+		}
+	}
+
+	messages, err := fn(anchor, r.cfg.Context)
+	if err != nil {
+		log.Printf("[agent:%s] conversation context unavailable: %v", r.cfg.Name, err)
+		return nil
+	}
+	return messages
+}
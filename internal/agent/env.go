@@ -0,0 +1,220 @@
+package agent
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/builtin"
+	"github.com/expr-lang/expr/vm"
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// exprFields are the event and time fields exposed to when expressions. Time
+// fields (tick, hour, minute, weekday) are only set on tick events.
+var exprFields = []string{
+	"notify", "notify_reason", "direct", "mentions", "channel", "thread", "bot", "service", "user", "text",
+	"kind", "direction", "priority", "labels", "translated_text", "language",
+	"tick", "hour", "minute", "weekday",
+}
+
+// exprFuncs are the helper functions exposed to when expressions, on top of
+// expr-lang's builtins such as duration() and len().
+var exprFuncs = []string{"at", "every", "text_capture", "channel_matches", "age"}
+
+// exprKeywords cannot be used as list names.
+var exprKeywords = []string{"true", "false", "nil", "in", "not", "and", "or", "matches", "contains", "startsWith", "endsWith", "let", "if", "else"}
+
+var listNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateListName checks that a config list can be referenced by name in a
+// when expression without shadowing a field, function or keyword.
+func ValidateListName(name string) error {
+	if !listNamePattern.MatchString(name) {
+		return fmt.Errorf("list name %q must be an identifier (letters, digits and _)", name)
+	}
+	for _, reserved := range [][]string{exprFields, exprFuncs, exprKeywords} {
+		for _, r := range reserved {
+			if name == r {
+				return fmt.Errorf("list name %q is reserved in when expressions", name)
+			}
+		}
+	}
+	if _, ok := builtin.Index[name]; ok {
+		return fmt.Errorf("list name %q is reserved in when expressions", name)
+	}
+	return nil
+}
+
+// patterns caches the regular expressions used by text_capture and
+// channel_matches. Constant patterns are compiled with the expression, so an
+// invalid one is reported when the runner is created.
+type patterns struct {
+	mu     sync.Mutex
+	byText map[string]*regexp.Regexp
+}
+
+func (p *patterns) get(pattern string) (*regexp.Regexp, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if re, ok := p.byText[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if p.byText == nil {
+		p.byText = make(map[string]*regexp.Regexp)
+	}
+	p.byText[pattern] = re
+	return re, nil
+}
+
+// channelPattern anchors a channel_matches pattern so it has to match the
+// whole channel.
+func channelPattern(pattern string) string {
+	return "^(?:" + pattern + ")$"
+}
+
+// patternCollector gathers the constant patterns passed to the regex helpers
+// while an expression is compiled.
+type patternCollector struct {
+	patterns []string
+}
+
+func (c *patternCollector) Visit(node *ast.Node) {
+	call, ok := (*node).(*ast.CallNode)
+	if !ok || len(call.Arguments) != 1 {
+		return
+	}
+	callee, ok := call.Callee.(*ast.IdentifierNode)
+	if !ok {
+		return
+	}
+	arg, ok := call.Arguments[0].(*ast.StringNode)
+	if !ok {
+		return
+	}
+
+	switch callee.Value {
+	case "text_capture":
+		c.patterns = append(c.patterns, arg.Value)
+	case "channel_matches":
+		c.patterns = append(c.patterns, channelPattern(arg.Value))
+	}
+}
+
+// compileWhen compiles a when expression against the given lists. An empty
+// expression means "notify".
+func compileWhen(when string, lists map[string][]string) (*vm.Program, *patterns, error) {
+	if strings.TrimSpace(when) == "" {
+		when = "notify"
+	}
+	for name := range lists {
+		if err := ValidateListName(name); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	pats := &patterns{}
+	collector := &patternCollector{}
+	program, err := expr.Compile(when,
+		expr.Env(newExprEnv(protocol.Event{}, time.Time{}, lists, pats)),
+		expr.AsBool(),
+		expr.Patch(collector),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, pattern := range collector.patterns {
+		if _, err := pats.get(pattern); err != nil {
+			return nil, nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	return program, pats, nil
+}
+
+// newExprEnv builds the expression environment for an event. Time fields are
+// taken from now and only set on tick events; age() is measured against now.
+func newExprEnv(event protocol.Event, now time.Time, lists map[string][]string, pats *patterns) map[string]any {
+	tick := event.Kind == "tick"
+	hour, minute, weekday := 0, 0, ""
+	if tick {
+		hour, minute, weekday = now.Hour(), now.Minute(), weekdayName(now.Weekday())
+	}
+
+	env := make(map[string]any, len(exprFields)+len(exprFuncs)+len(lists))
+	for name, values := range lists {
+		env[name] = values
+	}
+
+	env["notify"] = event.Notify
+	env["notify_reason"] = event.NotifyReason
+	env["direct"] = event.Direct
+	env["mentions"] = event.Mentions
+	env["channel"] = event.Channel
+	env["thread"] = event.Thread
+	env["bot"] = event.Bot
+	env["service"] = event.Service
+	env["user"] = event.User
+	env["text"] = event.Text
+	env["kind"] = event.Kind
+	env["direction"] = event.Direction
+	env["priority"] = event.Priority
+	env["labels"] = event.Labels
+	env["translated_text"] = event.TranslatedText
+	env["language"] = event.Language
+	env["tick"] = tick
+	env["hour"] = hour
+	env["minute"] = minute
+	env["weekday"] = weekday
+
+	env["at"] = func(times ...string) (bool, error) {
+		return atFunc(tick, hour, minute, times...)
+	}
+	env["every"] = func(interval string) (bool, error) {
+		return everyFunc(tick, hour, minute, interval)
+	}
+
+	// text_capture returns the first capture group of the first match in
+	// the text, the whole match without groups, or "" without a match.
+	env["text_capture"] = func(pattern string) (string, error) {
+		re, err := pats.get(pattern)
+		if err != nil {
+			return "", fmt.Errorf("text_capture(): %w", err)
+		}
+		match := re.FindStringSubmatch(event.Text)
+		switch {
+		case match == nil:
+			return "", nil
+		case len(match) > 1:
+			return match[1], nil
+		default:
+			return match[0], nil
+		}
+	}
+	env["channel_matches"] = func(pattern string) (bool, error) {
+		re, err := pats.get(channelPattern(pattern))
+		if err != nil {
+			return false, fmt.Errorf("channel_matches(): %w", err)
+		}
+		return re.MatchString(event.Channel), nil
+	}
+
+	// age is how long ago the event happened; zero for ticks.
+	env["age"] = func() time.Duration {
+		if tick || event.Timestamp.IsZero() || now.Before(event.Timestamp) {
+			return 0
+		}
+		return now.Sub(event.Timestamp)
+	}
+
+	return env
+}
@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func TestMatches_Helpers(t *testing.T) {
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	lists := map[string][]string{"admins": {"U123", "U456"}}
+
+	tests := []struct {
+		name  string
+		when  string
+		event protocol.Event
+		want  bool
+	}{
+		{name: "capture", when: `text_capture("ticket-(\\d+)") == "42"`, event: makeEvent(func(e *protocol.Event) { e.Text = "see ticket-42 please" }), want: true},
+		{name: "capture without groups", when: `text_capture("v[0-9.]+") == "v1.2"`, event: makeEvent(func(e *protocol.Event) { e.Text = "release v1.2 now" }), want: true},
+		{name: "capture no match", when: `text_capture("ticket-(\\d+)") != ""`, event: makeEvent(), want: false},
+		{name: "user in list", when: `user in admins`, event: makeEvent(), want: true},
+		{name: "user not in list", when: `user in admins`, event: makeEvent(func(e *protocol.Event) { e.User = "U999" }), want: false},
+		{name: "channel matches", when: `channel_matches("#ops-.*")`, event: makeEvent(func(e *protocol.Event) { e.Channel = "#ops-alerts" }), want: true},
+		{name: "channel match is anchored", when: `channel_matches("ops-.*")`, event: makeEvent(func(e *protocol.Event) { e.Channel = "#ops-alerts" }), want: false},
+		{name: "old event", when: `age() > duration("5m")`, event: makeEvent(func(e *protocol.Event) { e.Timestamp = now.Add(-10 * time.Minute) }), want: true},
+		{name: "fresh event", when: `age() > duration("5m")`, event: makeEvent(func(e *protocol.Event) { e.Timestamp = now.Add(-time.Minute) }), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRunner(Config{Name: "test", When: tt.when, Command: Command{"claude"}, Lists: lists})
+			if err != nil {
+				t.Fatalf("new runner: %v", err)
+			}
+			if got := r.MatchesAt(tt.event, now); got != tt.want {
+				t.Errorf("MatchesAt = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRunner_HelperErrors(t *testing.T) {
+	tests := map[string]struct {
+		when  string
+		lists map[string][]string
+		err   string
+	}{
+		"invalid capture pattern": {when: `text_capture("(") != ""`, err: "invalid pattern"},
+		"invalid channel pattern": {when: `channel_matches("[")`, err: "invalid pattern"},
+		"unknown list":            {when: `user in admins`, err: "unknown name admins"},
+		"reserved list name":      {when: `notify`, lists: map[string][]string{"text": {"x"}}, err: "reserved"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewRunner(Config{Name: "test", When: tt.when, Command: Command{"claude"}, Lists: tt.lists})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestValidateListName(t *testing.T) {
+	for _, name := range []string{"admins", "on_call", "Team2"} {
+		if err := ValidateListName(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "on-call", "2fa", "user", "at", "len", "duration", "in"} {
+		if err := ValidateListName(name); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+}
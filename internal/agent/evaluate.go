@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// Evaluation is the outcome of testing a when expression against one event.
+type Evaluation struct {
+	// Matched is the value of the expression. An agent only triggers when
+	// Skipped is empty as well.
+	Matched bool
+	// Skipped is set when the event could never trigger an agent, whatever
+	// the expression says (outbound messages, the bot's own messages, ...).
+	Skipped string
+	// Error is the runtime error of the expression, if any. A runner treats
+	// it as no match.
+	Error string
+	// Env holds the fields and lists the expression saw, keyed by their
+	// names in the expression.
+	Env map[string]any
+}
+
+// Evaluate compiles when and evaluates it against event the same way a
+// runner does, using now for the time fields of tick events and for age().
+// It is meant for debugging triggers: only an invalid expression is an
+// error, runtime errors are reported in the result. includeSelf is the
+// agent's include_self setting.
+func Evaluate(when string, lists map[string][]string, event protocol.Event, now time.Time, includeSelf bool) (Evaluation, error) {
+	program, pats, err := compileWhen(when, lists)
+	if err != nil {
+		return Evaluation{}, fmt.Errorf("invalid when expression: %w", err)
+	}
+
+	env := newExprEnv(event, now, lists, pats)
+	eval := Evaluation{
+		Skipped: skipReason(event, includeSelf),
+		Env:     make(map[string]any, len(exprFields)+len(lists)),
+	}
+	for _, name := range exprFields {
+		eval.Env[name] = env[name]
+	}
+	for name, values := range lists {
+		eval.Env[name] = values
+	}
+
+	result, err := expr.Run(program, env)
+	if err != nil {
+		eval.Error = err.Error()
+		return eval, nil
+	}
+
+	match, ok := result.(bool)
+	eval.Matched = ok && match
+	return eval, nil
+}
@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func TestEvaluate(t *testing.T) {
+	monday9 := time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name    string
+		when    string
+		event   protocol.Event
+		matched bool
+		skipped bool
+		errored bool
+	}{
+		{name: "default is notify", when: "", event: makeEvent(), matched: true},
+		{name: "text match", when: `direct && text matches "deploy"`, event: makeEvent(func(e *protocol.Event) { e.Direct = true; e.Text = "deploy prod" }), matched: true},
+		{name: "no match", when: `direct && text matches "deploy"`, event: makeEvent(), matched: false},
+		{name: "tick at", when: `at("9:00") && weekday == "mon"`, event: makeTickEvent(), matched: true},
+		{name: "own message is skipped", when: "true", event: makeEvent(func(e *protocol.Event) { e.Self = true }), matched: true, skipped: true},
+		{name: "outbound is skipped", when: "notify", event: makeEvent(func(e *protocol.Event) { e.Direction = "out" }), matched: true, skipped: true},
+		{name: "runtime error", when: `every("5x")`, event: makeTickEvent(), errored: true},
+		{name: "classified urgent", when: `priority == "urgent" && "outage" in labels`, event: makeEvent(func(e *protocol.Event) { e.Priority = "urgent"; e.Labels = []string{"outage"} }), matched: true},
+		{name: "translated", when: `language == "es" && translated_text contains "refund"`, event: makeEvent(func(e *protocol.Event) { e.TranslatedText = "I want a refund"; e.Language = "es" }), matched: true},
+		{name: "unclassified", when: `priority == "urgent" || "outage" in labels`, event: makeEvent(), matched: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eval, err := Evaluate(tt.when, nil, tt.event, monday9, false)
+			if err != nil {
+				t.Fatalf("evaluate: %v", err)
+			}
+			if eval.Matched != tt.matched {
+				t.Errorf("matched = %v, want %v", eval.Matched, tt.matched)
+			}
+			if (eval.Skipped != "") != tt.skipped {
+				t.Errorf("skipped = %q, want skipped %v", eval.Skipped, tt.skipped)
+			}
+			if (eval.Error != "") != tt.errored {
+				t.Errorf("error = %q, want error %v", eval.Error, tt.errored)
+			}
+		})
+	}
+}
+
+func TestEvaluate_Env(t *testing.T) {
+	eval, err := Evaluate("tick", nil, makeTickEvent(), time.Date(2026, 3, 4, 17, 30, 0, 0, time.Local), false)
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if eval.Env["hour"] != 17 || eval.Env["minute"] != 30 || eval.Env["weekday"] != "wed" || eval.Env["tick"] != true {
+		t.Errorf("unexpected time fields: %+v", eval.Env)
+	}
+
+	eval, err = Evaluate("notify", nil, makeEvent(), time.Now(), false)
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if eval.Env["user"] != "U123" || eval.Env["channel"] != "#general" || eval.Env["hour"] != 0 {
+		t.Errorf("unexpected message fields: %+v", eval.Env)
+	}
+}
+
+func TestEvaluate_InvalidExpression(t *testing.T) {
+	if _, err := Evaluate("text +", nil, makeEvent(), time.Now(), false); err == nil {
+		t.Fatal("expected compile error")
+	}
+	if _, err := Evaluate(`"not a bool"`, nil, makeEvent(), time.Now(), false); err == nil {
+		t.Fatal("expected error for a non-boolean expression")
+	}
+}
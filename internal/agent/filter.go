@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// Filter is a compiled expression for filtering an event stream. It sees the
+// same fields, functions and lists as a when expression, but unlike a runner
+// it does not skip outbound or self-authored events, so kind and direction
+// are up to the expression.
+type Filter struct {
+	program  *vm.Program
+	patterns *patterns
+	lists    map[string][]string
+}
+
+// NewFilter compiles expression. An invalid expression or pattern is an
+// error; unlike a when expression, an empty one is rejected too.
+func NewFilter(expression string, lists map[string][]string) (*Filter, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, fmt.Errorf("filter expression is empty")
+	}
+	program, pats, err := compileWhen(expression, lists)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter expression: %w", err)
+	}
+	return &Filter{program: program, patterns: pats, lists: lists}, nil
+}
+
+// Match reports whether event passes the filter. A runtime error counts as
+// no match.
+func (f *Filter) Match(event protocol.Event) bool {
+	result, err := expr.Run(f.program, newExprEnv(event, time.Now(), f.lists, f.patterns))
+	if err != nil {
+		return false
+	}
+	match, ok := result.(bool)
+	return ok && match
+}
@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func TestFilter(t *testing.T) {
+	lists := map[string][]string{"chat": {"slack", "discord"}}
+
+	tests := []struct {
+		name       string
+		expression string
+		event      protocol.Event
+		want       bool
+	}{
+		{name: "notify and text", expression: `notify && text matches "error"`, event: makeEvent(func(e *protocol.Event) { e.Text = "disk error" }), want: true},
+		{name: "text mismatch", expression: `notify && text matches "error"`, event: makeEvent(), want: false},
+		{name: "service list", expression: `service in ["slack", "discord"]`, event: makeEvent(), want: true},
+		{name: "config list", expression: `service in chat`, event: makeEvent(func(e *protocol.Event) { e.Service = "telegram" }), want: false},
+		{name: "outbound is not skipped", expression: `direction == "out"`, event: makeEvent(func(e *protocol.Event) { e.Direction = "out" }), want: true},
+		{name: "runtime error drops", expression: `every("5x")`, event: makeEvent(), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := NewFilter(tt.expression, lists)
+			if err != nil {
+				t.Fatalf("new filter: %v", err)
+			}
+			if got := filter.Match(tt.event); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFilter_Invalid(t *testing.T) {
+	for _, expression := range []string{"", "text +", `"not a bool"`, `text_capture("(") != ""`} {
+		if _, err := NewFilter(expression, nil); err == nil {
+			t.Errorf("NewFilter(%q): expected error", expression)
+		}
+	}
+}
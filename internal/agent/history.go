@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// RecordFunc stores a finished run. The server supplies it to keep run
+// history in the database.
+type RecordFunc func(run protocol.AgentRun)
+
+// maxRecordedOutput caps how much output is kept per recorded run; the tail
+// is kept because that is where errors usually are.
+const maxRecordedOutput = 4000
+
+// SetRecordFunc sets where finished runs are reported. Without one, runs
+// are only logged.
+func (r *Runner) SetRecordFunc(fn RecordFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record = fn
+}
+
+// State reports whether the command is running and how many events are
+// buffered for the next run.
+func (r *Runner) State() (running bool, pending int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.running, len(r.pending)
+}
+
+// recordRun reports a finished run to the record func, if any.
+func (r *Runner) recordRun(started time.Time, triggers int, runErr error, ctxErr error, output string) {
+	r.mu.Lock()
+	record := r.record
+	r.mu.Unlock()
+
+	if record == nil {
+		return
+	}
+
+	run := protocol.AgentRun{
+		Agent:      r.cfg.Name,
+		StartedAt:  started.UTC(),
+		FinishedAt: time.Now().UTC(),
+		Triggers:   triggers,
+		Output:     tail(output, maxRecordedOutput),
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case runErr == nil:
+	case errors.Is(ctxErr, context.DeadlineExceeded):
+		run.ExitCode = exitCode(runErr)
+		run.Error = fmt.Sprintf("timed out after %ds", r.cfg.Timeout)
+	case errors.As(runErr, &exitErr):
+		run.ExitCode = exitErr.ExitCode()
+		run.Error = runErr.Error()
+	default:
+		run.ExitCode = -1
+		run.Error = runErr.Error()
+	}
+
+	record(run)
+}
+
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// tail returns the last max bytes of s, marked when cut.
+func tail(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	cut := len(s) - max
+	for cut < len(s) && !utf8.RuneStart(s[cut]) {
+		cut++
+	}
+	return "..." + s[cut:]
+}
@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func TestRun_RecordsRuns(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  Command
+		timeout  int
+		exitCode int
+		err      string
+		output   string
+	}{
+		{name: "success", command: Command{"sh", "-c", "echo done"}, exitCode: 0, output: "done"},
+		{name: "failure", command: Command{"sh", "-c", "echo broken >&2; exit 3"}, exitCode: 3, err: "exit status 3", output: "broken"},
+		{name: "missing binary", command: Command{"pantalk-no-such-agent"}, exitCode: -1, err: "executable file not found"},
+		{name: "timeout", command: Command{"sleep", "5"}, timeout: 1, exitCode: -1, err: "timed out after 1s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRunner(Config{Name: "reviewer", Command: tt.command, Timeout: tt.timeout})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var runs []protocol.AgentRun
+			r.SetRecordFunc(func(run protocol.AgentRun) { runs = append(runs, run) })
+
+			r.run([]protocol.Event{makeEvent(), makeTickEvent()})
+
+			if len(runs) != 1 {
+				t.Fatalf("expected one recorded run, got %d", len(runs))
+			}
+			run := runs[0]
+			if run.Agent != "reviewer" || run.Triggers != 2 {
+				t.Errorf("unexpected run: %+v", run)
+			}
+			if run.ExitCode != tt.exitCode {
+				t.Errorf("exit code = %d, want %d", run.ExitCode, tt.exitCode)
+			}
+			if !strings.Contains(run.Error, tt.err) || (tt.err == "" && run.Error != "") {
+				t.Errorf("error = %q, want %q", run.Error, tt.err)
+			}
+			if strings.TrimSpace(run.Output) != tt.output {
+				t.Errorf("output = %q, want %q", run.Output, tt.output)
+			}
+			if run.FinishedAt.Before(run.StartedAt) {
+				t.Errorf("finished before started: %+v", run)
+			}
+		})
+	}
+}
+
+func TestTail(t *testing.T) {
+	if got := tail("short", 10); got != "short" {
+		t.Errorf("tail kept %q", got)
+	}
+	if got := tail("0123456789", 4); got != "...6789" {
+		t.Errorf("tail = %q", got)
+	}
+	// Never cut inside a multi-byte character.
+	if got := tail("aé", 1); got != "..." {
+		t.Errorf("tail split a rune: %q", got)
+	}
+}
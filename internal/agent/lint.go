@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// NeverTrue reports whether a when expression is false for every event the
+// bots could deliver, e.g. `kind == "mesage"` or `bot == "gone"`. Such
+// comparisons are replaced by their constant result and the expression is
+// folded; only an expression that folds to false counts, so the check never
+// flags an agent that could run.
+func NeverTrue(when string, lists map[string][]string, bots []protocol.BotRef) (bool, error) {
+	if _, _, err := compileWhen(when, lists); err != nil {
+		return false, err
+	}
+	if strings.TrimSpace(when) == "" {
+		when = "notify"
+	}
+
+	// Ticks have no service, bot or direction.
+	values := map[string][]string{
+		"kind":      {"message", protocol.KindInteraction, protocol.KindEdit, protocol.KindDelete, protocol.KindReaction, "tick"},
+		"direction": {"", "in", "out"},
+		"weekday":   {"", "mon", "tue", "wed", "thu", "fri", "sat", "sun"},
+		"service":   {""},
+		"bot":       {""},
+	}
+	for _, bot := range bots {
+		values["service"] = append(values["service"], bot.Service)
+		values["bot"] = append(values["bot"], bot.Name)
+	}
+
+	program, err := expr.Compile(when,
+		expr.Env(newExprEnv(protocol.Event{}, time.Time{}, lists, &patterns{})),
+		expr.AsBool(),
+		expr.Patch(&impossibleComparisons{values: values}),
+	)
+	if err != nil {
+		return false, err
+	}
+	folded, ok := program.Node().(*ast.BoolNode)
+	return ok && !folded.Value, nil
+}
+
+// impossibleComparisons replaces comparisons of a field with values it
+// never takes by false (true for !=).
+type impossibleComparisons struct {
+	values map[string][]string
+}
+
+func (c *impossibleComparisons) Visit(node *ast.Node) {
+	binary, ok := (*node).(*ast.BinaryNode)
+	if !ok {
+		return
+	}
+
+	switch binary.Operator {
+	case "==", "!=":
+		field, literal, ok := fieldAndString(binary.Left, binary.Right)
+		if !ok {
+			field, literal, ok = fieldAndString(binary.Right, binary.Left)
+		}
+		if !ok || c.possible(field, literal) {
+			return
+		}
+		ast.Patch(node, &ast.BoolNode{Value: binary.Operator == "!="})
+	case "in":
+		field, isField := binary.Left.(*ast.IdentifierNode)
+		array, isArray := binary.Right.(*ast.ArrayNode)
+		if !isField || !isArray {
+			return
+		}
+		if _, known := c.values[field.Value]; !known {
+			return
+		}
+		for _, element := range array.Nodes {
+			literal, ok := element.(*ast.StringNode)
+			if !ok || c.possible(field.Value, literal.Value) {
+				return
+			}
+		}
+		ast.Patch(node, &ast.BoolNode{Value: false})
+	}
+}
+
+func (c *impossibleComparisons) possible(field string, value string) bool {
+	values, known := c.values[field]
+	return !known || slices.Contains(values, value)
+}
+
+func fieldAndString(a ast.Node, b ast.Node) (string, string, bool) {
+	field, ok := a.(*ast.IdentifierNode)
+	if !ok {
+		return "", "", false
+	}
+	literal, ok := b.(*ast.StringNode)
+	if !ok {
+		return "", "", false
+	}
+	return field.Value, literal.Value, true
+}
@@ -0,0 +1,46 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func TestNeverTrue(t *testing.T) {
+	bots := []protocol.BotRef{{Service: "slack", Name: "ops"}, {Service: "discord", Name: "community"}}
+	lists := map[string][]string{"oncall": {"U1"}}
+
+	tests := []struct {
+		when string
+		want bool
+	}{
+		{when: "", want: false},
+		{when: "notify && channel == \"C1\"", want: false},
+		{when: "kind == \"mesage\"", want: true},
+		{when: "kind == \"mesage\" || direct", want: false},
+		{when: "direct && service == \"telegram\"", want: true},
+		{when: "bot != \"gone\" && mentions", want: false},
+		{when: "bot == \"gone\" && mentions", want: true},
+		{when: "kind in [\"click\", \"tap\"]", want: true},
+		{when: "kind in [\"click\", \"reaction\"]", want: false},
+		{when: "weekday == \"monday\" && at(\"09:00\")", want: true},
+		{when: "user in oncall && service == \"slack\"", want: false},
+		{when: "false", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.when, func(t *testing.T) {
+			got, err := NeverTrue(tt.when, lists, bots)
+			if err != nil {
+				t.Fatalf("NeverTrue: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("NeverTrue(%q) = %v, want %v", tt.when, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NeverTrue("kind ==", lists, bots); err == nil {
+		t.Fatal("expected an invalid expression to fail")
+	}
+}
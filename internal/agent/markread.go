@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// MarkReadFunc marks a conversation read upstream through the request's
+// stored EventID. The server supplies it.
+type MarkReadFunc func(ctx context.Context, req protocol.Request) error
+
+// markReadTimeout bounds marking all conversations of one run.
+const markReadTimeout = 30 * time.Second
+
+// SetMarkReadFunc sets how the runner marks conversations read when
+// mark_read is enabled. Without one, mark_read is a no-op.
+func (r *Runner) SetMarkReadFunc(fn MarkReadFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.markRead = fn
+}
+
+// markConversationsRead marks each channel the events came from read up to
+// its newest triggering message. Ticks and unstored events are skipped.
+func (r *Runner) markConversationsRead(events []protocol.Event) {
+	r.mu.Lock()
+	mark := r.markRead
+	r.mu.Unlock()
+	if mark == nil {
+		return
+	}
+
+	type conversation struct{ service, bot, channel string }
+	newest := make(map[conversation]int64)
+	var order []conversation
+	for _, event := range events {
+		if event.Kind == "tick" || event.ID <= 0 || event.Channel == "" {
+			continue
+		}
+		key := conversation{event.Service, event.Bot, event.Channel}
+		if _, seen := newest[key]; !seen {
+			order = append(order, key)
+		}
+		if event.ID > newest[key] {
+			newest[key] = event.ID
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), markReadTimeout)
+	defer cancel()
+
+	for _, key := range order {
+		req := protocol.Request{
+			Action:  protocol.ActionMarkRead,
+			Service: key.service,
+			Bot:     key.bot,
+			EventID: newest[key],
+		}
+		if err := mark(ctx, req); err != nil {
+			log.Printf("[agent:%s] mark read of %s failed: %v", r.cfg.Name, key.channel, err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func TestRun_MarksConversationsRead(t *testing.T) {
+	r, err := NewRunner(Config{Name: "test", Command: Command{"true"}, Timeout: 5, MarkRead: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var marked []protocol.Request
+	r.SetMarkReadFunc(func(_ context.Context, req protocol.Request) error {
+		marked = append(marked, req)
+		return nil
+	})
+
+	r.run([]protocol.Event{
+		makeEvent(func(e *protocol.Event) { e.ID = 10 }),
+		makeEvent(func(e *protocol.Event) { e.ID = 12; e.Channel = "#ops" }),
+		makeEvent(func(e *protocol.Event) { e.ID = 14 }),
+		makeEvent(), // not stored, nothing to mark through
+		makeTickEvent(),
+	})
+
+	if len(marked) != 2 {
+		t.Fatalf("expected one mark per channel, got %+v", marked)
+	}
+	if req := marked[0]; req.Action != protocol.ActionMarkRead || req.Bot != "test-bot" || req.Service != "slack" || req.EventID != 14 {
+		t.Fatalf("expected #general marked through its newest event, got %+v", req)
+	}
+	if marked[1].EventID != 12 {
+		t.Fatalf("expected #ops marked through event 12, got %+v", marked[1])
+	}
+}
+
+func TestRun_NoMarkReadOnFailureOrWhenDisabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		markRead bool
+	}{
+		{name: "failed run", script: "exit 1", markRead: true},
+		{name: "disabled", script: "true", markRead: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRunner(Config{Name: "test", Command: Command{"sh", "-c", tt.script}, Timeout: 5, MarkRead: tt.markRead})
+			if err != nil {
+				t.Fatal(err)
+			}
+			called := false
+			r.SetMarkReadFunc(func(context.Context, protocol.Request) error {
+				called = true
+				return nil
+			})
+
+			r.run([]protocol.Event{makeEvent(func(e *protocol.Event) { e.ID = 1 })})
+			if called {
+				t.Fatal("unexpected mark read")
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// ReplyFunc sends one message on behalf of an agent. The server supplies it
+// so replies go through the same path as pantalk send.
+type ReplyFunc func(ctx context.Context, req protocol.Request) error
+
+// ReplyData is passed to reply templates.
+type ReplyData struct {
+	Agent   string
+	Output  string // trimmed stdout of the command
+	Service string
+	Bot     string
+	Channel string
+	Thread  string
+	User    string // author of the triggering message
+	Text    string // text of the triggering message
+}
+
+// replyTimeout bounds posting one reply.
+const replyTimeout = 30 * time.Second
+
+// SetReplyFunc sets how the runner posts command output when reply is
+// enabled. Without one, reply is a no-op.
+func (r *Runner) SetReplyFunc(fn ReplyFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reply = fn
+}
+
+func compileReplyTemplate(cfg Config) (*template.Template, error) {
+	if !cfg.Reply {
+		if strings.TrimSpace(cfg.ReplyTemplate) != "" {
+			return nil, fmt.Errorf("agent %q: reply_template requires reply: true", cfg.Name)
+		}
+		if cfg.ThreadReplies {
+			return nil, fmt.Errorf("agent %q: thread_replies requires reply: true", cfg.Name)
+		}
+		return nil, nil
+	}
+
+	text := cfg.ReplyTemplate
+	if strings.TrimSpace(text) == "" {
+		text = "{{.Output}}"
+	}
+	tmpl, err := template.New(cfg.Name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("agent %q: invalid reply_template: %w", cfg.Name, err)
+	}
+	return tmpl, nil
+}
+
+// postReply sends the command's stdout to the conversation of the most
+// recent triggering message. Clock ticks have nowhere to reply to.
+func (r *Runner) postReply(events []protocol.Event, stdout string) {
+	r.mu.Lock()
+	send := r.reply
+	r.mu.Unlock()
+
+	output := strings.TrimSpace(stdout)
+	if send == nil || r.replyTemplate == nil || output == "" {
+		return
+	}
+
+	var trigger protocol.Event
+	for _, event := range events {
+		if event.Kind != "tick" {
+			trigger = event
+		}
+	}
+	if trigger.Bot == "" {
+		log.Printf("[agent:%s] reply skipped: no message to reply to", r.cfg.Name)
+		return
+	}
+
+	var text strings.Builder
+	if err := r.replyTemplate.Execute(&text, ReplyData{
+		Agent:   r.cfg.Name,
+		Output:  output,
+		Service: trigger.Service,
+		Bot:     trigger.Bot,
+		Channel: trigger.Channel,
+		Thread:  trigger.Thread,
+		User:    trigger.User,
+		Text:    trigger.Text,
+	}); err != nil {
+		log.Printf("[agent:%s] reply template failed: %v", r.cfg.Name, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), replyTimeout)
+	defer cancel()
+
+	// Connectors set Target to the canonical reply address, so prefer it
+	// over the raw channel. Output longer than one message of the platform
+	// is split by the connector, as for pantalk send.
+	req := protocol.Request{
+		Action:  protocol.ActionSend,
+		Service: trigger.Service,
+		Bot:     trigger.Bot,
+		Target:  trigger.Target,
+		Thread:  trigger.Thread,
+		Text:    text.String(),
+	}
+	if req.Target == "" {
+		req.Channel = trigger.Channel
+	}
+	// The daemon picks the thread: the trigger's, or one on it.
+	if r.cfg.ThreadReplies && trigger.ID > 0 {
+		req.ReplyTo = trigger.ID
+	}
+
+	if err := send(ctx, req); err != nil {
+		log.Printf("[agent:%s] reply failed: %v", r.cfg.Name, err)
+		return
+	}
+	log.Printf("[agent:%s] replied on %s/%s", r.cfg.Name, trigger.Service, trigger.Bot)
+}
@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func TestRun_RepliesWithStdout(t *testing.T) {
+	r, err := NewRunner(Config{
+		Name:          "test",
+		Command:       Command{"sh", "-c", `echo "deploy is green"; echo "noise" >&2`},
+		Timeout:       5,
+		Reply:         true,
+		ReplyTemplate: "{{.User}}: {{.Output}}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sent []protocol.Request
+	r.SetReplyFunc(func(_ context.Context, req protocol.Request) error {
+		sent = append(sent, req)
+		return nil
+	})
+
+	r.run([]protocol.Event{makeEvent(func(e *protocol.Event) { e.Thread = "T1" }), makeTickEvent()})
+
+	if len(sent) != 1 {
+		t.Fatalf("expected one reply, got %+v", sent)
+	}
+	req := sent[0]
+	if req.Action != protocol.ActionSend || req.Bot != "test-bot" || req.Channel != "#general" || req.Thread != "T1" {
+		t.Fatalf("reply not addressed to the triggering conversation: %+v", req)
+	}
+	if req.Text != "U123: deploy is green" {
+		t.Fatalf("expected templated stdout without stderr, got %q", req.Text)
+	}
+}
+
+func TestRun_LongReplyLeftToTheConnector(t *testing.T) {
+	r, err := NewRunner(Config{Name: "test", Command: Command{"sh", "-c", `for i in $(seq 2000); do echo "line $i"; done`}, Timeout: 5, Reply: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sent []protocol.Request
+	r.SetReplyFunc(func(_ context.Context, req protocol.Request) error {
+		sent = append(sent, req)
+		return nil
+	})
+
+	r.run([]protocol.Event{makeEvent()})
+
+	if len(sent) != 1 || !strings.HasPrefix(sent[0].Text, "line 1\n") || !strings.HasSuffix(sent[0].Text, "line 2000") {
+		t.Fatalf("expected the whole output in one send, got %d sends", len(sent))
+	}
+}
+
+func TestRun_ThreadReplies(t *testing.T) {
+	r, err := NewRunner(Config{Name: "test", Command: Command{"echo", "on it"}, Timeout: 5, Reply: true, ThreadReplies: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sent []protocol.Request
+	r.SetReplyFunc(func(_ context.Context, req protocol.Request) error {
+		sent = append(sent, req)
+		return nil
+	})
+
+	r.run([]protocol.Event{makeEvent(func(e *protocol.Event) { e.ID = 42 })})
+
+	if len(sent) != 1 || sent[0].ReplyTo != 42 || sent[0].Channel != "#general" {
+		t.Fatalf("expected the reply threaded onto event 42, got %+v", sent)
+	}
+}
+
+func TestRun_NoReplyOnFailureOrEmptyOutput(t *testing.T) {
+	for _, script := range []string{`echo partial; exit 1`, `true`} {
+		r, err := NewRunner(Config{Name: "test", Command: Command{"sh", "-c", script}, Timeout: 5, Reply: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		called := false
+		r.SetReplyFunc(func(context.Context, protocol.Request) error {
+			called = true
+			return nil
+		})
+
+		r.run([]protocol.Event{makeEvent()})
+		if called {
+			t.Fatalf("%q: unexpected reply", script)
+		}
+	}
+}
+
+func TestNewRunner_ReplyTemplateRequiresReply(t *testing.T) {
+	_, err := NewRunner(Config{Name: "test", Command: Command{"claude"}, ReplyTemplate: "{{.Output}}"})
+	if err == nil || !strings.Contains(err.Error(), "reply_template requires reply") {
+		t.Fatalf("expected error, got: %v", err)
+	}
+
+	_, err = NewRunner(Config{Name: "test", Command: Command{"claude"}, ThreadReplies: true})
+	if err == nil || !strings.Contains(err.Error(), "thread_replies requires reply") {
+		t.Fatalf("expected error, got: %v", err)
+	}
+}
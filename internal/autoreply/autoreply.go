@@ -0,0 +1,301 @@
+// Package autoreply implements canned daemon-side replies such as
+// out-of-office or maintenance notices.
+//
+// Each rule pairs an expr condition, evaluated against inbound messages, with
+// a text/template reply. Replies are rate-limited per rule and user so a
+// chatty conversation gets one notice per cool-down rather than one per
+// message.
+package autoreply
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// DefaultCooldown is how long a user waits for the same rule to fire again
+// when the rule does not set its own cool-down.
+const DefaultCooldown = time.Hour
+
+// Rule is one auto-reply definition.
+type Rule struct {
+	Name     string
+	Channel  string // only messages on this channel; empty matches all
+	When     string // expr condition; empty matches every inbound message
+	Reply    string // text/template rendered with the triggering event
+	Cooldown time.Duration
+}
+
+// env is exposed to when expressions. Unlike agent expressions, the time
+// fields describe when the message arrived, so conditions such as
+// between("18:00", "09:00") work on ordinary messages.
+type env struct {
+	Notify   bool   `expr:"notify"`
+	Direct   bool   `expr:"direct"`
+	Mentions bool   `expr:"mentions"`
+	Channel  string `expr:"channel"`
+	Thread   string `expr:"thread"`
+	Bot      string `expr:"bot"`
+	Service  string `expr:"service"`
+	User     string `expr:"user"`
+	Text     string `expr:"text"`
+
+	Hour    int    `expr:"hour"`
+	Minute  int    `expr:"minute"`
+	Weekday string `expr:"weekday"` // "mon" ... "sun"
+
+	BetweenFn func(start string, end string) (bool, error) `expr:"between"`
+}
+
+// Data is passed to reply templates.
+type Data struct {
+	Service string
+	Bot     string
+	User    string
+	Channel string
+	Thread  string
+	Text    string
+	Time    time.Time
+}
+
+type compiled struct {
+	rule     Rule
+	program  *vm.Program
+	template *template.Template
+}
+
+// Responder evaluates a bot's rules. It is safe for concurrent use; a nil
+// Responder never replies.
+type Responder struct {
+	rules []compiled
+
+	mu      sync.Mutex
+	last    map[string]time.Time // rule name + user -> last reply sent
+	sending map[string]struct{}  // rule name + user -> a reply being sent
+}
+
+// Reply is a reply to send. The rule's cool-down starts once it is
+// reported with Sent; Failed lets the rule fire again right away.
+type Reply struct {
+	Text string
+	key  string
+}
+
+// New compiles rules. It returns a nil Responder when there are none.
+func New(rules []Rule) (*Responder, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	r := &Responder{last: make(map[string]time.Time), sending: make(map[string]struct{})}
+	seen := make(map[string]struct{}, len(rules))
+	for _, rule := range rules {
+		name := strings.TrimSpace(rule.Name)
+		if name == "" {
+			return nil, fmt.Errorf("auto_reply name cannot be empty")
+		}
+		if _, dup := seen[name]; dup {
+			return nil, fmt.Errorf("duplicate auto_reply %q", name)
+		}
+		seen[name] = struct{}{}
+
+		if strings.TrimSpace(rule.Reply) == "" {
+			return nil, fmt.Errorf("auto_reply %q requires reply", name)
+		}
+		if rule.Cooldown < 0 {
+			return nil, fmt.Errorf("auto_reply %q: cooldown must be >= 0", name)
+		}
+		if rule.Cooldown == 0 {
+			rule.Cooldown = DefaultCooldown
+		}
+
+		when := rule.When
+		if strings.TrimSpace(when) == "" {
+			when = "true"
+		}
+		program, err := expr.Compile(when, expr.Env(env{}), expr.AsBool())
+		if err != nil {
+			return nil, fmt.Errorf("auto_reply %q: invalid when expression: %w", name, err)
+		}
+
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(rule.Reply)
+		if err != nil {
+			return nil, fmt.Errorf("auto_reply %q: invalid reply template: %w", name, err)
+		}
+
+		rule.Name = name
+		r.rules = append(r.rules, compiled{rule: rule, program: program, template: tmpl})
+	}
+
+	return r, nil
+}
+
+// Reply returns the reply to send in response to event, if any rule
+// matches and the sender is not rate-limited. Only inbound messages from
+// other users are considered. The first matching rule wins; a rate-limited
+// match, or one whose reply is still being sent, stops evaluation so lower
+// rules don't fire in its place. The caller reports the outcome with Sent
+// or Failed.
+func (r *Responder) Reply(event protocol.Event, now time.Time) (Reply, bool) {
+	if r == nil || event.Kind != "message" || event.Direction != "in" || event.Self {
+		return Reply{}, false
+	}
+
+	at := event.Timestamp
+	if at.IsZero() {
+		at = now
+	}
+	local := at.Local()
+
+	e := env{
+		Notify:   event.Notify,
+		Direct:   event.Direct,
+		Mentions: event.Mentions,
+		Channel:  event.Channel,
+		Thread:   event.Thread,
+		Bot:      event.Bot,
+		Service:  event.Service,
+		User:     event.User,
+		Text:     event.Text,
+		Hour:     local.Hour(),
+		Minute:   local.Minute(),
+		Weekday:  strings.ToLower(local.Weekday().String()[:3]),
+	}
+	e.BetweenFn = func(start string, end string) (bool, error) {
+		return between(e.Hour, e.Minute, start, end)
+	}
+
+	for _, c := range r.rules {
+		if c.rule.Channel != "" && c.rule.Channel != event.Channel {
+			continue
+		}
+
+		result, err := expr.Run(c.program, e)
+		if err != nil {
+			return Reply{}, false
+		}
+		if match, ok := result.(bool); !ok || !match {
+			continue
+		}
+
+		var out strings.Builder
+		if err := c.template.Execute(&out, Data{
+			Service: event.Service,
+			Bot:     event.Bot,
+			User:    event.User,
+			Channel: event.Channel,
+			Thread:  event.Thread,
+			Text:    event.Text,
+			Time:    local,
+		}); err != nil {
+			return Reply{}, false
+		}
+
+		key := c.rule.Name + "|" + event.User
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if _, ok := r.sending[key]; ok {
+			return Reply{}, false
+		}
+		if last, ok := r.last[key]; ok && now.Sub(last) < c.rule.Cooldown {
+			return Reply{}, false
+		}
+		r.sending[key] = struct{}{}
+		return Reply{Text: out.String(), key: key}, true
+	}
+
+	return Reply{}, false
+}
+
+// Sent starts the cool-down of a reply sent at at.
+func (r *Responder) Sent(reply Reply, at time.Time) {
+	if r == nil || reply.key == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sending, reply.key)
+	r.last[reply.key] = at
+}
+
+// Failed releases a reply that could not be sent without starting its
+// cool-down.
+func (r *Responder) Failed(reply Reply) {
+	if r == nil || reply.key == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sending, reply.key)
+}
+
+// Inherit carries the cool-downs of prev, the responder a reload replaces,
+// over to r for the rules r still has, so a reload doesn't reply again to
+// users who were just answered.
+func (r *Responder) Inherit(prev *Responder) {
+	if r == nil || prev == nil || r == prev {
+		return
+	}
+	names := make(map[string]struct{}, len(r.rules))
+	for _, c := range r.rules {
+		names[c.rule.Name] = struct{}{}
+	}
+
+	prev.mu.Lock()
+	last := make(map[string]time.Time, len(prev.last))
+	for key, at := range prev.last {
+		name, _, _ := strings.Cut(key, "|")
+		if _, ok := names[name]; ok {
+			last[key] = at
+		}
+	}
+	prev.mu.Unlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, at := range last {
+		r.last[key] = at
+	}
+}
+
+// between reports whether hour:minute falls in [start, end). A window whose
+// end is earlier than its start wraps past midnight, e.g. "18:00" to "09:00".
+func between(hour int, minute int, start string, end string) (bool, error) {
+	from, err := minuteOfDay(start)
+	if err != nil {
+		return false, err
+	}
+	to, err := minuteOfDay(end)
+	if err != nil {
+		return false, err
+	}
+
+	now := hour*60 + minute
+	if from <= to {
+		return now >= from && now < to, nil
+	}
+	return now >= from || now < to, nil
+}
+
+func minuteOfDay(s string) (int, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("between(): invalid time format %q, expected HH:MM", s)
+	}
+	h, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || h < 0 || h > 23 {
+		return 0, fmt.Errorf("between(): invalid hour in %q", s)
+	}
+	m, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || m < 0 || m > 59 {
+		return 0, fmt.Errorf("between(): invalid minute in %q", s)
+	}
+	return h*60 + m, nil
+}
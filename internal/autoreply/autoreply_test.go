@@ -0,0 +1,233 @@
+package autoreply
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func inbound(user string, channel string, at time.Time) protocol.Event {
+	return protocol.Event{
+		Kind:      "message",
+		Direction: "in",
+		Service:   "slack",
+		Bot:       "ops",
+		User:      user,
+		Channel:   channel,
+		Direct:    true,
+		Timestamp: at,
+		Text:      "hello?",
+	}
+}
+
+func TestNew_Empty(t *testing.T) {
+	r, err := New(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r != nil {
+		t.Fatal("expected nil responder for no rules")
+	}
+	if _, ok := r.Reply(inbound("U1", "D1", time.Now()), time.Now()); ok {
+		t.Fatal("nil responder replied")
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+		want  string
+	}{
+		{"empty name", []Rule{{Reply: "x"}}, "name cannot be empty"},
+		{"duplicate", []Rule{{Name: "ooo", Reply: "x"}, {Name: "ooo", Reply: "y"}}, "duplicate"},
+		{"missing reply", []Rule{{Name: "ooo"}}, "requires reply"},
+		{"negative cooldown", []Rule{{Name: "ooo", Reply: "x", Cooldown: -time.Second}}, "cooldown"},
+		{"bad expression", []Rule{{Name: "ooo", Reply: "x", When: "direct &&"}}, "invalid when expression"},
+		{"non-bool expression", []Rule{{Name: "ooo", Reply: "x", When: "hour"}}, "invalid when expression"},
+		{"bad template", []Rule{{Name: "ooo", Reply: "{{.User"}}, "invalid reply template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.rules)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got: %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestReply_OvernightDirectMessages(t *testing.T) {
+	r, err := New([]Rule{{
+		Name:  "overnight",
+		When:  `direct && between("18:00", "09:00")`,
+		Reply: "Hi {{.User}}, the team is offline until 9:00, your message is queued.",
+	}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	night := time.Date(2026, 3, 4, 23, 30, 0, 0, time.Local)
+	day := time.Date(2026, 3, 4, 11, 0, 0, 0, time.Local)
+
+	reply, ok := r.Reply(inbound("U1", "D1", night), night)
+	if !ok {
+		t.Fatal("expected a reply overnight")
+	}
+	if reply.Text != "Hi U1, the team is offline until 9:00, your message is queued." {
+		t.Fatalf("unexpected reply: %q", reply.Text)
+	}
+
+	if _, ok := r.Reply(inbound("U2", "D2", day), day); ok {
+		t.Fatal("replied during working hours")
+	}
+
+	channelMsg := inbound("U3", "C1", night)
+	channelMsg.Direct = false
+	if _, ok := r.Reply(channelMsg, night); ok {
+		t.Fatal("replied to a non-direct message")
+	}
+}
+
+func TestReply_RateLimitedPerUser(t *testing.T) {
+	r, err := New([]Rule{{Name: "maintenance", Reply: "down for maintenance", Cooldown: 10 * time.Minute}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	now := time.Date(2026, 3, 4, 12, 0, 0, 0, time.Local)
+
+	reply, ok := r.Reply(inbound("U1", "D1", now), now)
+	if !ok {
+		t.Fatal("expected first reply")
+	}
+	r.Sent(reply, now)
+	if _, ok := r.Reply(inbound("U1", "D1", now), now.Add(time.Minute)); ok {
+		t.Fatal("same user replied to again within cool-down")
+	}
+	if _, ok := r.Reply(inbound("U2", "D2", now), now.Add(time.Minute)); !ok {
+		t.Fatal("other user was rate-limited")
+	}
+	if _, ok := r.Reply(inbound("U1", "D1", now), now.Add(11*time.Minute)); !ok {
+		t.Fatal("expected reply after cool-down")
+	}
+}
+
+func TestReply_CooldownStartsOnceSent(t *testing.T) {
+	r, err := New([]Rule{{Name: "maintenance", Reply: "down for maintenance", Cooldown: 10 * time.Minute}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	now := time.Date(2026, 3, 4, 12, 0, 0, 0, time.Local)
+	reply, ok := r.Reply(inbound("U1", "D1", now), now)
+	if !ok {
+		t.Fatal("expected first reply")
+	}
+	if _, ok := r.Reply(inbound("U1", "D1", now), now); ok {
+		t.Fatal("replied again while the first reply was being sent")
+	}
+
+	r.Failed(reply)
+	reply, ok = r.Reply(inbound("U1", "D1", now), now.Add(time.Minute))
+	if !ok {
+		t.Fatal("expected a failed reply not to start the cool-down")
+	}
+	r.Sent(reply, now.Add(time.Minute))
+	if _, ok := r.Reply(inbound("U1", "D1", now), now.Add(2*time.Minute)); ok {
+		t.Fatal("expected the cool-down once the reply was sent")
+	}
+}
+
+func TestInherit_KeepsCooldownsAcrossReloads(t *testing.T) {
+	rules := []Rule{{Name: "maintenance", Reply: "down for maintenance", Cooldown: 10 * time.Minute}}
+	prev, err := New(rules)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	now := time.Date(2026, 3, 4, 12, 0, 0, 0, time.Local)
+	reply, _ := prev.Reply(inbound("U1", "D1", now), now)
+	prev.Sent(reply, now)
+
+	next, err := New(append(rules, Rule{Name: "other", Reply: "hi"}))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	next.Inherit(prev)
+	if _, ok := next.Reply(inbound("U1", "D1", now), now.Add(time.Minute)); ok {
+		t.Fatal("expected the cool-down carried over the reload")
+	}
+}
+
+func TestReply_ChannelFilterAndOrdering(t *testing.T) {
+	r, err := New([]Rule{
+		{Name: "support", Channel: "C-support", Reply: "support is closed"},
+		{Name: "fallback", Reply: "we'll get back to you"},
+	})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	now := time.Now()
+	if reply, _ := r.Reply(inbound("U1", "C-support", now), now); reply.Text != "support is closed" {
+		t.Fatalf("expected channel rule, got %q", reply.Text)
+	}
+	if reply, _ := r.Reply(inbound("U1", "C-general", now), now); reply.Text != "we'll get back to you" {
+		t.Fatalf("expected fallback rule, got %q", reply.Text)
+	}
+}
+
+func TestReply_IgnoresOutboundAndSelf(t *testing.T) {
+	r, err := New([]Rule{{Name: "any", Reply: "hi"}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	now := time.Now()
+	out := inbound("U1", "D1", now)
+	out.Direction = "out"
+	if _, ok := r.Reply(out, now); ok {
+		t.Fatal("replied to an outbound message")
+	}
+
+	self := inbound("BOT", "D1", now)
+	self.Self = true
+	if _, ok := r.Reply(self, now); ok {
+		t.Fatal("replied to its own message")
+	}
+}
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		hour, minute int
+		start, end   string
+		want         bool
+	}{
+		{10, 0, "09:00", "17:00", true},
+		{17, 0, "09:00", "17:00", false},
+		{23, 0, "18:00", "09:00", true},
+		{8, 59, "18:00", "09:00", true},
+		{9, 0, "18:00", "09:00", false},
+	}
+
+	for _, tt := range tests {
+		got, err := between(tt.hour, tt.minute, tt.start, tt.end)
+		if err != nil {
+			t.Fatalf("between(%s, %s): %v", tt.start, tt.end, err)
+		}
+		if got != tt.want {
+			t.Errorf("%02d:%02d in [%s, %s) = %v, want %v", tt.hour, tt.minute, tt.start, tt.end, got, tt.want)
+		}
+	}
+
+	if _, err := between(0, 0, "25:00", "09:00"); err == nil {
+		t.Fatal("expected error for invalid hour")
+	}
+}
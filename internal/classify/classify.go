@@ -0,0 +1,189 @@
+// Package classify rates notifications with a local command or an HTTP
+// endpoint, so agents and pushes can tell an outage report from small talk
+// without keyword lists in the config.
+//
+// The classifier gets the notification as protocol.Event JSON - on stdin
+// for a command, as the POST body for an endpoint - and answers with
+//
+//	{"priority": "urgent", "labels": ["outage", "billing"]}
+//
+// or just the priority word, which keeps shell classifiers short.
+package classify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// DefaultTimeout bounds one classification when Config.Timeout is zero.
+// Notifications wait for their classification, so it is kept short.
+const DefaultTimeout = 10 * time.Second
+
+// maxResponse bounds what is read from a classifier.
+const maxResponse = 64 << 10
+
+// Config selects the classifier. Exactly one of Command and Endpoint must
+// be set.
+type Config struct {
+	Command []string
+
+	Endpoint string
+	APIKey   string // sent as a bearer token (optional)
+
+	Timeout time.Duration
+}
+
+// Result is a classification.
+type Result struct {
+	Priority string   `json:"priority"` // one of the protocol.Priority constants
+	Labels   []string `json:"labels,omitempty"`
+}
+
+// Classifier runs classifications. It is safe for concurrent use.
+type Classifier struct {
+	cfg        Config
+	httpClient *http.Client
+}
+
+// New validates cfg and returns a Classifier.
+func New(cfg Config) (*Classifier, error) {
+	hasCommand := len(cfg.Command) > 0
+	hasEndpoint := strings.TrimSpace(cfg.Endpoint) != ""
+	if hasCommand == hasEndpoint {
+		return nil, errors.New("classifier requires exactly one of command or endpoint")
+	}
+	if cfg.Timeout < 0 {
+		return nil, errors.New("classifier timeout must be >= 0")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	cfg.Endpoint = strings.TrimSpace(cfg.Endpoint)
+
+	return &Classifier{
+		cfg:        cfg,
+		httpClient: &http.Client{},
+	}, nil
+}
+
+// Classify returns the priority and labels for event.
+func (c *Classifier) Classify(ctx context.Context, event protocol.Event) (Result, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return Result{}, fmt.Errorf("encode event: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	var output []byte
+	if len(c.cfg.Command) > 0 {
+		output, err = c.runCommand(ctx, payload)
+	} else {
+		output, err = c.postEndpoint(ctx, payload)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	return Parse(output)
+}
+
+func (c *Classifier) runCommand(ctx context.Context, payload []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.cfg.Command[0], c.cfg.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if detail := strings.TrimSpace(stderr.String()); detail != "" {
+			return nil, fmt.Errorf("classifier command: %w: %s", err, lastLine(detail))
+		}
+		return nil, fmt.Errorf("classifier command: %w", err)
+	}
+	if stdout.Len() > maxResponse {
+		return nil, fmt.Errorf("classifier command printed more than %d bytes", maxResponse)
+	}
+	return stdout.Bytes(), nil
+}
+
+func (c *Classifier) postEndpoint(ctx context.Context, payload []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("build classifier request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.APIKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("classifier request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return nil, fmt.Errorf("read classifier response: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("classifier request: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// Parse reads a classifier's answer: a JSON Result or a bare priority. A
+// missing priority is normal; labels are trimmed, kept to one line and
+// deduplicated.
+func Parse(output []byte) (Result, error) {
+	output = bytes.TrimSpace(output)
+
+	var result Result
+	if len(output) > 0 && output[0] == '{' {
+		if err := json.Unmarshal(output, &result); err != nil {
+			return Result{}, fmt.Errorf("decode classification: %w", err)
+		}
+	} else {
+		result.Priority = string(output)
+	}
+
+	result.Priority = strings.ToLower(strings.TrimSpace(result.Priority))
+	switch result.Priority {
+	case "":
+		result.Priority = protocol.PriorityNormal
+	case protocol.PriorityLow, protocol.PriorityNormal, protocol.PriorityUrgent:
+	default:
+		return Result{}, fmt.Errorf("unknown priority %q (expected %s, %s or %s)", result.Priority, protocol.PriorityLow, protocol.PriorityNormal, protocol.PriorityUrgent)
+	}
+
+	labels := make([]string, 0, len(result.Labels))
+	for _, label := range result.Labels {
+		label = strings.TrimSpace(strings.ReplaceAll(label, "\n", " "))
+		if label != "" && !slices.Contains(labels, label) {
+			labels = append(labels, label)
+		}
+	}
+	result.Labels = nil
+	if len(labels) > 0 {
+		result.Labels = labels
+	}
+	return result, nil
+}
+
+func lastLine(text string) string {
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+		return text[i+1:]
+	}
+	return text
+}
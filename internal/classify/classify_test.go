@@ -0,0 +1,142 @@
+package classify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func TestNew_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{name: "no backend", cfg: Config{}, want: "exactly one of command or endpoint"},
+		{name: "both backends", cfg: Config{Command: []string{"classify"}, Endpoint: "http://localhost"}, want: "exactly one of command or endpoint"},
+		{name: "negative timeout", cfg: Config{Command: []string{"classify"}, Timeout: -time.Second}, want: "timeout must be >= 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    Result
+		wantErr string
+	}{
+		{name: "json", output: `{"priority":"urgent","labels":["outage"," billing ","outage",""]}`, want: Result{Priority: "urgent", Labels: []string{"outage", "billing"}}},
+		{name: "bare word", output: "Low\n", want: Result{Priority: "low"}},
+		{name: "labels only", output: `{"labels":["question"]}`, want: Result{Priority: "normal", Labels: []string{"question"}}},
+		{name: "empty", output: "", want: Result{Priority: "normal"}},
+		{name: "unknown priority", output: "critical", wantErr: `unknown priority "critical"`},
+		{name: "bad json", output: `{"priority":`, wantErr: "decode classification"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.output))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if got.Priority != tt.want.Priority || !slices.Equal(got.Labels, tt.want.Labels) {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestClassify_Command(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	classifier, err := New(Config{Command: []string{"sh", "-c", `grep -q '"text":"prod is down"' && echo urgent || echo low`}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	got, err := classifier.Classify(context.Background(), protocol.Event{Text: "prod is down"})
+	if err != nil {
+		t.Fatalf("classify: %v", err)
+	}
+	if got.Priority != protocol.PriorityUrgent {
+		t.Fatalf("expected urgent, got %+v", got)
+	}
+
+	failing, err := New(Config{Command: []string{"sh", "-c", "echo model unavailable >&2; exit 3"}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if _, err := failing.Classify(context.Background(), protocol.Event{}); err == nil || !strings.Contains(err.Error(), "model unavailable") {
+		t.Fatalf("expected the command's stderr in the error, got %v", err)
+	}
+}
+
+func TestClassify_Endpoint(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-test" {
+			t.Errorf("unexpected authorization %q", got)
+		}
+		var event protocol.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("decode event: %v", err)
+		}
+		if event.Channel != "C1" {
+			t.Errorf("unexpected event %+v", event)
+		}
+		_, _ = w.Write([]byte(`{"priority":"normal","labels":["question"]}`))
+	}))
+	defer srv.Close()
+
+	classifier, err := New(Config{Endpoint: srv.URL, APIKey: "sk-test"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	got, err := classifier.Classify(context.Background(), protocol.Event{Channel: "C1", Text: "how do I reset my password?"})
+	if err != nil {
+		t.Fatalf("classify: %v", err)
+	}
+	if got.Priority != protocol.PriorityNormal || !slices.Equal(got.Labels, []string{"question"}) {
+		t.Fatalf("unexpected result %+v", got)
+	}
+}
+
+func TestClassify_EndpointError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	classifier, err := New(Config{Endpoint: srv.URL})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	_, err = classifier.Classify(context.Background(), protocol.Event{})
+	if err == nil || !strings.Contains(err.Error(), "429") || !strings.Contains(err.Error(), "rate limited") {
+		t.Fatalf("expected status and body in the error, got %v", err)
+	}
+}
@@ -1,22 +1,32 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"log"
 	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/pantalk/pantalk/internal/config"
 	"github.com/pantalk/pantalk/internal/ctl"
+	"github.com/pantalk/pantalk/internal/manpage"
 	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/server"
 	"github.com/pantalk/pantalk/internal/skill"
+	"github.com/pantalk/pantalk/internal/tui"
 )
 
 var defaultSocketPath = config.DefaultSocketPath()
@@ -62,6 +72,10 @@ func Run(service string, toolName string, args []string) int {
 		return runBots(service, commandArgs)
 	case "status":
 		return runStatus(service, commandArgs)
+	case "logs":
+		return runLogs(service, commandArgs)
+	case "debug":
+		return runDebug(service, commandArgs)
 	case "send":
 		return runSend(service, commandArgs)
 	case "react":
@@ -70,17 +84,49 @@ func Run(service string, toolName string, args []string) int {
 		return runHistory(service, commandArgs, false)
 	case "notifications", "notify":
 		return runHistory(service, commandArgs, true)
+	case "context":
+		return runContext(commandArgs)
+	case "mark-read":
+		return runMarkRead(service, commandArgs)
+	case "broadcast":
+		return runBroadcast(commandArgs)
+	case "presence":
+		return runPresence(service, commandArgs)
+	case "mute":
+		return runMute(service, toolName, commandArgs)
+	case "channel":
+		return runChannel(service, toolName, commandArgs)
+	case "channels":
+		return runChannels(service, commandArgs)
 	case "stream", "subscribe":
 		return runSubscribe(service, commandArgs)
+	case "watch":
+		return runWatch(service, commandArgs)
+	case "notify-desktop":
+		return runNotifyDesktop(service, commandArgs)
+	case "tui":
+		return runTUI(service, commandArgs)
+	case "mcp":
+		return runMCP(commandArgs)
+	case "tools":
+		return runTools(commandArgs)
 	case "ping":
 		return runPing(commandArgs)
+	case "examples":
+		return runExamples(commandArgs)
+	case "agents":
+		return runAgents(toolName, commandArgs)
+	case "explain":
+		return runExplain(service, toolName, commandArgs)
+	case "man":
+		return runMan(commandArgs)
 	case "skill":
 		if err := skill.Run(commandArgs); err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			return 1
 		}
 		return 0
-	case "setup", "validate", "reload", "config", "pair":
+	case "setup", "validate", "reload", "verify", "rotate-token", "config", "pair", "invite", "db", "service", "bench":
 		if err := ctl.Run(args); err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			return 1
@@ -97,7 +143,7 @@ func Run(service string, toolName string, args []string) int {
 }
 
 func runBots(service string, args []string) int {
-	flags := flag.NewFlagSet("bots", flag.ContinueOnError)
+	flags := manpage.NewFlagSet("bots")
 	socket := flags.String("socket", defaultSocketPath, "unix socket path")
 	svcFlag := flags.String("service", "", "filter by service (slack, discord, mattermost, telegram, whatsapp)")
 	jsonOut := flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
@@ -109,13 +155,11 @@ func runBots(service string, args []string) int {
 
 	resp, err := call(*socket, protocol.Request{Action: protocol.ActionBots, Service: svc})
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return callFailed(err, *jsonOut)
 	}
 
 	if !resp.OK {
-		fmt.Fprintln(os.Stderr, resp.Error)
-		return 1
+		return responseFailed(resp, *jsonOut)
 	}
 
 	if *jsonOut {
@@ -124,14 +168,49 @@ func runBots(service string, args []string) int {
 	}
 
 	for _, bot := range resp.Bots {
-		fmt.Printf("%s\t%s\t%s\t%s\n", bot.Service, bot.Name, bot.BotID, bot.DisplayName)
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\n", bot.Service, bot.Name, bot.BotID, bot.DisplayName, capabilityList(bot.Capabilities))
 	}
 
 	return 0
 }
 
+// capabilityList renders a bot's capabilities for the bots listing, e.g.
+// "threads,reactions,mark_read".
+func capabilityList(caps *protocol.Capabilities) string {
+	if caps == nil {
+		return ""
+	}
+	var names []string
+	for _, c := range []struct {
+		name string
+		ok   bool
+	}{
+		{"threads", caps.Threads},
+		{"reactions", caps.Reactions},
+		{"files", caps.Files},
+		{"interactive", caps.Interactive},
+		{"blocks", caps.Blocks},
+		{"embeds", caps.Embeds},
+		{"new_threads", caps.NewThreads},
+		{"puppeting", caps.Puppeting},
+		{"mark_read", caps.MarkRead},
+		{"presence", caps.Presence},
+		{"channels", caps.Channels},
+		{"topics", caps.Topics},
+		{"receipts", caps.Receipts},
+	} {
+		if c.ok {
+			names = append(names, c.name)
+		}
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, ",")
+}
+
 func runStatus(service string, args []string) int {
-	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	flags := manpage.NewFlagSet("status")
 	socket := flags.String("socket", defaultSocketPath, "unix socket path")
 	jsonOut := flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
 	if err := flags.Parse(args); err != nil {
@@ -142,13 +221,11 @@ func runStatus(service string, args []string) int {
 
 	resp, err := call(*socket, protocol.Request{Action: protocol.ActionStatus})
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return callFailed(err, *jsonOut)
 	}
 
 	if !resp.OK {
-		fmt.Fprintln(os.Stderr, resp.Error)
-		return 1
+		return responseFailed(resp, *jsonOut)
 	}
 
 	if resp.Status == nil {
@@ -179,6 +256,23 @@ func runStatus(service string, args []string) int {
 	if st.Notifications != nil {
 		fmt.Printf("notifications: total=%d unseen=%d\n", st.Notifications.Total, st.Notifications.Unseen)
 	}
+	fmt.Printf("streams: %d (dropped %d events)\n", len(st.Subscribers), st.DroppedEvents)
+	for _, sub := range st.Subscribers {
+		mode := ""
+		if sub.CatchUp {
+			mode = "  catch-up"
+		}
+		fmt.Printf("  %-20s  queued %d/%d  dropped %d%s\n", strings.Join(sub.Bots, ","), sub.Queued, sub.Buffer, sub.Dropped, mode)
+	}
+	if len(st.Middleware) > 0 {
+		fmt.Println("middleware:")
+		for _, m := range st.Middleware {
+			fmt.Printf("  %-20s  events %d  dropped %d  errors %d  avg %.1fms\n", m.Name, m.Events, m.Dropped, m.Errors, m.AvgMillis)
+		}
+	}
+	if st.Debug != nil && (st.Debug.All || len(st.Debug.Bots) > 0) {
+		fmt.Printf("debug:   %s\n", formatDebug(st.Debug))
+	}
 
 	return 0
 }
@@ -196,8 +290,164 @@ func formatUptime(secs int64) string {
 	return fmt.Sprintf("%dh%dm", h, m)
 }
 
+func runLogs(service string, args []string) int {
+	flags := manpage.NewFlagSet("logs")
+	socket := flags.String("socket", defaultSocketPath, "unix socket path")
+	svcFlag := flags.String("service", "", "only entries about bots of this service")
+	bot := flags.String("bot", "", "only entries about this bot")
+	level := flags.String("level", "info", "least severe entry to show: debug, info or error (debug entries need pantalk debug --enable)")
+	limit := flags.Int("limit", 100, "recent entries to show first")
+	follow := flags.Bool("follow", false, "keep streaming new entries until interrupted")
+	jsonOut := flags.Bool("json", !isTTY(), "output as JSON, one entry per line (default when stdout is not a terminal)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *limit < 0 {
+		fmt.Fprintln(os.Stderr, "--limit cannot be negative")
+		return 2
+	}
+
+	request := protocol.Request{
+		Action:  protocol.ActionLogs,
+		Service: resolveService(service, *svcFlag),
+		Bot:     *bot,
+		Level:   *level,
+		Limit:   *limit,
+		Follow:  *follow,
+	}
+
+	printEntry := func(entry protocol.LogEntry) {
+		if *jsonOut {
+			_ = json.NewEncoder(os.Stdout).Encode(entry)
+			return
+		}
+		bot := ""
+		if entry.Bot != "" {
+			bot = "[" + entry.Bot + "] "
+		}
+		fmt.Printf("%s %-5s %s%s\n", entry.Time.Local().Format("15:04:05"), entry.Level, bot, entry.Message)
+	}
+
+	if !*follow {
+		resp, err := call(*socket, request)
+		if err != nil {
+			return callFailed(err, *jsonOut)
+		}
+		if !resp.OK {
+			return responseFailed(resp, *jsonOut)
+		}
+		if resp.Ack != "" {
+			fmt.Fprintln(os.Stderr, resp.Ack)
+		}
+		for _, entry := range resp.Logs {
+			printEntry(entry)
+		}
+		return 0
+	}
+
+	if explaining {
+		return callFailed(explainRequest(request), *jsonOut)
+	}
+	stream, err := openStream(*socket, request, time.Time{}, 0)
+	if err != nil {
+		return callFailed(err, *jsonOut)
+	}
+	defer stream.conn.Close()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	go func() {
+		<-interrupt
+		_ = stream.conn.Close()
+	}()
+
+	for {
+		var resp protocol.Response
+		if err := stream.decoder.Decode(&resp); err != nil {
+			// Interrupted, or the daemon stopped or handed over.
+			return 0
+		}
+		if stream.legacy {
+			resp = legacyMismatch(resp, request.Action)
+		}
+		if !resp.OK {
+			return responseFailed(resp, *jsonOut)
+		}
+		if resp.Ack != "" && resp.Ack != "following" {
+			fmt.Fprintln(os.Stderr, resp.Ack)
+		}
+		for _, entry := range resp.Logs {
+			printEntry(entry)
+		}
+		if resp.Log != nil {
+			printEntry(*resp.Log)
+		}
+	}
+}
+
+func runDebug(service string, args []string) int {
+	flags := manpage.NewFlagSet("debug")
+	socket := flags.String("socket", defaultSocketPath, "unix socket path")
+	svcFlag := flags.String("service", "", "only bots of this service")
+	bot := flags.String("bot", "", "only this bot, as NAME or service:NAME")
+	enable := flags.Bool("enable", false, "turn debug logging on")
+	disable := flags.Bool("disable", false, "turn debug logging off")
+	jsonOut := flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *enable && *disable {
+		fmt.Fprintln(os.Stderr, "--enable and --disable cannot be combined")
+		return 2
+	}
+
+	request := protocol.Request{
+		Action:  protocol.ActionDebug,
+		Service: resolveService(service, *svcFlag),
+		Bot:     *bot,
+	}
+	switch {
+	case *enable:
+		request.Debug = "on"
+	case *disable:
+		request.Debug = "off"
+	}
+
+	resp, err := call(*socket, request)
+	if err != nil {
+		return callFailed(err, *jsonOut)
+	}
+	if !resp.OK {
+		return responseFailed(resp, *jsonOut)
+	}
+
+	if *jsonOut {
+		_ = json.NewEncoder(os.Stdout).Encode(resp.Debug)
+		return 0
+	}
+	if resp.Ack != "" {
+		fmt.Println(resp.Ack)
+	}
+	fmt.Printf("debug logging: %s\n", formatDebug(resp.Debug))
+	return 0
+}
+
+// formatDebug describes what debug logging is on for.
+func formatDebug(status *protocol.DebugStatus) string {
+	switch {
+	case status == nil:
+		return "off"
+	case status.All:
+		return "on for every bot"
+	case len(status.Bots) > 0:
+		return "on for " + strings.Join(status.Bots, ", ")
+	}
+	return "off"
+}
+
 func runSend(service string, args []string) int {
-	flags := flag.NewFlagSet("send", flag.ContinueOnError)
+	flags := manpage.NewFlagSet("send")
 	socket := flags.String("socket", defaultSocketPath, "unix socket path")
 	svcFlag := flags.String("service", "", "service name (auto-resolved from bot if omitted)")
 	bot := flags.String("bot", "", "bot name from config")
@@ -205,7 +455,30 @@ func runSend(service string, args []string) int {
 	channel := flags.String("channel", "", "channel destination id")
 	thread := flags.String("thread", "", "thread id")
 	text := flags.String("text", "", "message text (use - to read from stdin)")
+	fromStdin := flags.Bool("stdin", false, "read the message text from stdin verbatim, newlines included")
+	textFile := flags.String("text-file", "", "read the message text verbatim from this file")
 	format := flags.String("format", "plain", "message format (plain, markdown, html)")
+	author := flags.String("author", "", "post as this display name (bridges; Slack/Discord impersonate, others prefix the name)")
+	authorAvatar := flags.String("author-avatar", "", "avatar URL to show with --author where supported")
+	var buttons, options stringList
+	flags.Var(&buttons, "button", "add a button, LABEL=VALUE with an optional :primary or :danger style (repeatable)")
+	flags.Var(&options, "option", "add a select menu option, LABEL=VALUE (repeatable)")
+	placeholder := flags.String("placeholder", "", "placeholder text of the --option select menu")
+	blocksFile := flags.String("blocks", "", "Slack Block Kit JSON file to post (use - to read from stdin); other services get the text")
+	embedTitle := flags.String("embed-title", "", "attach an embed with this title (Discord; other services get it as text)")
+	embedDescription := flags.String("embed-description", "", "description of the embed")
+	embedURL := flags.String("embed-url", "", "link of the embed title")
+	embedColor := flags.String("embed-color", "", "color of the embed, as #RRGGBB")
+	var embedFields stringList
+	flags.Var(&embedFields, "embed-field", "add an embed field, NAME=VALUE with an optional :inline suffix (repeatable)")
+	startThread := flags.String("start-thread", "", "start a thread with this name, from the --thread message or in the channel, and post into it")
+	replyTo := flags.Int64("reply-to", 0, "reply to this stored event: in its thread, or one started from it where the service has threads (bot and destination default to the event's)")
+	var files stringList
+	flags.Var(&files, "file", "upload this file with the message, which becomes its caption (repeatable)")
+	translateTo := flags.String("translate", "", "translate the text into this language (e.g. de) before sending; needs translation in the config")
+	dryRun := flags.Bool("dry-run", false, "show the messages that would be posted and where, without sending them")
+	direct := flags.Bool("direct", false, "send without pantalkd: connect the bot from --config, send and exit (nothing is stored)")
+	configPath := flags.String("config", config.DefaultConfigPath(), "config to load the bot from with --direct")
 	jsonOut := flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
 	if err := flags.Parse(args); err != nil {
 		return 2
@@ -213,15 +486,101 @@ func runSend(service string, args []string) int {
 
 	svc := resolveService(service, *svcFlag)
 
-	if strings.TrimSpace(*bot) == "" {
+	if strings.TrimSpace(*bot) == "" && *replyTo == 0 {
 		fmt.Fprintln(os.Stderr, "--bot is required")
 		return 2
 	}
+	if *replyTo < 0 {
+		fmt.Fprintln(os.Stderr, "--reply-to must be an event ID")
+		return 2
+	}
+	if *replyTo > 0 && *direct {
+		fmt.Fprintln(os.Stderr, "--reply-to needs pantalkd's event store and cannot be combined with --direct")
+		return 2
+	}
+	interactive, err := parseInteractive(buttons, options, *placeholder)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if strings.TrimSpace(*authorAvatar) != "" && strings.TrimSpace(*author) == "" {
+		fmt.Fprintln(os.Stderr, "--author-avatar requires --author")
+		return 2
+	}
+	embeds, err := parseEmbed(*embedTitle, *embedDescription, *embedURL, *embedColor, embedFields)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	// The daemon reads the files, so hand it absolute paths.
+	var filePaths []string
+	for _, file := range files {
+		path, err := filepath.Abs(file)
+		if err == nil {
+			_, err = os.Stat(path)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		filePaths = append(filePaths, path)
+	}
+
+	sources := 0
+	for _, set := range []bool{*text != "", *fromStdin, *textFile != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		fmt.Fprintln(os.Stderr, "use only one of --text, --stdin and --text-file")
+		return 2
+	}
+
+	var blocks json.RawMessage
+	switch *blocksFile {
+	case "":
+	case "-":
+		if *text == "-" || *fromStdin {
+			fmt.Fprintln(os.Stderr, "--text and --blocks cannot both read stdin")
+			return 2
+		}
+		data, err := readStdin()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		blocks = json.RawMessage(data)
+	default:
+		data, err := os.ReadFile(*blocksFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		blocks = json.RawMessage(data)
+	}
 
 	// Resolve message text: explicit flag, stdin sentinel (-), or implicit
-	// stdin when the flag is omitted and stdin is not a terminal.
+	// stdin when the flag is omitted and stdin is not a terminal. With
+	// --blocks, an embed or a file the text is optional.
 	messageText := *text
-	if messageText == "-" || (messageText == "" && !isStdinTTY()) {
+	switch {
+	case *fromStdin:
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "read stdin: %v\n", err)
+			return 1
+		}
+		messageText = string(data)
+	case *textFile != "":
+		data, err := os.ReadFile(*textFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		messageText = string(data)
+	case messageText == "-" || (messageText == "" && blocks == nil && embeds == nil && filePaths == nil && !isStdinTTY()):
 		stdinText, err := readStdin()
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
@@ -230,246 +589,1346 @@ func runSend(service string, args []string) int {
 		messageText = stdinText
 	}
 
+	if strings.TrimSpace(messageText) == "" && blocks == nil && embeds == nil && filePaths == nil {
+		fmt.Fprintln(os.Stderr, "--text is required (or pass message via stdin)")
+		return 2
+	}
+	if strings.TrimSpace(*target) == "" && strings.TrimSpace(*channel) == "" && strings.TrimSpace(*thread) == "" && *replyTo == 0 {
+		fmt.Fprintln(os.Stderr, "one of --target, --channel, --thread or --reply-to is required")
+		return 2
+	}
+
+	request := protocol.Request{
+		Action:  protocol.ActionSend,
+		Service: svc,
+		Bot:     *bot,
+		Target:  *target,
+		Channel: *channel,
+		Thread:  *thread,
+		Text:    messageText,
+		Format:  *format,
+
+		Author:       *author,
+		AuthorAvatar: *authorAvatar,
+		Interactive:  interactive,
+		Blocks:       blocks,
+		Embeds:       embeds,
+		StartThread:  *startThread,
+		ReplyTo:      *replyTo,
+		Files:        filePaths,
+		Translate:    *translateTo,
+		DryRun:       *dryRun,
+	}
+	var resp protocol.Response
+	if *direct && !explaining {
+		resp, err = sendDirect(*configPath, request)
+	} else {
+		resp, err = call(*socket, request)
+	}
+	if err != nil {
+		return callFailed(err, *jsonOut)
+	}
+
+	if !resp.OK {
+		return responseFailed(resp, *jsonOut)
+	}
+
+	if resp.Preview != nil {
+		if *jsonOut {
+			_ = json.NewEncoder(os.Stdout).Encode(resp.Preview)
+		} else {
+			printPreview(*resp.Preview)
+		}
+	}
+	if resp.Event != nil {
+		if *jsonOut {
+			_ = json.NewEncoder(os.Stdout).Encode(resp.Event)
+		} else {
+			printEvent(*resp.Event)
+		}
+	}
+
+	return 0
+}
+
+// printPreview shows a dry-run send: the destination, then each message
+// as it would be posted.
+func printPreview(preview protocol.SendPreview) {
+	where := preview.Channel
+	if where == "" {
+		where = preview.Target
+	}
+	if preview.Thread != "" {
+		where += " thread=" + preview.Thread
+	}
+	fmt.Printf("dry run: %s/%s -> %s (nothing sent)\n", preview.Service, preview.Bot, where)
+	for i, message := range preview.Messages {
+		header := fmt.Sprintf("--- message %d/%d, %d chars", i+1, len(preview.Messages), utf8.RuneCountInString(message.Text))
+		if message.Format != "" {
+			header += ", " + message.Format
+		}
+		fmt.Println(header + " ---")
+		fmt.Println(message.Text)
+	}
+	for _, file := range preview.Files {
+		fmt.Printf("--- file %s ---\n", file)
+	}
+}
+
+func runBroadcast(args []string) int {
+	flags := manpage.NewFlagSet("broadcast")
+	socket := flags.String("socket", defaultSocketPath, "unix socket path")
+	group := flags.String("group", "", "broadcast group from config")
+	text := flags.String("text", "", "message text (use - to read from stdin)")
+	format := flags.String("format", "plain", "message format (plain, markdown, html)")
+	jsonOut := flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if strings.TrimSpace(*group) == "" {
+		fmt.Fprintln(os.Stderr, "--group is required")
+		return 2
+	}
+
+	messageText := *text
+	if messageText == "-" || (messageText == "" && !isStdinTTY()) {
+		stdinText, err := readStdin()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		messageText = stdinText
+	}
 	if strings.TrimSpace(messageText) == "" {
 		fmt.Fprintln(os.Stderr, "--text is required (or pass message via stdin)")
 		return 2
 	}
-	if strings.TrimSpace(*target) == "" && strings.TrimSpace(*channel) == "" && strings.TrimSpace(*thread) == "" {
-		fmt.Fprintln(os.Stderr, "one of --target, --channel, or --thread is required")
+
+	resp, err := call(*socket, protocol.Request{
+		Action: protocol.ActionBroadcast,
+		Group:  *group,
+		Text:   messageText,
+		Format: *format,
+	})
+	if err != nil {
+		return callFailed(err, *jsonOut)
+	}
+
+	// A partial failure still carries a result per destination.
+	if *jsonOut && resp.Results != nil {
+		_ = json.NewEncoder(os.Stdout).Encode(resp.Results)
+	} else {
+		for _, result := range resp.Results {
+			destination := result.Channel
+			if result.Thread != "" {
+				destination = result.Thread
+			}
+			if result.OK {
+				id := int64(0)
+				if result.Event != nil {
+					id = result.Event.ID
+				}
+				fmt.Printf("ok    %s/%s %s (event %d)\n", result.Service, result.Bot, destination, id)
+			} else {
+				fmt.Printf("fail  %s/%s %s: %s\n", result.Service, result.Bot, destination, result.Error)
+			}
+		}
+	}
+
+	if !resp.OK {
+		// The results printed above already report each failure.
+		return failure(resp.Code, resp.Error, *jsonOut && resp.Results == nil)
+	}
+	return 0
+}
+
+// stringList collects the values of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ", ") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parseInteractive builds the interactive payload of send from --button and
+// --option flags, or returns nil when neither is given.
+func parseInteractive(buttons []string, options []string, placeholder string) (*protocol.Interactive, error) {
+	if len(buttons) == 0 && len(options) == 0 {
+		if placeholder != "" {
+			return nil, fmt.Errorf("--placeholder requires --option")
+		}
+		return nil, nil
+	}
+
+	interactive := &protocol.Interactive{}
+	for _, raw := range buttons {
+		label, value, ok := strings.Cut(raw, "=")
+		if !ok {
+			return nil, fmt.Errorf("--button %q: expected LABEL=VALUE", raw)
+		}
+		button := protocol.Button{Label: label, Value: value}
+		for _, style := range []string{"primary", "danger"} {
+			if strings.HasSuffix(value, ":"+style) {
+				button.Value, button.Style = strings.TrimSuffix(value, ":"+style), style
+			}
+		}
+		interactive.Buttons = append(interactive.Buttons, button)
+	}
+	if len(options) > 0 {
+		interactive.Select = &protocol.Select{Placeholder: placeholder}
+		for _, raw := range options {
+			label, value, ok := strings.Cut(raw, "=")
+			if !ok {
+				return nil, fmt.Errorf("--option %q: expected LABEL=VALUE", raw)
+			}
+			interactive.Select.Options = append(interactive.Select.Options, protocol.Option{Label: label, Value: value})
+		}
+	}
+	return interactive, nil
+}
+
+// parseEmbed builds the embed of the send flags, or nil without any.
+func parseEmbed(title string, description string, url string, color string, fields []string) ([]protocol.Embed, error) {
+	if title == "" && description == "" && len(fields) == 0 {
+		if url != "" || color != "" {
+			return nil, fmt.Errorf("--embed-url and --embed-color need --embed-title, --embed-description or --embed-field")
+		}
+		return nil, nil
+	}
+
+	embed := protocol.Embed{Title: title, Description: description, URL: url}
+	if color != "" {
+		hex := strings.TrimPrefix(color, "#")
+		value, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || len(hex) != 6 {
+			return nil, fmt.Errorf("--embed-color %q: expected #RRGGBB", color)
+		}
+		embed.Color = int(value)
+	}
+	for _, raw := range fields {
+		name, value, ok := strings.Cut(raw, "=")
+		if !ok {
+			return nil, fmt.Errorf("--embed-field %q: expected NAME=VALUE", raw)
+		}
+		field := protocol.EmbedField{Name: name, Value: value}
+		if strings.HasSuffix(value, ":inline") {
+			field.Value, field.Inline = strings.TrimSuffix(value, ":inline"), true
+		}
+		embed.Fields = append(embed.Fields, field)
+	}
+	return []protocol.Embed{embed}, nil
+}
+
+func runReact(service string, args []string) int {
+	flags := manpage.NewFlagSet("react")
+	socket := flags.String("socket", defaultSocketPath, "unix socket path")
+	svcFlag := flags.String("service", "", "service name (auto-resolved from bot if omitted)")
+	bot := flags.String("bot", "", "bot name from config")
+	channel := flags.String("channel", "", "channel id containing the message")
+	thread := flags.String("thread", "", "message timestamp / thread id (required for Slack)")
+	target := flags.String("target", "", "message id (required for Discord)")
+	emoji := flags.String("emoji", "", "emoji reaction to add (e.g. white_check_mark, 👍)")
+	jsonOut := flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	svc := resolveService(service, *svcFlag)
+
+	if strings.TrimSpace(*bot) == "" {
+		fmt.Fprintln(os.Stderr, "--bot is required")
+		return 2
+	}
+	if strings.TrimSpace(*emoji) == "" {
+		fmt.Fprintln(os.Stderr, "--emoji is required")
+		return 2
+	}
+
+	resp, err := call(*socket, protocol.Request{
+		Action:  protocol.ActionReact,
+		Service: svc,
+		Bot:     *bot,
+		Channel: *channel,
+		Thread:  *thread,
+		Target:  *target,
+		Emoji:   *emoji,
+	})
+	if err != nil {
+		return callFailed(err, *jsonOut)
+	}
+
+	if !resp.OK {
+		return responseFailed(resp, *jsonOut)
+	}
+
+	if *jsonOut {
+		_ = json.NewEncoder(os.Stdout).Encode(resp)
+		return 0
+	}
+
+	fmt.Println(resp.Ack)
+	return 0
+}
+
+func runHistory(service string, args []string, forceNotify bool) int {
+	flags := manpage.NewFlagSet("history")
+	socket := flags.String("socket", defaultSocketPath, "unix socket path")
+	svcFlag := flags.String("service", "", "filter by service (slack, discord, mattermost, telegram, whatsapp)")
+	bot := flags.String("bot", "", "bot name from config")
+	target := flags.String("target", "", "filter by destination id")
+	channel := flags.String("channel", "", "filter by channel id")
+	thread := flags.String("thread", "", "filter by thread id")
+	search := flags.String("search", "", "filter messages containing this text (case-insensitive)")
+	notify := flags.Bool("notify", forceNotify, "only return agent-relevant notification events")
+	unseen := flags.Bool("unseen", false, "only return unseen notifications (notifications command)")
+	limit := flags.Int("limit", 20, "number of events")
+	sinceID := flags.Int64("since", 0, "only return events with id > since")
+	forward := flags.Bool("forward", false, "with --since, return the events right after it rather than the newest, to page forward")
+	direction := flags.String("direction", "", "filter by direction: in or out")
+	kind := flags.String("kind", "", "filter by event kind (message, edit, reaction, ...)")
+	clear := flags.Bool("clear", false, "delete matching events from the database")
+	all := flags.Bool("all", false, "allow broad clear across all bots/channels")
+	jsonOut := flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	svc := resolveService(service, *svcFlag)
+
+	if *clear {
+		return runClear(svc, *socket, *bot, *target, *channel, *thread, *search, *unseen, *all, forceNotify, *jsonOut)
+	}
+
+	resp, err := call(*socket, protocol.Request{
+		Action:    toAction(forceNotify),
+		Service:   svc,
+		Bot:       *bot,
+		Target:    *target,
+		Channel:   *channel,
+		Thread:    *thread,
+		Search:    *search,
+		Notify:    *notify,
+		Unseen:    *unseen,
+		Limit:     *limit,
+		SinceID:   *sinceID,
+		Forward:   *forward,
+		Direction: *direction,
+		Kind:      *kind,
+	})
+	if err != nil {
+		return callFailed(err, *jsonOut)
+	}
+
+	if !resp.OK {
+		return responseFailed(resp, *jsonOut)
+	}
+
+	if *jsonOut {
+		_ = json.NewEncoder(os.Stdout).Encode(resp.Events)
+		return 0
+	}
+
+	for _, event := range resp.Events {
+		printEvent(event)
+	}
+
+	return 0
+}
+
+func runContext(args []string) int {
+	flags := manpage.NewFlagSet("context")
+	socket := flags.String("socket", defaultSocketPath, "unix socket path")
+	eventID := flags.Int64("event-id", 0, "stored event whose conversation to read (see history)")
+	limit := flags.Int("limit", 20, "number of earlier messages")
+	jsonOut := flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *eventID <= 0 {
+		fmt.Fprintln(os.Stderr, "--event-id is required")
+		return 2
+	}
+
+	resp, err := call(*socket, protocol.Request{
+		Action:  protocol.ActionContext,
+		EventID: *eventID,
+		Limit:   *limit,
+	})
+	if err != nil {
+		return callFailed(err, *jsonOut)
+	}
+
+	if !resp.OK {
+		return responseFailed(resp, *jsonOut)
+	}
+
+	if *jsonOut {
+		_ = json.NewEncoder(os.Stdout).Encode(resp.Events)
+		return 0
+	}
+
+	for _, event := range resp.Events {
+		printEvent(event)
+	}
+
+	return 0
+}
+
+func runMarkRead(service string, args []string) int {
+	flags := manpage.NewFlagSet("mark-read")
+	socket := flags.String("socket", defaultSocketPath, "unix socket path")
+	svcFlag := flags.String("service", "", "service name (auto-resolved from bot if omitted)")
+	bot := flags.String("bot", "", "bot name from config")
+	channel := flags.String("channel", "", "channel to mark read up to the newest received message")
+	eventID := flags.Int64("event-id", 0, "stored event to mark its channel read up to (instead of --bot/--channel)")
+	jsonOut := flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *eventID <= 0 && (strings.TrimSpace(*bot) == "" || strings.TrimSpace(*channel) == "") {
+		fmt.Fprintln(os.Stderr, "--event-id or --bot and --channel are required")
+		return 2
+	}
+
+	resp, err := call(*socket, protocol.Request{
+		Action:  protocol.ActionMarkRead,
+		Service: resolveService(service, *svcFlag),
+		Bot:     *bot,
+		Channel: *channel,
+		EventID: *eventID,
+	})
+	if err != nil {
+		return callFailed(err, *jsonOut)
+	}
+
+	if !resp.OK {
+		return responseFailed(resp, *jsonOut)
+	}
+
+	if *jsonOut {
+		_ = json.NewEncoder(os.Stdout).Encode(resp)
+		return 0
+	}
+
+	fmt.Println(resp.Ack)
+	return 0
+}
+
+func runPresence(service string, args []string) int {
+	flags := manpage.NewFlagSet("presence")
+	socket := flags.String("socket", defaultSocketPath, "unix socket path")
+	svcFlag := flags.String("service", "", "service name (auto-resolved from bot if omitted)")
+	bot := flags.String("bot", "", "bot name from config")
+	state := flags.String("state", "", "availability: online, away or dnd")
+	status := flags.String("status", "", "status text, e.g. \"Reviewing PRs\" (empty clears it)")
+	jsonOut := flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if strings.TrimSpace(*bot) == "" {
+		fmt.Fprintln(os.Stderr, "--bot is required")
+		return 2
+	}
+
+	presence := &protocol.Presence{State: strings.TrimSpace(*state)}
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "status" {
+			presence.Status = status
+		}
+	})
+	if presence.State == "" && presence.Status == nil {
+		fmt.Fprintln(os.Stderr, "--state or --status is required")
+		return 2
+	}
+
+	resp, err := call(*socket, protocol.Request{
+		Action:   protocol.ActionPresence,
+		Service:  resolveService(service, *svcFlag),
+		Bot:      *bot,
+		Presence: presence,
+	})
+	if err != nil {
+		return callFailed(err, *jsonOut)
+	}
+
+	if !resp.OK {
+		return responseFailed(resp, *jsonOut)
+	}
+
+	if *jsonOut {
+		_ = json.NewEncoder(os.Stdout).Encode(resp)
+		return 0
+	}
+
+	fmt.Println(resp.Ack)
+	return 0
+}
+
+func runMute(service string, toolName string, args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "list":
+			return runMuteList(service, args[1:])
+		case "clear":
+			return runMuteClear(service, args[1:])
+		}
+	}
+
+	flags := manpage.NewFlagSet("mute")
+	socket := flags.String("socket", defaultSocketPath, "unix socket path")
+	svcFlag := flags.String("service", "", "service name (auto-resolved from bot if omitted)")
+	bot := flags.String("bot", "", "bot name from config")
+	channel := flags.String("channel", "", "channel to mute")
+	duration := flags.String("for", "", "how long to mute it, e.g. 2h or 30m")
+	jsonOut := flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if strings.TrimSpace(*bot) == "" || strings.TrimSpace(*channel) == "" || strings.TrimSpace(*duration) == "" {
+		fmt.Fprintf(os.Stderr, "usage: %s mute --bot NAME --channel ID --for DURATION | mute list | mute clear\n", toolName)
+		return 2
+	}
+
+	resp, err := call(*socket, protocol.Request{
+		Action:  protocol.ActionMute,
+		Service: resolveService(service, *svcFlag),
+		Bot:     *bot,
+		Channel: *channel,
+		For:     *duration,
+	})
+	if err != nil {
+		return callFailed(err, *jsonOut)
+	}
+
+	if !resp.OK {
+		return responseFailed(resp, *jsonOut)
+	}
+
+	if *jsonOut {
+		_ = json.NewEncoder(os.Stdout).Encode(resp)
+		return 0
+	}
+
+	fmt.Println(resp.Ack)
+	return 0
+}
+
+func runMuteList(service string, args []string) int {
+	flags := manpage.NewFlagSet("mute list")
+	socket := flags.String("socket", defaultSocketPath, "unix socket path")
+	svcFlag := flags.String("service", "", "only bots of this service")
+	bot := flags.String("bot", "", "only this bot")
+	jsonOut := flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	resp, err := call(*socket, protocol.Request{
+		Action:  protocol.ActionMutes,
+		Service: resolveService(service, *svcFlag),
+		Bot:     *bot,
+	})
+	if err != nil {
+		return callFailed(err, *jsonOut)
+	}
+
+	if !resp.OK {
+		return responseFailed(resp, *jsonOut)
+	}
+
+	if *jsonOut {
+		mutes := resp.Mutes
+		if mutes == nil {
+			mutes = []protocol.Mute{}
+		}
+		_ = json.NewEncoder(os.Stdout).Encode(mutes)
+		return 0
+	}
+
+	if len(resp.Mutes) == 0 {
+		fmt.Println("no channels muted")
+		return 0
+	}
+	for _, mute := range resp.Mutes {
+		fmt.Printf("%s/%s\t%s\tuntil %s (%s left)\n",
+			mute.Service,
+			mute.Bot,
+			mute.Channel,
+			mute.Until.Local().Format("2006-01-02 15:04"),
+			time.Until(mute.Until).Round(time.Minute),
+		)
+	}
+	return 0
+}
+
+func runMuteClear(service string, args []string) int {
+	flags := manpage.NewFlagSet("mute clear")
+	socket := flags.String("socket", defaultSocketPath, "unix socket path")
+	svcFlag := flags.String("service", "", "service name (auto-resolved from bot if omitted)")
+	bot := flags.String("bot", "", "bot name from config")
+	channel := flags.String("channel", "", "only this channel (default: every channel of the bot)")
+	all := flags.Bool("all", false, "lift the mutes of every bot")
+	jsonOut := flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if !*all && strings.TrimSpace(*bot) == "" {
+		fmt.Fprintln(os.Stderr, "--bot or --all is required")
+		return 2
+	}
+
+	resp, err := call(*socket, protocol.Request{
+		Action:  protocol.ActionUnmute,
+		Service: resolveService(service, *svcFlag),
+		Bot:     *bot,
+		Channel: *channel,
+		All:     *all,
+	})
+	if err != nil {
+		return callFailed(err, *jsonOut)
+	}
+
+	if !resp.OK {
+		return responseFailed(resp, *jsonOut)
+	}
+
+	if *jsonOut {
+		_ = json.NewEncoder(os.Stdout).Encode(resp)
+		return 0
+	}
+
+	fmt.Println(resp.Ack)
+	return 0
+}
+
+var channelActions = map[string]string{
+	"join":   protocol.ActionJoinChannel,
+	"leave":  protocol.ActionLeaveChannel,
+	"create": protocol.ActionCreateChannel,
+	"invite": protocol.ActionInviteChannel,
+}
+
+func runChannel(service string, toolName string, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s channel (join | leave | create | invite) [flags]\n", toolName)
+		return 2
+	}
+	op := args[0]
+	action, ok := channelActions[op]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown channel command %q\n", op)
+		return 2
+	}
+
+	flags := manpage.NewFlagSet("channel " + op)
+	socket := flags.String("socket", defaultSocketPath, "unix socket path")
+	svcFlag := flags.String("service", "", "service name (auto-resolved from bot if omitted)")
+	bot := flags.String("bot", "", "bot name from config")
+	var channel, name, target *string
+	var private *bool
+	var users stringList
+	switch op {
+	case "create":
+		name = flags.String("name", "", "name of the new channel")
+		private = flags.Bool("private", false, "create a private channel")
+		target = flags.String("target", "", "Discord server or Mattermost team ID (default: the bot's only one)")
+	case "invite":
+		channel = flags.String("channel", "", "channel ID")
+		flags.Var(&users, "user", "platform user ID to add (repeatable, or comma-separated)")
+	default:
+		channel = flags.String("channel", "", "channel ID")
+	}
+	jsonOut := flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if strings.TrimSpace(*bot) == "" {
+		fmt.Fprintln(os.Stderr, "--bot is required")
+		return 2
+	}
+	request := protocol.Request{
+		Action:  action,
+		Service: resolveService(service, *svcFlag),
+		Bot:     *bot,
+	}
+	if op == "create" {
+		if strings.TrimSpace(*name) == "" {
+			fmt.Fprintln(os.Stderr, "--name is required")
+			return 2
+		}
+		request.Name, request.Private, request.Target = *name, *private, *target
+	} else {
+		if strings.TrimSpace(*channel) == "" {
+			fmt.Fprintln(os.Stderr, "--channel is required")
+			return 2
+		}
+		request.Channel = *channel
+	}
+	if op == "invite" {
+		for _, value := range users {
+			request.Users = append(request.Users, strings.Split(value, ",")...)
+		}
+		if len(request.Users) == 0 {
+			fmt.Fprintln(os.Stderr, "--user is required")
+			return 2
+		}
+	}
+
+	resp, err := call(*socket, request)
+	if err != nil {
+		return callFailed(err, *jsonOut)
+	}
+
+	if !resp.OK {
+		return responseFailed(resp, *jsonOut)
+	}
+
+	if *jsonOut {
+		_ = json.NewEncoder(os.Stdout).Encode(map[string]string{"ack": resp.Ack, "channel": resp.Channel})
+		return 0
+	}
+	fmt.Println(resp.Ack)
+	return 0
+}
+
+// runChannels lists what is inside a channel; for now the topics of a
+// Zulip stream with --topics.
+func runChannels(service string, args []string) int {
+	flags := manpage.NewFlagSet("channels")
+	socket := flags.String("socket", defaultSocketPath, "unix socket path")
+	svcFlag := flags.String("service", "", "service name (auto-resolved from bot if omitted)")
+	bot := flags.String("bot", "", "bot name from config")
+	topics := flags.String("topics", "", "list the topics of this stream (ID or name), most recently active first")
+	limit := flags.Int("limit", 20, "maximum number of topics to list (0 for all)")
+	jsonOut := flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if strings.TrimSpace(*bot) == "" {
+		fmt.Fprintln(os.Stderr, "--bot is required")
+		return 2
+	}
+	if strings.TrimSpace(*topics) == "" {
+		fmt.Fprintln(os.Stderr, "--topics is required")
+		return 2
+	}
+
+	resp, err := call(*socket, protocol.Request{
+		Action:  protocol.ActionListTopics,
+		Service: resolveService(service, *svcFlag),
+		Bot:     *bot,
+		Channel: *topics,
+		Limit:   *limit,
+	})
+	if err != nil {
+		return callFailed(err, *jsonOut)
+	}
+
+	if !resp.OK {
+		return responseFailed(resp, *jsonOut)
+	}
+
+	if *jsonOut {
+		if resp.Topics == nil {
+			resp.Topics = []protocol.Topic{}
+		}
+		_ = json.NewEncoder(os.Stdout).Encode(resp.Topics)
+		return 0
+	}
+	for _, topic := range resp.Topics {
+		fmt.Printf("%s\t%s\n", topic.Name, topic.LastMessage)
+	}
+	return 0
+}
+
+func runSubscribe(service string, args []string) int {
+	return runStream(service, "stream", args)
+}
+
+// runWatch is stream for people: it follows until interrupted and prints
+// events with runWatch's prettyPrinter instead of one dense line each.
+func runWatch(service string, args []string) int {
+	return runStream(service, "watch", args)
+}
+
+func runStream(service string, command string, args []string) int {
+	watch := command == "watch"
+	flags := manpage.NewFlagSet(command)
+	socket := flags.String("socket", defaultSocketPath, "unix socket path")
+	svcFlag := flags.String("service", "", "filter by service (slack, discord, mattermost, telegram, whatsapp)")
+	bot := flags.String("bot", "", "bot name from config")
+	target := flags.String("target", "", "filter by destination id")
+	channel := flags.String("channel", "", "filter by channel id")
+	thread := flags.String("thread", "", "filter by thread id")
+	search := flags.String("search", "", "filter messages containing this text (case-insensitive)")
+	notify := flags.Bool("notify", false, "only stream agent-relevant notification events")
+	where := flags.String("where", "", "only stream events matching this expression (see docs/agents.md)")
+	sinceID := flags.Int64("since", 0, "first replay stored events with id > since, then stream live")
+	replayRate := flags.Int("replay-rate", 0, "pace the --since catch-up to N events per second (0 = unthrottled)")
+	buffer := flags.Int("buffer", 0, "queue up to N live events while this client is slow to read (default 64)")
+	catchUp := flags.Bool("catch-up", false, "replay events dropped from a full buffer from the store instead of losing them")
+	timeoutDefault, timeoutUsage := 60, "disconnect after N seconds (0 = no timeout)"
+	if watch {
+		timeoutDefault, timeoutUsage = 0, "disconnect after N seconds (0 = follow until interrupted)"
+	}
+	timeoutSec := flags.Int("timeout", timeoutDefault, timeoutUsage)
+	jsonOut, noColor := new(bool), new(bool)
+	byConversation, limit := new(bool), new(int)
+	if watch {
+		noColor = flags.Bool("no-color", os.Getenv("NO_COLOR") != "", "print without colors (default when $NO_COLOR is set or stdout is not a terminal)")
+	} else {
+		byConversation = flags.Bool("by-conversation", false, "print each message with the last messages of its thread or channel")
+		limit = flags.Int("limit", 0, "with --by-conversation, messages per conversation (default 20)")
+		jsonOut = flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	svc := resolveService(service, *svcFlag)
+	pretty := newPrettyPrinter(os.Stdout, isTTY() && !*noColor, terminalWidth())
+
+	if *replayRate < 0 {
+		fmt.Fprintln(os.Stderr, "--replay-rate cannot be negative")
+		return 2
+	}
+	if *replayRate > 0 && *sinceID <= 0 {
+		fmt.Fprintln(os.Stderr, "--replay-rate requires --since")
+		return 2
+	}
+	if *buffer < 0 {
+		fmt.Fprintln(os.Stderr, "--buffer cannot be negative")
+		return 2
+	}
+	if *limit != 0 && !*byConversation {
+		fmt.Fprintln(os.Stderr, "--limit requires --by-conversation")
+		return 2
+	}
+
+	request := protocol.Request{
+		Action:  protocol.ActionSubscribe,
+		Service: svc,
+		Bot:     *bot,
+		Target:  *target,
+		Channel: *channel,
+		Thread:  *thread,
+		Search:  *search,
+		Notify:  *notify,
+		SinceID: *sinceID,
+		Limit:   *limit,
+
+		ReplayRate:     *replayRate,
+		Where:          *where,
+		Buffer:         *buffer,
+		CatchUp:        *catchUp,
+		ByConversation: *byConversation,
+	}
+
+	if explaining {
+		return callFailed(explainRequest(request), *jsonOut)
+	}
+
+	// Set a hard deadline on the connection so agent tools never block
+	// indefinitely. A timeout of 0 disables the deadline for interactive use.
+	var deadline time.Time
+	if *timeoutSec > 0 {
+		deadline = time.Now().Add(time.Duration(*timeoutSec) * time.Second)
+	}
+
+	stream, err := openStream(*socket, request, deadline, 0)
+	if err != nil {
+		return callFailed(err, *jsonOut)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	var mu sync.Mutex
+	interrupted := false
+	go func() {
+		<-interrupt
+		mu.Lock()
+		interrupted = true
+		_ = stream.conn.Close()
+		mu.Unlock()
+	}()
+	defer func() {
+		mu.Lock()
+		_ = stream.conn.Close()
+		mu.Unlock()
+	}()
+
+	resumed := false
+	for {
+		var resp protocol.Response
+		if err := stream.decoder.Decode(&resp); err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return 0
+			}
+			// Deadline exceeded is a normal exit for timed streams.
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return 0
+			}
+			fmt.Fprintln(os.Stderr, err)
+			return 0
+		}
+
+		if stream.legacy {
+			resp = legacyMismatch(resp, request.Action)
+		}
+		if !resp.OK {
+			return responseFailed(resp, *jsonOut)
+		}
+
+		if resp.Bundle != nil {
+			if *jsonOut {
+				_ = json.NewEncoder(os.Stdout).Encode(resp.Bundle)
+				continue
+			}
+			printBundle(*resp.Bundle)
+			continue
+		}
+
+		if resp.Event == nil {
+			continue
+		}
+
+		// The daemon is handing over to a new pantalkd: subscribe there and
+		// pick up after the last event this stream saw.
+		if resp.Event.Kind == protocol.KindHandoff {
+			resume := request
+			if resp.Event.ID > 0 {
+				resume.SinceID = resp.Event.ID
+				resume.ReplayRate = 0
+			}
+			next, err := openStream(*socket, resume, deadline, resumeTimeout)
+			if err != nil {
+				return callFailed(err, *jsonOut)
+			}
+			mu.Lock()
+			_ = stream.conn.Close()
+			stream = next
+			if interrupted {
+				_ = stream.conn.Close()
+			}
+			mu.Unlock()
+			resumed = resp.Event.ID > 0
+			continue
+		}
+		// The catch-up after a handoff is not the client's to see.
+		if resumed && resp.Event.Kind == protocol.KindReplayDone {
+			resumed = false
+			continue
+		}
+
+		if *jsonOut {
+			_ = json.NewEncoder(os.Stdout).Encode(resp.Event)
+			continue
+		}
+
+		if watch {
+			pretty.print(*resp.Event, time.Now())
+			continue
+		}
+
+		if resp.Event.Kind == protocol.KindReplayDone {
+			fmt.Printf("--- %s up to id %d; live events follow ---\n", resp.Event.Text, resp.Event.ID)
+			continue
+		}
+
+		printEvent(*resp.Event)
+	}
+}
+
+// printBundle prints a conversation of a by-conversation stream: a header
+// naming it, then its messages as printEvent would.
+func printBundle(bundle protocol.Bundle) {
+	where := bundle.Channel
+	if bundle.Thread != "" {
+		where += " thread " + bundle.Thread
+	}
+	fmt.Printf("--- %s/%s %s (%d messages) ---\n", bundle.Service, bundle.Bot, strings.TrimSpace(where), len(bundle.Messages))
+	for _, event := range bundle.Messages {
+		printEvent(event)
+	}
+}
+
+// resumeTimeout bounds how long a stream retries connecting after the
+// daemon hands over to a new one.
+const resumeTimeout = 30 * time.Second
+
+// subscription is an open subscribe connection.
+type subscription struct {
+	conn    net.Conn
+	decoder *json.Decoder
+	legacy  bool
+}
+
+// openStream connects to the daemon and subscribes with request, retrying
+// the connection for up to retryFor.
+func openStream(socket string, request protocol.Request, deadline time.Time, retryFor time.Duration) (*subscription, error) {
+	retryUntil := time.Now().Add(retryFor)
+	conn, err := net.Dial("unix", socket)
+	for err != nil && time.Now().Before(retryUntil) {
+		time.Sleep(250 * time.Millisecond)
+		conn, err = net.Dial("unix", socket)
+	}
+	if err != nil {
+		return nil, &clientError{codeDaemonUnreachable, fmt.Errorf("connect socket: %w", err)}
+	}
+	if !deadline.IsZero() {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	encoder := json.NewEncoder(conn)
+	decoder := json.NewDecoder(conn)
+	legacy, err := handshake(encoder, decoder, request.Action)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := encoder.Encode(request); err != nil {
+		conn.Close()
+		return nil, &clientError{codeDaemonUnreachable, fmt.Errorf("send request: %w", err)}
+	}
+	return &subscription{conn: conn, decoder: decoder, legacy: legacy}, nil
+}
+
+func runTUI(service string, args []string) int {
+	flags := manpage.NewFlagSet("tui")
+	socket := flags.String("socket", defaultSocketPath, "unix socket path")
+	svcFlag := flags.String("service", "", "only show bots of this service")
+	bot := flags.String("bot", "", "only show this bot")
+	history := flags.Int("history", 100, "stored messages to load per bot")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *history <= 0 {
+		fmt.Fprintln(os.Stderr, "--history must be positive")
+		return 2
+	}
+
+	err := tui.Run(tui.Options{
+		Socket:  *socket,
+		Service: resolveService(service, *svcFlag),
+		Bot:     *bot,
+		History: *history,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func runExamples(args []string) int {
+	flags := manpage.NewFlagSet("examples")
+	socket := flags.String("socket", defaultSocketPath, "unix socket path")
+	jsonOut := flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
+
+	// Accept the command name before or after the flags.
+	var command string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		if command != "" || flags.NArg() > 1 {
+			fmt.Fprintln(os.Stderr, "examples takes at most one command name")
+			return 2
+		}
+		command = flags.Arg(0)
+	}
+
+	resp, err := call(*socket, protocol.Request{Action: protocol.ActionExamples, Command: command})
+	if err != nil {
+		return callFailed(err, *jsonOut)
+	}
+
+	if !resp.OK {
+		return responseFailed(resp, *jsonOut)
+	}
+
+	if *jsonOut {
+		_ = json.NewEncoder(os.Stdout).Encode(resp.Examples)
+		return 0
+	}
+
+	for i, ex := range resp.Examples {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("# %s\n%s\n", ex.Description, ex.Line)
+	}
+
+	return 0
+}
+
+func runAgents(toolName string, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s agents (list | runs | run | test) [flags]\n", toolName)
+		return 2
+	}
+
+	switch args[0] {
+	case "list":
+		return runAgentsList(args[1:])
+	case "runs":
+		return runAgentRuns(args[1:])
+	case "run":
+		return runAgentNow(args[1:])
+	case "test":
+		return runAgentTest(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown agents command %q\n", args[0])
+		return 2
+	}
+}
+
+func runAgentsList(args []string) int {
+	flags := manpage.NewFlagSet("agents list")
+	socket := flags.String("socket", defaultSocketPath, "unix socket path")
+	jsonOut := flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
+	if err := flags.Parse(args); err != nil {
 		return 2
 	}
 
-	resp, err := call(*socket, protocol.Request{
-		Action:  protocol.ActionSend,
-		Service: svc,
-		Bot:     *bot,
-		Target:  *target,
-		Channel: *channel,
-		Thread:  *thread,
-		Text:    messageText,
-		Format:  *format,
-	})
+	resp, err := call(*socket, protocol.Request{Action: protocol.ActionAgents})
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return callFailed(err, *jsonOut)
 	}
 
 	if !resp.OK {
-		fmt.Fprintln(os.Stderr, resp.Error)
-		return 1
+		return responseFailed(resp, *jsonOut)
 	}
 
-	if resp.Event != nil {
-		if *jsonOut {
-			_ = json.NewEncoder(os.Stdout).Encode(resp.Event)
-		} else {
-			printEvent(*resp.Event)
+	if *jsonOut {
+		agents := resp.Agents
+		if agents == nil {
+			agents = []protocol.AgentInfo{}
+		}
+		_ = json.NewEncoder(os.Stdout).Encode(agents)
+		return 0
+	}
+
+	for _, a := range resp.Agents {
+		state := "idle"
+		if a.Running {
+			state = "running"
 		}
+		if a.Pending > 0 {
+			state += fmt.Sprintf(" (%d pending)", a.Pending)
+		}
+
+		last := "never run"
+		if a.LastRun != nil {
+			last = fmt.Sprintf("last run %s exit=%d", a.LastRun.StartedAt.Local().Format("2006-01-02 15:04:05"), a.LastRun.ExitCode)
+		}
+		fmt.Printf("%s\t%s\t%s\twhen: %s\n", a.Name, state, last, a.When)
 	}
 
 	return 0
 }
 
-func runReact(service string, args []string) int {
-	flags := flag.NewFlagSet("react", flag.ContinueOnError)
+func runAgentRuns(args []string) int {
+	flags := manpage.NewFlagSet("agents runs")
 	socket := flags.String("socket", defaultSocketPath, "unix socket path")
-	svcFlag := flags.String("service", "", "service name (auto-resolved from bot if omitted)")
-	bot := flags.String("bot", "", "bot name from config")
-	channel := flags.String("channel", "", "channel id containing the message")
-	thread := flags.String("thread", "", "message timestamp / thread id (required for Slack)")
-	target := flags.String("target", "", "message id (required for Discord)")
-	emoji := flags.String("emoji", "", "emoji reaction to add (e.g. white_check_mark, 👍)")
+	name := flags.String("name", "", "only runs of this agent")
+	limit := flags.Int("limit", 20, "max runs to return")
+	jsonOut := flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
 	if err := flags.Parse(args); err != nil {
 		return 2
 	}
 
-	svc := resolveService(service, *svcFlag)
-
-	if strings.TrimSpace(*bot) == "" {
-		fmt.Fprintln(os.Stderr, "--bot is required")
-		return 2
+	resp, err := call(*socket, protocol.Request{Action: protocol.ActionAgentRuns, Agent: *name, Limit: *limit})
+	if err != nil {
+		return callFailed(err, *jsonOut)
 	}
-	if strings.TrimSpace(*emoji) == "" {
-		fmt.Fprintln(os.Stderr, "--emoji is required")
-		return 2
+
+	if !resp.OK {
+		return responseFailed(resp, *jsonOut)
 	}
 
-	resp, err := call(*socket, protocol.Request{
-		Action:  protocol.ActionReact,
-		Service: svc,
-		Bot:     *bot,
-		Channel: *channel,
-		Thread:  *thread,
-		Target:  *target,
-		Emoji:   *emoji,
-	})
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+	if *jsonOut {
+		runs := resp.Runs
+		if runs == nil {
+			runs = []protocol.AgentRun{}
+		}
+		_ = json.NewEncoder(os.Stdout).Encode(runs)
+		return 0
 	}
 
-	if !resp.OK {
-		fmt.Fprintln(os.Stderr, resp.Error)
-		return 1
+	for _, run := range resp.Runs {
+		duration := run.FinishedAt.Sub(run.StartedAt).Round(100 * time.Millisecond)
+		fmt.Printf("%d\t%s\t%s\t%s\texit=%d\ttriggers=%d\t%s\n",
+			run.ID,
+			run.StartedAt.Local().Format("2006-01-02 15:04:05"),
+			run.Agent,
+			duration,
+			run.ExitCode,
+			run.Triggers,
+			run.Error,
+		)
+		if output := strings.TrimSpace(run.Output); output != "" {
+			for _, line := range strings.Split(output, "\n") {
+				fmt.Printf("\t| %s\n", line)
+			}
+		}
 	}
 
-	fmt.Println(resp.Ack)
 	return 0
 }
 
-func runHistory(service string, args []string, forceNotify bool) int {
-	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+func runAgentNow(args []string) int {
+	flags := manpage.NewFlagSet("agents run")
 	socket := flags.String("socket", defaultSocketPath, "unix socket path")
-	svcFlag := flags.String("service", "", "filter by service (slack, discord, mattermost, telegram, whatsapp)")
-	bot := flags.String("bot", "", "bot name from config")
-	target := flags.String("target", "", "filter by destination id")
-	channel := flags.String("channel", "", "filter by channel id")
-	thread := flags.String("thread", "", "filter by thread id")
-	search := flags.String("search", "", "filter messages containing this text (case-insensitive)")
-	notify := flags.Bool("notify", forceNotify, "only return agent-relevant notification events")
-	unseen := flags.Bool("unseen", false, "only return unseen notifications (notifications command)")
-	limit := flags.Int("limit", 20, "number of events")
-	sinceID := flags.Int64("since", 0, "only return events with id > since")
-	clear := flags.Bool("clear", false, "delete matching events from the database")
-	all := flags.Bool("all", false, "allow broad clear across all bots/channels")
+	name := flags.String("name", "", "agent to launch")
+	eventID := flags.Int64("event-id", 0, "stored event to pass to the agent as its trigger")
+	force := flags.Bool("force", false, "launch even if the agent is in cooldown")
 	jsonOut := flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
 	if err := flags.Parse(args); err != nil {
 		return 2
 	}
 
-	svc := resolveService(service, *svcFlag)
-
-	if *clear {
-		return runClear(svc, *socket, *bot, *target, *channel, *thread, *search, *unseen, *all, forceNotify, *jsonOut)
+	if strings.TrimSpace(*name) == "" {
+		fmt.Fprintln(os.Stderr, "--name is required")
+		return 2
 	}
 
-	resp, err := call(*socket, protocol.Request{
-		Action:  toAction(forceNotify),
-		Service: svc,
-		Bot:     *bot,
-		Target:  *target,
-		Channel: *channel,
-		Thread:  *thread,
-		Search:  *search,
-		Notify:  *notify,
-		Unseen:  *unseen,
-		Limit:   *limit,
-		SinceID: *sinceID,
-	})
+	resp, err := call(*socket, protocol.Request{Action: protocol.ActionRunAgent, Agent: *name, EventID: *eventID, Force: *force})
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return callFailed(err, *jsonOut)
 	}
 
 	if !resp.OK {
-		fmt.Fprintln(os.Stderr, resp.Error)
-		return 1
+		return responseFailed(resp, *jsonOut)
 	}
 
 	if *jsonOut {
-		_ = json.NewEncoder(os.Stdout).Encode(resp.Events)
+		_ = json.NewEncoder(os.Stdout).Encode(resp)
 		return 0
 	}
 
-	for _, event := range resp.Events {
-		printEvent(event)
-	}
-
+	fmt.Println(resp.Ack)
 	return 0
 }
 
-func runSubscribe(service string, args []string) int {
-	flags := flag.NewFlagSet("stream", flag.ContinueOnError)
+func runAgentTest(args []string) int {
+	flags := manpage.NewFlagSet("agents test")
 	socket := flags.String("socket", defaultSocketPath, "unix socket path")
-	svcFlag := flags.String("service", "", "filter by service (slack, discord, mattermost, telegram, whatsapp)")
-	bot := flags.String("bot", "", "bot name from config")
-	target := flags.String("target", "", "filter by destination id")
-	channel := flags.String("channel", "", "filter by channel id")
-	thread := flags.String("thread", "", "filter by thread id")
-	search := flags.String("search", "", "filter messages containing this text (case-insensitive)")
-	notify := flags.Bool("notify", false, "only stream agent-relevant notification events")
-	timeoutSec := flags.Int("timeout", 60, "disconnect after N seconds (0 = no timeout)")
+	when := flags.String("when", "", "expression to evaluate")
+	name := flags.String("name", "", "evaluate this agent's when expression instead")
+	eventID := flags.Int64("event-id", 0, "stored event to evaluate against")
+	eventJSON := flags.String("event-json", "", "file with an event as JSON to evaluate against (- for stdin)")
 	jsonOut := flags.Bool("json", !isTTY(), "output as JSON (default when stdout is not a terminal)")
 	if err := flags.Parse(args); err != nil {
 		return 2
 	}
 
-	svc := resolveService(service, *svcFlag)
-
-	conn, err := net.Dial("unix", *socket)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "connect socket: %v\n", err)
-		return 1
+	if strings.TrimSpace(*when) == "" && strings.TrimSpace(*name) == "" {
+		fmt.Fprintln(os.Stderr, "--when or --name is required")
+		return 2
 	}
-	defer conn.Close()
-
-	// Set a hard deadline on the connection so agent tools never block
-	// indefinitely. A timeout of 0 disables the deadline for interactive use.
-	if *timeoutSec > 0 {
-		_ = conn.SetDeadline(time.Now().Add(time.Duration(*timeoutSec) * time.Second))
+	if (*eventID > 0) == (*eventJSON != "") {
+		fmt.Fprintln(os.Stderr, "exactly one of --event-id and --event-json is required")
+		return 2
 	}
 
-	request := protocol.Request{
-		Action:  protocol.ActionSubscribe,
-		Service: svc,
-		Bot:     *bot,
-		Target:  *target,
-		Channel: *channel,
-		Thread:  *thread,
-		Search:  *search,
-		Notify:  *notify,
+	req := protocol.Request{Action: protocol.ActionTestAgent, When: *when, Agent: *name, EventID: *eventID}
+	if *eventJSON != "" {
+		event, err := readEventJSON(*eventJSON)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		req.Event = event
 	}
 
-	if err := json.NewEncoder(conn).Encode(request); err != nil {
-		fmt.Fprintf(os.Stderr, "send request: %v\n", err)
-		return 1
+	resp, err := call(*socket, req)
+	if err != nil {
+		return callFailed(err, *jsonOut)
 	}
 
-	decoder := json.NewDecoder(conn)
+	if !resp.OK {
+		return responseFailed(resp, *jsonOut)
+	}
 
-	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
-	defer signal.Stop(interrupt)
+	if *jsonOut {
+		_ = json.NewEncoder(os.Stdout).Encode(resp.Test)
+		return 0
+	}
 
-	go func() {
-		<-interrupt
-		_ = conn.Close()
-	}()
+	test := resp.Test
+	result := "not matched"
+	switch {
+	case test.Error != "":
+		result = "error: " + test.Error
+	case test.Matched && test.Skipped != "":
+		result = "matched, but the event would not trigger an agent: " + test.Skipped
+	case test.Matched:
+		result = "matched"
+	case test.Skipped != "":
+		result = "not matched (" + test.Skipped + ")"
+	}
 
-	for {
-		var resp protocol.Response
-		if err := decoder.Decode(&resp); err != nil {
-			if errors.Is(err, net.ErrClosed) {
-				return 0
-			}
-			// Deadline exceeded is a normal exit for timed streams.
-			if ne, ok := err.(net.Error); ok && ne.Timeout() {
-				return 0
-			}
-			fmt.Fprintln(os.Stderr, err)
-			return 0
-		}
+	fmt.Printf("when:   %s\n", test.When)
+	if test.Event.ID > 0 {
+		fmt.Printf("event:  %d\n", test.Event.ID)
+	}
+	fmt.Printf("result: %s\n\n", result)
 
-		if !resp.OK {
-			fmt.Fprintln(os.Stderr, resp.Error)
-			return 1
-		}
+	keys := make([]string, 0, len(test.Env))
+	for key := range test.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 
-		if resp.Event == nil {
-			continue
+	for _, key := range keys {
+		value := test.Env[key]
+		if text, ok := value.(string); ok {
+			value = strconv.Quote(text)
 		}
+		fmt.Printf("  %-9s %v\n", key, value)
+	}
+	return 0
+}
 
-		if *jsonOut {
-			_ = json.NewEncoder(os.Stdout).Encode(resp.Event)
-			continue
-		}
+// readEventJSON reads one event for agents test from a file or stdin.
+func readEventJSON(path string) (*protocol.Event, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read event: %w", err)
+	}
 
-		printEvent(*resp.Event)
+	var event protocol.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("parse event %s: %w", path, err)
 	}
+	return &event, nil
 }
 
 func runPing(args []string) int {
-	flags := flag.NewFlagSet("ping", flag.ContinueOnError)
+	flags := manpage.NewFlagSet("ping")
 	socket := flags.String("socket", defaultSocketPath, "unix socket path")
 	if err := flags.Parse(args); err != nil {
 		return 2
@@ -477,13 +1936,11 @@ func runPing(args []string) int {
 
 	resp, err := call(*socket, protocol.Request{Action: protocol.ActionPing})
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return callFailed(err, false)
 	}
 
 	if !resp.OK {
-		fmt.Fprintln(os.Stderr, resp.Error)
-		return 1
+		return responseFailed(resp, false)
 	}
 
 	fmt.Println(resp.Ack)
@@ -513,13 +1970,11 @@ func runClear(service string, socket string, bot string, target string, channel
 		All:     all,
 	})
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return callFailed(err, jsonOut)
 	}
 
 	if !resp.OK {
-		fmt.Fprintln(os.Stderr, resp.Error)
-		return 1
+		return responseFailed(resp, jsonOut)
 	}
 
 	if jsonOut {
@@ -532,28 +1987,62 @@ func runClear(service string, socket string, bot string, target string, channel
 }
 
 func call(socket string, request protocol.Request) (protocol.Response, error) {
+	if request.Trace == "" {
+		request.Trace = os.Getenv("PANTALK_TRACE")
+	}
+	if explaining {
+		return protocol.Response{}, explainRequest(request)
+	}
+
 	conn, err := net.Dial("unix", socket)
 	if err != nil {
-		return protocol.Response{}, fmt.Errorf("connect socket: %w", err)
+		return protocol.Response{}, &clientError{codeDaemonUnreachable, fmt.Errorf("connect socket: %w", err)}
 	}
 	defer conn.Close()
 
-	if err := json.NewEncoder(conn).Encode(request); err != nil {
-		return protocol.Response{}, fmt.Errorf("send request: %w", err)
+	encoder := json.NewEncoder(conn)
+	decoder := json.NewDecoder(conn)
+	legacy, err := handshake(encoder, decoder, request.Action)
+	if err != nil {
+		return protocol.Response{}, err
+	}
+
+	if err := encoder.Encode(request); err != nil {
+		return protocol.Response{}, &clientError{codeDaemonUnreachable, fmt.Errorf("send request: %w", err)}
 	}
 
 	var resp protocol.Response
-	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
-		return protocol.Response{}, fmt.Errorf("read response: %w", err)
+	if err := decoder.Decode(&resp); err != nil {
+		return protocol.Response{}, &clientError{codeDaemonUnreachable, fmt.Errorf("read response: %w", err)}
 	}
 
+	if legacy {
+		resp = legacyMismatch(resp, request.Action)
+	}
 	return resp, nil
 }
 
 func printEvent(event protocol.Event) {
-	fmt.Printf("%d\tnid=%d\tseen=%t\t%s\t%s/%s\t%s\t%s\tuser=%s self=%t\tnotify=%t direct=%t mention=%t\ttarget=%s channel=%s thread=%s\t%s\n",
+	nid := fmt.Sprintf("%d", event.NotificationID)
+	if event.Collapsed > 0 {
+		nid += fmt.Sprintf("(+%d)", event.Collapsed)
+	}
+	flags := fmt.Sprintf("notify=%t direct=%t mention=%t", event.Notify, event.Direct, event.Mentions)
+	if event.NotifyReason != "" {
+		flags += " reason=" + event.NotifyReason
+	}
+	if event.Priority != "" {
+		flags += " priority=" + event.Priority
+	}
+	if len(event.Labels) > 0 {
+		flags += " labels=" + strings.Join(event.Labels, ",")
+	}
+	if event.Status != "" {
+		flags += " status=" + event.Status
+	}
+	fmt.Printf("%d\tnid=%s\tseen=%t\t%s\t%s/%s\t%s\t%s\tuser=%s self=%t\t%s\ttarget=%s channel=%s thread=%s\t%s\n",
 		event.ID,
-		event.NotificationID,
+		nid,
 		event.Seen,
 		event.Timestamp.Format("2006-01-02T15:04:05Z07:00"),
 		event.Service,
@@ -562,16 +2051,46 @@ func printEvent(event protocol.Event) {
 		event.Direction,
 		event.User,
 		event.Self,
-		event.Notify,
-		event.Direct,
-		event.Mentions,
+		flags,
 		event.Target,
 		event.Channel,
 		event.Thread,
-		event.Text,
+		eventText(event),
 	)
 }
 
+// eventText prefixes the text with a marker per attachment, e.g.
+// "[voice 7s] transcript", so media without text is still visible.
+func eventText(event protocol.Event) string {
+	markers := make([]string, 0, len(event.Attachments)+1)
+	for _, attachment := range event.Attachments {
+		label := attachment.Kind
+		if attachment.Voice {
+			label = "voice"
+		}
+		if attachment.Duration > 0 {
+			label += fmt.Sprintf(" %.0fs", attachment.Duration)
+		}
+		markers = append(markers, "["+label+"]")
+	}
+	if event.Text != "" {
+		markers = append(markers, event.Text)
+	}
+	if event.TranslatedText != "" {
+		marker := "[translated]"
+		if event.Language != "" {
+			marker = "[translated from " + event.Language + "]"
+		}
+		markers = append(markers, marker, event.TranslatedText)
+	}
+	for _, link := range event.Links {
+		if link.Title != "" {
+			markers = append(markers, "[link: "+link.Title+"]")
+		}
+	}
+	return strings.Join(markers, " ")
+}
+
 func toAction(notifications bool) string {
 	if notifications {
 		return protocol.ActionNotify
@@ -600,28 +2119,69 @@ func printUsage(toolName string) {
 Messaging:
   %s bots%s [--json]
   %s status [--json]
-	%s send --bot NAME (--text MESSAGE | --text -) (--target ID | --channel ID | --thread ID) [--format plain|markdown|html]%s [--json]
+  %s logs [--bot NAME] [--level debug|info|error] [--limit N] [--follow]%s [--json]
+  %s debug [--enable|--disable] [--bot NAME]%s [--json]
+  %s agents list [--json]
+  %s agents runs [--name NAME] [--limit N] [--json]
+  %s agents run --name NAME [--event-id N] [--force] [--json]
+  %s agents test (--when EXPR | --name NAME) (--event-id N | --event-json FILE) [--json]
+  %s send --bot NAME (--text MESSAGE | --text - | --stdin | --text-file PATH | --blocks FILE | --embed-title TEXT | --file PATH) (--target ID | --channel ID | --thread ID | --reply-to EVENT_ID) [--format plain|markdown|html] [--button LABEL=VALUE]... [--option LABEL=VALUE]... [--embed-field NAME=VALUE]... [--start-thread NAME] [--file PATH]... [--translate LANG] [--direct [--config PATH]]%s [--json]
+  %s broadcast --group NAME (--text MESSAGE | --text -) [--format plain|markdown|html] [--json]
   %s react --bot NAME --emoji EMOJI (--channel ID | --thread ID | --target ID)%s
   %s history [--bot NAME] [--channel ID] [--thread ID] [--search TEXT] [--notify] [--limit N] [--since ID] [--clear [--all]]%s [--json]
   %s notifications [--bot NAME] [--channel ID] [--thread ID] [--search TEXT] [--unseen] [--limit N] [--since ID] [--clear [--all]]%s [--json]
-  %s stream [--bot NAME] [--channel ID] [--thread ID] [--search TEXT] [--notify] [--timeout N]%s [--json]
+  %s context --event-id N [--limit N] [--json]
+  %s mark-read (--event-id N | --bot NAME --channel ID)%s
+  %s presence --bot NAME [--state online|away|dnd] [--status TEXT]%s
+  %s mute --bot NAME --channel ID --for DURATION%s [--json]
+  %s mute list [--bot NAME]%s [--json]
+  %s mute clear (--bot NAME [--channel ID] | --all)%s [--json]
+  %s channel (join | leave) --bot NAME --channel ID%s [--json]
+  %s channel create --bot NAME --name NAME [--private] [--target SERVER|TEAM]%s [--json]
+  %s channel invite --bot NAME --channel ID --user ID...%s [--json]
+  %s channels --bot NAME --topics STREAM [--limit N]%s [--json]
+  %s stream [--bot NAME] [--channel ID] [--thread ID] [--search TEXT] [--notify] [--where EXPR] [--since ID [--replay-rate N]] [--buffer N] [--catch-up] [--by-conversation [--limit N]] [--timeout N]%s [--json]
+  %s watch [--bot NAME] [--channel ID] [--thread ID] [--search TEXT] [--notify] [--where EXPR] [--since ID] [--timeout N] [--no-color]%s
+  %s notify-desktop [--bot NAME] [--channel ID] [--where EXPR] [--unseen [--limit N]] [--notifier NAME]%s
+  %s tui [--bot NAME] [--history N]%s
+  %s mcp serve [--socket PATH]
+  %s tools manifest [--format openai|anthropic]
+  %s tools call [--socket PATH] <tool> [<args-json>|-]
   %s ping
+  %s examples [command] [--json]
+  %s explain <command> [flags]
 
 Skills:
-  %s skill install [--scope project|user|all] [--agents ...] [--repo URL] [--dry-run]
-  %s skill update  [--scope project|user|all] [--agents ...]
+  %s skill install [--scope project|user|all] [--agents ...] [--repo URL|DIR] [--ref REF] [--config PATH] [--dry-run]
+  %s skill update  [--scope project|user|all] [--agents ...] [--config PATH] [--latest]
   %s skill list
 
 Admin:
   %s setup [--output PATH] [--force]
-  %s validate [--config PATH]
+  %s validate [--config PATH] [--lint [--strict]]
   %s reload [--socket PATH]
-  %s pair --bot NAME [--config PATH]
+  %s verify --bot NAME|--all [--config PATH]
+  %s rotate-token --bot NAME --bot-token TOKEN [--config PATH]
+  %s pair --bot NAME [--user USER] [--sso] [--config PATH]
+  %s invite --bot NAME|--all [--client-id ID] [--config PATH] [--json]
   %s config print [--config PATH]
   %s config list-bots [--config PATH] [--json]
   %s config set-server [--socket ...] [--db ...] [--history ...]
   %s config add-bot --name NAME --type TYPE [--bot-token ...] [--app-level-token ...] [--endpoint ...] [--transport ...] [--channels ...]
+  %s config set-bot --name NAME [--channels ...] [--display-name ...] [--set KEY=VALUE ...] [--unset KEY ...]
   %s config remove-bot --name NAME
+  %s config add-agent --name NAME --command CMD [--when EXPR] [--set KEY=VALUE ...]
+  %s config set-agent --name NAME [--command ...] [--when ...] [--set KEY=VALUE ...] [--unset KEY ...]
+  %s config remove-agent --name NAME
+  %s config set KEY=VALUE ...
+  %s config unset KEY ...
+  %s config edit [--config PATH]
+  %s config schema
+  %s db fsck [--config PATH] [--db PATH] [--repair]
+  %s db migrate [--config PATH] [--db PATH] [--status]
+  %s service install [--user] [--config PATH] [--pantalkd PATH] [--print]
+  %s service status|uninstall [--user]
+  %s bench [--events-per-sec N] [--duration D] [--subscribers N] [--read-delay D] [--json]
 
 JSON output is enabled by default when stdout is not a terminal.
 `, toolName,
@@ -629,9 +2189,50 @@ JSON output is enabled by default when stdout is not a terminal.
 		toolName,
 		toolName, svcHint,
 		toolName, svcHint,
+		toolName,
+		toolName,
+		toolName,
+		toolName,
+		toolName, svcHint,
+		toolName,
+		toolName, svcHint,
+		toolName, svcHint,
+		toolName, svcHint,
+		toolName,
+		toolName, svcHint,
+		toolName, svcHint,
+		toolName, svcHint,
+		toolName, svcHint,
 		toolName, svcHint,
 		toolName, svcHint,
 		toolName, svcHint,
+		toolName, svcHint,
+		toolName, svcHint,
+		toolName, svcHint,
+		toolName, svcHint,
+		toolName, svcHint,
+		toolName, svcHint,
+		toolName,
+		toolName,
+		toolName,
+		toolName,
+		toolName,
+		toolName,
+		toolName,
+		toolName,
+		toolName,
+		toolName,
+		toolName,
+		toolName,
+		toolName,
+		toolName,
+		toolName,
+		toolName,
+		toolName,
+		toolName,
+		toolName,
+		toolName,
+		toolName,
 		toolName,
 		toolName,
 		toolName,
@@ -646,3 +2247,19 @@ JSON output is enabled by default when stdout is not a terminal.
 		toolName,
 		toolName)
 }
+
+// sendDirect sends request through a connector of its own, for
+// `send --direct`. The connector's logging is silenced so a cron job only
+// sees the outcome; failures come back in the response.
+func sendDirect(configPath string, request protocol.Request) (protocol.Response, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return protocol.Response{}, fmt.Errorf("load config: %w", err)
+	}
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return server.SendDirect(ctx, cfg, request), nil
+}
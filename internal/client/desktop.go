@@ -0,0 +1,240 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/manpage"
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// desktopTimeout bounds one run of the notification command, so a stuck
+// notifier can't stall the stream.
+const desktopTimeout = 5 * time.Second
+
+// desktopBodyWidth keeps the body short enough for a notification bubble.
+const desktopBodyWidth = 240
+
+// desktopNotifier raises one native notification.
+type desktopNotifier struct {
+	name string
+	args func(title string, body string, urgent bool) []string
+}
+
+// desktopNotifiers are the supported notification commands, in the order
+// they are tried when --notifier is not given.
+var desktopNotifiers = []desktopNotifier{
+	{"notify-send", func(title, body string, urgent bool) []string {
+		urgency := "normal"
+		if urgent {
+			urgency = "critical"
+		}
+		return []string{"-a", "pantalk", "-u", urgency, "--", title, body}
+	}},
+	{"terminal-notifier", func(title, body string, urgent bool) []string {
+		args := []string{"-title", "pantalk", "-subtitle", title, "-message", body, "-group", "pantalk"}
+		if urgent {
+			args = append(args, "-sound", "default")
+		}
+		return args
+	}},
+	{"osascript", func(title, body string, urgent bool) []string {
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptString(body), appleScriptString(title))
+		if urgent {
+			script += ` sound name "default"`
+		}
+		return []string{"-e", script}
+	}},
+}
+
+// findNotifier returns the named notifier, or the first one installed that
+// suits this OS.
+func findNotifier(name string) (desktopNotifier, error) {
+	if name != "" {
+		for _, n := range desktopNotifiers {
+			if n.name == name {
+				if _, err := exec.LookPath(n.name); err != nil {
+					return desktopNotifier{}, fmt.Errorf("%s not found in PATH", n.name)
+				}
+				return n, nil
+			}
+		}
+		return desktopNotifier{}, fmt.Errorf("unknown notifier %q (use notify-send, terminal-notifier or osascript)", name)
+	}
+
+	candidates := []string{"notify-send"}
+	if runtime.GOOS == "darwin" {
+		candidates = []string{"terminal-notifier", "osascript"}
+	}
+	for _, candidate := range candidates {
+		if _, err := exec.LookPath(candidate); err == nil {
+			return findNotifier(candidate)
+		}
+	}
+	return desktopNotifier{}, fmt.Errorf("no desktop notifier found (install %s)", strings.Join(candidates, " or "))
+}
+
+// raise shows event as a desktop notification. Direct messages and mentions
+// are urgent.
+func (n desktopNotifier) raise(event protocol.Event) error {
+	title := event.Service + "/" + event.Bot
+	if where := firstNonEmpty(event.Channel, event.Target); where != "" {
+		title = where + " (" + title + ")"
+	}
+	if event.User != "" {
+		title = event.User + " in " + title
+	}
+	body := clip(watchText(event), desktopBodyWidth)
+
+	ctx, cancel := context.WithTimeout(context.Background(), desktopTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, n.name, n.args(title, body, event.Direct || event.Mentions)...).CombinedOutput()
+	if err != nil {
+		if detail := strings.TrimSpace(string(out)); detail != "" {
+			return fmt.Errorf("%s: %w: %s", n.name, err, detail)
+		}
+		return fmt.Errorf("%s: %w", n.name, err)
+	}
+	return nil
+}
+
+// appleScriptString quotes s as an AppleScript string literal.
+func appleScriptString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func runNotifyDesktop(service string, args []string) int {
+	flags := manpage.NewFlagSet("notify-desktop")
+	socket := flags.String("socket", defaultSocketPath, "unix socket path")
+	svcFlag := flags.String("service", "", "filter by service (slack, discord, mattermost, telegram, whatsapp)")
+	bot := flags.String("bot", "", "bot name from config")
+	channel := flags.String("channel", "", "filter by channel id")
+	where := flags.String("where", "", "only raise notifications for events matching this expression (see docs/agents.md)")
+	unseen := flags.Bool("unseen", false, "first raise the notifications that are still unseen, then follow live ones")
+	limit := flags.Int("limit", 10, "most unseen notifications to raise with --unseen")
+	notifier := flags.String("notifier", "", "notification command: notify-send, terminal-notifier or osascript (default: the first one installed)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *limit <= 0 {
+		fmt.Fprintln(os.Stderr, "--limit must be positive")
+		return 2
+	}
+
+	svc := resolveService(service, *svcFlag)
+	request := protocol.Request{
+		Action:  protocol.ActionSubscribe,
+		Service: svc,
+		Bot:     *bot,
+		Channel: *channel,
+		Notify:  true,
+		Where:   *where,
+	}
+
+	if explaining {
+		return callFailed(explainRequest(request), false)
+	}
+
+	desktop, err := findNotifier(*notifier)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// The backlog is raised oldest first, and the stream picks up after it
+	// so nothing that arrives in between is missed.
+	if *unseen {
+		resp, err := call(*socket, protocol.Request{
+			Action:  protocol.ActionNotify,
+			Service: svc,
+			Bot:     *bot,
+			Channel: *channel,
+			Unseen:  true,
+			Limit:   *limit,
+		})
+		if err != nil {
+			return callFailed(err, false)
+		}
+		if !resp.OK {
+			return responseFailed(resp, false)
+		}
+		for i := len(resp.Events) - 1; i >= 0; i-- {
+			event := resp.Events[i]
+			if err := desktop.raise(event); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			request.SinceID = max(request.SinceID, event.ID)
+		}
+	}
+
+	stream, err := openStream(*socket, request, time.Time{}, 0)
+	if err != nil {
+		return callFailed(err, false)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var mu sync.Mutex
+	go func() {
+		<-ctx.Done()
+		mu.Lock()
+		_ = stream.conn.Close()
+		mu.Unlock()
+	}()
+
+	for {
+		var resp protocol.Response
+		if err := stream.decoder.Decode(&resp); err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return 0
+			}
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if stream.legacy {
+			resp = legacyMismatch(resp, request.Action)
+		}
+		if !resp.OK {
+			return responseFailed(resp, false)
+		}
+		if resp.Event == nil {
+			continue
+		}
+
+		switch {
+		case resp.Event.Kind == protocol.KindHandoff:
+			resume := request
+			if resp.Event.ID > 0 {
+				resume.SinceID = resp.Event.ID
+			}
+			next, err := openStream(*socket, resume, time.Time{}, resumeTimeout)
+			if err != nil {
+				return callFailed(err, false)
+			}
+			mu.Lock()
+			_ = stream.conn.Close()
+			stream = next
+			if ctx.Err() != nil {
+				_ = stream.conn.Close()
+			}
+			mu.Unlock()
+		case resp.Event.Kind == protocol.KindReplayDone, resp.Event.Self, resp.Event.Direction == "out":
+			// Nothing to ping about.
+		default:
+			if err := desktop.raise(*resp.Event); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// codeDaemonUnreachable is the error code of a command that could not talk
+// to pantalkd at all, usually because it is not running.
+const codeDaemonUnreachable = "daemon_unreachable"
+
+// Exit codes of commands, stable so scripts can branch on the kind of
+// failure. 0 is success.
+const (
+	exitFailure     = 1  // anything not listed below
+	exitUsage       = 2  // bad flags, or a request pantalkd refused as invalid
+	exitUnreachable = 3  // pantalkd is not running or its socket is not reachable
+	exitUnknownBot  = 4  // no such bot, service or broadcast group
+	exitNotFound    = 5  // no such event or agent
+	exitUnsupported = 6  // the bot's platform can't do that
+	exitRateLimited = 7  // the platform throttled the call; retry later
+	exitUpstream    = 8  // the platform failed or refused the call
+	exitUnavailable = 9  // the bot's connector is restarting; retry shortly
+	exitProtocol    = 10 // pantalk and pantalkd versions don't match
+)
+
+var exitCodes = map[string]int{
+	protocol.CodeInvalidRequest:   exitUsage,
+	codeDaemonUnreachable:         exitUnreachable,
+	protocol.CodeUnknownBot:       exitUnknownBot,
+	protocol.CodeNotFound:         exitNotFound,
+	protocol.CodeUnsupported:      exitUnsupported,
+	protocol.CodeRateLimited:      exitRateLimited,
+	protocol.CodeUpstream:         exitUpstream,
+	protocol.CodeUnavailable:      exitUnavailable,
+	protocol.CodeProtocolMismatch: exitProtocol,
+}
+
+// clientError is a failure talking to pantalkd, with its error code.
+type clientError struct {
+	code string
+	err  error
+}
+
+func (e *clientError) Error() string { return e.err.Error() }
+func (e *clientError) Unwrap() error { return e.err }
+
+// failure reports a failed command and returns its exit code. The message
+// goes to stderr, or with jsonOut to stdout as
+// {"error": {"code": "...", "message": "..."}}.
+func failure(code, message string, jsonOut bool) int {
+	if code == "" {
+		// Daemons from before error codes.
+		code = protocol.CodeInternal
+	}
+	if jsonOut {
+		_ = json.NewEncoder(os.Stdout).Encode(map[string]any{
+			"error": map[string]string{"code": code, "message": message},
+		})
+	} else {
+		fmt.Fprintln(os.Stderr, message)
+	}
+	if exit, ok := exitCodes[code]; ok {
+		return exit
+	}
+	return exitFailure
+}
+
+// responseFailed reports a response that is not OK, with the trace ID to
+// look the request up by in the daemon's log.
+func responseFailed(resp protocol.Response, jsonOut bool) int {
+	message := resp.Error
+	if resp.Trace != "" {
+		message += " (trace " + resp.Trace + ")"
+	}
+	return failure(resp.Code, message, jsonOut)
+}
+
+// callFailed reports an error from call and returns the exit code.
+func callFailed(err error, jsonOut bool) int {
+	if errors.Is(err, errExplained) {
+		return 0
+	}
+	code := protocol.CodeInternal
+	var clientErr *clientError
+	if errors.As(err, &clientErr) {
+		code = clientErr.code
+	}
+	return failure(code, err.Error(), jsonOut)
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// explaining is set by `pantalk explain`. While it is set, requests are
+// written to stdout exactly as they would go over the socket instead of
+// being sent.
+var explaining bool
+
+// errExplained is returned by call in explain mode once the request has been
+// printed. Commands treat it as success.
+var errExplained = errors.New("request explained, not sent")
+
+// explainableCommands are the commands that talk to the daemon through call.
+// Admin commands either edit the config directly or have no flags to explain.
+var explainableCommands = map[string]bool{
+	"bots":           true,
+	"status":         true,
+	"logs":           true,
+	"debug":          true,
+	"send":           true,
+	"broadcast":      true,
+	"react":          true,
+	"history":        true,
+	"notifications":  true,
+	"notify":         true,
+	"context":        true,
+	"mark-read":      true,
+	"presence":       true,
+	"mute":           true,
+	"channel":        true,
+	"channels":       true,
+	"stream":         true,
+	"watch":          true,
+	"subscribe":      true,
+	"notify-desktop": true,
+	"ping":           true,
+	"examples":       true,
+	"agents":         true,
+}
+
+func runExplain(service string, toolName string, args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprintf(os.Stderr, "usage: %s explain <command> [flags]\n\nPrints the JSON request <command> would send to pantalkd, one line, without sending it.\n", toolName)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+
+	if !explainableCommands[args[0]] {
+		fmt.Fprintf(os.Stderr, "explain: %q does not send a protocol request\n", args[0])
+		return 2
+	}
+
+	explaining = true
+	defer func() { explaining = false }()
+
+	return Run(service, toolName, args)
+}
+
+// explainRequest prints request as a single newline-terminated JSON line,
+// byte-for-byte what call would write to the socket.
+func explainRequest(request protocol.Request) error {
+	if err := json.NewEncoder(os.Stdout).Encode(request); err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+	return errExplained
+}
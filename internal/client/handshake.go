@@ -0,0 +1,66 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/version"
+)
+
+// handshake opens a connection with hello and checks that the daemon can
+// handle action, so a CLI newer than the running daemon fails with a clear
+// message instead of a confusing one. Daemons from before the handshake
+// answer hello as an unsupported action; legacy is then set and the
+// request is sent anyway.
+func handshake(encoder *json.Encoder, decoder *json.Decoder, action string) (legacy bool, err error) {
+	if err := encoder.Encode(protocol.Request{Action: protocol.ActionHello, Version: protocol.ProtocolVersion}); err != nil {
+		return false, &clientError{codeDaemonUnreachable, fmt.Errorf("send request: %w", err)}
+	}
+	var resp protocol.Response
+	if err := decoder.Decode(&resp); err != nil {
+		return false, &clientError{codeDaemonUnreachable, fmt.Errorf("read response: %w", err)}
+	}
+
+	if !resp.OK {
+		if isUnsupportedAction(resp.Error) {
+			return true, nil
+		}
+		return false, mismatch("protocol mismatch: %s", resp.Error)
+	}
+	hello := resp.Hello
+	if hello == nil {
+		return false, mismatch("protocol mismatch: pantalkd answered the handshake without a version")
+	}
+	if hello.Version < protocol.MinProtocolVersion {
+		return false, mismatch("protocol mismatch: pantalkd %s speaks protocol v%d but pantalk %s needs at least v%d; upgrade pantalkd and restart it",
+			hello.Daemon, hello.Version, version.Version, protocol.MinProtocolVersion)
+	}
+	if !slices.Contains(hello.Actions, action) {
+		return false, mismatch("protocol mismatch: pantalkd %s does not support %q, which pantalk %s uses; upgrade pantalkd and restart it",
+			hello.Daemon, action, version.Version)
+	}
+	return false, nil
+}
+
+// legacyMismatch rewrites the error a pre-handshake daemon gives for an
+// action it doesn't know into the mismatch error handshake would have
+// returned.
+func legacyMismatch(resp protocol.Response, action string) protocol.Response {
+	if !resp.OK && isUnsupportedAction(resp.Error) {
+		resp.Error = fmt.Sprintf("protocol mismatch: pantalkd predates pantalk %s and does not support %q; upgrade pantalkd and restart it", version.Version, action)
+		resp.Code = protocol.CodeProtocolMismatch
+	}
+	return resp
+}
+
+// mismatch is a protocol mismatch error.
+func mismatch(format string, args ...any) error {
+	return &clientError{protocol.CodeProtocolMismatch, fmt.Errorf(format, args...)}
+}
+
+func isUnsupportedAction(message string) bool {
+	return strings.HasPrefix(message, "unsupported action")
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/ctl"
+	"github.com/pantalk/pantalk/internal/manpage"
+	"github.com/pantalk/pantalk/internal/skill"
+	"github.com/pantalk/pantalk/internal/version"
+)
+
+// manCommands lists the documented commands in page order. Flags are not
+// repeated here; they are captured from each command's own FlagSet.
+var manCommands = []struct {
+	group   string
+	name    string
+	summary string
+}{
+	{"Messaging", "bots", "List configured bots and their runtime identity."},
+	{"Messaging", "status", "Show daemon uptime, bots, agents and the notification backlog."},
+	{"Messaging", "logs", "Print the daemon's recent log entries, optionally for one bot or level, and with --follow stream new ones."},
+	{"Messaging", "debug", "Turn debug logging on or off at runtime for the whole daemon or one bot with --bot, or show what it is on for."},
+	{"Messaging", "send", "Send a message. Text can be passed with --text, --text - or piped on stdin."},
+	{"Messaging", "broadcast", "Send one message to every destination of a broadcast group from the config and report each outcome."},
+	{"Messaging", "react", "Add an emoji reaction to a message."},
+	{"Messaging", "history", "Read stored message history, optionally clearing it with --clear."},
+	{"Messaging", "notifications", "Read agent-relevant notifications (mentions, DMs, followed threads)."},
+	{"Messaging", "context", "Print the messages that came before a stored event in its thread or channel, oldest first."},
+	{"Messaging", "mark-read", "Mark a conversation read on the platform (WhatsApp read receipts, Slack, Mattermost) up to a stored event or the newest received message."},
+	{"Messaging", "presence", "Set the bot's availability (online, away, dnd) and status text on Slack, Discord or Mattermost."},
+	{"Messaging", "mute", "Mute a channel for a while: its messages are still stored but never notify and agents skip them until the mute expires."},
+	{"Messaging", "mute list", "List the channels muted now and until when."},
+	{"Messaging", "mute clear", "Lift the mutes of a channel, of every channel of a bot with --bot, or of every bot with --all."},
+	{"Messaging", "channel join", "Join a channel (Slack public channels, Mattermost)."},
+	{"Messaging", "channel leave", "Leave a channel or chat (Slack, Mattermost, Telegram)."},
+	{"Messaging", "channel create", "Create a channel with the bot as a member (Slack, Discord, Mattermost) and print its ID."},
+	{"Messaging", "channel invite", "Add users to a channel by platform user ID (Slack, Discord, Mattermost)."},
+	{"Messaging", "channels", "List the topics of a Zulip stream with --topics, most recently active first."},
+	{"Messaging", "stream", "Stream live events until --timeout elapses or the connection is closed."},
+	{"Messaging", "watch", "Follow live events in a readable form: grouped by conversation, aligned and colored, with relative times, cut to the terminal width."},
+	{"Messaging", "notify-desktop", "Raise native desktop notifications (notify-send, terminal-notifier or osascript) for live notifications, and with --unseen for the ones still unseen."},
+	{"Messaging", "tui", "Open a terminal chat client: conversations per bot with unseen badges, live messages and a line to send from."},
+	{"Messaging", "mcp serve", "Serve pantalk as a Model Context Protocol tool server over stdio, for MCP clients such as Claude Desktop or Cursor."},
+	{"Messaging", "tools manifest", "Print the MCP tools as a JSON function-calling manifest in OpenAI or Anthropic format, for frameworks that wire tools up themselves."},
+	{"Messaging", "tools call", "Run one tool from the manifest with JSON arguments (inline or - for stdin) and print its result as JSON."},
+	{"Messaging", "agents list", "List configured agents, whether they are running and how their last run ended."},
+	{"Messaging", "agents runs", "Show recent agent runs with exit code, trigger count and the tail of their output."},
+	{"Messaging", "agents run", "Launch an agent now, optionally with a stored event as its trigger, to test it or re-run a failed job."},
+	{"Messaging", "agents test", "Evaluate a when expression against a stored or supplied event and show the fields it saw, without running anything."},
+	{"Messaging", "ping", "Check that the daemon is reachable."},
+	{"Messaging", "examples", "Print ready-to-run commands built from the configured bots and recent channels. Usage: pantalk examples [command]."},
+	{"Messaging", "explain", "Print the protocol request another command would send, without sending it. Usage: pantalk explain <command> [flags]."},
+	{"Skills", "skill install", "Install pantalk agent skills into detected agent directories, from a repository (optionally pinned with --ref) or a local directory."},
+	{"Skills", "skill update", "Refresh the skills cache and reinstall, keeping a --ref pin unless --latest."},
+	{"Skills", "skill list", "List skills available in the cache."},
+	{"Admin", "setup", "Interactive wizard that writes a new config file."},
+	{"Admin", "validate", "Validate a config file without starting the daemon."},
+	{"Admin", "reload", "Ask the running daemon to reload its config."},
+	{"Admin", "verify", "Check bots' credentials with the platform's auth-test call (Slack, Discord, Mattermost, Telegram, Zulip), reporting the identity and scopes."},
+	{"Admin", "rotate-token", "Replace a bot's bot_token in the config and reload; Slack, Mattermost and Telegram connectors switch to it without dropping their session, other bots restart."},
+	{"Admin", "pair", "Pair a WhatsApp bot with a QR code or phone pairing code, or log a Matrix bot in with a password or SSO."},
+	{"Admin", "invite", "Print how to install a bot on its platform: a Slack app manifest link and OAuth URL, a Discord invite URL with the permissions pantalk uses, or the @BotFather steps for Telegram."},
+	{"Admin", "config print", "Print the config with credentials masked."},
+	{"Admin", "config list-bots", "List bots defined in the config."},
+	{"Admin", "config set-server", "Edit the server section of the config."},
+	{"Admin", "config add-bot", "Append a bot to the config."},
+	{"Admin", "config set-bot", "Change or remove settings of a bot in the config."},
+	{"Admin", "config remove-bot", "Remove a bot from the config."},
+	{"Admin", "config add-agent", "Append an agent to the config."},
+	{"Admin", "config set-agent", "Change or remove settings of an agent in the config."},
+	{"Admin", "config remove-agent", "Remove an agent from the config."},
+	{"Admin", "config set", "Set config values by their YAML path, e.g. ntfy.topic=alerts."},
+	{"Admin", "config unset", "Remove config values by their YAML path."},
+	{"Admin", "config edit", "Edit the config in $EDITOR and replace it once it validates."},
+	{"Admin", "config schema", "Print a JSON Schema of the config file for editor completion and checks."},
+	{"Admin", "db fsck", "Check the database for orphaned notifications and corruption; --repair deletes the orphans and vacuums."},
+	{"Admin", "db migrate", "Apply pending database schema migrations, as pantalkd does on start; --status lists them without applying."},
+	{"Admin", "service install", "Install pantalkd as a systemd unit (a launchd job on macOS) that restarts on failure; --user for a per-user service."},
+	{"Admin", "service status", "Show the state of the installed pantalkd service."},
+	{"Admin", "service uninstall", "Stop, disable and remove the pantalkd service."},
+	{"Admin", "bench", "Drive synthetic events through an in-process daemon with a mock bot and report store write, publish and fan-out latency percentiles and subscriber drops."},
+}
+
+// ManPage builds the pantalk(1) page from the live command definitions.
+func ManPage() manpage.Page {
+	page := manpage.Page{
+		Name:     "pantalk",
+		Summary:  "talk to chat platforms through the pantalkd daemon",
+		Synopsis: []string{"<command> [flags]"},
+		Description: `pantalk is the command-line client for pantalkd. Messaging commands talk to the daemon over a unix socket using newline-delimited JSON; admin commands edit the config file directly.
+
+JSON output is the default whenever stdout is not a terminal, so the same commands work for people and for agents.
+
+Every request is recorded under a trace ID, which failures print so the request can be found in the daemon's log. Set $PANTALK_TRACE to 32 hex digits to choose the ID, e.g. to follow a script's requests in a tracing backend.`,
+		Files: []manpage.Item{
+			{Tag: "~/.config/pantalk/config.yaml", Text: "Default config file; override with --config or $PANTALK_CONFIG."},
+			{Tag: "$XDG_RUNTIME_DIR/pantalk.sock", Text: "Default daemon socket; falls back to /tmp/pantalk-<uid>.sock."},
+		},
+		SeeAlso: []string{"pantalkd(1)"},
+		Version: version.Version,
+	}
+
+	for _, cmd := range manCommands {
+		entry := manpage.Command{Name: cmd.name, Group: cmd.group, Summary: cmd.summary}
+
+		// explain takes another command's flags rather than its own.
+		if cmd.name != "explain" {
+			args := append(strings.Fields(cmd.name), "-h")
+			if fs := manpage.Capture(func() { runForFlags(cmd.group, args) }); fs != nil {
+				entry.Flags = manpage.FlagsFrom(fs)
+			}
+		}
+		for i, f := range entry.Flags {
+			if f.Name == "json" {
+				// The usage text already explains the TTY-dependent default.
+				entry.Flags[i].Default = ""
+			}
+		}
+		page.Commands = append(page.Commands, entry)
+	}
+
+	for resolved, symbolic := range config.SymbolicPaths() {
+		page.Replace(resolved, symbolic)
+	}
+
+	return page
+}
+
+// runForFlags invokes a command just far enough for it to define and parse
+// its flags. Admin and skill commands are called directly so their flag.ErrHelp
+// is not echoed to stderr by Run.
+func runForFlags(group string, args []string) {
+	switch group {
+	case "Admin":
+		_ = ctl.Run(args)
+	case "Skills":
+		_ = skill.Run(args[1:])
+	default:
+		Run("", "pantalk", args)
+	}
+}
+
+func runMan(args []string) int {
+	flags := manpage.NewFlagSet("man")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if err := manpage.Write(os.Stdout, ManPage()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
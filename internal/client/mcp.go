@@ -0,0 +1,500 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/manpage"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/version"
+)
+
+// mcpProtocolVersion is the Model Context Protocol revision this server
+// implements. Clients asking for another one get this one back and decide
+// whether to continue.
+const mcpProtocolVersion = "2025-06-18"
+
+// Bounds for wait_for_events, which holds a subscription open.
+const (
+	mcpDefaultWait = 30
+	mcpMaxWait     = 300
+)
+
+// JSON-RPC error codes used by the MCP server.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+func runMCP(args []string) int {
+	if len(args) == 0 || args[0] != "serve" {
+		fmt.Fprintln(os.Stderr, "usage: pantalk mcp serve [--socket PATH]")
+		return 2
+	}
+
+	flags := manpage.NewFlagSet("mcp serve")
+	socket := flags.String("socket", defaultSocketPath, "unix socket path")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	server := &mcpServer{socket: *socket, out: json.NewEncoder(os.Stdout)}
+	if err := server.serve(os.Stdin); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// mcpServer serves pantalk operations as MCP tools over the stdio
+// transport: one JSON-RPC message per line on stdin, replies on stdout.
+// Each tool is a request to the daemon at socket.
+type mcpServer struct {
+	socket string
+
+	mu  sync.Mutex // serializes writes to out
+	out *json.Encoder
+}
+
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (s *mcpServer) serve(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var msg rpcMessage
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			s.reply(json.RawMessage("null"), nil, &rpcError{rpcParseError, "parse error: " + err.Error()})
+			continue
+		}
+		if msg.Method == "" {
+			// A response to a request we never send, or garbage.
+			if len(msg.ID) > 0 {
+				s.reply(msg.ID, nil, &rpcError{rpcInvalidRequest, "missing method"})
+			}
+			continue
+		}
+		// Notifications (no id) need no reply; none of them change state here.
+		if len(msg.ID) == 0 {
+			continue
+		}
+
+		// Tool calls can wait on the daemon, so they don't hold up pings
+		// or other calls.
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, rpcErr := s.handle(msg)
+			s.reply(msg.ID, result, rpcErr)
+		}()
+	}
+	return scanner.Err()
+}
+
+func (s *mcpServer) reply(id json.RawMessage, result any, rpcErr *rpcError) {
+	if rpcErr == nil && result == nil {
+		result = struct{}{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.out.Encode(rpcResponse{JSONRPC: "2.0", ID: id, Result: result, Error: rpcErr})
+}
+
+func (s *mcpServer) handle(msg rpcMessage) (any, *rpcError) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]any{
+			"protocolVersion": mcpProtocolVersion,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "pantalk", "version": version.Version},
+			"instructions":    "Tools for the chat bots served by the local pantalk daemon: list bots, read and wait for notifications, send messages and mark conversations read.",
+		}, nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		tools := make([]map[string]any, 0, len(mcpTools))
+		for _, tool := range mcpTools {
+			tools = append(tools, map[string]any{
+				"name":        tool.name,
+				"description": tool.description,
+				"inputSchema": tool.schema(),
+			})
+		}
+		return map[string]any{"tools": tools}, nil
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &rpcError{rpcInvalidParams, "invalid params: " + err.Error()}
+		}
+		if tool, ok := findMCPTool(params.Name); ok {
+			return s.callTool(tool, params.Arguments), nil
+		}
+		return nil, &rpcError{rpcInvalidParams, fmt.Sprintf("unknown tool %q", params.Name)}
+	default:
+		return nil, &rpcError{rpcMethodNotFound, fmt.Sprintf("method %q not found", msg.Method)}
+	}
+}
+
+// mcpToolArgs are the arguments of every tool; each uses a subset. They
+// are the daemon's request fields under the same JSON names, plus the
+// few wait_for_events handles itself.
+type mcpToolArgs struct {
+	protocol.Request
+	Timeout   int `json:"timeout"`
+	MaxEvents int `json:"max_events"`
+}
+
+type mcpTool struct {
+	name        string
+	description string
+	properties  []string // mcpToolArgs fields, by JSON name
+	required    []string
+	run         func(s *mcpServer, args mcpToolArgs) (any, error)
+}
+
+// mcpArgDocs describes the tool arguments for the input schemas, on top of
+// the JSON type their mcpToolArgs field has. Every request field is either
+// described here or listed in mcpUnexposed.
+var mcpArgDocs = map[string]map[string]any{
+	"service":    {"description": "Service of the bot (slack, discord, telegram, ...); only needed when bot names repeat across services."},
+	"bot":        {"description": "Bot name from the pantalk config."},
+	"target":     {"description": "Destination ID, e.g. a user for a direct message."},
+	"channel":    {"description": "Channel ID."},
+	"thread":     {"description": "Thread ID."},
+	"text":       {"description": "Message text."},
+	"format":     {"enum": []string{"plain", "markdown", "html"}, "description": "Format of text; converted to what the platform supports."},
+	"translate":  {"description": "Translate text into this language (ISO-639-1 code such as de) before sending; needs translation in the pantalk config."},
+	"search":     {"description": "Only messages containing this text (case-insensitive)."},
+	"where":      {"description": "Only events matching this expression, e.g. `direct || mentions`."},
+	"notify":     {"description": "Only events that notify the agent (mentions, direct messages, followed threads)."},
+	"unseen":     {"description": "Only notifications not yet marked seen."},
+	"limit":      {"minimum": 1, "description": "Maximum number of events (default 20)."},
+	"since_id":   {"minimum": 0, "description": "Only events with an ID greater than this."},
+	"event_id":   {"minimum": 1, "description": "ID of a stored event, as returned by the read tools."},
+	"reply_to":   {"minimum": 1, "description": "ID of a stored event to reply to: in its thread, or one started from it where the service has threads. Channel, thread and target may then be left out."},
+	"timeout":    {"minimum": 1, "maximum": mcpMaxWait, "description": "Seconds to wait (default 30)."},
+	"max_events": {"minimum": 1, "description": "Return as soon as this many events arrived (default 1)."},
+}
+
+// mcpUnexposed are the request fields no tool takes: protocol plumbing, and
+// what the tools leave to the CLI and the config.
+var mcpUnexposed = []string{
+	"id", "trace", "action", "version", "emoji", "all", "author", "author_avatar",
+	"interactive", "blocks", "embeds", "start_thread", "files", "dry_run", "presence",
+	"group", "name", "private", "users", "replay_rate", "buffer", "catch_up",
+	"by_conversation", "level", "follow", "debug", "for", "command", "agent",
+	"force", "when", "event", "forward", "direction", "kind",
+}
+
+// mcpArgFields maps the JSON names of the mcpToolArgs fields, the request's
+// included, to their types.
+func mcpArgFields() map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for _, field := range reflect.VisibleFields(reflect.TypeFor[mcpToolArgs]()) {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous || !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// mcpArgType is the JSON schema type of a tool argument of type t.
+func mcpArgType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func (t mcpTool) schema() map[string]any {
+	fields := mcpArgFields()
+	properties := make(map[string]any, len(t.properties))
+	for _, name := range t.properties {
+		property := map[string]any{"type": mcpArgType(fields[name])}
+		for key, value := range mcpArgDocs[name] {
+			property[key] = value
+		}
+		properties[name] = property
+	}
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(t.required) > 0 {
+		schema["required"] = t.required
+	}
+	return schema
+}
+
+var mcpTools = []mcpTool{
+	{
+		name:        "list_bots",
+		description: "List the bots pantalk serves, with their service, name and capabilities.",
+		properties:  []string{"service"},
+		run: func(s *mcpServer, args mcpToolArgs) (any, error) {
+			resp, err := s.call(protocol.Request{Action: protocol.ActionBots, Service: args.Service})
+			return resp.Bots, err
+		},
+	},
+	{
+		name:        "send_message",
+		description: "Send a message as a bot to a channel, thread or user.",
+		properties:  []string{"bot", "text", "channel", "thread", "target", "reply_to", "format", "translate", "service"},
+		required:    []string{"bot", "text"},
+		run: func(s *mcpServer, args mcpToolArgs) (any, error) {
+			if args.Channel == "" && args.Thread == "" && args.Target == "" && args.ReplyTo == 0 {
+				return nil, errors.New("channel, thread, target or reply_to is required")
+			}
+			resp, err := s.call(protocol.Request{
+				Action:    protocol.ActionSend,
+				Service:   args.Service,
+				Bot:       args.Bot,
+				Target:    args.Target,
+				Channel:   args.Channel,
+				Thread:    args.Thread,
+				ReplyTo:   args.ReplyTo,
+				Text:      args.Text,
+				Format:    args.Format,
+				Translate: args.Translate,
+			})
+			if resp.Event != nil {
+				return resp.Event, err
+			}
+			return resp.Ack, err
+		},
+	},
+	{
+		name:        "read_notifications",
+		description: "Read notifications: messages that mention the bots, direct messages and replies in followed threads, newest last.",
+		properties:  []string{"bot", "channel", "thread", "search", "unseen", "limit", "since_id", "service"},
+		run: func(s *mcpServer, args mcpToolArgs) (any, error) {
+			return s.readEvents(protocol.ActionNotify, args)
+		},
+	},
+	{
+		name:        "read_history",
+		description: "Read the stored message history of the bots' channels, newest last.",
+		properties:  []string{"bot", "channel", "thread", "search", "notify", "limit", "since_id", "service"},
+		run: func(s *mcpServer, args mcpToolArgs) (any, error) {
+			return s.readEvents(protocol.ActionHistory, args)
+		},
+	},
+	{
+		name:        "mark_read",
+		description: "Mark a conversation read up to its newest message, on the platform where supported, and its notifications seen. Give event_id, or bot and channel.",
+		properties:  []string{"event_id", "bot", "channel", "service"},
+		run: func(s *mcpServer, args mcpToolArgs) (any, error) {
+			if args.EventID <= 0 && (args.Bot == "" || args.Channel == "") {
+				return nil, errors.New("event_id, or bot and channel, is required")
+			}
+			resp, err := s.call(protocol.Request{
+				Action:  protocol.ActionMarkRead,
+				Service: args.Service,
+				Bot:     args.Bot,
+				Channel: args.Channel,
+				EventID: args.EventID,
+			})
+			return resp.Ack, err
+		},
+	},
+	{
+		name:        "wait_for_events",
+		description: "Wait for new events (like pantalk stream) and return those that arrive before the timeout. Pass since_id to also get stored events after it, so nothing is missed between calls.",
+		properties:  []string{"bot", "channel", "thread", "search", "notify", "where", "since_id", "timeout", "max_events", "service"},
+		run: func(s *mcpServer, args mcpToolArgs) (any, error) {
+			return s.waitForEvents(args)
+		},
+	},
+}
+
+func findMCPTool(name string) (mcpTool, bool) {
+	for _, tool := range mcpTools {
+		if tool.name == name {
+			return tool, true
+		}
+	}
+	return mcpTool{}, false
+}
+
+// callTool runs a tool. Failures are tool results flagged isError, which
+// the model sees, rather than protocol errors.
+func (s *mcpServer) callTool(tool mcpTool, raw json.RawMessage) map[string]any {
+	result, err := s.runTool(tool, raw)
+	if err != nil {
+		return mcpToolResult(err.Error(), true)
+	}
+	text, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return mcpToolResult(err.Error(), true)
+	}
+	return mcpToolResult(string(text), false)
+}
+
+// runTool checks the raw JSON arguments against the tool's required ones
+// and runs it.
+func (s *mcpServer) runTool(tool mcpTool, raw json.RawMessage) (any, error) {
+	var args mcpToolArgs
+	present := map[string]any{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %w", err)
+		}
+		_ = json.Unmarshal(raw, &present)
+	}
+	for _, name := range tool.required {
+		if value, ok := present[name]; !ok || value == "" {
+			return nil, errors.New(name + " is required")
+		}
+	}
+	return tool.run(s, args)
+}
+
+func mcpToolResult(text string, isError bool) map[string]any {
+	return map[string]any{
+		"content": []map[string]any{{"type": "text", "text": text}},
+		"isError": isError,
+	}
+}
+
+// call sends a request to the daemon, turning a refusal into an error.
+func (s *mcpServer) call(request protocol.Request) (protocol.Response, error) {
+	resp, err := call(s.socket, request)
+	if err != nil {
+		return resp, err
+	}
+	if !resp.OK {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+func (s *mcpServer) readEvents(action string, args mcpToolArgs) (any, error) {
+	limit := args.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	resp, err := s.call(protocol.Request{
+		Action:  action,
+		Service: args.Service,
+		Bot:     args.Bot,
+		Channel: args.Channel,
+		Thread:  args.Thread,
+		Search:  args.Search,
+		Notify:  args.Notify,
+		Unseen:  args.Unseen,
+		Limit:   limit,
+		SinceID: args.SinceID,
+	})
+	if resp.Events == nil {
+		resp.Events = []protocol.Event{}
+	}
+	return resp.Events, err
+}
+
+// waitForEvents subscribes and collects events until max_events arrived or
+// the timeout passed. System events (connector status, heartbeats) and the
+// end of a since_id replay are left out; a handoff to a new daemon ends the
+// wait early.
+func (s *mcpServer) waitForEvents(args mcpToolArgs) (any, error) {
+	timeout := args.Timeout
+	if timeout <= 0 {
+		timeout = mcpDefaultWait
+	}
+	timeout = min(timeout, mcpMaxWait)
+	maxEvents := max(args.MaxEvents, 1)
+
+	stream, err := openStream(s.socket, protocol.Request{
+		Action:  protocol.ActionSubscribe,
+		Service: args.Service,
+		Bot:     args.Bot,
+		Channel: args.Channel,
+		Thread:  args.Thread,
+		Search:  args.Search,
+		Notify:  args.Notify,
+		Where:   args.Where,
+		SinceID: args.SinceID,
+	}, time.Now().Add(time.Duration(timeout)*time.Second), 0)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.conn.Close()
+
+	events := []protocol.Event{}
+	for len(events) < maxEvents {
+		var resp protocol.Response
+		if err := stream.decoder.Decode(&resp); err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return nil, err
+		}
+		if stream.legacy {
+			resp = legacyMismatch(resp, protocol.ActionSubscribe)
+		}
+		if !resp.OK {
+			return nil, errors.New(resp.Error)
+		}
+		if resp.Event == nil {
+			continue
+		}
+		if resp.Event.Kind == protocol.KindHandoff {
+			return events, nil
+		}
+		if resp.Event.Kind == protocol.KindReplayDone || resp.Event.Direction == "system" {
+			continue
+		}
+		events = append(events, *resp.Event)
+	}
+	return events, nil
+}
@@ -0,0 +1,299 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// fakeDaemon serves the pantalk protocol on a unix socket: it answers the
+// handshake and passes every other request to handle. It returns the
+// socket path and the requests handle got.
+func fakeDaemon(t *testing.T, handle func(protocol.Request) protocol.Response) (string, func() []protocol.Request) {
+	t.Helper()
+	// Unix socket paths are short; t.TempDir can be too long.
+	dir, err := os.MkdirTemp("", "pantalk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "d.sock")
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	var mu sync.Mutex
+	var requests []protocol.Request
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				decoder, encoder := json.NewDecoder(conn), json.NewEncoder(conn)
+				for {
+					var req protocol.Request
+					if err := decoder.Decode(&req); err != nil {
+						return
+					}
+					if req.Action == protocol.ActionHello {
+						_ = encoder.Encode(protocol.Response{OK: true, Hello: &protocol.Hello{
+							Version:    protocol.ProtocolVersion,
+							MinVersion: protocol.MinProtocolVersion,
+							Daemon:     "test",
+							Actions:    []string{protocol.ActionBots, protocol.ActionSend, protocol.ActionHistory, protocol.ActionNotify, protocol.ActionMarkRead, protocol.ActionSubscribe},
+						}})
+						continue
+					}
+					mu.Lock()
+					requests = append(requests, req)
+					mu.Unlock()
+					_ = encoder.Encode(handle(req))
+				}
+			}()
+		}
+	}()
+
+	return socket, func() []protocol.Request {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]protocol.Request(nil), requests...)
+	}
+}
+
+type testRPCResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// serveMCP runs an MCP session of lines against socket and returns the
+// replies by request ID. Tool calls answer concurrently, so out of order.
+func serveMCP(t *testing.T, socket string, lines ...string) map[string]testRPCResponse {
+	t.Helper()
+	var out bytes.Buffer
+	server := &mcpServer{socket: socket, out: json.NewEncoder(&out)}
+	if err := server.serve(strings.NewReader(strings.Join(lines, "\n") + "\n")); err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+
+	replies := make(map[string]testRPCResponse)
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var resp testRPCResponse
+		if err := decoder.Decode(&resp); err != nil {
+			t.Fatalf("decode reply: %v", err)
+		}
+		replies[string(resp.ID)] = resp
+	}
+	return replies
+}
+
+// toolText returns the text content of a tools/call result and whether it
+// is flagged as an error.
+func toolText(t *testing.T, resp testRPCResponse) (string, bool) {
+	t.Helper()
+	if resp.Error != nil {
+		t.Fatalf("unexpected protocol error %+v", resp.Error)
+	}
+	var result struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		IsError bool `json:"isError"`
+	}
+	if err := json.Unmarshal(resp.Result, &result); err != nil || len(result.Content) != 1 {
+		t.Fatalf("unexpected tool result %s: %v", resp.Result, err)
+	}
+	return result.Content[0].Text, result.IsError
+}
+
+func TestMCP_Initialize(t *testing.T) {
+	replies := serveMCP(t, "", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05"}}`, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	if len(replies) != 1 {
+		t.Fatalf("expected only the request answered, got %v", replies)
+	}
+
+	var result struct {
+		ProtocolVersion string         `json:"protocolVersion"`
+		Capabilities    map[string]any `json:"capabilities"`
+		ServerInfo      struct {
+			Name string `json:"name"`
+		} `json:"serverInfo"`
+	}
+	if err := json.Unmarshal(replies["1"].Result, &result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if result.ProtocolVersion != mcpProtocolVersion || result.ServerInfo.Name != "pantalk" || result.Capabilities["tools"] == nil {
+		t.Fatalf("unexpected initialize result %s", replies["1"].Result)
+	}
+}
+
+func TestMCP_ToolsList(t *testing.T) {
+	replies := serveMCP(t, "", `{"jsonrpc":"2.0","id":"list","method":"tools/list"}`)
+
+	var result struct {
+		Tools []struct {
+			Name        string `json:"name"`
+			InputSchema struct {
+				Type       string                    `json:"type"`
+				Properties map[string]map[string]any `json:"properties"`
+				Required   []string                  `json:"required"`
+			} `json:"inputSchema"`
+		} `json:"tools"`
+	}
+	if err := json.Unmarshal(replies[`"list"`].Result, &result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(result.Tools) != len(mcpTools) {
+		t.Fatalf("expected %d tools, got %d", len(mcpTools), len(result.Tools))
+	}
+	for i, tool := range result.Tools {
+		if tool.Name != mcpTools[i].name || tool.InputSchema.Type != "object" {
+			t.Fatalf("unexpected tool %+v", tool)
+		}
+		for _, name := range tool.InputSchema.Required {
+			if _, ok := tool.InputSchema.Properties[name]; !ok {
+				t.Fatalf("tool %s requires %s but doesn't describe it", tool.Name, name)
+			}
+		}
+	}
+}
+
+func TestMCP_ToolsCall(t *testing.T) {
+	socket, requests := fakeDaemon(t, func(req protocol.Request) protocol.Response {
+		return protocol.Response{OK: true, Event: &protocol.Event{ID: 42, Service: "slack", Bot: req.Bot, Channel: req.Channel, Text: req.Text}}
+	})
+
+	replies := serveMCP(t, socket, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"send_message","arguments":{"bot":"ops","channel":"C1","text":"deployed"}}}`)
+	text, isError := toolText(t, replies["2"])
+	if isError {
+		t.Fatalf("unexpected tool error %q", text)
+	}
+	var event protocol.Event
+	if err := json.Unmarshal([]byte(text), &event); err != nil || event.ID != 42 || event.Text != "deployed" {
+		t.Fatalf("expected the sent event back, got %q: %v", text, err)
+	}
+
+	got := requests()
+	if len(got) != 1 || got[0].Action != protocol.ActionSend || got[0].Bot != "ops" || got[0].Channel != "C1" || got[0].Text != "deployed" {
+		t.Fatalf("unexpected daemon requests %+v", got)
+	}
+}
+
+func TestMCP_ToolsCallMissingArgument(t *testing.T) {
+	socket, requests := fakeDaemon(t, func(protocol.Request) protocol.Response {
+		return protocol.Response{OK: true}
+	})
+
+	replies := serveMCP(t, socket, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"send_message","arguments":{"bot":"ops","channel":"C1"}}}`)
+	if text, isError := toolText(t, replies["3"]); !isError || text != "text is required" {
+		t.Fatalf("expected a missing argument error, got %q (isError %v)", text, isError)
+	}
+	if got := requests(); len(got) != 0 {
+		t.Fatalf("expected nothing sent to the daemon, got %+v", got)
+	}
+}
+
+func TestMCP_DaemonErrors(t *testing.T) {
+	socket, _ := fakeDaemon(t, func(req protocol.Request) protocol.Response {
+		return protocol.Response{OK: false, Error: `unknown bot "nope"`, Code: protocol.CodeUnknownBot}
+	})
+
+	replies := serveMCP(t, socket, `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"read_history","arguments":{"bot":"nope"}}}`)
+	if text, isError := toolText(t, replies["4"]); !isError || text != `unknown bot "nope"` {
+		t.Fatalf("expected the daemon's error as a tool error, got %q (isError %v)", text, isError)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.sock")
+	replies = serveMCP(t, missing, `{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"list_bots"}}`)
+	if text, isError := toolText(t, replies["5"]); !isError || !strings.Contains(text, "connect socket") {
+		t.Fatalf("expected an unreachable daemon reported as a tool error, got %q (isError %v)", text, isError)
+	}
+}
+
+func TestMCP_ProtocolErrors(t *testing.T) {
+	replies := serveMCP(t, "",
+		`{"jsonrpc":"2.0","id":6,"method":"resources/list"}`,
+		`{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"rm_rf"}}`,
+		`{"jsonrpc":"2.0","id":8,"method":"tools/call","params":"nope"}`,
+		`{"jsonrpc":"2.0","id":9,`,
+	)
+
+	for id, want := range map[string]int{"6": rpcMethodNotFound, "7": rpcInvalidParams, "8": rpcInvalidParams, "null": rpcParseError} {
+		resp, ok := replies[id]
+		if !ok || resp.Error == nil || resp.Error.Code != want {
+			t.Errorf("id %s: expected error %d, got %+v", id, want, resp)
+		}
+	}
+}
+
+func TestMCP_CallUnwrapsDaemonRefusal(t *testing.T) {
+	socket, _ := fakeDaemon(t, func(protocol.Request) protocol.Response {
+		return protocol.Response{OK: false, Error: "send failed"}
+	})
+
+	server := &mcpServer{socket: socket}
+	if _, err := server.call(protocol.Request{Action: protocol.ActionSend}); err == nil || err.Error() != "send failed" {
+		t.Fatalf("expected the refusal as an error, got %v", err)
+	}
+	var clientErr *clientError
+	if _, err := (&mcpServer{socket: filepath.Join(t.TempDir(), "x.sock")}).call(protocol.Request{Action: protocol.ActionSend}); !errors.As(err, &clientErr) {
+		t.Fatalf("expected a client error for an unreachable daemon, got %v", err)
+	}
+}
+
+func TestMCP_ToolArgumentsCoverRequestFields(t *testing.T) {
+	fields := mcpArgFields()
+	unexposed := make(map[string]bool, len(mcpUnexposed))
+	for _, name := range mcpUnexposed {
+		unexposed[name] = true
+	}
+
+	request := reflect.TypeFor[protocol.Request]()
+	for i := 0; i < request.NumField(); i++ {
+		name, _, _ := strings.Cut(request.Field(i).Tag.Get("json"), ",")
+		_, described := mcpArgDocs[name]
+		if described == unexposed[name] {
+			t.Errorf("request field %s must be either described in mcpArgDocs or listed in mcpUnexposed", name)
+		}
+		if _, ok := fields[name]; !ok {
+			t.Errorf("request field %s is not a tool argument", name)
+		}
+	}
+	for name := range mcpArgDocs {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("mcpArgDocs describes %s, which is no tool argument", name)
+		}
+	}
+	for _, tool := range mcpTools {
+		for _, name := range tool.properties {
+			if _, ok := mcpArgDocs[name]; !ok {
+				t.Errorf("tool %s takes undescribed argument %s", tool.name, name)
+			}
+			if typ := mcpArgType(fields[name]); typ == "object" || typ == "array" {
+				t.Errorf("tool %s argument %s has type %s, which tool callers can't fill", tool.name, name, typ)
+			}
+		}
+	}
+
+	properties := mcpTools[0].schema()["properties"].(map[string]any)
+	if got := properties["service"].(map[string]any)["type"]; got != "string" {
+		t.Fatalf("expected service typed from the request field, got %v", got)
+	}
+}
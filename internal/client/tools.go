@@ -0,0 +1,116 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pantalk/pantalk/internal/manpage"
+)
+
+// runTools describes pantalk's operations as LLM tool definitions and runs
+// them, for orchestration frameworks that wire tools up from a manifest
+// instead of speaking MCP. The tools are the ones pantalk mcp serve offers.
+func runTools(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: pantalk tools manifest [--format openai|anthropic] | pantalk tools call NAME [ARGS_JSON|-]")
+		return 2
+	}
+
+	switch args[0] {
+	case "manifest":
+		return runToolsManifest(args[1:])
+	case "call":
+		return runToolsCall(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown tools command %q (expected manifest or call)\n", args[0])
+		return 2
+	}
+}
+
+func runToolsManifest(args []string) int {
+	flags := manpage.NewFlagSet("tools manifest")
+	format := flags.String("format", "openai", "schema flavor: openai or anthropic")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	manifest := make([]map[string]any, 0, len(mcpTools))
+	for _, tool := range mcpTools {
+		switch *format {
+		case "openai":
+			manifest = append(manifest, map[string]any{
+				"type": "function",
+				"function": map[string]any{
+					"name":        tool.name,
+					"description": tool.description,
+					"parameters":  tool.schema(),
+				},
+			})
+		case "anthropic":
+			manifest = append(manifest, map[string]any{
+				"name":         tool.name,
+				"description":  tool.description,
+				"input_schema": tool.schema(),
+			})
+		default:
+			fmt.Fprintf(os.Stderr, "unknown format %q (expected openai or anthropic)\n", *format)
+			return 2
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(manifest)
+	return 0
+}
+
+// runToolsCall runs one tool with JSON arguments, as an orchestrator does
+// once the model picked it, and prints the result as JSON.
+func runToolsCall(args []string) int {
+	flags := manpage.NewFlagSet("tools call")
+	socket := flags.String("socket", defaultSocketPath, "unix socket path")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		fmt.Fprintln(os.Stderr, "usage: pantalk tools call [--socket PATH] NAME [ARGS_JSON|-]")
+		return 2
+	}
+
+	tool, ok := findMCPTool(flags.Arg(0))
+	if !ok {
+		names := make([]string, 0, len(mcpTools))
+		for _, tool := range mcpTools {
+			names = append(names, tool.name)
+		}
+		fmt.Fprintf(os.Stderr, "unknown tool %q (available: %s)\n", flags.Arg(0), strings.Join(names, ", "))
+		return 2
+	}
+
+	raw := flags.Arg(1)
+	if raw == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "read arguments: %v\n", err)
+			return 1
+		}
+		raw = string(data)
+	}
+	if strings.TrimSpace(raw) == "" {
+		raw = "{}"
+	}
+
+	server := &mcpServer{socket: *socket}
+	result, err := server.runTool(tool, json.RawMessage(raw))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(result)
+	return 0
+}
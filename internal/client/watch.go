@@ -0,0 +1,189 @@
+package client
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/tui"
+)
+
+// watchUserWidth is the width of the user column of `pantalk watch`.
+const watchUserWidth = 12
+
+// userColors are the ANSI colors watch picks from, by name, for users.
+var userColors = []string{"31", "32", "33", "34", "35", "36"}
+
+// prettyPrinter prints events for `pantalk watch`: a heading whenever the
+// conversation changes, then one aligned line per event, cut to the
+// terminal width.
+type prettyPrinter struct {
+	out   io.Writer
+	color bool
+	width func() int
+
+	lastConversation string
+}
+
+func newPrettyPrinter(out io.Writer, color bool, width func() int) *prettyPrinter {
+	return &prettyPrinter{out: out, color: color, width: width}
+}
+
+// terminalWidth returns a function reporting stdout's current width, or 0
+// (no truncation) when stdout is not a terminal.
+func terminalWidth() func() int {
+	return func() int {
+		width, _, err := term.GetSize(int(os.Stdout.Fd()))
+		if err != nil {
+			return 0
+		}
+		return width
+	}
+}
+
+func (p *prettyPrinter) paint(code, s string) string {
+	if !p.color || s == "" {
+		return s
+	}
+	return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
+
+func (p *prettyPrinter) print(event protocol.Event, now time.Time) {
+	width := p.width()
+	// Control characters in any field would move the cursor or recolor the
+	// terminal; watchText cleans the text itself.
+	for _, field := range []*string{&event.Service, &event.Bot, &event.Channel, &event.Target, &event.User} {
+		*field = tui.StripControls(*field)
+	}
+
+	if event.Kind == protocol.KindReplayDone {
+		if p.lastConversation != "" {
+			fmt.Fprintln(p.out)
+		}
+		p.lastConversation = ""
+		fmt.Fprintln(p.out, p.paint("2", clip("── "+tui.StripControls(event.Text)+" · live from here ──", width)))
+		return
+	}
+
+	conversation := event.Service + ":" + event.Bot
+	if where := firstNonEmpty(event.Channel, event.Target); where != "" {
+		conversation += " · " + where
+	}
+	if conversation != p.lastConversation {
+		if p.lastConversation != "" {
+			fmt.Fprintln(p.out)
+		}
+		p.lastConversation = conversation
+		fmt.Fprintln(p.out, p.paint("1;36", clip("── "+conversation+" ──", width)))
+	}
+
+	clock := event.Timestamp.Local().Format("15:04")
+	age := fmt.Sprintf("%-8s", relativeTime(now.Sub(event.Timestamp)))
+
+	who, userCode := firstNonEmpty(event.User, "?"), userColors[colorIndex(event.User)]
+	if event.Direction == "out" || event.Self {
+		who, userCode = "me", "2"
+	}
+	who = fmt.Sprintf("%-*s", watchUserWidth, clip(who, watchUserWidth))
+
+	marker := " "
+	switch {
+	case event.Direct:
+		marker = p.paint("1;35", "✉")
+	case event.Notify:
+		marker = p.paint("1;33", "●")
+	}
+
+	// Indent, clock, age, user and marker, with the spaces between them.
+	prefixWidth := 2 + 5 + 2 + 8 + 2 + watchUserWidth + 1 + 1 + 1
+	text := watchText(event)
+	if width > 0 {
+		text = clip(text, width-prefixWidth)
+	}
+
+	textOut := text
+	if isWatchLifecycle(event.Kind) {
+		textOut = p.paint("2;3", text)
+	}
+	fmt.Fprintf(p.out, "  %s  %s  %s %s %s\n", p.paint("2", clock), p.paint("2", age), p.paint(userCode, who), marker, textOut)
+}
+
+// watchText is the one-line text shown for event.
+func watchText(event protocol.Event) string {
+	// Control characters in a message would move the cursor or recolor the
+	// terminal; line breaks and tabs become single spaces first.
+	text := tui.StripControls(strings.Join(strings.Fields(event.Text), " "))
+	switch event.Kind {
+	case protocol.KindEdit:
+		text = "edited: " + text
+	case protocol.KindDelete:
+		text = "deleted a message"
+	case protocol.KindReaction:
+		text = "reacted " + text
+	case protocol.KindReceipt:
+		text = strings.TrimSuffix("message "+tui.StripControls(event.Status)+": "+text, ": ")
+	}
+	if event.Thread != "" {
+		text = "↳ " + text
+	}
+	for _, attachment := range event.Attachments {
+		text += " [" + tui.StripControls(attachment.Kind)
+		if name := tui.StripControls(attachment.Name); name != "" {
+			text += ": " + name
+		}
+		text += "]"
+	}
+	return text
+}
+
+func isWatchLifecycle(kind string) bool {
+	return kind == protocol.KindEdit || kind == protocol.KindDelete || kind == protocol.KindReaction || kind == protocol.KindReceipt
+}
+
+// relativeTime formats how long ago something happened, coarsely.
+func relativeTime(d time.Duration) string {
+	switch {
+	case d < 10*time.Second:
+		return "just now"
+	case d < time.Minute:
+		return fmt.Sprintf("%ds ago", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
+
+// clip cuts s to width runes, marking the cut with an ellipsis. A width of
+// zero or less leaves s alone.
+func clip(s string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:width-1]) + "…"
+}
+
+func colorIndex(name string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	return int(h.Sum32() % uint32(len(userColors)))
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
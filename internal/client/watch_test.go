@@ -0,0 +1,48 @@
+package client
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func TestWatchText_StripsControls(t *testing.T) {
+	event := protocol.Event{
+		Kind:        protocol.KindReceipt,
+		Status:      "read\x1b[2J",
+		Text:        "hi\x1b[31m\nthere\u009b2J",
+		Attachments: []protocol.Attachment{{Kind: "file\x07", Name: "a\u0085b\x1b]0;pwned\x07.txt"}},
+	}
+	got := watchText(event)
+	if want := "message read[2J: hi[31m there2J [file: ab]0;pwned.txt]"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestPrettyPrinter_StripsControlsFromEveryField(t *testing.T) {
+	var out bytes.Buffer
+	p := newPrettyPrinter(&out, false, func() int { return 0 })
+	now := time.Now()
+	p.print(protocol.Event{
+		Kind:      "message",
+		Service:   "slack\x1b",
+		Bot:       "ops\u009d",
+		Channel:   "C1\x1b[2J",
+		User:      "eve\u009b31m\r",
+		Text:      "hello",
+		Timestamp: now,
+	}, now)
+	p.print(protocol.Event{Kind: protocol.KindReplayDone, Text: "replayed\x1b[H 3 events"}, now)
+
+	for _, r := range out.String() {
+		if r != '\n' && (r < 0x20 || r == 0x7f || (r >= 0x80 && r < 0xa0)) {
+			t.Fatalf("control character %U printed in %q", r, out.String())
+		}
+	}
+	if !strings.Contains(out.String(), "slack:ops · C1[2J") || !strings.Contains(out.String(), "eve31m") {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+}
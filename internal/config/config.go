@@ -2,13 +2,28 @@ package config
 
 import (
 	"bytes"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/pantalk/pantalk/internal/agent"
+	"github.com/pantalk/pantalk/internal/autoreply"
+	"github.com/pantalk/pantalk/internal/classify"
+	"github.com/pantalk/pantalk/internal/ntfy"
+	"github.com/pantalk/pantalk/internal/quiet"
+	"github.com/pantalk/pantalk/internal/redact"
+	"github.com/pantalk/pantalk/internal/trace"
+	"github.com/pantalk/pantalk/internal/transcribe"
+	"github.com/pantalk/pantalk/internal/translate"
+	"github.com/pantalk/pantalk/internal/unfurl"
 	"gopkg.in/yaml.v3"
 )
 
@@ -18,31 +33,558 @@ type Config struct {
 	Server ServerConfig  `yaml:"server"`
 	Bots   []BotConfig   `yaml:"bots"`
 	Agents []AgentConfig `yaml:"agents"`
+	Redact []RedactRule  `yaml:"redact"`
+	Ntfy   *NtfyConfig   `yaml:"ntfy"`
+
+	Transcription *TranscriptionConfig `yaml:"transcription"`
+	Classifier    *ClassifierConfig    `yaml:"classifier"`
+	Translation   *TranslationConfig   `yaml:"translation"`
+	Unfurl        *UnfurlConfig        `yaml:"unfurl"`
+	Tracing       *TracingConfig       `yaml:"tracing"`
+
+	// Middleware orders the processors inbound events pass through before
+	// they are stored and published. Empty runs the built-ins in
+	// DefaultMiddleware order.
+	Middleware []MiddlewareConfig `yaml:"middleware"`
+
+	// Lists are named string lists agents can use in when expressions,
+	// e.g. admins for `user in admins`.
+	Lists map[string][]string `yaml:"lists"`
+
+	// BroadcastGroups are named sets of destinations pantalk broadcast
+	// sends one message to.
+	BroadcastGroups map[string][]BroadcastTarget `yaml:"broadcast_groups"`
+
+	ConnectionAlerts *ConnectionAlertsConfig `yaml:"connection_alerts"`
+
+	// QuietHours applies to every bot without its own quiet_hours and
+	// silences the agents' clock.
+	QuietHours *QuietHoursConfig `yaml:"quiet_hours"`
 }
 
 type ServerConfig struct {
 	SocketPath  string `yaml:"socket_path"`
-	HistorySize int    `yaml:"notification_history_size"`
+	HistorySize int    `yaml:"notification_history_size"` // events per bot kept in memory for history reads
 	DBPath      string `yaml:"db_path"`
+
+	// NotifyCooldown collapses repeat notifications for the same
+	// (channel, thread, user) within this many seconds into the first one.
+	// Zero disables collapsing.
+	NotifyCooldown int `yaml:"notify_cooldown"`
+
+	// WatchConfig reloads the daemon automatically when the config file
+	// changes on disk. Read at startup only.
+	WatchConfig bool `yaml:"watch_config"`
+
+	// HTTPAddr serves the HTTP API behind the ntfy action buttons, e.g.
+	// "127.0.0.1:8750". Empty disables it. Read at startup only.
+	HTTPAddr  string `yaml:"http_addr"`
+	HTTPToken string `yaml:"http_token"` // bearer token every HTTP request must carry
+
+	// HTTPURL is the HTTP API's base URL as other machines reach it, used
+	// for ntfy buttons, Mattermost action callbacks and webhooks (default
+	// http://<http_addr>, https:// with a certificate).
+	HTTPURL string `yaml:"http_url"`
+
+	// HTTPTLSCert and HTTPTLSKey are PEM files that make the HTTP API serve
+	// HTTPS, as Slack and Telegram require of webhooks, when no proxy in
+	// front of it terminates TLS. Read at startup only.
+	HTTPTLSCert string `yaml:"http_tls_cert"`
+	HTTPTLSKey  string `yaml:"http_tls_key"`
+
+	// DebugAddr serves pprof, expvar counters and /healthz without
+	// authentication, so it must be a loopback address, e.g.
+	// "127.0.0.1:6060". Empty disables it. Read at startup only.
+	DebugAddr string `yaml:"debug_addr"`
+}
+
+// ConnectionAlertsConfig posts a message through Bot to Channel when another
+// bot's connector stays down, comes back online after a failure, or keeps
+// reconnecting.
+type ConnectionAlertsConfig struct {
+	Bot           string `yaml:"bot"`
+	Channel       string `yaml:"channel"`
+	MaxReconnects int    `yaml:"max_reconnects"` // reconnects per hour before a flapping alert (default 5)
+	DownAfter     int    `yaml:"down_after"`     // seconds of outage before a down alert (default 600)
+}
+
+// BroadcastTarget is one destination of a broadcast group. Service is
+// optional and only checked against the bot's type.
+type BroadcastTarget struct {
+	Service string `yaml:"service"`
+	Bot     string `yaml:"bot"`
+	Channel string `yaml:"channel"`
+	Thread  string `yaml:"thread"`
+}
+
+// NtfyConfig forwards new notifications to an ntfy topic with mark-seen,
+// snooze and open buttons.
+type NtfyConfig struct {
+	Server    string `yaml:"server"` // default https://ntfy.sh
+	Topic     string `yaml:"topic"`
+	Token     string `yaml:"token"`      // ntfy access token (optional)
+	ActionURL string `yaml:"action_url"` // server.http_addr as reachable from the phone (default server.http_url)
+	ThreadURL string `yaml:"thread_url"` // text/template for the open button, e.g. "https://app.slack.com/client/T0123/{{.Channel}}"
+	Snooze    int    `yaml:"snooze"`     // seconds the snooze button hides a notification (default 3600)
+}
+
+// TranscriptionConfig turns inbound voice messages into event text with a
+// local command or a Whisper-compatible HTTP endpoint.
+type TranscriptionConfig struct {
+	// Command receives the audio file path in place of {file}, or as its
+	// last argument, and prints the transcript on stdout.
+	Command agent.Command `yaml:"command"`
+
+	Endpoint string `yaml:"endpoint"` // e.g. https://api.openai.com/v1/audio/transcriptions
+	APIKey   string `yaml:"api_key"`
+	Model    string `yaml:"model"`    // default whisper-1
+	Language string `yaml:"language"` // ISO-639-1 hint (optional)
+
+	Timeout int `yaml:"timeout"` // seconds per recording (default 120)
+}
+
+// ClassifierConfig rates each new notification with a local command or an
+// HTTP endpoint; the priority and labels it returns are stored on the
+// notification and usable in agent when expressions.
+type ClassifierConfig struct {
+	// Command reads the notification as JSON on stdin and prints
+	// {"priority": ..., "labels": [...]} or just the priority.
+	Command agent.Command `yaml:"command"`
+
+	Endpoint string `yaml:"endpoint"` // receives the notification JSON as a POST body
+	APIKey   string `yaml:"api_key"`  // sent as a bearer token (optional)
+
+	Timeout int `yaml:"timeout"` // seconds per notification (default 10)
+}
+
+// UnfurlConfig fetches the title and description of links in inbound
+// messages into the events' links. Only pages on Domains are fetched.
+type UnfurlConfig struct {
+	Domains  []string `yaml:"domains"`   // hosts to fetch from; subdomains included
+	Timeout  int      `yaml:"timeout"`   // seconds per page (default 5)
+	MaxLinks int      `yaml:"max_links"` // links per message (default 3)
+}
+
+// TracingConfig exports the trace of every client request to an
+// OpenTelemetry collector and sets when a request counts as slow.
+type TracingConfig struct {
+	Endpoint    string            `yaml:"endpoint"`     // OTLP/HTTP traces URL, e.g. http://localhost:4318/v1/traces; empty only logs slow requests
+	Headers     map[string]string `yaml:"headers"`      // sent with every export, e.g. an API key
+	ServiceName string            `yaml:"service_name"` // default pantalkd
+	Timeout     int               `yaml:"timeout"`      // seconds per export (default 10)
+
+	// Slow is how many milliseconds a request may take before its spans
+	// are logged (default 5000). -1 never logs them.
+	Slow int `yaml:"slow"`
+}
+
+// TranslationConfig is the translation backend for bots with translate
+// and for sends with --translate.
+type TranslationConfig struct {
+	Provider string `yaml:"provider"` // libretranslate or deepl
+	Endpoint string `yaml:"endpoint"` // API base URL; deepl defaults to the free API
+	APIKey   string `yaml:"api_key"`
+
+	Timeout int `yaml:"timeout"` // seconds per message (default 10)
+}
+
+// TranslateConfig translates a bot's inbound messages into To, or into the
+// language its channel is set to, into the events' translated_text.
+type TranslateConfig struct {
+	To       string            `yaml:"to"`       // ISO-639-1 code, e.g. en
+	Channels map[string]string `yaml:"channels"` // channel ID to language, or "off"
+}
+
+// TranslateOff in TranslateConfig.Channels leaves a channel untranslated.
+const TranslateOff = "off"
+
+var languagePattern = regexp.MustCompile(`^[A-Za-z]{2,3}([-_][A-Za-z]{2,4})?$`)
+
+// Target returns the language messages in channel are translated into, or
+// "" when they aren't.
+func (t *TranslateConfig) Target(channel string) string {
+	if t == nil {
+		return ""
+	}
+	if lang, ok := t.Channels[channel]; ok {
+		if lang == TranslateOff {
+			return ""
+		}
+		return lang
+	}
+	return t.To
 }
 
 type BotConfig struct {
 	Name          string   `yaml:"name"`
 	Type          string   `yaml:"type"`
 	DisplayName   string   `yaml:"display_name"`
+	Aliases       []string `yaml:"aliases"` // extra names that mention the bot as @alias
 	BotToken      string   `yaml:"bot_token"`
 	AppLevelToken string   `yaml:"app_level_token"`
-	Transport     string   `yaml:"transport"`
-	Endpoint      string   `yaml:"endpoint"`
-	Password      string   `yaml:"password"`
-	AuthToken     string   `yaml:"auth_token"`
-	AccountSID    string   `yaml:"account_sid"`
-	PhoneNumber   string   `yaml:"phone_number"`
-	APIKey        string   `yaml:"api_key"`
-	BotEmail      string   `yaml:"bot_email"`
-	AccessToken   string   `yaml:"access_token"`
-	DBPath        string   `yaml:"db_path"`
-	Channels      []string `yaml:"channels"`
+	UserToken     string   `yaml:"user_token"`     // slack: xoxp- token for the calls made as a user (mark read, presence, status)
+	SigningSecret string   `yaml:"signing_secret"` // slack with transport: webhook: verifies the Events API callbacks
+	// Transport is exec for connector plugins, or webhook for slack and
+	// telegram bots that take their events as callbacks on the HTTP API
+	// instead of over Socket Mode or long polling.
+	Transport string `yaml:"transport"`
+	Endpoint  string `yaml:"endpoint"`
+	// Proxy is the http:// or socks5:// URL, or $ENV_VAR holding it, that
+	// the bot's API calls and websocket or IRC connections go through
+	// (default: HTTPS_PROXY, HTTP_PROXY and NO_PROXY from the environment).
+	Proxy       string   `yaml:"proxy"`
+	Password    string   `yaml:"password"`
+	AuthToken   string   `yaml:"auth_token"`
+	AccountSID  string   `yaml:"account_sid"`
+	PhoneNumber string   `yaml:"phone_number"`
+	APIKey      string   `yaml:"api_key"`
+	BotEmail    string   `yaml:"bot_email"`
+	AccessToken string   `yaml:"access_token"`
+	DBPath      string   `yaml:"db_path"`
+	MediaDir    string   `yaml:"media_dir"` // whatsapp: where received media is saved
+	Channels    []string `yaml:"channels"`
+	Intents     []string `yaml:"intents"`   // discord gateway intents, see DiscordIntents
+	Redact      *bool    `yaml:"redact"`    // apply top-level redact rules to this bot (default true)
+	AppHome     bool     `yaml:"app_home"`  // slack: publish the App Home tab and accept its messages as DMs
+	SyncRead    bool     `yaml:"sync_read"` // mattermost, matrix: mark notifications seen when the account reads them elsewhere
+
+	// IncludeSelf publishes messages the bot's account posts through other
+	// clients (its phone, the web app) as outbound events, like the ones
+	// sent through pantalk.
+	IncludeSelf bool `yaml:"include_self"`
+
+	IRC *IRCConfig `yaml:"irc"` // irc: TLS, SASL, NickServ and nick options
+
+	HTTP *HTTPConfig `yaml:"http"` // timeouts, retries and keep-alive of the platform's HTTP API
+
+	Mock *MockConfig `yaml:"mock"` // mock: scenario file and the endpoint that injects inbound messages
+
+	// Command is the connector plugin pantalkd launches for transport: exec.
+	// It speaks the protocol in docs/exec-connectors.md on stdin/stdout.
+	Command agent.Command `yaml:"command"`
+
+	AutoReply []AutoReplyConfig `yaml:"auto_reply"`
+
+	// NotifyOn makes inbound messages matching any rule notifications,
+	// besides mentions, direct messages and threads the bot is in.
+	NotifyOn []NotifyRule `yaml:"notify_on"`
+
+	// IgnoreUsers and IgnorePatterns drop inbound events from these user
+	// IDs, or whose text matches one of these case-insensitive regular
+	// expressions, before they are stored or notify anyone.
+	IgnoreUsers    []string `yaml:"ignore_users"`
+	IgnorePatterns []string `yaml:"ignore_patterns"`
+
+	QuietHours *QuietHoursConfig `yaml:"quiet_hours"` // overrides the top-level quiet_hours
+
+	Digest *DigestConfig `yaml:"digest"`
+
+	Translate *TranslateConfig `yaml:"translate"`
+
+	// ThreadWindow groups messages of platforms without threads (irc,
+	// twilio, whatsapp, imessage, matrix) into synthetic threads: a
+	// message less than this many seconds after the previous one in its
+	// channel continues that thread. Zero disables it.
+	ThreadWindow int `yaml:"thread_window"`
+}
+
+// botField is a field a built-in bot type can't do without.
+type botField struct {
+	name      string // as in the YAML
+	hint      string // appended to the error, e.g. " (Twilio Auth Token)"
+	value     func(BotConfig) string
+	transport fieldTransport
+}
+
+// fieldTransport limits a botField to bots with or without
+// transport: webhook.
+type fieldTransport int
+
+const (
+	anyTransport fieldTransport = iota
+	webhookOnly                 // needed only with transport: webhook
+	noWebhook                   // not needed with transport: webhook
+)
+
+// TransportWebhook is the transport of bots that take their events as
+// callbacks on the HTTP API.
+const TransportWebhook = "webhook"
+
+// applies reports whether the field is required of bot.
+func (f botField) applies(bot BotConfig) bool {
+	switch f.transport {
+	case webhookOnly:
+		return bot.Transport == TransportWebhook
+	case noWebhook:
+		return bot.Transport != TransportWebhook
+	}
+	return true
+}
+
+// botRequirements lists the built-in bot types and the fields each
+// requires, for validation and the JSON schema. Any other type is a custom
+// one that needs a transport.
+var botRequirements = map[string][]botField{
+	"slack": {
+		{name: "bot_token", value: func(b BotConfig) string { return b.BotToken }},
+		{name: "app_level_token", value: func(b BotConfig) string { return b.AppLevelToken }, transport: noWebhook},
+		{name: "signing_secret", hint: " with transport: webhook (Slack app signing secret)", value: func(b BotConfig) string { return b.SigningSecret }, transport: webhookOnly},
+	},
+	"discord": {
+		{name: "bot_token", value: func(b BotConfig) string { return b.BotToken }},
+	},
+	"mattermost": {
+		{name: "endpoint", value: func(b BotConfig) string { return b.Endpoint }},
+		{name: "bot_token", value: func(b BotConfig) string { return b.BotToken }},
+	},
+	"telegram": {
+		{name: "bot_token", value: func(b BotConfig) string { return b.BotToken }},
+	},
+	// Without access_token the matrix connector uses the session stored by
+	// pantalk pair (password or SSO login with token refresh).
+	"matrix": {
+		{name: "endpoint", hint: " (Matrix homeserver URL)", value: func(b BotConfig) string { return b.Endpoint }},
+	},
+	// whatsapp authenticates by QR code pairing at first startup; the
+	// optional endpoint overrides the default whatsmeow database path.
+	"whatsapp": nil,
+	"irc": {
+		{name: "endpoint", hint: " for irc (e.g. irc.libera.chat:6697)", value: func(b BotConfig) string { return b.Endpoint }},
+	},
+	"twilio": {
+		{name: "auth_token", hint: " (Twilio Auth Token)", value: func(b BotConfig) string { return b.AuthToken }},
+		{name: "account_sid", hint: " (Twilio Account SID)", value: func(b BotConfig) string { return b.AccountSID }},
+		{name: "phone_number", hint: " (Twilio phone number)", value: func(b BotConfig) string { return b.PhoneNumber }},
+	},
+	"zulip": {
+		{name: "endpoint", hint: " (Zulip server URL)", value: func(b BotConfig) string { return b.Endpoint }},
+		{name: "api_key", hint: " (Zulip API key)", value: func(b BotConfig) string { return b.APIKey }},
+		{name: "bot_email", hint: " (Zulip bot email)", value: func(b BotConfig) string { return b.BotEmail }},
+	},
+	// imessage reads ~/Library/Messages/chat.db (or db_path) directly and
+	// sends via AppleScript; it needs no credentials.
+	"imessage": nil,
+	// mock talks to no platform; see MockConfig.
+	"mock": nil,
+}
+
+// DigestConfig batches a bot's notification pushes per channel: the first
+// notification in a channel opens a window, and when it closes a single
+// summary goes to ntfy and, optionally, to a chat channel. Notifications
+// are still stored and listed one by one.
+type DigestConfig struct {
+	Window  int    `yaml:"window"`  // seconds to collect a channel's notifications (default 900)
+	Channel string `yaml:"channel"` // also post each summary to this channel (optional)
+}
+
+// DefaultDigestWindow is used when digest.window is unset.
+const DefaultDigestWindow = 15 * time.Minute
+
+// WindowDuration returns the digest window, applying the default.
+func (d DigestConfig) WindowDuration() time.Duration {
+	if d.Window <= 0 {
+		return DefaultDigestWindow
+	}
+	return time.Duration(d.Window) * time.Second
+}
+
+// QuietHoursConfig is a daily window, e.g. 22:00 to 07:00, in which
+// inbound events are stored but don't notify or trigger agents.
+type QuietHoursConfig struct {
+	Start    string `yaml:"start"`    // HH:MM
+	End      string `yaml:"end"`      // HH:MM; earlier than start wraps past midnight
+	Timezone string `yaml:"timezone"` // IANA name (default local time)
+	Defer    bool   `yaml:"defer"`    // hold notifications until the window ends instead of dropping them
+}
+
+// Hours compiles the window; a nil config has no quiet hours.
+func (q *QuietHoursConfig) Hours() (*quiet.Hours, error) {
+	if q == nil {
+		return nil, nil
+	}
+	return quiet.New(quiet.Window{Start: q.Start, End: q.End, Timezone: q.Timezone, Defer: q.Defer})
+}
+
+// HTTPBaseURL is the HTTP API's base URL as other machines reach it:
+// server.http_url, or the http_addr with http:// or, when the API serves
+// TLS itself, https://. It is empty without the HTTP API.
+func (c Config) HTTPBaseURL() string {
+	addr := strings.TrimSpace(c.Server.HTTPAddr)
+	if addr == "" {
+		return ""
+	}
+	if base := strings.TrimRight(strings.TrimSpace(c.Server.HTTPURL), "/"); base != "" {
+		return base
+	}
+	if c.Server.HTTPTLSCert != "" {
+		return "https://" + addr
+	}
+	return "http://" + addr
+}
+
+// WebhookURL is where the platform of a transport: webhook bot delivers
+// its events, or "" without the HTTP API.
+func (c Config) WebhookURL(bot BotConfig) string {
+	base := c.HTTPBaseURL()
+	if base == "" {
+		return ""
+	}
+	return base + "/v1/webhooks/" + url.PathEscape(bot.Type) + "/" + url.PathEscape(bot.Name)
+}
+
+// QuietHoursFor returns the quiet hours that apply to bot: its own, or the
+// top-level ones.
+func (c Config) QuietHoursFor(bot BotConfig) *QuietHoursConfig {
+	if bot.QuietHours != nil {
+		return bot.QuietHours
+	}
+	return c.QuietHours
+}
+
+// NotifyRule is a notify_on entry: a regular expression, matched
+// case-insensitively anywhere in the message text, optionally restricted
+// to one channel. A plain string is a rule for every channel:
+//
+//	notify_on:
+//	  - deploy
+//	  - {match: 'incident-\d+', channel: C0OPS}
+type NotifyRule struct {
+	Match   string `yaml:"match"`
+	Channel string `yaml:"channel"`
+}
+
+// UnmarshalYAML accepts a rule as a plain pattern or a match/channel
+// mapping.
+func (r *NotifyRule) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.ScalarNode:
+		r.Match = value.Value
+		return nil
+	case yaml.MappingNode:
+		for i := 0; i < len(value.Content); i += 2 {
+			switch key := value.Content[i].Value; key {
+			case "match", "channel":
+			default:
+				return fmt.Errorf("line %d: field %s not found in notify_on entry", value.Content[i].Line, key)
+			}
+		}
+		type plain NotifyRule
+		return value.Decode((*plain)(r))
+	default:
+		return errors.New("notify_on entry must be a pattern or a match/channel mapping")
+	}
+}
+
+// Pattern compiles the rule's case-insensitive regular expression.
+func (r NotifyRule) Pattern() (*regexp.Regexp, error) {
+	return regexp.Compile("(?i)" + r.Match)
+}
+
+// IgnoreRegexps compiles the bot's ignore_patterns.
+func (b BotConfig) IgnoreRegexps() ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, 0, len(b.IgnorePatterns))
+	for _, p := range b.IgnorePatterns {
+		if strings.TrimSpace(p) == "" {
+			return nil, errors.New("ignore_patterns entry cannot be empty")
+		}
+		pattern, err := regexp.Compile("(?i)" + p)
+		if err != nil {
+			return nil, fmt.Errorf("ignore_patterns %q: %w", p, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// AutoReplyConfig is a canned reply the daemon sends itself, without an
+// agent, when an inbound message matches When.
+type AutoReplyConfig struct {
+	Name     string `yaml:"name"`
+	Channel  string `yaml:"channel"`  // restrict to one channel (optional)
+	When     string `yaml:"when"`     // expr expression; default matches every inbound message
+	Reply    string `yaml:"reply"`    // Go text/template, e.g. "Hi {{.User}}, ..."
+	Cooldown int    `yaml:"cooldown"` // seconds before the same user gets this reply again (default 3600)
+}
+
+// AutoReplyRules converts the bot's auto_reply entries to their runtime form.
+func (b BotConfig) AutoReplyRules() []autoreply.Rule {
+	rules := make([]autoreply.Rule, 0, len(b.AutoReply))
+	for _, r := range b.AutoReply {
+		rules = append(rules, autoreply.Rule{
+			Name:     r.Name,
+			Channel:  r.Channel,
+			When:     r.When,
+			Reply:    r.Reply,
+			Cooldown: time.Duration(r.Cooldown) * time.Second,
+		})
+	}
+	return rules
+}
+
+// RedactEnabled reports whether the global redact rules apply to this bot.
+func (b BotConfig) RedactEnabled() bool {
+	return b.Redact == nil || *b.Redact
+}
+
+// RedactRule is a named regex whose matches are scrubbed from event text
+// before it is stored or published. Pattern may be omitted for builtin names
+// (api_key, credit_card, email).
+type RedactRule struct {
+	Name        string `yaml:"name"`
+	Pattern     string `yaml:"pattern"`
+	Replacement string `yaml:"replacement"` // default "[REDACTED:<name>]"
+}
+
+// Built-in middleware, configured by their own sections.
+const (
+	MiddlewareRedact    = "redact"
+	MiddlewareTranslate = "translate"
+	MiddlewareUnfurl    = "unfurl"
+	MiddlewareClassify  = "classify"
+)
+
+// DefaultMiddleware is the order of the built-in middleware when the config
+// doesn't set one.
+var DefaultMiddleware = []string{MiddlewareRedact, MiddlewareTranslate, MiddlewareUnfurl, MiddlewareClassify}
+
+// MiddlewareConfig is one step of the middleware chain: a built-in by name,
+// or a command that gets the event as JSON on stdin and prints the fields
+// to change, or {"drop": true}.
+type MiddlewareConfig struct {
+	Name    string        `yaml:"name"`
+	Command agent.Command `yaml:"command"`
+	Timeout int           `yaml:"timeout"` // seconds per event (default 10)
+}
+
+// MiddlewareChain returns the middleware to run, in order. Redaction can be
+// moved but not left out: when the config doesn't list it, it runs first.
+func (c Config) MiddlewareChain() []MiddlewareConfig {
+	if len(c.Middleware) == 0 {
+		chain := make([]MiddlewareConfig, 0, len(DefaultMiddleware))
+		for _, name := range DefaultMiddleware {
+			chain = append(chain, MiddlewareConfig{Name: name})
+		}
+		return chain
+	}
+	for _, m := range c.Middleware {
+		if m.Name == MiddlewareRedact {
+			return c.Middleware
+		}
+	}
+	return append([]MiddlewareConfig{{Name: MiddlewareRedact}}, c.Middleware...)
+}
+
+// RedactRules converts the config rules to their runtime form.
+func (c Config) RedactRules() []redact.Rule {
+	rules := make([]redact.Rule, 0, len(c.Redact))
+	for _, r := range c.Redact {
+		rules = append(rules, redact.Rule{
+			Name:        r.Name,
+			Pattern:     r.Pattern,
+			Replacement: r.Replacement,
+		})
+	}
+	return rules
 }
 
 // AgentConfig describes a preconfigured command that pantalkd can launch when
@@ -56,6 +598,34 @@ type AgentConfig struct {
 	Buffer   int           `yaml:"buffer"`   // seconds to batch events before launching (default 30)
 	Timeout  int           `yaml:"timeout"`  // max runtime in seconds (default 120)
 	Cooldown int           `yaml:"cooldown"` // min seconds between consecutive runs (default 60)
+
+	EventsFile bool   `yaml:"events_file"` // pass the triggering events as a JSON file in $PANTALK_EVENTS_FILE
+	Stdin      string `yaml:"stdin"`       // "events" pipes the triggering events to stdin as JSON lines
+	Context    int    `yaml:"context"`     // earlier messages of the conversation to put ahead of the events
+
+	Reply         bool   `yaml:"reply"`          // post stdout back to the triggering conversation
+	ReplyTemplate string `yaml:"reply_template"` // text/template for the reply (default "{{.Output}}")
+	ThreadReplies bool   `yaml:"thread_replies"` // post the reply in a thread on the triggering message where the service has threads
+
+	MarkRead bool `yaml:"mark_read"` // mark the triggering conversations read upstream after a successful run
+
+	IncludeSelf bool `yaml:"include_self"` // also trigger on the bot's own messages
+}
+
+// ParseProxy parses a proxy URL: http://[user:password@]host:port or
+// socks5://[user:password@]host:port.
+func ParseProxy(raw string) (*url.URL, error) {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "socks5" {
+		return nil, fmt.Errorf("invalid proxy %q: must be an http:// or socks5:// URL", parsed.Redacted())
+	}
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: missing host", parsed.Redacted())
+	}
+	return parsed, nil
 }
 
 func ResolveCredential(value string) (string, error) {
@@ -89,8 +659,39 @@ func Load(path string) (Config, error) {
 }
 
 // LoadWithOptions loads and validates the config. When allowExec is false,
-// agent commands are restricted to the known allowlist.
+// every command the daemon runs is restricted to the known allowlist.
 func LoadWithOptions(path string, allowExec bool) (Config, error) {
+	cfg, err := decodeFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if err := mergeFragments(&cfg, path); err != nil {
+		return Config{}, err
+	}
+
+	applyDefaults(&cfg)
+	if err := validate(cfg, allowExec); err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+// LoadMain reads only the file at path, without config.d fragments or
+// validation, and applies defaults. Commands that rewrite the main file use
+// it so fragment bots are never copied into it.
+func LoadMain(path string) (Config, error) {
+	cfg, err := decodeFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	applyDefaults(&cfg)
+	return cfg, nil
+}
+
+func decodeFile(path string) (Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return Config{}, fmt.Errorf("read config: %w", err)
@@ -103,11 +704,6 @@ func LoadWithOptions(path string, allowExec bool) (Config, error) {
 		return Config{}, fmt.Errorf("parse yaml: %w", err)
 	}
 
-	applyDefaults(&cfg)
-	if err := validate(cfg, allowExec); err != nil {
-		return Config{}, err
-	}
-
 	return cfg, nil
 }
 
@@ -130,6 +726,117 @@ func validate(cfg Config, allowExec bool) error {
 		return errors.New("config must include at least one bot")
 	}
 
+	if cfg.Server.NotifyCooldown < 0 {
+		return errors.New("server.notify_cooldown cannot be negative")
+	}
+
+	if strings.TrimSpace(cfg.Server.HTTPAddr) != "" && strings.TrimSpace(cfg.Server.HTTPToken) == "" {
+		return errors.New("server.http_addr requires server.http_token")
+	}
+	if strings.TrimSpace(cfg.Server.HTTPURL) != "" && strings.TrimSpace(cfg.Server.HTTPAddr) == "" {
+		return errors.New("server.http_url requires server.http_addr")
+	}
+	if addr := strings.TrimSpace(cfg.Server.DebugAddr); addr != "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return fmt.Errorf("invalid server.debug_addr %q: %w", addr, err)
+		}
+		// pprof and expvar ask for no token, so keep them off the network.
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return fmt.Errorf("server.debug_addr %q must be on loopback (localhost, 127.0.0.1 or [::1]): the debug listener has no authentication", addr)
+		}
+	}
+	if (cfg.Server.HTTPTLSCert == "") != (cfg.Server.HTTPTLSKey == "") {
+		return errors.New("server.http_tls_cert and server.http_tls_key must be set together")
+	}
+	if cfg.Server.HTTPTLSCert != "" {
+		if strings.TrimSpace(cfg.Server.HTTPAddr) == "" {
+			return errors.New("server.http_tls_cert requires server.http_addr")
+		}
+		if _, err := tls.LoadX509KeyPair(cfg.Server.HTTPTLSCert, cfg.Server.HTTPTLSKey); err != nil {
+			return fmt.Errorf("server.http_tls_cert: %w", err)
+		}
+	}
+
+	if _, err := cfg.QuietHours.Hours(); err != nil {
+		return fmt.Errorf("quiet_hours: %w", err)
+	}
+
+	if cfg.Ntfy != nil {
+		if strings.TrimSpace(cfg.Ntfy.ActionURL) != "" && strings.TrimSpace(cfg.Server.HTTPAddr) == "" {
+			return errors.New("ntfy.action_url requires server.http_addr")
+		}
+		if _, err := ntfy.New(ntfy.Config{
+			Server:    cfg.Ntfy.Server,
+			Topic:     cfg.Ntfy.Topic,
+			ThreadURL: cfg.Ntfy.ThreadURL,
+			Snooze:    time.Duration(cfg.Ntfy.Snooze) * time.Second,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Transcription != nil {
+		if _, err := transcribe.New(transcribe.Config{
+			Command:  cfg.Transcription.Command,
+			Endpoint: cfg.Transcription.Endpoint,
+			Timeout:  time.Duration(cfg.Transcription.Timeout) * time.Second,
+		}); err != nil {
+			return err
+		}
+		if err := checkExec("transcription", cfg.Transcription.Command, allowExec); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Classifier != nil {
+		if _, err := classify.New(classify.Config{
+			Command:  cfg.Classifier.Command,
+			Endpoint: cfg.Classifier.Endpoint,
+			Timeout:  time.Duration(cfg.Classifier.Timeout) * time.Second,
+		}); err != nil {
+			return err
+		}
+		if err := checkExec("classifier", cfg.Classifier.Command, allowExec); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Translation != nil {
+		if _, err := translate.New(translate.Config{
+			Provider: cfg.Translation.Provider,
+			Endpoint: cfg.Translation.Endpoint,
+			APIKey:   cfg.Translation.APIKey,
+			Timeout:  time.Duration(cfg.Translation.Timeout) * time.Second,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Unfurl != nil {
+		if _, err := unfurl.New(unfurl.Config{
+			Domains:  cfg.Unfurl.Domains,
+			Timeout:  time.Duration(cfg.Unfurl.Timeout) * time.Second,
+			MaxLinks: cfg.Unfurl.MaxLinks,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Tracing != nil {
+		if cfg.Tracing.Slow < -1 {
+			return errors.New("tracing.slow must be >= -1")
+		}
+		if strings.TrimSpace(cfg.Tracing.Endpoint) != "" {
+			if _, err := trace.NewExporter(trace.ExporterConfig{
+				Endpoint: cfg.Tracing.Endpoint,
+				Timeout:  time.Duration(cfg.Tracing.Timeout) * time.Second,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
 	seenBots := map[string]struct{}{}
 	for _, bot := range cfg.Bots {
 		if bot.Name == "" {
@@ -145,75 +852,238 @@ func validate(cfg Config, allowExec bool) error {
 		}
 		seenBots[bot.Name] = struct{}{}
 
-		switch bot.Type {
-		case "slack":
-			if strings.TrimSpace(bot.BotToken) == "" {
-				return fmt.Errorf("bot %q requires bot_token", bot.Name)
+		for _, alias := range bot.Aliases {
+			if strings.TrimLeft(strings.TrimSpace(alias), "@") == "" {
+				return fmt.Errorf("bot %q has an empty alias", bot.Name)
+			}
+		}
+
+		for _, field := range botRequirements[bot.Type] {
+			if field.applies(bot) && strings.TrimSpace(field.value(bot)) == "" {
+				return fmt.Errorf("bot %q requires %s%s", bot.Name, field.name, field.hint)
+			}
+		}
+
+		if bot.Transport == TransportWebhook {
+			if bot.Type != "slack" && bot.Type != "telegram" {
+				return fmt.Errorf("bot %q: transport: webhook is only supported for slack and telegram bots", bot.Name)
 			}
-			if strings.TrimSpace(bot.AppLevelToken) == "" {
-				return fmt.Errorf("bot %q requires app_level_token", bot.Name)
+			if strings.TrimSpace(cfg.Server.HTTPAddr) == "" {
+				return fmt.Errorf("bot %q: transport: webhook requires server.http_addr", bot.Name)
 			}
+		}
+
+		switch bot.Type {
 		case "discord":
-			if strings.TrimSpace(bot.BotToken) == "" {
-				return fmt.Errorf("bot %q requires bot_token", bot.Name)
+			if err := validateDiscordIntents(bot); err != nil {
+				return err
 			}
-		case "mattermost":
-			if strings.TrimSpace(bot.Endpoint) == "" {
-				return fmt.Errorf("bot %q requires endpoint", bot.Name)
+		case "irc":
+			if err := validateIRC(bot); err != nil {
+				return err
 			}
-			if strings.TrimSpace(bot.BotToken) == "" {
-				return fmt.Errorf("bot %q requires bot_token", bot.Name)
+		case "mock":
+			if err := validateMock(bot); err != nil {
+				return err
 			}
-		case "telegram":
-			if strings.TrimSpace(bot.BotToken) == "" {
-				return fmt.Errorf("bot %q requires bot_token", bot.Name)
+		default:
+			if _, builtin := botRequirements[bot.Type]; builtin {
+				break
 			}
-		case "matrix":
-			if strings.TrimSpace(bot.Endpoint) == "" {
-				return fmt.Errorf("bot %q requires endpoint (Matrix homeserver URL)", bot.Name)
+			switch strings.TrimSpace(bot.Transport) {
+			case "":
+				return fmt.Errorf("bot %q transport cannot be empty for custom type %q", bot.Name, bot.Type)
+			case "exec":
+				if len(bot.Command) == 0 {
+					return fmt.Errorf("bot %q command cannot be empty for exec transport", bot.Name)
+				}
+				if err := checkExec(fmt.Sprintf("bot %q", bot.Name), bot.Command, allowExec); err != nil {
+					return err
+				}
+			default:
+				if strings.TrimSpace(bot.Endpoint) == "" {
+					return fmt.Errorf("bot %q endpoint cannot be empty for custom type %q", bot.Name, bot.Type)
+				}
 			}
-			if strings.TrimSpace(bot.AccessToken) == "" {
-				return fmt.Errorf("bot %q requires access_token (Matrix access token)", bot.Name)
+		}
+
+		if len(bot.Command) > 0 && bot.Transport != "exec" {
+			return fmt.Errorf("bot %q: command is only used with transport: exec", bot.Name)
+		}
+
+		if len(bot.Intents) > 0 && bot.Type != "discord" {
+			return fmt.Errorf("bot %q: intents are only supported for discord bots", bot.Name)
+		}
+		if bot.IRC != nil && bot.Type != "irc" {
+			return fmt.Errorf("bot %q: irc options are only supported for irc bots", bot.Name)
+		}
+		if bot.Mock != nil && bot.Type != "mock" {
+			return fmt.Errorf("bot %q: mock options are only supported for mock bots", bot.Name)
+		}
+		if bot.SigningSecret != "" && bot.Type != "slack" {
+			return fmt.Errorf("bot %q: signing_secret is only supported for slack bots", bot.Name)
+		}
+		if bot.UserToken != "" && bot.Type != "slack" {
+			return fmt.Errorf("bot %q: user_token is only supported for slack bots", bot.Name)
+		}
+		if err := validateHTTP(bot); err != nil {
+			return err
+		}
+		if proxy := strings.TrimSpace(bot.Proxy); proxy != "" {
+			switch bot.Type {
+			case "imessage", "mock":
+				return fmt.Errorf("bot %q: proxy is not supported for %s bots", bot.Name, bot.Type)
 			}
-		case "whatsapp":
-			// No credentials required - authentication is handled via QR code
-			// pairing at first startup. The optional endpoint field overrides
-			// the default whatsmeow database path.
-		case "irc":
-			if strings.TrimSpace(bot.Endpoint) == "" {
-				return fmt.Errorf("bot %q requires endpoint for irc (e.g. irc.libera.chat:6697)", bot.Name)
+			if _, builtin := botRequirements[bot.Type]; !builtin {
+				return fmt.Errorf("bot %q: proxy is not supported for custom type %q", bot.Name, bot.Type)
 			}
-		case "twilio":
-			if strings.TrimSpace(bot.AuthToken) == "" {
-				return fmt.Errorf("bot %q requires auth_token (Twilio Auth Token)", bot.Name)
+			// $ENV_VAR references are checked when the connector starts.
+			if !strings.HasPrefix(proxy, "$") {
+				if _, err := ParseProxy(proxy); err != nil {
+					return fmt.Errorf("bot %q: %w", bot.Name, err)
+				}
 			}
-			if strings.TrimSpace(bot.AccountSID) == "" {
-				return fmt.Errorf("bot %q requires account_sid (Twilio Account SID)", bot.Name)
+		}
+		if bot.AppHome && bot.Type != "slack" {
+			return fmt.Errorf("bot %q: app_home is only supported for slack bots", bot.Name)
+		}
+		if bot.SyncRead && bot.Type != "mattermost" && bot.Type != "matrix" {
+			return fmt.Errorf("bot %q: sync_read is only supported for mattermost and matrix bots", bot.Name)
+		}
+		if bot.IncludeSelf {
+			switch bot.Type {
+			case "slack", "discord", "mattermost", "telegram", "whatsapp", "zulip", "matrix":
+			default:
+				return fmt.Errorf("bot %q: include_self is not supported for %s bots", bot.Name, bot.Type)
 			}
-			if strings.TrimSpace(bot.PhoneNumber) == "" {
-				return fmt.Errorf("bot %q requires phone_number (Twilio phone number)", bot.Name)
+		}
+
+		if _, err := autoreply.New(bot.AutoReplyRules()); err != nil {
+			return fmt.Errorf("bot %q: %w", bot.Name, err)
+		}
+		if _, err := bot.QuietHours.Hours(); err != nil {
+			return fmt.Errorf("bot %q: quiet_hours: %w", bot.Name, err)
+		}
+		if d := bot.Digest; d != nil {
+			if d.Window < 0 {
+				return fmt.Errorf("bot %q: digest.window must be >= 0", bot.Name)
 			}
-		case "zulip":
-			if strings.TrimSpace(bot.Endpoint) == "" {
-				return fmt.Errorf("bot %q requires endpoint (Zulip server URL)", bot.Name)
+			if cfg.Ntfy == nil && strings.TrimSpace(d.Channel) == "" {
+				return fmt.Errorf("bot %q: digest needs ntfy or a digest.channel to deliver to", bot.Name)
 			}
-			if strings.TrimSpace(bot.APIKey) == "" {
-				return fmt.Errorf("bot %q requires api_key (Zulip API key)", bot.Name)
+		}
+		if t := bot.Translate; t != nil {
+			if cfg.Translation == nil {
+				return fmt.Errorf("bot %q: translate needs a top-level translation backend", bot.Name)
 			}
-			if strings.TrimSpace(bot.BotEmail) == "" {
-				return fmt.Errorf("bot %q requires bot_email (Zulip bot email)", bot.Name)
+			if t.To != "" && !languagePattern.MatchString(t.To) {
+				return fmt.Errorf("bot %q: translate.to %q is not a language code such as en", bot.Name, t.To)
 			}
-		case "imessage":
-			// Native macOS integration - no credentials required. The
-			// connector reads ~/Library/Messages/chat.db directly and
-			// sends via AppleScript. db_path is optional (defaults to
-			// ~/Library/Messages/chat.db).
-		default:
-			if strings.TrimSpace(bot.Transport) == "" {
-				return fmt.Errorf("bot %q transport cannot be empty for custom type %q", bot.Name, bot.Type)
+			for channel, lang := range t.Channels {
+				if lang != TranslateOff && !languagePattern.MatchString(lang) {
+					return fmt.Errorf("bot %q: translate.channels.%s %q is not a language code such as en, or off", bot.Name, channel, lang)
+				}
 			}
-			if strings.TrimSpace(bot.Endpoint) == "" {
-				return fmt.Errorf("bot %q endpoint cannot be empty for custom type %q", bot.Name, bot.Type)
+		}
+		if bot.ThreadWindow < 0 {
+			return fmt.Errorf("bot %q: thread_window cannot be negative", bot.Name)
+		}
+		if bot.ThreadWindow > 0 {
+			switch bot.Type {
+			case "slack", "discord", "mattermost", "telegram", "zulip":
+				return fmt.Errorf("bot %q: thread_window is for platforms without threads, and %s has its own", bot.Name, bot.Type)
+			}
+		}
+		for _, rule := range bot.NotifyOn {
+			if strings.TrimSpace(rule.Match) == "" {
+				return fmt.Errorf("bot %q: notify_on entry needs a pattern", bot.Name)
+			}
+			if _, err := rule.Pattern(); err != nil {
+				return fmt.Errorf("bot %q: notify_on %q: %w", bot.Name, rule.Match, err)
+			}
+		}
+		for _, user := range bot.IgnoreUsers {
+			if strings.TrimSpace(user) == "" {
+				return fmt.Errorf("bot %q: ignore_users entry cannot be empty", bot.Name)
+			}
+		}
+		if _, err := bot.IgnoreRegexps(); err != nil {
+			return fmt.Errorf("bot %q: %w", bot.Name, err)
+		}
+	}
+
+	if _, err := redact.New(cfg.RedactRules()); err != nil {
+		return err
+	}
+
+	seenMiddleware := make(map[string]bool, len(cfg.Middleware))
+	for _, m := range cfg.Middleware {
+		name := m.Name
+		if strings.TrimSpace(name) == "" {
+			return errors.New("middleware name cannot be empty")
+		}
+		if seenMiddleware[name] {
+			return fmt.Errorf("duplicate middleware %q", name)
+		}
+		seenMiddleware[name] = true
+
+		builtin := slices.Contains(DefaultMiddleware, name)
+		if builtin && len(m.Command) > 0 {
+			return fmt.Errorf("middleware %q is built in and takes no command", name)
+		}
+		if !builtin && len(m.Command) == 0 {
+			return fmt.Errorf("middleware %q requires a command (built-ins: %s)", name, strings.Join(DefaultMiddleware, ", "))
+		}
+		if m.Timeout < 0 {
+			return fmt.Errorf("middleware %q: timeout cannot be negative", name)
+		}
+		if err := checkExec(fmt.Sprintf("middleware %q", name), m.Command, allowExec); err != nil {
+			return err
+		}
+	}
+
+	if ac := cfg.ConnectionAlerts; ac != nil {
+		if strings.TrimSpace(ac.Bot) == "" || strings.TrimSpace(ac.Channel) == "" {
+			return errors.New("connection_alerts requires bot and channel")
+		}
+		if _, ok := seenBots[ac.Bot]; !ok {
+			return fmt.Errorf("connection_alerts: unknown bot %q", ac.Bot)
+		}
+		if ac.MaxReconnects < 0 {
+			return errors.New("connection_alerts.max_reconnects cannot be negative")
+		}
+		if ac.DownAfter < 0 {
+			return errors.New("connection_alerts.down_after cannot be negative")
+		}
+	}
+
+	for name := range cfg.Lists {
+		if err := agent.ValidateListName(name); err != nil {
+			return fmt.Errorf("lists: %w", err)
+		}
+	}
+
+	botTypes := make(map[string]string, len(cfg.Bots))
+	for _, bot := range cfg.Bots {
+		botTypes[bot.Name] = bot.Type
+	}
+	for name, targets := range cfg.BroadcastGroups {
+		if strings.TrimSpace(name) == "" {
+			return errors.New("broadcast group name cannot be empty")
+		}
+		if len(targets) == 0 {
+			return fmt.Errorf("broadcast group %q has no targets", name)
+		}
+		for i, target := range targets {
+			botType, ok := botTypes[target.Bot]
+			if !ok {
+				return fmt.Errorf("broadcast group %q target %d: unknown bot %q", name, i+1, target.Bot)
+			}
+			if target.Service != "" && target.Service != botType {
+				return fmt.Errorf("broadcast group %q target %d: bot %q is a %s bot, not %s", name, i+1, target.Bot, botType, target.Service)
+			}
+			if strings.TrimSpace(target.Channel) == "" && strings.TrimSpace(target.Thread) == "" {
+				return fmt.Errorf("broadcast group %q target %d requires channel or thread", name, i+1)
 			}
 		}
 	}
@@ -233,12 +1103,44 @@ func validate(cfg Config, allowExec bool) error {
 			return fmt.Errorf("agent %q requires command", a.Name)
 		}
 
-		// Restrict command binaries to the known allowlist unless --allow-exec.
-		binary := filepath.Base(a.Command[0])
-		if !allowExec && !agent.AllowedCommands[binary] {
-			return fmt.Errorf("agent %q: command %q is not in the allowed list (claude, codex, copilot, aider, goose, opencode, gemini); start pantalkd with --allow-exec to permit arbitrary commands", a.Name, a.Command[0])
+		if a.Stdin != "" && a.Stdin != agent.StdinEvents {
+			return fmt.Errorf("agent %q: stdin must be %q or omitted", a.Name, agent.StdinEvents)
+		}
+
+		if a.Context < 0 || a.Context > agent.MaxContext {
+			return fmt.Errorf("agent %q: context must be between 0 and %d", a.Name, agent.MaxContext)
+		}
+		if a.Context > 0 && a.Stdin != agent.StdinEvents && !a.EventsFile {
+			return fmt.Errorf("agent %q: context requires stdin: events or events_file: true", a.Name)
+		}
+
+		if strings.TrimSpace(a.ReplyTemplate) != "" && !a.Reply {
+			return fmt.Errorf("agent %q: reply_template requires reply: true", a.Name)
+		}
+		if a.ThreadReplies && !a.Reply {
+			return fmt.Errorf("agent %q: thread_replies requires reply: true", a.Name)
+		}
+		if a.IncludeSelf && a.Reply {
+			return fmt.Errorf("agent %q: include_self cannot be combined with reply: true, the agent would answer its own replies", a.Name)
+		}
+
+		if err := checkExec(fmt.Sprintf("agent %q", a.Name), a.Command, allowExec); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
+
+// checkExec restricts the binary of a command the daemon runs - for an
+// agent, a connector plugin, transcription, the classifier or middleware -
+// to the known allowlist unless --allow-exec.
+func checkExec(owner string, command agent.Command, allowExec bool) error {
+	if allowExec || len(command) == 0 {
+		return nil
+	}
+	if binary := filepath.Base(command[0]); !agent.AllowedCommands[binary] {
+		return fmt.Errorf("%s: command %q is not in the allowed list (claude, codex, copilot, aider, goose, opencode, gemini); start pantalkd with --allow-exec to permit arbitrary commands", owner, command[0])
+	}
+	return nil
+}
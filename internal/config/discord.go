@@ -0,0 +1,58 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiscordIntents are the gateway intent groups a discord bot can request
+// with intents:. message_content and guild_members are privileged and must
+// also be enabled for the application in the Discord developer portal.
+var DiscordIntents = []string{"guild_messages", "direct_messages", "message_content", "guild_members", "reactions"}
+
+// DefaultDiscordIntents are requested when a discord bot has no intents.
+var DefaultDiscordIntents = []string{"guild_messages", "direct_messages", "message_content"}
+
+// DiscordIntentNames returns the intents the bot requests.
+func (b BotConfig) DiscordIntentNames() []string {
+	if len(b.Intents) == 0 {
+		return DefaultDiscordIntents
+	}
+	return b.Intents
+}
+
+// validateDiscordIntents checks the requested intents against what the bot
+// needs to work: some way to receive messages, and guild messages when it
+// listens to specific channels.
+func validateDiscordIntents(bot BotConfig) error {
+	if len(bot.Intents) == 0 {
+		return nil
+	}
+
+	requested := make(map[string]bool, len(bot.Intents))
+	for _, intent := range bot.Intents {
+		name := strings.TrimSpace(intent)
+		if !containsName(DiscordIntents, name) {
+			return fmt.Errorf("bot %q: unknown discord intent %q (valid: %s)", bot.Name, intent, strings.Join(DiscordIntents, ", "))
+		}
+		requested[name] = true
+	}
+
+	if !requested["guild_messages"] && !requested["direct_messages"] {
+		return fmt.Errorf("bot %q: intents must include guild_messages or direct_messages to receive messages", bot.Name)
+	}
+	if len(bot.Channels) > 0 && !requested["guild_messages"] {
+		return fmt.Errorf("bot %q: channels requires the guild_messages intent", bot.Name)
+	}
+
+	return nil
+}
+
+func containsName(names []string, want string) bool {
+	for _, name := range names {
+		if name == want {
+			return true
+		}
+	}
+	return false
+}
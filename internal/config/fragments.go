@@ -0,0 +1,166 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FragmentDirName is the directory, next to the main config file, whose YAML
+// fragments are merged into it at load time. Each team can own a fragment
+// with its bots and agents.
+const FragmentDirName = "config.d"
+
+// FragmentDir returns the fragment directory for the config at path.
+func FragmentDir(path string) string {
+	return filepath.Join(filepath.Dir(path), FragmentDirName)
+}
+
+// Fragments lists the fragment files for the config at path in merge order
+// (lexical, so "10-ops.yaml" comes before "20-eng.yaml"). A missing
+// directory is not an error.
+func Fragments(path string) ([]string, error) {
+	dir := FragmentDir(path)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", dir, err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if ext := filepath.Ext(name); ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// mergeFragments appends the bots, agents, redact rules and lists from
+// every fragment to cfg. Names must be unique across the main file and all
+// fragments; a collision names both files. Fragments cannot set server,
+// ntfy or connection_alerts options, which stay in the main file.
+func mergeFragments(cfg *Config, path string) error {
+	files, err := Fragments(path)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	main := filepath.Base(path)
+	bots := make(map[string]string)
+	agents := make(map[string]string)
+	rules := make(map[string]string)
+	lists := make(map[string]string)
+	groups := make(map[string]string)
+	for _, bot := range cfg.Bots {
+		bots[bot.Name] = main
+	}
+	for _, a := range cfg.Agents {
+		agents[a.Name] = main
+	}
+	for _, r := range cfg.Redact {
+		rules[r.Name] = main
+	}
+	for name := range cfg.Lists {
+		lists[name] = main
+	}
+	for name := range cfg.BroadcastGroups {
+		groups[name] = main
+	}
+
+	for _, file := range files {
+		label := filepath.Join(FragmentDirName, filepath.Base(file))
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", label, err)
+		}
+
+		var frag Config
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&frag); err != nil {
+			if errors.Is(err, io.EOF) {
+				continue
+			}
+			return fmt.Errorf("parse %s: %w", label, err)
+		}
+
+		if frag.Server != (ServerConfig{}) {
+			return fmt.Errorf("%s: server settings are only allowed in %s", label, main)
+		}
+		if frag.Ntfy != nil {
+			return fmt.Errorf("%s: ntfy settings are only allowed in %s", label, main)
+		}
+		if frag.ConnectionAlerts != nil {
+			return fmt.Errorf("%s: connection_alerts is only allowed in %s", label, main)
+		}
+		if frag.QuietHours != nil {
+			return fmt.Errorf("%s: quiet_hours is only allowed in %s", label, main)
+		}
+
+		for _, bot := range frag.Bots {
+			if owner, ok := bots[bot.Name]; ok {
+				return fmt.Errorf("duplicate bot name %q: defined in %s and %s", bot.Name, owner, label)
+			}
+			bots[bot.Name] = label
+		}
+		for _, a := range frag.Agents {
+			if owner, ok := agents[a.Name]; ok {
+				return fmt.Errorf("duplicate agent name %q: defined in %s and %s", a.Name, owner, label)
+			}
+			agents[a.Name] = label
+		}
+		for _, r := range frag.Redact {
+			if owner, ok := rules[r.Name]; ok {
+				return fmt.Errorf("duplicate redact rule %q: defined in %s and %s", r.Name, owner, label)
+			}
+			rules[r.Name] = label
+		}
+		for name, values := range frag.Lists {
+			if owner, ok := lists[name]; ok {
+				return fmt.Errorf("duplicate list %q: defined in %s and %s", name, owner, label)
+			}
+			lists[name] = label
+			if cfg.Lists == nil {
+				cfg.Lists = make(map[string][]string)
+			}
+			cfg.Lists[name] = values
+		}
+		for name, targets := range frag.BroadcastGroups {
+			if owner, ok := groups[name]; ok {
+				return fmt.Errorf("duplicate broadcast group %q: defined in %s and %s", name, owner, label)
+			}
+			groups[name] = label
+			if cfg.BroadcastGroups == nil {
+				cfg.BroadcastGroups = make(map[string][]BroadcastTarget)
+			}
+			cfg.BroadcastGroups[name] = targets
+		}
+
+		cfg.Bots = append(cfg.Bots, frag.Bots...)
+		cfg.Agents = append(cfg.Agents, frag.Agents...)
+		cfg.Redact = append(cfg.Redact, frag.Redact...)
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFragment(t *testing.T, configPath string, name string, content string) {
+	t.Helper()
+	dir := FragmentDir(configPath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("create fragment dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatalf("write fragment: %v", err)
+	}
+}
+
+func TestLoad_MergesFragments(t *testing.T) {
+	path := writeConfig(t, `
+server:
+  notification_history_size: 10
+bots:
+  - name: main-bot
+    type: telegram
+    bot_token: tok
+`)
+	writeFragment(t, path, "20-eng.yaml", `
+bots:
+  - name: eng-bot
+    type: telegram
+    bot_token: tok
+agents:
+  - name: eng-agent
+    command: claude
+`)
+	writeFragment(t, path, "10-ops.yml", `
+bots:
+  - name: ops-bot
+    type: telegram
+    bot_token: tok
+`)
+	writeFragment(t, path, "notes.txt", "not yaml")
+	writeFragment(t, path, "30-empty.yaml", "")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var names []string
+	for _, bot := range cfg.Bots {
+		names = append(names, bot.Name)
+	}
+	if got := strings.Join(names, ","); got != "main-bot,ops-bot,eng-bot" {
+		t.Errorf("expected bots merged in lexical fragment order, got %s", got)
+	}
+	if len(cfg.Agents) != 1 || cfg.Agents[0].Name != "eng-agent" {
+		t.Errorf("expected fragment agent, got %+v", cfg.Agents)
+	}
+}
+
+func TestLoad_FragmentsOnly(t *testing.T) {
+	path := writeConfig(t, `
+server:
+  notification_history_size: 10
+`)
+	writeFragment(t, path, "ops.yaml", `
+bots:
+  - name: ops-bot
+    type: telegram
+    bot_token: tok
+`)
+
+	if _, err := Load(path); err != nil {
+		t.Fatalf("main file without bots should be valid when fragments add some: %v", err)
+	}
+}
+
+func TestLoad_FragmentErrors(t *testing.T) {
+	const main = `
+bots:
+  - name: ops-bot
+    type: telegram
+    bot_token: tok
+lists:
+  admins: [U123]
+broadcast_groups:
+  oncall:
+    - bot: ops-bot
+      channel: "-100123"
+`
+	tests := []struct {
+		name     string
+		fragment string
+		want     string
+	}{
+		{
+			name: "bot collides with main file",
+			fragment: `
+bots:
+  - name: ops-bot
+    type: telegram
+    bot_token: tok
+`,
+			want: `duplicate bot name "ops-bot": defined in pantalk.yaml and config.d/team.yaml`,
+		},
+		{
+			name: "server section",
+			fragment: `
+server:
+  db_path: /tmp/other.db
+`,
+			want: "server settings are only allowed in pantalk.yaml",
+		},
+		{
+			name:     "unknown field",
+			fragment: "bogus: true\n",
+			want:     "parse config.d/team.yaml",
+		},
+		{
+			name: "list collides with main file",
+			fragment: `
+lists:
+  admins: [U999]
+`,
+			want: `duplicate list "admins": defined in pantalk.yaml and config.d/team.yaml`,
+		},
+		{
+			name: "broadcast group collides with main file",
+			fragment: `
+broadcast_groups:
+  oncall:
+    - bot: ops-bot
+      channel: "-100456"
+`,
+			want: `duplicate broadcast group "oncall": defined in pantalk.yaml and config.d/team.yaml`,
+		},
+		{
+			name: "merged result is validated",
+			fragment: `
+bots:
+  - name: team-bot
+    type: slack
+`,
+			want: `bot "team-bot" requires bot_token`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, main)
+			writeFragment(t, path, "team.yaml", tt.fragment)
+
+			_, err := Load(path)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got: %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoad_FragmentCollisionBetweenFragments(t *testing.T) {
+	path := writeConfig(t, `
+bots:
+  - name: main-bot
+    type: telegram
+    bot_token: tok
+agents:
+  - name: triage
+    command: claude
+`)
+	writeFragment(t, path, "a.yaml", `
+agents:
+  - name: triage
+    command: codex
+`)
+
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), `duplicate agent name "triage": defined in pantalk.yaml and config.d/a.yaml`) {
+		t.Fatalf("expected agent collision naming both files, got: %v", err)
+	}
+}
+
+func TestLoadMain_IgnoresFragments(t *testing.T) {
+	path := writeConfig(t, `
+bots:
+  - name: main-bot
+    type: telegram
+    bot_token: tok
+`)
+	writeFragment(t, path, "team.yaml", `
+bots:
+  - name: team-bot
+    type: telegram
+    bot_token: tok
+`)
+
+	cfg, err := LoadMain(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Bots) != 1 || cfg.Bots[0].Name != "main-bot" {
+		t.Fatalf("expected only the main file's bots, got %+v", cfg.Bots)
+	}
+}
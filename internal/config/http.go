@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Defaults of a bot's http: block.
+const (
+	DefaultHTTPRetries = 2
+	DefaultHTTPBackoff = 500 * time.Millisecond
+)
+
+// HTTPConfig tunes the requests a bot makes to its platform's HTTP API
+// (http:). Unset fields keep the connector's defaults.
+type HTTPConfig struct {
+	Timeout     int  `yaml:"timeout"`      // seconds a request may take, retries included (default 20 for discord and mattermost, 30 for twilio, 180 for matrix, 60 otherwise)
+	PollTimeout int  `yaml:"poll_timeout"` // telegram, zulip: seconds a long poll waits for new events (default 50 and 90)
+	Retries     *int `yaml:"retries"`      // times a failed request is retried (default 2)
+	Backoff     int  `yaml:"backoff"`      // milliseconds before the first retry, doubled for each next one (default 500)
+	KeepAlive   int  `yaml:"keep_alive"`   // seconds an idle connection stays open for the next request (default 90; -1 closes it after each request)
+}
+
+// HTTPOptions returns the bot's http: block, or the defaults when it has none.
+func (b BotConfig) HTTPOptions() HTTPConfig {
+	if b.HTTP == nil {
+		return HTTPConfig{}
+	}
+	return *b.HTTP
+}
+
+// TimeoutOr returns the request timeout, or fallback when it is unset.
+func (h HTTPConfig) TimeoutOr(fallback time.Duration) time.Duration {
+	if h.Timeout > 0 {
+		return time.Duration(h.Timeout) * time.Second
+	}
+	return fallback
+}
+
+// PollTimeoutOr returns how long a long poll waits, or fallback when it is
+// unset.
+func (h HTTPConfig) PollTimeoutOr(fallback time.Duration) time.Duration {
+	if h.PollTimeout > 0 {
+		return time.Duration(h.PollTimeout) * time.Second
+	}
+	return fallback
+}
+
+// RetryCount returns how many times a failed request is retried.
+func (h HTTPConfig) RetryCount() int {
+	if h.Retries == nil {
+		return DefaultHTTPRetries
+	}
+	return *h.Retries
+}
+
+// BackoffDuration returns the wait before the first retry.
+func (h HTTPConfig) BackoffDuration() time.Duration {
+	if h.Backoff > 0 {
+		return time.Duration(h.Backoff) * time.Millisecond
+	}
+	return DefaultHTTPBackoff
+}
+
+// validateHTTP checks a bot's http: block.
+func validateHTTP(bot BotConfig) error {
+	if bot.HTTP == nil {
+		return nil
+	}
+	switch bot.Type {
+	case "slack", "discord", "mattermost", "telegram", "matrix", "twilio", "zulip":
+	default:
+		return fmt.Errorf("bot %q: http options are not supported for %s bots", bot.Name, bot.Type)
+	}
+
+	opts := *bot.HTTP
+	switch {
+	case opts.Timeout < 0:
+		return fmt.Errorf("bot %q: http timeout cannot be negative", bot.Name)
+	case opts.PollTimeout < 0:
+		return fmt.Errorf("bot %q: http poll_timeout cannot be negative", bot.Name)
+	case opts.Retries != nil && *opts.Retries < 0:
+		return fmt.Errorf("bot %q: http retries cannot be negative", bot.Name)
+	case opts.Backoff < 0:
+		return fmt.Errorf("bot %q: http backoff cannot be negative", bot.Name)
+	case opts.KeepAlive < -1:
+		return fmt.Errorf("bot %q: http keep_alive must be -1 or more", bot.Name)
+	}
+	// Matrix syncs through the same client, long-polling for 30s.
+	if bot.Type == "matrix" && opts.Timeout > 0 && opts.Timeout < 60 {
+		return fmt.Errorf("bot %q: http timeout must be at least 60 for matrix bots, whose sync waits 30s for events", bot.Name)
+	}
+	if opts.PollTimeout > 0 && bot.Type != "telegram" && bot.Type != "zulip" {
+		return fmt.Errorf("bot %q: http poll_timeout is only supported for telegram and zulip bots", bot.Name)
+	}
+	if opts.PollTimeout > 0 && bot.Type == "telegram" && bot.Transport == TransportWebhook {
+		return fmt.Errorf("bot %q: http poll_timeout has no effect with transport: webhook", bot.Name)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IRC SASL mechanisms accepted in irc.sasl.
+const (
+	SASLPlain    = "plain"
+	SASLExternal = "external"
+)
+
+// IRCConfig holds the connection and authentication options of an irc
+// bot (irc:). Passwords accept the same references as other credentials.
+type IRCConfig struct {
+	TLS        *bool  `yaml:"tls"`         // default: on for port 6697 or when the endpoint has no port
+	TLSVerify  *bool  `yaml:"tls_verify"`  // verify the server certificate (default true)
+	ClientCert string `yaml:"client_cert"` // PEM certificate for CertFP and SASL EXTERNAL
+	ClientKey  string `yaml:"client_key"`
+
+	SASL         string `yaml:"sasl"`          // plain or external
+	SASLUser     string `yaml:"sasl_user"`     // account name (default: the bot name)
+	SASLPassword string `yaml:"sasl_password"` // plain only
+
+	NickServPassword string `yaml:"nickserv_password"` // IDENTIFY with NickServ after connecting
+
+	AltNicks     []string `yaml:"alt_nicks"`      // tried in order when the nick is taken
+	RejoinOnKick *bool    `yaml:"rejoin_on_kick"` // default true
+}
+
+// IRCOptions returns the bot's irc: block, or the defaults when it has none.
+func (b BotConfig) IRCOptions() IRCConfig {
+	if b.IRC == nil {
+		return IRCConfig{}
+	}
+	return *b.IRC
+}
+
+// validateIRC checks an irc bot's irc: block.
+func validateIRC(bot BotConfig) error {
+	opts := bot.IRCOptions()
+
+	if (opts.ClientCert == "") != (opts.ClientKey == "") {
+		return fmt.Errorf("bot %q: irc client_cert and client_key must be set together", bot.Name)
+	}
+	if opts.ClientCert != "" && opts.TLS != nil && !*opts.TLS {
+		return fmt.Errorf("bot %q: irc client_cert requires tls", bot.Name)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(opts.SASL)) {
+	case "":
+		if opts.SASLUser != "" || opts.SASLPassword != "" {
+			return fmt.Errorf("bot %q: irc sasl_user and sasl_password require sasl: plain", bot.Name)
+		}
+	case SASLPlain:
+		if strings.TrimSpace(opts.SASLPassword) == "" {
+			return fmt.Errorf("bot %q: irc sasl: plain requires sasl_password", bot.Name)
+		}
+	case SASLExternal:
+		if opts.ClientCert == "" {
+			return fmt.Errorf("bot %q: irc sasl: external requires client_cert and client_key", bot.Name)
+		}
+		if opts.SASLPassword != "" {
+			return fmt.Errorf("bot %q: irc sasl: external authenticates with the client certificate, not sasl_password", bot.Name)
+		}
+	default:
+		return fmt.Errorf("bot %q: unknown irc sasl mechanism %q (valid: %s, %s)", bot.Name, opts.SASL, SASLPlain, SASLExternal)
+	}
+
+	for _, nick := range opts.AltNicks {
+		if strings.TrimSpace(nick) == "" || strings.ContainsAny(nick, " ,:") {
+			return fmt.Errorf("bot %q: invalid irc alt nick %q", bot.Name, nick)
+		}
+	}
+
+	return nil
+}
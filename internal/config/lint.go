@@ -0,0 +1,134 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pantalk/pantalk/internal/agent"
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// twilioNumber is a channel of a Twilio bot: the E.164 number texting it.
+var twilioNumber = regexp.MustCompile(`^\+[0-9]{6,15}$`)
+
+// Lint reports setups that pass validation but are probably mistakes, such
+// as a credential whose environment variable isn't set here or an agent
+// that can never run. cfg is expected to be valid.
+func Lint(cfg Config) []string {
+	var warnings []string
+	warn := func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	for _, ref := range credentialRefs(cfg) {
+		if name, unset := unsetEnvRef(ref.value); unset {
+			warn("%s refers to $%s, which is not set in this environment", ref.field, name)
+		}
+	}
+
+	bots := make([]protocol.BotRef, 0, len(cfg.Bots))
+	for _, bot := range cfg.Bots {
+		bots = append(bots, protocol.BotRef{Service: bot.Type, Name: bot.Name})
+
+		seen := make(map[string]bool, len(bot.Channels))
+		for _, channel := range bot.Channels {
+			channel = strings.TrimSpace(channel)
+			if seen[channel] {
+				warn("bot %q: channel %q is listed more than once", bot.Name, channel)
+				continue
+			}
+			seen[channel] = true
+
+			switch {
+			case bot.Type == "whatsapp" && !strings.Contains(channel, "@"):
+				warn("bot %q: channel %q is not a chat JID (e.g. 15551234567@s.whatsapp.net or 120363025246125486@g.us) and never matches", bot.Name, channel)
+			case bot.Type == "twilio" && !twilioNumber.MatchString(channel):
+				warn("bot %q: channel %q is not a phone number in E.164 form (e.g. +15551234567) and never matches", bot.Name, channel)
+			}
+		}
+	}
+
+	for _, a := range cfg.Agents {
+		never, err := agent.NeverTrue(a.When, cfg.Lists, bots)
+		if err == nil && never {
+			warn("agent %q: when %q can never be true for these bots, so the agent never runs", a.Name, a.When)
+		}
+
+		buffer, timeout := a.Buffer, a.Timeout
+		if buffer <= 0 {
+			buffer = 30
+		}
+		if timeout <= 0 {
+			timeout = 120
+		}
+		if buffer > timeout {
+			warn("agent %q: buffer (%ds) is longer than timeout (%ds); events wait longer than the agent may run", a.Name, buffer, timeout)
+		}
+	}
+
+	return warnings
+}
+
+type credentialRef struct {
+	field string
+	value string
+}
+
+// credentialRefs lists the credential fields that are set, named as in
+// error messages.
+func credentialRefs(cfg Config) []credentialRef {
+	var refs []credentialRef
+	add := func(field string, value string) {
+		if strings.TrimSpace(value) != "" {
+			refs = append(refs, credentialRef{field, value})
+		}
+	}
+
+	add("server.http_token", cfg.Server.HTTPToken)
+	if cfg.Ntfy != nil {
+		add("ntfy.token", cfg.Ntfy.Token)
+	}
+	if cfg.Transcription != nil {
+		add("transcription.api_key", cfg.Transcription.APIKey)
+	}
+	if cfg.Classifier != nil {
+		add("classifier.api_key", cfg.Classifier.APIKey)
+	}
+	if cfg.Translation != nil {
+		add("translation.api_key", cfg.Translation.APIKey)
+	}
+	for _, bot := range cfg.Bots {
+		prefix := fmt.Sprintf("bot %q: ", bot.Name)
+		add(prefix+"bot_token", bot.BotToken)
+		add(prefix+"app_level_token", bot.AppLevelToken)
+		add(prefix+"user_token", bot.UserToken)
+		add(prefix+"signing_secret", bot.SigningSecret)
+		add(prefix+"proxy", bot.Proxy)
+		add(prefix+"password", bot.Password)
+		add(prefix+"auth_token", bot.AuthToken)
+		add(prefix+"account_sid", bot.AccountSID)
+		add(prefix+"api_key", bot.APIKey)
+		add(prefix+"bot_email", bot.BotEmail)
+		add(prefix+"access_token", bot.AccessToken)
+		irc := bot.IRCOptions()
+		add(prefix+"irc.sasl_password", irc.SASLPassword)
+		add(prefix+"irc.nickserv_password", irc.NickServPassword)
+	}
+	return refs
+}
+
+// unsetEnvRef returns the variable a "$NAME" or "${NAME}" credential
+// refers to, and whether it is unset.
+func unsetEnvRef(value string) (string, bool) {
+	trimmed := strings.TrimSpace(value)
+	if !strings.HasPrefix(trimmed, "$") {
+		return "", false
+	}
+	name := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(trimmed, "$"), "{"), "}"))
+	if name == "" {
+		return "", false
+	}
+	return name, strings.TrimSpace(os.Getenv(name)) == ""
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	t.Setenv("PANTALK_LINT_SET", "xoxb-set")
+
+	cfg, err := Load(writeConfig(t, `
+bots:
+  - name: ops
+    type: slack
+    bot_token: $PANTALK_LINT_SET
+    app_level_token: ${PANTALK_LINT_UNSET}
+    channels: [C1, C2, C1]
+  - name: phone
+    type: whatsapp
+    channels: ['15551234567', '15557654321@s.whatsapp.net']
+agents:
+  - name: typo
+    when: kind == "mesage"
+    command: claude
+  - name: slow
+    when: notify
+    buffer: 300
+    command: claude
+  - name: fine
+    when: service == "slack" && direct
+    command: claude
+`))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	want := []string{
+		`bot "ops": app_level_token refers to $PANTALK_LINT_UNSET, which is not set in this environment`,
+		`bot "ops": channel "C1" is listed more than once`,
+		`bot "phone": channel "15551234567" is not a chat JID`,
+		`agent "typo": when "kind == \"mesage\"" can never be true`,
+		`agent "slow": buffer (300s) is longer than timeout (120s)`,
+	}
+	got := Lint(cfg)
+	if len(got) != len(want) {
+		t.Fatalf("expected %d warnings, got %d:\n%s", len(want), len(got), strings.Join(got, "\n"))
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("warning %d = %q, want it to start with %q", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MockConfig holds the options of a type: mock bot. A mock bot talks to no
+// platform: it echoes what is sent through it, answers from a scenario
+// file and takes inbound messages over HTTP, so agent setups can be tried
+// end to end without real tokens.
+type MockConfig struct {
+	Scenario string `yaml:"scenario"` // YAML file of scripted replies and inbound messages, see MockScenario
+	Listen   string `yaml:"listen"`   // loopback host:port of the HTTP endpoint that injects inbound messages (default: none)
+	Echo     *bool  `yaml:"echo"`     // echo sends that no scenario reply matches (default true)
+}
+
+// MockOptions returns the bot's mock: block, or the defaults when it has none.
+func (b BotConfig) MockOptions() MockConfig {
+	if b.Mock == nil {
+		return MockConfig{}
+	}
+	return *b.Mock
+}
+
+// EchoEnabled reports whether unmatched sends are echoed back.
+func (m MockConfig) EchoEnabled() bool {
+	return m.Echo == nil || *m.Echo
+}
+
+// MockScenario is the script of a mock bot.
+type MockScenario struct {
+	// Replies answer sent messages: the first reply whose match finds the
+	// sent text is posted back in the same channel and thread.
+	Replies []MockReply `yaml:"replies"`
+	// Inbound messages are posted, in order, once the bot connects.
+	Inbound []MockMessage `yaml:"inbound"`
+}
+
+// MockReply is a scripted answer to sent messages.
+type MockReply struct {
+	Match string `yaml:"match"` // regular expression tested against the sent text
+	Reply string `yaml:"reply"` // $1, ${name} expand to the match's groups
+	User  string `yaml:"user"`  // who answers (default "mock-user")
+	Delay int    `yaml:"delay"` // milliseconds before the answer (default 300)
+
+	pattern *regexp.Regexp
+}
+
+// Pattern returns the compiled match expression.
+func (r MockReply) Pattern() *regexp.Regexp {
+	return r.pattern
+}
+
+// MockMessage is an inbound message, from a scenario or posted to the
+// mock bot's HTTP endpoint.
+type MockMessage struct {
+	Channel string `yaml:"channel" json:"channel"`
+	Thread  string `yaml:"thread" json:"thread,omitempty"`
+	User    string `yaml:"user" json:"user,omitempty"` // default "mock-user"
+	Text    string `yaml:"text" json:"text"`
+	Direct  bool   `yaml:"direct" json:"direct,omitempty"` // a direct message from user rather than a channel post
+	Delay   int    `yaml:"delay" json:"-"`                 // milliseconds after the previous scenario message (scenarios only)
+}
+
+// LoadMockScenario reads and checks a scenario file. A leading ~/ is the
+// home directory.
+func LoadMockScenario(path string) (MockScenario, error) {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, rest)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return MockScenario{}, fmt.Errorf("read mock scenario: %w", err)
+	}
+
+	var scenario MockScenario
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&scenario); err != nil {
+		return MockScenario{}, fmt.Errorf("parse mock scenario %s: %w", path, err)
+	}
+
+	for i := range scenario.Replies {
+		reply := &scenario.Replies[i]
+		if strings.TrimSpace(reply.Reply) == "" {
+			return MockScenario{}, fmt.Errorf("mock scenario %s: reply %d is empty", path, i+1)
+		}
+		if reply.Delay < 0 {
+			return MockScenario{}, fmt.Errorf("mock scenario %s: reply %d has a negative delay", path, i+1)
+		}
+		if reply.pattern, err = regexp.Compile(reply.Match); err != nil {
+			return MockScenario{}, fmt.Errorf("mock scenario %s: reply %d: invalid match: %w", path, i+1, err)
+		}
+	}
+	for i, message := range scenario.Inbound {
+		if strings.TrimSpace(message.Text) == "" {
+			return MockScenario{}, fmt.Errorf("mock scenario %s: inbound message %d has no text", path, i+1)
+		}
+		if message.Channel == "" && !message.Direct {
+			return MockScenario{}, fmt.Errorf("mock scenario %s: inbound message %d needs a channel or direct: true", path, i+1)
+		}
+		if message.Delay < 0 {
+			return MockScenario{}, fmt.Errorf("mock scenario %s: inbound message %d has a negative delay", path, i+1)
+		}
+	}
+	return scenario, nil
+}
+
+// validateMock checks a mock bot's mock: block, including its scenario.
+func validateMock(bot BotConfig) error {
+	opts := bot.MockOptions()
+
+	if opts.Listen != "" {
+		host, _, err := net.SplitHostPort(opts.Listen)
+		if err != nil {
+			return fmt.Errorf("bot %q: invalid mock listen address %q: %w", bot.Name, opts.Listen, err)
+		}
+		// Anyone who reaches the endpoint can post as any user.
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return fmt.Errorf("bot %q: mock listen address %q must be on loopback (localhost, 127.0.0.1 or [::1]): the inject endpoint has no authentication", bot.Name, opts.Listen)
+		}
+	}
+	if opts.Scenario != "" {
+		if _, err := LoadMockScenario(opts.Scenario); err != nil {
+			return fmt.Errorf("bot %q: %w", bot.Name, err)
+		}
+	}
+	return nil
+}
@@ -27,11 +27,17 @@ func DefaultConfigPath() string {
 //  1. $XDG_RUNTIME_DIR/pantalk.sock (if XDG_RUNTIME_DIR is set)
 //  2. /tmp/pantalk-<uid>.sock (per-user fallback)
 func DefaultSocketPath() string {
+	return DefaultSocketPathFor(strconv.Itoa(os.Getuid()))
+}
+
+// DefaultSocketPathFor is DefaultSocketPath for the account with the given
+// uid, for commands run through sudo on behalf of another user.
+func DefaultSocketPathFor(uid string) string {
 	if runtimeDir := strings.TrimSpace(os.Getenv("XDG_RUNTIME_DIR")); runtimeDir != "" {
 		return filepath.Join(runtimeDir, "pantalk.sock")
 	}
 
-	return fmt.Sprintf("/tmp/pantalk-%d.sock", os.Getuid())
+	return fmt.Sprintf("/tmp/pantalk-%s.sock", uid)
 }
 
 // DefaultDBPath returns the resolved database path using a fallback chain:
@@ -88,3 +94,15 @@ func homeDir() string {
 	// fallback for unusual environments
 	return "/tmp/pantalk-" + strconv.Itoa(os.Getuid())
 }
+
+// SymbolicPaths maps the default paths as resolved on this machine to their
+// portable spelling. Build-time generated docs use it so they don't embed the
+// build user's home directory.
+func SymbolicPaths() map[string]string {
+	return map[string]string{
+		DefaultConfigPath():      "~/.config/pantalk/config.yaml",
+		DefaultSocketPath():      "$XDG_RUNTIME_DIR/pantalk.sock",
+		DefaultDBPath():          "~/.local/share/pantalk/pantalk.db",
+		DefaultSkillsCachePath(): "~/.cache/pantalk/skills",
+	}
+}
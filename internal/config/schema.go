@@ -0,0 +1,250 @@
+package config
+
+import (
+	"embed"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/pantalk/pantalk/internal/agent"
+)
+
+// SchemaURI is the JSON Schema dialect Schema is written in.
+const SchemaURI = "https://json-schema.org/draft/2020-12/schema"
+
+// sources are the files declaring the config structs; their doc comments
+// become the schema's descriptions, so the two can't drift apart.
+//
+//go:embed config.go http.go irc.go mock.go
+var sources embed.FS
+
+// Schema returns a JSON Schema of the config file, derived from the config
+// structs: field names from their yaml tags, descriptions from their doc
+// comments, and the fields each built-in bot type requires. Editors use it
+// to complete and check pantalk.yaml; it says nothing of the checks
+// validation makes across fields, such as agent commands being allowed.
+func Schema() map[string]any {
+	b := &schemaBuilder{docs: sourceDocs(), defs: map[string]map[string]any{}}
+
+	root := b.object(reflect.TypeFor[Config]())
+	root["$schema"] = SchemaURI
+	root["title"] = "pantalk configuration"
+
+	bot := b.defs["BotConfig"]
+	bot["required"] = []string{"name", "type"}
+	bot["allOf"] = botTypeSchemas()
+	b.defs["AgentConfig"]["required"] = []string{"name", "command"}
+
+	defs := make(map[string]any, len(b.defs))
+	for name, def := range b.defs {
+		defs[name] = def
+	}
+	root["$defs"] = defs
+	return root
+}
+
+// botTypeSchemas expresses botRequirements, and what custom types need, as
+// conditional subschemas of a bot.
+func botTypeSchemas() []any {
+	types := make([]string, 0, len(botRequirements))
+	for name := range botRequirements {
+		types = append(types, name)
+	}
+	slices.Sort(types)
+
+	var out []any
+	for _, name := range types {
+		required := make(map[fieldTransport][]string)
+		for _, field := range botRequirements[name] {
+			required[field.transport] = append(required[field.transport], field.name)
+		}
+		for _, transport := range []fieldTransport{anyTransport, webhookOnly, noWebhook} {
+			if len(required[transport]) == 0 {
+				continue
+			}
+			properties := map[string]any{"type": map[string]any{"const": name}}
+			switch transport {
+			case webhookOnly:
+				properties["transport"] = map[string]any{"const": TransportWebhook}
+			case noWebhook:
+				properties["transport"] = map[string]any{"not": map[string]any{"const": TransportWebhook}}
+			}
+			out = append(out, map[string]any{
+				"if":   map[string]any{"properties": properties, "required": []string{"type"}},
+				"then": map[string]any{"required": required[transport]},
+			})
+		}
+	}
+
+	return append(out,
+		map[string]any{
+			"if":   map[string]any{"properties": map[string]any{"type": map[string]any{"not": map[string]any{"enum": types}}}, "required": []string{"type"}},
+			"then": map[string]any{"required": []string{"transport"}},
+		},
+		map[string]any{
+			"if":   map[string]any{"properties": map[string]any{"transport": map[string]any{"const": "exec"}}, "required": []string{"transport"}},
+			"then": map[string]any{"required": []string{"command"}},
+		},
+	)
+}
+
+type schemaBuilder struct {
+	docs map[string]typeDocs
+	defs map[string]map[string]any
+}
+
+// typeDocs are the doc comments of a struct and its fields.
+type typeDocs struct {
+	doc    string
+	fields map[string]string
+}
+
+// schema returns the schema of a value of type t.
+func (b *schemaBuilder) schema(t reflect.Type) map[string]any {
+	switch t {
+	case reflect.TypeFor[agent.Command]():
+		return map[string]any{"oneOf": []any{
+			map[string]any{"type": "string", "description": "split on spaces, honouring quotes; never run through a shell"},
+			map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		}}
+	case reflect.TypeFor[NotifyRule]():
+		return map[string]any{"oneOf": []any{
+			map[string]any{"type": "string", "description": "a pattern matched in every channel"},
+			b.ref(t),
+		}}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.schema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		return b.ref(t)
+	default:
+		return map[string]any{}
+	}
+}
+
+// ref defines struct type t once under $defs and refers to it.
+func (b *schemaBuilder) ref(t reflect.Type) map[string]any {
+	if _, ok := b.defs[t.Name()]; !ok {
+		b.defs[t.Name()] = nil // placeholder while the fields are built
+		b.defs[t.Name()] = b.object(t)
+	}
+	return map[string]any{"$ref": "#/$defs/" + t.Name()}
+}
+
+// object is the schema of struct type t. Unknown keys are rejected, as
+// Load rejects them.
+func (b *schemaBuilder) object(t reflect.Type) map[string]any {
+	docs := b.docs[t.Name()]
+	properties := map[string]any{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		property := b.schema(field.Type)
+		if doc := docs.fields[field.Name]; doc != "" {
+			// A $ref's siblings are ignored by older drafts, so wrap it.
+			if _, isRef := property["$ref"]; isRef {
+				property = map[string]any{"allOf": []any{property}}
+			}
+			property["description"] = strings.Replace(doc, field.Name+" ", name+" ", 1)
+		}
+		properties[name] = property
+	}
+
+	object := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if docs.doc != "" {
+		object["description"] = docs.doc
+	}
+	return object
+}
+
+// sourceDocs collects the doc comments of the structs in sources, keyed by
+// type and field name, each joined into one line.
+func sourceDocs() map[string]typeDocs {
+	docs := map[string]typeDocs{}
+	entries, _ := sources.ReadDir(".")
+	for _, entry := range entries {
+		src, err := sources.ReadFile(entry.Name())
+		if err != nil {
+			continue
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), entry.Name(), src, parser.ParseComments)
+		if err != nil {
+			continue
+		}
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				structType, ok := typeSpec.Type.(*ast.StructType)
+				if !ok {
+					continue
+				}
+				group := typeSpec.Doc
+				if group == nil {
+					group = gen.Doc
+				}
+				td := typeDocs{doc: commentText(group), fields: map[string]string{}}
+				for _, field := range structType.Fields.List {
+					text := commentText(field.Doc)
+					if text == "" {
+						text = commentText(field.Comment)
+					}
+					for _, name := range field.Names {
+						td.fields[name.Name] = text
+					}
+				}
+				docs[typeSpec.Name.Name] = td
+			}
+		}
+	}
+	return docs
+}
+
+// commentText is a comment as one line, without its code examples.
+func commentText(group *ast.CommentGroup) string {
+	if group == nil {
+		return ""
+	}
+	var lines []string
+	for _, line := range strings.Split(group.Text(), "\n") {
+		if strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "  ") {
+			continue
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSuffix(strings.Join(lines, " "), ":")
+}
@@ -0,0 +1,246 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// schemaJSON is Schema as it is printed, decoded back into plain values.
+func schemaJSON(t *testing.T) map[string]any {
+	t.Helper()
+	data, err := json.Marshal(Schema())
+	if err != nil {
+		t.Fatalf("marshal schema: %v", err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("unmarshal schema: %v", err)
+	}
+	return schema
+}
+
+// property follows a dotted path of keys through schema, resolving $refs,
+// and returns the property's schema or nil.
+func property(schema map[string]any, path string) map[string]any {
+	defs, _ := schema["$defs"].(map[string]any)
+	resolve := func(node map[string]any) map[string]any {
+		for {
+			if all, ok := node["allOf"].([]any); ok && len(all) == 1 {
+				node = all[0].(map[string]any)
+			}
+			if one, ok := node["oneOf"].([]any); ok {
+				node = one[len(one)-1].(map[string]any)
+			}
+			if items, ok := node["items"].(map[string]any); ok {
+				node = items
+				continue
+			}
+			ref, ok := node["$ref"].(string)
+			if !ok {
+				return node
+			}
+			node, _ = defs[strings.TrimPrefix(ref, "#/$defs/")].(map[string]any)
+		}
+	}
+
+	node := schema
+	for _, key := range strings.Split(path, ".") {
+		properties, _ := resolve(node)["properties"].(map[string]any)
+		next, ok := properties[key].(map[string]any)
+		if !ok {
+			return nil
+		}
+		node = next
+	}
+	return node
+}
+
+func TestSchema_CoversConfig(t *testing.T) {
+	schema := schemaJSON(t)
+	if schema["$schema"] != SchemaURI {
+		t.Fatalf("$schema = %v", schema["$schema"])
+	}
+	if schema["additionalProperties"] != false {
+		t.Fatal("expected unknown top-level keys to be rejected")
+	}
+
+	cfgType := reflect.TypeFor[Config]()
+	for i := 0; i < cfgType.NumField(); i++ {
+		name := cfgType.Field(i).Tag.Get("yaml")
+		if property(schema, name) == nil {
+			t.Fatalf("schema is missing %s", name)
+		}
+	}
+
+	for path, kind := range map[string]string{
+		"server.debug_addr":      "string",
+		"server.watch_config":    "boolean",
+		"bots.thread_window":     "integer",
+		"bots.channels":          "array",
+		"tracing.headers":        "object",
+		"broadcast_groups":       "object",
+		"agents.reply_template":  "string",
+		"bots.notify_on.channel": "string",
+		"bots.digest.window":     "integer",
+		"bots.irc.tls":           "boolean",
+	} {
+		node := property(schema, path)
+		if node == nil {
+			t.Fatalf("schema is missing %s", path)
+		}
+		if got, _ := node["type"].(string); got != kind {
+			if all, ok := node["allOf"].([]any); !ok || all[0].(map[string]any)["type"] != kind {
+				t.Fatalf("%s: type = %v, want %s", path, node["type"], kind)
+			}
+		}
+	}
+}
+
+func TestSchema_Descriptions(t *testing.T) {
+	schema := schemaJSON(t)
+
+	cases := map[string]string{
+		"server.debug_addr": "debug_addr serves pprof",
+		"bots.media_dir":    "whatsapp: where received media is saved",
+		"tracing.slow":      "slow is how many milliseconds",
+		"bots.irc.sasl":     "plain or external",
+	}
+	for path, want := range cases {
+		description, _ := property(schema, path)["description"].(string)
+		if !strings.Contains(description, want) {
+			t.Fatalf("%s description = %q, want it to contain %q", path, description, want)
+		}
+	}
+
+	description, _ := property(schema, "bots.notify_on")["description"].(string)
+	if strings.Contains(description, "\n") {
+		t.Fatalf("expected a one-line description, got %q", description)
+	}
+}
+
+func TestSchema_Commands(t *testing.T) {
+	schema := schemaJSON(t)
+	command := property(schema, "agents.command")
+	variants, _ := command["oneOf"].([]any)
+	if len(variants) != 2 {
+		t.Fatalf("expected command as string or list, got %v", command)
+	}
+}
+
+func TestSchema_BotRequirements(t *testing.T) {
+	schema := schemaJSON(t)
+	bot := schema["$defs"].(map[string]any)["BotConfig"].(map[string]any)
+
+	required := map[string][]any{}
+	for _, rule := range bot["allOf"].([]any) {
+		rule := rule.(map[string]any)
+		typ, _ := rule["if"].(map[string]any)["properties"].(map[string]any)["type"].(map[string]any)
+		name, ok := typ["const"].(string)
+		if !ok {
+			continue
+		}
+		if transport, ok := rule["if"].(map[string]any)["properties"].(map[string]any)["transport"].(map[string]any); ok {
+			if transport["const"] == TransportWebhook {
+				name += "+webhook"
+			} else {
+				name += "-webhook"
+			}
+		}
+		required[name] = rule["then"].(map[string]any)["required"].([]any)
+	}
+
+	want := map[string][]any{
+		"slack":         {"bot_token"},
+		"slack-webhook": {"app_level_token"},
+		"slack+webhook": {"signing_secret"},
+		"twilio":        {"auth_token", "account_sid", "phone_number"},
+		"zulip":         {"endpoint", "api_key", "bot_email"},
+		"matrix":        {"endpoint"},
+	}
+	for name, fields := range want {
+		if !reflect.DeepEqual(required[name], fields) {
+			t.Fatalf("%s requires %v, want %v", name, required[name], fields)
+		}
+	}
+	if _, ok := required["whatsapp"]; ok {
+		t.Fatal("whatsapp requires no fields")
+	}
+}
+
+func TestBotRequirements_Validated(t *testing.T) {
+	for typ, fields := range botRequirements {
+		for _, missing := range fields {
+			bot := BotConfig{
+				Name:          "b",
+				Type:          typ,
+				SigningSecret: "t",
+				BotToken:      "t",
+				AppLevelToken: "t",
+				Endpoint:      "irc.example.org:6697",
+				AuthToken:     "t",
+				AccountSID:    "t",
+				PhoneNumber:   "+15551234567",
+				APIKey:        "t",
+				BotEmail:      "b@example.org",
+			}
+			value := reflect.ValueOf(&bot).Elem()
+			for i := 0; i < value.NumField(); i++ {
+				if value.Type().Field(i).Tag.Get("yaml") == missing.name {
+					value.Field(i).SetString("")
+				}
+			}
+
+			if missing.transport == webhookOnly {
+				bot.Transport = TransportWebhook
+			}
+			err := validate(Config{Server: ServerConfig{HTTPAddr: "127.0.0.1:8750", HTTPToken: "t"}, Bots: []BotConfig{bot}}, false)
+			if err == nil || !strings.Contains(err.Error(), "requires "+missing.name) {
+				t.Fatalf("%s bot without %s: got %v", typ, missing.name, err)
+			}
+		}
+	}
+}
+
+func TestSchema_ExampleConfig(t *testing.T) {
+	data, err := os.ReadFile("../../configs/pantalk.example.yaml")
+	if err != nil {
+		t.Fatalf("read example: %v", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("parse example: %v", err)
+	}
+	schema := schemaJSON(t)
+
+	var walk func(node *yaml.Node, path string)
+	walk = func(node *yaml.Node, path string) {
+		switch node.Kind {
+		case yaml.DocumentNode, yaml.SequenceNode:
+			for _, child := range node.Content {
+				walk(child, path)
+			}
+		case yaml.MappingNode:
+			if path != "" {
+				if property(schema, path)["additionalProperties"] != false && property(schema, path)["properties"] == nil {
+					return // a map of arbitrary keys, such as lists
+				}
+			}
+			for i := 0; i < len(node.Content); i += 2 {
+				key := node.Content[i].Value
+				if path != "" {
+					key = path + "." + key
+				}
+				if property(schema, key) == nil {
+					t.Fatalf("example config sets %s, which the schema doesn't know", key)
+				}
+				walk(node.Content[i+1], key)
+			}
+		}
+	}
+	walk(&doc, "")
+}
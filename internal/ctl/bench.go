@@ -0,0 +1,75 @@
+package ctl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/manpage"
+	"github.com/pantalk/pantalk/internal/server"
+)
+
+// runBench pushes synthetic traffic through an in-process daemon and
+// reports store write, publish and fan-out latency percentiles and how
+// many events subscribers dropped. Ctrl-C stops early and still reports.
+func runBench(args []string) error {
+	flags := manpage.NewFlagSet("bench")
+	rate := flags.Int("events-per-sec", 100, "inbound messages generated per second")
+	duration := flags.Duration("duration", 10*time.Second, "how long to generate them")
+	subscribers := flags.Int("subscribers", 1, "subscriptions reading every event")
+	buffer := flags.Int("buffer", 0, "queue of each subscription (default: the daemon's)")
+	readDelay := flags.Duration("read-delay", 0, "time a subscriber spends per event, to model slow clients")
+	dbPath := flags.String("db", "", "database to write, e.g. on the daemon's disk (default: a temporary one)")
+	jsonOut := flags.Bool("json", false, "output as JSON (durations in nanoseconds)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if !*jsonOut {
+		fmt.Printf("benchmarking %d events/s for %s with %d subscriber(s)...\n", *rate, *duration, *subscribers)
+	}
+	report, err := server.Bench(ctx, server.BenchOptions{
+		EventsPerSec: *rate,
+		Duration:     *duration,
+		Subscribers:  *subscribers,
+		Buffer:       *buffer,
+		ReadDelay:    *readDelay,
+		DBPath:       *dbPath,
+	})
+	if err != nil {
+		return err
+	}
+
+	if *jsonOut {
+		return json.NewEncoder(os.Stdout).Encode(report)
+	}
+
+	fmt.Printf("published    %d events in %s (%.1f/s)\n", report.Published, report.Elapsed.Round(time.Millisecond), report.Rate)
+	printLatency("store write", report.StoreWrite)
+	printLatency("publish", report.Publish)
+	printLatency("fan-out", report.FanOut)
+	fmt.Printf("subscribers  %d delivered, %d dropped (%.2f%%)\n", report.Delivered, report.Dropped, report.DropRate*100)
+	if report.Rate < float64(*rate)*0.95 {
+		fmt.Printf("note: publishing fell behind the requested %d events/s\n", *rate)
+	}
+	return nil
+}
+
+func printLatency(label string, latency server.Latency) {
+	if latency.Count == 0 {
+		fmt.Printf("%-12s no samples\n", label)
+		return
+	}
+	fmt.Printf("%-12s p50 %s  p90 %s  p99 %s  max %s\n", label,
+		formatLatency(latency.P50), formatLatency(latency.P90), formatLatency(latency.P99), formatLatency(latency.Max))
+}
+
+func formatLatency(d time.Duration) string {
+	return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+}
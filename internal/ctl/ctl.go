@@ -9,6 +9,8 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -16,6 +18,7 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/manpage"
 	"github.com/pantalk/pantalk/internal/protocol"
 )
 
@@ -38,10 +41,22 @@ func Run(args []string) error {
 		return runValidate(subArgs)
 	case "reload":
 		return runReload(subArgs)
+	case "verify":
+		return runVerify(subArgs)
+	case "rotate-token":
+		return runRotateToken(subArgs)
 	case "config":
 		return runConfig(subArgs)
 	case "pair":
 		return runPair(subArgs)
+	case "invite":
+		return runInvite(subArgs)
+	case "db":
+		return runDB(subArgs)
+	case "service":
+		return runService(subArgs)
+	case "bench":
+		return runBench(subArgs)
 	case "help", "-h", "--help":
 		printUsage()
 		return nil
@@ -51,7 +66,7 @@ func Run(args []string) error {
 }
 
 func runSetup(args []string) error {
-	flags := flag.NewFlagSet("setup", flag.ContinueOnError)
+	flags := manpage.NewFlagSet("setup")
 	output := flags.String("output", defaultConfigPath, "output config path")
 	force := flags.Bool("force", false, "overwrite output file if it exists")
 	if err := flags.Parse(args); err != nil {
@@ -95,22 +110,44 @@ func runSetup(args []string) error {
 }
 
 func runValidate(args []string) error {
-	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags := manpage.NewFlagSet("validate")
 	configPath := flags.String("config", defaultConfigPath, "config path to validate")
+	lint := flags.Bool("lint", false, "also warn about setups that are valid but probably mistakes")
+	strict := flags.Bool("strict", false, "with --lint, fail when there are warnings")
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
 
-	if _, err := config.Load(*configPath); err != nil {
+	cfg, err := config.Load(*configPath)
+	if err != nil {
 		return fmt.Errorf("config validation failed: %w", err)
 	}
 
+	fragments, err := config.Fragments(*configPath)
+	if err != nil {
+		return err
+	}
+
 	fmt.Printf("config is valid: %s\n", *configPath)
+	for _, fragment := range fragments {
+		fmt.Printf("  merged %s\n", fragment)
+	}
+
+	if !*lint {
+		return nil
+	}
+	warnings := config.Lint(cfg)
+	for _, warning := range warnings {
+		fmt.Printf("warning: %s\n", warning)
+	}
+	if *strict && len(warnings) > 0 {
+		return fmt.Errorf("config has %d lint warning(s)", len(warnings))
+	}
 	return nil
 }
 
 func runReload(args []string) error {
-	flags := flag.NewFlagSet("reload", flag.ContinueOnError)
+	flags := manpage.NewFlagSet("reload")
 	socket := flags.String("socket", defaultSocketPath, "unix socket path")
 	if err := flags.Parse(args); err != nil {
 		return err
@@ -148,6 +185,22 @@ func runConfig(args []string) error {
 		return runConfigAddBot(subArgs)
 	case "remove-bot":
 		return runConfigRemoveBot(subArgs)
+	case "set-bot":
+		return runConfigSetBot(subArgs)
+	case "add-agent":
+		return runConfigAddAgent(subArgs)
+	case "set-agent":
+		return runConfigSetAgent(subArgs)
+	case "remove-agent":
+		return runConfigRemoveAgent(subArgs)
+	case "set":
+		return runConfigSet(subArgs)
+	case "unset":
+		return runConfigUnset(subArgs)
+	case "edit":
+		return runConfigEdit(subArgs)
+	case "schema":
+		return runConfigSchema(subArgs)
 	case "help", "-h", "--help":
 		printConfigUsage()
 		return nil
@@ -157,7 +210,7 @@ func runConfig(args []string) error {
 }
 
 func runConfigPrint(args []string) error {
-	flags := flag.NewFlagSet("config print", flag.ContinueOnError)
+	flags := manpage.NewFlagSet("config print")
 	configPath := flags.String("config", defaultConfigPath, "config path")
 	if err := flags.Parse(args); err != nil {
 		return err
@@ -174,11 +227,39 @@ func runConfigPrint(args []string) error {
 	}
 
 	fmt.Print(string(data))
+
+	fragments, err := config.Fragments(*configPath)
+	if err != nil {
+		return err
+	}
+	for _, fragment := range fragments {
+		fragmentData, err := os.ReadFile(fragment)
+		if err != nil {
+			return fmt.Errorf("read fragment: %w", err)
+		}
+		fmt.Printf("\n# --- %s ---\n%s", fragment, fragmentData)
+	}
+	return nil
+}
+
+// runConfigSchema prints the JSON Schema of the config file, for editors
+// to complete and check it.
+func runConfigSchema(args []string) error {
+	flags := manpage.NewFlagSet("config schema")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(config.Schema(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode schema: %w", err)
+	}
+	fmt.Println(string(data))
 	return nil
 }
 
 func runConfigListBots(args []string) error {
-	flags := flag.NewFlagSet("config list-bots", flag.ContinueOnError)
+	flags := manpage.NewFlagSet("config list-bots")
 	configPath := flags.String("config", defaultConfigPath, "config path")
 	jsonOut := flags.Bool("json", false, "output as JSON")
 	if err := flags.Parse(args); err != nil {
@@ -217,7 +298,7 @@ func runConfigListBots(args []string) error {
 }
 
 func runConfigSetServer(args []string) error {
-	flags := flag.NewFlagSet("config set-server", flag.ContinueOnError)
+	flags := manpage.NewFlagSet("config set-server")
 	configPath := flags.String("config", defaultConfigPath, "config path")
 	socket := flags.String("socket", "", "set server.socket_path")
 	db := flags.String("db", "", "set server.db_path")
@@ -229,26 +310,22 @@ func runConfigSetServer(args []string) error {
 	if strings.TrimSpace(*socket) == "" && strings.TrimSpace(*db) == "" && *history < 0 {
 		return errors.New("no changes requested: provide --socket, --db, and/or --history")
 	}
-
-	cfg, err := config.Load(*configPath)
-	if err != nil {
-		return err
+	if *history == 0 {
+		return errors.New("history must be > 0")
 	}
 
+	var settings []string
 	if strings.TrimSpace(*socket) != "" {
-		cfg.Server.SocketPath = strings.TrimSpace(*socket)
+		settings = append(settings, "server.socket_path="+*socket)
 	}
 	if strings.TrimSpace(*db) != "" {
-		cfg.Server.DBPath = strings.TrimSpace(*db)
+		settings = append(settings, "server.db_path="+*db)
 	}
-	if *history >= 0 {
-		if *history == 0 {
-			return errors.New("history must be > 0")
-		}
-		cfg.Server.HistorySize = *history
+	if *history > 0 {
+		settings = append(settings, "server.notification_history_size="+strconv.Itoa(*history))
 	}
 
-	if err := saveConfigValidated(*configPath, cfg); err != nil {
+	if err := editConfig(*configPath, settings, nil); err != nil {
 		return err
 	}
 
@@ -256,13 +333,67 @@ func runConfigSetServer(args []string) error {
 	return nil
 }
 
+func runConfigSet(args []string) error {
+	flags := manpage.NewFlagSet("config set")
+	configPath := flags.String("config", defaultConfigPath, "config path")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("provide at least one KEY=VALUE, e.g. ntfy.topic=alerts")
+	}
+
+	if err := editConfig(*configPath, flags.Args(), nil); err != nil {
+		return err
+	}
+
+	fmt.Printf("updated %s\n", *configPath)
+	return nil
+}
+
+func runConfigUnset(args []string) error {
+	flags := manpage.NewFlagSet("config unset")
+	configPath := flags.String("config", defaultConfigPath, "config path")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("provide at least one KEY, e.g. quiet_hours")
+	}
+
+	if err := editConfig(*configPath, nil, flags.Args()); err != nil {
+		return err
+	}
+
+	fmt.Printf("updated %s\n", *configPath)
+	return nil
+}
+
+func runConfigEdit(args []string) error {
+	flags := manpage.NewFlagSet("config edit")
+	configPath := flags.String("config", defaultConfigPath, "config path")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := editInEditor(*configPath); err != nil {
+		return err
+	}
+
+	fmt.Printf("updated %s\n", *configPath)
+	return nil
+}
+
 func runConfigAddBot(args []string) error {
-	flags := flag.NewFlagSet("config add-bot", flag.ContinueOnError)
+	flags := manpage.NewFlagSet("config add-bot")
 	configPath := flags.String("config", defaultConfigPath, "config path")
 	name := flags.String("name", "", "bot name")
 	botType := flags.String("type", "", "bot type (slack, discord, mattermost, telegram, whatsapp, irc, matrix, twilio, zulip, imessage)")
+	displayName := flags.String("display-name", "", "display_name")
 	botToken := flags.String("bot-token", "", "bot_token (literal or $ENV_VAR)")
 	appLevelToken := flags.String("app-level-token", "", "app_level_token (slack only)")
+	userToken := flags.String("user-token", "", "user_token for calls made as a user (slack only)")
+	signingSecret := flags.String("signing-secret", "", "signing_secret verifying webhook callbacks (slack with --transport webhook)")
 	accessToken := flags.String("access-token", "", "access_token (matrix only)")
 	transport := flags.String("transport", "", "custom transport (for non-built-in types)")
 	endpoint := flags.String("endpoint", "", "endpoint (required for mattermost/irc/matrix/zulip/custom)")
@@ -274,6 +405,8 @@ func runConfigAddBot(args []string) error {
 	botEmail := flags.String("bot-email", "", "bot_email (zulip only)")
 	dbPath := flags.String("db-path", "", "db_path (whatsapp/imessage only)")
 	password := flags.String("password", "", "password (irc only)")
+	var settings stringList
+	flags.Var(&settings, "set", "set any other bot setting, KEY=VALUE (repeatable)")
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
@@ -282,36 +415,56 @@ func runConfigAddBot(args []string) error {
 		return errors.New("--name and --type are required")
 	}
 
-	cfg, err := config.Load(*configPath)
+	_, merged, err := loadForEdit(*configPath)
 	if err != nil {
 		return err
 	}
 
-	for _, existingBot := range cfg.Bots {
+	for _, existingBot := range merged.Bots {
 		if existingBot.Name == strings.TrimSpace(*name) {
 			return fmt.Errorf("bot %q already exists", *name)
 		}
 	}
 
-	cfg.Bots = append(cfg.Bots, config.BotConfig{
-		Name:          strings.TrimSpace(*name),
-		Type:          strings.TrimSpace(*botType),
-		BotToken:      strings.TrimSpace(*botToken),
-		AppLevelToken: strings.TrimSpace(*appLevelToken),
-		AccessToken:   strings.TrimSpace(*accessToken),
-		Transport:     strings.TrimSpace(*transport),
-		Endpoint:      strings.TrimSpace(*endpoint),
-		Channels:      splitCSV(*channels),
-		AuthToken:     strings.TrimSpace(*authToken),
-		AccountSID:    strings.TrimSpace(*accountSID),
-		PhoneNumber:   strings.TrimSpace(*phoneNumber),
-		APIKey:        strings.TrimSpace(*apiKey),
-		BotEmail:      strings.TrimSpace(*botEmail),
-		DBPath:        strings.TrimSpace(*dbPath),
-		Password:      strings.TrimSpace(*password),
-	})
+	doc, err := loadConfigDoc(*configPath)
+	if err != nil {
+		return err
+	}
+
+	bot := newMapping()
+	for _, field := range []struct{ key, value string }{
+		{"name", *name},
+		{"type", *botType},
+		{"display_name", *displayName},
+		{"bot_token", *botToken},
+		{"app_level_token", *appLevelToken},
+		{"user_token", *userToken},
+		{"signing_secret", *signingSecret},
+		{"access_token", *accessToken},
+		{"transport", *transport},
+		{"endpoint", *endpoint},
+		{"auth_token", *authToken},
+		{"account_sid", *accountSID},
+		{"phone_number", *phoneNumber},
+		{"api_key", *apiKey},
+		{"bot_email", *botEmail},
+		{"db_path", *dbPath},
+		{"password", *password},
+	} {
+		if value := strings.TrimSpace(field.value); value != "" {
+			bot.Content = append(bot.Content, newString(field.key), newString(value))
+		}
+	}
+	if list := splitCSV(*channels); len(list) > 0 {
+		bot.Content = append(bot.Content, newString("channels"), newStringList(list))
+	}
+	if err := applySettings(bot, reflect.TypeFor[config.BotConfig](), settings, nil); err != nil {
+		return err
+	}
 
-	if err := saveConfigValidated(*configPath, cfg); err != nil {
+	bots := doc.list("bots")
+	bots.Content = append(bots.Content, bot)
+	if err := doc.save(); err != nil {
 		return err
 	}
 
@@ -319,10 +472,15 @@ func runConfigAddBot(args []string) error {
 	return nil
 }
 
-func runConfigRemoveBot(args []string) error {
-	flags := flag.NewFlagSet("config remove-bot", flag.ContinueOnError)
+func runConfigSetBot(args []string) error {
+	flags := manpage.NewFlagSet("config set-bot")
 	configPath := flags.String("config", defaultConfigPath, "config path")
 	name := flags.String("name", "", "bot name")
+	flags.String("channels", "", "replace channels (comma-separated)")
+	flags.String("display-name", "", "set display_name")
+	var settings, unset stringList
+	flags.Var(&settings, "set", "set a bot setting, KEY=VALUE (repeatable), e.g. quiet_hours.start=22:00")
+	flags.Var(&unset, "unset", "remove a bot setting, KEY (repeatable)")
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
@@ -331,31 +489,212 @@ func runConfigRemoveBot(args []string) error {
 		return errors.New("--name is required")
 	}
 
-	cfg, err := config.Load(*configPath)
+	var set []string
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "channels", "display-name":
+			set = append(set, strings.ReplaceAll(f.Name, "-", "_")+"="+f.Value.String())
+		}
+	})
+	set = append(set, settings...)
+	if len(set) == 0 && len(unset) == 0 {
+		return errors.New("no changes requested: provide --channels, --display-name, --set and/or --unset")
+	}
+
+	doc, bot, err := loadNamedEntry(*configPath, "bots", strings.TrimSpace(*name))
 	if err != nil {
 		return err
 	}
+	if err := applySettings(bot, reflect.TypeFor[config.BotConfig](), set, unset); err != nil {
+		return err
+	}
+	if err := doc.save(); err != nil {
+		return err
+	}
 
-	updated := make([]config.BotConfig, 0, len(cfg.Bots))
-	removed := false
-	for _, bot := range cfg.Bots {
-		if bot.Name == strings.TrimSpace(*name) {
-			removed = true
-			continue
+	fmt.Printf("updated bot %s\n", *name)
+	return nil
+}
+
+func runConfigRemoveBot(args []string) error {
+	return removeNamedEntry(args, "config remove-bot", "bots")
+}
+
+func runConfigAddAgent(args []string) error {
+	flags := manpage.NewFlagSet("config add-agent")
+	configPath := flags.String("config", defaultConfigPath, "config path")
+	name := flags.String("name", "", "agent name")
+	command := flags.String("command", "", "command to run, e.g. \"claude -p 'Handle the new messages'\"")
+	when := flags.String("when", "", "expr expression selecting events (default notify)")
+	var settings stringList
+	flags.Var(&settings, "set", "set any other agent setting, KEY=VALUE (repeatable), e.g. reply=true")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(*name) == "" || strings.TrimSpace(*command) == "" {
+		return errors.New("--name and --command are required")
+	}
+
+	_, merged, err := loadForEdit(*configPath)
+	if err != nil {
+		return err
+	}
+
+	for _, existing := range merged.Agents {
+		if existing.Name == strings.TrimSpace(*name) {
+			return fmt.Errorf("agent %q already exists", *name)
+		}
+	}
+
+	doc, err := loadConfigDoc(*configPath)
+	if err != nil {
+		return err
+	}
+
+	agent := newMapping()
+	agent.Content = append(agent.Content, newString("name"), newString(strings.TrimSpace(*name)))
+	if strings.TrimSpace(*when) != "" {
+		agent.Content = append(agent.Content, newString("when"), newString(strings.TrimSpace(*when)))
+	}
+	agent.Content = append(agent.Content, newString("command"), newString(strings.TrimSpace(*command)))
+	if err := applySettings(agent, reflect.TypeFor[config.AgentConfig](), settings, nil); err != nil {
+		return err
+	}
+
+	agents := doc.list("agents")
+	agents.Content = append(agents.Content, agent)
+	if err := doc.save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("added agent %s\n", *name)
+	return nil
+}
+
+func runConfigSetAgent(args []string) error {
+	flags := manpage.NewFlagSet("config set-agent")
+	configPath := flags.String("config", defaultConfigPath, "config path")
+	name := flags.String("name", "", "agent name")
+	flags.String("command", "", "replace the command")
+	flags.String("when", "", "replace the when expression")
+	var settings, unset stringList
+	flags.Var(&settings, "set", "set an agent setting, KEY=VALUE (repeatable), e.g. timeout=300")
+	flags.Var(&unset, "unset", "remove an agent setting, KEY (repeatable)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(*name) == "" {
+		return errors.New("--name is required")
+	}
+
+	var set []string
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "command", "when":
+			set = append(set, f.Name+"="+f.Value.String())
+		}
+	})
+	set = append(set, settings...)
+	if len(set) == 0 && len(unset) == 0 {
+		return errors.New("no changes requested: provide --command, --when, --set and/or --unset")
+	}
+
+	doc, agent, err := loadNamedEntry(*configPath, "agents", strings.TrimSpace(*name))
+	if err != nil {
+		return err
+	}
+	if err := applySettings(agent, reflect.TypeFor[config.AgentConfig](), set, unset); err != nil {
+		return err
+	}
+	if err := doc.save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("updated agent %s\n", *name)
+	return nil
+}
+
+func runConfigRemoveAgent(args []string) error {
+	return removeNamedEntry(args, "config remove-agent", "agents")
+}
+
+// editConfig applies settings given as yaml paths from the top of the config.
+func editConfig(path string, set []string, unset []string) error {
+	if _, _, err := loadForEdit(path); err != nil {
+		return err
+	}
+
+	doc, err := loadConfigDoc(path)
+	if err != nil {
+		return err
+	}
+	if err := applySettings(doc.top(), reflect.TypeFor[config.Config](), set, unset); err != nil {
+		return err
+	}
+	return doc.save()
+}
+
+// loadNamedEntry loads the main config for editing the entry called name
+// in its bots or agents list. Entries from config.d fragments can't be
+// edited here, and the error says where they are.
+func loadNamedEntry(path string, section string, name string) (*configDoc, *yaml.Node, error) {
+	_, merged, err := loadForEdit(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc, err := loadConfigDoc(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, entry := namedEntry(doc.list(section), name); entry != nil {
+		return doc, entry, nil
+	}
+
+	kind := strings.TrimSuffix(section, "s")
+	var names []string
+	switch section {
+	case "bots":
+		for _, bot := range merged.Bots {
+			names = append(names, bot.Name)
+		}
+	case "agents":
+		for _, a := range merged.Agents {
+			names = append(names, a.Name)
 		}
-		updated = append(updated, bot)
+	}
+	if slices.Contains(names, name) {
+		return nil, nil, fmt.Errorf("%s %q is defined in a fragment under %s; edit that file instead", kind, name, config.FragmentDir(path))
+	}
+	return nil, nil, fmt.Errorf("%s %q not found", kind, name)
+}
+
+func removeNamedEntry(args []string, command string, section string) error {
+	flags := manpage.NewFlagSet(command)
+	configPath := flags.String("config", defaultConfigPath, "config path")
+	name := flags.String("name", "", strings.TrimSuffix(section, "s")+" name")
+	if err := flags.Parse(args); err != nil {
+		return err
 	}
 
-	if !removed {
-		return fmt.Errorf("bot %q not found", *name)
+	if strings.TrimSpace(*name) == "" {
+		return errors.New("--name is required")
 	}
 
-	cfg.Bots = updated
-	if err := saveConfigValidated(*configPath, cfg); err != nil {
+	doc, _, err := loadNamedEntry(*configPath, section, strings.TrimSpace(*name))
+	if err != nil {
+		return err
+	}
+	list := doc.list(section)
+	index, _ := namedEntry(list, strings.TrimSpace(*name))
+	list.Content = slices.Delete(list.Content, index, index+1)
+	if err := doc.save(); err != nil {
 		return err
 	}
 
-	fmt.Printf("removed bot %s\n", *name)
+	fmt.Printf("removed %s %s\n", strings.TrimSuffix(section, "s"), *name)
 	return nil
 }
 
@@ -665,28 +1004,21 @@ func fileExists(path string) bool {
 	return err == nil
 }
 
-func saveConfigValidated(path string, cfg config.Config) error {
-	data, err := yaml.Marshal(cfg)
+// loadForEdit validates the merged config (main file plus config.d
+// fragments) and returns the main file on its own, which is the only file the
+// editing commands rewrite, along with the merged result.
+func loadForEdit(path string) (config.Config, config.Config, error) {
+	merged, err := config.Load(path)
 	if err != nil {
-		return fmt.Errorf("marshal config: %w", err)
+		return config.Config{}, config.Config{}, err
 	}
 
-	tmpPath := path + ".tmp"
-	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
-		return fmt.Errorf("write temp config: %w", err)
-	}
-
-	if _, err := config.Load(tmpPath); err != nil {
-		_ = os.Remove(tmpPath)
-		return fmt.Errorf("resulting config is invalid: %w", err)
-	}
-
-	if err := os.Rename(tmpPath, path); err != nil {
-		_ = os.Remove(tmpPath)
-		return fmt.Errorf("replace config: %w", err)
+	main, err := config.LoadMain(path)
+	if err != nil {
+		return config.Config{}, config.Config{}, err
 	}
 
-	return nil
+	return main, merged, nil
 }
 
 func call(socket string, request protocol.Request) (protocol.Response, error) {
@@ -808,12 +1140,18 @@ func printUsage() {
 
 Usage:
   pantalk setup [--output %s] [--force]
-  pantalk validate [--config %s]
+  pantalk validate [--config %s] [--lint [--strict]]
   pantalk reload [--socket %s]
-  pantalk pair --bot NAME [--config %s]
+  pantalk verify --bot NAME|--all [--config %s]
+  pantalk rotate-token --bot NAME --bot-token TOKEN [--config %s] [--socket PATH]
+  pantalk pair --bot NAME [--phone NUMBER] [--status] [--user USER] [--sso] [--config %s]
+  pantalk invite --bot NAME|--all [--client-id ID] [--config %s] [--json]
   pantalk config <subcommand> [options]
+  pantalk db fsck|migrate [--config %s] [--db PATH] [options]
+  pantalk service install|status|uninstall [--user] [options]
+  pantalk bench [--events-per-sec N] [--duration D] [--subscribers N] [--read-delay D] [--db PATH] [--json]
   pantalk help
-`, defaultConfigPath, defaultConfigPath, defaultSocketPath, defaultConfigPath)
+`, defaultConfigPath, defaultConfigPath, defaultSocketPath, defaultConfigPath, defaultConfigPath, defaultConfigPath, defaultConfigPath, defaultConfigPath)
 }
 
 func printConfigUsage() {
@@ -823,7 +1161,22 @@ Usage:
   pantalk config print [--config %s]
   pantalk config list-bots [--config %s] [--json]
   pantalk config set-server --config <path> [--socket ...] [--db ...] [--history ...]
-  pantalk config add-bot --config <path> --name <bot> --type <type> [--bot-token ...] [--app-level-token ...] [--access-token ...] [--endpoint ...] [--auth-token ...] [--account-sid ...] [--phone-number ...] [--api-key ...] [--bot-email ...] [--db-path ...] [--password ...] [--transport ...] [--channels a,b]
+  pantalk config add-bot --config <path> --name <bot> --type <type> [--bot-token ...] [--app-level-token ...] [--user-token ...] [--signing-secret ...] [--access-token ...] [--endpoint ...] [--auth-token ...] [--account-sid ...] [--phone-number ...] [--api-key ...] [--bot-email ...] [--db-path ...] [--password ...] [--transport ...] [--channels a,b] [--display-name ...] [--set KEY=VALUE ...]
+  pantalk config set-bot --config <path> --name <bot> [--channels a,b] [--display-name ...] [--set KEY=VALUE ...] [--unset KEY ...]
   pantalk config remove-bot --config <path> --name <bot>
-`, defaultConfigPath, defaultConfigPath)
+  pantalk config add-agent --config <path> --name <agent> --command <cmd> [--when <expr>] [--set KEY=VALUE ...]
+  pantalk config set-agent --config <path> --name <agent> [--command ...] [--when ...] [--set KEY=VALUE ...] [--unset KEY ...]
+  pantalk config remove-agent --config <path> --name <agent>
+  pantalk config set [--config %s] KEY=VALUE ...
+  pantalk config unset [--config %s] KEY ...
+  pantalk config edit [--config %s]
+  pantalk config schema
+
+Edits keep the file's comments and key order, and are validated before the
+file is replaced. Keys are YAML paths separated by dots, e.g. ntfy.topic or
+quiet_hours.start.
+
+schema prints a JSON Schema of the config file for editor completion and
+checks, e.g. pantalk config schema > ~/.config/pantalk/schema.json
+`, defaultConfigPath, defaultConfigPath, defaultConfigPath, defaultConfigPath, defaultConfigPath)
 }
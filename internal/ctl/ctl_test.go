@@ -4,12 +4,18 @@ import (
 	"bufio"
 	"encoding/json"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/user"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
 	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
 )
 
 func writeTestConfig(t *testing.T, content string) string {
@@ -169,3 +175,533 @@ bots:
 		t.Fatalf("json output must not include credentials: %q", output)
 	}
 }
+
+func TestRunConfigEdits_LeaveFragmentsAlone(t *testing.T) {
+	configPath := writeTestConfig(t, `
+bots:
+  - name: existing
+    type: discord
+    bot_token: discord-token
+`)
+	fragmentDir := config.FragmentDir(configPath)
+	if err := os.MkdirAll(fragmentDir, 0o755); err != nil {
+		t.Fatalf("create fragment dir: %v", err)
+	}
+	fragment := `
+bots:
+  - name: team-bot
+    type: telegram
+    bot_token: tok
+`
+	if err := os.WriteFile(filepath.Join(fragmentDir, "team.yaml"), []byte(fragment), 0o644); err != nil {
+		t.Fatalf("write fragment: %v", err)
+	}
+
+	err := runConfigAddBot([]string{"--config", configPath, "--name", "team-bot", "--type", "telegram", "--bot-token", "x"})
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected collision with fragment bot, got: %v", err)
+	}
+
+	if err := runConfigAddBot([]string{"--config", configPath, "--name", "new-bot", "--type", "telegram", "--bot-token", "x"}); err != nil {
+		t.Fatalf("add bot: %v", err)
+	}
+
+	main, err := config.LoadMain(configPath)
+	if err != nil {
+		t.Fatalf("load main: %v", err)
+	}
+	for _, bot := range main.Bots {
+		if bot.Name == "team-bot" {
+			t.Fatal("fragment bot was copied into the main config")
+		}
+	}
+
+	err = runConfigRemoveBot([]string{"--config", configPath, "--name", "team-bot"})
+	if err == nil || !strings.Contains(err.Error(), "fragment") {
+		t.Fatalf("expected remove-bot to point at the fragment, got: %v", err)
+	}
+}
+
+func TestRunConfigEdits_KeepComments(t *testing.T) {
+	configPath := writeTestConfig(t, `# pantalk config for the ops team
+server:
+  socket_path: /tmp/pantalk.sock # shared with the web UI
+
+# Bots
+bots:
+  - name: existing
+    type: discord
+    bot_token: discord-token # rotated monthly
+  - name: old
+    type: telegram
+    bot_token: tok
+`)
+
+	edits := [][]string{
+		{"add-bot", "--config", configPath, "--name", "new-bot", "--type", "telegram", "--bot-token", "$TELEGRAM_TOKEN"},
+		{"set-bot", "--config", configPath, "--name", "existing", "--channels", "123,456", "--set", "quiet_hours.start=22:00", "--set", "quiet_hours.end=07:00"},
+		{"remove-bot", "--config", configPath, "--name", "old"},
+		{"set", "--config", configPath, "server.notification_history_size=500"},
+	}
+	for _, args := range edits {
+		if err := runConfig(args); err != nil {
+			t.Fatalf("config %s: %v", args[0], err)
+		}
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+	for _, comment := range []string{"# pantalk config for the ops team", "# shared with the web UI", "# Bots", "# rotated monthly"} {
+		if !strings.Contains(string(data), comment) {
+			t.Errorf("comment %q was lost:\n%s", comment, data)
+		}
+	}
+
+	cfg, err := config.LoadMain(configPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if len(cfg.Bots) != 2 || cfg.Bots[0].Name != "existing" || cfg.Bots[1].Name != "new-bot" {
+		t.Fatalf("unexpected bots: %+v", cfg.Bots)
+	}
+	existing := cfg.Bots[0]
+	if strings.Join(existing.Channels, ",") != "123,456" {
+		t.Fatalf("unexpected channels: %q", existing.Channels)
+	}
+	if existing.QuietHours == nil || existing.QuietHours.Start != "22:00" || existing.QuietHours.End != "07:00" {
+		t.Fatalf("unexpected quiet hours: %+v", existing.QuietHours)
+	}
+	if cfg.Bots[1].BotToken != "$TELEGRAM_TOKEN" {
+		t.Fatalf("unexpected bot token: %q", cfg.Bots[1].BotToken)
+	}
+	if cfg.Server.HistorySize != 500 || cfg.Server.SocketPath != "/tmp/pantalk.sock" {
+		t.Fatalf("unexpected server config: %+v", cfg.Server)
+	}
+}
+
+func TestRunConfigAgents(t *testing.T) {
+	configPath := writeTestConfig(t, `
+bots:
+  - name: ops
+    type: discord
+    bot_token: discord-token
+`)
+
+	err := runConfigAddAgent([]string{"--config", configPath, "--name", "triage", "--command", "claude -p 'Triage: new messages'", "--when", "direct", "--set", "reply=true"})
+	if err != nil {
+		t.Fatalf("add agent: %v", err)
+	}
+	if err := runConfigAddAgent([]string{"--config", configPath, "--name", "triage", "--command", "claude"}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected duplicate agent error, got: %v", err)
+	}
+	if err := runConfigSetAgent([]string{"--config", configPath, "--name", "triage", "--set", "timeout=300", "--unset", "reply"}); err != nil {
+		t.Fatalf("set agent: %v", err)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if len(cfg.Agents) != 1 {
+		t.Fatalf("expected 1 agent, got %d", len(cfg.Agents))
+	}
+	triage := cfg.Agents[0]
+	if strings.Join(triage.Command, "|") != "claude|-p|Triage: new messages" {
+		t.Fatalf("unexpected command: %q", triage.Command)
+	}
+	if triage.When != "direct" || triage.Timeout != 300 || triage.Reply {
+		t.Fatalf("unexpected agent: %+v", triage)
+	}
+
+	err = runConfigSetAgent([]string{"--config", configPath, "--name", "triage", "--set", "timout=300"})
+	if err == nil || !strings.Contains(err.Error(), `unknown setting "timout"`) {
+		t.Fatalf("expected unknown setting error, got: %v", err)
+	}
+	err = runConfigSetAgent([]string{"--config", configPath, "--name", "triage", "--set", "timeout=soon"})
+	if err == nil {
+		t.Fatal("expected an error for a non-numeric timeout")
+	}
+
+	if err := runConfigRemoveAgent([]string{"--config", configPath, "--name", "triage"}); err != nil {
+		t.Fatalf("remove agent: %v", err)
+	}
+	if err := runConfigRemoveAgent([]string{"--config", configPath, "--name", "triage"}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+}
+
+func TestRunVerify(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/botgood-token/getMe":
+			_, _ = w.Write([]byte(`{"ok":true,"result":{"id":4242,"username":"ops_bot"}}`))
+		default:
+			http.Error(w, `{"ok":false,"description":"Unauthorized"}`, http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	configPath := writeTestConfig(t, `
+bots:
+  - name: good
+    type: telegram
+    bot_token: good-token
+    endpoint: `+srv.URL+`
+  - name: bad
+    type: telegram
+    bot_token: revoked-token
+    endpoint: `+srv.URL+`
+  - name: chat
+    type: irc
+    endpoint: irc.example.com:6697
+    channels: ["#ops"]
+`)
+
+	var err error
+	out := captureStdout(t, func() {
+		err = runVerify([]string{"--config", configPath, "--bot", "good"})
+	})
+	if err != nil {
+		t.Fatalf("verify good bot: %v", err)
+	}
+	if !strings.Contains(out, "ok   telegram/good: authenticated as ops_bot (4242)") {
+		t.Fatalf("unexpected output: %q", out)
+	}
+
+	out = captureStdout(t, func() {
+		err = runVerify([]string{"--config", configPath, "--all"})
+	})
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 bot(s) failed") {
+		t.Fatalf("expected one failure, got: %v", err)
+	}
+	if !strings.Contains(out, "FAIL telegram/bad: getMe failed: status 401") || !strings.Contains(out, "skip irc/chat") {
+		t.Fatalf("unexpected output: %q", out)
+	}
+
+	if err := runVerify([]string{"--config", configPath}); err == nil {
+		t.Fatal("expected an error without --bot or --all")
+	}
+	if err := runVerify([]string{"--config", configPath, "--bot", "missing"}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+}
+
+func TestRunInvite(t *testing.T) {
+	// A Discord token starts with the bot's ID in base64.
+	t.Setenv("TEST_DISCORD_TOKEN", "MTIzNDU2Nzg5MDEyMzQ1Njc4.GhIjKl.abcdef")
+	configPath := writeTestConfig(t, `
+bots:
+  - name: ops
+    type: slack
+    display_name: Ops Bot
+    bot_token: xoxb-test
+    app_level_token: xapp-test
+  - name: community
+    type: discord
+    bot_token: $TEST_DISCORD_TOKEN
+  - name: alerts
+    type: telegram
+    bot_token: "123:abc"
+`)
+
+	output := captureStdout(t, func() {
+		if err := runInvite([]string{"--config", configPath, "--all", "--json"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	var invites []invite
+	if err := json.Unmarshal([]byte(output), &invites); err != nil {
+		t.Fatalf("decode output %q: %v", output, err)
+	}
+	if len(invites) != 3 {
+		t.Fatalf("expected 3 invites, got %+v", invites)
+	}
+
+	slack := invites[0]
+	if slack.URL != "" || !strings.Contains(slack.Steps[0], "manifest_json=") || !strings.Contains(slack.Steps[0], "Ops+Bot") || !strings.Contains(slack.Steps[len(slack.Steps)-1], "/invite @Ops Bot") {
+		t.Errorf("unexpected slack invite %+v", slack)
+	}
+	discord := invites[1]
+	if !strings.HasPrefix(discord.URL, "https://discord.com/oauth2/authorize?") || !strings.Contains(discord.URL, "client_id=123456789012345678") || !strings.Contains(discord.URL, "permissions=309774634048") {
+		t.Errorf("unexpected discord invite URL %q", discord.URL)
+	}
+	if telegram := invites[2]; telegram.URL != "" || !strings.Contains(strings.Join(telegram.Steps, "\n"), "/setprivacy") {
+		t.Errorf("unexpected telegram invite %+v", telegram)
+	}
+
+	output = captureStdout(t, func() {
+		if err := runInvite([]string{"--config", configPath, "--bot", "ops", "--client-id", "123.456"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	if !strings.Contains(output, "https://slack.com/oauth/v2/authorize?client_id=123.456&scope=chat%3Awrite%2C") {
+		t.Errorf("expected the OAuth URL with --client-id, got %q", output)
+	}
+
+	if err := runInvite([]string{"--config", configPath}); err == nil || !strings.Contains(err.Error(), "--bot NAME or --all") {
+		t.Errorf("expected a missing bot error, got %v", err)
+	}
+}
+
+func TestRunDBFsck(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "pantalk.db")
+	st, err := store.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	if _, err := st.InsertNotification(protocol.Event{ID: 42, Service: "slack", Bot: "ops", Kind: "message", Direction: "in", Text: "orphan"}); err != nil {
+		t.Fatalf("insert notification: %v", err)
+	}
+	_ = st.Close()
+
+	var runErr error
+	output := captureStdout(t, func() {
+		runErr = runDBFsck([]string{"--db", dbPath})
+	})
+	if runErr == nil || !strings.Contains(runErr.Error(), "--repair") {
+		t.Fatalf("expected problems to fail the check, got %v", runErr)
+	}
+	if !strings.Contains(output, "orphaned notifications: 1") {
+		t.Fatalf("unexpected output: %q", output)
+	}
+
+	output = captureStdout(t, func() {
+		runErr = runDBFsck([]string{"--db", dbPath, "--repair"})
+	})
+	if runErr != nil || !strings.Contains(output, "deleted 1 orphaned notification(s)") {
+		t.Fatalf("expected repair to succeed, got %v: %q", runErr, output)
+	}
+
+	if err := runDBFsck([]string{"--db", filepath.Join(t.TempDir(), "missing.db")}); err == nil {
+		t.Fatal("expected error for a missing database")
+	}
+}
+
+func TestPairPhoneNumber(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  string
+		ok    bool
+	}{
+		{phone: "+1 (555) 123-4567", want: "15551234567", ok: true},
+		{phone: "447700900123", want: "447700900123", ok: true},
+		{phone: "+49.151.2345.6789", want: "4915123456789", ok: true},
+		{phone: "555-1234", ok: false},
+		{phone: "+1 555 CALL NOW", ok: false},
+		{phone: "", ok: false},
+	}
+	for _, tt := range tests {
+		got, err := pairPhoneNumber(tt.phone)
+		if tt.ok != (err == nil) || got != tt.want {
+			t.Errorf("pairPhoneNumber(%q) = %q, %v", tt.phone, got, err)
+		}
+	}
+}
+
+func TestRunPair_WhatsAppStatus(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "wa.db")
+	configPath := writeTestConfig(t, `
+bots:
+  - name: wa-bot
+    type: whatsapp
+    db_path: `+dbPath+`
+  - name: ops-bot
+    type: slack
+    bot_token: xoxb-test
+    app_level_token: xapp-test
+`)
+
+	var runErr error
+	output := captureStdout(t, func() {
+		runErr = runPair([]string{"--config", configPath, "--bot", "wa-bot", "--status"})
+	})
+	if runErr != nil {
+		t.Fatalf("status: %v", runErr)
+	}
+	if !strings.Contains(output, `bot "wa-bot" is not linked`) {
+		t.Fatalf("unexpected output: %q", output)
+	}
+	if _, err := os.Stat(dbPath); err == nil {
+		t.Fatal("status should not create the credential store")
+	}
+
+	err := runPair([]string{"--config", configPath, "--bot", "ops-bot", "--phone", "+15551234567"})
+	if err == nil || !strings.Contains(err.Error(), "only for whatsapp") {
+		t.Fatalf("expected --phone to be refused for slack, got %v", err)
+	}
+}
+
+func TestSystemdUnit(t *testing.T) {
+	unit := systemdUnit(serviceSpec{
+		RunAs:    "alice",
+		Pantalkd: "/opt/pantalk bin/pantalkd",
+		Pantalk:  "/usr/local/bin/pantalk",
+		Config:   "/home/alice/.config/pantalk/config.yaml",
+		Socket:   "/run/user/1000/pantalk.sock",
+		DB:       "/home/alice/.local/share/pantalk/pantalk.db",
+	})
+
+	for _, want := range []string{
+		"User=alice\n",
+		`ExecStart="/opt/pantalk bin/pantalkd" --config /home/alice/.config/pantalk/config.yaml --socket /run/user/1000/pantalk.sock --db /home/alice/.local/share/pantalk/pantalk.db` + "\n",
+		"ExecReload=/usr/local/bin/pantalk reload --socket /run/user/1000/pantalk.sock\n",
+		"Restart=on-failure\n",
+		"WantedBy=multi-user.target\n",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Fatalf("expected unit to contain %q, got:\n%s", want, unit)
+		}
+	}
+
+	userUnit := systemdUnit(serviceSpec{User: true, Pantalkd: "/bin/pantalkd"})
+	if strings.Contains(userUnit, "User=") || !strings.Contains(userUnit, "WantedBy=default.target\n") {
+		t.Fatalf("unexpected user unit:\n%s", userUnit)
+	}
+}
+
+func TestLaunchdPlist(t *testing.T) {
+	plist := launchdPlist(serviceSpec{
+		User:     true,
+		Pantalkd: "/usr/local/bin/pantalkd",
+		Config:   "/Users/a&b/config.yaml",
+		Socket:   "/tmp/pantalk.sock",
+		DB:       "/tmp/pantalk.db",
+		LogDir:   "/Users/a&b/Library/Logs/pantalk",
+	})
+
+	for _, want := range []string{
+		"<string>com.pantalk.pantalkd</string>",
+		"<string>/Users/a&amp;b/config.yaml</string>",
+		"<key>SuccessfulExit</key>\n\t\t<false/>",
+		"<string>/Users/a&amp;b/Library/Logs/pantalk/pantalkd.log</string>",
+	} {
+		if !strings.Contains(plist, want) {
+			t.Fatalf("expected plist to contain %q, got:\n%s", want, plist)
+		}
+	}
+	if strings.Contains(plist, "UserName") {
+		t.Fatalf("expected no UserName in a LaunchAgent, got:\n%s", plist)
+	}
+}
+
+func TestServiceInstallUninstallUser(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("systemd layout only")
+	}
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	pantalkd := filepath.Join(dir, "pantalkd")
+	if err := os.WriteFile(pantalkd, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatalf("write pantalkd: %v", err)
+	}
+	configPath := writeTestConfig(t, `
+server:
+  socket_path: /tmp/pantalk-test.sock
+  db_path: /tmp/pantalk-test.db
+bots:
+  - name: ops
+    type: slack
+    bot_token: xoxb-test
+    app_level_token: xapp-test
+`)
+
+	var commands []string
+	original := runCommand
+	runCommand = func(name string, args ...string) error {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		return nil
+	}
+	t.Cleanup(func() { runCommand = original })
+
+	captureStdout(t, func() {
+		if err := runService([]string{"install", "--user", "--config", configPath, "--pantalkd", pantalkd}); err != nil {
+			t.Fatalf("install: %v", err)
+		}
+	})
+
+	unitPath := filepath.Join(dir, "config", "systemd", "user", "pantalkd.service")
+	unit, err := os.ReadFile(unitPath)
+	if err != nil {
+		t.Fatalf("read unit: %v", err)
+	}
+	if !strings.Contains(string(unit), "ExecStart="+pantalkd+" --config "+configPath+" --socket /tmp/pantalk-test.sock --db /tmp/pantalk-test.db\n") {
+		t.Fatalf("unexpected unit:\n%s", unit)
+	}
+
+	captureStdout(t, func() {
+		if err := runService([]string{"uninstall", "--user"}); err != nil {
+			t.Fatalf("uninstall: %v", err)
+		}
+	})
+	if _, err := os.Stat(unitPath); !os.IsNotExist(err) {
+		t.Fatalf("expected unit to be removed, stat err = %v", err)
+	}
+
+	want := []string{
+		"systemctl --user daemon-reload",
+		"systemctl --user enable --now pantalkd.service",
+		"systemctl --user disable --now pantalkd.service",
+		"systemctl --user daemon-reload",
+	}
+	if strings.Join(commands, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected commands:\n%s", strings.Join(commands, "\n"))
+	}
+}
+
+func TestNewServiceSpec_SudoResolvesFromSudoUser(t *testing.T) {
+	account, err := user.Current()
+	if err != nil {
+		t.Skipf("no current user: %v", err)
+	}
+	// sudo leaves HOME pointing at root's home; the paths must come from
+	// the home of the user who ran it.
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SUDO_USER", account.Username)
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	configPath := writeTestConfig(t, `
+bots:
+  - name: ops
+    type: slack
+    bot_token: xoxb-test
+    app_level_token: xapp-test
+`)
+
+	spec, err := newServiceSpec(false, configPath, "/usr/local/bin/pantalkd")
+	if err != nil {
+		t.Fatalf("spec: %v", err)
+	}
+	if spec.RunAs != account.Username {
+		t.Fatalf("expected the service to run as %s, got %q", account.Username, spec.RunAs)
+	}
+	if want := filepath.Join(account.HomeDir, ".local", "share", "pantalk", "pantalk.db"); spec.DB != want {
+		t.Fatalf("expected db %s, got %s", want, spec.DB)
+	}
+	if want := "/tmp/pantalk-" + account.Uid + ".sock"; spec.Socket != want {
+		t.Fatalf("expected socket %s, got %s", want, spec.Socket)
+	}
+}
+
+func TestRunConfigEdits_KeepMode(t *testing.T) {
+	configPath := writeTestConfig(t, `bots:
+  - name: existing
+    type: discord
+    bot_token: discord-token
+`)
+	if err := os.Chmod(configPath, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runConfig([]string{"set", "--config", configPath, "server.notification_history_size=500"}); err != nil {
+		t.Fatalf("config set: %v", err)
+	}
+	info, err := os.Stat(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected the config to stay 0600, got %v", info.Mode().Perm())
+	}
+}
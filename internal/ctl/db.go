@@ -0,0 +1,157 @@
+package ctl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/manpage"
+	"github.com/pantalk/pantalk/internal/store"
+)
+
+func runDB(args []string) error {
+	if len(args) == 0 {
+		printDBUsage()
+		return nil
+	}
+
+	switch args[0] {
+	case "fsck":
+		return runDBFsck(args[1:])
+	case "migrate":
+		return runDBMigrate(args[1:])
+	case "help", "-h", "--help":
+		printDBUsage()
+		return nil
+	default:
+		return fmt.Errorf("unknown db command %q", args[0])
+	}
+}
+
+// runDBFsck checks the database for orphaned rows and corruption. It exits
+// non-zero while problems remain, so it can run from cron.
+func runDBFsck(args []string) error {
+	flags := manpage.NewFlagSet("db fsck")
+	configPath := flags.String("config", defaultConfigPath, "config path, for db_path")
+	dbPath := flags.String("db", "", "database path (overrides the config)")
+	repair := flags.Bool("repair", false, "delete orphaned rows and vacuum the database")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	path, err := resolveDBPath(*configPath, *dbPath)
+	if err != nil {
+		return err
+	}
+
+	st, err := store.Open(path)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	report, err := st.Fsck(*repair)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("checked %s\n", path)
+	fmt.Printf("  orphaned notifications: %d\n", report.OrphanNotifications)
+	if len(report.Integrity) == 0 {
+		fmt.Println("  integrity: ok")
+	}
+	for _, problem := range report.Integrity {
+		fmt.Printf("  integrity: %s\n", problem)
+	}
+	if report.Repaired > 0 {
+		fmt.Printf("deleted %d orphaned notification(s)\n", report.Repaired)
+	}
+	if report.Vacuumed {
+		fmt.Println("vacuumed the database")
+	}
+
+	switch {
+	case len(report.Integrity) > 0:
+		return errors.New("the database is corrupt - stop pantalkd and restore it from a backup")
+	case !report.Clean() && !*repair:
+		return errors.New("problems found - run again with --repair to fix them")
+	}
+	return nil
+}
+
+// runDBMigrate applies pending schema migrations, which pantalkd also does
+// when it opens the database, or lists them with --status.
+func runDBMigrate(args []string) error {
+	flags := manpage.NewFlagSet("db migrate")
+	configPath := flags.String("config", defaultConfigPath, "config path, for db_path")
+	dbPath := flags.String("db", "", "database path (overrides the config)")
+	status := flags.Bool("status", false, "list the migrations and when each was applied, without applying any")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	path, err := resolveDBPath(*configPath, *dbPath)
+	if err != nil {
+		return err
+	}
+
+	if *status {
+		migrations, err := store.SchemaStatus(path)
+		if err != nil {
+			return err
+		}
+		pending := 0
+		fmt.Printf("%s\n", path)
+		for _, m := range migrations {
+			applied := "pending"
+			if !m.AppliedAt.IsZero() {
+				applied = m.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			} else {
+				pending++
+			}
+			fmt.Printf("  %3d  %-19s  %s\n", m.Version, applied, m.Name)
+		}
+		if pending > 0 {
+			fmt.Printf("%d migration(s) pending; run pantalk db migrate or start pantalkd to apply them\n", pending)
+		}
+		return nil
+	}
+
+	applied, err := store.Migrate(path)
+	for _, m := range applied {
+		fmt.Printf("applied %d: %s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is at schema version %d\n", path, store.SchemaVersion())
+	return nil
+}
+
+// resolveDBPath returns the --db path, or else db_path from the config,
+// after checking the file exists.
+func resolveDBPath(configPath string, dbPath string) (string, error) {
+	path := strings.TrimSpace(dbPath)
+	if path == "" {
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			return "", fmt.Errorf("%w (use --db to open a database without a config)", err)
+		}
+		path = cfg.Server.DBPath
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("database %s: %w", path, err)
+	}
+	return path, nil
+}
+
+func printDBUsage() {
+	fmt.Printf(`pantalk db commands
+
+Usage:
+  pantalk db fsck [--config %s] [--db PATH] [--repair]
+  pantalk db migrate [--config %s] [--db PATH] [--status]
+`, defaultConfigPath, defaultConfigPath)
+}
@@ -0,0 +1,343 @@
+package ctl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/pantalk/pantalk/internal/config"
+)
+
+// configDoc is the main config file as a YAML node tree. The editing
+// commands change the nodes they touch and leave the rest alone, so
+// comments and key order survive a rewrite.
+type configDoc struct {
+	path string
+	root yaml.Node
+}
+
+func loadConfigDoc(path string) (*configDoc, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	doc := &configDoc{path: path}
+	if err := yaml.Unmarshal(data, &doc.root); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	if len(doc.root.Content) == 0 {
+		doc.root = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{newMapping()}}
+	}
+	if doc.top().Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: top level is not a mapping", path)
+	}
+	return doc, nil
+}
+
+func (d *configDoc) top() *yaml.Node {
+	return d.root.Content[0]
+}
+
+// list returns the top-level sequence under key, creating it if needed.
+func (d *configDoc) list(key string) *yaml.Node {
+	seq := mappingValue(d.top(), key)
+	if seq == nil || seq.Kind != yaml.SequenceNode {
+		seq = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		setMappingValue(d.top(), key, seq)
+	}
+	return seq
+}
+
+// save writes the document next to the config, validates it together with
+// the config.d fragments and only then replaces the config.
+func (d *configDoc) save() error {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&d.root); err != nil {
+		return fmt.Errorf("encode config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("encode config: %w", err)
+	}
+	return replaceConfig(d.path, buf.Bytes())
+}
+
+// replaceConfig validates data and swaps it in for the config at path,
+// keeping the file's mode: configs that hold tokens are often 0600.
+func replaceConfig(path string, data []byte) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, mode); err != nil {
+		return fmt.Errorf("write temp config: %w", err)
+	}
+	// WriteFile leaves the mode of a leftover temp file, and the umask
+	// applies to a new one.
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("write temp config: %w", err)
+	}
+
+	if _, err := config.Load(tmpPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("resulting config is invalid: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("replace config: %w", err)
+	}
+
+	return nil
+}
+
+func newMapping() *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+}
+
+func newString(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+func newStringList(values []string) *yaml.Node {
+	seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: yaml.FlowStyle}
+	for _, value := range values {
+		seq.Content = append(seq.Content, newString(value))
+	}
+	return seq
+}
+
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue replaces the value of key in m, keeping the comment at
+// the end of its line, or appends the key.
+func setMappingValue(m *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			if value.LineComment == "" {
+				value.LineComment = m.Content[i+1].LineComment
+			}
+			m.Content[i+1] = value
+			return
+		}
+	}
+	m.Content = append(m.Content, newString(key), value)
+}
+
+func deleteMappingKey(m *yaml.Node, key string) bool {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// namedEntry finds the mapping in seq whose name is name.
+func namedEntry(seq *yaml.Node, name string) (int, *yaml.Node) {
+	for i, entry := range seq.Content {
+		if entry.Kind != yaml.MappingNode {
+			continue
+		}
+		if value := mappingValue(entry, "name"); value != nil && value.Value == name {
+			return i, entry
+		}
+	}
+	return -1, nil
+}
+
+var unmarshalerType = reflect.TypeFor[yaml.Unmarshaler]()
+
+// settingType returns the type of the setting at path, yaml keys from t
+// down, or an error naming the first key t doesn't have.
+func settingType(t reflect.Type, path []string) (reflect.Type, error) {
+	for i, key := range path {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Map:
+			t = t.Elem()
+			continue
+		case reflect.Struct:
+		case reflect.Slice:
+			return nil, fmt.Errorf("%s is a list; set it whole or use config edit", strings.Join(path[:i], "."))
+		default:
+			return nil, fmt.Errorf("%s is not a section", strings.Join(path[:i], "."))
+		}
+
+		field, ok := yamlField(t, key)
+		if !ok {
+			return nil, fmt.Errorf("unknown setting %q", strings.Join(path[:i+1], "."))
+		}
+		t = field.Type
+	}
+	return t, nil
+}
+
+func yamlField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == key {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// settingNode turns a command-line value into a node for a setting of type
+// t. The value is read as YAML, except that text settings keep it as text
+// (a numeric channel ID stays a string) and a comma-separated value of a
+// list of text becomes the list.
+func settingNode(t reflect.Type, value string) (*yaml.Node, error) {
+	var parsed yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &parsed); err != nil {
+		return nil, fmt.Errorf("parse %q: %w", value, err)
+	}
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+	if len(parsed.Content) > 0 {
+		node = parsed.Content[0]
+	}
+
+	base := t
+	for base.Kind() == reflect.Pointer {
+		base = base.Elem()
+	}
+	switch {
+	case reflect.PointerTo(base).Implements(unmarshalerType):
+		// Decodes its own forms, e.g. an agent command as text or a list;
+		// anything but a list is taken as text.
+		if node.Kind != yaml.SequenceNode {
+			node = newString(value)
+		}
+	case base.Kind() == reflect.String && node.Kind == yaml.ScalarNode:
+		node = newString(value)
+	case base.Kind() == reflect.Slice && base.Elem().Kind() == reflect.String && node.Kind == yaml.ScalarNode && node.Tag != "!!null":
+		node = newStringList(splitCSV(value))
+	}
+
+	if err := node.Decode(reflect.New(t).Interface()); err != nil {
+		return nil, fmt.Errorf("value %q: %w", value, err)
+	}
+	return node, nil
+}
+
+// applySettings sets (KEY=VALUE) and unsets (KEY) settings of m, a mapping
+// for a value of type t. Keys are yaml paths separated by dots, such as
+// quiet_hours.start; missing sections are created.
+func applySettings(m *yaml.Node, t reflect.Type, set []string, unset []string) error {
+	for _, assignment := range set {
+		key, value, ok := strings.Cut(assignment, "=")
+		if !ok {
+			return fmt.Errorf("%q: expected KEY=VALUE", assignment)
+		}
+		path := strings.Split(strings.TrimSpace(key), ".")
+		valueType, err := settingType(t, path)
+		if err != nil {
+			return err
+		}
+		node, err := settingNode(valueType, strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+
+		parent := m
+		for _, section := range path[:len(path)-1] {
+			child := mappingValue(parent, section)
+			if child == nil || child.Kind != yaml.MappingNode {
+				child = newMapping()
+				setMappingValue(parent, section, child)
+			}
+			parent = child
+		}
+		setMappingValue(parent, path[len(path)-1], node)
+	}
+
+	for _, key := range unset {
+		path := strings.Split(strings.TrimSpace(key), ".")
+		if _, err := settingType(t, path); err != nil {
+			return err
+		}
+		parent := m
+		for _, section := range path[:len(path)-1] {
+			if parent = mappingValue(parent, section); parent == nil || parent.Kind != yaml.MappingNode {
+				break
+			}
+		}
+		if parent != nil && parent.Kind == yaml.MappingNode {
+			deleteMappingKey(parent, path[len(path)-1])
+		}
+	}
+	return nil
+}
+
+// stringList is a flag that may be given more than once.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// editInEditor opens a copy of the config in $EDITOR (vi by default) and
+// puts it in place once it validates. An invalid copy is kept so the edit
+// isn't lost.
+func editInEditor(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	editPath := filepath.Join(filepath.Dir(path), ".edit-"+filepath.Base(path))
+	if err := os.WriteFile(editPath, data, 0o600); err != nil {
+		return fmt.Errorf("write edit copy: %w", err)
+	}
+
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+	cmd := exec.Command(editor[0], append(editor[1:], editPath)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		_ = os.Remove(editPath)
+		return fmt.Errorf("run editor: %w", err)
+	}
+
+	edited, err := os.ReadFile(editPath)
+	if err != nil {
+		return fmt.Errorf("read edit copy: %w", err)
+	}
+	if bytes.Equal(edited, data) {
+		_ = os.Remove(editPath)
+		return errors.New("no changes made")
+	}
+	if err := replaceConfig(path, edited); err != nil {
+		return fmt.Errorf("%w (your edit is kept in %s)", err, editPath)
+	}
+	_ = os.Remove(editPath)
+	return nil
+}
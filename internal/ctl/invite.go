@@ -0,0 +1,238 @@
+package ctl
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/manpage"
+)
+
+// invite is what it takes to get one bot into a workspace, server or group.
+type invite struct {
+	Bot         string   `json:"bot"`
+	Type        string   `json:"type"`
+	URL         string   `json:"url,omitempty"`
+	Scopes      []string `json:"scopes,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	Steps       []string `json:"steps"`
+}
+
+// slackBotScopes and slackBotEvents are the Slack app settings from
+// docs/slack-setup.md.
+var (
+	slackBotScopes = []string{"chat:write", "channels:history", "app_mentions:read", "groups:history", "im:history", "chat:write.customize", "users:read"}
+	slackBotEvents = []string{"app_mention", "message.channels", "message.groups", "message.im"}
+)
+
+// discordPermissions are the permissions the invite asks for, as named in
+// the Discord developer portal.
+var discordPermissions = []struct {
+	name string
+	bit  int64
+}{
+	{"View Channels", discordgo.PermissionViewChannel},
+	{"Send Messages", discordgo.PermissionSendMessages},
+	{"Read Message History", discordgo.PermissionReadMessageHistory},
+	{"Add Reactions", discordgo.PermissionAddReactions},
+	{"Attach Files", discordgo.PermissionAttachFiles},
+	{"Embed Links", discordgo.PermissionEmbedLinks},
+	{"Create Public Threads", discordgo.PermissionCreatePublicThreads},
+	{"Send Messages in Threads", discordgo.PermissionSendMessagesInThreads},
+	{"Manage Webhooks", discordgo.PermissionManageWebhooks},
+}
+
+// runInvite prints how to install each bot on its platform: the Slack app
+// manifest and OAuth URL, the Discord invite URL with its permissions, or
+// the @BotFather steps for Telegram.
+func runInvite(args []string) error {
+	flags := manpage.NewFlagSet("invite")
+	configPath := flags.String("config", defaultConfigPath, "config path")
+	botName := flags.String("bot", "", "bot to invite")
+	all := flags.Bool("all", false, "print invites for every bot")
+	clientID := flags.String("client-id", "", "OAuth client ID: Slack's from Basic Information, or the Discord application ID when it can't be read from the token")
+	jsonOut := flags.Bool("json", false, "output as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if (strings.TrimSpace(*botName) == "") == !*all {
+		return errors.New("provide either --bot NAME or --all")
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return err
+	}
+
+	var invites []invite
+	for _, bot := range cfg.Bots {
+		if *all || bot.Name == strings.TrimSpace(*botName) {
+			invites = append(invites, inviteFor(cfg, bot, strings.TrimSpace(*clientID)))
+		}
+	}
+	if len(invites) == 0 {
+		return fmt.Errorf("bot %q not found", *botName)
+	}
+
+	if *jsonOut {
+		return json.NewEncoder(os.Stdout).Encode(invites)
+	}
+	for i, inv := range invites {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s/%s\n", inv.Type, inv.Bot)
+		if inv.URL != "" {
+			fmt.Printf("  %s\n", inv.URL)
+		}
+		if len(inv.Scopes) > 0 {
+			fmt.Printf("  scopes: %s\n", strings.Join(inv.Scopes, ", "))
+		}
+		if len(inv.Permissions) > 0 {
+			fmt.Printf("  permissions: %s\n", strings.Join(inv.Permissions, ", "))
+		}
+		for n, step := range inv.Steps {
+			fmt.Printf("  %d. %s\n", n+1, step)
+		}
+	}
+	return nil
+}
+
+func inviteFor(cfg config.Config, bot config.BotConfig, clientID string) invite {
+	inv := invite{Bot: bot.Name, Type: bot.Type}
+	switch bot.Type {
+	case "slack":
+		inv.Scopes = slackBotScopes
+		inv.Steps = []string{"Create the app with pantalk's scopes and events: " + slackManifestURL(bot, cfg.WebhookURL(bot))}
+		if bot.Transport == config.TransportWebhook {
+			inv.Steps = append(inv.Steps,
+				"Under Basic Information > App Credentials, copy the Signing Secret for signing_secret.",
+				"With pantalkd running, open Event Subscriptions and click Retry next to the request URL if Slack hasn't verified it yet.")
+		} else {
+			inv.Steps = append(inv.Steps, "Under Basic Information > App-Level Tokens, generate a token with connections:write for app_level_token.")
+		}
+		if clientID != "" {
+			inv.URL = "https://slack.com/oauth/v2/authorize?" + url.Values{
+				"client_id": {clientID},
+				"scope":     {strings.Join(slackBotScopes, ",")},
+			}.Encode()
+			inv.Steps = append(inv.Steps, "Open the URL above to install the app and copy the Bot User OAuth Token (xoxb-...) for bot_token.")
+		} else {
+			inv.Steps = append(inv.Steps, "Under OAuth & Permissions, click Install to Workspace and copy the Bot User OAuth Token (xoxb-...) for bot_token.")
+		}
+		inv.Steps = append(inv.Steps, "In each channel the bot should follow, type /invite @"+displayName(bot)+".")
+
+	case "discord":
+		var names []string
+		var bits int64
+		for _, p := range discordPermissions {
+			names = append(names, p.name)
+			bits |= p.bit
+		}
+		inv.Scopes = []string{"bot"}
+		inv.Permissions = names
+
+		appID := clientID
+		if appID == "" {
+			appID = discordApplicationID(bot.BotToken)
+		}
+		if appID != "" {
+			inv.URL = "https://discord.com/oauth2/authorize?" + url.Values{
+				"client_id":   {appID},
+				"scope":       {"bot"},
+				"permissions": {strconv.FormatInt(bits, 10)},
+			}.Encode()
+			inv.Steps = append(inv.Steps, "Open the URL above, pick the server and click Authorize.")
+		} else {
+			inv.Steps = append(inv.Steps, "Pass --client-id with the Application ID from the developer portal's General Information page to get the invite URL.")
+		}
+		inv.Steps = append(inv.Steps, "Under Bot > Privileged Gateway Intents, turn on Message Content Intent, or message text arrives empty.")
+
+	case "telegram":
+		inv.Steps = []string{
+			"Message @BotFather: /newbot gives the bot_token (skip if you have one).",
+			"Send /setprivacy, pick the bot and choose Disable, so it sees every group message rather than only commands and replies.",
+			"Send /setjoingroups and choose Enable.",
+			"Add it to a group with https://t.me/BOT_USERNAME?startgroup=true, BOT_USERNAME being the name BotFather gave it (pantalk verify --bot " + bot.Name + " prints it). Remove and re-add it to groups it joined before privacy was disabled.",
+		}
+		if bot.Transport == config.TransportWebhook {
+			inv.Steps = append(inv.Steps, "pantalkd registers the webhook "+cfg.WebhookURL(bot)+" itself; Telegram only delivers to HTTPS on port 443, 80, 88 or 8443.")
+		}
+
+	default:
+		inv.Steps = []string{fmt.Sprintf("There is no invite link for %s bots; see docs/%s-setup.md.", bot.Type, bot.Type)}
+	}
+	return inv
+}
+
+// slackManifestURL opens Slack's "create app" dialog prefilled with a
+// manifest for bot: socket mode, or the webhook URL for transport:
+// webhook, the bot scopes and the events pantalk listens to.
+func slackManifestURL(bot config.BotConfig, webhookURL string) string {
+	name := displayName(bot)
+	manifest := map[string]any{
+		"display_information": map[string]any{"name": name},
+		"features": map[string]any{
+			"bot_user": map[string]any{"display_name": name, "always_online": true},
+		},
+		"oauth_config": map[string]any{
+			"scopes": map[string]any{"bot": slackBotScopes},
+		},
+		"settings": map[string]any{
+			"event_subscriptions": map[string]any{"bot_events": slackBotEvents},
+			"socket_mode_enabled": true,
+		},
+	}
+	if bot.Transport == config.TransportWebhook {
+		settings := manifest["settings"].(map[string]any)
+		settings["socket_mode_enabled"] = false
+		settings["event_subscriptions"].(map[string]any)["request_url"] = webhookURL
+		settings["interactivity"] = map[string]any{"is_enabled": true, "request_url": webhookURL}
+	}
+	data, _ := json.Marshal(manifest)
+	return "https://api.slack.com/apps?" + url.Values{"new_app": {"1"}, "manifest_json": {string(data)}}.Encode()
+}
+
+func displayName(bot config.BotConfig) string {
+	if bot.DisplayName != "" {
+		return bot.DisplayName
+	}
+	return bot.Name
+}
+
+// discordApplicationID reads the bot's user ID, which is its application's
+// ID, from the first part of a Discord bot token. It returns "" when the
+// token can't be resolved or doesn't have that shape.
+func discordApplicationID(token string) string {
+	if strings.TrimSpace(token) == "" {
+		return ""
+	}
+	resolved, err := config.ResolveCredential(token)
+	if err != nil {
+		return ""
+	}
+	first, _, ok := strings.Cut(strings.TrimPrefix(resolved, "Bot "), ".")
+	if !ok {
+		return ""
+	}
+	decoded, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(first, "="))
+	if err != nil {
+		decoded, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(first, "="))
+		if err != nil {
+			return ""
+		}
+	}
+	if _, err := strconv.ParseUint(string(decoded), 10, 64); err != nil {
+		return ""
+	}
+	return string(decoded)
+}
@@ -2,8 +2,9 @@ package ctl
 
 import (
 	"context"
-	"flag"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -13,22 +14,27 @@ import (
 	"github.com/mdp/qrterminal/v3"
 
 	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store"
 	"go.mau.fi/whatsmeow/store/sqlstore"
 	waLog "go.mau.fi/whatsmeow/util/log"
 
 	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/manpage"
 	"github.com/pantalk/pantalk/internal/protocol"
 )
 
-// runPair performs interactive WhatsApp QR-code pairing. It opens the
-// whatsmeow store directly (no running daemon required), displays the QR
-// code in the terminal, waits for the user to scan it, persists the
-// credentials into SQLite, and exits. The daemon can then connect using
-// the stored credentials.
+// runPair performs interactive login for bots that can't be configured
+// with a static credential: WhatsApp QR-code or phone-number pairing and
+// Matrix password or SSO login. It works directly against the bot's credential store (no
+// running daemon required) and asks the daemon to reload afterwards.
 func runPair(args []string) error {
-	flags := flag.NewFlagSet("pair", flag.ContinueOnError)
+	flags := manpage.NewFlagSet("pair")
 	configPath := flags.String("config", defaultConfigPath, "path to pantalk config")
-	botName := flags.String("bot", "", "name of the whatsapp bot to pair")
+	botName := flags.String("bot", "", "name of the whatsapp or matrix bot to pair")
+	user := flags.String("user", "", "matrix user to log in as (password login)")
+	sso := flags.Bool("sso", false, "matrix: log in through the homeserver's SSO page in a browser")
+	phone := flags.String("phone", "", "whatsapp: link with a pairing code entered on this phone number instead of a QR code")
+	status := flags.Bool("status", false, "whatsapp: report whether the bot is linked instead of pairing")
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
@@ -52,36 +58,145 @@ func runPair(args []string) error {
 	if bot == nil {
 		return fmt.Errorf("bot %q not found in config", *botName)
 	}
-	if bot.Type != "whatsapp" {
-		return fmt.Errorf("bot %q is type %q - pair is only for whatsapp bots", *botName, bot.Type)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if bot.Type != "whatsapp" && (*phone != "" || *status) {
+		return fmt.Errorf("--phone and --status are only for whatsapp bots")
+	}
+	if *status {
+		return whatsAppLinkStatus(ctx, *bot)
 	}
 
+	switch bot.Type {
+	case "whatsapp":
+		err = pairWhatsApp(ctx, *bot, *phone)
+	case "matrix":
+		err = pairMatrix(ctx, *bot, *user, *sso)
+	default:
+		return fmt.Errorf("bot %q is type %q - pair is only for whatsapp and matrix bots", *botName, bot.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Try to reload the daemon so it picks up credentials immediately.
+	// This is best-effort - the daemon may not be running yet.
+	socketPath := cfg.Server.SocketPath
+	if socketPath == "" {
+		socketPath = defaultSocketPath
+	}
+	resp, err := call(socketPath, protocol.Request{Action: protocol.ActionReload})
+	if err == nil && resp.OK {
+		fmt.Fprintln(os.Stderr, "daemon reloaded - connecting now")
+	}
+
+	return nil
+}
+
+// whatsAppDBPath returns the bot's whatsmeow store, creating its directory.
+func whatsAppDBPath(bot config.BotConfig) (string, error) {
 	dbPath := strings.TrimSpace(bot.DBPath)
 	if dbPath == "" {
 		dataDir := filepath.Dir(config.DefaultDBPath())
 		dbPath = filepath.Join(dataDir, fmt.Sprintf("whatsapp-%s.db", bot.Name))
 	}
 	if err := config.EnsureDir(dbPath); err != nil {
-		return fmt.Errorf("create data dir: %w", err)
+		return "", fmt.Errorf("create data dir: %w", err)
 	}
+	return dbPath, nil
+}
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
-	defer cancel()
-
-	logger := waLog.Stdout("WhatsApp", "ERROR", true)
+func openWhatsAppDevice(ctx context.Context, dbPath string, logger waLog.Logger) (*store.Device, error) {
 	dsn := fmt.Sprintf("file:%s?_foreign_keys=on", dbPath)
 	container, err := sqlstore.New(ctx, "sqlite3", dsn, logger)
 	if err != nil {
-		return fmt.Errorf("open whatsapp store: %w", err)
+		return nil, fmt.Errorf("open whatsapp store: %w", err)
 	}
-
 	device, err := container.GetFirstDevice(ctx)
 	if err != nil {
-		return fmt.Errorf("get device: %w", err)
+		return nil, fmt.Errorf("get device: %w", err)
+	}
+	return device, nil
+}
+
+// describeWhatsAppLink names the account a linked device belongs to.
+func describeWhatsAppLink(device *store.Device) string {
+	text := fmt.Sprintf("+%s (jid=%s", device.ID.User, device.ID.String())
+	if device.PushName != "" {
+		text += ", name=" + device.PushName
+	}
+	return text + ")"
+}
+
+// whatsAppLinkStatus reports whether the bot's store holds a linked device.
+func whatsAppLinkStatus(ctx context.Context, bot config.BotConfig) error {
+	dbPath, err := whatsAppDBPath(bot)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dbPath); errors.Is(err, fs.ErrNotExist) {
+		fmt.Printf("bot %q is not linked - run: pantalk pair --bot %s\n", bot.Name, bot.Name)
+		return nil
+	}
+	device, err := openWhatsAppDevice(ctx, dbPath, waLog.Noop)
+	if err != nil {
+		return err
+	}
+	if device.ID == nil {
+		fmt.Printf("bot %q is not linked - run: pantalk pair --bot %s\n", bot.Name, bot.Name)
+		return nil
+	}
+	fmt.Printf("bot %q is linked as %s\n", bot.Name, describeWhatsAppLink(device))
+	fmt.Printf("credentials: %s\n", dbPath)
+	return nil
+}
+
+// pairPhoneNumber normalizes a phone number for whatsmeow's pairing code
+// request: the international number as digits only.
+func pairPhoneNumber(phone string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9':
+			return r
+		case r == '+' || r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+			return -1
+		default:
+			return 'x'
+		}
+	}, phone)
+	if strings.Contains(digits, "x") || len(digits) < 8 || len(digits) > 15 {
+		return "", fmt.Errorf("invalid phone number %q - use the international format, e.g. +15551234567", phone)
+	}
+	return digits, nil
+}
+
+// pairWhatsApp links the bot as a WhatsApp companion device, either by
+// showing a QR code in the terminal or, with phone set, a pairing code to
+// enter on that phone, and persists the credentials into the bot's SQLite
+// store.
+func pairWhatsApp(ctx context.Context, bot config.BotConfig, phone string) error {
+	if phone != "" {
+		var err error
+		if phone, err = pairPhoneNumber(phone); err != nil {
+			return err
+		}
+	}
+
+	dbPath, err := whatsAppDBPath(bot)
+	if err != nil {
+		return err
+	}
+
+	logger := waLog.Stdout("WhatsApp", "ERROR", true)
+	device, err := openWhatsAppDevice(ctx, dbPath, logger)
+	if err != nil {
+		return err
 	}
 
 	if device.ID != nil {
-		fmt.Fprintf(os.Stderr, "bot %q is already paired (jid=%s)\n", *botName, device.ID.String())
+		fmt.Fprintf(os.Stderr, "bot %q is already linked as %s\n", bot.Name, describeWhatsAppLink(device))
 		fmt.Fprintf(os.Stderr, "to re-pair, delete %s and run this command again\n", dbPath)
 		return nil
 	}
@@ -94,10 +209,13 @@ func runPair(args []string) error {
 	}
 	defer client.Disconnect()
 
-	fmt.Fprintln(os.Stderr, "scan this QR code with WhatsApp on your phone:")
-	fmt.Fprintln(os.Stderr, "(Settings → Linked Devices → Link a Device)")
-	fmt.Fprintln(os.Stderr)
+	if phone == "" {
+		fmt.Fprintln(os.Stderr, "scan this QR code with WhatsApp on your phone:")
+		fmt.Fprintln(os.Stderr, "(Settings → Linked Devices → Link a Device)")
+		fmt.Fprintln(os.Stderr)
+	}
 
+	codeShown := false
 	for evt := range qrChan {
 		select {
 		case <-ctx.Done():
@@ -106,28 +224,51 @@ func runPair(args []string) error {
 		}
 
 		switch evt.Event {
-		case "code":
-			qrterminal.GenerateHalfBlock(evt.Code, qrterminal.L, os.Stderr)
+		case whatsmeow.QRChannelEventCode:
+			if phone == "" {
+				qrterminal.GenerateHalfBlock(evt.Code, qrterminal.L, os.Stderr)
+				fmt.Fprintln(os.Stderr)
+				fmt.Fprintln(os.Stderr, "waiting for scan...")
+				continue
+			}
+			// The first QR event means the login socket is ready for a
+			// pairing code request; later ones are ignored.
+			if codeShown {
+				continue
+			}
+			code, err := client.PairPhone(ctx, phone, true, whatsmeow.PairClientChrome, "Chrome (Linux)")
+			if err != nil {
+				return fmt.Errorf("request pairing code: %w", err)
+			}
+			codeShown = true
+			fmt.Fprintf(os.Stderr, "pairing code: %s\n\n", code)
+			fmt.Fprintln(os.Stderr, "on the phone with +"+phone+", open WhatsApp and go to")
+			fmt.Fprintln(os.Stderr, "Settings → Linked Devices → Link a Device → Link with phone number instead,")
+			fmt.Fprintln(os.Stderr, "then enter the code above.")
 			fmt.Fprintln(os.Stderr)
-			fmt.Fprintln(os.Stderr, "waiting for scan...")
+			fmt.Fprintln(os.Stderr, "waiting for the phone...")
 		case "success":
 			fmt.Fprintln(os.Stderr)
-			fmt.Fprintf(os.Stderr, "paired successfully! credentials saved to %s\n", dbPath)
-
-			// Try to reload the daemon so it picks up credentials immediately.
-			// This is best-effort - the daemon may not be running yet.
-			socketPath := cfg.Server.SocketPath
-			if socketPath == "" {
-				socketPath = defaultSocketPath
+			if client.Store.ID != nil {
+				fmt.Fprintf(os.Stderr, "linked as %s\n", describeWhatsAppLink(client.Store))
 			}
-			resp, err := call(socketPath, protocol.Request{Action: protocol.ActionReload})
-			if err == nil && resp.OK {
-				fmt.Fprintln(os.Stderr, "daemon reloaded - connecting now")
-			}
-
+			fmt.Fprintf(os.Stderr, "paired successfully! credentials saved to %s\n", dbPath)
 			return nil
 		case "timeout":
+			if phone != "" {
+				return fmt.Errorf("pairing code expired - run this command again to retry")
+			}
 			return fmt.Errorf("QR code timed out - run this command again to retry")
+		case whatsmeow.QRChannelEventError:
+			return fmt.Errorf("pairing failed: %w", evt.Error)
+		case "err-client-outdated":
+			return fmt.Errorf("pairing rejected: WhatsApp reports this client as outdated - update pantalk")
+		case "err-scanned-without-multidevice":
+			return fmt.Errorf("pairing failed: enable multi-device on the phone and try again")
+		default:
+			if strings.HasPrefix(evt.Event, "err-") {
+				return fmt.Errorf("pairing failed: %s", evt.Event)
+			}
 		}
 	}
 
@@ -0,0 +1,165 @@
+package ctl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+// ssoLoginTimeout bounds how long pair waits for the browser to come back
+// from the homeserver's SSO page.
+const ssoLoginTimeout = 5 * time.Minute
+
+// pairMatrix logs a Matrix bot in with a password or through SSO and stores
+// the session, including the refresh token, where the connector reads it.
+func pairMatrix(ctx context.Context, bot config.BotConfig, user string, sso bool) error {
+	homeserver := strings.TrimSpace(bot.Endpoint)
+	path := upstream.MatrixSessionPath(bot)
+
+	if strings.TrimSpace(bot.AccessToken) != "" {
+		fmt.Fprintf(os.Stderr, "note: bot %q has a static access_token, which takes precedence - remove it from the config to use this login\n", bot.Name)
+	}
+
+	flows, err := upstream.MatrixLoginFlows(ctx, homeserver)
+	if err != nil {
+		return err
+	}
+	hasPassword := containsFlow(flows, "m.login.password")
+	hasSSO := containsFlow(flows, "m.login.sso")
+
+	var session *upstream.MatrixSession
+	switch {
+	case sso || (!hasPassword && hasSSO):
+		if !hasSSO {
+			return fmt.Errorf("%s does not offer SSO login (flows: %s)", homeserver, strings.Join(flows, ", "))
+		}
+		session, err = matrixSSOLogin(ctx, homeserver)
+	case hasPassword:
+		session, err = matrixPasswordLogin(ctx, bot, homeserver, user)
+	default:
+		return fmt.Errorf("%s offers no supported login flow (flows: %s)", homeserver, strings.Join(flows, ", "))
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := upstream.SaveMatrixSession(path, session); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "logged in as %s (device %s); credentials saved to %s\n", session.UserID, session.DeviceID, path)
+	if session.RefreshToken != "" && !session.ExpiresAt.IsZero() {
+		fmt.Fprintf(os.Stderr, "the access token expires at %s and is refreshed automatically\n", session.ExpiresAt.Local().Format(time.RFC3339))
+	}
+	return nil
+}
+
+func matrixPasswordLogin(ctx context.Context, bot config.BotConfig, homeserver string, user string) (*upstream.MatrixSession, error) {
+	reader := bufio.NewReader(os.Stdin)
+
+	user = strings.TrimSpace(user)
+	if user == "" {
+		fmt.Fprint(os.Stderr, "matrix user: ")
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("read user: %w", err)
+		}
+		user = strings.TrimSpace(line)
+		if user == "" {
+			return nil, fmt.Errorf("user is required")
+		}
+	}
+
+	// A password in the config (usually $ENV) allows unattended logins.
+	var password string
+	if strings.TrimSpace(bot.Password) != "" {
+		resolved, err := config.ResolveCredential(bot.Password)
+		if err != nil {
+			return nil, fmt.Errorf("resolve password for bot %q: %w", bot.Name, err)
+		}
+		password = resolved
+	} else {
+		fmt.Fprint(os.Stderr, "password: ")
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			raw, err := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Fprintln(os.Stderr)
+			if err != nil {
+				return nil, fmt.Errorf("read password: %w", err)
+			}
+			password = string(raw)
+		} else {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return nil, fmt.Errorf("read password: %w", err)
+			}
+			password = strings.TrimRight(line, "\r\n")
+		}
+	}
+
+	return upstream.MatrixPasswordLogin(ctx, homeserver, user, password)
+}
+
+// matrixSSOLogin sends the user to the homeserver's SSO page and waits on a
+// loopback listener for the redirect carrying the login token.
+func matrixSSOLogin(ctx context.Context, homeserver string) (*upstream.MatrixSession, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("listen for sso redirect: %w", err)
+	}
+	defer listener.Close()
+
+	redirect := fmt.Sprintf("http://%s/callback", listener.Addr().String())
+	tokens := make(chan string, 1)
+
+	server := &http.Server{
+		ReadHeaderTimeout: 10 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.URL.Query().Get("loginToken")
+			if r.URL.Path != "/callback" || token == "" {
+				http.Error(w, "missing loginToken", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintln(w, "pantalk: login received, you can close this tab.")
+			select {
+			case tokens <- token:
+			default:
+			}
+		}),
+	}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	fmt.Fprintln(os.Stderr, "open this URL in a browser to log in:")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "  "+upstream.MatrixSSOURL(homeserver, redirect))
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "waiting for login...")
+
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("interrupted")
+	case <-time.After(ssoLoginTimeout):
+		return nil, fmt.Errorf("sso login timed out - run this command again to retry")
+	case token := <-tokens:
+		return upstream.MatrixTokenLogin(ctx, homeserver, token)
+	}
+}
+
+func containsFlow(flows []string, want string) bool {
+	for _, flow := range flows {
+		if flow == want {
+			return true
+		}
+	}
+	return false
+}
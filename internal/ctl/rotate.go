@@ -0,0 +1,81 @@
+package ctl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pantalk/pantalk/internal/manpage"
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// runRotateToken writes a bot's new bot_token into the config and reloads
+// the daemon, which hands the token to the running connector where it can
+// (Slack, Mattermost, Telegram) and restarts only that bot elsewhere. When
+// the daemon rejects the token the config is put back.
+func runRotateToken(args []string) error {
+	flags := manpage.NewFlagSet("rotate-token")
+	configPath := flags.String("config", defaultConfigPath, "config path")
+	socket := flags.String("socket", "", "unix socket path (default: the config's socket_path)")
+	botName := flags.String("bot", "", "bot whose token to replace")
+	token := flags.String("bot-token", "", "new bot token, literal or an env reference like '$SLACK_BOT_TOKEN'")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	name := strings.TrimSpace(*botName)
+	if name == "" || strings.TrimSpace(*token) == "" {
+		return errors.New("--bot and --bot-token are required")
+	}
+
+	_, merged, err := loadForEdit(*configPath)
+	if err != nil {
+		return err
+	}
+	for _, bot := range merged.Bots {
+		if bot.Name != name {
+			continue
+		}
+		switch bot.Type {
+		case "slack", "discord", "mattermost", "telegram":
+		default:
+			return fmt.Errorf("bot %q is a %s bot, which has no bot_token", name, bot.Type)
+		}
+	}
+
+	doc, bot, err := loadNamedEntry(*configPath, "bots", name)
+	if err != nil {
+		return err
+	}
+	previous, err := os.ReadFile(*configPath)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	setMappingValue(bot, "bot_token", newString(strings.TrimSpace(*token)))
+	if err := doc.save(); err != nil {
+		return err
+	}
+
+	socketPath := *socket
+	if socketPath == "" {
+		socketPath = merged.Server.SocketPath
+	}
+	if socketPath == "" {
+		socketPath = defaultSocketPath
+	}
+	resp, err := call(socketPath, protocol.Request{Action: protocol.ActionReload})
+	if err != nil {
+		fmt.Printf("updated bot_token of %s; pantalkd isn't reachable (%v) and uses it from its next start\n", name, err)
+		return nil
+	}
+	if !resp.OK {
+		if restoreErr := os.WriteFile(*configPath, previous, 0o644); restoreErr != nil {
+			return fmt.Errorf("pantalkd rejected the new token: %s (restoring the config failed too: %v)", resp.Error, restoreErr)
+		}
+		return fmt.Errorf("pantalkd rejected the new token, config left unchanged: %s", resp.Error)
+	}
+
+	fmt.Printf("rotated bot_token of %s\n", name)
+	return nil
+}
@@ -0,0 +1,399 @@
+package ctl
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/manpage"
+)
+
+// launchdLabel names the pantalkd job for launchd.
+const launchdLabel = "com.pantalk.pantalkd"
+
+// runCommand runs a service manager command with its output on the
+// terminal. Tests replace it.
+var runCommand = func(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// serviceSpec is what the generated unit or plist runs.
+type serviceSpec struct {
+	User     bool   // a per-user service rather than a system one
+	RunAs    string // account a system service runs as
+	Pantalkd string
+	Pantalk  string // the CLI, for ExecReload; may be empty
+	Config   string
+	Socket   string
+	DB       string
+	LogDir   string // launchd only
+}
+
+func (s serviceSpec) args() []string {
+	return []string{s.Pantalkd, "--config", s.Config, "--socket", s.Socket, "--db", s.DB}
+}
+
+func runService(args []string) error {
+	if len(args) == 0 {
+		printServiceUsage()
+		return nil
+	}
+
+	switch args[0] {
+	case "install":
+		return runServiceInstall(args[1:])
+	case "status":
+		return runServiceStatus(args[1:])
+	case "uninstall":
+		return runServiceUninstall(args[1:])
+	case "help", "-h", "--help":
+		printServiceUsage()
+		return nil
+	default:
+		return fmt.Errorf("unknown service command %q", args[0])
+	}
+}
+
+// runServiceInstall writes a systemd unit (or launchd plist on macOS) that
+// keeps pantalkd running with the paths of this installation, then enables
+// and starts it.
+func runServiceInstall(args []string) error {
+	flags := manpage.NewFlagSet("service install")
+	userService := flags.Bool("user", false, "install a per-user service (systemd --user, or a LaunchAgent on macOS)")
+	configPath := flags.String("config", defaultConfigPath, "config the service runs pantalkd with")
+	pantalkd := flags.String("pantalkd", "", "pantalkd binary (default: next to this binary, then $PATH)")
+	printOnly := flags.Bool("print", false, "print the unit or plist instead of installing it")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	configSet := false
+	flags.Visit(func(f *flag.Flag) { configSet = configSet || f.Name == "config" })
+	if !configSet {
+		// Resolved again once the account the service runs as is known.
+		*configPath = ""
+	}
+
+	spec, err := newServiceSpec(*userService, *configPath, *pantalkd)
+	if err != nil {
+		return err
+	}
+
+	path, err := servicePath(*userService)
+	if err != nil {
+		return err
+	}
+	content := systemdUnit(spec)
+	if runtime.GOOS == "darwin" {
+		content = launchdPlist(spec)
+	}
+	if *printOnly {
+		fmt.Print(content)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create %s: %w", filepath.Dir(path), err)
+	}
+	if spec.LogDir != "" {
+		if err := os.MkdirAll(spec.LogDir, 0o755); err != nil {
+			return fmt.Errorf("create log directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	fmt.Printf("wrote %s\n", path)
+
+	if runtime.GOOS == "darwin" {
+		return runCommand("launchctl", "load", "-w", path)
+	}
+	if err := runCommand("systemctl", systemctlArgs(*userService, "daemon-reload")...); err != nil {
+		return err
+	}
+	if err := runCommand("systemctl", systemctlArgs(*userService, "enable", "--now", "pantalkd.service")...); err != nil {
+		return err
+	}
+	if *userService {
+		fmt.Println("to keep pantalkd running while you are logged out, run: loginctl enable-linger")
+	}
+	return nil
+}
+
+func runServiceStatus(args []string) error {
+	flags := manpage.NewFlagSet("service status")
+	userService := flags.Bool("user", false, "the per-user service")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "darwin" {
+		return runCommand("launchctl", "list", launchdLabel)
+	}
+	return runCommand("systemctl", systemctlArgs(*userService, "status", "--no-pager", "pantalkd.service")...)
+}
+
+func runServiceUninstall(args []string) error {
+	flags := manpage.NewFlagSet("service uninstall")
+	userService := flags.Bool("user", false, "the per-user service")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	path, err := servicePath(*userService)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("no pantalkd service installed at %s", path)
+	}
+
+	if runtime.GOOS == "darwin" {
+		if err := runCommand("launchctl", "unload", "-w", path); err != nil {
+			return err
+		}
+	} else if err := runCommand("systemctl", systemctlArgs(*userService, "disable", "--now", "pantalkd.service")...); err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("remove %s: %w", path, err)
+	}
+	fmt.Printf("removed %s\n", path)
+
+	if runtime.GOOS != "darwin" {
+		return runCommand("systemctl", systemctlArgs(*userService, "daemon-reload")...)
+	}
+	return nil
+}
+
+// newServiceSpec resolves the binaries and the absolute config, socket and
+// database paths, the config's default when configPath is empty. The
+// socket and database are passed to pantalkd explicitly: a system service
+// has no $XDG_RUNTIME_DIR or $HOME of the user who installed it to derive
+// the defaults from. A system service installed with sudo runs as the user
+// who ran sudo, so its paths resolve from that user's home, not root's.
+func newServiceSpec(userService bool, configPath string, pantalkd string) (serviceSpec, error) {
+	var runAs *user.User
+	sudo := false
+	if !userService {
+		account, err := serviceAccount()
+		if err != nil {
+			return serviceSpec{}, err
+		}
+		runAs = account
+		if sudo = os.Getenv("SUDO_USER") != ""; sudo {
+			if err := os.Setenv("HOME", account.HomeDir); err != nil {
+				return serviceSpec{}, err
+			}
+		}
+	}
+
+	if configPath == "" {
+		configPath = config.DefaultConfigPath()
+	}
+	configPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return serviceSpec{}, err
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return serviceSpec{}, fmt.Errorf("load config: %w", err)
+	}
+	if sudo && cfg.Server.SocketPath == config.DefaultSocketPath() {
+		cfg.Server.SocketPath = config.DefaultSocketPathFor(runAs.Uid)
+	}
+
+	self, _ := os.Executable()
+	if pantalkd == "" {
+		pantalkd, err = findPantalkd(self)
+		if err != nil {
+			return serviceSpec{}, err
+		}
+	}
+	if pantalkd, err = filepath.Abs(pantalkd); err != nil {
+		return serviceSpec{}, err
+	}
+
+	spec := serviceSpec{
+		User:     userService,
+		Pantalkd: pantalkd,
+		Config:   configPath,
+	}
+	if spec.Socket, err = filepath.Abs(cfg.Server.SocketPath); err != nil {
+		return serviceSpec{}, err
+	}
+	if spec.DB, err = filepath.Abs(cfg.Server.DBPath); err != nil {
+		return serviceSpec{}, err
+	}
+	if filepath.Base(self) == "pantalk" {
+		spec.Pantalk = self
+	}
+
+	if runAs != nil {
+		spec.RunAs = runAs.Username
+	}
+	if runtime.GOOS == "darwin" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return serviceSpec{}, err
+		}
+		spec.LogDir = filepath.Join(home, "Library", "Logs", "pantalk")
+	}
+	return spec, nil
+}
+
+// serviceAccount is the account a system service runs as: the user who
+// owns the config, which is the one who ran sudo when installed with it.
+func serviceAccount() (*user.User, error) {
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
+		account, err := user.Lookup(sudoUser)
+		if err != nil {
+			return nil, fmt.Errorf("look up sudo user %s: %w", sudoUser, err)
+		}
+		return account, nil
+	}
+	return user.Current()
+}
+
+// findPantalkd looks for pantalkd next to the running binary, where
+// release archives put both, then on $PATH.
+func findPantalkd(self string) (string, error) {
+	if self != "" {
+		sibling := filepath.Join(filepath.Dir(self), "pantalkd")
+		if _, err := os.Stat(sibling); err == nil {
+			return sibling, nil
+		}
+	}
+	path, err := exec.LookPath("pantalkd")
+	if err != nil {
+		return "", errors.New("pantalkd not found next to pantalk or on $PATH; pass --pantalkd")
+	}
+	return path, nil
+}
+
+// servicePath is where the unit or plist is installed.
+func servicePath(userService bool) (string, error) {
+	home, err := os.UserHomeDir()
+	switch {
+	case runtime.GOOS == "darwin" && userService:
+		return filepath.Join(home, "Library", "LaunchAgents", launchdLabel+".plist"), err
+	case runtime.GOOS == "darwin":
+		return filepath.Join("/Library", "LaunchDaemons", launchdLabel+".plist"), nil
+	case userService:
+		configHome := os.Getenv("XDG_CONFIG_HOME")
+		if configHome == "" {
+			configHome = filepath.Join(home, ".config")
+			if err != nil {
+				return "", err
+			}
+		}
+		return filepath.Join(configHome, "systemd", "user", "pantalkd.service"), nil
+	default:
+		return "/etc/systemd/system/pantalkd.service", nil
+	}
+}
+
+func systemctlArgs(userService bool, args ...string) []string {
+	if userService {
+		return append([]string{"--user"}, args...)
+	}
+	return args
+}
+
+// systemdUnit renders the pantalkd unit. pantalkd removes a stale socket
+// itself, so a plain restart on failure is enough.
+func systemdUnit(spec serviceSpec) string {
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=pantalk chat daemon\n")
+	b.WriteString("Documentation=https://github.com/pantalk/pantalk\n")
+	b.WriteString("After=network-online.target\n")
+	b.WriteString("Wants=network-online.target\n\n")
+
+	b.WriteString("[Service]\n")
+	if spec.RunAs != "" {
+		fmt.Fprintf(&b, "User=%s\n", spec.RunAs)
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", systemdCommand(spec.args()))
+	if spec.Pantalk != "" {
+		fmt.Fprintf(&b, "ExecReload=%s\n", systemdCommand([]string{spec.Pantalk, "reload", "--socket", spec.Socket}))
+	}
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("RestartSec=5\n\n")
+
+	b.WriteString("[Install]\n")
+	if spec.User {
+		b.WriteString("WantedBy=default.target\n")
+	} else {
+		b.WriteString("WantedBy=multi-user.target\n")
+	}
+	return b.String()
+}
+
+// systemdCommand joins args for ExecStart, quoting those with spaces.
+func systemdCommand(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = arg
+		if strings.ContainsAny(arg, " \t\"\\") {
+			quoted[i] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// launchdPlist renders the pantalkd job. KeepAlive restarts it when it
+// exits with an error, like the systemd unit's Restart=on-failure.
+func launchdPlist(spec serviceSpec) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+`)
+	fmt.Fprintf(&b, "\t<key>Label</key>\n\t<string>%s</string>\n", launchdLabel)
+	if spec.RunAs != "" {
+		fmt.Fprintf(&b, "\t<key>UserName</key>\n\t<string>%s</string>\n", html.EscapeString(spec.RunAs))
+	}
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, arg := range spec.args() {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", html.EscapeString(arg))
+	}
+	b.WriteString("\t</array>\n")
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	b.WriteString("\t<key>KeepAlive</key>\n\t<dict>\n\t\t<key>SuccessfulExit</key>\n\t\t<false/>\n\t</dict>\n")
+	b.WriteString("\t<key>ThrottleInterval</key>\n\t<integer>5</integer>\n")
+	if spec.LogDir != "" {
+		logFile := html.EscapeString(filepath.Join(spec.LogDir, "pantalkd.log"))
+		fmt.Fprintf(&b, "\t<key>StandardOutPath</key>\n\t<string>%s</string>\n", logFile)
+		fmt.Fprintf(&b, "\t<key>StandardErrorPath</key>\n\t<string>%s</string>\n", logFile)
+	}
+	b.WriteString("</dict>\n</plist>\n")
+	return b.String()
+}
+
+func printServiceUsage() {
+	fmt.Printf(`pantalk service commands
+
+Usage:
+  pantalk service install [--user] [--config %s] [--pantalkd PATH] [--print]
+  pantalk service status [--user]
+  pantalk service uninstall [--user]
+
+Installs pantalkd as a systemd service (a launchd job on macOS) that starts
+at boot, or at login with --user, and restarts it when it fails. System
+services need root; they run pantalkd as the user who ran the install,
+with the config, socket and database paths of that user under sudo.
+`, defaultConfigPath)
+}
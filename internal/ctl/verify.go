@@ -0,0 +1,102 @@
+package ctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/manpage"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+// runVerify checks bots' credentials with the platform's auth-test call,
+// without starting the daemon, so a bad token shows up before deploy.
+func runVerify(args []string) error {
+	flags := manpage.NewFlagSet("verify")
+	configPath := flags.String("config", defaultConfigPath, "config path")
+	botName := flags.String("bot", "", "bot to verify")
+	all := flags.Bool("all", false, "verify every bot")
+	timeout := flags.Duration("timeout", 15*time.Second, "time allowed for each bot")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if (strings.TrimSpace(*botName) == "") == !*all {
+		return errors.New("provide either --bot NAME or --all")
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return err
+	}
+
+	var bots []config.BotConfig
+	for _, bot := range cfg.Bots {
+		if *all || bot.Name == strings.TrimSpace(*botName) {
+			bots = append(bots, bot)
+		}
+	}
+	if len(bots) == 0 {
+		return fmt.Errorf("bot %q not found", *botName)
+	}
+
+	// Connectors log as they are built; here only the results matter.
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	failed := 0
+	for _, bot := range bots {
+		label := bot.Type + "/" + bot.Name
+		verification, err := verifyBot(bot, *timeout)
+		switch {
+		case errors.Is(err, errors.ErrUnsupported):
+			fmt.Printf("skip %s: %s bots can't be verified without connecting\n", label, bot.Type)
+		case err != nil:
+			failed++
+			fmt.Printf("FAIL %s: %v\n", label, err)
+		default:
+			fmt.Printf("ok   %s: %s\n", label, describeVerification(verification))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d bot(s) failed verification", failed, len(bots))
+	}
+	return nil
+}
+
+func verifyBot(bot config.BotConfig, timeout time.Duration) (upstream.Verification, error) {
+	connector, err := upstream.NewConnector(bot, func(protocol.Event) {})
+	if err != nil {
+		return upstream.Verification{}, err
+	}
+	verifier, ok := connector.(upstream.Verifier)
+	if !ok {
+		return upstream.Verification{}, errors.ErrUnsupported
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return verifier.Verify(ctx)
+}
+
+func describeVerification(v upstream.Verification) string {
+	parts := []string{"authenticated as " + v.User}
+	if v.UserID != "" && v.UserID != v.User {
+		parts[0] += " (" + v.UserID + ")"
+	}
+	if v.Team != "" {
+		parts = append(parts, "team "+v.Team)
+	}
+	if len(v.Scopes) > 0 {
+		parts = append(parts, "scopes "+strings.Join(v.Scopes, ","))
+	}
+	return strings.Join(parts, ", ")
+}
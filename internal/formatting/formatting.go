@@ -3,6 +3,7 @@ package formatting
 import (
 	"bytes"
 	"fmt"
+	stdhtml "html"
 	"regexp"
 	"strings"
 	"unicode/utf8"
@@ -108,6 +109,32 @@ func MarkdownToPlain(markdown string) string {
 	return StripHTML(htmlStr)
 }
 
+// Attribute prefixes text with the original author's name in relay-bot style,
+// for bridged messages on platforms that can't post under another identity.
+// The prefix is written in the message's own format so it survives
+// conversion: "<alice> hi" for plain, "**alice**: hi" for markdown and
+// "<b>alice</b>: hi" for HTML.
+func Attribute(author string, format string, text string) string {
+	author = strings.TrimSpace(author)
+	if author == "" {
+		return text
+	}
+
+	normalized, err := NormalizeFormat(format)
+	if err != nil {
+		normalized = FormatPlain
+	}
+
+	switch normalized {
+	case FormatMarkdown:
+		return "**" + author + "**: " + text
+	case FormatHTML:
+		return "<b>" + stdhtml.EscapeString(author) + "</b>: " + text
+	default:
+		return "<" + author + "> " + text
+	}
+}
+
 func SplitText(text string, maxLen int) []string {
 	if maxLen <= 0 || utf8.RuneCountInString(text) <= maxLen {
 		return []string{text}
@@ -1320,3 +1320,23 @@ func max(a, b int) int {
 	}
 	return b
 }
+
+func TestAttribute(t *testing.T) {
+	tests := []struct {
+		format string
+		author string
+		want   string
+	}{
+		{"", "alice", "<alice> hi"},
+		{"plain", "alice", "<alice> hi"},
+		{"md", "alice", "**alice**: hi"},
+		{"html", "a<b>", "<b>a&lt;b&gt;</b>: hi"},
+		{"plain", "  ", "hi"},
+	}
+
+	for _, tt := range tests {
+		if got := Attribute(tt.author, tt.format, "hi"); got != tt.want {
+			t.Errorf("Attribute(%q, %q) = %q, want %q", tt.author, tt.format, got, tt.want)
+		}
+	}
+}
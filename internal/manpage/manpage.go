@@ -0,0 +1,241 @@
+package manpage
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Page is a single man page. Commands and Flags are rendered from the same
+// flag.FlagSet definitions the binaries parse at runtime, so the pages cannot
+// drift from the real CLI.
+type Page struct {
+	Name        string
+	Section     string // defaults to "1"
+	Summary     string
+	Synopsis    []string
+	Description string
+	Flags       []Flag
+	Commands    []Command
+	Files       []Item
+	SeeAlso     []string
+	Version     string
+	Date        time.Time
+}
+
+// Command documents one subcommand and its flags.
+type Command struct {
+	Name    string
+	Group   string
+	Summary string
+	Flags   []Flag
+}
+
+// Flag documents one command-line flag.
+type Flag struct {
+	Name    string
+	Arg     string // placeholder for the value, empty for booleans
+	Usage   string
+	Default string
+}
+
+// Item is a tagged paragraph, used for FILES and similar sections.
+type Item struct {
+	Tag  string
+	Text string
+}
+
+// FlagsFrom converts every flag registered on fs, in lexical order.
+func FlagsFrom(fs *flag.FlagSet) []Flag {
+	var flags []Flag
+	fs.VisitAll(func(f *flag.Flag) {
+		arg, usage := flag.UnquoteUsage(f)
+		def := f.DefValue
+		if isBool(f) {
+			arg = ""
+			if def == "false" {
+				def = ""
+			}
+		}
+		flags = append(flags, Flag{
+			Name:    f.Name,
+			Arg:     arg,
+			Usage:   usage,
+			Default: def,
+		})
+	})
+	return flags
+}
+
+func isBool(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// Write renders p as roff using the man(7) macro package.
+func Write(w io.Writer, p Page) error {
+	bw := bufio.NewWriter(w)
+
+	section := p.Section
+	if section == "" {
+		section = "1"
+	}
+	date := p.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	fmt.Fprintf(bw, ".TH %s %s %q %q %q\n",
+		strings.ToUpper(p.Name), section, date.Format("2006-01-02"), p.Name+" "+p.Version, "Pantalk Manual")
+
+	bw.WriteString(".SH NAME\n")
+	fmt.Fprintf(bw, "%s \\- %s\n", escape(p.Name), escape(p.Summary))
+
+	if len(p.Synopsis) > 0 {
+		bw.WriteString(".SH SYNOPSIS\n")
+		for i, line := range p.Synopsis {
+			if i > 0 {
+				bw.WriteString(".br\n")
+			}
+			fmt.Fprintf(bw, "\\fB%s\\fR %s\n", escape(p.Name), escape(line))
+		}
+	}
+
+	if p.Description != "" {
+		bw.WriteString(".SH DESCRIPTION\n")
+		writeParagraphs(bw, p.Description)
+	}
+
+	if len(p.Flags) > 0 {
+		bw.WriteString(".SH OPTIONS\n")
+		writeFlags(bw, p.Flags)
+	}
+
+	if len(p.Commands) > 0 {
+		bw.WriteString(".SH COMMANDS\n")
+		group := ""
+		for _, cmd := range p.Commands {
+			if cmd.Group != group {
+				group = cmd.Group
+				fmt.Fprintf(bw, ".SS %s\n", escape(group))
+			}
+			fmt.Fprintf(bw, ".TP\n\\fB%s %s\\fR", escape(p.Name), escape(cmd.Name))
+			if len(cmd.Flags) > 0 {
+				bw.WriteString(" [\\fIoptions\\fR]")
+			}
+			bw.WriteString("\n")
+			writeParagraphs(bw, cmd.Summary)
+			if len(cmd.Flags) > 0 {
+				bw.WriteString(".RS\n")
+				writeFlags(bw, cmd.Flags)
+				bw.WriteString(".RE\n")
+			}
+		}
+	}
+
+	if len(p.Files) > 0 {
+		bw.WriteString(".SH FILES\n")
+		for _, item := range p.Files {
+			fmt.Fprintf(bw, ".TP\n\\fI%s\\fR\n%s\n", escape(item.Tag), escape(item.Text))
+		}
+	}
+
+	if len(p.SeeAlso) > 0 {
+		bw.WriteString(".SH SEE ALSO\n")
+		refs := make([]string, 0, len(p.SeeAlso))
+		for _, ref := range p.SeeAlso {
+			refs = append(refs, "\\fB"+escape(ref)+"\\fR")
+		}
+		bw.WriteString(strings.Join(refs, ", ") + "\n")
+	}
+
+	return bw.Flush()
+}
+
+func writeFlags(bw *bufio.Writer, flags []Flag) {
+	for _, f := range flags {
+		fmt.Fprintf(bw, ".TP\n\\fB\\-\\-%s\\fR", escape(f.Name))
+		if f.Arg != "" {
+			fmt.Fprintf(bw, " \\fI%s\\fR", escape(f.Arg))
+		}
+		bw.WriteString("\n")
+		text := f.Usage
+		if f.Default != "" {
+			text += fmt.Sprintf(" (default: %s)", f.Default)
+		}
+		bw.WriteString(escape(text) + "\n")
+	}
+}
+
+func writeParagraphs(bw *bufio.Writer, text string) {
+	for i, para := range strings.Split(strings.TrimSpace(text), "\n\n") {
+		if i > 0 {
+			bw.WriteString(".PP\n")
+		}
+		for _, line := range strings.Split(para, "\n") {
+			bw.WriteString(escape(strings.TrimSpace(line)) + "\n")
+		}
+	}
+}
+
+// escape makes text safe for roff: backslashes and hyphens are escaped and a
+// leading control character is neutralised with a zero-width \&.
+func escape(text string) string {
+	text = strings.ReplaceAll(text, `\`, `\e`)
+	text = strings.ReplaceAll(text, "-", `\-`)
+	if strings.HasPrefix(text, ".") || strings.HasPrefix(text, "'") {
+		text = `\&` + text
+	}
+	return text
+}
+
+// capture, when set, receives every FlagSet created through NewFlagSet.
+var capture func(*flag.FlagSet)
+
+// NewFlagSet returns a ContinueOnError flag set. Commands create their flags
+// through it so Capture can recover the definitions for documentation.
+func NewFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	if capture != nil {
+		fs.SetOutput(io.Discard)
+		capture(fs)
+	}
+	return fs
+}
+
+// Capture runs a command (normally with "-h" so it stops right after
+// parsing) and returns the first flag set it created, or nil. It is not safe
+// for concurrent use and is only meant for page generation.
+func Capture(run func()) *flag.FlagSet {
+	var captured *flag.FlagSet
+	capture = func(fs *flag.FlagSet) {
+		if captured == nil {
+			captured = fs
+		}
+	}
+	defer func() { capture = nil }()
+
+	run()
+	return captured
+}
+
+// Replace rewrites old to new in every flag usage and default on the page.
+func (p *Page) Replace(old string, new string) {
+	if old == "" {
+		return
+	}
+	replaceFlags(p.Flags, old, new)
+	for i := range p.Commands {
+		replaceFlags(p.Commands[i].Flags, old, new)
+	}
+}
+
+func replaceFlags(flags []Flag, old string, new string) {
+	for i := range flags {
+		flags[i].Usage = strings.ReplaceAll(flags[i].Usage, old, new)
+		flags[i].Default = strings.ReplaceAll(flags[i].Default, old, new)
+	}
+}
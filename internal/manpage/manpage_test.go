@@ -0,0 +1,133 @@
+package manpage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "plain"},
+		{"--json", `\-\-json`},
+		{`C:\path`, `C:\epath`},
+		{".hidden", `\&.hidden`},
+		{"'quoted", `\&'quoted`},
+	}
+
+	for _, tt := range tests {
+		if got := escape(tt.in); got != tt.want {
+			t.Errorf("escape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFlagsFrom(t *testing.T) {
+	fs := NewFlagSet("send")
+	fs.String("bot", "", "bot `NAME` from config")
+	fs.Int("limit", 20, "number of events")
+	fs.Bool("json", false, "output as JSON")
+
+	flags := FlagsFrom(fs)
+	if len(flags) != 3 {
+		t.Fatalf("expected 3 flags, got %d", len(flags))
+	}
+
+	// VisitAll is lexical: bot, json, limit.
+	if flags[0].Name != "bot" || flags[0].Arg != "NAME" || flags[0].Default != "" {
+		t.Errorf("unexpected bot flag: %+v", flags[0])
+	}
+	if flags[1].Name != "json" || flags[1].Arg != "" || flags[1].Default != "" {
+		t.Errorf("expected bool flag without arg or false default: %+v", flags[1])
+	}
+	if flags[2].Name != "limit" || flags[2].Arg != "int" || flags[2].Default != "20" {
+		t.Errorf("unexpected limit flag: %+v", flags[2])
+	}
+}
+
+func TestCapture(t *testing.T) {
+	var defined bool
+	fs := Capture(func() {
+		flags := NewFlagSet("ping")
+		flags.String("socket", "/tmp/x.sock", "unix socket path")
+		_ = flags.Parse([]string{"-h"})
+		defined = true
+	})
+
+	if !defined {
+		t.Fatal("expected command to run")
+	}
+	if fs == nil || fs.Lookup("socket") == nil {
+		t.Fatal("expected captured flag set with socket flag")
+	}
+
+	// Outside Capture, flag sets are not recorded.
+	if capture != nil {
+		t.Fatal("expected capture hook to be cleared")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	page := Page{
+		Name:        "pantalk",
+		Summary:     "chat from the terminal",
+		Synopsis:    []string{"<command> [flags]"},
+		Description: "First paragraph.\n\nSecond paragraph.",
+		Commands: []Command{
+			{Name: "send", Group: "Messaging", Summary: "Send a message.", Flags: []Flag{{Name: "bot", Arg: "string", Usage: "bot name"}}},
+			{Name: "ping", Group: "Messaging", Summary: "Check the daemon."},
+			{Name: "setup", Group: "Admin", Summary: "Run the wizard."},
+		},
+		SeeAlso: []string{"pantalkd(1)"},
+		Version: "v1.2.3",
+		Date:    time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, page); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		`.TH PANTALK 1 "2026-01-02" "pantalk v1.2.3" "Pantalk Manual"`,
+		`pantalk \- chat from the terminal`,
+		".SH SYNOPSIS",
+		".PP\nSecond paragraph.",
+		".SS Messaging",
+		".SS Admin",
+		`\fBpantalk send\fR [\fIoptions\fR]`,
+		`\fB\-\-bot\fR \fIstring\fR`,
+		`\fBpantalkd(1)\fR`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\n%s", want, out)
+		}
+	}
+
+	if strings.Count(out, ".SS Messaging") != 1 {
+		t.Error("expected Messaging group header once")
+	}
+}
+
+func TestPageReplace(t *testing.T) {
+	page := Page{
+		Flags: []Flag{{Name: "config", Usage: "path (default: /home/u/.config/x)", Default: "/home/u/.config/x"}},
+		Commands: []Command{
+			{Name: "reload", Flags: []Flag{{Name: "socket", Default: "/home/u/.config/x"}}},
+		},
+	}
+
+	page.Replace("/home/u/.config/x", "~/.config/x")
+
+	if page.Flags[0].Usage != "path (default: ~/.config/x)" || page.Flags[0].Default != "~/.config/x" {
+		t.Errorf("top-level flag not rewritten: %+v", page.Flags[0])
+	}
+	if page.Commands[0].Flags[0].Default != "~/.config/x" {
+		t.Errorf("command flag not rewritten: %+v", page.Commands[0].Flags[0])
+	}
+}
@@ -0,0 +1,244 @@
+// Package ntfy forwards pantalk notifications to an ntfy topic
+// (https://ntfy.sh or a self-hosted server) so they reach a phone.
+//
+// Each push carries action buttons that call back into the daemon's HTTP
+// API - mark seen and snooze - plus an optional button that opens the
+// conversation in the chat app, so notifications can be triaged without
+// opening a terminal.
+package ntfy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// DefaultServer is used when Config.Server is empty.
+const DefaultServer = "https://ntfy.sh"
+
+// DefaultSnooze is how long the snooze button hides a notification.
+const DefaultSnooze = time.Hour
+
+// maxMessage (in characters) keeps pushes readable on a lock screen; ntfy
+// itself accepts up to 4 KiB.
+const maxMessage = 1024
+
+// Config describes where notifications are published and how the action
+// buttons reach the daemon.
+type Config struct {
+	Server string // ntfy server base URL (default DefaultServer)
+	Topic  string
+	Token  string // ntfy access token (optional)
+
+	// ActionURL is the base URL of the daemon's HTTP API as seen from the
+	// phone. When empty the mark-seen and snooze buttons are omitted.
+	ActionURL   string
+	ActionToken string // bearer token the HTTP API requires
+
+	ThreadURL string // text/template for the "Open" button (optional)
+	Snooze    time.Duration
+}
+
+// Action is one ntfy action button.
+type Action struct {
+	Action  string            `json:"action"` // "http" or "view"
+	Label   string            `json:"label"`
+	URL     string            `json:"url"`
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Clear   bool              `json:"clear,omitempty"`
+}
+
+// Message is the JSON publish body understood by ntfy.
+type Message struct {
+	Topic    string   `json:"topic"`
+	Title    string   `json:"title"`
+	Message  string   `json:"message"`
+	Tags     []string `json:"tags,omitempty"`
+	Priority int      `json:"priority,omitempty"`
+	Actions  []Action `json:"actions,omitempty"`
+}
+
+// Publisher sends notifications to ntfy. It is safe for concurrent use.
+type Publisher struct {
+	cfg        Config
+	threadURL  *template.Template
+	httpClient *http.Client
+}
+
+// New validates cfg and returns a Publisher.
+func New(cfg Config) (*Publisher, error) {
+	if strings.TrimSpace(cfg.Topic) == "" {
+		return nil, fmt.Errorf("ntfy topic cannot be empty")
+	}
+	if cfg.Server == "" {
+		cfg.Server = DefaultServer
+	}
+	cfg.Server = strings.TrimRight(cfg.Server, "/")
+	cfg.ActionURL = strings.TrimRight(cfg.ActionURL, "/")
+	if cfg.Snooze < 0 {
+		return nil, fmt.Errorf("ntfy snooze must be >= 0")
+	}
+	if cfg.Snooze == 0 {
+		cfg.Snooze = DefaultSnooze
+	}
+
+	p := &Publisher{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: 15 * time.Second},
+	}
+
+	if strings.TrimSpace(cfg.ThreadURL) != "" {
+		tmpl, err := template.New("thread_url").Option("missingkey=error").Parse(cfg.ThreadURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ntfy thread_url template: %w", err)
+		}
+		p.threadURL = tmpl
+	}
+
+	return p, nil
+}
+
+// Message builds the push for a stored notification. The event must carry
+// its NotificationID so the buttons can address it.
+func (p *Publisher) Message(event protocol.Event) Message {
+	title := fmt.Sprintf("%s/%s", event.Service, event.Bot)
+	if event.User != "" {
+		title = fmt.Sprintf("%s in %s (%s)", event.User, conversation(event), title)
+	}
+
+	text := event.Text
+	if runes := []rune(text); len(runes) > maxMessage {
+		text = string(runes[:maxMessage]) + "…"
+	}
+
+	msg := Message{
+		Topic:   p.cfg.Topic,
+		Title:   title,
+		Message: text,
+	}
+	switch {
+	case event.Direct:
+		msg.Tags = []string{"speech_balloon"}
+		msg.Priority = 4
+	case event.Mentions:
+		msg.Tags = []string{"bell"}
+		msg.Priority = 4
+	}
+	// A classifier's verdict outranks how the notification came about.
+	switch event.Priority {
+	case protocol.PriorityUrgent:
+		msg.Tags = append(msg.Tags, "rotating_light")
+		msg.Priority = 5
+	case protocol.PriorityLow:
+		msg.Priority = 2
+	}
+
+	if p.cfg.ActionURL != "" && event.NotificationID > 0 {
+		base := fmt.Sprintf("%s/v1/notifications/%d", p.cfg.ActionURL, event.NotificationID)
+		var headers map[string]string
+		if p.cfg.ActionToken != "" {
+			headers = map[string]string{"Authorization": "Bearer " + p.cfg.ActionToken}
+		}
+		msg.Actions = append(msg.Actions,
+			Action{Action: "http", Label: "Mark seen", URL: base + "/seen", Method: http.MethodPost, Headers: headers, Clear: true},
+			Action{Action: "http", Label: "Snooze " + formatSnooze(p.cfg.Snooze), URL: base + "/snooze?for=" + p.cfg.Snooze.String(), Method: http.MethodPost, Headers: headers, Clear: true},
+		)
+	}
+
+	if url := p.renderThreadURL(event); url != "" {
+		msg.Actions = append(msg.Actions, Action{Action: "view", Label: "Open", URL: url})
+	}
+
+	return msg
+}
+
+// Summary builds a push that stands for several notifications, such as a
+// digest, so it carries no per-notification buttons.
+func (p *Publisher) Summary(title string, text string) Message {
+	return Message{
+		Topic:   p.cfg.Topic,
+		Title:   title,
+		Message: text,
+		Tags:    []string{"inbox_tray"},
+	}
+}
+
+// Publish sends the push for event.
+func (p *Publisher) Publish(ctx context.Context, event protocol.Event) error {
+	return p.Send(ctx, p.Message(event))
+}
+
+// Send publishes msg as is.
+func (p *Publisher) Send(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("encode ntfy message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.Server, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build ntfy request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.cfg.Token)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("publish to ntfy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("publish to ntfy: %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// renderThreadURL returns the "Open" link for event, or "" when no template
+// is configured or it fails to render.
+func (p *Publisher) renderThreadURL(event protocol.Event) string {
+	if p.threadURL == nil {
+		return ""
+	}
+
+	var out strings.Builder
+	if err := p.threadURL.Execute(&out, event); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out.String())
+}
+
+func conversation(event protocol.Event) string {
+	if event.Channel != "" {
+		return event.Channel
+	}
+	return event.Target
+}
+
+// formatSnooze renders d for a button label: "1h", "30m", "1h30m".
+func formatSnooze(d time.Duration) string {
+	d = d.Round(time.Minute)
+	hours := int(d / time.Hour)
+	minutes := int(d % time.Hour / time.Minute)
+
+	switch {
+	case hours > 0 && minutes > 0:
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	case hours > 0:
+		return fmt.Sprintf("%dh", hours)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
@@ -0,0 +1,151 @@
+package ntfy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func mention() protocol.Event {
+	return protocol.Event{
+		NotificationID: 42,
+		Service:        "slack",
+		Bot:            "ops",
+		User:           "alice",
+		Channel:        "C123",
+		Thread:         "1700000000.000100",
+		Text:           "@ops can you look at the deploy?",
+		Mentions:       true,
+		Notify:         true,
+	}
+}
+
+func TestNew_RequiresTopic(t *testing.T) {
+	if _, err := New(Config{}); err == nil {
+		t.Fatal("expected error for empty topic")
+	}
+}
+
+func TestMessage_Actions(t *testing.T) {
+	p, err := New(Config{
+		Topic:       "alerts",
+		ActionURL:   "https://laptop.example.ts.net:8750/",
+		ActionToken: "secret",
+		ThreadURL:   "https://app.slack.com/client/T0123/{{.Channel}}/thread/{{.Channel}}-{{.Thread}}",
+		Snooze:      90 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	msg := p.Message(mention())
+	if msg.Topic != "alerts" || msg.Title != "alice in C123 (slack/ops)" || msg.Priority != 4 {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+	if len(msg.Actions) != 3 {
+		t.Fatalf("expected 3 actions, got %+v", msg.Actions)
+	}
+
+	seen, snooze, open := msg.Actions[0], msg.Actions[1], msg.Actions[2]
+	if seen.URL != "https://laptop.example.ts.net:8750/v1/notifications/42/seen" || seen.Method != http.MethodPost {
+		t.Errorf("unexpected seen action: %+v", seen)
+	}
+	if seen.Headers["Authorization"] != "Bearer secret" || !seen.Clear {
+		t.Errorf("seen action should authenticate and clear: %+v", seen)
+	}
+	if snooze.Label != "Snooze 1h30m" || !strings.HasSuffix(snooze.URL, "/v1/notifications/42/snooze?for=1h30m0s") {
+		t.Errorf("unexpected snooze action: %+v", snooze)
+	}
+	if open.Action != "view" || open.URL != "https://app.slack.com/client/T0123/C123/thread/C123-1700000000.000100" {
+		t.Errorf("unexpected open action: %+v", open)
+	}
+}
+
+func TestMessage_NoActionURL(t *testing.T) {
+	p, err := New(Config{Topic: "alerts"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if actions := p.Message(mention()).Actions; len(actions) != 0 {
+		t.Fatalf("expected no buttons without an action url, got %+v", actions)
+	}
+}
+
+func TestMessage_Priority(t *testing.T) {
+	p, err := New(Config{Topic: "alerts"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	urgent := mention()
+	urgent.Priority = protocol.PriorityUrgent
+	if msg := p.Message(urgent); msg.Priority != 5 || len(msg.Tags) != 2 || msg.Tags[1] != "rotating_light" {
+		t.Errorf("expected an urgent push, got %+v", msg)
+	}
+
+	low := mention()
+	low.Priority = protocol.PriorityLow
+	if msg := p.Message(low); msg.Priority != 2 {
+		t.Errorf("expected a low priority push, got %+v", msg)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	var got Message
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	p, err := New(Config{Server: srv.URL, Topic: "alerts", Token: "tk_abc"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if err := p.Publish(context.Background(), mention()); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	if auth != "Bearer tk_abc" {
+		t.Errorf("expected ntfy token, got %q", auth)
+	}
+	if got.Topic != "alerts" || got.Message != "@ops can you look at the deploy?" {
+		t.Errorf("unexpected published message: %+v", got)
+	}
+}
+
+func TestPublish_ServerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "topic reserved", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	p, _ := New(Config{Server: srv.URL, Topic: "alerts"})
+	err := p.Publish(context.Background(), mention())
+	if err == nil || !strings.Contains(err.Error(), "topic reserved") {
+		t.Fatalf("expected server error to be surfaced, got: %v", err)
+	}
+}
+
+func TestFormatSnooze(t *testing.T) {
+	tests := map[time.Duration]string{
+		time.Hour:        "1h",
+		30 * time.Minute: "30m",
+		90 * time.Minute: "1h30m",
+		24 * time.Hour:   "24h",
+	}
+	for in, want := range tests {
+		if got := formatSnooze(in); got != want {
+			t.Errorf("formatSnooze(%s) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -1,8 +1,20 @@
 package protocol
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
+
+// ProtocolVersion is the version of the socket protocol this build speaks.
+// It goes up when a change would make one side misread the other; new
+// actions and fields don't need it, hello lists the actions a daemon has.
+const ProtocolVersion = 1
+
+// MinProtocolVersion is the oldest client protocol pantalkd still serves.
+const MinProtocolVersion = 1
 
 const (
+	ActionHello        = "hello"
 	ActionPing         = "ping"
 	ActionBots         = "bots"
 	ActionStatus       = "status"
@@ -13,11 +25,52 @@ const (
 	ActionClearHistory = "clear_history"
 	ActionClearNotify  = "clear_notifications"
 	ActionSubscribe    = "subscribe"
+	ActionUnsubscribe  = "unsubscribe"
 	ActionReload       = "reload"
+	ActionExamples     = "examples"
+	ActionAgents       = "agents"
+	ActionAgentRuns    = "agent_runs"
+	ActionRunAgent     = "run_agent"
+	ActionTestAgent    = "test_agent"
+	ActionContext      = "context"
+	ActionMarkRead     = "mark_read"
+	ActionPresence     = "presence"
+	ActionBroadcast    = "broadcast"
+	ActionLogs         = "logs"
+	ActionDebug        = "debug"
+
+	ActionJoinChannel   = "join_channel"
+	ActionLeaveChannel  = "leave_channel"
+	ActionCreateChannel = "create_channel"
+	ActionInviteChannel = "invite_channel"
+	ActionListTopics    = "list_topics"
+
+	ActionMute   = "mute"
+	ActionUnmute = "unmute"
+	ActionMutes  = "mutes"
+
+	// ActionHandoff is sent by a pantalkd started with --takeover. The
+	// daemon answers with its listening sockets attached as SCM_RIGHTS (the
+	// unix socket first, then the HTTP API's if it has one), drains, and
+	// sends a second response with Ack "released" once it has let go of
+	// the connectors and the database.
+	ActionHandoff = "handoff"
 )
 
 type Request struct {
+	// ID tags a request on a multiplexed connection: requests with an ID
+	// run concurrently, every response to one (each event of a
+	// subscription included) carries its ID, and unsubscribe ends the
+	// subscription with its ID.
+	ID string `json:"id,omitempty"`
+
+	// Trace is the trace ID to record the request under, 32 hex digits;
+	// the daemon makes one up when it is empty and returns it in the
+	// response either way.
+	Trace string `json:"trace,omitempty"`
+
 	Action  string `json:"action"`
+	Version int    `json:"version,omitempty"` // hello: the client's ProtocolVersion
 	Service string `json:"service,omitempty"`
 	Bot     string `json:"bot,omitempty"`
 	Target  string `json:"target,omitempty"`
@@ -32,17 +85,268 @@ type Request struct {
 	All     bool   `json:"all,omitempty"`
 	Limit   int    `json:"limit,omitempty"`
 	SinceID int64  `json:"since_id,omitempty"`
+
+	// Forward makes history and notifications page up from SinceID: the
+	// Limit events right after it rather than the newest ones.
+	Forward bool `json:"forward,omitempty"`
+
+	// Direction ("in" or "out") and Kind narrow history and notifications
+	// to events of that direction and kind.
+	Direction string `json:"direction,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+
+	// Author and AuthorAvatar post a send under another person's name, for
+	// bridges. Connectors that can't impersonate prefix the name instead.
+	Author       string `json:"author,omitempty"`
+	AuthorAvatar string `json:"author_avatar,omitempty"`
+
+	// Interactive attaches buttons and a select menu to a send, on
+	// connectors that support them.
+	Interactive *Interactive `json:"interactive,omitempty"`
+
+	// Blocks is a Slack Block Kit layout (a JSON array of blocks) for a
+	// send. Text is the notification fallback and what services without
+	// Block Kit post instead; it defaults to the text in the blocks.
+	Blocks json.RawMessage `json:"blocks,omitempty"`
+
+	// Embeds are rich cards (title, description, fields, color) for a
+	// send. Services without embeds post them as text after Text, which
+	// may be empty when embeds are given.
+	Embeds []Embed `json:"embeds,omitempty"`
+
+	// StartThread opens a new thread with this name for a send: from the
+	// message in Thread when set, otherwise in the channel. The send is
+	// posted into the new thread and its event's Thread is the thread ID.
+	StartThread string `json:"start_thread,omitempty"`
+
+	// Files are absolute paths of files a send uploads. The daemon reads
+	// them, so they must be on its machine. Text is the caption, and may be
+	// empty when files are given.
+	Files []string `json:"files,omitempty"`
+
+	// ReplyTo threads a send onto the stored event with this ID: into its
+	// thread, or one started from the message where the service has
+	// threads, otherwise into its conversation. The bot and destination
+	// default to the event's.
+	ReplyTo int64 `json:"reply_to,omitempty"`
+
+	// Translate makes a send translate Text into this language (an
+	// ISO-639-1 code such as "de") before posting it.
+	Translate string `json:"translate,omitempty"`
+
+	// DryRun makes a send resolve the bot and destination and format and
+	// split the text as usual, then answer with a Preview of what would be
+	// posted instead of posting it.
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// Presence is the bot status the presence action sets.
+	Presence *Presence `json:"presence,omitempty"`
+
+	// Group names the broadcast group a broadcast sends Text to.
+	Group string `json:"group,omitempty"`
+
+	// Name and Private describe the channel create_channel makes; Target
+	// optionally picks the Discord server or Mattermost team to make it in.
+	// invite_channel adds Users (platform user IDs) to Channel.
+	Name    string   `json:"name,omitempty"`
+	Private bool     `json:"private,omitempty"`
+	Users   []string `json:"users,omitempty"`
+
+	// ReplayRate paces a subscribe catch-up (SinceID > 0) to this many
+	// events per second. Zero replays as fast as the client reads.
+	ReplayRate int `json:"replay_rate,omitempty"`
+	// Where is an expression (the agent when language) a subscribe applies
+	// to every event on top of the other filters.
+	Where string `json:"where,omitempty"`
+	// Buffer is how many live events a subscribe queues while the client
+	// is slow to read (default 64). Events beyond it are dropped, or with
+	// CatchUp replayed from the store once the client has drained the
+	// queue. Subscriptions with a SinceID always catch up.
+	Buffer  int  `json:"buffer,omitempty"`
+	CatchUp bool `json:"catch_up,omitempty"`
+	// ByConversation makes a subscribe answer each message with a Bundle
+	// of the last Limit messages (default 20) of its conversation instead
+	// of the message alone. Other events are sent as they are.
+	ByConversation bool `json:"by_conversation,omitempty"`
+
+	// Level is the least severe log entry logs returns: "debug", "info"
+	// (the default) or "error". Follow keeps the request open and streams
+	// new entries after the recent ones, like a subscribe.
+	Level  string `json:"level,omitempty"`
+	Follow bool   `json:"follow,omitempty"`
+
+	// Debug is "on" or "off" to switch debug logging for the bot selected
+	// by Service and Bot, or for the whole daemon when neither is set.
+	// Empty only reports what debug logging is on for.
+	Debug string `json:"debug,omitempty"`
+
+	// For is how long mute silences Channel of the bot, as a duration such
+	// as "2h" or "30m". unmute lifts the mute of Channel, of every channel
+	// of the bot when Channel is empty, or of every bot with All.
+	For string `json:"for,omitempty"`
+
+	// Command narrows the examples action to one CLI command.
+	Command string `json:"command,omitempty"`
+
+	// Agent narrows agent_runs to one agent and names the agent for
+	// run_agent, which passes it the stored event EventID, if set. Force
+	// ignores the agent's cooldown. context returns the Limit messages
+	// before EventID in its conversation. mark_read marks EventID's channel
+	// read up to that message, or all of Channel when EventID is unset.
+	Agent   string `json:"agent,omitempty"`
+	EventID int64  `json:"event_id,omitempty"`
+	Force   bool   `json:"force,omitempty"`
+
+	// When is the expression test_agent evaluates (default: the when of
+	// Agent) against the stored event EventID or the supplied Event.
+	When  string `json:"when,omitempty"`
+	Event *Event `json:"event,omitempty"`
 }
 
 type Response struct {
+	ID      string        `json:"id,omitempty"`    // the ID of the request answered
+	Trace   string        `json:"trace,omitempty"` // the trace the request was recorded under
 	OK      bool          `json:"ok"`
 	Error   string        `json:"error,omitempty"`
+	Code    string        `json:"code,omitempty"` // why the request failed, one of the Code constants
 	Ack     string        `json:"ack,omitempty"`
 	Bots    []BotRef      `json:"bots,omitempty"`
 	Events  []Event       `json:"events,omitempty"`
 	Event   *Event        `json:"event,omitempty"`
 	Cleared int64         `json:"cleared,omitempty"`
 	Status  *DaemonStatus `json:"status,omitempty"`
+	Hello   *Hello        `json:"hello,omitempty"`
+	Channel string        `json:"channel,omitempty"` // ID of the channel create_channel made
+
+	Results []BroadcastResult `json:"results,omitempty"`
+
+	Topics []Topic `json:"topics,omitempty"` // list_topics, most recently active first
+
+	Examples []Example   `json:"examples,omitempty"`
+	Agents   []AgentInfo `json:"agents,omitempty"`
+	Runs     []AgentRun  `json:"runs,omitempty"`
+	Test     *AgentTest  `json:"test,omitempty"`
+
+	Preview *SendPreview `json:"preview,omitempty"` // what a dry-run send would post
+
+	Logs []LogEntry `json:"logs,omitempty"` // recent daemon log entries, oldest first
+	Log  *LogEntry  `json:"log,omitempty"`  // one entry of a followed log
+
+	Debug *DebugStatus `json:"debug,omitempty"`
+
+	Mutes []Mute `json:"mutes,omitempty"` // mute, mutes: the channels muted, soonest to expire first
+
+	Bundle *Bundle `json:"bundle,omitempty"` // a by-conversation subscribe's update of one conversation
+}
+
+// Bundle is a conversation as a by-conversation subscribe sends it when a
+// message arrives: the thread when the message is in one, otherwise the
+// channel, with its last Messages oldest first and the new one last.
+type Bundle struct {
+	Service  string  `json:"service"`
+	Bot      string  `json:"bot"`
+	Channel  string  `json:"channel,omitempty"`
+	Thread   string  `json:"thread,omitempty"`
+	Messages []Event `json:"messages"`
+}
+
+// Mute is a channel whose events don't notify or reach agents until Until.
+// They are still stored and streamed.
+type Mute struct {
+	Service string    `json:"service"`
+	Bot     string    `json:"bot"`
+	Channel string    `json:"channel"`
+	Until   time.Time `json:"until"`
+}
+
+// DebugStatus is what debug logging is on for: every connector (All), or
+// the service:bot keys in Bots.
+type DebugStatus struct {
+	All  bool     `json:"all"`
+	Bots []string `json:"bots,omitempty"`
+}
+
+// LogEntry is one line of the daemon's log. Bot is the service:bot key of
+// the connector it is about, if any.
+type LogEntry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Bot     string    `json:"bot,omitempty"`
+	Message string    `json:"message"`
+}
+
+// Error codes classify a failed Response so clients can tell failures
+// apart without parsing Error. They are stable across releases; new ones
+// may be added, so treat an unknown code like CodeInternal.
+const (
+	CodeInvalidRequest   = "invalid_request"   // missing, malformed or conflicting fields
+	CodeUnknownBot       = "unknown_bot"       // no such bot, service or broadcast group
+	CodeNotFound         = "not_found"         // no such event or agent
+	CodeUnsupported      = "unsupported"       // the bot's connector lacks the capability
+	CodeUnavailable      = "unavailable"       // the bot's connector is restarting
+	CodeRateLimited      = "rate_limited"      // the platform throttled the call; retry later
+	CodeUpstream         = "upstream"          // the platform failed or refused the call
+	CodeProtocolMismatch = "protocol_mismatch" // client and daemon share no protocol version
+	CodeInternal         = "internal"          // anything else, such as a store error
+)
+
+// Topic is a thread of a channel that list_topics reports, such as a Zulip
+// stream topic. LastMessage is the ID of its newest message.
+type Topic struct {
+	Name        string `json:"name"`
+	LastMessage string `json:"last_message,omitempty"`
+}
+
+// SendPreview is what a send would post: one message per entry of
+// Messages, in the platform's own markup, to Channel (and Thread) of the
+// resolved bot.
+type SendPreview struct {
+	Service  string           `json:"service"`
+	Bot      string           `json:"bot"`
+	Target   string           `json:"target,omitempty"`
+	Channel  string           `json:"channel"`
+	Thread   string           `json:"thread,omitempty"`
+	Messages []PreviewMessage `json:"messages"`
+	Files    []string         `json:"files,omitempty"`
+}
+
+// PreviewMessage is one message of a SendPreview. Format names the markup
+// the platform is told Text is in, such as Telegram's "MarkdownV2", where
+// the API takes one.
+type PreviewMessage struct {
+	Text   string `json:"text"`
+	Format string `json:"format,omitempty"`
+}
+
+// BroadcastResult is the outcome of a broadcast for one destination of
+// its group, in group order.
+type BroadcastResult struct {
+	Service string `json:"service"`
+	Bot     string `json:"bot"`
+	Channel string `json:"channel,omitempty"`
+	Thread  string `json:"thread,omitempty"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Event   *Event `json:"event,omitempty"`
+}
+
+// Example is a ready-to-run CLI invocation built by the daemon from the
+// configured bots and recent history.
+type Example struct {
+	Command     string `json:"command"` // CLI command it demonstrates, e.g. "send"
+	Description string `json:"description"`
+	Line        string `json:"line"` // full command line, shell-quoted
+}
+
+// Hello answers the hello handshake: the protocol version both sides use
+// (the lower of the two), the oldest the daemon accepts, the daemon's
+// release and the actions it handles.
+type Hello struct {
+	Version    int      `json:"version"`
+	MinVersion int      `json:"min_version"`
+	Daemon     string   `json:"daemon"`
+	Actions    []string `json:"actions"`
 }
 
 // DaemonStatus holds a snapshot of the daemon's runtime state returned by
@@ -54,6 +358,34 @@ type DaemonStatus struct {
 	Bots          []BotStatus    `json:"bots"`
 	Agents        []AgentInfo    `json:"agents"`
 	Notifications *NotifyBacklog `json:"notifications,omitempty"`
+
+	Subscribers   []SubscriberStatus `json:"subscribers"`
+	DroppedEvents int64              `json:"dropped_events"` // across all subscribers since start
+
+	Middleware []MiddlewareStatus `json:"middleware,omitempty"`
+
+	Debug *DebugStatus `json:"debug,omitempty"`
+}
+
+// MiddlewareStatus counts what one step of the middleware chain did since
+// the daemon started.
+type MiddlewareStatus struct {
+	Name      string  `json:"name"`
+	Events    int64   `json:"events"`
+	Dropped   int64   `json:"dropped"`
+	Errors    int64   `json:"errors"`
+	AvgMillis float64 `json:"avg_ms"`
+}
+
+// SubscriberStatus describes an open subscribe connection: the bots it
+// follows, how full its buffer is and how many live events it missed.
+type SubscriberStatus struct {
+	Bots    []string  `json:"bots"` // service:bot keys
+	Since   time.Time `json:"since"`
+	Buffer  int       `json:"buffer"`
+	Queued  int       `json:"queued"`
+	Dropped int64     `json:"dropped"`
+	CatchUp bool      `json:"catch_up,omitempty"`
 }
 
 // NotifyBacklog summarizes pending and total notifications in the local store.
@@ -71,15 +403,162 @@ type BotStatus struct {
 
 // AgentInfo describes a configured agent runner.
 type AgentInfo struct {
-	Name string `json:"name"`
-	When string `json:"when"`
+	Name    string    `json:"name"`
+	When    string    `json:"when"`
+	Running bool      `json:"running,omitempty"`
+	Pending int       `json:"pending,omitempty"` // buffered events waiting for the next run
+	LastRun *AgentRun `json:"last_run,omitempty"`
+}
+
+// AgentRun records one execution of an agent command.
+type AgentRun struct {
+	ID         int64     `json:"id"`
+	Agent      string    `json:"agent"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	ExitCode   int       `json:"exit_code"` // -1 when the command could not be started
+	Triggers   int       `json:"triggers"`  // buffered events that triggered the run
+	Error      string    `json:"error,omitempty"`
+	Output     string    `json:"output,omitempty"` // stdout and stderr, truncated
+}
+
+// AgentTest is the result of evaluating a when expression against one event
+// with test_agent.
+type AgentTest struct {
+	When    string         `json:"when"`
+	Matched bool           `json:"matched"`           // value of the expression
+	Skipped string         `json:"skipped,omitempty"` // why the event can't trigger an agent anyway
+	Error   string         `json:"error,omitempty"`   // runtime error evaluating the expression
+	Env     map[string]any `json:"env"`               // fields the expression saw
+	Event   Event          `json:"event"`
 }
 
 type BotRef struct {
-	Service     string `json:"service"`
-	Name        string `json:"name"`
-	BotID       string `json:"bot_id"`
-	DisplayName string `json:"display_name,omitempty"`
+	Service      string        `json:"service"`
+	Name         string        `json:"name"`
+	BotID        string        `json:"bot_id"`
+	UserID       string        `json:"user_id,omitempty"` // the user account a Slack bot's user_token acts as
+	DisplayName  string        `json:"display_name,omitempty"`
+	Aliases      []string      `json:"aliases,omitempty"`
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+}
+
+// Capabilities lists the optional features a bot's connector supports.
+// Requests that need a missing one are refused.
+type Capabilities struct {
+	Threads     bool `json:"threads"`     // sends with Thread reply in that thread
+	Reactions   bool `json:"reactions"`   // react
+	Files       bool `json:"files"`       // file uploads
+	Interactive bool `json:"interactive"` // Request.Interactive buttons and menus
+	Blocks      bool `json:"blocks"`      // Request.Blocks layouts; other connectors post the text
+	Embeds      bool `json:"embeds"`      // Request.Embeds cards; other connectors post them as text
+	NewThreads  bool `json:"new_threads"` // Request.StartThread
+	Puppeting   bool `json:"puppeting"`   // Request.Author posts under that name rather than a prefix
+	MarkRead    bool `json:"mark_read"`   // mark_read
+	Presence    bool `json:"presence"`    // presence
+	Channels    bool `json:"channels"`    // join_channel, leave_channel, create_channel, invite_channel
+	Topics      bool `json:"topics"`      // list_topics
+	Receipts    bool `json:"receipts"`    // KindReceipt events for sent messages
+
+	// MaxText is the most text one message carries; longer text is split
+	// into several. Zero means no limit is known.
+	MaxText int `json:"max_text,omitempty"`
+}
+
+// KindReplayDone marks the end of a subscribe catch-up: events before it
+// were replayed from the store, events after it are live. Its ID is the
+// last replayed event, usable as the next SinceID.
+const KindReplayDone = "replay_done"
+
+// KindHandoff is the last event of a subscription on a daemon handing over
+// to its successor. Its ID is the event to resume after: subscribing again
+// with it as SinceID replays whatever the subscription would have seen in
+// between.
+const KindHandoff = "handoff"
+
+// KindRead reports that the bot's account read a conversation on another
+// client: Channel was read up to Timestamp. pantalkd consumes it to mark
+// notifications seen on bots with sync_read; it is neither stored nor
+// delivered.
+const KindRead = "read"
+
+// KindReceipt reports a change in the delivery status of a message the bot
+// sent: MessageID is the message, Status its new status and, for a failed
+// one, Text the reason. pantalkd records it on the stored message and
+// streams it to subscribers; it is not kept as an event of its own and
+// never notifies.
+const KindReceipt = "receipt"
+
+// Delivery statuses of sent messages, in the order they are reached. A
+// failed message goes no further.
+const (
+	StatusQueued    = "queued"    // accepted by the platform, not yet sent on
+	StatusSent      = "sent"      // handed to the recipient's carrier or server
+	StatusDelivered = "delivered" // on the recipient's device
+	StatusRead      = "read"      // opened by the recipient
+	StatusFailed    = "failed"    // not deliverable
+)
+
+// KindInteraction is an inbound click on a button or select menu of a
+// message sent with Interactive. Its Text is the chosen Value, User is who
+// chose it, and Channel and Thread are where the message is.
+const KindInteraction = "interaction"
+
+// Lifecycle kinds report changes to messages already posted: an edit (Text
+// is the new text), a deletion, or a reaction added (Text is the emoji
+// name). Target is "post:<id>" of the message concerned. They are kept in
+// history and reach agents and subscribers, but never notify.
+const (
+	KindEdit     = "edit"
+	KindDelete   = "delete"
+	KindReaction = "reaction"
+)
+
+// Presence is a bot's availability on a platform. Unset fields are left
+// as they are; an empty Status clears the status text.
+type Presence struct {
+	State  string  `json:"state,omitempty"`  // "online", "away" or "dnd"
+	Status *string `json:"status,omitempty"` // free-text status, e.g. "Reviewing PRs"
+}
+
+// Embed is a rich card attached to a sent message. Color is an RGB value
+// such as 0x5865F2; zero leaves the platform default.
+type Embed struct {
+	Title       string       `json:"title,omitempty"`
+	Description string       `json:"description,omitempty"`
+	URL         string       `json:"url,omitempty"`
+	Color       int          `json:"color,omitempty"`
+	Fields      []EmbedField `json:"fields,omitempty"`
+	Footer      string       `json:"footer,omitempty"`
+}
+
+type EmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// Interactive is a set of buttons and an optional select menu rendered
+// under a sent message with each platform's native components.
+type Interactive struct {
+	Buttons []Button `json:"buttons,omitempty"`
+	Select  *Select  `json:"select,omitempty"`
+}
+
+type Button struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+	Style string `json:"style,omitempty"` // "primary", "danger" or empty for the platform default
+}
+
+type Select struct {
+	Placeholder string   `json:"placeholder,omitempty"`
+	Options     []Option `json:"options"`
+}
+
+type Option struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
 }
 
 type Event struct {
@@ -94,11 +573,90 @@ type Event struct {
 	Target         string     `json:"target,omitempty"`
 	Channel        string     `json:"channel,omitempty"`
 	Thread         string     `json:"thread,omitempty"`
+	MessageID      string     `json:"message_id,omitempty"` // the platform's ID for the message, e.g. a Slack ts or Discord snowflake
 	NotificationID int64      `json:"notification_id,omitempty"`
+	Collapsed      int        `json:"collapsed,omitempty"` // repeats folded into this notification by the cool-down
 	Seen           bool       `json:"seen,omitempty"`
 	SeenAt         *time.Time `json:"seen_at,omitempty"`
 	Mentions       bool       `json:"mentions_agent,omitempty"`
 	Direct         bool       `json:"direct_to_agent,omitempty"`
 	Notify         bool       `json:"notify,omitempty"`
+	NotifyReason   string     `json:"notify_reason,omitempty"` // see the NotifyReason constants
+	Priority       string     `json:"priority,omitempty"`      // set by the classifier on notifications; see the Priority constants
+	Labels         []string   `json:"labels,omitempty"`        // set by the classifier on notifications
 	Text           string     `json:"text"`
+
+	// Status is how far an outbound message got, as the platform's
+	// receipts report it: one of the Status constants, or empty when the
+	// platform sends none. On a receipt it is the status reported.
+	Status string `json:"status,omitempty"`
+
+	// TranslatedText is Text in the language the bot's translate setting
+	// asks for, and Language the detected language of Text. Both are empty
+	// when the message wasn't translated or already was in that language.
+	TranslatedText string `json:"translated_text,omitempty"`
+	Language       string `json:"language,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+
+	// Links is metadata of the pages linked from Text, fetched by the
+	// unfurler on inbound messages.
+	Links []Link `json:"links,omitempty"`
+
+	// Trace is the trace ID of the request that sent an outbound message.
+	Trace string `json:"trace,omitempty"`
+}
+
+// Why an event notifies, in Event.NotifyReason. A notify_on match is
+// NotifyKeyword followed by ":" and the pattern that matched, e.g.
+// "keyword:deploy".
+const (
+	NotifyInteraction = "interaction"
+	NotifyDirect      = "direct"
+	NotifyMention     = "mention"
+	NotifyKeyword     = "keyword"
+	NotifyThread      = "thread" // a conversation the bot has posted in
+)
+
+// Priorities a classifier can give a notification, in Event.Priority.
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityUrgent = "urgent"
+)
+
+// Link is the metadata of a linked page, mostly from its OpenGraph tags.
+type Link struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+	Image       string `json:"image,omitempty"`
+}
+
+// AttachmentAudio is an audio file or voice note. When transcription is
+// configured its transcript becomes the event's Text.
+const AttachmentAudio = "audio"
+
+// Other attachment kinds.
+const (
+	AttachmentImage = "image"
+	AttachmentVideo = "video"
+	AttachmentFile  = "file"
+)
+
+// Attachment describes media carried by a message. The media itself stays
+// on the platform; ID is the platform's handle for it. Path is the file on
+// this machine for platforms that keep media locally (iMessage).
+type Attachment struct {
+	Kind        string  `json:"kind"`
+	ID          string  `json:"id,omitempty"`
+	Name        string  `json:"name,omitempty"`
+	Path        string  `json:"path,omitempty"`
+	MimeType    string  `json:"mime_type,omitempty"`
+	UTI         string  `json:"uti,omitempty"`      // Apple uniform type identifier, e.g. "public.jpeg"
+	Size        int64   `json:"size,omitempty"`     // bytes
+	Duration    float64 `json:"duration,omitempty"` // seconds
+	Voice       bool    `json:"voice,omitempty"`    // recorded in the app rather than an uploaded file
+	Transcribed bool    `json:"transcribed,omitempty"`
 }
@@ -0,0 +1,98 @@
+// Package quiet implements quiet hours: a daily window during which events
+// are stored but don't notify or wake agents.
+package quiet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Window is the daily [Start, End) span of quiet hours. A window whose end
+// is earlier than its start wraps past midnight, e.g. "22:00" to "07:00".
+type Window struct {
+	Start    string // "HH:MM"
+	End      string // "HH:MM"
+	Timezone string // IANA name, e.g. "Europe/Berlin"; empty is local time
+
+	// Defer holds notifications until the window ends instead of dropping
+	// them.
+	Defer bool
+}
+
+// Hours is a compiled Window.
+type Hours struct {
+	from int // minute of the day
+	to   int
+	loc  *time.Location
+	hold bool
+}
+
+// New compiles w. Active and Ends on a nil Hours report no quiet hours.
+func New(w Window) (*Hours, error) {
+	from, err := minuteOfDay(w.Start)
+	if err != nil {
+		return nil, fmt.Errorf("start: %w", err)
+	}
+	to, err := minuteOfDay(w.End)
+	if err != nil {
+		return nil, fmt.Errorf("end: %w", err)
+	}
+	if from == to {
+		return nil, fmt.Errorf("start and end are both %s", w.Start)
+	}
+
+	loc := time.Local
+	if tz := strings.TrimSpace(w.Timezone); tz != "" {
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return nil, fmt.Errorf("timezone: %w", err)
+		}
+	}
+	return &Hours{from: from, to: to, loc: loc, hold: w.Defer}, nil
+}
+
+// Active reports whether now falls in the window.
+func (h *Hours) Active(now time.Time) bool {
+	if h == nil {
+		return false
+	}
+	local := now.In(h.loc)
+	minute := local.Hour()*60 + local.Minute()
+	if h.from < h.to {
+		return minute >= h.from && minute < h.to
+	}
+	return minute >= h.from || minute < h.to
+}
+
+// Ends returns when the window that now falls in ends.
+func (h *Hours) Ends(now time.Time) time.Time {
+	local := now.In(h.loc)
+	end := time.Date(local.Year(), local.Month(), local.Day(), h.to/60, h.to%60, 0, 0, h.loc)
+	if !end.After(local) {
+		end = time.Date(local.Year(), local.Month(), local.Day()+1, h.to/60, h.to%60, 0, 0, h.loc)
+	}
+	return end
+}
+
+// Defers reports whether notifications are held until the window ends
+// rather than dropped.
+func (h *Hours) Defers() bool {
+	return h != nil && h.hold
+}
+
+func minuteOfDay(s string) (int, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	h, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || h < 0 || h > 23 {
+		return 0, fmt.Errorf("invalid hour in %q", s)
+	}
+	m, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || m < 0 || m > 59 {
+		return 0, fmt.Errorf("invalid minute in %q", s)
+	}
+	return h*60 + m, nil
+}
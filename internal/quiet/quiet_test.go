@@ -0,0 +1,73 @@
+package quiet
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActive(t *testing.T) {
+	overnight, err := New(Window{Start: "22:00", End: "07:00", Timezone: "UTC"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	daytime, err := New(Window{Start: "12:00", End: "13:30", Timezone: "UTC"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	at := func(clock string) time.Time {
+		parsed, _ := time.Parse("15:04", clock)
+		return time.Date(2024, 3, 1, parsed.Hour(), parsed.Minute(), 0, 0, time.UTC)
+	}
+	tests := []struct {
+		hours *Hours
+		clock string
+		want  bool
+	}{
+		{overnight, "21:59", false},
+		{overnight, "22:00", true},
+		{overnight, "03:00", true},
+		{overnight, "07:00", false},
+		{daytime, "12:30", true},
+		{daytime, "13:30", false},
+		{nil, "03:00", false},
+	}
+	for _, tt := range tests {
+		if got := tt.hours.Active(at(tt.clock)); got != tt.want {
+			t.Errorf("Active(%s) = %v, want %v", tt.clock, got, tt.want)
+		}
+	}
+}
+
+func TestEnds(t *testing.T) {
+	h, err := New(Window{Start: "22:00", End: "07:00", Timezone: "Europe/Berlin", Defer: true})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+
+	evening := time.Date(2024, 3, 1, 23, 15, 0, 0, berlin)
+	if got, want := h.Ends(evening), time.Date(2024, 3, 2, 7, 0, 0, 0, berlin); !got.Equal(want) {
+		t.Errorf("Ends(evening) = %s, want %s", got, want)
+	}
+	early := time.Date(2024, 3, 2, 5, 0, 0, 0, berlin)
+	if got, want := h.Ends(early), time.Date(2024, 3, 2, 7, 0, 0, 0, berlin); !got.Equal(want) {
+		t.Errorf("Ends(early) = %s, want %s", got, want)
+	}
+	if !h.Defers() {
+		t.Error("expected the window to defer")
+	}
+}
+
+func TestNewRejectsInvalidWindows(t *testing.T) {
+	for _, w := range []Window{
+		{Start: "22:00", End: "22:00"},
+		{Start: "25:00", End: "07:00"},
+		{Start: "22:00", End: "7"},
+		{Start: "22:00", End: "07:00", Timezone: "Mars/Olympus"},
+	} {
+		if _, err := New(w); err == nil {
+			t.Errorf("expected %+v to be rejected", w)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Builtin maps well-known rule names to ready-made patterns so configs can
+// enable common filters by name without writing the regex themselves.
+var Builtin = map[string]string{
+	"api_key":     `\b(?:sk-[A-Za-z0-9_-]{20,}|xox[abposr]-[A-Za-z0-9-]{10,}|gh[pousr]_[A-Za-z0-9]{36,}|AKIA[0-9A-Z]{16}|AIza[0-9A-Za-z_-]{35})\b`,
+	"credit_card": `\b(?:\d[ -]?){12,18}\d\b`,
+	"email":       `\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`,
+}
+
+// Rule is a named pattern whose matches are replaced in event text. When
+// Pattern is empty the name must refer to one of the Builtin patterns. When
+// Replacement is empty matches become "[REDACTED:<name>]".
+type Rule struct {
+	Name        string
+	Pattern     string
+	Replacement string
+}
+
+type compiledRule struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// Redactor applies an ordered set of compiled rules to text.
+type Redactor struct {
+	rules []compiledRule
+}
+
+// New compiles rules into a Redactor. It returns a nil Redactor when rules is
+// empty; Apply on a nil Redactor returns its input unchanged.
+func New(rules []Rule) (*Redactor, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	compiled := make([]compiledRule, 0, len(rules))
+	seen := map[string]struct{}{}
+	for _, rule := range rules {
+		name := strings.TrimSpace(rule.Name)
+		if name == "" {
+			return nil, errors.New("redact rule name cannot be empty")
+		}
+		if _, exists := seen[name]; exists {
+			return nil, fmt.Errorf("duplicate redact rule: %s", name)
+		}
+		seen[name] = struct{}{}
+
+		pattern := rule.Pattern
+		if strings.TrimSpace(pattern) == "" {
+			builtin, ok := Builtin[name]
+			if !ok {
+				return nil, fmt.Errorf("redact rule %q requires pattern (no builtin with that name)", name)
+			}
+			pattern = builtin
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redact rule %q: invalid pattern: %w", name, err)
+		}
+
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = "[REDACTED:" + name + "]"
+		}
+
+		compiled = append(compiled, compiledRule{re: re, replacement: replacement})
+	}
+
+	return &Redactor{rules: compiled}, nil
+}
+
+// Apply returns text with every rule's matches replaced. Replacements are
+// literal; "$1"-style group references are not expanded.
+func (r *Redactor) Apply(text string) string {
+	if r == nil || text == "" {
+		return text
+	}
+
+	for _, rule := range r.rules {
+		text = rule.re.ReplaceAllLiteralString(text, rule.replacement)
+	}
+
+	return text
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/agent"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+)
+
+// recordAgentRun stores a finished agent run for pantalk agents runs.
+func (s *Server) recordAgentRun(run protocol.AgentRun) {
+	s.mu.RLock()
+	st := s.notifications
+	s.mu.RUnlock()
+
+	if st == nil {
+		return
+	}
+	if _, err := st.InsertAgentRun(run); err != nil {
+		log.Printf("[agent:%s] record run failed: %v", run.Agent, err)
+	}
+}
+
+// agentInfos describes the configured agents in config order. With
+// lastRun, each is annotated with its most recent stored run.
+func (s *Server) agentInfos(lastRun bool) []protocol.AgentInfo {
+	s.mu.RLock()
+	runners := s.agents
+	st := s.notifications
+	s.mu.RUnlock()
+
+	agents := make([]protocol.AgentInfo, 0, len(runners))
+	for _, r := range runners {
+		when := r.When()
+		if when == "" {
+			when = "notify"
+		}
+		running, pending := r.State()
+		info := protocol.AgentInfo{
+			Name:    r.Name(),
+			When:    when,
+			Running: running,
+			Pending: pending,
+		}
+
+		if lastRun && st != nil {
+			runs, err := st.ListAgentRuns(r.Name(), 1)
+			if err != nil {
+				log.Printf("[agent:%s] read last run: %v", r.Name(), err)
+			} else if len(runs) > 0 {
+				info.LastRun = &runs[0]
+			}
+		}
+
+		agents = append(agents, info)
+	}
+
+	return agents
+}
+
+// agentRuns returns stored runs for the agent_runs action. Runs of agents
+// removed from the config are still listed by name.
+func (s *Server) agentRuns(req protocol.Request) ([]protocol.AgentRun, error) {
+	s.mu.RLock()
+	st := s.notifications
+	runners := s.agents
+	s.mu.RUnlock()
+
+	if st == nil {
+		return nil, fmt.Errorf("agent run history is unavailable without a database")
+	}
+
+	runs, err := st.ListAgentRuns(req.Agent, req.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(runs) == 0 && req.Agent != "" {
+		known := false
+		for _, r := range runners {
+			if r.Name() == req.Agent {
+				known = true
+			}
+		}
+		if !known {
+			return nil, withCode(protocol.CodeNotFound, fmt.Errorf("unknown agent %q", req.Agent))
+		}
+	}
+
+	return runs, nil
+}
+
+// findAgent returns the runner of the named agent.
+func (s *Server) findAgent(name string) (*agent.Runner, error) {
+	s.mu.RLock()
+	runners := s.agents
+	s.mu.RUnlock()
+
+	for _, r := range runners {
+		if r.Name() == name {
+			return r, nil
+		}
+	}
+	return nil, withCode(protocol.CodeNotFound, fmt.Errorf("unknown agent %q", name))
+}
+
+// storedEvent loads one event by ID, annotated like live events.
+func (s *Server) storedEvent(id int64) (protocol.Event, error) {
+	s.mu.RLock()
+	st := s.notifications
+	s.mu.RUnlock()
+
+	if st == nil {
+		return protocol.Event{}, fmt.Errorf("store is not available")
+	}
+	events, err := st.ListEvents(store.EventFilter{BeforeID: id + 1, Limit: 1})
+	if err != nil {
+		return protocol.Event{}, err
+	}
+	if len(events) == 0 || events[0].ID != id {
+		return protocol.Event{}, withCode(protocol.CodeNotFound, fmt.Errorf("event %d not found", id))
+	}
+	s.annotateSelf(events)
+	return events[0], nil
+}
+
+// runAgent launches an agent on demand for run_agent, optionally with a
+// stored event as if it had triggered the agent. The ack says whether the
+// agent's when expression matches that event, which is the point when
+// testing one.
+func (s *Server) runAgent(req protocol.Request) (string, *protocol.Event, error) {
+	runner, err := s.findAgent(req.Agent)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if req.EventID <= 0 {
+		if err := runner.Trigger(nil, req.Force); err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("launched %s", req.Agent), nil, nil
+	}
+
+	event, err := s.storedEvent(req.EventID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	match := "matches"
+	if !runner.Matches(event) {
+		match = "does not match"
+	}
+	if err := runner.Trigger([]protocol.Event{event}, req.Force); err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("launched %s with event %d (when expression %s it)", req.Agent, event.ID, match), &event, nil
+}
+
+// testAgent evaluates a when expression for test_agent without running
+// anything. The expression is req.When or the when of agent req.Agent; the
+// event is the stored event req.EventID or req.Event as supplied. Ticks are
+// evaluated at their timestamp in the daemon's time zone.
+func (s *Server) testAgent(req protocol.Request) (*protocol.AgentTest, error) {
+	when := req.When
+	includeSelf := false
+	if strings.TrimSpace(when) == "" {
+		if req.Agent == "" {
+			return nil, invalidRequest("when expression or agent is required")
+		}
+		runner, err := s.findAgent(req.Agent)
+		if err != nil {
+			return nil, err
+		}
+		when = runner.When()
+		includeSelf = runner.IncludeSelf()
+	}
+	if strings.TrimSpace(when) == "" {
+		when = "notify"
+	}
+
+	var event protocol.Event
+	switch {
+	case req.EventID > 0:
+		stored, err := s.storedEvent(req.EventID)
+		if err != nil {
+			return nil, err
+		}
+		event = stored
+	case req.Event != nil:
+		event = *req.Event
+	default:
+		return nil, invalidRequest("event_id or event is required")
+	}
+
+	now := time.Now()
+	if event.Kind == "tick" && !event.Timestamp.IsZero() {
+		now = event.Timestamp.Local()
+	}
+
+	s.mu.RLock()
+	lists := s.cfg.Lists
+	s.mu.RUnlock()
+
+	eval, err := agent.Evaluate(when, lists, event, now, includeSelf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &protocol.AgentTest{
+		When:    when,
+		Matched: eval.Matched,
+		Skipped: eval.Skipped,
+		Error:   eval.Error,
+		Env:     eval.Env,
+		Event:   event,
+	}, nil
+}
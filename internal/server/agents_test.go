@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/agent"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+func TestAgentRunsActions(t *testing.T) {
+	st, err := store.Open(filepath.Join(t.TempDir(), "pantalk-agents.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+
+	reviewer, err := agent.NewRunner(agent.Config{Name: "reviewer", Command: agent.Command{"claude"}})
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+	triage, err := agent.NewRunner(agent.Config{Name: "triage", When: "direct", Command: agent.Command{"claude"}})
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+
+	s := &Server{notifications: st, agents: []*agent.Runner{reviewer, triage}}
+
+	started := time.Now().UTC().Add(-time.Minute)
+	s.recordAgentRun(protocol.AgentRun{Agent: "reviewer", StartedAt: started, FinishedAt: started.Add(time.Second), ExitCode: 1, Triggers: 3, Error: "exit status 1"})
+	s.recordAgentRun(protocol.AgentRun{Agent: "gone", StartedAt: started, FinishedAt: started.Add(time.Second)})
+
+	resp := s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionAgents})
+	if !resp.OK || len(resp.Agents) != 2 {
+		t.Fatalf("unexpected agents response: %+v", resp)
+	}
+	if last := resp.Agents[0].LastRun; last == nil || last.ExitCode != 1 || last.Triggers != 3 {
+		t.Errorf("expected reviewer's last run, got %+v", last)
+	}
+	if resp.Agents[1].LastRun != nil || resp.Agents[1].When != "direct" {
+		t.Errorf("triage has never run: %+v", resp.Agents[1])
+	}
+
+	resp = s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionAgentRuns, Agent: "reviewer"})
+	if !resp.OK || len(resp.Runs) != 1 || resp.Runs[0].Error != "exit status 1" {
+		t.Fatalf("unexpected runs response: %+v", resp)
+	}
+
+	// Runs of agents no longer configured stay readable.
+	resp = s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionAgentRuns, Agent: "gone"})
+	if !resp.OK || len(resp.Runs) != 1 {
+		t.Fatalf("expected run of removed agent, got %+v", resp)
+	}
+
+	resp = s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionAgentRuns, Agent: "nobody"})
+	if resp.OK || resp.Error != `unknown agent "nobody"` {
+		t.Fatalf("expected unknown agent error, got %+v", resp)
+	}
+}
+
+func TestRunAgentAction(t *testing.T) {
+	st, err := store.Open(filepath.Join(t.TempDir(), "pantalk-run-agent.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+
+	reviewer, err := agent.NewRunner(agent.Config{Name: "reviewer", When: `text contains "review"`, Command: agent.Command{"sh", "-c", "exit 0"}})
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+
+	s := &Server{
+		notifications: st,
+		agents:        []*agent.Runner{reviewer},
+		bots:          map[string]protocol.BotRef{"slack:ops": {Service: "slack", Name: "ops"}},
+		connectors:    make(map[string]upstream.Connector),
+		routesByBot:   make(map[string]map[string]struct{}),
+		subsByBot:     make(map[string]map[*subscriber]struct{}),
+	}
+	ran := make(chan protocol.AgentRun, 1)
+	reviewer.SetRecordFunc(func(run protocol.AgentRun) { ran <- run })
+
+	publishText(s, "slack", "ops", "please review PR 12")
+
+	resp := s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionRunAgent, Agent: "reviewer", EventID: 1})
+	if !resp.OK || resp.Ack != "launched reviewer with event 1 (when expression matches it)" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if resp.Event == nil || resp.Event.Text != "please review PR 12" {
+		t.Fatalf("expected triggering event in response, got %+v", resp.Event)
+	}
+	select {
+	case run := <-ran:
+		if run.Triggers != 1 {
+			t.Fatalf("unexpected run: %+v", run)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent did not run")
+	}
+
+	// The run just finished, so the agent is in cooldown.
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if running, _ := reviewer.State(); !running {
+			break
+		}
+	}
+	resp = s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionRunAgent, Agent: "reviewer"})
+	if resp.OK || !strings.Contains(resp.Error, "cooldown") {
+		t.Fatalf("expected cooldown error, got %+v", resp)
+	}
+
+	for _, req := range []protocol.Request{
+		{Action: protocol.ActionRunAgent, Agent: "nobody"},
+		{Action: protocol.ActionRunAgent, Agent: "reviewer", EventID: 99, Force: true},
+	} {
+		if resp := s.handleRequest(context.Background(), req); resp.OK {
+			t.Errorf("expected error for %+v", req)
+		}
+	}
+}
+
+func TestTestAgentAction(t *testing.T) {
+	st, err := store.Open(filepath.Join(t.TempDir(), "pantalk-test-agent.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+
+	reviewer, err := agent.NewRunner(agent.Config{Name: "reviewer", When: `text contains "review"`, Command: agent.Command{"sh", "-c", "exit 0"}})
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+
+	s := &Server{
+		notifications: st,
+		agents:        []*agent.Runner{reviewer},
+		bots:          map[string]protocol.BotRef{"slack:ops": {Service: "slack", Name: "ops"}},
+		connectors:    make(map[string]upstream.Connector),
+		routesByBot:   make(map[string]map[string]struct{}),
+		subsByBot:     make(map[string]map[*subscriber]struct{}),
+	}
+	reviewer.SetRecordFunc(func(run protocol.AgentRun) { t.Errorf("test_agent must not run the agent: %+v", run) })
+
+	publishText(s, "slack", "ops", "please review PR 12")
+
+	resp := s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionTestAgent, Agent: "reviewer", EventID: 1})
+	if !resp.OK || resp.Test == nil || !resp.Test.Matched || resp.Test.When != `text contains "review"` {
+		t.Fatalf("expected stored event to match the agent's when, got %+v %+v", resp, resp.Test)
+	}
+	if resp.Test.Env["text"] != "please review PR 12" || resp.Test.Event.ID != 1 {
+		t.Errorf("unexpected env or event: %+v", resp.Test)
+	}
+
+	resp = s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionTestAgent, When: "direct", EventID: 1})
+	if !resp.OK || resp.Test.Matched {
+		t.Fatalf("expected no match, got %+v", resp)
+	}
+
+	tick := protocol.Event{Kind: "tick", Timestamp: time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)}
+	resp = s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionTestAgent, When: `at("09:00")`, Event: &tick})
+	if !resp.OK || !resp.Test.Matched {
+		t.Fatalf("expected supplied tick to be evaluated at its timestamp, got %+v", resp.Test)
+	}
+
+	for _, req := range []protocol.Request{
+		{Action: protocol.ActionTestAgent, EventID: 1},
+		{Action: protocol.ActionTestAgent, When: "notify"},
+		{Action: protocol.ActionTestAgent, When: "text +", EventID: 1},
+		{Action: protocol.ActionTestAgent, Agent: "nobody", EventID: 1},
+		{Action: protocol.ActionTestAgent, When: "notify", EventID: 99},
+	} {
+		if resp := s.handleRequest(context.Background(), req); resp.OK {
+			t.Errorf("expected error for %+v", req)
+		}
+	}
+}
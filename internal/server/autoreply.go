@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/autoreply"
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// autoReplyTimeout bounds a single canned reply send.
+const autoReplyTimeout = 30 * time.Second
+
+func (s *Server) responder(key string) *autoreply.Responder {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.responders[key]
+}
+
+// sendAutoReply answers event in the conversation it arrived on. It goes
+// through the same connector gate as client sends so reloads drain it, but
+// it deliberately does not mark participation: a canned reply should not
+// make the rest of the conversation notify.
+func (s *Server) sendAutoReply(key string, event protocol.Event, reply autoreply.Reply) {
+	parent := s.rootCtx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(parent, autoReplyTimeout)
+	defer cancel()
+
+	// The rule's cool-down starts only once the reply went out. Reloads
+	// may replace the responder meanwhile; the current one is told.
+	sent := false
+	defer func() {
+		if sent {
+			s.responder(key).Sent(reply, time.Now())
+		} else {
+			s.responder(key).Failed(reply)
+		}
+	}()
+
+	connector, gate, err := s.acquireConnector(ctx, key)
+	if err != nil || connector == nil {
+		return
+	}
+	defer gate.leave()
+
+	// Connectors set Target to the canonical reply address (e.g. "dm:alice"
+	// on IRC), so prefer it over the raw channel.
+	req := protocol.Request{
+		Action:  protocol.ActionSend,
+		Service: event.Service,
+		Bot:     event.Bot,
+		Target:  event.Target,
+		Thread:  event.Thread,
+		Text:    reply.Text,
+	}
+	if req.Target == "" {
+		req.Channel = event.Channel
+	}
+
+	if _, err := connector.Send(ctx, req); err != nil {
+		log.Printf("[%s] auto-reply to %s failed: %v", key, event.User, err)
+		return
+	}
+	sent = true
+	log.Printf("[%s] auto-replied to %s on %s", key, event.User, event.Channel)
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/autoreply"
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+type recordingConnector struct {
+	idleConnector
+	sent chan protocol.Request
+}
+
+func (c *recordingConnector) Send(_ context.Context, req protocol.Request) (protocol.Event, error) {
+	c.sent <- req
+	return protocol.Event{}, nil
+}
+
+func TestPublish_SendsAutoReplyOncePerUser(t *testing.T) {
+	responder, err := autoreply.New([]autoreply.Rule{{
+		Name:  "maintenance",
+		When:  "direct",
+		Reply: "Hi {{.User}}, we're down for maintenance.",
+	}})
+	if err != nil {
+		t.Fatalf("compile rules: %v", err)
+	}
+
+	connector := &recordingConnector{idleConnector: idleConnector{name: "B0T"}, sent: make(chan protocol.Request, 4)}
+	s := &Server{
+		bots:        map[string]protocol.BotRef{"slack:ops": {Service: "slack", Name: "ops"}},
+		connectors:  map[string]upstream.Connector{"slack:ops": connector},
+		responders:  map[string]*autoreply.Responder{"slack:ops": responder},
+		routesByBot: make(map[string]map[string]struct{}),
+		subsByBot:   make(map[string]map[*subscriber]struct{}),
+	}
+
+	dm := protocol.Event{
+		Service:   "slack",
+		Bot:       "ops",
+		Kind:      "message",
+		Direction: "in",
+		User:      "U1",
+		Target:    "dm:U1",
+		Channel:   "D1",
+		Text:      "is the deploy stuck?",
+		Direct:    true,
+	}
+	s.publish(dm)
+	s.publish(dm)
+
+	select {
+	case req := <-connector.sent:
+		if req.Text != "Hi U1, we're down for maintenance." {
+			t.Fatalf("unexpected reply text: %q", req.Text)
+		}
+		if req.Target != "dm:U1" || req.Channel != "" {
+			t.Fatalf("reply not addressed to the sender: %+v", req)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no auto-reply sent")
+	}
+
+	select {
+	case req := <-connector.sent:
+		t.Fatalf("second message within cool-down was answered: %+v", req)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if s.hasParticipation("slack:ops", dm.Target, dm.Channel, dm.Thread) {
+		t.Fatal("auto-reply marked the conversation as participated")
+	}
+}
+
+// flakyConnector fails its first send.
+type flakyConnector struct {
+	recordingConnector
+	failed chan struct{}
+}
+
+func (c *flakyConnector) Send(ctx context.Context, req protocol.Request) (protocol.Event, error) {
+	select {
+	case <-c.failed:
+		return c.recordingConnector.Send(ctx, req)
+	default:
+		close(c.failed)
+		return protocol.Event{}, errors.New("rate limited")
+	}
+}
+
+func TestPublish_FailedAutoReplyDoesNotStartCooldown(t *testing.T) {
+	responder, err := autoreply.New([]autoreply.Rule{{Name: "maintenance", When: "direct", Reply: "down for maintenance"}})
+	if err != nil {
+		t.Fatalf("compile rules: %v", err)
+	}
+
+	connector := &flakyConnector{
+		recordingConnector: recordingConnector{idleConnector: idleConnector{name: "B0T"}, sent: make(chan protocol.Request, 4)},
+		failed:             make(chan struct{}),
+	}
+	s := &Server{
+		bots:        map[string]protocol.BotRef{"slack:ops": {Service: "slack", Name: "ops"}},
+		connectors:  map[string]upstream.Connector{"slack:ops": connector},
+		responders:  map[string]*autoreply.Responder{"slack:ops": responder},
+		routesByBot: make(map[string]map[string]struct{}),
+		subsByBot:   make(map[string]map[*subscriber]struct{}),
+	}
+
+	dm := protocol.Event{Service: "slack", Bot: "ops", Kind: "message", Direction: "in", User: "U1", Target: "dm:U1", Channel: "D1", Text: "hello?", Direct: true}
+	s.publish(dm)
+	select {
+	case <-connector.failed:
+	case <-time.After(time.Second):
+		t.Fatal("no auto-reply attempted")
+	}
+
+	// The failure is reported after Send returns.
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.publish(dm)
+		select {
+		case <-connector.sent:
+			return
+		case <-time.After(20 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the failed reply not to start the cool-down")
+		}
+	}
+}
+
+func TestStartConnectors_KeepsAutoReplyCooldowns(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bot := mockBot("a", "mock://a")
+	bot.AutoReply = []config.AutoReplyConfig{{Name: "maintenance", Reply: "down for maintenance"}}
+	cfg := config.Config{Bots: []config.BotConfig{bot}}
+	s := New(cfg, "", "", "")
+	s.rootCtx = ctx
+	if err := s.startConnectors(cfg); err != nil {
+		t.Fatalf("start connectors: %v", err)
+	}
+
+	dm := protocol.Event{Service: "custom", Bot: "a", Kind: "message", Direction: "in", User: "U1", Channel: "D1", Text: "hello?"}
+	now := time.Now()
+	reply, ok := s.responder("custom:a").Reply(dm, now)
+	if !ok {
+		t.Fatal("expected a reply")
+	}
+	s.responder("custom:a").Sent(reply, now)
+
+	bot.AutoReply = append(bot.AutoReply, config.AutoReplyConfig{Name: "other", When: "false", Reply: "never"})
+	if err := s.startConnectors(config.Config{Bots: []config.BotConfig{bot}}); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if _, ok := s.responder("custom:a").Reply(dm, now.Add(time.Minute)); ok {
+		t.Fatal("expected the reload to keep the cool-down")
+	}
+}
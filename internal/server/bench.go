@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+// Shape of the synthetic traffic: messages rotate through these many
+// channels and users, and every benchMentionEvery-th one mentions the bot
+// so the notification path is exercised too.
+const (
+	benchChannels     = 8
+	benchUsers        = 32
+	benchMentionEvery = 20
+)
+
+// benchDrain bounds the wait for subscribers to read what is queued once
+// the generator stops.
+const benchDrain = 5 * time.Second
+
+// BenchOptions configures Bench.
+type BenchOptions struct {
+	EventsPerSec int           // inbound messages generated per second
+	Duration     time.Duration // how long to generate them
+	Subscribers  int           // subscriptions reading every event
+	Buffer       int           // queue of each subscription (default defaultSubscriberBuffer)
+	ReadDelay    time.Duration // time a subscriber spends per event, to model slow clients
+	DBPath       string        // database to write (default: a temporary one)
+}
+
+// Latency summarises a set of measured durations.
+type Latency struct {
+	Count int           `json:"count"`
+	P50   time.Duration `json:"p50_ns"`
+	P90   time.Duration `json:"p90_ns"`
+	P99   time.Duration `json:"p99_ns"`
+	Max   time.Duration `json:"max_ns"`
+}
+
+// BenchReport is what Bench measured.
+type BenchReport struct {
+	Published  int           `json:"published"`
+	Elapsed    time.Duration `json:"elapsed_ns"`
+	Rate       float64       `json:"rate"`        // events published per second
+	StoreWrite Latency       `json:"store_write"` // writing each event to the database
+	Publish    Latency       `json:"publish"`     // the whole publish path of an event
+	FanOut     Latency       `json:"fan_out"`     // from the connector until a subscriber reads the event
+	Delivered  int64         `json:"delivered"`   // events read by subscribers
+	Dropped    int64         `json:"dropped"`     // events subscribers missed with a full queue
+	DropRate   float64       `json:"drop_rate"`   // dropped / (delivered + dropped)
+}
+
+// Bench drives synthetic inbound messages through a mock connector at a
+// fixed rate, through the same publish path the daemon uses: filtering,
+// notification rules, the store and subscriber fan-out. It runs in
+// process, with its own database and no socket, so it can run next to a
+// live daemon. Log output is discarded while it runs. Cancelling ctx ends
+// the run early with what was measured so far.
+func Bench(ctx context.Context, opts BenchOptions) (BenchReport, error) {
+	if opts.EventsPerSec <= 0 {
+		return BenchReport{}, errors.New("events per second must be positive")
+	}
+	if opts.Duration <= 0 {
+		return BenchReport{}, errors.New("duration must be positive")
+	}
+	if opts.Subscribers < 0 {
+		return BenchReport{}, errors.New("subscribers cannot be negative")
+	}
+
+	dbPath := opts.DBPath
+	if dbPath == "" {
+		dir, err := os.MkdirTemp("", "pantalk-bench-")
+		if err != nil {
+			return BenchReport{}, fmt.Errorf("create bench directory: %w", err)
+		}
+		defer os.RemoveAll(dir)
+		dbPath = filepath.Join(dir, "bench.db")
+	}
+	st, err := store.Open(dbPath)
+	if err != nil {
+		return BenchReport{}, fmt.Errorf("open bench store: %w", err)
+	}
+	defer st.Close()
+
+	echo := false
+	bot := config.BotConfig{Name: "bench", Type: "mock", Mock: &config.MockConfig{Echo: &echo}}
+	cfg := config.Config{Server: config.ServerConfig{DBPath: dbPath}, Bots: []config.BotConfig{bot}}
+	key := botKey(bot.Type, bot.Name)
+
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(output)
+
+	s := New(cfg, "", "", "")
+	s.notifications = st
+	var storeMu sync.Mutex
+	var storeWrites []time.Duration
+	s.storeProbe = func(took time.Duration) {
+		storeMu.Lock()
+		storeWrites = append(storeWrites, took)
+		storeMu.Unlock()
+	}
+	// Inject needs no session, so the connector isn't run.
+	connector, err := upstream.NewMockBotConnector(bot, s.publish)
+	if err != nil {
+		return BenchReport{}, err
+	}
+	s.bots[key] = protocol.BotRef{Service: bot.Type, Name: bot.Name}
+	s.connectors[key] = connector
+
+	subs := make([]*subscriber, opts.Subscribers)
+	fanOut := make([][]time.Duration, opts.Subscribers)
+	var readers sync.WaitGroup
+	for i := range subs {
+		subs[i] = s.subscribe([]string{key}, opts.Buffer, false, false)
+		readers.Add(1)
+		go func(i int) {
+			defer readers.Done()
+			for event := range subs[i].events {
+				if event.Kind != "message" {
+					continue
+				}
+				fanOut[i] = append(fanOut[i], time.Since(event.Timestamp))
+				if opts.ReadDelay > 0 {
+					time.Sleep(opts.ReadDelay)
+				}
+			}
+		}(i)
+	}
+
+	interval := time.Second / time.Duration(opts.EventsPerSec)
+	var publishes []time.Duration
+	start := time.Now()
+	deadline := start.Add(opts.Duration)
+generate:
+	for i := 0; ; i++ {
+		next := start.Add(time.Duration(i) * interval)
+		if !next.Before(deadline) {
+			break
+		}
+		if wait := time.Until(next); wait > 0 {
+			select {
+			case <-ctx.Done():
+				break generate
+			case <-time.After(wait):
+			}
+		}
+
+		text := fmt.Sprintf("synthetic message %d", i)
+		if i%benchMentionEvery == 0 {
+			text = "@bench " + text
+		}
+		begin := time.Now()
+		connector.Inject(config.MockMessage{
+			Channel: fmt.Sprintf("bench-%d", i%benchChannels),
+			User:    fmt.Sprintf("user-%d", i%benchUsers),
+			Text:    text,
+		})
+		publishes = append(publishes, time.Since(begin))
+	}
+	elapsed := time.Since(start)
+
+	// Give subscribers the chance to read what is still queued, then
+	// close them so the readers finish.
+	drainBy := time.Now().Add(benchDrain)
+	for _, sub := range subs {
+		for len(sub.events) > 0 && time.Now().Before(drainBy) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	var dropped int64
+	s.mu.RLock()
+	for _, sub := range subs {
+		dropped += sub.dropped
+	}
+	s.mu.RUnlock()
+	for _, sub := range subs {
+		s.unsubscribe(sub)
+	}
+	readers.Wait()
+
+	report := BenchReport{
+		Published: len(publishes),
+		Elapsed:   elapsed,
+		Rate:      float64(len(publishes)) / elapsed.Seconds(),
+		Publish:   summarize(publishes),
+		Dropped:   dropped,
+	}
+	storeMu.Lock()
+	report.StoreWrite = summarize(storeWrites)
+	storeMu.Unlock()
+	report.FanOut = summarize(slices.Concat(fanOut...))
+	report.Delivered = int64(report.FanOut.Count)
+	if total := report.Delivered + report.Dropped; total > 0 {
+		report.DropRate = float64(report.Dropped) / float64(total)
+	}
+	return report, nil
+}
+
+// summarize returns the percentiles of samples, which it sorts.
+func summarize(samples []time.Duration) Latency {
+	if len(samples) == 0 {
+		return Latency{}
+	}
+	slices.Sort(samples)
+	at := func(p float64) time.Duration {
+		return samples[int(p*float64(len(samples)-1))]
+	}
+	return Latency{
+		Count: len(samples),
+		P50:   at(0.50),
+		P90:   at(0.90),
+		P99:   at(0.99),
+		Max:   samples[len(samples)-1],
+	}
+}
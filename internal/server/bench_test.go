@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBench(t *testing.T) {
+	report, err := Bench(context.Background(), BenchOptions{EventsPerSec: 200, Duration: 250 * time.Millisecond, Subscribers: 2})
+	if err != nil {
+		t.Fatalf("bench: %v", err)
+	}
+	if report.Published < 40 || report.Published > 50 {
+		t.Fatalf("expected about 50 events, published %d", report.Published)
+	}
+	if report.StoreWrite.Count != report.Published || report.Publish.Count != report.Published {
+		t.Fatalf("expected a store write and publish sample per event, got %+v", report)
+	}
+	if report.Delivered != int64(2*report.Published) || report.Dropped != 0 {
+		t.Fatalf("expected every event delivered to both subscribers, got %d delivered, %d dropped", report.Delivered, report.Dropped)
+	}
+	if report.FanOut.P50 <= 0 || report.FanOut.P50 > report.FanOut.Max {
+		t.Fatalf("unexpected fan-out latency %+v", report.FanOut)
+	}
+}
+
+func TestBench_SlowSubscriberDrops(t *testing.T) {
+	report, err := Bench(context.Background(), BenchOptions{EventsPerSec: 500, Duration: 200 * time.Millisecond, Subscribers: 1, Buffer: 1, ReadDelay: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("bench: %v", err)
+	}
+	if report.Dropped == 0 || report.DropRate <= 0 || report.DropRate >= 1 {
+		t.Fatalf("expected a slow subscriber to drop events, got %+v", report)
+	}
+}
+
+func TestBench_Options(t *testing.T) {
+	for _, opts := range []BenchOptions{{Duration: time.Second}, {EventsPerSec: 10}, {EventsPerSec: 10, Duration: time.Second, Subscribers: -1}} {
+		if _, err := Bench(context.Background(), opts); err == nil {
+			t.Fatalf("expected %+v to be rejected", opts)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	samples := make([]time.Duration, 0, 100)
+	for i := 100; i >= 1; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	got := summarize(samples)
+	want := Latency{Count: 100, P50: 50 * time.Millisecond, P90: 90 * time.Millisecond, P99: 99 * time.Millisecond, Max: 100 * time.Millisecond}
+	if got != want {
+		t.Fatalf("summarize = %+v, want %+v", got, want)
+	}
+	if (summarize(nil) != Latency{}) {
+		t.Fatal("expected no samples to summarise to zero")
+	}
+}
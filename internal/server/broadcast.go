@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/trace"
+)
+
+// broadcast sends req.Text to every destination of the broadcast group
+// req.Group at once. The response carries one result per destination and
+// is OK only when all of them succeeded.
+func (s *Server) broadcast(ctx context.Context, req protocol.Request) protocol.Response {
+	group := strings.TrimSpace(req.Group)
+	if group == "" {
+		return protocol.Response{OK: false, Error: "group is required", Code: protocol.CodeInvalidRequest}
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		return protocol.Response{OK: false, Error: "text is required", Code: protocol.CodeInvalidRequest}
+	}
+
+	s.mu.RLock()
+	targets, ok := s.cfg.BroadcastGroups[group]
+	s.mu.RUnlock()
+	if !ok {
+		return protocol.Response{OK: false, Error: fmt.Sprintf("unknown broadcast group %q", group), Code: protocol.CodeUnknownBot}
+	}
+
+	results := make([]protocol.BroadcastResult, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each destination gets its own span, so concurrent sends don't
+			// share one.
+			sendCtx, span := trace.Start(ctx, protocol.ActionSend)
+			resp := s.send(sendCtx, protocol.Request{
+				Action:  protocol.ActionSend,
+				Service: target.Service,
+				Bot:     target.Bot,
+				Channel: target.Channel,
+				Thread:  target.Thread,
+				Text:    req.Text,
+				Format:  req.Format,
+			})
+			result := protocol.BroadcastResult{
+				Service: target.Service,
+				Bot:     target.Bot,
+				Channel: target.Channel,
+				Thread:  target.Thread,
+				OK:      resp.OK,
+				Error:   resp.Error,
+				Code:    resp.Code,
+				Event:   resp.Event,
+			}
+			if service, _, err := s.resolveBotService(target.Service, target.Bot); err == nil {
+				result.Service = service
+			}
+			span.Finish(responseErr(resp))
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+
+	// The response carries the failures' code when they share one.
+	failed, code := 0, ""
+	for _, result := range results {
+		if result.OK {
+			continue
+		}
+		failed++
+		switch code {
+		case "":
+			code = result.Code
+		case result.Code:
+		default:
+			code = protocol.CodeUpstream
+		}
+	}
+	if failed > 0 {
+		return protocol.Response{OK: false, Error: fmt.Sprintf("%d of %d destinations failed", failed, len(results)), Code: code, Results: results}
+	}
+	return protocol.Response{OK: true, Ack: fmt.Sprintf("sent to %d destinations", len(results)), Results: results}
+}
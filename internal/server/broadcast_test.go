@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func TestHandleRequest_Broadcast(t *testing.T) {
+	s := newReplayServer(t)
+	slackOps := &recordingConnector{idleConnector: idleConnector{name: "ops"}, sent: make(chan protocol.Request, 4)}
+	s.connectors["slack:ops"] = slackOps
+	s.connectors["discord:ops"] = &idleConnector{name: "ops"}
+	s.cfg.BroadcastGroups = map[string][]config.BroadcastTarget{
+		"oncall": {
+			{Service: "slack", Bot: "ops", Channel: "C1"},
+			{Service: "discord", Bot: "ops", Thread: "T1"},
+		},
+		"everyone": {
+			{Service: "slack", Bot: "ops", Channel: "C1"},
+			{Bot: "other", Channel: "C2"}, // no connector
+		},
+	}
+
+	broadcast := func(group string) protocol.Response {
+		return s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionBroadcast, Group: group, Text: "deploy at 5pm", Format: "markdown"})
+	}
+
+	resp := broadcast("oncall")
+	if !resp.OK || resp.Ack != "sent to 2 destinations" || len(resp.Results) != 2 {
+		t.Fatalf("broadcast failed: %+v", resp)
+	}
+	if got := resp.Results[1]; got.Service != "discord" || got.Thread != "T1" || !got.OK {
+		t.Fatalf("expected results in group order, got %+v", resp.Results)
+	}
+	sent := <-slackOps.sent
+	if sent.Channel != "C1" || sent.Text != "deploy at 5pm" || sent.Format != "markdown" {
+		t.Fatalf("unexpected send %+v", sent)
+	}
+
+	resp = broadcast("everyone")
+	if resp.OK || resp.Error != "1 of 2 destinations failed" || len(resp.Results) != 2 {
+		t.Fatalf("expected a partial failure, got %+v", resp)
+	}
+	if got := resp.Results[1]; got.OK || got.Service != "slack" || !strings.Contains(got.Error, `unknown bot "other"`) {
+		t.Fatalf("expected the failed destination to be reported, got %+v", got)
+	}
+	if !resp.Results[0].OK {
+		t.Fatalf("expected the other destination to succeed, got %+v", resp.Results[0])
+	}
+
+	if resp := broadcast("nope"); resp.OK || !strings.Contains(resp.Error, `unknown broadcast group "nope"`) {
+		t.Fatalf("expected an unknown group error, got %+v", resp)
+	}
+}
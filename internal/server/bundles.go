@@ -0,0 +1,141 @@
+package server
+
+import (
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// maxBundledConversations caps how many conversations a by-conversation
+// subscription keeps messages of. The least recently active one is dropped
+// and read back from the store if it comes up again.
+const maxBundledConversations = 256
+
+// bundleEncoder writes the messages of a by-conversation subscription as
+// bundles of the last limit messages of their conversation. Other events
+// go through as they are; edits, deletions and receipts also update the
+// messages kept. It is only used by the subscription's goroutine.
+type bundleEncoder struct {
+	s     *Server
+	next  responseEncoder
+	limit int
+
+	conversations map[string]*bundledConversation
+	tick          uint64
+}
+
+// bundledConversation is what a bundleEncoder keeps of one conversation.
+type bundledConversation struct {
+	messages []protocol.Event
+	active   uint64 // tick of the last message
+}
+
+func (s *Server) newBundleEncoder(next responseEncoder, limit int) *bundleEncoder {
+	return &bundleEncoder{
+		s:             s,
+		next:          next,
+		limit:         limit,
+		conversations: make(map[string]*bundledConversation),
+	}
+}
+
+func (b *bundleEncoder) Encode(v any) error {
+	resp, ok := v.(protocol.Response)
+	if !ok || resp.Event == nil {
+		return b.next.Encode(v)
+	}
+	ev := *resp.Event
+	switch {
+	case ev.Kind == "message" && (ev.Channel != "" || ev.Thread != ""):
+		return b.next.Encode(protocol.Response{OK: true, Bundle: b.add(ev)})
+	case ev.Kind == protocol.KindEdit || ev.Kind == protocol.KindDelete:
+		b.update(ev, strings.TrimPrefix(ev.Target, "post:"))
+	case ev.Kind == protocol.KindReceipt:
+		b.update(ev, ev.MessageID)
+	}
+	return b.next.Encode(v)
+}
+
+// add appends ev to its conversation, reading the messages before it from
+// the store the first time the conversation comes up, and returns the
+// conversation's bundle.
+func (b *bundleEncoder) add(ev protocol.Event) *protocol.Bundle {
+	b.tick++
+	key := bundleKey(ev)
+	conv, ok := b.conversations[key]
+	if !ok {
+		conv = &bundledConversation{}
+		if b.limit > 1 && ev.ID > 0 {
+			earlier, err := b.s.conversationContext(ev, b.limit-1)
+			if err != nil {
+				log.Printf("[%s] bundle %s: %v", botKey(ev.Service, ev.Bot), key, err)
+			}
+			conv.messages = earlier
+		}
+		b.conversations[key] = conv
+	}
+	conv.active = b.tick
+	if !ok {
+		b.evict()
+	}
+	conv.messages = append(conv.messages, ev)
+	if extra := len(conv.messages) - b.limit; extra > 0 {
+		conv.messages = slices.Delete(conv.messages, 0, extra)
+	}
+
+	return &protocol.Bundle{
+		Service:  ev.Service,
+		Bot:      ev.Bot,
+		Channel:  ev.Channel,
+		Thread:   ev.Thread,
+		Messages: slices.Clone(conv.messages),
+	}
+}
+
+// update applies an edit, deletion or receipt to the kept message messageID.
+func (b *bundleEncoder) update(ev protocol.Event, messageID string) {
+	if messageID == "" {
+		return
+	}
+	conv, ok := b.conversations[bundleKey(ev)]
+	if !ok {
+		return
+	}
+	for i, message := range conv.messages {
+		if message.MessageID != messageID {
+			continue
+		}
+		switch ev.Kind {
+		case protocol.KindEdit:
+			conv.messages[i].Text = ev.Text
+		case protocol.KindDelete:
+			conv.messages = slices.Delete(conv.messages, i, i+1)
+		case protocol.KindReceipt:
+			conv.messages[i].Status = ev.Status
+		}
+		return
+	}
+}
+
+// evict drops the least recently active conversation once there are more
+// than maxBundledConversations.
+func (b *bundleEncoder) evict() {
+	if len(b.conversations) <= maxBundledConversations {
+		return
+	}
+	var oldest string
+	for key, conv := range b.conversations {
+		if oldest == "" || conv.active < b.conversations[oldest].active {
+			oldest = key
+		}
+	}
+	delete(b.conversations, oldest)
+}
+
+// bundleKey identifies the conversation of ev: its thread, or its
+// channel when it is not in one.
+func bundleKey(ev protocol.Event) string {
+	return botKey(ev.Service, ev.Bot) + "|" + ev.Channel + "|" + ev.Thread
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func nextBundle(t *testing.T, decoder *json.Decoder) protocol.Bundle {
+	t.Helper()
+	var resp protocol.Response
+	if err := decoder.Decode(&resp); err != nil {
+		t.Fatalf("read bundle: %v", err)
+	}
+	if !resp.OK || resp.Bundle == nil {
+		t.Fatalf("expected bundle, got %+v", resp)
+	}
+	return *resp.Bundle
+}
+
+func bundleTexts(bundle protocol.Bundle) []string {
+	texts := make([]string, 0, len(bundle.Messages))
+	for _, message := range bundle.Messages {
+		texts = append(texts, message.Text)
+	}
+	return texts
+}
+
+func TestHandleSubscribe_ByConversation(t *testing.T) {
+	s := newReplayServer(t)
+	message := func(thread string, id string, text string) {
+		s.publish(protocol.Event{Service: "slack", Bot: "ops", Kind: "message", Direction: "in", Channel: "C1", Thread: thread, MessageID: id, Text: text})
+	}
+	message("", "1", "one")
+	message("", "2", "two")
+	message("", "3", "three")
+
+	decoder := subscribeStream(t, s, protocol.Request{
+		Action:         protocol.ActionSubscribe,
+		Service:        "slack",
+		Bot:            "ops",
+		Limit:          3,
+		ByConversation: true,
+	})
+
+	message("", "4", "four")
+	bundle := nextBundle(t, decoder)
+	if bundle.Channel != "C1" || bundle.Thread != "" || len(bundle.Messages) != 3 {
+		t.Fatalf("unexpected bundle %+v", bundle)
+	}
+	if got := bundleTexts(bundle); got[0] != "two" || got[1] != "three" || got[2] != "four" {
+		t.Fatalf("expected the stored messages before the new one, got %v", got)
+	}
+
+	message("4", "5", "in a thread")
+	if bundle := nextBundle(t, decoder); bundle.Thread != "4" || len(bundle.Messages) != 1 {
+		t.Fatalf("expected the thread as its own conversation, got %+v", bundle)
+	}
+
+	s.publish(protocol.Event{Service: "slack", Bot: "ops", Kind: protocol.KindEdit, Direction: "in", Channel: "C1", Target: "post:4", Text: "four, edited"})
+	if ev := nextEvent(t, decoder); ev.Kind != protocol.KindEdit {
+		t.Fatalf("expected the edit streamed as an event, got %+v", ev)
+	}
+
+	message("", "6", "six")
+	if got := bundleTexts(nextBundle(t, decoder)); len(got) != 3 || got[0] != "three" || got[1] != "four, edited" || got[2] != "six" {
+		t.Fatalf("expected the last three messages with the edit applied, got %v", got)
+	}
+}
+
+func TestHandleSubscribe_ByConversationInvalidLimit(t *testing.T) {
+	s := newReplayServer(t)
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go s.handleSubscribe(context.Background(), protocol.Request{
+		Action:         protocol.ActionSubscribe,
+		Limit:          maxContextLimit + 1,
+		ByConversation: true,
+	}, json.NewEncoder(serverConn))
+
+	var resp protocol.Response
+	if err := json.NewDecoder(clientConn).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.OK || resp.Code != protocol.CodeInvalidRequest {
+		t.Fatalf("expected subscribe to fail, got %+v", resp)
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// unsupported is the error text for a request the bot's connector has no
+// capability for, e.g. `irc bot "ops" does not support reactions`.
+func unsupported(service, bot, feature string) string {
+	return fmt.Sprintf("%s bot %q does not support %s", service, bot, feature)
+}
+
+// botCapabilities reports the capabilities of the connector running key.
+// ok is false when no connector runs for it.
+func (s *Server) botCapabilities(key string) (caps protocol.Capabilities, ok bool) {
+	s.mu.RLock()
+	connector := s.connectors[key]
+	s.mu.RUnlock()
+	if connector == nil {
+		return protocol.Capabilities{}, false
+	}
+	return connector.Capabilities(), true
+}
+
+// maxSendParts bounds how many messages one send may be split into. Past
+// that, a long text floods the conversation and is better sent as a file.
+const maxSendParts = 10
+
+// checkTextLength refuses text too long to send through a connector that
+// posts at most maxText characters per message.
+func checkTextLength(text, service string, maxText int) error {
+	if maxText <= 0 {
+		return nil
+	}
+	limit := maxText * maxSendParts
+	if n := utf8.RuneCountInString(strings.TrimSpace(text)); n > limit {
+		return invalidRequest("text is %d characters; %s accepts at most %d per send (%d messages of %d); shorten it or attach it with --file", n, service, limit, maxSendParts, maxText)
+	}
+	return nil
+}
+
+// truncatedNote ends agent output cut to fit maxSendParts messages.
+const truncatedNote = "\n… (output truncated)"
+
+// fitSendParts cuts text to the most checkTextLength accepts for maxText,
+// marking the cut, so long agent output is posted rather than refused.
+func fitSendParts(text string, maxText int) string {
+	runes := []rune(strings.TrimSpace(text))
+	limit := maxText * maxSendParts
+	if maxText <= 0 || len(runes) <= limit {
+		return text
+	}
+	return strings.TrimSpace(string(runes[:limit-utf8.RuneCountInString(truncatedNote)])) + truncatedNote
+}
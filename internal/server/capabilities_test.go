@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// barebonesConnector has none of the optional capabilities, like IRC.
+type barebonesConnector struct{ recordingConnector }
+
+func (c *barebonesConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{}
+}
+
+func TestHandleRequest_UnsupportedCapabilities(t *testing.T) {
+	s := newReplayServer(t)
+	bare := &barebonesConnector{recordingConnector{idleConnector: idleConnector{name: "ops"}, sent: make(chan protocol.Request, 1)}}
+	s.connectors["discord:ops"] = bare
+
+	tests := []struct {
+		name string
+		req  protocol.Request
+		want string
+	}{
+		{name: "react", req: protocol.Request{Action: protocol.ActionReact, Channel: "C1", Thread: "1", Emoji: "eyes"}, want: `discord bot "ops" does not support reactions`},
+		{name: "thread", req: protocol.Request{Action: protocol.ActionSend, Channel: "C1", Thread: "1", Text: "hi"}, want: `discord bot "ops" does not support threads`},
+		{name: "interactive", req: protocol.Request{Action: protocol.ActionSend, Channel: "C1", Text: "ok?", Interactive: &protocol.Interactive{Buttons: []protocol.Button{{Label: "Yes", Value: "yes"}}}}, want: "does not support interactive messages"},
+		{name: "presence", req: protocol.Request{Action: protocol.ActionPresence, Presence: &protocol.Presence{State: "away"}}, want: `discord bot "ops" does not support presence`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.Service, tt.req.Bot = "discord", "ops"
+			resp := s.handleRequest(context.Background(), tt.req)
+			if resp.OK || !strings.Contains(resp.Error, tt.want) {
+				t.Fatalf("expected error containing %q, got %+v", tt.want, resp)
+			}
+		})
+	}
+
+	select {
+	case req := <-bare.sent:
+		t.Fatalf("refused request reached the connector: %+v", req)
+	default:
+	}
+}
+
+// shortTextConnector posts at most 5 characters per message.
+type shortTextConnector struct{ recordingConnector }
+
+func (c *shortTextConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{MaxText: 5}
+}
+
+func TestSend_TextLengthLimit(t *testing.T) {
+	s := newReplayServer(t)
+	short := &shortTextConnector{recordingConnector{idleConnector: idleConnector{name: "ops"}, sent: make(chan protocol.Request, 1)}}
+	s.connectors["discord:ops"] = short
+
+	resp := s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionSend, Service: "discord", Bot: "ops", Channel: "C1", Text: strings.Repeat("x", 51)})
+	if resp.OK || !strings.Contains(resp.Error, "text is 51 characters; discord accepts at most 50") {
+		t.Fatalf("expected the long text refused, got %+v", resp)
+	}
+
+	text := "line one\n\n  line two\n"
+	resp = s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionSend, Service: "discord", Bot: "ops", Channel: "C1", Text: text})
+	if !resp.OK {
+		t.Fatalf("expected text within the limit sent, got %+v", resp)
+	}
+	if req := <-short.sent; req.Text != text {
+		t.Fatalf("expected the text passed on verbatim, got %q", req.Text)
+	}
+}
+
+func TestAgentReply_TruncatesToSendParts(t *testing.T) {
+	s := newReplayServer(t)
+	short := &shortTextConnector{recordingConnector{idleConnector: idleConnector{name: "ops"}, sent: make(chan protocol.Request, 1)}}
+	s.connectors["discord:ops"] = short
+
+	// A send of this is refused; an agent reply is cut to what fits.
+	if err := s.agentReply(context.Background(), protocol.Request{Service: "discord", Bot: "ops", Channel: "C1", Text: strings.Repeat("x", 80)}); err != nil {
+		t.Fatalf("agent reply: %v", err)
+	}
+	req := <-short.sent
+	if n := len([]rune(req.Text)); n != 5*maxSendParts || !strings.HasSuffix(req.Text, truncatedNote) {
+		t.Fatalf("expected the reply cut to %d characters with a note, got %d: %q", 5*maxSendParts, n, req.Text)
+	}
+}
+
+func TestAgentReply_DropsThreadWithoutThreads(t *testing.T) {
+	s := newReplayServer(t)
+	bare := &barebonesConnector{recordingConnector{idleConnector: idleConnector{name: "ops"}, sent: make(chan protocol.Request, 1)}}
+	s.connectors["discord:ops"] = bare
+
+	if err := s.agentReply(context.Background(), protocol.Request{Service: "discord", Bot: "ops", Channel: "C1", Thread: "$reply", Text: "done"}); err != nil {
+		t.Fatalf("agent reply: %v", err)
+	}
+	if req := <-bare.sent; req.Thread != "" || req.Channel != "C1" {
+		t.Fatalf("expected the reply in the channel, got %+v", req)
+	}
+}
+
+func TestListBots_Capabilities(t *testing.T) {
+	s := newReplayServer(t)
+	s.connectors["slack:ops"] = &readMarkerConnector{idleConnector: idleConnector{name: "ops"}}
+
+	bots := s.listBots("slack")
+	if len(bots) != 2 {
+		t.Fatalf("expected 2 slack bots, got %+v", bots)
+	}
+	for _, bot := range bots {
+		switch bot.Name {
+		case "ops":
+			if bot.Capabilities == nil || !bot.Capabilities.MarkRead || bot.Capabilities.Reactions {
+				t.Fatalf("expected the connector's capabilities, got %+v", bot.Capabilities)
+			}
+		case "other":
+			if bot.Capabilities != nil {
+				t.Fatalf("expected no capabilities without a connector, got %+v", bot.Capabilities)
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+// manageChannel runs the join_channel, leave_channel, create_channel and
+// invite_channel actions against the bot's connector.
+func (s *Server) manageChannel(ctx context.Context, req protocol.Request) protocol.Response {
+	channel := strings.TrimSpace(req.Channel)
+	name := strings.TrimSpace(req.Name)
+	var users []string
+	for _, user := range req.Users {
+		if user = strings.TrimSpace(user); user != "" {
+			users = append(users, user)
+		}
+	}
+
+	switch req.Action {
+	case protocol.ActionCreateChannel:
+		if name == "" {
+			return protocol.Response{OK: false, Error: "name is required", Code: protocol.CodeInvalidRequest}
+		}
+	case protocol.ActionInviteChannel:
+		if channel == "" || len(users) == 0 {
+			return protocol.Response{OK: false, Error: "channel and users are required", Code: protocol.CodeInvalidRequest}
+		}
+	default:
+		if channel == "" {
+			return protocol.Response{OK: false, Error: "channel is required", Code: protocol.CodeInvalidRequest}
+		}
+	}
+
+	service, bot, err := s.resolveBotService(req.Service, req.Bot)
+	if err != nil {
+		return failed(err)
+	}
+
+	key := botKey(service, bot)
+	connector, gate, err := s.acquireConnector(ctx, key)
+	if err != nil {
+		return failed(err)
+	}
+	if connector == nil {
+		return failed(unknownBot(service, bot))
+	}
+	defer gate.leave()
+
+	manager, ok := connector.(upstream.ChannelManager)
+	if !ok || !connector.Capabilities().Channels {
+		return protocol.Response{OK: false, Error: unsupported(service, bot, "channel management"), Code: protocol.CodeUnsupported}
+	}
+
+	var resp protocol.Response
+	switch req.Action {
+	case protocol.ActionJoinChannel:
+		err = manager.JoinChannel(ctx, channel)
+		resp.Ack = "joined " + channel
+	case protocol.ActionLeaveChannel:
+		err = manager.LeaveChannel(ctx, channel)
+		resp.Ack = "left " + channel
+	case protocol.ActionCreateChannel:
+		resp.Channel, err = manager.CreateChannel(ctx, name, req.Private, strings.TrimSpace(req.Target))
+		resp.Ack = fmt.Sprintf("created %s (%s)", name, resp.Channel)
+	case protocol.ActionInviteChannel:
+		err = manager.InviteToChannel(ctx, channel, users)
+		resp.Ack = fmt.Sprintf("invited %d user(s) to %s", len(users), channel)
+	}
+	if errors.Is(err, errors.ErrUnsupported) {
+		return protocol.Response{OK: false, Error: fmt.Sprintf("%s bot %q: %v", service, bot, err), Code: protocol.CodeUnsupported}
+	}
+	if err != nil {
+		return failed(withCode(protocol.CodeUpstream, err))
+	}
+	resp.OK = true
+	return resp
+}
+
+// listTopics runs the list_topics action: the topics of req.Channel, at
+// most req.Limit of them when set.
+func (s *Server) listTopics(ctx context.Context, req protocol.Request) protocol.Response {
+	channel := strings.TrimSpace(req.Channel)
+	if channel == "" {
+		return protocol.Response{OK: false, Error: "channel is required", Code: protocol.CodeInvalidRequest}
+	}
+
+	service, bot, err := s.resolveBotService(req.Service, req.Bot)
+	if err != nil {
+		return failed(err)
+	}
+
+	key := botKey(service, bot)
+	connector, gate, err := s.acquireConnector(ctx, key)
+	if err != nil {
+		return failed(err)
+	}
+	if connector == nil {
+		return failed(unknownBot(service, bot))
+	}
+	defer gate.leave()
+
+	lister, ok := connector.(upstream.TopicLister)
+	if !ok || !connector.Capabilities().Topics {
+		return protocol.Response{OK: false, Error: unsupported(service, bot, "listing topics"), Code: protocol.CodeUnsupported}
+	}
+
+	topics, err := lister.ListTopics(ctx, channel)
+	if err != nil {
+		return failed(withCode(protocol.CodeUpstream, fmt.Errorf("%s bot %q: %w", service, bot, err)))
+	}
+	if req.Limit > 0 && len(topics) > req.Limit {
+		topics = topics[:req.Limit]
+	}
+	return protocol.Response{OK: true, Topics: topics}
+}
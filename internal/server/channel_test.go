@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+type channelConnector struct {
+	idleConnector
+	calls []string
+}
+
+func (c *channelConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{Channels: true}
+}
+
+func (c *channelConnector) JoinChannel(_ context.Context, channel string) error {
+	c.calls = append(c.calls, "join "+channel)
+	return nil
+}
+
+func (c *channelConnector) LeaveChannel(context.Context, string) error {
+	return errors.ErrUnsupported
+}
+
+func (c *channelConnector) CreateChannel(_ context.Context, name string, private bool, scope string) (string, error) {
+	c.calls = append(c.calls, fmt.Sprintf("create %s private=%t scope=%s", name, private, scope))
+	return "C9", nil
+}
+
+func (c *channelConnector) InviteToChannel(_ context.Context, channel string, users []string) error {
+	c.calls = append(c.calls, "invite "+channel+" "+strings.Join(users, ","))
+	return nil
+}
+
+func TestHandleRequest_ChannelManagement(t *testing.T) {
+	s := newReplayServer(t)
+	manager := &channelConnector{idleConnector: idleConnector{name: "ops"}}
+	s.connectors["slack:ops"] = manager
+	s.connectors["discord:ops"] = &idleConnector{name: "ops"}
+
+	request := func(req protocol.Request) protocol.Response {
+		if req.Service == "" {
+			req.Service = "slack"
+		}
+		req.Bot = "ops"
+		return s.handleRequest(context.Background(), req)
+	}
+
+	if resp := request(protocol.Request{Action: protocol.ActionJoinChannel, Channel: "C1"}); !resp.OK || resp.Ack != "joined C1" {
+		t.Fatalf("join failed: %+v", resp)
+	}
+	resp := request(protocol.Request{Action: protocol.ActionCreateChannel, Name: "release-train", Private: true, Target: "T1"})
+	if !resp.OK || resp.Channel != "C9" {
+		t.Fatalf("create failed: %+v", resp)
+	}
+	if resp := request(protocol.Request{Action: protocol.ActionInviteChannel, Channel: "C9", Users: []string{" U1", "", "U2 "}}); !resp.OK {
+		t.Fatalf("invite failed: %+v", resp)
+	}
+
+	want := []string{"join C1", "create release-train private=true scope=T1", "invite C9 U1,U2"}
+	if strings.Join(manager.calls, "|") != strings.Join(want, "|") {
+		t.Fatalf("expected calls %v, got %v", want, manager.calls)
+	}
+
+	tests := []struct {
+		name string
+		req  protocol.Request
+		want string
+	}{
+		{name: "join without channel", req: protocol.Request{Action: protocol.ActionJoinChannel}, want: "channel is required"},
+		{name: "create without name", req: protocol.Request{Action: protocol.ActionCreateChannel}, want: "name is required"},
+		{name: "invite without users", req: protocol.Request{Action: protocol.ActionInviteChannel, Channel: "C1", Users: []string{" "}}, want: "channel and users are required"},
+		{name: "unsupported operation", req: protocol.Request{Action: protocol.ActionLeaveChannel, Channel: "C1"}, want: `slack bot "ops": unsupported operation`},
+		{name: "unsupported connector", req: protocol.Request{Action: protocol.ActionJoinChannel, Service: "discord", Channel: "C1"}, want: "does not support channel management"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := request(tt.req); resp.OK || !strings.Contains(resp.Error, tt.want) {
+				t.Fatalf("expected error containing %q, got %+v", tt.want, resp)
+			}
+		})
+	}
+}
+
+type topicConnector struct{ idleConnector }
+
+func (c *topicConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{Threads: true, Topics: true}
+}
+
+func (c *topicConnector) ListTopics(_ context.Context, channel string) ([]protocol.Topic, error) {
+	if channel != "42" {
+		return nil, fmt.Errorf("unknown stream %q", channel)
+	}
+	return []protocol.Topic{{Name: "incidents", LastMessage: "30"}, {Name: "lunch", LastMessage: "20"}}, nil
+}
+
+func TestHandleRequest_ListTopics(t *testing.T) {
+	s := newReplayServer(t)
+	s.bots["zulip:ops"] = protocol.BotRef{Service: "zulip", Name: "ops"}
+	s.connectors["zulip:ops"] = &topicConnector{idleConnector{name: "ops"}}
+	s.connectors["slack:ops"] = &idleConnector{name: "ops"}
+
+	request := func(service string, channel string, limit int) protocol.Response {
+		return s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionListTopics, Service: service, Bot: "ops", Channel: channel, Limit: limit})
+	}
+
+	resp := request("zulip", "42", 1)
+	if !resp.OK || len(resp.Topics) != 1 || resp.Topics[0].Name != "incidents" {
+		t.Fatalf("expected the newest topic, got %+v", resp)
+	}
+	if resp := request("zulip", "7", 0); resp.OK || !strings.Contains(resp.Error, `zulip bot "ops": unknown stream "7"`) {
+		t.Fatalf("expected the connector error, got %+v", resp)
+	}
+	if resp := request("slack", "C1", 0); resp.OK || !strings.Contains(resp.Error, "does not support listing topics") {
+		t.Fatalf("expected unsupported, got %+v", resp)
+	}
+	if resp := request("zulip", "", 0); resp.OK || resp.Error != "channel is required" {
+		t.Fatalf("expected channel required, got %+v", resp)
+	}
+}
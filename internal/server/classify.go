@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/classify"
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// newClassifier builds the notification classifier for cfg, or returns nil
+// when classification is not configured.
+func newClassifier(cfg config.Config) (*classify.Classifier, error) {
+	if cfg.Classifier == nil {
+		return nil, nil
+	}
+
+	cc := classify.Config{
+		Command:  cfg.Classifier.Command,
+		Endpoint: cfg.Classifier.Endpoint,
+		Timeout:  time.Duration(cfg.Classifier.Timeout) * time.Second,
+	}
+	if strings.TrimSpace(cfg.Classifier.APIKey) != "" {
+		key, err := config.ResolveCredential(cfg.Classifier.APIKey)
+		if err != nil {
+			return nil, fmt.Errorf("resolve classifier api_key: %w", err)
+		}
+		cc.APIKey = key
+	}
+	return classify.New(cc)
+}
+
+func (s *Server) currentClassifier() *classify.Classifier {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.classifier
+}
+
+// classify sets the priority and labels of an inbound notification. When
+// the classifier fails the notification goes on unclassified, so it still
+// reaches agents that don't look at the priority.
+func (s *Server) classify(key string, event *protocol.Event) error {
+	if !event.Notify || event.Direction != "in" {
+		return nil
+	}
+	classifier := s.currentClassifier()
+	if classifier == nil {
+		return nil
+	}
+
+	parent := s.rootCtx
+	if parent == nil {
+		parent = context.Background()
+	}
+	result, err := classifier.Classify(parent, *event)
+	if err != nil {
+		return err
+	}
+	event.Priority = result.Priority
+	event.Labels = result.Labels
+	return nil
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/classify"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+)
+
+func TestPublish_ClassifiesNotifications(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	s := newReplayServer(t)
+	classifier, err := classify.New(classify.Config{Command: []string{"sh", "-c",
+		`event=$(cat); case "$event" in
+			*down*) echo '{"priority":"urgent","labels":["outage"]}' ;;
+			*lunch*) echo low ;;
+			*) exit 1 ;;
+		esac`}})
+	if err != nil {
+		t.Fatalf("new classifier: %v", err)
+	}
+	s.classifier = classifier
+
+	for _, text := range []string{"@ops prod is down", "@ops lunch?", "@ops hello", "prod is down"} {
+		s.publish(protocol.Event{Service: "slack", Bot: "ops", Kind: "message", Direction: "in", Channel: "C1", Text: text})
+	}
+
+	notifications, err := s.notifications.ListNotifications(store.NotificationFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("list notifications: %v", err)
+	}
+	got := make(map[string]protocol.Event)
+	for _, n := range notifications {
+		got[n.Text] = n
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected the three mentions as notifications, got %+v", notifications)
+	}
+	if n := got["@ops prod is down"]; n.Priority != protocol.PriorityUrgent || !slices.Equal(n.Labels, []string{"outage"}) {
+		t.Errorf("expected urgent outage, got %+v", n)
+	}
+	if n := got["@ops lunch?"]; n.Priority != protocol.PriorityLow || n.Labels != nil {
+		t.Errorf("expected low without labels, got %+v", n)
+	}
+	// The classifier failed on this one; it still notifies, unclassified.
+	if n := got["@ops hello"]; n.Priority != "" {
+		t.Errorf("expected no priority after a classifier failure, got %+v", n)
+	}
+}
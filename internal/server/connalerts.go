@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+// defaultMaxReconnects is how many recoveries per flapWindow are tolerated
+// before a connector is reported as flapping.
+const defaultMaxReconnects = 5
+
+const flapWindow = time.Hour
+
+// alertTimeout bounds posting one connection alert.
+const alertTimeout = 30 * time.Second
+
+// alertTarget is where connection alerts are posted.
+type alertTarget struct {
+	key           string // bot that posts the alerts
+	channel       string
+	maxReconnects int
+}
+
+func newAlertTarget(cfg config.Config) *alertTarget {
+	ac := cfg.ConnectionAlerts
+	if ac == nil {
+		return nil
+	}
+
+	for _, bot := range cfg.Bots {
+		if bot.Name != ac.Bot {
+			continue
+		}
+		max := ac.MaxReconnects
+		if max <= 0 {
+			max = defaultMaxReconnects
+		}
+		return &alertTarget{key: botKey(bot.Type, bot.Name), channel: ac.Channel, maxReconnects: max}
+	}
+	return nil
+}
+
+// connState follows one connector through its status events.
+type connState struct {
+	down       bool
+	downSince  time.Time
+	downReason string
+	reconnects []time.Time // recoveries within flapWindow
+	mutedUntil time.Time   // recovery notices are muted while flapping
+}
+
+// connWatch tracks connector health across reloads.
+type connWatch struct {
+	mu     sync.Mutex
+	states map[string]*connState
+}
+
+// observe records a status event for key and returns the alert to post, if
+// any: a recovery notice when the connector comes back after a failure, a
+// single flapping notice once it recovers more than maxReconnects times
+// within flapWindow, or the supervisor's notice that an outage is dragging
+// on.
+func (w *connWatch) observe(key string, text string, now time.Time, maxReconnects int) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.states == nil {
+		w.states = make(map[string]*connState)
+	}
+	state := w.states[key]
+	if state == nil {
+		state = &connState{}
+		w.states[key] = state
+	}
+
+	switch upstream.ClassifyStatus(text) {
+	case upstream.StatusDown:
+		if strings.HasPrefix(text, upstream.StatusDownAlert) {
+			return fmt.Sprintf("pantalk: %s %s", key, text)
+		}
+		if !state.down {
+			state.down = true
+			state.downSince = now
+			state.downReason = text
+		}
+		return ""
+	case upstream.StatusStopped:
+		// Shutdown or reload; not an outage.
+		state.down = false
+		return ""
+	case upstream.StatusInfo, upstream.StatusUnknown:
+		return ""
+	}
+
+	if !state.down {
+		return ""
+	}
+	state.down = false
+
+	kept := state.reconnects[:0]
+	for _, at := range state.reconnects {
+		if now.Sub(at) < flapWindow {
+			kept = append(kept, at)
+		}
+	}
+	state.reconnects = append(kept, now)
+
+	if now.Before(state.mutedUntil) {
+		return ""
+	}
+	if len(state.reconnects) > maxReconnects {
+		state.mutedUntil = now.Add(flapWindow)
+		return fmt.Sprintf("pantalk: %s is flapping - reconnected %d times in the last hour (latest: %s). Muting its recovery notices for an hour.",
+			key, len(state.reconnects), state.downReason)
+	}
+
+	return fmt.Sprintf("pantalk: %s is back online after %s (%s)",
+		key, now.Sub(state.downSince).Round(time.Second), state.downReason)
+}
+
+// watchConnection feeds a status event to the connection watcher and posts
+// the resulting alert through the configured alert bot. Status of the alert
+// bot itself is not reported; it could not post reliably anyway.
+func (s *Server) watchConnection(key string, event protocol.Event) {
+	s.mu.RLock()
+	target := s.alerts
+	s.mu.RUnlock()
+
+	if target == nil || key == target.key {
+		return
+	}
+
+	text := s.connWatch.observe(key, event.Text, event.Timestamp, target.maxReconnects)
+	if text == "" {
+		return
+	}
+
+	go s.postAlert(target, text)
+}
+
+// postAlert sends text to the alert channel. Like auto-replies it bypasses
+// participation tracking so the alert channel doesn't start notifying.
+func (s *Server) postAlert(target *alertTarget, text string) {
+	parent := s.rootCtx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(parent, alertTimeout)
+	defer cancel()
+
+	connector, gate, err := s.acquireConnector(ctx, target.key)
+	if err != nil || connector == nil {
+		return
+	}
+	defer gate.leave()
+
+	service, bot, _ := strings.Cut(target.key, ":")
+	if _, err := connector.Send(ctx, protocol.Request{
+		Action:  protocol.ActionSend,
+		Service: service,
+		Bot:     bot,
+		Channel: target.channel,
+		Text:    text,
+	}); err != nil {
+		log.Printf("[%s] connection alert failed: %v", target.key, err)
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+func TestConnWatch_RecoveryAndFlapping(t *testing.T) {
+	var w connWatch
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	if got := w.observe("slack:ops", "connector online", now, 2); got != "" {
+		t.Fatalf("initial connect should not alert, got %q", got)
+	}
+
+	w.observe("slack:ops", "slack session ended: EOF", now.Add(time.Minute), 2)
+	w.observe("slack:ops", "slack reconnecting...", now.Add(time.Minute+time.Second), 2)
+	got := w.observe("slack:ops", "connector online", now.Add(3*time.Minute), 2)
+	if !strings.Contains(got, "slack:ops is back online after 2m0s (slack session ended: EOF)") {
+		t.Fatalf("unexpected recovery alert: %q", got)
+	}
+
+	// A second "connected" notice without a failure in between is not a
+	// recovery.
+	if got := w.observe("slack:ops", "socket mode connected", now.Add(4*time.Minute), 2); got != "" {
+		t.Fatalf("expected no alert without an outage, got %q", got)
+	}
+
+	w.observe("slack:ops", "socket mode connection error", now.Add(5*time.Minute), 2)
+	if got := w.observe("slack:ops", "socket mode connected", now.Add(6*time.Minute), 2); !strings.Contains(got, "back online") {
+		t.Fatalf("expected second recovery alert, got %q", got)
+	}
+
+	w.observe("slack:ops", "socket mode connection error", now.Add(7*time.Minute), 2)
+	got = w.observe("slack:ops", "socket mode connected", now.Add(8*time.Minute), 2)
+	if !strings.Contains(got, "flapping - reconnected 3 times") {
+		t.Fatalf("expected flapping alert on the third recovery, got %q", got)
+	}
+
+	w.observe("slack:ops", "socket mode connection error", now.Add(9*time.Minute), 2)
+	if got := w.observe("slack:ops", "socket mode connected", now.Add(10*time.Minute), 2); got != "" {
+		t.Fatalf("recovery notices should be muted while flapping, got %q", got)
+	}
+}
+
+func TestConnWatch_StopIsNotAnOutage(t *testing.T) {
+	var w connWatch
+	now := time.Now()
+
+	w.observe("irc:ops", "connector online", now, 5)
+	w.observe("irc:ops", "connector offline", now.Add(time.Second), 5)
+	w.observe("irc:ops", "warning: slow server", now.Add(2*time.Second), 5)
+	w.observe("irc:ops", "syncing 40 channels", now.Add(2*time.Second), 5)
+	if got := w.observe("irc:ops", "connector online", now.Add(3*time.Second), 5); got != "" {
+		t.Fatalf("restart after a clean stop should not alert, got %q", got)
+	}
+}
+
+func TestConnWatch_DownAlert(t *testing.T) {
+	var w connWatch
+	now := time.Now()
+
+	w.observe("zulip:ops", "zulip auth failed: 401", now, 5)
+	got := w.observe("zulip:ops", upstream.StatusDownAlert+"10m0s (zulip auth failed: 401)", now.Add(10*time.Minute), 5)
+	if got != "pantalk: zulip:ops connector down for 10m0s (zulip auth failed: 401)" {
+		t.Fatalf("unexpected down alert: %q", got)
+	}
+	if got := w.observe("zulip:ops", "connector online", now.Add(11*time.Minute), 5); !strings.Contains(got, "back online after 11m0s (zulip auth failed: 401)") {
+		t.Fatalf("expected the recovery to date from the first failure, got %q", got)
+	}
+}
+
+func TestPublish_PostsConnectionAlert(t *testing.T) {
+	alertBot := &recordingConnector{idleConnector: idleConnector{name: "B0T"}, sent: make(chan protocol.Request, 4)}
+	s := &Server{
+		bots: map[string]protocol.BotRef{
+			"slack:ops":      {Service: "slack", Name: "ops"},
+			"discord:alerts": {Service: "discord", Name: "alerts"},
+		},
+		connectors:  map[string]upstream.Connector{"discord:alerts": alertBot},
+		alerts:      &alertTarget{key: "discord:alerts", channel: "C-OPS", maxReconnects: 5},
+		routesByBot: make(map[string]map[string]struct{}),
+		subsByBot:   make(map[string]map[*subscriber]struct{}),
+	}
+
+	for _, text := range []string{"connector online", "slack session ended: EOF", "connector online"} {
+		s.publish(protocol.Event{Service: "slack", Bot: "ops", Kind: "status", Text: text})
+	}
+	// The alert bot's own status is never reported.
+	s.publish(protocol.Event{Service: "discord", Bot: "alerts", Kind: "status", Text: "discord session ended: EOF"})
+	s.publish(protocol.Event{Service: "discord", Bot: "alerts", Kind: "status", Text: "connector online"})
+
+	select {
+	case req := <-alertBot.sent:
+		if req.Bot != "alerts" || req.Channel != "C-OPS" || !strings.Contains(req.Text, "slack:ops is back online") {
+			t.Fatalf("unexpected alert: %+v", req)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no connection alert posted")
+	}
+
+	select {
+	case req := <-alertBot.sent:
+		t.Fatalf("unexpected second alert: %+v", req)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if s.hasParticipation("discord:alerts", "", "C-OPS", "") {
+		t.Fatal("alert marked the ops channel as participated")
+	}
+}
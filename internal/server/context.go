@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/pantalk/pantalk/internal/agent"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+)
+
+// defaultContextLimit and maxContextLimit bound how many messages a context
+// request returns.
+const (
+	defaultContextLimit = 20
+	maxContextLimit     = agent.MaxContext
+)
+
+// eventContext returns the messages before the stored event id in the same
+// conversation, for the context action.
+func (s *Server) eventContext(id int64, limit int) ([]protocol.Event, error) {
+	if id <= 0 {
+		return nil, invalidRequest("event_id is required")
+	}
+	event, err := s.storedEvent(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.conversationContext(event, limit)
+}
+
+// conversationContext returns up to limit messages, oldest first, that came
+// before event in its conversation: the thread when the event is in one,
+// otherwise the whole channel. Both directions are included so the bot's own
+// replies are part of the context.
+func (s *Server) conversationContext(event protocol.Event, limit int) ([]protocol.Event, error) {
+	if limit <= 0 {
+		limit = defaultContextLimit
+	}
+	if limit > maxContextLimit {
+		limit = maxContextLimit
+	}
+	if event.Channel == "" && event.Thread == "" {
+		return nil, fmt.Errorf("event %d is not part of a conversation", event.ID)
+	}
+
+	s.mu.RLock()
+	st := s.notifications
+	s.mu.RUnlock()
+	if st == nil {
+		return nil, fmt.Errorf("store is not available")
+	}
+
+	events, err := st.ListEvents(store.EventFilter{
+		Service:  event.Service,
+		Bot:      event.Bot,
+		Channel:  event.Channel,
+		Thread:   event.Thread,
+		Kind:     "message",
+		BeforeID: event.ID,
+		Limit:    limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read context: %w", err)
+	}
+	s.annotateSelf(events)
+	return events, nil
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+)
+
+func TestEventContext(t *testing.T) {
+	s := newReplayServer(t)
+
+	publish := func(channel, thread, direction, text string) {
+		s.publish(protocol.Event{
+			Service:   "slack",
+			Bot:       "ops",
+			Kind:      "message",
+			Direction: direction,
+			Channel:   channel,
+			Thread:    thread,
+			Text:      text,
+		})
+	}
+	publish("C1", "", "in", "oldest")
+	publish("C1", "", "in", "question")
+	publish("C2", "", "in", "other channel")
+	publish("C1", "T1", "in", "in thread")
+	publish("C1", "", "out", "answer")
+	publish("C1", "", "in", "trigger")
+	publish("C1", "", "in", "after")
+
+	trigger := findStored(t, s, "trigger")
+	events, err := s.eventContext(trigger.ID, 3)
+	if err != nil {
+		t.Fatalf("context: %v", err)
+	}
+	if got := eventTexts(events); got != "question,in thread,answer" {
+		t.Fatalf("unexpected channel context: %s", got)
+	}
+
+	threaded := findStored(t, s, "in thread")
+	events, err = s.eventContext(threaded.ID, 10)
+	if err != nil {
+		t.Fatalf("context: %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected no earlier thread messages, got %s", eventTexts(events))
+	}
+
+	if _, err := s.eventContext(0, 10); err == nil {
+		t.Fatal("expected error without an event id")
+	}
+	if _, err := s.eventContext(999, 10); err == nil {
+		t.Fatal("expected error for an unknown event")
+	}
+}
+
+func findStored(t *testing.T, s *Server, text string) protocol.Event {
+	t.Helper()
+	events, err := s.readEvents(store.EventFilter{Search: text, Limit: 100})
+	if err != nil || len(events) != 1 {
+		t.Fatalf("find %q: %v, %d events", text, err, len(events))
+	}
+	return events[0]
+}
+
+func eventTexts(events []protocol.Event) string {
+	texts := make([]string, 0, len(events))
+	for _, event := range events {
+		texts = append(texts, event.Text)
+	}
+	return strings.Join(texts, ",")
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// debugging reports whether debug logging is on for the connector key:
+// for every connector with --debug or pantalk debug --enable, or for that
+// one after pantalk debug --enable --bot. An empty key asks about the
+// daemon itself.
+func (s *Server) debugging(key string) bool {
+	if s.debug.Load() {
+		return true
+	}
+	if key == "" {
+		return false
+	}
+	s.debugMu.Lock()
+	defer s.debugMu.Unlock()
+	return s.debugBots[key]
+}
+
+// debugStatus reports what debug logging is on for.
+func (s *Server) debugStatus() *protocol.DebugStatus {
+	s.debugMu.Lock()
+	defer s.debugMu.Unlock()
+	status := &protocol.DebugStatus{All: s.debug.Load()}
+	for key := range s.debugBots {
+		status.Bots = append(status.Bots, key)
+	}
+	sort.Strings(status.Bots)
+	return status
+}
+
+// setDebug answers the debug action: it turns debug logging on or off for
+// the whole daemon or the selected bots, and reports the result. The
+// setting lives in the daemon, not the config, so reloads keep it.
+func (s *Server) setDebug(req protocol.Request) protocol.Response {
+	var enable bool
+	switch req.Debug {
+	case "":
+		return protocol.Response{OK: true, Debug: s.debugStatus()}
+	case "on":
+		enable = true
+	case "off":
+	default:
+		return failed(invalidRequest("debug must be on or off, got %q", req.Debug))
+	}
+
+	service, bot := req.Service, req.Bot
+	if before, after, ok := strings.Cut(bot, ":"); ok && service == "" {
+		service, bot = before, after
+	}
+
+	if service == "" && bot == "" {
+		s.debugMu.Lock()
+		s.debug.Store(enable)
+		if !enable {
+			s.debugBots = nil
+		}
+		s.debugMu.Unlock()
+		log.Printf("debug logging %s", req.Debug)
+		return protocol.Response{OK: true, Ack: "debug " + req.Debug, Debug: s.debugStatus()}
+	}
+
+	keys, err := s.resolveSelector(service, bot)
+	if err != nil {
+		return failed(err)
+	}
+	s.debugMu.Lock()
+	if s.debugBots == nil {
+		s.debugBots = make(map[string]bool)
+	}
+	for _, key := range keys {
+		if enable {
+			s.debugBots[key] = true
+		} else {
+			delete(s.debugBots, key)
+		}
+	}
+	s.debugMu.Unlock()
+	for _, key := range keys {
+		log.Printf("[%s] debug logging %s", key, req.Debug)
+	}
+	return protocol.Response{OK: true, Ack: "debug " + req.Debug + " for " + strings.Join(keys, ", "), Debug: s.debugStatus()}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func TestSetDebug_PerBot(t *testing.T) {
+	s := newReplayServer(t)
+
+	resp := s.setDebug(protocol.Request{Action: protocol.ActionDebug, Debug: "on", Bot: "slack:ops"})
+	if !resp.OK {
+		t.Fatalf("debug on: %s", resp.Error)
+	}
+	if !s.debugging("slack:ops") || s.debugging("discord:ops") || s.debugging("") {
+		t.Fatalf("expected debug logging for slack:ops only, got %+v", resp.Debug)
+	}
+	if resp.Debug == nil || resp.Debug.All || len(resp.Debug.Bots) != 1 || resp.Debug.Bots[0] != "slack:ops" {
+		t.Fatalf("expected status to list slack:ops, got %+v", resp.Debug)
+	}
+
+	// A service selects each of its bots.
+	s.setDebug(protocol.Request{Debug: "on", Service: "discord"})
+	if !s.debugging("discord:ops") {
+		t.Fatal("expected debug logging for discord:ops")
+	}
+	s.setDebug(protocol.Request{Debug: "off", Service: "slack", Bot: "ops"})
+	if s.debugging("slack:ops") {
+		t.Fatal("expected debug logging off for slack:ops")
+	}
+
+	if resp := s.setDebug(protocol.Request{Debug: "on", Bot: "nobody"}); resp.OK || resp.Code != protocol.CodeUnknownBot {
+		t.Fatalf("expected an unknown bot rejected, got %+v", resp)
+	}
+	if resp := s.setDebug(protocol.Request{Debug: "maybe"}); resp.OK || resp.Code != protocol.CodeInvalidRequest {
+		t.Fatalf("expected an unknown setting rejected, got %+v", resp)
+	}
+}
+
+func TestSetDebug_Daemon(t *testing.T) {
+	s := newReplayServer(t)
+	s.setDebug(protocol.Request{Debug: "on", Bot: "slack:ops"})
+
+	s.setDebug(protocol.Request{Debug: "on"})
+	if !s.debugging("") || !s.debugging("slack:other") {
+		t.Fatal("expected debug logging for the whole daemon")
+	}
+
+	// Turning it off for the daemon clears the per-bot settings too.
+	resp := s.setDebug(protocol.Request{Debug: "off"})
+	if s.debugging("") || s.debugging("slack:ops") {
+		t.Fatalf("expected debug logging off everywhere, got %+v", resp.Debug)
+	}
+
+	if resp := s.setDebug(protocol.Request{}); !resp.OK || resp.Debug == nil || resp.Debug.All {
+		t.Fatalf("expected a status report, got %+v", resp)
+	}
+}
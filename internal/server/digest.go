@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/ntfy"
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// digestCheckInterval is how often closed digest windows are flushed.
+const digestCheckInterval = 30 * time.Second
+
+// digestRule is a bot's digest setting in runtime form.
+type digestRule struct {
+	window  time.Duration
+	channel string // where summaries are posted; "" for ntfy only
+}
+
+// digestBatch counts the notifications held back for one channel until
+// its window closes.
+type digestBatch struct {
+	key      string
+	service  string
+	bot      string
+	channel  string
+	post     string
+	due      time.Time
+	messages int
+	mentions int
+	direct   int
+}
+
+// newDigestRule converts a bot's digest config, or returns false when the
+// bot pushes every notification on its own.
+func newDigestRule(d *config.DigestConfig) (digestRule, bool) {
+	if d == nil {
+		return digestRule{}, false
+	}
+	return digestRule{window: d.WindowDuration(), channel: strings.TrimSpace(d.Channel)}, true
+}
+
+// holdForDigest counts a new notification towards its channel's digest and
+// reports whether it did; held notifications are not pushed individually.
+// Interactions are decisions someone is waiting on, so they never wait for
+// a digest.
+func (s *Server) holdForDigest(key string, event protocol.Event, now time.Time) bool {
+	if event.Kind != "message" {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rule, ok := s.digests[key]
+	if !ok {
+		return false
+	}
+	if s.digestBatches == nil {
+		s.digestBatches = make(map[string]*digestBatch)
+	}
+
+	batchKey := key + "|c=" + event.Channel
+	batch := s.digestBatches[batchKey]
+	if batch == nil {
+		batch = &digestBatch{
+			key:     key,
+			service: event.Service,
+			bot:     event.Bot,
+			channel: event.Channel,
+			post:    rule.channel,
+			due:     now.Add(rule.window),
+		}
+		s.digestBatches[batchKey] = batch
+	}
+
+	batch.messages++
+	if event.Mentions {
+		batch.mentions++
+	}
+	if event.Direct {
+		batch.direct++
+	}
+	return true
+}
+
+// runDigestFlusher sends the summaries of digest windows as they close.
+func (s *Server) runDigestFlusher(ctx context.Context) {
+	ticker := time.NewTicker(digestCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.flushDigests(now)
+		}
+	}
+}
+
+// flushDigests removes the batches whose window has closed by now and
+// delivers their summaries.
+func (s *Server) flushDigests(now time.Time) {
+	s.mu.Lock()
+	var due []*digestBatch
+	for batchKey, batch := range s.digestBatches {
+		if !now.Before(batch.due) {
+			due = append(due, batch)
+			delete(s.digestBatches, batchKey)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].key != due[j].key {
+			return due[i].key < due[j].key
+		}
+		return due[i].channel < due[j].channel
+	})
+
+	publisher := s.publisher()
+	for _, batch := range due {
+		text := batch.summary()
+		log.Printf("[%s] digest: %s", batch.key, text)
+		if publisher != nil {
+			go s.forwardDigest(publisher, batch, text)
+		}
+		if batch.post != "" {
+			go s.postDigest(batch, text)
+		}
+	}
+}
+
+// summary renders the batch as e.g. "12 new messages in #ops, 3 mentions".
+func (b *digestBatch) summary() string {
+	var out strings.Builder
+	out.WriteString(plural(b.messages, "new message", "new messages"))
+	out.WriteString(" in ")
+	out.WriteString(channelLabel(b.channel))
+	if b.mentions > 0 {
+		out.WriteString(", ")
+		out.WriteString(plural(b.mentions, "mention", "mentions"))
+	}
+	if b.direct > 0 {
+		out.WriteString(", ")
+		out.WriteString(plural(b.direct, "direct message", "direct messages"))
+	}
+	return out.String()
+}
+
+// channelLabel prefixes bare channel names with '#' and leaves addresses
+// such as "dm:alice" or "#ops" alone.
+func channelLabel(channel string) string {
+	if channel == "" || strings.HasPrefix(channel, "#") || strings.Contains(channel, ":") {
+		return channel
+	}
+	return "#" + channel
+}
+
+func plural(n int, one string, many string) string {
+	if n == 1 {
+		return "1 " + one
+	}
+	return fmt.Sprintf("%d %s", n, many)
+}
+
+// forwardDigest pushes a digest summary to ntfy.
+func (s *Server) forwardDigest(publisher *ntfy.Publisher, batch *digestBatch, text string) {
+	parent := s.rootCtx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(parent, forwardTimeout)
+	defer cancel()
+
+	title := fmt.Sprintf("%s/%s digest", batch.service, batch.bot)
+	if err := publisher.Send(ctx, publisher.Summary(title, text)); err != nil {
+		log.Printf("[%s] ntfy forward of digest for %s failed: %v", batch.key, batch.channel, err)
+	}
+}
+
+// postDigest posts a digest summary to the bot's digest channel.
+func (s *Server) postDigest(batch *digestBatch, text string) {
+	parent := s.rootCtx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(parent, autoReplyTimeout)
+	defer cancel()
+
+	connector, gate, err := s.acquireConnector(ctx, batch.key)
+	if err != nil || connector == nil {
+		return
+	}
+	defer gate.leave()
+
+	req := protocol.Request{
+		Action:  protocol.ActionSend,
+		Service: batch.service,
+		Bot:     batch.bot,
+		Channel: batch.post,
+		Text:    text,
+	}
+	if _, err := connector.Send(ctx, req); err != nil {
+		log.Printf("[%s] posting digest to %s failed: %v", batch.key, batch.post, err)
+	}
+}
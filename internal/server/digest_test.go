@@ -0,0 +1,64 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+)
+
+func TestDigest_BatchesPerChannel(t *testing.T) {
+	s := newReplayServer(t)
+	connector := &recordingConnector{idleConnector: idleConnector{name: "B0T"}, sent: make(chan protocol.Request, 4)}
+	s.connectors["slack:ops"] = connector
+	s.digests = map[string]digestRule{"slack:ops": {window: time.Minute, channel: "C0DIGEST"}}
+
+	publishText(s, "slack", "ops", "@ops the build is red")
+	publishText(s, "slack", "ops", "@ops still red")
+	publishText(s, "slack", "other", "@other the build is red")
+
+	// Digests change how notifications are pushed, not what is stored.
+	if unseen, _ := s.notifications.ListNotifications(store.NotificationFilter{Unseen: true, Limit: 10}); len(unseen) != 3 {
+		t.Fatalf("expected every notification to be stored, got %+v", unseen)
+	}
+	if len(s.digestBatches) != 1 {
+		t.Fatalf("expected one batch for the digesting bot, got %+v", s.digestBatches)
+	}
+
+	s.flushDigests(time.Now())
+	select {
+	case req := <-connector.sent:
+		t.Fatalf("expected nothing to be posted before the window closes, got %+v", req)
+	default:
+	}
+
+	s.flushDigests(time.Now().Add(time.Minute))
+	select {
+	case req := <-connector.sent:
+		if req.Channel != "C0DIGEST" || req.Text != "2 new messages in #C1, 2 mentions" {
+			t.Fatalf("unexpected digest post: %+v", req)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the digest to be posted")
+	}
+	if len(s.digestBatches) != 0 {
+		t.Fatalf("expected the flushed batch to be removed, got %+v", s.digestBatches)
+	}
+}
+
+func TestDigestSummary(t *testing.T) {
+	cases := []struct {
+		batch digestBatch
+		want  string
+	}{
+		{digestBatch{channel: "ops", messages: 1}, "1 new message in #ops"},
+		{digestBatch{channel: "ops", messages: 12, mentions: 3}, "12 new messages in #ops, 3 mentions"},
+		{digestBatch{channel: "dm:alice", messages: 2, direct: 2}, "2 new messages in dm:alice, 2 direct messages"},
+	}
+	for _, tc := range cases {
+		if got := tc.batch.summary(); got != tc.want {
+			t.Errorf("summary() = %q, want %q", got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/redact"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+// directConnectTimeout bounds how long a one-shot send waits for a
+// connector that needs a session to come online.
+const directConnectTimeout = 30 * time.Second
+
+// SendDirect sends req without a daemon, for `pantalk send --direct`: it
+// builds the bot's connector from cfg, sends through the same checks as
+// the send action and returns. Nothing is stored. Connectors that can only
+// send over a live session (IRC, WhatsApp, Matrix, ...) are run until they
+// report online first, except for a dry run.
+func SendDirect(ctx context.Context, cfg config.Config, req protocol.Request) protocol.Response {
+	s := New(cfg, "", "", "")
+	for _, bot := range cfg.Bots {
+		s.bots[botKey(bot.Type, bot.Name)] = protocol.BotRef{Service: bot.Type, Name: bot.Name}
+	}
+
+	service, botName, err := s.resolveBotService(req.Service, req.Bot)
+	if err != nil {
+		return failed(err)
+	}
+	var bot config.BotConfig
+	for _, candidate := range cfg.Bots {
+		if candidate.Type == service && candidate.Name == botName {
+			bot = candidate
+		}
+	}
+	if bot.Name == "" {
+		return failed(unknownBot(service, botName))
+	}
+	key := botKey(service, botName)
+	if bot.RedactEnabled() {
+		redactor, err := redact.New(cfg.RedactRules())
+		if err != nil {
+			return failed(fmt.Errorf("compile redact rules: %w", err))
+		}
+		s.redactors = map[string]*redact.Redactor{key: redactor}
+	}
+	if req.Translate != "" {
+		translator, err := newTranslator(cfg)
+		if err != nil {
+			return failed(fmt.Errorf("configure translation: %w", err))
+		}
+		s.translator = translator
+	}
+
+	statuses := make(chan string, 16)
+	connector, err := upstream.NewConnector(bot, func(event protocol.Event) {
+		if event.Kind != "status" {
+			return
+		}
+		select {
+		case statuses <- event.Text:
+		default:
+		}
+	})
+	if err != nil {
+		return failed(fmt.Errorf("create connector for %s: %w", key, err))
+	}
+
+	// A dry run posts nothing, so it needs no session.
+	if _, ok := connector.(upstream.SessionlessSender); !ok && !req.DryRun {
+		runCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		if err := runUntilOnline(runCtx, connector, statuses); err != nil {
+			return failed(withCode(protocol.CodeUnavailable, fmt.Errorf("%s: %w", key, err)))
+		}
+	}
+
+	s.connectors[key] = connector
+	req.Action = protocol.ActionSend
+	req.Service, req.Bot = service, botName
+	return s.send(ctx, req)
+}
+
+// runUntilOnline starts connector and waits for it to report online. It
+// fails when the connector gives up, or with the last status it reported
+// when it takes too long.
+func runUntilOnline(ctx context.Context, connector upstream.Connector, statuses <-chan string) error {
+	done := make(chan struct{})
+	go func() {
+		connector.Run(ctx)
+		close(done)
+	}()
+
+	timeout := time.NewTimer(directConnectTimeout)
+	defer timeout.Stop()
+	last := "no status reported"
+	for {
+		select {
+		case text := <-statuses:
+			if upstream.ClassifyStatus(text) == upstream.StatusOnline {
+				return nil
+			}
+			last = text
+		case <-done:
+			return fmt.Errorf("connector stopped before coming online: %s", last)
+		case <-timeout.C:
+			return fmt.Errorf("not online after %s: %s", directConnectTimeout, last)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func TestSendDirect(t *testing.T) {
+	cfg := config.Config{Bots: []config.BotConfig{{Name: "cron", Type: "demo", Transport: "mock"}}}
+
+	resp := SendDirect(context.Background(), cfg, protocol.Request{Bot: "cron", Channel: "general", Text: "backup finished"})
+	if !resp.OK || resp.Event == nil || resp.Event.Text != "backup finished" || resp.Event.Service != "demo" {
+		t.Fatalf("expected the message sent through the mock connector, got %+v", resp)
+	}
+
+	resp = SendDirect(context.Background(), cfg, protocol.Request{Bot: "nobody", Channel: "general", Text: "hi"})
+	if resp.OK || resp.Code != protocol.CodeUnknownBot {
+		t.Fatalf("expected an unknown bot error, got %+v", resp)
+	}
+}
+
+func TestSend_DryRun(t *testing.T) {
+	s := newReplayServer(t)
+	connector := &recordingConnector{idleConnector: idleConnector{name: "ops"}, sent: make(chan protocol.Request, 1)}
+	s.connectors["slack:ops"] = connector
+
+	resp := s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionSend, Bot: "ops", Service: "slack", Channel: "C1", Text: "<b>deploy</b> done", Format: "html", DryRun: true})
+	if !resp.OK || resp.Preview == nil || resp.Event != nil {
+		t.Fatalf("expected a preview, got %+v", resp)
+	}
+	want := protocol.SendPreview{Service: "slack", Bot: "ops", Channel: "C1", Messages: []protocol.PreviewMessage{{Text: "deploy done"}}}
+	if !reflect.DeepEqual(*resp.Preview, want) {
+		t.Fatalf("preview = %+v, want %+v", *resp.Preview, want)
+	}
+
+	select {
+	case req := <-connector.sent:
+		t.Fatalf("dry run reached the connector: %+v", req)
+	default:
+	}
+}
+
+func TestSendDirect_DryRun(t *testing.T) {
+	cfg := config.Config{Bots: []config.BotConfig{{Name: "cron", Type: "demo", Transport: "mock"}}}
+
+	resp := SendDirect(context.Background(), cfg, protocol.Request{Bot: "cron", Channel: "general", Text: "backup finished", DryRun: true})
+	if !resp.OK || resp.Event != nil || resp.Preview == nil || len(resp.Preview.Messages) != 1 || resp.Preview.Channel != "general" {
+		t.Fatalf("expected a preview of one message, got %+v", resp)
+	}
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+// drainTimeout bounds how long reload and shutdown wait for in-flight sends
+// and reactions before cancelling the old connectors anyway.
+const drainTimeout = 10 * time.Second
+
+// sendGate tracks in-flight operations for one connector instance. Stopping
+// the gate keeps new operations from starting; they wait for the replacement
+// connector instead of racing one that is about to be cancelled. All methods
+// are safe on a nil gate, which admits everything.
+type sendGate struct {
+	mu      sync.Mutex
+	closed  bool
+	wg      sync.WaitGroup
+	retired chan struct{} // closed once the replacement connector is installed
+}
+
+func newSendGate() *sendGate {
+	return &sendGate{retired: make(chan struct{})}
+}
+
+// enter registers an in-flight operation. It reports false once the gate is
+// closed.
+func (g *sendGate) enter() bool {
+	if g == nil {
+		return true
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.closed {
+		return false
+	}
+	g.wg.Add(1)
+	return true
+}
+
+func (g *sendGate) leave() {
+	if g == nil {
+		return
+	}
+	g.wg.Done()
+}
+
+// stop makes the gate refuse new operations. Operations already admitted
+// are unaffected.
+func (g *sendGate) stop() {
+	if g == nil {
+		return
+	}
+
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+}
+
+// wait blocks until every admitted operation has left or timeout elapses,
+// reporting whether they all finished.
+func (g *sendGate) wait(timeout time.Duration) bool {
+	if g == nil {
+		return true
+	}
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// drainGates stops every gate at once and then waits for all of them within
+// a single shared timeout.
+func drainGates(gates []*sendGate, timeout time.Duration) bool {
+	for _, g := range gates {
+		g.stop()
+	}
+
+	deadline := time.Now().Add(timeout)
+	drained := true
+	for _, g := range gates {
+		if !g.wait(time.Until(deadline)) {
+			drained = false
+		}
+	}
+	return drained
+}
+
+// retire wakes operations that were waiting on a stopped gate so they can
+// retry against the replacement connector.
+func (g *sendGate) retire() {
+	if g == nil {
+		return
+	}
+	close(g.retired)
+}
+
+// acquireConnector looks up the connector for key and enters its gate. While
+// a reload is draining that connector, the lookup waits for its replacement.
+// A nil connector means the bot is not configured; otherwise the
+// caller must call leave on the returned gate.
+func (s *Server) acquireConnector(ctx context.Context, key string) (upstream.Connector, *sendGate, error) {
+	for {
+		s.mu.RLock()
+		connector := s.connectors[key]
+		gate := s.gates[key]
+		s.mu.RUnlock()
+
+		if gate.enter() {
+			if connector == nil {
+				gate.leave()
+				return nil, nil, nil
+			}
+			return connector, gate, nil
+		}
+
+		select {
+		case <-gate.retired:
+		case <-ctx.Done():
+			return nil, nil, withCode(protocol.CodeUnavailable, fmt.Errorf("connectors are restarting: %w", ctx.Err()))
+		}
+	}
+}
+
+// drainConnectors stops every connector's gate during shutdown so in-flight
+// sends can finish before the connectors are cancelled.
+func (s *Server) drainConnectors() {
+	s.mu.RLock()
+	gates := make([]*sendGate, 0, len(s.gates))
+	for _, gate := range s.gates {
+		gates = append(gates, gate)
+	}
+	s.mu.RUnlock()
+
+	if !drainGates(gates, drainTimeout) {
+		log.Printf("warning: in-flight sends still running after %s; cancelling connectors", drainTimeout)
+	}
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+type idleConnector struct{ name string }
+
+func (c *idleConnector) Run(ctx context.Context) { <-ctx.Done() }
+func (c *idleConnector) Send(context.Context, protocol.Request) (protocol.Event, error) {
+	return protocol.Event{}, nil
+}
+func (c *idleConnector) React(context.Context, protocol.Request) error { return nil }
+func (c *idleConnector) Identity() string                              { return c.name }
+func (c *idleConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{Threads: true}
+}
+
+func TestSendGate_CloseWaitsForInflight(t *testing.T) {
+	g := newSendGate()
+	if !g.enter() {
+		t.Fatal("open gate refused enter")
+	}
+
+	done := make(chan bool, 1)
+	go func() { done <- drainGates([]*sendGate{g}, time.Second) }()
+
+	select {
+	case <-done:
+		t.Fatal("close returned while an operation was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if g.enter() {
+		t.Fatal("closed gate admitted a new operation")
+	}
+
+	g.leave()
+	if drained := <-done; !drained {
+		t.Fatal("expected close to report a clean drain")
+	}
+}
+
+func TestSendGate_CloseTimesOut(t *testing.T) {
+	g := newSendGate()
+	g.enter()
+	defer g.leave()
+
+	if drainGates([]*sendGate{g}, 20*time.Millisecond) {
+		t.Fatal("expected close to time out with an operation in flight")
+	}
+}
+
+func TestAcquireConnector_WaitsForNextGeneration(t *testing.T) {
+	oldGate := newSendGate()
+	s := &Server{
+		connectors: map[string]upstream.Connector{"slack:ops": &idleConnector{name: "old"}},
+		gates:      map[string]*sendGate{"slack:ops": oldGate},
+	}
+	oldGate.stop()
+
+	got := make(chan upstream.Connector, 1)
+	go func() {
+		connector, gate, err := s.acquireConnector(context.Background(), "slack:ops")
+		if err != nil {
+			t.Errorf("acquire: %v", err)
+		}
+		gate.leave()
+		got <- connector
+	}()
+
+	select {
+	case <-got:
+		t.Fatal("acquired a connector from a draining generation")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.mu.Lock()
+	s.connectors = map[string]upstream.Connector{"slack:ops": &idleConnector{name: "new"}}
+	s.gates = map[string]*sendGate{"slack:ops": newSendGate()}
+	s.mu.Unlock()
+	oldGate.retire()
+
+	select {
+	case connector := <-got:
+		if connector.Identity() != "new" {
+			t.Fatalf("expected the new connector, got %q", connector.Identity())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("acquire did not resume after the swap")
+	}
+}
+
+func TestAcquireConnector_UnknownBot(t *testing.T) {
+	s := &Server{connectors: map[string]upstream.Connector{}}
+
+	connector, _, err := s.acquireConnector(context.Background(), "slack:nope")
+	if err != nil || connector != nil {
+		t.Fatalf("expected nil connector and no error, got %v, %v", connector, err)
+	}
+}
+
+func TestAcquireConnector_ReleasesSlotForRemovedBot(t *testing.T) {
+	gate := newSendGate()
+	s := &Server{connectors: map[string]upstream.Connector{}, gates: map[string]*sendGate{"slack:ops": gate}}
+
+	if connector, _, _ := s.acquireConnector(context.Background(), "slack:ops"); connector != nil {
+		t.Fatalf("expected nil connector, got %v", connector)
+	}
+	if !drainGates([]*sendGate{gate}, 10*time.Millisecond) {
+		t.Fatal("unknown bot lookup leaked an in-flight slot")
+	}
+}
+
+func mockBot(name string, endpoint string) config.BotConfig {
+	return config.BotConfig{Name: name, Type: "custom", Transport: "mock", Endpoint: endpoint}
+}
+
+func TestStartConnectors_RestartsOnlyChangedBots(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	initial := config.Config{Bots: []config.BotConfig{mockBot("a", "mock://a"), mockBot("b", "mock://b")}}
+	s := New(initial, "", "", "")
+	s.rootCtx = ctx
+	if err := s.startConnectors(initial); err != nil {
+		t.Fatalf("start connectors: %v", err)
+	}
+
+	s.mu.RLock()
+	oldA, oldB := s.connectors["custom:a"], s.connectors["custom:b"]
+	inflight := s.gates["custom:a"]
+	s.mu.RUnlock()
+
+	// Hold a send open on bot a so the reload has to drain it.
+	inflight.enter()
+
+	updated := config.Config{Bots: []config.BotConfig{mockBot("a", "mock://a2"), mockBot("b", "mock://b")}}
+	reloaded := make(chan error, 1)
+	go func() { reloaded <- s.startConnectors(updated) }()
+
+	select {
+	case <-reloaded:
+		t.Fatal("reload finished while a send was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Sends to the unchanged bot are not held up by the drain.
+	connector, gate, err := s.acquireConnector(ctx, "custom:b")
+	if err != nil || connector != oldB {
+		t.Fatalf("expected unchanged connector for bot b, got %v, %v", connector, err)
+	}
+	gate.leave()
+
+	inflight.leave()
+
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatalf("reload: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reload did not finish after the send completed")
+	}
+
+	s.mu.RLock()
+	newA, newB := s.connectors["custom:a"], s.connectors["custom:b"]
+	s.mu.RUnlock()
+	if newA == oldA {
+		t.Fatal("changed bot a kept its old connector")
+	}
+	if newB != oldB {
+		t.Fatal("unchanged bot b was restarted")
+	}
+}
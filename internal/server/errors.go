@@ -0,0 +1,55 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+// codedError is an error carrying the protocol error code a failed
+// response reports for it.
+type codedError struct {
+	code string
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// withCode tags err with a protocol error code.
+func withCode(code string, err error) error {
+	return &codedError{code: code, err: err}
+}
+
+// invalidRequest is a codedError for a request missing or misusing fields.
+func invalidRequest(format string, args ...any) error {
+	return withCode(protocol.CodeInvalidRequest, fmt.Errorf(format, args...))
+}
+
+// unknownBot is the error for a bot no connector is configured for.
+func unknownBot(service, bot string) error {
+	return withCode(protocol.CodeUnknownBot, fmt.Errorf("unknown bot %q for service %q", bot, service))
+}
+
+// errorCode classifies err for protocol.Response.Code. Rate limiting and
+// missing support win over a code added on the way up, so a throttled
+// send still says so.
+func errorCode(err error) string {
+	var coded *codedError
+	switch {
+	case upstream.IsRateLimited(err):
+		return protocol.CodeRateLimited
+	case errors.Is(err, errors.ErrUnsupported):
+		return protocol.CodeUnsupported
+	case errors.As(err, &coded):
+		return coded.code
+	}
+	return protocol.CodeInternal
+}
+
+// failed is the response to a request that failed with err.
+func failed(err error) protocol.Response {
+	return protocol.Response{OK: false, Error: err.Error(), Code: errorCode(err)}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+// failingConnector fails every send with err.
+type failingConnector struct {
+	idleConnector
+	err error
+}
+
+func (c *failingConnector) Send(context.Context, protocol.Request) (protocol.Event, error) {
+	return protocol.Event{}, c.err
+}
+
+func TestHandleRequest_ErrorCodes(t *testing.T) {
+	s := newReplayServer(t)
+	s.connectors["slack:ops"] = &failingConnector{idleConnector{name: "ops"}, fmt.Errorf("slack send: %w", upstream.ErrRateLimited)}
+	s.connectors["discord:ops"] = &failingConnector{idleConnector{name: "ops"}, errors.New("channel_not_found")}
+
+	send := func(service, bot string) protocol.Request {
+		return protocol.Request{Action: protocol.ActionSend, Service: service, Bot: bot, Channel: "C1", Text: "hi"}
+	}
+	tests := []struct {
+		name string
+		req  protocol.Request
+		want string
+	}{
+		{name: "invalid", req: protocol.Request{Action: protocol.ActionSend, Service: "slack", Bot: "ops", Channel: "C1"}, want: protocol.CodeInvalidRequest},
+		{name: "unknown bot", req: protocol.Request{Action: protocol.ActionSend, Bot: "nobody", Channel: "C1", Text: "hi"}, want: protocol.CodeUnknownBot},
+		{name: "no connector", req: send("slack", "other"), want: protocol.CodeUnknownBot},
+		{name: "unsupported", req: protocol.Request{Action: protocol.ActionPresence, Service: "discord", Bot: "ops", Presence: &protocol.Presence{State: "away"}}, want: protocol.CodeUnsupported},
+		{name: "rate limited", req: send("slack", "ops"), want: protocol.CodeRateLimited},
+		{name: "upstream", req: send("discord", "ops"), want: protocol.CodeUpstream},
+		{name: "not found", req: protocol.Request{Action: protocol.ActionContext, EventID: 999}, want: protocol.CodeNotFound},
+		{name: "unknown action", req: protocol.Request{Action: "nope"}, want: protocol.CodeInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := s.handleRequest(context.Background(), tt.req)
+			if resp.OK || resp.Code != tt.want {
+				t.Fatalf("expected code %q, got %+v", tt.want, resp)
+			}
+		})
+	}
+
+	if resp := s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionPing}); resp.Code != "" {
+		t.Fatalf("expected no code on success, got %q", resp.Code)
+	}
+}
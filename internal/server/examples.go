@@ -0,0 +1,231 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+)
+
+// exampleCommands lists the commands examples are generated for, in output
+// order, with the aliases the CLI accepts.
+var exampleCommands = []string{"bots", "status", "send", "react", "history", "notifications", "stream"}
+
+var exampleAliases = map[string]string{
+	"notify":    "notifications",
+	"subscribe": "stream",
+}
+
+// placeholderChannels are shaped like real IDs on each service. They are only
+// used when a bot has no stored history to borrow a channel from.
+var placeholderChannels = map[string]string{
+	"slack":      "C0123456789",
+	"discord":    "123456789012345678",
+	"mattermost": "4xp9fdt77pncbef59f4k1qe83o",
+	"telegram":   "-1001234567890",
+	"matrix":     "!room:example.org",
+	"irc":        "#general",
+	"zulip":      "general",
+	"twilio":     "+15551234567",
+	"whatsapp":   "15551234567@s.whatsapp.net",
+	"imessage":   "+15551234567",
+	"mock":       "general",
+}
+
+// exampleContext is what the examples are built around: one real bot and,
+// when the store has any, the conversation it was most recently active in.
+type exampleContext struct {
+	bot         protocol.BotRef
+	ambiguous   bool // another service has a bot with the same name
+	channel     string
+	thread      string
+	placeholder bool // channel is made up, not from history
+}
+
+// examples returns copy-pasteable commands for this installation, optionally
+// limited to one command.
+func (s *Server) examples(command string) ([]protocol.Example, error) {
+	if alias, ok := exampleAliases[command]; ok {
+		command = alias
+	}
+	if command != "" && !containsString(exampleCommands, command) {
+		return nil, fmt.Errorf("no examples for %q (available: %s)", command, strings.Join(exampleCommands, ", "))
+	}
+
+	s.mu.RLock()
+	bots := make([]protocol.BotRef, 0, len(s.bots))
+	for _, bot := range s.bots {
+		bots = append(bots, bot)
+	}
+	s.mu.RUnlock()
+
+	if len(bots) == 0 {
+		return nil, fmt.Errorf("no bots configured")
+	}
+	sort.Slice(bots, func(i, j int) bool {
+		return botKey(bots[i].Service, bots[i].Name) < botKey(bots[j].Service, bots[j].Name)
+	})
+
+	ctx := s.exampleContext(bots)
+
+	var out []protocol.Example
+	for _, ex := range buildExamples(ctx, bots) {
+		if command == "" || ex.Command == command {
+			out = append(out, ex)
+		}
+	}
+	return out, nil
+}
+
+// exampleContext picks the bot with the most recent stored message, falling
+// back to the first configured bot and a placeholder channel.
+func (s *Server) exampleContext(bots []protocol.BotRef) exampleContext {
+	ctx := exampleContext{bot: bots[0]}
+
+	if s.notifications != nil {
+		var latest protocol.Event
+		for _, bot := range bots {
+			events, err := s.notifications.ListEvents(store.EventFilter{Service: bot.Service, Bot: bot.Name, Limit: 20})
+			if err != nil {
+				continue
+			}
+			for i := len(events) - 1; i >= 0; i-- {
+				if events[i].Channel == "" {
+					continue
+				}
+				if events[i].ID > latest.ID {
+					latest = events[i]
+					ctx.bot = bot
+				}
+				break
+			}
+		}
+		ctx.channel = latest.Channel
+		ctx.thread = latest.Thread
+	}
+
+	if ctx.channel == "" {
+		ctx.channel = placeholderChannels[ctx.bot.Service]
+		if ctx.channel == "" {
+			ctx.channel = "CHANNEL_ID"
+		}
+		ctx.placeholder = true
+	}
+
+	for _, bot := range bots {
+		if bot.Name == ctx.bot.Name && bot.Service != ctx.bot.Service {
+			ctx.ambiguous = true
+		}
+	}
+
+	return ctx
+}
+
+func buildExamples(ctx exampleContext, bots []protocol.BotRef) []protocol.Example {
+	botArgs := []string{"--bot", ctx.bot.Name}
+	if ctx.ambiguous {
+		botArgs = append([]string{"--service", ctx.bot.Service}, botArgs...)
+	}
+	where := ctx.channel
+	if ctx.placeholder {
+		where += " (placeholder - no history yet, use a real channel ID)"
+	}
+
+	names := make([]string, 0, len(bots))
+	for _, bot := range bots {
+		names = append(names, bot.Name)
+	}
+
+	examples := []protocol.Example{
+		{
+			Command:     "bots",
+			Description: fmt.Sprintf("List the configured bots (%s)", strings.Join(names, ", ")),
+			Line:        commandLine("bots"),
+		},
+		{
+			Command:     "status",
+			Description: "Check the daemon is up and see the notification backlog",
+			Line:        commandLine("status"),
+		},
+		{
+			Command:     "send",
+			Description: "Post a message to " + where,
+			Line:        commandLine("send", append(botArgs, "--channel", ctx.channel, "--text", "Hello from pantalk")...),
+		},
+	}
+
+	if ctx.thread != "" {
+		examples = append(examples,
+			protocol.Example{
+				Command:     "send",
+				Description: "Reply in the most recent thread on " + ctx.channel,
+				Line:        commandLine("send", append(botArgs, "--channel", ctx.channel, "--thread", ctx.thread, "--text", "On it")...),
+			},
+			protocol.Example{
+				Command:     "react",
+				Description: "React to that thread's message",
+				Line:        commandLine("react", append(botArgs, "--channel", ctx.channel, "--thread", ctx.thread, "--emoji", "white_check_mark")...),
+			},
+		)
+	}
+
+	examples = append(examples,
+		protocol.Example{
+			Command:     "history",
+			Description: "Read the last 20 messages in " + where,
+			Line:        commandLine("history", append(botArgs, "--channel", ctx.channel, "--limit", "20")...),
+		},
+		protocol.Example{
+			Command:     "notifications",
+			Description: "List mentions, DMs and followed threads you haven't handled",
+			Line:        commandLine("notifications", "--unseen"),
+		},
+		protocol.Example{
+			Command:     "notifications",
+			Description: "Mark " + ctx.bot.Name + "'s notifications as seen",
+			Line:        commandLine("notifications", append(botArgs, "--unseen", "--clear")...),
+		},
+		protocol.Example{
+			Command:     "stream",
+			Description: "Wait up to two minutes for the next notification to " + ctx.bot.Name,
+			Line:        commandLine("stream", append(botArgs, "--notify", "--timeout", "120")...),
+		},
+	)
+
+	return examples
+}
+
+// commandLine renders a pantalk invocation, quoting arguments the shell
+// would otherwise split or expand.
+func commandLine(command string, args ...string) string {
+	parts := []string{"pantalk", command}
+	for _, arg := range args {
+		parts = append(parts, shellQuote(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+func shellQuote(arg string) string {
+	safe := arg != ""
+	for _, r := range arg {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:/@+=,", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+func containsString(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+func TestExamples_UsesHistory(t *testing.T) {
+	st, err := store.Open(filepath.Join(t.TempDir(), "pantalk-examples.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+
+	s := &Server{
+		notifications: st,
+		bots: map[string]protocol.BotRef{
+			"slack:ops":    {Service: "slack", Name: "ops"},
+			"telegram:eng": {Service: "telegram", Name: "eng"},
+		},
+		connectors:  make(map[string]upstream.Connector),
+		routesByBot: make(map[string]map[string]struct{}),
+		subsByBot:   make(map[string]map[*subscriber]struct{}),
+	}
+	s.publish(protocol.Event{Service: "slack", Bot: "ops", Kind: "message", Direction: "in", Channel: "C0OLD", Text: "old"})
+	s.publish(protocol.Event{Service: "telegram", Bot: "eng", Kind: "message", Direction: "in", Channel: "-100777", Thread: "42", Text: "new"})
+
+	examples, err := s.examples("send")
+	if err != nil {
+		t.Fatalf("examples: %v", err)
+	}
+	if len(examples) != 2 {
+		t.Fatalf("expected channel and thread send examples, got %+v", examples)
+	}
+	if want := "pantalk send --bot eng --channel -100777 --text 'Hello from pantalk'"; examples[0].Line != want {
+		t.Errorf("expected most recently active bot and channel:\n got %s\nwant %s", examples[0].Line, want)
+	}
+	if !strings.Contains(examples[1].Line, "--thread 42") {
+		t.Errorf("expected thread reply example, got %s", examples[1].Line)
+	}
+}
+
+func TestExamples_Placeholders(t *testing.T) {
+	s := &Server{
+		bots: map[string]protocol.BotRef{
+			"slack:ops":   {Service: "slack", Name: "ops"},
+			"discord:ops": {Service: "discord", Name: "ops"},
+		},
+	}
+
+	examples, err := s.examples("history")
+	if err != nil {
+		t.Fatalf("examples: %v", err)
+	}
+	if len(examples) != 1 {
+		t.Fatalf("expected one history example, got %+v", examples)
+	}
+	ex := examples[0]
+	if ex.Line != "pantalk history --service discord --bot ops --channel 123456789012345678 --limit 20" {
+		t.Errorf("unexpected line: %s", ex.Line)
+	}
+	if !strings.Contains(ex.Description, "placeholder") {
+		t.Errorf("made-up channel should be called out: %s", ex.Description)
+	}
+
+	if examples, _ := s.examples("react"); len(examples) != 0 {
+		t.Errorf("react needs a real message, got %+v", examples)
+	}
+	if _, err := s.examples("pair"); err == nil {
+		t.Error("expected error for a command without examples")
+	}
+	if examples, err := s.examples("subscribe"); err != nil || len(examples) != 1 || examples[0].Command != "stream" {
+		t.Errorf("expected alias to resolve to stream, got %+v, %v", examples, err)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := map[string]string{
+		"ops-bot":      "ops-bot",
+		"#general":     "'#general'",
+		"it's done":    `'it'\''s done'`,
+		"":             "''",
+		"+15551234567": "+15551234567",
+	}
+	for in, want := range tests {
+		if got := shellQuote(in); got != want {
+			t.Errorf("shellQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
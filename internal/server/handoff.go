@@ -0,0 +1,230 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+)
+
+// releaseTimeout bounds how long a successor waits for the old daemon to
+// drain and let go of the connectors and database. Connections made in the
+// meantime queue on the inherited socket.
+const releaseTimeout = drainTimeout + 20*time.Second
+
+// streamsTimeout bounds how long the old daemon waits for subscriptions to
+// flush their queues and send the handoff event.
+const streamsTimeout = 5 * time.Second
+
+// handoffState tracks a handoff to a successor on the old daemon.
+type handoffState struct {
+	released chan struct{} // closed once the connectors are stopped and the store is closed
+	done     chan struct{} // closed once the successor has been told
+}
+
+// inherited holds what a successor got from the daemon it took over from.
+type inherited struct {
+	listener net.Listener
+	http     net.Listener  // nil when the old daemon had no HTTP API
+	conn     *net.UnixConn // answers "released" once the old daemon has let go
+}
+
+// SetTakeover makes Run take the listening sockets over from the daemon
+// already running on the configured socket instead of creating them.
+func (s *Server) SetTakeover(enabled bool) {
+	s.takeover = enabled
+}
+
+// handOff passes the listening sockets to a successor, stops accepting and
+// blocks until Run has drained and released everything, so the successor
+// can open the database and start the connectors.
+func (s *Server) handOff(conn net.Conn, encoder responseEncoder) {
+	unixConn, ok := conn.(*net.UnixConn)
+	unixListener, listening := s.listener.(*net.UnixListener)
+	if !ok || !listening {
+		_ = encoder.Encode(failed(invalidRequest("handoff needs the daemon's unix socket")))
+		return
+	}
+
+	state := &handoffState{released: make(chan struct{}), done: make(chan struct{})}
+	s.mu.Lock()
+	if s.handoff != nil {
+		s.mu.Unlock()
+		_ = encoder.Encode(failed(withCode(protocol.CodeUnavailable, errors.New("a handoff is already in progress"))))
+		return
+	}
+	s.handoff = state
+	httpListener := s.httpListener
+	s.mu.Unlock()
+	defer close(state.done)
+
+	if err := sendListeners(unixConn, unixListener, httpListener); err != nil {
+		log.Printf("warning: handoff failed: %v", err)
+		s.mu.Lock()
+		s.handoff = nil
+		s.mu.Unlock()
+		_ = encoder.Encode(failed(err))
+		return
+	}
+
+	log.Printf("handing the socket over to a new pantalkd; draining")
+	// The successor serves the same path, so it must outlive this listener.
+	unixListener.SetUnlinkOnClose(false)
+	_ = unixListener.Close()
+
+	<-state.released
+	_ = encoder.Encode(protocol.Response{OK: true, Ack: "released"})
+}
+
+// release ends the subscriptions, stops the connectors and closes the
+// database once in-flight sends have drained, then tells the successor it
+// can start.
+func (s *Server) release(handoff *handoffState, stopServing context.CancelFunc, events *store.Store) {
+	s.endStreams()
+	stopServing()
+	if err := events.Close(); err != nil {
+		log.Printf("warning: close database: %v", err)
+	}
+	close(handoff.released)
+
+	select {
+	case <-handoff.done:
+		log.Printf("handed over to the new pantalkd")
+	case <-time.After(streamsTimeout):
+		log.Printf("warning: new pantalkd did not take the release notice")
+	}
+}
+
+// handingOff returns the handoff in progress, if any.
+func (s *Server) handingOff() *handoffState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.handoff
+}
+
+// endStreams has every subscription flush what it queued and send its
+// handoff event, and waits for them within streamsTimeout.
+func (s *Server) endStreams() {
+	s.endStreamsOnce.Do(func() { close(s.streamsEnding) })
+
+	done := make(chan struct{})
+	go func() {
+		s.streams.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(streamsTimeout):
+		log.Printf("warning: subscriptions still open after %s; closing them", streamsTimeout)
+	}
+}
+
+// takeOver asks the daemon on socketPath for its listening sockets.
+func takeOver(socketPath string) (*inherited, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("connect to the running daemon: %w", err)
+	}
+	unixConn := conn.(*net.UnixConn)
+
+	request, err := json.Marshal(protocol.Request{Action: protocol.ActionHandoff})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := unixConn.Write(append(request, '\n')); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("request handoff: %w", err)
+	}
+
+	line, files, err := receiveListeners(unixConn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("receive sockets: %w", err)
+	}
+	var resp protocol.Response
+	if err := json.Unmarshal(bytes.TrimSpace(line), &resp); err != nil {
+		closeFiles(files)
+		conn.Close()
+		return nil, fmt.Errorf("decode handoff response: %w", err)
+	}
+	if !resp.OK {
+		closeFiles(files)
+		conn.Close()
+		return nil, fmt.Errorf("running daemon refused the handoff: %s", resp.Error)
+	}
+	if len(files) == 0 {
+		conn.Close()
+		return nil, errors.New("running daemon sent no sockets")
+	}
+
+	got := &inherited{conn: unixConn}
+	defer closeFiles(files)
+	if got.listener, err = net.FileListener(files[0]); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("inherit socket: %w", err)
+	}
+	if len(files) > 1 {
+		if got.http, err = net.FileListener(files[1]); err != nil {
+			got.listener.Close()
+			conn.Close()
+			return nil, fmt.Errorf("inherit http listener: %w", err)
+		}
+	}
+	return got, nil
+}
+
+// waitReleased waits for the old daemon to stop its connectors and close
+// the database. It gives up after releaseTimeout; the old daemon going away
+// counts as released.
+func (in *inherited) waitReleased() {
+	defer in.conn.Close()
+	_ = in.conn.SetReadDeadline(time.Now().Add(releaseTimeout))
+
+	var resp protocol.Response
+	err := json.NewDecoder(bufio.NewReader(in.conn)).Decode(&resp)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		log.Printf("warning: previous daemon did not finish draining within %s; starting anyway", releaseTimeout)
+	}
+}
+
+// activatedListener returns the socket passed by systemd socket activation
+// (LISTEN_FDS), or nil when the daemon wasn't started that way.
+func activatedListener() (net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, nil
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	// The first passed descriptor is always 3, after stdin, stdout and stderr.
+	file := os.NewFile(3, "systemd-socket")
+	defer file.Close()
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("use activated socket: %w", err)
+	}
+	return listener, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+var errHandoffUnsupported = errors.New("socket handoff is not supported on this platform")
+
+func sendListeners(*net.UnixConn, *net.UnixListener, net.Listener) error {
+	return errHandoffUnsupported
+}
+
+func receiveListeners(*net.UnixConn) ([]byte, []*os.File, error) {
+	return nil, nil, errHandoffUnsupported
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func TestHandoff_StreamEndsWithResumePoint(t *testing.T) {
+	s := newReplayServer(t)
+	s.streamsEnding = make(chan struct{})
+
+	publishText(s, "slack", "ops", "before")
+	decoder := subscribeStream(t, s, protocol.Request{Action: protocol.ActionSubscribe, Service: "slack", Bot: "ops"})
+	publishText(s, "slack", "ops", "queued")
+
+	ended := make(chan struct{})
+	go func() {
+		s.endStreams()
+		close(ended)
+	}()
+
+	if ev := nextEvent(t, decoder); ev.Text != "queued" {
+		t.Fatalf("expected the queued event before the handoff, got %+v", ev)
+	}
+	marker := nextEvent(t, decoder)
+	if marker.Kind != protocol.KindHandoff || marker.ID != 2 {
+		t.Fatalf("expected handoff event resuming after id 2, got %+v", marker)
+	}
+
+	// What the old daemon stored after the stream ended is replayed on
+	// the successor.
+	<-ended
+	publishText(s, "slack", "ops", "missed")
+	successor := newReplayServer(t)
+	successor.notifications = s.notifications
+	resumed := subscribeStream(t, successor, protocol.Request{Action: protocol.ActionSubscribe, Service: "slack", Bot: "ops", SinceID: marker.ID})
+	if ev := nextEvent(t, resumed); ev.Text != "missed" {
+		t.Fatalf("expected the missed event replayed, got %+v", ev)
+	}
+}
+
+func TestHandoff_PassesSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no descriptor passing")
+	}
+	path := filepath.Join(t.TempDir(), "p.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	s := newReplayServer(t)
+	s.listener = listener
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.handleConn(ctx, conn)
+		}
+	}()
+
+	got, err := takeOver(path)
+	if err != nil {
+		t.Fatalf("take over: %v", err)
+	}
+	t.Cleanup(func() { _ = got.listener.Close() })
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("old daemon still accepting after the handoff")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected the socket to outlive the old listener: %v", err)
+	}
+
+	client, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial after handoff: %v", err)
+	}
+	defer client.Close()
+	conn, err := got.listener.Accept()
+	if err != nil {
+		t.Fatalf("accept on inherited socket: %v", err)
+	}
+	conn.Close()
+
+	released := make(chan struct{})
+	go func() {
+		got.waitReleased()
+		close(released)
+	}()
+	select {
+	case <-released:
+		t.Fatal("successor started before the old daemon released")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(s.handingOff().released)
+	select {
+	case <-released:
+	case <-time.After(5 * time.Second):
+		t.Fatal("successor not told about the release")
+	}
+}
@@ -0,0 +1,77 @@
+//go:build unix
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// sendListeners writes the handoff response with the unix socket and, when
+// there is one, the HTTP listener attached as SCM_RIGHTS.
+func sendListeners(conn *net.UnixConn, listener *net.UnixListener, httpListener net.Listener) error {
+	socketFile, err := listener.File()
+	if err != nil {
+		return fmt.Errorf("duplicate socket: %w", err)
+	}
+	files := []*os.File{socketFile}
+	defer closeFiles(files)
+
+	if tcp, ok := httpListener.(*net.TCPListener); ok {
+		httpFile, err := tcp.File()
+		if err != nil {
+			return fmt.Errorf("duplicate http listener: %w", err)
+		}
+		files = append(files, httpFile)
+	}
+
+	fds := make([]int, len(files))
+	for i, f := range files {
+		fds[i] = int(f.Fd())
+	}
+	line, err := json.Marshal(protocol.Response{OK: true, Ack: "handoff"})
+	if err != nil {
+		return err
+	}
+	if _, _, err := conn.WriteMsgUnix(append(line, '\n'), syscall.UnixRights(fds...), nil); err != nil {
+		return fmt.Errorf("send sockets: %w", err)
+	}
+	return nil
+}
+
+// receiveListeners reads the handoff response line and the descriptors
+// passed with it.
+func receiveListeners(conn *net.UnixConn) ([]byte, []*os.File, error) {
+	buf := make([]byte, 4096)
+	oob := make([]byte, syscall.CmsgSpace(2*4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return nil, nil, err
+	}
+	if bytes.IndexByte(buf[:n], '\n') < 0 {
+		return nil, nil, errors.New("truncated handoff response")
+	}
+
+	messages, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse control message: %w", err)
+	}
+	var files []*os.File
+	for _, message := range messages {
+		fds, err := syscall.ParseUnixRights(&message)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			files = append(files, os.NewFile(uintptr(fd), "inherited-listener"))
+		}
+	}
+	return buf[:n], files, nil
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/version"
+)
+
+// supportedActions lists every action the daemon handles, for hello. Keep
+// it in step with handleRequest and handleConn.
+var supportedActions = []string{
+	protocol.ActionHello,
+	protocol.ActionPing,
+	protocol.ActionStatus,
+	protocol.ActionLogs,
+	protocol.ActionDebug,
+	protocol.ActionBots,
+	protocol.ActionNotify,
+	protocol.ActionClearNotify,
+	protocol.ActionClearHistory,
+	protocol.ActionHistory,
+	protocol.ActionSend,
+	protocol.ActionBroadcast,
+	protocol.ActionReact,
+	protocol.ActionReload,
+	protocol.ActionExamples,
+	protocol.ActionAgents,
+	protocol.ActionAgentRuns,
+	protocol.ActionRunAgent,
+	protocol.ActionTestAgent,
+	protocol.ActionMarkRead,
+	protocol.ActionPresence,
+	protocol.ActionJoinChannel,
+	protocol.ActionLeaveChannel,
+	protocol.ActionCreateChannel,
+	protocol.ActionInviteChannel,
+	protocol.ActionListTopics,
+	protocol.ActionMute,
+	protocol.ActionUnmute,
+	protocol.ActionMutes,
+	protocol.ActionContext,
+	protocol.ActionSubscribe,
+	protocol.ActionUnsubscribe,
+	protocol.ActionHandoff,
+}
+
+// hello negotiates the protocol version with a client. Clients newer than
+// the daemon are served at the daemon's version; clients that don't send
+// one are taken to speak the current version.
+func hello(req protocol.Request) protocol.Response {
+	if req.Version < 0 {
+		return protocol.Response{OK: false, Error: fmt.Sprintf("invalid protocol version %d", req.Version), Code: protocol.CodeInvalidRequest}
+	}
+	if req.Version > 0 && req.Version < protocol.MinProtocolVersion {
+		return protocol.Response{OK: false, Error: fmt.Sprintf(
+			"pantalk speaks protocol v%d but pantalkd %s needs at least v%d; upgrade pantalk",
+			req.Version, version.Version, protocol.MinProtocolVersion), Code: protocol.CodeProtocolMismatch}
+	}
+
+	negotiated := protocol.ProtocolVersion
+	if req.Version > 0 {
+		negotiated = min(req.Version, protocol.ProtocolVersion)
+	}
+	return protocol.Response{OK: true, Hello: &protocol.Hello{
+		Version:    negotiated,
+		MinVersion: protocol.MinProtocolVersion,
+		Daemon:     version.Version,
+		Actions:    append([]string(nil), supportedActions...),
+	}}
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func TestHello(t *testing.T) {
+	resp := hello(protocol.Request{Action: protocol.ActionHello, Version: protocol.ProtocolVersion + 3})
+	if !resp.OK || resp.Hello == nil || resp.Hello.Version != protocol.ProtocolVersion {
+		t.Fatalf("expected a newer client served at v%d, got %+v", protocol.ProtocolVersion, resp)
+	}
+
+	resp = hello(protocol.Request{Action: protocol.ActionHello})
+	if !resp.OK || resp.Hello.Version != protocol.ProtocolVersion {
+		t.Fatalf("expected a client without a version served at the current one, got %+v", resp)
+	}
+
+	if resp := hello(protocol.Request{Action: protocol.ActionHello, Version: -1}); resp.OK {
+		t.Fatal("expected a negative version rejected")
+	}
+	if protocol.MinProtocolVersion > 1 {
+		if resp := hello(protocol.Request{Action: protocol.ActionHello, Version: protocol.MinProtocolVersion - 1}); resp.OK {
+			t.Fatal("expected a client older than MinProtocolVersion rejected")
+		}
+	}
+}
+
+// Every action hello advertises must be one the daemon handles.
+func TestHello_ActionsHandled(t *testing.T) {
+	s := newReplayServer(t)
+	for _, action := range supportedActions {
+		if action == protocol.ActionSubscribe || action == protocol.ActionReload {
+			continue // take over the connection / need a config file
+		}
+		resp := s.handleRequest(context.Background(), protocol.Request{Action: action})
+		if strings.HasPrefix(resp.Error, "unsupported action") {
+			t.Errorf("hello lists %q but handleRequest doesn't handle it", action)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pantalk/pantalk/internal/store"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+// homeRecentLimit caps the notifications listed on a home surface.
+const homeRecentLimit = 10
+
+// homeFunc returns the summary shown on a bot's home surface: its own
+// unseen notifications and every agent with its last run.
+func (s *Server) homeFunc(service string, bot string) upstream.HomeFunc {
+	return func(ctx context.Context) (upstream.HomeSummary, error) {
+		s.mu.RLock()
+		st := s.notifications
+		s.mu.RUnlock()
+
+		if st == nil {
+			return upstream.HomeSummary{}, fmt.Errorf("notification store is not available")
+		}
+
+		unseen, err := st.UnseenCount(service, bot)
+		if err != nil {
+			return upstream.HomeSummary{}, err
+		}
+		recent, err := st.ListNotifications(store.NotificationFilter{Service: service, Bot: bot, Unseen: true, Limit: homeRecentLimit})
+		if err != nil {
+			return upstream.HomeSummary{}, err
+		}
+		// Listed oldest first; the home surface shows the newest on top.
+		for i, j := 0, len(recent)-1; i < j; i, j = i+1, j-1 {
+			recent[i], recent[j] = recent[j], recent[i]
+		}
+
+		return upstream.HomeSummary{
+			Unseen: unseen,
+			Recent: recent,
+			Agents: s.agentInfos(true),
+		}, nil
+	}
+}
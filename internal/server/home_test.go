@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/agent"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+func TestHomeFunc(t *testing.T) {
+	st, err := store.Open(filepath.Join(t.TempDir(), "pantalk-home.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+
+	triage, err := agent.NewRunner(agent.Config{Name: "triage", When: "tick", Command: agent.Command{"claude"}})
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+
+	s := &Server{
+		notifications: st,
+		agents:        []*agent.Runner{triage},
+		bots: map[string]protocol.BotRef{
+			"slack:ops": {Service: "slack", Name: "ops"},
+			"slack:eng": {Service: "slack", Name: "eng"},
+		},
+		connectors:  make(map[string]upstream.Connector),
+		routesByBot: make(map[string]map[string]struct{}),
+		subsByBot:   make(map[string]map[*subscriber]struct{}),
+	}
+	for _, dm := range []struct{ bot, text string }{{"ops", "first"}, {"eng", "elsewhere"}, {"ops", "second"}} {
+		s.publish(protocol.Event{Service: "slack", Bot: dm.bot, Kind: "message", Direction: "in", Channel: "D0123456789", User: "U1", Text: dm.text, Direct: true})
+	}
+
+	summary, err := s.homeFunc("slack", "ops")(context.Background())
+	if err != nil {
+		t.Fatalf("home summary: %v", err)
+	}
+	if summary.Unseen != 2 || len(summary.Recent) != 2 || summary.Recent[0].Text != "second" {
+		t.Errorf("expected the bot's own unseen notifications, newest first, got %+v", summary)
+	}
+	if len(summary.Agents) != 1 || summary.Agents[0].Name != "triage" {
+		t.Errorf("expected agents in summary, got %+v", summary.Agents)
+	}
+}
@@ -0,0 +1,369 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/ntfy"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+// forwardTimeout bounds a single ntfy publish.
+const forwardTimeout = 30 * time.Second
+
+// snoozeCheckInterval is how often expired snoozes are brought back.
+const snoozeCheckInterval = time.Minute
+
+// serveHTTP runs the HTTP API until ctx is cancelled. It only exposes the
+// notification actions used by ntfy buttons, the callbacks of interactive
+// messages and platform webhooks; everything else stays on the unix socket.
+func (s *Server) serveHTTP(ctx context.Context, listener net.Listener, token string) {
+	srv := s.newHTTPServer(ctx, token)
+	if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("warning: http api stopped: %v", err)
+	}
+}
+
+// serveHTTPS is serveHTTP over TLS, with the certificate and key at the
+// given paths.
+func (s *Server) serveHTTPS(ctx context.Context, listener net.Listener, token, certFile, keyFile string) {
+	srv := s.newHTTPServer(ctx, token)
+	if err := srv.ServeTLS(listener, certFile, keyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("warning: http api stopped: %v", err)
+	}
+}
+
+// newHTTPServer returns the HTTP API server, shut down once ctx is
+// cancelled.
+func (s *Server) newHTTPServer(ctx context.Context, token string) *http.Server {
+	srv := &http.Server{
+		Handler:           s.httpHandler(token),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	return srv
+}
+
+func (s *Server) httpHandler(token string) http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("POST /v1/notifications/{id}/seen", s.handleHTTPSeen)
+	api.HandleFunc("POST /v1/notifications/{id}/snooze", s.handleHTTPSnooze)
+
+	want := []byte("Bearer " + token)
+	authenticated := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			writeHTTPError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		api.ServeHTTP(w, r)
+	})
+
+	// Platforms can't send the bearer token with their callbacks; the
+	// connector checks the secret it put in its buttons, or the platform's
+	// signature, instead.
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/actions/{service}/{bot}", s.handleHTTPAction)
+	mux.HandleFunc("POST /v1/webhooks/{service}/{bot}", s.handleHTTPWebhook)
+	mux.Handle("/", authenticated)
+	return mux
+}
+
+// maxActionBody caps the size of an action callback.
+const maxActionBody = 64 << 10
+
+func (s *Server) handleHTTPAction(w http.ResponseWriter, r *http.Request) {
+	key := botKey(r.PathValue("service"), r.PathValue("bot"))
+	s.mu.RLock()
+	connector := s.connectors[key]
+	s.mu.RUnlock()
+
+	receiver, ok := connector.(upstream.ActionReceiver)
+	if !ok {
+		writeHTTPError(w, http.StatusNotFound, "no bot takes action callbacks at this path")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxActionBody))
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, "read body: "+err.Error())
+		return
+	}
+	if err := receiver.HandleAction(r.Context(), body); err != nil {
+		log.Printf("[%s] action callback rejected: %v", key, err)
+		writeHTTPError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeHTTPResponse(w, protocol.Response{OK: true})
+}
+
+// maxWebhookBody caps the size of a platform webhook delivery.
+const maxWebhookBody = 1 << 20
+
+func (s *Server) handleHTTPWebhook(w http.ResponseWriter, r *http.Request) {
+	key := botKey(r.PathValue("service"), r.PathValue("bot"))
+	s.mu.RLock()
+	connector := s.connectors[key]
+	s.mu.RUnlock()
+
+	receiver, ok := connector.(upstream.WebhookReceiver)
+	if !ok {
+		writeHTTPError(w, http.StatusNotFound, "no bot takes webhooks at this path")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, "read body: "+err.Error())
+		return
+	}
+	// The connector answers before handling the event, so slow middleware
+	// doesn't make the platform retry.
+	reply, err := receiver.HandleWebhook(r.Context(), r.Header, body)
+	switch {
+	case errors.Is(err, upstream.ErrNotWebhook):
+		writeHTTPError(w, http.StatusNotFound, "no bot takes webhooks at this path")
+		return
+	case errors.Is(err, upstream.ErrWebhookUnauthorized):
+		log.Printf("[%s] webhook rejected: %v", key, err)
+		writeHTTPError(w, http.StatusUnauthorized, err.Error())
+		return
+	case err != nil:
+		log.Printf("[%s] webhook rejected: %v", key, err)
+		writeHTTPError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Some platforms expect a body of their own, such as Slack's URL
+	// verification challenge.
+	if reply != nil {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write(reply)
+		return
+	}
+	writeHTTPResponse(w, protocol.Response{OK: true})
+}
+
+// actionEndpoint returns the callback URL on the HTTP API for a bot's
+// interactive messages and the secret its buttons carry, derived from the
+// HTTP token so it survives restarts. ok is false without the HTTP API.
+func actionEndpoint(cfg config.Config, bot config.BotConfig) (string, string, bool) {
+	base := cfg.HTTPBaseURL()
+	secret, ok := httpSecret(cfg, "actions:"+botKey(bot.Type, bot.Name))
+	if base == "" || !ok {
+		return "", "", false
+	}
+	return base + "/v1/actions/" + url.PathEscape(bot.Type) + "/" + url.PathEscape(bot.Name), secret, true
+}
+
+// webhookEndpoint returns the URL a transport: webhook bot's platform
+// delivers to and the secret token those deliveries carry, where the
+// platform lets pantalk choose one. ok is false without the HTTP API.
+func webhookEndpoint(cfg config.Config, bot config.BotConfig) (string, string, bool) {
+	webhookURL := cfg.WebhookURL(bot)
+	secret, ok := httpSecret(cfg, "webhooks:"+botKey(bot.Type, bot.Name))
+	if webhookURL == "" || !ok {
+		return "", "", false
+	}
+	return webhookURL, secret, true
+}
+
+// httpSecret derives a secret for purpose from the HTTP token.
+func httpSecret(cfg config.Config, purpose string) (string, bool) {
+	token, err := config.ResolveCredential(cfg.Server.HTTPToken)
+	if err != nil {
+		return "", false
+	}
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(purpose))
+	return hex.EncodeToString(mac.Sum(nil)), true
+}
+
+func (s *Server) handleHTTPSeen(w http.ResponseWriter, r *http.Request) {
+	id, ok := notificationIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	cleared, err := s.notifications.MarkSeenByID(id)
+	if err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeHTTPResponse(w, protocol.Response{OK: true, Cleared: cleared, Ack: "notification marked seen"})
+}
+
+func (s *Server) handleHTTPSnooze(w http.ResponseWriter, r *http.Request) {
+	id, ok := notificationIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	duration := ntfy.DefaultSnooze
+	if raw := r.URL.Query().Get("for"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			writeHTTPError(w, http.StatusBadRequest, "for must be a positive duration such as 1h or 30m")
+			return
+		}
+		duration = parsed
+	}
+
+	until := time.Now().Add(duration)
+	found, err := s.notifications.SnoozeNotification(id, until)
+	if err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeHTTPError(w, http.StatusNotFound, "notification not found")
+		return
+	}
+
+	writeHTTPResponse(w, protocol.Response{OK: true, Ack: "notification snoozed until " + until.Format(time.Kitchen)})
+}
+
+func notificationIDParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeHTTPError(w, http.StatusBadRequest, "invalid notification id")
+		return 0, false
+	}
+	return id, true
+}
+
+func writeHTTPResponse(w http.ResponseWriter, resp protocol.Response) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func writeHTTPError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(protocol.Response{OK: false, Error: message})
+}
+
+// newPublisher builds the ntfy publisher for cfg, or returns nil when ntfy
+// forwarding is not configured.
+func newPublisher(cfg config.Config) (*ntfy.Publisher, error) {
+	if cfg.Ntfy == nil {
+		return nil, nil
+	}
+
+	pc := ntfy.Config{
+		Server:    cfg.Ntfy.Server,
+		Topic:     cfg.Ntfy.Topic,
+		ActionURL: cfg.Ntfy.ActionURL,
+		ThreadURL: cfg.Ntfy.ThreadURL,
+		Snooze:    time.Duration(cfg.Ntfy.Snooze) * time.Second,
+	}
+
+	if strings.TrimSpace(cfg.Ntfy.Token) != "" {
+		token, err := config.ResolveCredential(cfg.Ntfy.Token)
+		if err != nil {
+			return nil, err
+		}
+		pc.Token = token
+	}
+
+	// Without the HTTP API the seen and snooze buttons are left out.
+	if addr := strings.TrimSpace(cfg.Server.HTTPAddr); addr != "" {
+		token, err := config.ResolveCredential(cfg.Server.HTTPToken)
+		if err != nil {
+			return nil, err
+		}
+		pc.ActionToken = token
+		if pc.ActionURL == "" {
+			pc.ActionURL = cfg.HTTPBaseURL()
+		}
+	}
+
+	return ntfy.New(pc)
+}
+
+func (s *Server) publisher() *ntfy.Publisher {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ntfy
+}
+
+// forwardNotification pushes a newly stored notification to ntfy.
+func (s *Server) forwardNotification(publisher *ntfy.Publisher, event protocol.Event) {
+	parent := s.rootCtx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(parent, forwardTimeout)
+	defer cancel()
+
+	if err := publisher.Publish(ctx, event); err != nil {
+		log.Printf("[%s:%s] ntfy forward of notification %d failed: %v", event.Service, event.Bot, event.NotificationID, err)
+	}
+}
+
+// runSnoozeWaker brings snoozed notifications back once their time is up
+// and pushes them to ntfy again, so a snooze behaves like a reminder.
+func (s *Server) runSnoozeWaker(ctx context.Context) {
+	ticker := time.NewTicker(snoozeCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.wakeSnoozed(now)
+		}
+	}
+}
+
+func (s *Server) wakeSnoozed(now time.Time) {
+	events, err := s.notifications.WakeSnoozed(now)
+	if err != nil {
+		log.Printf("warning: wake snoozed notifications: %v", err)
+		return
+	}
+
+	publisher := s.publisher()
+	for _, event := range events {
+		log.Printf("[%s:%s] notification %d snooze expired", event.Service, event.Bot, event.NotificationID)
+		if publisher != nil {
+			go s.forwardNotification(publisher, event)
+		}
+	}
+
+	// Notification streams get them now, including those deferred by quiet
+	// hours, which weren't streamed as notifications when they came in.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, event := range events {
+		key := botKey(event.Service, event.Bot)
+		for sub := range s.subsByBot[key] {
+			if sub.notify {
+				s.deliver(sub, key, event)
+			}
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+func newHTTPTestServer(t *testing.T) (*Server, int64) {
+	t.Helper()
+	st, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+
+	event := protocol.Event{
+		Timestamp: time.Now(),
+		Service:   "slack",
+		Bot:       "ops",
+		Kind:      "message",
+		Direction: "in",
+		User:      "alice",
+		Channel:   "C1",
+		Text:      "ping",
+		Notify:    true,
+	}
+	event.ID, _ = st.InsertEvent(event)
+	id, err := st.InsertNotification(event)
+	if err != nil {
+		t.Fatalf("insert notification: %v", err)
+	}
+
+	return &Server{notifications: st}, id
+}
+
+func unseenCount(t *testing.T, s *Server) int {
+	t.Helper()
+	events, err := s.notifications.ListNotifications(store.NotificationFilter{Unseen: true, Limit: 10})
+	if err != nil {
+		t.Fatalf("list notifications: %v", err)
+	}
+	return len(events)
+}
+
+func TestHTTPHandler_RequiresToken(t *testing.T) {
+	s, _ := newHTTPTestServer(t)
+	handler := s.httpHandler("secret")
+
+	for _, auth := range []string{"", "Bearer wrong", "secret"} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/notifications/1/seen", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("auth %q: expected 401, got %d", auth, rec.Code)
+		}
+	}
+
+	if unseenCount(t, s) != 1 {
+		t.Fatal("unauthenticated request changed state")
+	}
+}
+
+func TestHTTPHandler_Seen(t *testing.T) {
+	s, id := newHTTPTestServer(t)
+	handler := s.httpHandler("secret")
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/notifications/"+strconv.FormatInt(id, 10)+"/seen", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if unseenCount(t, s) != 0 {
+		t.Fatal("notification still unseen")
+	}
+}
+
+func TestHTTPHandler_Snooze(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{name: "default duration", path: "/snooze", status: http.StatusOK},
+		{name: "explicit duration", path: "/snooze?for=30m", status: http.StatusOK},
+		{name: "bad duration", path: "/snooze?for=soon", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, id := newHTTPTestServer(t)
+			handler := s.httpHandler("secret")
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/notifications/"+strconv.FormatInt(id, 10)+tt.path, nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if unseenCount(t, s) != 0 {
+				t.Fatal("snoozed notification still unseen")
+			}
+
+			s.wakeSnoozed(time.Now().Add(2 * time.Hour))
+			if unseenCount(t, s) != 1 {
+				t.Fatal("notification did not come back after the snooze")
+			}
+		})
+	}
+}
+
+func TestHTTPHandler_SnoozeUnknown(t *testing.T) {
+	s, _ := newHTTPTestServer(t)
+	handler := s.httpHandler("secret")
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/notifications/999/snooze", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+type actionConnector struct {
+	idleConnector
+	bodies chan []byte
+}
+
+func (c *actionConnector) SetActionEndpoint(string, string) {}
+
+func (c *actionConnector) HandleAction(_ context.Context, body []byte) error {
+	if string(body) == "bad" {
+		return errors.New("action callback has an invalid secret")
+	}
+	c.bodies <- body
+	return nil
+}
+
+func TestHTTPHandler_ActionCallback(t *testing.T) {
+	connector := &actionConnector{bodies: make(chan []byte, 1)}
+	s := &Server{connectors: map[string]upstream.Connector{"mattermost:ops": connector}}
+	handler := s.httpHandler("secret")
+
+	post := func(path string, body string) int {
+		// Callbacks come from the platform, without the bearer token.
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := post("/v1/actions/mattermost/ops", `{"context":{}}`); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if body := <-connector.bodies; string(body) != `{"context":{}}` {
+		t.Fatalf("unexpected body passed on: %s", body)
+	}
+	if code := post("/v1/actions/mattermost/ops", "bad"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a rejected callback, got %d", code)
+	}
+	if code := post("/v1/actions/slack/other", "{}"); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a bot without callbacks, got %d", code)
+	}
+}
+
+func TestActionEndpoint(t *testing.T) {
+	bot := config.BotConfig{Name: "ops", Type: "mattermost"}
+
+	if _, _, ok := actionEndpoint(config.Config{}, bot); ok {
+		t.Fatal("expected no endpoint without the HTTP API")
+	}
+
+	cfg := config.Config{Server: config.ServerConfig{HTTPAddr: "127.0.0.1:8750", HTTPToken: "secret"}}
+	url, secret, ok := actionEndpoint(cfg, bot)
+	if !ok || url != "http://127.0.0.1:8750/v1/actions/mattermost/ops" || secret == "" {
+		t.Fatalf("unexpected endpoint %q %q %v", url, secret, ok)
+	}
+
+	cfg.Server.HTTPURL = "https://pantalk.example.com/"
+	other, otherSecret, _ := actionEndpoint(cfg, config.BotConfig{Name: "dev", Type: "mattermost"})
+	if other != "https://pantalk.example.com/v1/actions/mattermost/dev" || otherSecret == secret {
+		t.Fatalf("expected http_url base and a per-bot secret, got %q %q", other, otherSecret)
+	}
+}
+
+type webhookConnector struct {
+	idleConnector
+	bodies chan []byte
+}
+
+func (c *webhookConnector) SetWebhookEndpoint(string, string) {}
+
+func (c *webhookConnector) HandleWebhook(_ context.Context, header http.Header, body []byte) ([]byte, error) {
+	switch {
+	case header.Get("X-Signature") != "ok":
+		return nil, upstream.ErrWebhookUnauthorized
+	case string(body) == "challenge":
+		return []byte("abc123"), nil
+	}
+	c.bodies <- body
+	return nil, nil
+}
+
+func TestHTTPHandler_Webhook(t *testing.T) {
+	connector := &webhookConnector{bodies: make(chan []byte, 1)}
+	s := &Server{connectors: map[string]upstream.Connector{"slack:ops": connector}}
+	handler := s.httpHandler("secret")
+
+	post := func(path, signature, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("X-Signature", signature)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post("/v1/webhooks/slack/ops", "ok", `{"event":{}}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if body := <-connector.bodies; string(body) != `{"event":{}}` {
+		t.Fatalf("unexpected body passed on: %s", body)
+	}
+	if rec := post("/v1/webhooks/slack/ops", "ok", "challenge"); rec.Code != http.StatusOK || rec.Body.String() != "abc123" {
+		t.Fatalf("expected the connector's reply, got %d %q", rec.Code, rec.Body)
+	}
+	if rec := post("/v1/webhooks/slack/ops", "bad", "{}"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a bad signature, got %d", rec.Code)
+	}
+	if rec := post("/v1/webhooks/slack/other", "ok", "{}"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown bot, got %d", rec.Code)
+	}
+}
+
+func TestWebhookEndpoint(t *testing.T) {
+	bot := config.BotConfig{Name: "ops", Type: "telegram", Transport: config.TransportWebhook}
+
+	if _, _, ok := webhookEndpoint(config.Config{}, bot); ok {
+		t.Fatal("expected no endpoint without the HTTP API")
+	}
+
+	cfg := config.Config{Server: config.ServerConfig{HTTPAddr: "127.0.0.1:8750", HTTPToken: "secret", HTTPURL: "https://pantalk.example.com"}}
+	url, secret, ok := webhookEndpoint(cfg, bot)
+	if !ok || url != "https://pantalk.example.com/v1/webhooks/telegram/ops" || secret == "" {
+		t.Fatalf("unexpected endpoint %q %q %v", url, secret, ok)
+	}
+	if _, actionSecret, _ := actionEndpoint(cfg, bot); actionSecret == secret {
+		t.Fatal("expected the webhook secret to differ from the action secret")
+	}
+}
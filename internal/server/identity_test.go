@@ -0,0 +1,36 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// hybridConnector acts as a bot and, through a user token, as a person.
+type hybridConnector struct {
+	idleConnector
+	user string
+}
+
+func (c *hybridConnector) UserIdentity() string { return c.user }
+
+func TestAnnotateSelf_UserIdentity(t *testing.T) {
+	s := newReplayServer(t)
+	s.connectors["slack:ops"] = &hybridConnector{idleConnector: idleConnector{name: "UBOT"}, user: "UHUMAN"}
+	s.connectors["discord:ops"] = &idleConnector{name: "UBOT"}
+
+	events := []protocol.Event{
+		{Service: "slack", Bot: "ops", User: "UBOT"},
+		{Service: "slack", Bot: "ops", User: "UHUMAN"},
+		{Service: "slack", Bot: "ops", User: "UOTHER"},
+		{Service: "discord", Bot: "ops", User: "UHUMAN"},
+	}
+	s.annotateSelf(events)
+
+	want := []bool{true, true, false, false}
+	for i, event := range events {
+		if event.Self != want[i] {
+			t.Fatalf("event %d (%s from %s): self = %t, want %t", i, event.Service, event.User, event.Self, want[i])
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"log"
+	"regexp"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// ignoreRule is a bot's compiled ignore_users and ignore_patterns.
+type ignoreRule struct {
+	users    map[string]struct{}
+	patterns []*regexp.Regexp
+}
+
+// compileIgnore returns the ignore rule of bot, or nil when it ignores
+// nothing.
+func compileIgnore(bot config.BotConfig) (*ignoreRule, error) {
+	if len(bot.IgnoreUsers) == 0 && len(bot.IgnorePatterns) == 0 {
+		return nil, nil
+	}
+	patterns, err := bot.IgnoreRegexps()
+	if err != nil {
+		return nil, err
+	}
+	rule := &ignoreRule{users: make(map[string]struct{}, len(bot.IgnoreUsers)), patterns: patterns}
+	for _, user := range bot.IgnoreUsers {
+		rule.users[user] = struct{}{}
+	}
+	return rule, nil
+}
+
+// ignored reports whether an inbound event comes from one of the bot's
+// ignored users or has text matching one of its ignored patterns.
+func (s *Server) ignored(key string, event protocol.Event) bool {
+	if event.Direction != "in" {
+		return false
+	}
+	s.mu.RLock()
+	rule := s.ignores[key]
+	s.mu.RUnlock()
+	if rule == nil {
+		return false
+	}
+
+	if _, ok := rule.users[event.User]; ok && event.User != "" {
+		if s.debugging(key) {
+			log.Printf("debug: [%s] ignoring %s from %s on %s", key, event.Kind, event.User, event.Channel)
+		}
+		return true
+	}
+	for _, pattern := range rule.patterns {
+		if pattern.MatchString(event.Text) {
+			if s.debugging(key) {
+				log.Printf("debug: [%s] ignoring %s on %s matching %q", key, event.Kind, event.Channel, pattern.String())
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+)
+
+func TestPublish_DropsIgnoredEvents(t *testing.T) {
+	s := newReplayServer(t)
+	rule, err := compileIgnore(config.BotConfig{
+		IgnoreUsers:    []string{"B0DEPENDABOT"},
+		IgnorePatterns: []string{`^\[ci\] `},
+	})
+	if err != nil {
+		t.Fatalf("compile ignore: %v", err)
+	}
+	s.ignores = map[string]*ignoreRule{"slack:ops": rule}
+
+	for _, event := range []protocol.Event{
+		{Bot: "ops", User: "B0DEPENDABOT", Text: "@ops bump golang.org/x/net"},
+		{Bot: "ops", User: "B0DEPENDABOT", Kind: "reaction", Text: "+1"},
+		{Bot: "ops", User: "U1", Text: "[CI] build #42 passed"},
+		{Bot: "ops", User: "U1", Text: "@ops is [ci] green?"},
+		{Bot: "other", User: "B0DEPENDABOT", Text: "@other bump"},
+		{Bot: "ops", User: "B0DEPENDABOT", Direction: "out", Text: "replying to the bot"},
+	} {
+		event.Service, event.Channel = "slack", "C1"
+		if event.Kind == "" {
+			event.Kind = "message"
+		}
+		if event.Direction == "" {
+			event.Direction = "in"
+		}
+		s.publish(event)
+	}
+
+	events, err := s.notifications.ListEvents(store.EventFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	var texts []string
+	for _, event := range events {
+		texts = append(texts, event.Bot+": "+event.Text)
+	}
+	want := []string{"ops: @ops is [ci] green?", "other: @other bump", "ops: replying to the bot"}
+	if !slices.Equal(texts, want) {
+		t.Fatalf("expected %q, got %q", want, texts)
+	}
+
+	notifications, err := s.notifications.ListNotifications(store.NotificationFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("list notifications: %v", err)
+	}
+	if len(notifications) != 2 {
+		t.Fatalf("expected only the kept mentions to notify, got %+v", notifications)
+	}
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serveDebugHTTP runs the debug listener until ctx is cancelled: pprof
+// under /debug/pprof/, expvar counters under /debug/vars and a health
+// check at /healthz. None of it asks for a token, which is why config
+// validation only accepts a loopback server.debug_addr.
+func (s *Server) serveDebugHTTP(ctx context.Context, listener net.Listener) {
+	srv := &http.Server{
+		Handler:           s.debugHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("warning: debug listener stopped: %v", err)
+	}
+}
+
+func (s *Server) debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealthz)
+	mux.HandleFunc("GET /debug/vars", s.handleVars)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// handleHealthz answers 200 while the daemon serves requests and 503 once
+// it is handing over to a successor.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if s.handingOff() != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"ok":false,"status":"handing off"}` + "\n"))
+		return
+	}
+	_, _ = w.Write([]byte(`{"ok":true,"status":"serving"}` + "\n"))
+}
+
+// handleVars serves the process-wide expvar variables, like expvar's own
+// handler, plus the daemon's counters under "pantalk". Publishing those
+// with expvar.Publish would tie them to one Server per process.
+func (s *Server) handleVars(w http.ResponseWriter, r *http.Request) {
+	counters, err := json.Marshal(s.introspection())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprintf(w, "{\n")
+	expvar.Do(func(kv expvar.KeyValue) {
+		fmt.Fprintf(w, "%q: %s,\n", kv.Key, kv.Value)
+	})
+	fmt.Fprintf(w, "%q: %s\n}\n", "pantalk", counters)
+}
+
+// introspectionVars are the counters /debug/vars reports under "pantalk".
+type introspectionVars struct {
+	UptimeSec     int64              `json:"uptime_sec"`
+	Goroutines    int                `json:"goroutines"`
+	Subscribers   int                `json:"subscribers"`
+	DroppedEvents int64              `json:"dropped_events"`
+	Bots          map[string]botVars `json:"bots"`
+}
+
+// botVars are the counters of one connector. Goroutines counts those
+// started by its supervisor, found by their pprof "bot" label.
+type botVars struct {
+	Goroutines  int   `json:"goroutines"`
+	Subscribers int   `json:"subscribers"`
+	Queued      int   `json:"queued"`  // events waiting in its subscribers' buffers
+	Dropped     int64 `json:"dropped"` // by its subscribers since they connected
+}
+
+func (s *Server) introspection() introspectionVars {
+	goroutines := goroutinesByBot()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	vars := introspectionVars{
+		Goroutines:    runtime.NumGoroutine(),
+		DroppedEvents: s.droppedEvents,
+		Bots:          make(map[string]botVars, len(s.bots)),
+	}
+	if !s.startedAt.IsZero() {
+		vars.UptimeSec = int64(time.Since(s.startedAt).Seconds())
+	}
+	for key := range s.bots {
+		bot := botVars{Goroutines: goroutines[key]}
+		for sub := range s.subsByBot[key] {
+			bot.Subscribers++
+			bot.Queued += len(sub.events)
+			bot.Dropped += sub.dropped
+		}
+		vars.Bots[key] = bot
+	}
+	vars.Subscribers = len(s.subscriberStatus())
+	return vars
+}
+
+// goroutinesByBot counts the running goroutines per pprof "bot" label,
+// which startConnectors puts on each connector's supervisor and which
+// every goroutine the connector starts inherits.
+func goroutinesByBot() map[string]int {
+	var profile bytes.Buffer
+	if err := runtimepprof.Lookup("goroutine").WriteTo(&profile, 1); err != nil {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	records := 0
+	for _, line := range strings.Split(profile.String(), "\n") {
+		if count, _, ok := strings.Cut(line, " @ "); ok {
+			records, _ = strconv.Atoi(count)
+			continue
+		}
+		raw, ok := strings.CutPrefix(line, "# labels: ")
+		if !ok {
+			continue
+		}
+		var labels map[string]string
+		if json.Unmarshal([]byte(raw), &labels) == nil && labels["bot"] != "" {
+			counts[labels["bot"]] += records
+		}
+	}
+	return counts
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func TestDebugHandler_Healthz(t *testing.T) {
+	s := newReplayServer(t)
+	handler := s.debugHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 while serving, got %d", rec.Code)
+	}
+
+	s.handoff = &handoffState{}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while handing off, got %d", rec.Code)
+	}
+}
+
+func TestDebugHandler_Vars(t *testing.T) {
+	s := newReplayServer(t)
+	sub := &subscriber{keys: []string{"slack:ops"}, events: make(chan protocol.Event, 4), dropped: 2}
+	sub.events <- protocol.Event{}
+	s.subsByBot["slack:ops"] = map[*subscriber]struct{}{sub: {}}
+
+	// Stand in for a running connector.
+	stop := make(chan struct{})
+	defer close(stop)
+	started := make(chan struct{})
+	go pprof.Do(context.Background(), pprof.Labels("bot", "slack:ops"), func(context.Context) {
+		close(started)
+		<-stop
+	})
+	<-started
+
+	rec := httptest.NewRecorder()
+	s.debugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var vars struct {
+		Memstats json.RawMessage   `json:"memstats"`
+		Pantalk  introspectionVars `json:"pantalk"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("decode vars: %v\n%s", err, rec.Body)
+	}
+	if len(vars.Memstats) == 0 {
+		t.Fatal("expected the process-wide expvar variables")
+	}
+	got := vars.Pantalk.Bots["slack:ops"]
+	if got.Goroutines != 1 || got.Subscribers != 1 || got.Queued != 1 || got.Dropped != 2 {
+		t.Fatalf("unexpected slack:ops counters %+v", got)
+	}
+	if vars.Pantalk.Subscribers != 1 {
+		t.Fatalf("expected 1 subscriber, got %d", vars.Pantalk.Subscribers)
+	}
+	if other := vars.Pantalk.Bots["discord:ops"]; other != (botVars{}) {
+		t.Fatalf("expected idle discord:ops, got %+v", other)
+	}
+}
+
+func TestDebugHandler_Pprof(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newReplayServer(t).debugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/goroutine?debug=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// keywordRule is a compiled notify_on entry.
+type keywordRule struct {
+	match   string
+	channel string // "" matches every channel
+	pattern *regexp.Regexp
+}
+
+func compileKeywords(rules []config.NotifyRule) ([]keywordRule, error) {
+	compiled := make([]keywordRule, 0, len(rules))
+	for _, rule := range rules {
+		pattern, err := rule.Pattern()
+		if err != nil {
+			return nil, fmt.Errorf("notify_on %q: %w", rule.Match, err)
+		}
+		compiled = append(compiled, keywordRule{match: rule.Match, channel: rule.Channel, pattern: pattern})
+	}
+	return compiled, nil
+}
+
+// matchKeyword returns the notify_on pattern the event's text matches, or
+// "" when none does.
+func (s *Server) matchKeyword(key string, event protocol.Event) string {
+	s.mu.RLock()
+	rules := s.keywords[key]
+	s.mu.RUnlock()
+
+	for _, rule := range rules {
+		if rule.channel != "" && rule.channel != event.Channel {
+			continue
+		}
+		if rule.pattern.MatchString(event.Text) {
+			return rule.match
+		}
+	}
+	return ""
+}
+
+// notifyReason says why an inbound event is a notification, or returns ""
+// when it isn't one. A click on one of the bot's buttons is always
+// addressed to it.
+func (s *Server) notifyReason(key string, event protocol.Event) string {
+	if event.Direction != "in" || isLifecycleKind(event.Kind) {
+		return ""
+	}
+	switch {
+	case event.Kind == protocol.KindInteraction:
+		return protocol.NotifyInteraction
+	case event.Direct:
+		return protocol.NotifyDirect
+	case event.Mentions:
+		return protocol.NotifyMention
+	}
+	if match := s.matchKeyword(key, event); match != "" {
+		return protocol.NotifyKeyword + ":" + match
+	}
+	if s.hasParticipation(key, event.Target, event.Channel, event.Thread) {
+		return protocol.NotifyThread
+	}
+	return ""
+}
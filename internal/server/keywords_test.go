@@ -0,0 +1,55 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+)
+
+func TestNotifyOnKeywords(t *testing.T) {
+	s := newReplayServer(t)
+	rules, err := compileKeywords([]config.NotifyRule{{Match: "deploy"}, {Match: `incident-\d+`, Channel: "C0OPS"}})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	s.keywords = map[string][]keywordRule{"slack:ops": rules}
+
+	for _, msg := range []struct{ channel, text string }{
+		{"C1", "Deploying the API now"},
+		{"C1", "incident-42 is resolved"},
+		{"C0OPS", "incident-42 is open"},
+		{"C1", "@ops can you deploy?"},
+		{"C1", "lunch?"},
+	} {
+		s.publish(protocol.Event{Service: "slack", Bot: "ops", Kind: "message", Direction: "in", Channel: msg.channel, Text: msg.text})
+	}
+
+	notifications, err := s.notifications.ListNotifications(store.NotificationFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("list notifications: %v", err)
+	}
+	got := make(map[string]string)
+	for _, n := range notifications {
+		got[n.Text] = n.NotifyReason
+	}
+	want := map[string]string{
+		"Deploying the API now": "keyword:deploy",
+		"incident-42 is open":   `keyword:incident-\d+`,
+		"@ops can you deploy?":  protocol.NotifyMention,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("notifications = %v, want %v", got, want)
+	}
+	for text, reason := range want {
+		if got[text] != reason {
+			t.Errorf("%q: reason = %q, want %q", text, got[text], reason)
+		}
+	}
+
+	events, _ := s.notifications.ListEvents(store.EventFilter{NotifyOnly: true, Limit: 10})
+	if len(events) != 3 || events[0].NotifyReason != "keyword:deploy" {
+		t.Fatalf("expected stored events to keep the reason, got %+v", events)
+	}
+}
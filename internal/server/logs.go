@@ -0,0 +1,267 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// maxLogEntries is how many recent log entries the daemon keeps for logs.
+const maxLogEntries = 1000
+
+// defaultLogLimit is how many recent entries logs returns by default.
+const defaultLogLimit = 100
+
+// logFollowBuffer is how many entries a follower queues while it is slow
+// to read; entries beyond it are dropped for that follower.
+const logFollowBuffer = 256
+
+// logLevels ranks the log levels, least severe first.
+var logLevels = map[string]int{"debug": 0, "info": 1, "error": 2}
+
+// logTail keeps the newest lines of the daemon's log and passes new ones to
+// the clients following it. Run makes it an output of the log package.
+type logTail struct {
+	mu        sync.Mutex
+	entries   []protocol.LogEntry // ring of the newest maxLogEntries
+	next      int
+	partial   []byte
+	followers map[chan protocol.LogEntry]struct{}
+}
+
+func newLogTail() *logTail {
+	return &logTail{followers: make(map[chan protocol.LogEntry]struct{})}
+}
+
+// Write records each complete line of p. It never fails, so a slow client
+// can't hold up logging.
+func (t *logTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	data := append(t.partial, p...)
+	for {
+		line, rest, ok := bytes.Cut(data, []byte("\n"))
+		if !ok {
+			break
+		}
+		data = rest
+		if len(bytes.TrimSpace(line)) > 0 {
+			t.add(parseLogLine(string(line), time.Now().UTC()))
+		}
+	}
+	t.partial = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+func (t *logTail) add(entry protocol.LogEntry) {
+	if len(t.entries) < maxLogEntries {
+		t.entries = append(t.entries, entry)
+	} else {
+		t.entries[t.next] = entry
+		t.next = (t.next + 1) % maxLogEntries
+	}
+	for ch := range t.followers {
+		select {
+		case ch <- entry:
+		default:
+		}
+	}
+}
+
+// recent returns the kept entries, oldest first.
+func (t *logTail) recent() []protocol.LogEntry {
+	out := make([]protocol.LogEntry, 0, len(t.entries))
+	out = append(out, t.entries[t.next:]...)
+	return append(out, t.entries[:t.next]...)
+}
+
+// snapshot returns the kept entries, oldest first.
+func (t *logTail) snapshot() []protocol.LogEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.recent()
+}
+
+// follow returns the kept entries and a channel of those logged after
+// them, until stop is called.
+func (t *logTail) follow() ([]protocol.LogEntry, <-chan protocol.LogEntry, func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ch := make(chan protocol.LogEntry, logFollowBuffer)
+	t.followers[ch] = struct{}{}
+	stop := func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.followers, ch)
+	}
+	return t.recent(), ch, stop
+}
+
+// logTimestamp is the date and time the log package puts before a line.
+var logTimestamp = regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(\.\d+)? `)
+
+// parseLogLine turns a line of the daemon's log into an entry: debug lines
+// say "debug: ", failures mention that something failed, and lines about a
+// connector start with its "[service:bot]".
+func parseLogLine(line string, now time.Time) protocol.LogEntry {
+	entry := protocol.LogEntry{Time: now, Level: "info"}
+	line = logTimestamp.ReplaceAllString(line, "")
+
+	debug := false
+	if rest, ok := strings.CutPrefix(line, "debug: "); ok {
+		debug, line = true, rest
+	}
+	if strings.HasPrefix(line, "[") {
+		if key, rest, ok := strings.Cut(line[1:], "] "); ok && strings.Contains(key, ":") && !strings.ContainsAny(key, " []") {
+			entry.Bot = key
+			line = rest
+		}
+	}
+	// Some lines put the key first: "[slack:ops] debug: heartbeat".
+	if rest, ok := strings.CutPrefix(line, "debug: "); ok {
+		debug, line = true, rest
+	}
+
+	if debug {
+		entry.Level = "debug"
+	} else if lower := strings.ToLower(line); strings.Contains(lower, "failed") || strings.Contains(lower, "error") {
+		entry.Level = "error"
+	}
+	entry.Message = line
+	return entry
+}
+
+// logFilter selects the entries a logs request asks for.
+type logFilter struct {
+	level int
+	bots  map[string]bool // nil keeps entries of every bot and none
+}
+
+func (s *Server) logFilter(req protocol.Request) (logFilter, error) {
+	level := strings.ToLower(strings.TrimSpace(req.Level))
+	if level == "" {
+		level = "info"
+	}
+	rank, ok := logLevels[level]
+	if !ok {
+		return logFilter{}, invalidRequest("unknown log level %q (expected debug, info or error)", req.Level)
+	}
+	filter := logFilter{level: rank}
+
+	if req.Service != "" || req.Bot != "" {
+		keys, err := s.resolveSelector(req.Service, req.Bot)
+		if err != nil {
+			return logFilter{}, err
+		}
+		filter.bots = make(map[string]bool, len(keys))
+		for _, key := range keys {
+			filter.bots[key] = true
+		}
+	}
+	return filter, nil
+}
+
+func (f logFilter) match(entry protocol.LogEntry) bool {
+	if logLevels[entry.Level] < f.level {
+		return false
+	}
+	return f.bots == nil || f.bots[entry.Bot]
+}
+
+// newest returns the last limit entries that match, oldest first.
+func (f logFilter) newest(entries []protocol.LogEntry, limit int) []protocol.LogEntry {
+	if limit <= 0 {
+		limit = defaultLogLimit
+	}
+	var out []protocol.LogEntry
+	for _, entry := range entries {
+		if f.match(entry) {
+			out = append(out, entry)
+		}
+	}
+	if len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out
+}
+
+// recentLogs answers logs without follow: the newest Limit matching
+// entries, oldest first.
+func (s *Server) recentLogs(req protocol.Request) protocol.Response {
+	if s.logs == nil {
+		return protocol.Response{OK: false, Error: "the daemon log is not being kept", Code: protocol.CodeUnavailable}
+	}
+	filter, err := s.logFilter(req)
+	if err != nil {
+		return failed(err)
+	}
+	return protocol.Response{OK: true, Logs: filter.newest(s.logs.snapshot(), req.Limit), Ack: s.logNote(filter)}
+}
+
+// logNote warns that debug entries were asked for but debug logging is off
+// for every bot the request covers.
+func (s *Server) logNote(filter logFilter) string {
+	if filter.level != logLevels["debug"] {
+		return ""
+	}
+	status := s.debugStatus()
+	if status.All {
+		return ""
+	}
+	for _, key := range status.Bots {
+		if filter.bots == nil || filter.bots[key] {
+			return ""
+		}
+	}
+	return "debug logging is off, so no debug entries are logged; turn it on with pantalk debug --enable"
+}
+
+// handleLogs answers a logs request. With Follow it streams the recent
+// entries and then each new one until the client goes away.
+func (s *Server) handleLogs(ctx context.Context, req protocol.Request, encoder responseEncoder) {
+	if !req.Follow || s.logs == nil {
+		_ = encoder.Encode(s.recentLogs(req))
+		return
+	}
+	filter, err := s.logFilter(req)
+	if err != nil {
+		_ = encoder.Encode(failed(err))
+		return
+	}
+
+	recent, entries, stop := s.logs.follow()
+	defer stop()
+	s.streams.Add(1)
+	defer s.streams.Done()
+
+	ack := "following"
+	if note := s.logNote(filter); note != "" {
+		ack = fmt.Sprintf("following (%s)", note)
+	}
+	if err := encoder.Encode(protocol.Response{OK: true, Ack: ack, Logs: filter.newest(recent, req.Limit)}); err != nil {
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.streamsEnding:
+			return
+		case entry := <-entries:
+			if !filter.match(entry) {
+				continue
+			}
+			if err := encoder.Encode(protocol.Response{OK: true, Log: &entry}); err != nil {
+				return
+			}
+		}
+	}
+}
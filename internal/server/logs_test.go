@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func TestParseLogLine(t *testing.T) {
+	now := time.Now().UTC()
+	tests := []struct {
+		line string
+		want protocol.LogEntry
+	}{
+		{"2026/10/15 09:30:00 listening on /tmp/pantalk.sock", protocol.LogEntry{Level: "info", Message: "listening on /tmp/pantalk.sock"}},
+		{"2026/10/15 09:30:00 [slack:ops] connector failed: timeout", protocol.LogEntry{Level: "error", Bot: "slack:ops", Message: "connector failed: timeout"}},
+		{"2026/10/15 09:30:00.123456 debug: [discord:ops] middleware unfurl dropped event on C1", protocol.LogEntry{Level: "debug", Bot: "discord:ops", Message: "middleware unfurl dropped event on C1"}},
+		{"[not a bot] started", protocol.LogEntry{Level: "info", Message: "[not a bot] started"}},
+	}
+	for _, tt := range tests {
+		tt.want.Time = now
+		if got := parseLogLine(tt.line, now); got != tt.want {
+			t.Errorf("parseLogLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestLogTail_KeepsNewest(t *testing.T) {
+	tail := newLogTail()
+	for i := range maxLogEntries + 5 {
+		fmt.Fprintf(tail, "line %d\n", i)
+	}
+	// A line written in two pieces is one entry.
+	_, _ = tail.Write([]byte("split "))
+	_, _ = tail.Write([]byte("line\n"))
+
+	entries := tail.snapshot()
+	if len(entries) != maxLogEntries {
+		t.Fatalf("expected %d entries, got %d", maxLogEntries, len(entries))
+	}
+	if entries[0].Message != "line 6" || entries[len(entries)-1].Message != "split line" {
+		t.Fatalf("expected line 6 to split line, got %q to %q", entries[0].Message, entries[len(entries)-1].Message)
+	}
+}
+
+func TestRecentLogs_Filters(t *testing.T) {
+	s := newReplayServer(t)
+	s.logs = newLogTail()
+	for _, line := range []string{
+		"opening database",
+		"[slack:ops] connected",
+		"debug: [slack:ops] request action=send",
+		"[slack:other] connector failed: auth",
+		"[discord:ops] send failed: rate limited",
+	} {
+		_, _ = s.logs.Write([]byte(line + "\n"))
+	}
+
+	messages := func(req protocol.Request) []string {
+		t.Helper()
+		resp := s.recentLogs(req)
+		if !resp.OK {
+			t.Fatalf("logs %+v: %s", req, resp.Error)
+		}
+		var out []string
+		for _, entry := range resp.Logs {
+			out = append(out, entry.Message)
+		}
+		return out
+	}
+
+	if got := messages(protocol.Request{}); len(got) != 4 {
+		t.Fatalf("expected every info and error entry, got %q", got)
+	}
+	if got := messages(protocol.Request{Service: "slack", Bot: "ops", Level: "debug"}); len(got) != 2 || got[1] != "request action=send" {
+		t.Fatalf("expected the slack:ops entries, got %q", got)
+	}
+	if got := messages(protocol.Request{Level: "error", Limit: 1}); len(got) != 1 || got[0] != "send failed: rate limited" {
+		t.Fatalf("expected the newest error, got %q", got)
+	}
+	if resp := s.recentLogs(protocol.Request{Level: "debug"}); resp.Ack == "" {
+		t.Fatal("expected a note that debug logging is off")
+	}
+	if resp := s.recentLogs(protocol.Request{Level: "trace"}); resp.OK || resp.Code != protocol.CodeInvalidRequest {
+		t.Fatalf("expected an unknown level rejected, got %+v", resp)
+	}
+	if resp := s.recentLogs(protocol.Request{Bot: "nobody"}); resp.OK || resp.Code != protocol.CodeUnknownBot {
+		t.Fatalf("expected an unknown bot rejected, got %+v", resp)
+	}
+}
+
+func TestHandleLogs_Follow(t *testing.T) {
+	s := newReplayServer(t)
+	s.logs = newLogTail()
+	s.streamsEnding = make(chan struct{})
+	_, _ = s.logs.Write([]byte("[slack:ops] connected\n"))
+
+	serverConn, clientConn := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		_ = clientConn.Close()
+		_ = serverConn.Close()
+	})
+	go s.handleLogs(ctx, protocol.Request{Action: protocol.ActionLogs, Bot: "ops", Service: "slack", Follow: true}, json.NewEncoder(serverConn))
+
+	_ = clientConn.SetDeadline(time.Now().Add(5 * time.Second))
+	decoder := json.NewDecoder(clientConn)
+
+	var ack protocol.Response
+	if err := decoder.Decode(&ack); err != nil || !ack.OK || len(ack.Logs) != 1 {
+		t.Fatalf("expected the ack with the recent entry, got %+v, %v", ack, err)
+	}
+
+	_, _ = s.logs.Write([]byte("[slack:other] connected\n"))
+	_, _ = s.logs.Write([]byte("[slack:ops] send failed: channel_not_found\n"))
+
+	var resp protocol.Response
+	if err := decoder.Decode(&resp); err != nil || resp.Log == nil {
+		t.Fatalf("expected a followed entry, got %+v, %v", resp, err)
+	}
+	if resp.Log.Bot != "slack:ops" || resp.Log.Level != "error" {
+		t.Fatalf("expected only the slack:ops failure, got %+v", resp.Log)
+	}
+}
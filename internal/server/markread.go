@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+// errMarkReadUnsupported is returned for bots whose connector has no read
+// state to update, e.g. Telegram.
+var errMarkReadUnsupported = errors.New("does not support marking messages read")
+
+// markRead marks a conversation read upstream for the mark_read action:
+// the channel of the stored event EventID up to that message, or all
+// received messages in req.Channel.
+func (s *Server) markRead(ctx context.Context, req protocol.Request) error {
+	service, bot, channel := req.Service, req.Bot, strings.TrimSpace(req.Channel)
+	var through time.Time
+	if req.EventID > 0 {
+		event, err := s.storedEvent(req.EventID)
+		if err != nil {
+			return err
+		}
+		if event.Channel == "" {
+			return fmt.Errorf("event %d is not part of a conversation", event.ID)
+		}
+		service, bot, channel, through = event.Service, event.Bot, event.Channel, event.Timestamp
+	}
+	if channel == "" {
+		return invalidRequest("channel or event_id is required")
+	}
+
+	resolvedService, resolvedBot, err := s.resolveBotService(service, bot)
+	if err != nil {
+		return err
+	}
+
+	key := botKey(resolvedService, resolvedBot)
+	connector, gate, err := s.acquireConnector(ctx, key)
+	if err != nil {
+		return err
+	}
+	if connector == nil {
+		return unknownBot(resolvedService, resolvedBot)
+	}
+	defer gate.leave()
+
+	marker, ok := connector.(upstream.ReadMarker)
+	if !ok || !connector.Capabilities().MarkRead {
+		return withCode(protocol.CodeUnsupported, fmt.Errorf("%s bot %q %w", resolvedService, resolvedBot, errMarkReadUnsupported))
+	}
+	if err := marker.MarkRead(ctx, channel, through); err != nil {
+		return withCode(protocol.CodeUpstream, err)
+	}
+	return nil
+}
+
+// agentMarkRead is the agents' MarkReadFunc. Agents mark whatever they were
+// triggered from, so bots that cannot mark read are skipped quietly.
+func (s *Server) agentMarkRead(ctx context.Context, req protocol.Request) error {
+	req.Action = protocol.ActionMarkRead
+	if err := s.markRead(ctx, req); err != nil && !errors.Is(err, errMarkReadUnsupported) {
+		return err
+	}
+	return nil
+}
+
+// syncReadMarker marks the notifications of a conversation seen when the
+// bot's account read it on another client, for bots with sync_read.
+func (s *Server) syncReadMarker(key string, event protocol.Event) {
+	s.mu.RLock()
+	enabled := false
+	for _, bot := range s.cfg.Bots {
+		if botKey(bot.Type, bot.Name) == key {
+			enabled = bot.SyncRead
+		}
+	}
+	notifications := s.notifications
+	s.mu.RUnlock()
+	if !enabled || notifications == nil || event.Channel == "" {
+		return
+	}
+
+	seen, err := notifications.MarkSeenThrough(event.Service, event.Bot, event.Channel, event.Timestamp)
+	if err != nil {
+		log.Printf("[%s] warning: sync read marker for %s: %v", key, event.Channel, err)
+		return
+	}
+	if seen > 0 {
+		log.Printf("[%s] %d notification(s) on %s read upstream", key, seen, event.Channel)
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+)
+
+type markedRead struct {
+	channel string
+	through time.Time
+}
+
+type readMarkerConnector struct {
+	idleConnector
+	marked []markedRead
+}
+
+func (c *readMarkerConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{MarkRead: true}
+}
+
+func (c *readMarkerConnector) MarkRead(_ context.Context, channel string, through time.Time) error {
+	c.marked = append(c.marked, markedRead{channel: channel, through: through})
+	return nil
+}
+
+func TestHandleRequest_MarkRead(t *testing.T) {
+	s := newReplayServer(t)
+	marker := &readMarkerConnector{idleConnector: idleConnector{name: "ops"}}
+	s.connectors["slack:ops"] = marker
+	s.connectors["discord:ops"] = &idleConnector{name: "ops"}
+
+	publishText(s, "slack", "ops", "please review")
+	event := findStored(t, s, "please review")
+
+	markRead := func(req protocol.Request) protocol.Response {
+		req.Action = protocol.ActionMarkRead
+		return s.handleRequest(context.Background(), req)
+	}
+
+	if resp := markRead(protocol.Request{EventID: event.ID}); !resp.OK {
+		t.Fatalf("mark read by event failed: %s", resp.Error)
+	}
+	if resp := markRead(protocol.Request{Service: "slack", Bot: "ops", Channel: "C2"}); !resp.OK {
+		t.Fatalf("mark read by channel failed: %s", resp.Error)
+	}
+	if len(marker.marked) != 2 {
+		t.Fatalf("expected two marks, got %+v", marker.marked)
+	}
+	if got := marker.marked[0]; got.channel != "C1" || !got.through.Equal(event.Timestamp) {
+		t.Fatalf("expected C1 marked through the event, got %+v", got)
+	}
+	if got := marker.marked[1]; got.channel != "C2" || !got.through.IsZero() {
+		t.Fatalf("expected all of C2 marked, got %+v", got)
+	}
+
+	if resp := markRead(protocol.Request{Service: "slack", Bot: "ops"}); resp.OK || !strings.Contains(resp.Error, "channel or event_id is required") {
+		t.Fatalf("expected a missing channel error, got %+v", resp)
+	}
+	if resp := markRead(protocol.Request{Service: "discord", Bot: "ops", Channel: "C1"}); resp.OK || !strings.Contains(resp.Error, "does not support marking messages read") {
+		t.Fatalf("expected discord to be refused, got %+v", resp)
+	}
+
+	// Agents mark whatever triggered them and skip bots that can't.
+	if err := s.agentMarkRead(context.Background(), protocol.Request{Service: "discord", Bot: "ops", Channel: "C1"}); err != nil {
+		t.Fatalf("expected unsupported bots to be skipped, got %v", err)
+	}
+}
+
+func TestSyncReadMarker(t *testing.T) {
+	s := newReplayServer(t)
+	s.cfg.Bots = []config.BotConfig{{Name: "ops", Type: "slack", SyncRead: true}}
+
+	s.publish(protocol.Event{Service: "slack", Bot: "ops", Kind: "message", Direction: "in", Channel: "C1", Text: "@ops please review"})
+	s.publish(protocol.Event{Service: "slack", Bot: "other", Kind: "message", Direction: "in", Channel: "C1", Text: "@other please review"})
+
+	read := func(bot string) {
+		s.publish(protocol.Event{Service: "slack", Bot: bot, Kind: protocol.KindRead, Channel: "C1", Timestamp: time.Now().UTC()})
+	}
+	read("ops")
+	read("other")
+
+	unseen, err := s.notifications.ListNotifications(store.NotificationFilter{Unseen: true, Limit: 10})
+	if err != nil {
+		t.Fatalf("list notifications: %v", err)
+	}
+	if len(unseen) != 1 || unseen[0].Bot != "other" {
+		t.Fatalf("expected only the bot without sync_read to stay unseen, got %+v", unseen)
+	}
+
+	events, _ := s.notifications.ListEvents(store.EventFilter{Kind: protocol.KindRead, Limit: 10})
+	if len(events) != 0 {
+		t.Fatalf("expected read markers not to be stored, got %+v", events)
+	}
+}
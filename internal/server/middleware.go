@@ -0,0 +1,213 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// defaultMiddlewareTimeout bounds a middleware command per event when its
+// config has no timeout.
+const defaultMiddlewareTimeout = 10 * time.Second
+
+// maxMiddlewareOutput bounds what is read from a middleware command.
+const maxMiddlewareOutput = 1 << 20
+
+// middleware is one step of the chain inbound events pass through in
+// publish. apply may change the event; it reports whether to drop it.
+type middleware struct {
+	name  string
+	apply func(s *Server, key string, event *protocol.Event) (drop bool, err error)
+	stats *middlewareStats
+}
+
+// middlewareStats counts what a middleware did since the daemon started.
+// The counters survive reloads for middleware that keep their name.
+type middlewareStats struct {
+	events  atomic.Int64
+	dropped atomic.Int64
+	errors  atomic.Int64
+	nanos   atomic.Int64
+}
+
+// newMiddleware builds the chain of cfg, reusing the stats of prev.
+func newMiddleware(cfg config.Config, prev []*middleware) []*middleware {
+	stats := make(map[string]*middlewareStats, len(prev))
+	for _, m := range prev {
+		stats[m.name] = m.stats
+	}
+
+	chain := make([]*middleware, 0, len(cfg.Middleware)+len(config.DefaultMiddleware))
+	for _, mc := range cfg.MiddlewareChain() {
+		m := &middleware{name: mc.Name, stats: stats[mc.Name]}
+		if m.stats == nil {
+			m.stats = &middlewareStats{}
+		}
+		switch mc.Name {
+		case config.MiddlewareRedact:
+			m.apply = func(s *Server, key string, event *protocol.Event) (bool, error) {
+				s.redactEvent(key, event)
+				return false, nil
+			}
+		case config.MiddlewareTranslate:
+			m.apply = func(s *Server, key string, event *protocol.Event) (bool, error) {
+				return false, s.translateEvent(key, event)
+			}
+		case config.MiddlewareUnfurl:
+			m.apply = func(s *Server, key string, event *protocol.Event) (bool, error) {
+				return false, s.unfurlEvent(key, event)
+			}
+		case config.MiddlewareClassify:
+			m.apply = func(s *Server, key string, event *protocol.Event) (bool, error) {
+				return false, s.classify(key, event)
+			}
+		default:
+			timeout := time.Duration(mc.Timeout) * time.Second
+			if timeout == 0 {
+				timeout = defaultMiddlewareTimeout
+			}
+			command := mc.Command
+			m.apply = func(s *Server, key string, event *protocol.Event) (bool, error) {
+				// Status events are the daemon's own; custom middleware
+				// only sees what came from the platform.
+				if event.Direction != "in" || event.Kind == "status" {
+					return false, nil
+				}
+				parent := s.rootCtx
+				if parent == nil {
+					parent = context.Background()
+				}
+				return runMiddlewareCommand(parent, command, timeout, event)
+			}
+		}
+		chain = append(chain, m)
+	}
+	return chain
+}
+
+// defaultChain runs for servers that haven't loaded a config yet, so no
+// event skips redaction.
+var defaultChain = newMiddleware(config.Config{}, nil)
+
+// runMiddleware passes event through the chain in order. A failing
+// middleware is logged and counted, and the event goes on unchanged by it;
+// a dropped event skips the rest of the chain.
+func (s *Server) runMiddleware(key string, event *protocol.Event) (drop bool) {
+	s.mu.RLock()
+	chain := s.middleware
+	s.mu.RUnlock()
+	if chain == nil {
+		chain = defaultChain
+	}
+
+	for _, m := range chain {
+		before := *event
+		start := time.Now()
+		drop, err := m.apply(s, key, event)
+		m.stats.nanos.Add(int64(time.Since(start)))
+		m.stats.events.Add(1)
+		if err != nil {
+			m.stats.errors.Add(1)
+			*event = before
+			log.Printf("[%s] middleware %s on %s failed: %v", key, m.name, event.Channel, err)
+			continue
+		}
+		if drop {
+			m.stats.dropped.Add(1)
+			if s.debugging(key) {
+				log.Printf("debug: [%s] middleware %s dropped event on %s", key, m.name, event.Channel)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// middlewareStatus reports the counters of the chain for the status action.
+func (s *Server) middlewareStatus() []protocol.MiddlewareStatus {
+	s.mu.RLock()
+	chain := s.middleware
+	s.mu.RUnlock()
+
+	status := make([]protocol.MiddlewareStatus, 0, len(chain))
+	for _, m := range chain {
+		st := protocol.MiddlewareStatus{
+			Name:    m.name,
+			Events:  m.stats.events.Load(),
+			Dropped: m.stats.dropped.Load(),
+			Errors:  m.stats.errors.Load(),
+		}
+		if st.Events > 0 {
+			st.AvgMillis = float64(m.stats.nanos.Load()) / float64(st.Events) / float64(time.Millisecond)
+		}
+		status = append(status, st)
+	}
+	return status
+}
+
+// middlewareResult is what a middleware command prints: the event fields
+// to change, plus drop to discard the event.
+type middlewareResult struct {
+	protocol.Event
+	Drop bool `json:"drop"`
+}
+
+// runMiddlewareCommand runs command with event as JSON on stdin. Fields in
+// its output replace those of the event; empty output leaves it as is.
+// What identifies the event - who wrote it, where and when - can't be
+// changed.
+func runMiddlewareCommand(ctx context.Context, command []string, timeout time.Duration, event *protocol.Event) (bool, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return false, fmt.Errorf("encode event: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if detail := strings.TrimSpace(stderr.String()); detail != "" {
+			return false, fmt.Errorf("%w: %s", err, detail)
+		}
+		return false, err
+	}
+	if stdout.Len() > maxMiddlewareOutput {
+		return false, fmt.Errorf("printed more than %d bytes", maxMiddlewareOutput)
+	}
+	output := bytes.TrimSpace(stdout.Bytes())
+	if len(output) == 0 {
+		return false, nil
+	}
+
+	result := middlewareResult{Event: *event}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return false, fmt.Errorf("decode output: %w", err)
+	}
+	if result.Drop {
+		return true, nil
+	}
+
+	changed := result.Event
+	changed.ID, changed.Timestamp = event.ID, event.Timestamp
+	changed.Service, changed.Bot = event.Service, event.Bot
+	changed.User, changed.Self = event.User, event.Self
+	changed.Kind, changed.Direction = event.Kind, event.Direction
+	changed.Target, changed.Channel, changed.Thread = event.Target, event.Channel, event.Thread
+	changed.MessageID = event.MessageID
+	*event = changed
+	return false, nil
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/agent"
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/redact"
+	"github.com/pantalk/pantalk/internal/store"
+	"github.com/pantalk/pantalk/internal/translate"
+)
+
+func TestPublish_Middleware(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	s := newReplayServer(t)
+	redactor, err := redact.New([]redact.Rule{{Name: "email"}})
+	if err != nil {
+		t.Fatalf("compile rules: %v", err)
+	}
+	s.redactors = map[string]*redact.Redactor{"slack:ops": redactor}
+	s.middleware = newMiddleware(config.Config{Middleware: []config.MiddlewareConfig{
+		// Runs before redaction, so it sees the address; redaction runs
+		// after it and still scrubs what it passes on.
+		{Name: "spam", Command: agent.Command{"sh", "-c",
+			`event=$(cat); case "$event" in
+				*"buy now"*) echo '{"drop": true}' ;;
+				*crash*) echo 'not json' ;;
+				*@example.com*) echo '{"labels": ["has-email"], "channel": "elsewhere"}' ;;
+			esac`}},
+		{Name: config.MiddlewareRedact},
+	}}, nil)
+
+	for _, text := range []string{"write to jane@example.com", "buy now!!!", "it crashed", "hello"} {
+		publishText(s, "slack", "ops", text)
+	}
+
+	events, err := s.notifications.ListEvents(store.EventFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	var texts []string
+	for _, event := range events {
+		texts = append(texts, event.Text)
+	}
+	if want := []string{"write to [REDACTED:email]", "it crashed", "hello"}; !slices.Equal(texts, want) {
+		t.Fatalf("expected %q, got %q", want, texts)
+	}
+	if events[0].Channel != "C1" {
+		t.Errorf("expected middleware not to move the event, got channel %q", events[0].Channel)
+	}
+
+	status := s.middlewareStatus()
+	if len(status) != 2 || status[0].Name != "spam" || status[1].Name != config.MiddlewareRedact {
+		t.Fatalf("unexpected chain %+v", status)
+	}
+	if spam := status[0]; spam.Events != 4 || spam.Dropped != 1 || spam.Errors != 1 {
+		t.Errorf("unexpected spam counters %+v", spam)
+	}
+	if red := status[1]; red.Events != 3 || red.Dropped != 0 || red.Errors != 0 {
+		t.Errorf("unexpected redact counters %+v", red)
+	}
+
+	// Counters carry over a reload for middleware that keep their name.
+	reloaded := newMiddleware(config.Config{Middleware: []config.MiddlewareConfig{{Name: "spam", Command: agent.Command{"true"}}}}, s.middleware)
+	if reloaded[0].name != config.MiddlewareRedact || reloaded[1].stats.events.Load() != 4 {
+		t.Fatalf("expected redact first and the spam counters kept, got %+v", reloaded)
+	}
+}
+
+func TestPublish_RedactsAfterMiddleware(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	s := newReplayServer(t)
+	redactor, err := redact.New([]redact.Rule{{Name: "email"}})
+	if err != nil {
+		t.Fatalf("compile rules: %v", err)
+	}
+	s.redactors = map[string]*redact.Redactor{"slack:ops": redactor}
+
+	// The translation backend echoes a secret the original text didn't
+	// carry, and a custom middleware adds one to a link preview.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"translatedText":   "write to jane@example.com",
+			"detectedLanguage": map[string]any{"language": "es"},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	s.translator, err = translate.New(translate.Config{Provider: translate.LibreTranslate, Endpoint: srv.URL})
+	if err != nil {
+		t.Fatalf("new translator: %v", err)
+	}
+	s.translateTo = map[string]*config.TranslateConfig{"slack:ops": {To: "en"}}
+	s.middleware = newMiddleware(config.Config{Middleware: []config.MiddlewareConfig{
+		{Name: config.MiddlewareTranslate},
+		{Name: "preview", Command: agent.Command{"sh", "-c",
+			`echo '{"links": [{"url": "https://example.com/?to=bob@example.com", "title": "mail bob@example.com"}]}'`}},
+	}}, nil)
+
+	publishText(s, "slack", "ops", "escribe a jane@example.com")
+
+	events, err := s.notifications.ListEvents(store.EventFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected one event, got %+v", events)
+	}
+	event := events[0]
+	if event.Text != "escribe a [REDACTED:email]" || event.TranslatedText != "write to [REDACTED:email]" {
+		t.Fatalf("expected the text and translation redacted, got %q and %q", event.Text, event.TranslatedText)
+	}
+	if len(event.Links) != 1 || strings.Contains(event.Links[0].URL+event.Links[0].Title, "@example.com") {
+		t.Fatalf("expected the link preview redacted, got %+v", event.Links)
+	}
+}
+
+func TestRunMiddlewareCommand_Annotates(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	event := protocol.Event{ID: 7, Service: "slack", Bot: "ops", User: "U1", Kind: "message", Direction: "in", Channel: "C1", Text: "refund please", Notify: true}
+	drop, err := runMiddlewareCommand(t.Context(), []string{"sh", "-c", `cat >/dev/null; echo '{"priority":"urgent","user":"U2","notify":false}'`}, defaultMiddlewareTimeout, &event)
+	if err != nil || drop {
+		t.Fatalf("expected the event kept, got drop=%t err=%v", drop, err)
+	}
+	if event.Priority != protocol.PriorityUrgent || event.Notify || event.User != "U1" || event.Text != "refund please" || event.ID != 7 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+}
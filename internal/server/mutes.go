@@ -0,0 +1,169 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// muteKey identifies the mute of one channel of the bot key.
+func muteKey(key string, channel string) string {
+	return key + "|" + channel
+}
+
+// loadMutes reads the mutes still in force from the store, so they outlast
+// a restart.
+func (s *Server) loadMutes() error {
+	mutes, err := s.notifications.ListMutes(time.Now())
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mutes = make(map[string]protocol.Mute, len(mutes))
+	for _, mute := range mutes {
+		s.mutes[muteKey(botKey(mute.Service, mute.Bot), mute.Channel)] = mute
+	}
+	return nil
+}
+
+// muted reports whether channel of the bot key is muted at now.
+func (s *Server) muted(key string, channel string, now time.Time) bool {
+	if channel == "" {
+		return false
+	}
+	s.mu.RLock()
+	mute, ok := s.mutes[muteKey(key, channel)]
+	s.mu.RUnlock()
+	return ok && now.Before(mute.Until)
+}
+
+// mute silences a channel of a bot for req.For, for the mute action. A
+// channel muted again keeps only the latest mute.
+func (s *Server) mute(req protocol.Request) protocol.Response {
+	channel := strings.TrimSpace(req.Channel)
+	if channel == "" {
+		return failed(invalidRequest("channel is required"))
+	}
+	duration, err := time.ParseDuration(strings.TrimSpace(req.For))
+	if err != nil || duration <= 0 {
+		return failed(invalidRequest("for must be a positive duration such as 2h or 30m"))
+	}
+	service, bot, err := s.resolveBotService(req.Service, req.Bot)
+	if err != nil {
+		return failed(err)
+	}
+	if _, err := s.resolveSelector(service, bot); err != nil {
+		return failed(err)
+	}
+	key := botKey(service, bot)
+
+	mute := protocol.Mute{
+		Service: service,
+		Bot:     bot,
+		Channel: channel,
+		Until:   time.Now().Add(duration).UTC().Truncate(time.Second),
+	}
+	if s.notifications != nil {
+		if err := s.notifications.SetMute(mute); err != nil {
+			return failed(err)
+		}
+	}
+
+	s.mu.Lock()
+	if s.mutes == nil {
+		s.mutes = make(map[string]protocol.Mute)
+	}
+	s.mutes[muteKey(key, channel)] = mute
+	s.mu.Unlock()
+
+	log.Printf("[%s] %s muted until %s", key, channel, mute.Until.Format(time.RFC3339))
+	return protocol.Response{
+		OK:    true,
+		Ack:   fmt.Sprintf("muted %s until %s", channel, mute.Until.Local().Format("2006-01-02 15:04")),
+		Mutes: []protocol.Mute{mute},
+	}
+}
+
+// unmute lifts mutes for the unmute action: of req.Channel, of every
+// channel of the bot without one, or of every bot with req.All.
+func (s *Server) unmute(req protocol.Request) protocol.Response {
+	channel := strings.TrimSpace(req.Channel)
+	var service, bot string
+	if req.All {
+		if strings.TrimSpace(req.Bot) != "" || channel != "" {
+			return failed(invalidRequest("all cannot be combined with bot or channel"))
+		}
+	} else {
+		if strings.TrimSpace(req.Bot) == "" {
+			return failed(invalidRequest("--bot is required, or --all to lift every mute"))
+		}
+		var err error
+		if service, bot, err = s.resolveBotService(req.Service, req.Bot); err != nil {
+			return failed(err)
+		}
+	}
+
+	if s.notifications != nil {
+		if _, err := s.notifications.DeleteMutes(service, bot, channel); err != nil {
+			return failed(err)
+		}
+	}
+
+	now := time.Now()
+	var lifted int64
+	s.mu.Lock()
+	for k, mute := range s.mutes {
+		if service != "" && mute.Service != service || bot != "" && mute.Bot != bot || channel != "" && mute.Channel != channel {
+			continue
+		}
+		delete(s.mutes, k)
+		if now.Before(mute.Until) {
+			lifted++
+			log.Printf("[%s] %s unmuted", botKey(mute.Service, mute.Bot), mute.Channel)
+		}
+	}
+	s.mu.Unlock()
+
+	return protocol.Response{OK: true, Cleared: lifted, Ack: fmt.Sprintf("lifted %d mutes", lifted)}
+}
+
+// listMutes returns the mutes in force for the mutes action, of the bots
+// req selects or of all of them.
+func (s *Server) listMutes(req protocol.Request) protocol.Response {
+	var keys []string
+	if req.Service != "" || req.Bot != "" {
+		var err error
+		if keys, err = s.resolveSelector(req.Service, req.Bot); err != nil {
+			return failed(err)
+		}
+	}
+
+	now := time.Now()
+	var mutes []protocol.Mute
+	s.mu.Lock()
+	for k, mute := range s.mutes {
+		if !now.Before(mute.Until) {
+			delete(s.mutes, k)
+			continue
+		}
+		if keys != nil && !slices.Contains(keys, botKey(mute.Service, mute.Bot)) {
+			continue
+		}
+		mutes = append(mutes, mute)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(mutes, func(i, j int) bool {
+		if !mutes[i].Until.Equal(mutes[j].Until) {
+			return mutes[i].Until.Before(mutes[j].Until)
+		}
+		return muteKey(botKey(mutes[i].Service, mutes[i].Bot), mutes[i].Channel) < muteKey(botKey(mutes[j].Service, mutes[j].Bot), mutes[j].Channel)
+	})
+	return protocol.Response{OK: true, Mutes: mutes}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/agent"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+)
+
+func TestMute_SuppressesChannel(t *testing.T) {
+	s := newReplayServer(t)
+	watcher, err := agent.NewRunner(agent.Config{Name: "watcher", When: "mentions", Command: agent.Command{"sh", "-c", "exit 0"}})
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+	t.Cleanup(watcher.Stop)
+	s.agents = []*agent.Runner{watcher}
+
+	resp := s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionMute, Service: "slack", Bot: "ops", Channel: "C1", For: "2h"})
+	if !resp.OK || len(resp.Mutes) != 1 {
+		t.Fatalf("mute: %+v", resp)
+	}
+
+	publishText(s, "slack", "ops", "@ops the build is red")
+	publishText(s, "slack", "other", "@other the build is red")
+
+	notifications, _ := s.notifications.ListNotifications(store.NotificationFilter{Limit: 10})
+	if len(notifications) != 1 || notifications[0].Bot != "other" {
+		t.Fatalf("expected only the unmuted bot to notify, got %+v", notifications)
+	}
+	events, _ := s.notifications.ListEvents(store.EventFilter{Bot: "ops", Limit: 10})
+	if len(events) != 1 || events[0].Notify {
+		t.Fatalf("expected the muted event to be stored without notify, got %+v", events)
+	}
+	if _, pending := watcher.State(); pending != 1 {
+		t.Fatalf("expected only the unmuted event to reach the agent, got %d pending", pending)
+	}
+
+	resp = s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionUnmute, Service: "slack", Bot: "ops"})
+	if !resp.OK || resp.Cleared != 1 {
+		t.Fatalf("unmute: %+v", resp)
+	}
+	publishText(s, "slack", "ops", "@ops still red")
+	if notifications, _ := s.notifications.ListNotifications(store.NotificationFilter{Bot: "ops", Limit: 10}); len(notifications) != 1 {
+		t.Fatalf("expected the channel to notify again once unmuted, got %+v", notifications)
+	}
+}
+
+func TestMute_ListAndReload(t *testing.T) {
+	s := newReplayServer(t)
+
+	for _, req := range []protocol.Request{
+		{Action: protocol.ActionMute, Service: "slack", Bot: "ops", Channel: "C1", For: "2h"},
+		{Action: protocol.ActionMute, Service: "slack", Bot: "other", Channel: "C2", For: "30m"},
+	} {
+		if resp := s.handleRequest(context.Background(), req); !resp.OK {
+			t.Fatalf("mute %s: %+v", req.Channel, resp)
+		}
+	}
+
+	// A restarted daemon reads the mutes back from the store.
+	s.mutes = nil
+	if err := s.loadMutes(); err != nil {
+		t.Fatalf("load mutes: %v", err)
+	}
+
+	resp := s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionMutes})
+	if !resp.OK || len(resp.Mutes) != 2 || resp.Mutes[0].Channel != "C2" || resp.Mutes[1].Channel != "C1" {
+		t.Fatalf("expected both mutes, soonest first, got %+v", resp)
+	}
+	resp = s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionMutes, Service: "slack", Bot: "ops"})
+	if !resp.OK || len(resp.Mutes) != 1 || resp.Mutes[0].Channel != "C1" {
+		t.Fatalf("expected the ops mute, got %+v", resp)
+	}
+
+	if resp := s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionMute, Service: "slack", Bot: "ops", Channel: "C1", For: "-1h"}); resp.OK {
+		t.Fatalf("expected a negative duration to be rejected")
+	}
+	if resp := s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionUnmute, Bot: "ops", All: true}); resp.OK {
+		t.Fatalf("expected all combined with bot to be rejected")
+	}
+
+	resp = s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionUnmute, All: true})
+	if !resp.OK || resp.Cleared != 2 {
+		t.Fatalf("unmute all: %+v", resp)
+	}
+	if mutes, _ := s.notifications.ListMutes(time.Now()); len(mutes) != 0 {
+		t.Fatalf("expected no stored mutes left, got %+v", mutes)
+	}
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// maxInFlight caps the tagged requests one connection runs at once; the
+// connection stops reading requests until one finishes. Subscriptions
+// don't count.
+const maxInFlight = 64
+
+// responseEncoder writes responses to a client.
+type responseEncoder interface {
+	Encode(v any) error
+}
+
+// connWriter serialises the responses of the requests and subscriptions
+// running concurrently on one connection.
+type connWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (w *connWriter) Encode(v any) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(v)
+}
+
+// taggedEncoder stamps every response with the ID of the request it
+// answers, so the client can tell interleaved replies and streams apart.
+type taggedEncoder struct {
+	w  *connWriter
+	id string
+}
+
+func (t taggedEncoder) Encode(v any) error {
+	if resp, ok := v.(protocol.Response); ok {
+		resp.ID = t.id
+		v = resp
+	}
+	return t.w.Encode(v)
+}
+
+// connMux runs the tagged requests of one connection: each in its own
+// goroutine, with subscriptions kept by ID until they end or the client
+// unsubscribes.
+type connMux struct {
+	ctx      context.Context
+	w        *connWriter
+	inFlight chan struct{}
+	wg       sync.WaitGroup
+
+	mu   sync.Mutex
+	subs map[string]*muxSubscription
+}
+
+type muxSubscription struct {
+	cancel context.CancelFunc
+	done   chan struct{} // closed once the subscription has stopped writing
+}
+
+func newConnMux(ctx context.Context, w *connWriter) *connMux {
+	return &connMux{
+		ctx:      ctx,
+		w:        w,
+		inFlight: make(chan struct{}, maxInFlight),
+		subs:     make(map[string]*muxSubscription),
+	}
+}
+
+// wait blocks until every request and subscription started has returned.
+// The caller cancels the connection's context first to end subscriptions.
+func (m *connMux) wait() {
+	m.wg.Wait()
+}
+
+func (m *connMux) handle(s *Server, req protocol.Request) {
+	enc := taggedEncoder{w: m.w, id: req.ID}
+
+	// A followed log is a stream too, kept and ended like a subscription.
+	stream := req.Action == protocol.ActionSubscribe || req.Action == protocol.ActionLogs && req.Follow
+	switch {
+	case stream:
+		m.mu.Lock()
+		if _, busy := m.subs[req.ID]; busy {
+			m.mu.Unlock()
+			_ = enc.Encode(protocol.Response{OK: false, Error: fmt.Sprintf("subscription %q is already open on this connection", req.ID), Code: protocol.CodeInvalidRequest})
+			return
+		}
+		ctx, cancel := context.WithCancel(m.ctx)
+		sub := &muxSubscription{cancel: cancel, done: make(chan struct{})}
+		m.subs[req.ID] = sub
+		m.mu.Unlock()
+
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			defer m.forget(req.ID, sub)
+			defer close(sub.done)
+			if req.Action == protocol.ActionLogs {
+				s.handleLogs(ctx, req, enc)
+			} else {
+				s.handleSubscribe(ctx, req, enc)
+			}
+		}()
+
+	case req.Action == protocol.ActionUnsubscribe:
+		sub := m.endSubscription(req.ID)
+		if sub == nil {
+			_ = enc.Encode(protocol.Response{OK: false, Error: fmt.Sprintf("no subscription %q on this connection", req.ID), Code: protocol.CodeInvalidRequest})
+			return
+		}
+		// Ack once the stream has stopped so no event of it follows.
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			<-sub.done
+			_ = enc.Encode(protocol.Response{OK: true, Ack: "unsubscribed"})
+		}()
+
+	default:
+		m.inFlight <- struct{}{}
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			defer func() { <-m.inFlight }()
+			_ = enc.Encode(s.handleRequest(m.ctx, req))
+		}()
+	}
+}
+
+// endSubscription stops the subscription id and returns it, or nil when
+// none is open.
+func (m *connMux) endSubscription(id string) *muxSubscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub := m.subs[id]
+	if sub != nil {
+		sub.cancel()
+		delete(m.subs, id)
+	}
+	return sub
+}
+
+// forget drops sub, which has ended, unless the client already
+// unsubscribed it and reused its ID.
+func (m *connMux) forget(id string, sub *muxSubscription) {
+	sub.cancel()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.subs[id] == sub {
+		delete(m.subs, id)
+	}
+}
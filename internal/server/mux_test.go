@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// muxConn runs handleConn over a pipe and returns the client's encoder and
+// decoder.
+func muxConn(t *testing.T, s *Server) (*json.Encoder, *json.Decoder) {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.handleConn(ctx, serverConn)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		_ = clientConn.Close()
+		<-done
+	})
+
+	_ = clientConn.SetDeadline(time.Now().Add(5 * time.Second))
+	return json.NewEncoder(clientConn), json.NewDecoder(clientConn)
+}
+
+func nextResponse(t *testing.T, decoder *json.Decoder) protocol.Response {
+	t.Helper()
+	var resp protocol.Response
+	if err := decoder.Decode(&resp); err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	return resp
+}
+
+func TestHandleConn_Multiplexed(t *testing.T) {
+	s := newReplayServer(t)
+	encoder, decoder := muxConn(t, s)
+
+	send := func(req protocol.Request) {
+		t.Helper()
+		if err := encoder.Encode(req); err != nil {
+			t.Fatalf("write request: %v", err)
+		}
+	}
+
+	send(protocol.Request{ID: "ops", Action: protocol.ActionSubscribe, Service: "slack", Bot: "ops"})
+	send(protocol.Request{ID: "other", Action: protocol.ActionSubscribe, Service: "slack", Bot: "other"})
+	for i := 0; i < 2; i++ {
+		if resp := nextResponse(t, decoder); !resp.OK || resp.Ack != "subscribed" || (resp.ID != "ops" && resp.ID != "other") {
+			t.Fatalf("expected a tagged subscribe ack, got %+v", resp)
+		}
+	}
+
+	publishText(s, "slack", "ops", "for ops")
+	publishText(s, "slack", "other", "for other")
+	got := map[string]string{}
+	for i := 0; i < 2; i++ {
+		resp := nextResponse(t, decoder)
+		if resp.Event == nil {
+			t.Fatalf("expected an event, got %+v", resp)
+		}
+		got[resp.ID] = resp.Event.Text
+	}
+	if got["ops"] != "for ops" || got["other"] != "for other" {
+		t.Fatalf("events routed to the wrong subscriptions: %v", got)
+	}
+
+	// Plain requests still work alongside the subscriptions.
+	send(protocol.Request{ID: "p1", Action: protocol.ActionPing})
+	if resp := nextResponse(t, decoder); resp.ID != "p1" || resp.Ack != "pong" {
+		t.Fatalf("expected a tagged pong, got %+v", resp)
+	}
+	send(protocol.Request{ID: "ops", Action: protocol.ActionSubscribe, Bot: "other"})
+	if resp := nextResponse(t, decoder); resp.OK || resp.ID != "ops" {
+		t.Fatalf("expected a duplicate subscription ID rejected, got %+v", resp)
+	}
+
+	send(protocol.Request{ID: "ops", Action: protocol.ActionUnsubscribe})
+	if resp := nextResponse(t, decoder); !resp.OK || resp.ID != "ops" || resp.Ack != "unsubscribed" {
+		t.Fatalf("expected an unsubscribe ack, got %+v", resp)
+	}
+	send(protocol.Request{ID: "ops", Action: protocol.ActionUnsubscribe})
+	if resp := nextResponse(t, decoder); resp.OK {
+		t.Fatalf("expected a second unsubscribe to fail, got %+v", resp)
+	}
+
+	publishText(s, "slack", "ops", "after unsubscribe")
+	publishText(s, "slack", "other", "still streaming")
+	if resp := nextResponse(t, decoder); resp.ID != "other" || resp.Event == nil || resp.Event.Text != "still streaming" {
+		t.Fatalf("expected only the remaining subscription's event, got %+v", resp)
+	}
+
+	// Untagged requests are answered without an ID.
+	send(protocol.Request{Action: protocol.ActionPing})
+	if resp := nextResponse(t, decoder); resp.ID != "" || resp.Ack != "pong" {
+		t.Fatalf("expected an untagged pong, got %+v", resp)
+	}
+}
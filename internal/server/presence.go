@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+// setPresence applies req.Presence to the bot's account for the presence
+// action.
+func (s *Server) setPresence(ctx context.Context, req protocol.Request) error {
+	if err := upstream.ValidatePresence(req.Presence); err != nil {
+		return err
+	}
+
+	service, bot, err := s.resolveBotService(req.Service, req.Bot)
+	if err != nil {
+		return err
+	}
+
+	key := botKey(service, bot)
+	connector, gate, err := s.acquireConnector(ctx, key)
+	if err != nil {
+		return err
+	}
+	if connector == nil {
+		return unknownBot(service, bot)
+	}
+	defer gate.leave()
+
+	setter, ok := connector.(upstream.PresenceSetter)
+	if !ok || !connector.Capabilities().Presence {
+		return withCode(protocol.CodeUnsupported, errors.New(unsupported(service, bot, "presence")))
+	}
+	if err := setter.SetPresence(ctx, *req.Presence); err != nil {
+		return withCode(protocol.CodeUpstream, err)
+	}
+	return nil
+}
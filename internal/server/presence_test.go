@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+type presenceConnector struct {
+	idleConnector
+	set []protocol.Presence
+}
+
+func (c *presenceConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{Presence: true}
+}
+
+func (c *presenceConnector) SetPresence(_ context.Context, presence protocol.Presence) error {
+	c.set = append(c.set, presence)
+	return nil
+}
+
+func TestHandleRequest_Presence(t *testing.T) {
+	s := newReplayServer(t)
+	setter := &presenceConnector{idleConnector: idleConnector{name: "ops"}}
+	s.connectors["slack:ops"] = setter
+	s.connectors["discord:ops"] = &idleConnector{name: "ops"}
+
+	setPresence := func(service string, presence *protocol.Presence) protocol.Response {
+		return s.handleRequest(context.Background(), protocol.Request{
+			Action:   protocol.ActionPresence,
+			Service:  service,
+			Bot:      "ops",
+			Presence: presence,
+		})
+	}
+
+	status := "Reviewing PRs"
+	if resp := setPresence("slack", &protocol.Presence{State: "dnd", Status: &status}); !resp.OK || resp.Ack != "presence updated" {
+		t.Fatalf("set presence failed: %+v", resp)
+	}
+	if len(setter.set) != 1 || setter.set[0].State != "dnd" || *setter.set[0].Status != status {
+		t.Fatalf("expected the presence to reach the connector, got %+v", setter.set)
+	}
+
+	if resp := setPresence("slack", &protocol.Presence{State: "busy"}); resp.OK || !strings.Contains(resp.Error, "presence state must be") {
+		t.Fatalf("expected an invalid state error, got %+v", resp)
+	}
+	if resp := setPresence("slack", nil); resp.OK || !strings.Contains(resp.Error, "needs a state or a status") {
+		t.Fatalf("expected a missing presence error, got %+v", resp)
+	}
+	if resp := setPresence("discord", &protocol.Presence{State: "away"}); resp.OK || !strings.Contains(resp.Error, "does not support presence") {
+		t.Fatalf("expected the connector to be refused, got %+v", resp)
+	}
+	if len(setter.set) != 1 {
+		t.Fatalf("expected rejected requests not to reach the connector, got %+v", setter.set)
+	}
+}
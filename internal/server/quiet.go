@@ -0,0 +1,35 @@
+package server
+
+import (
+	"log"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/quiet"
+)
+
+// quietNow returns the bot's quiet hours when they are in effect at now,
+// or nil.
+func (s *Server) quietNow(key string, now time.Time) *quiet.Hours {
+	s.mu.RLock()
+	hours := s.quietHours[key]
+	s.mu.RUnlock()
+	if !hours.Active(now) {
+		return nil
+	}
+	return hours
+}
+
+// deferNotification hides a notification that arrived during quiet hours
+// until they end, when the snooze waker brings it back unseen and streams
+// it to notification subscribers.
+func (s *Server) deferNotification(key string, event protocol.Event, hours *quiet.Hours, now time.Time) {
+	until := hours.Ends(now)
+	if _, err := s.notifications.SnoozeNotification(event.NotificationID, until); err != nil {
+		log.Printf("[%s] warning: defer notification %d: %v", key, event.NotificationID, err)
+		return
+	}
+	if s.debugging(key) {
+		log.Printf("[%s] debug: notification %d deferred to %s", key, event.NotificationID, until.Format(time.RFC3339))
+	}
+}
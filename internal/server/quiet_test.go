@@ -0,0 +1,117 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/agent"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/quiet"
+	"github.com/pantalk/pantalk/internal/store"
+)
+
+// quietAroundNow returns quiet hours from an hour ago to an hour from now.
+func quietAroundNow(t *testing.T, deferred bool) *quiet.Hours {
+	t.Helper()
+	now := time.Now().UTC()
+	hours, err := quiet.New(quiet.Window{
+		Start:    now.Add(-time.Hour).Format("15:04"),
+		End:      now.Add(time.Hour).Format("15:04"),
+		Timezone: "UTC",
+		Defer:    deferred,
+	})
+	if err != nil {
+		t.Fatalf("quiet hours: %v", err)
+	}
+	return hours
+}
+
+func TestQuietHours_SuppressNotifications(t *testing.T) {
+	s := newReplayServer(t)
+	s.quietHours = map[string]*quiet.Hours{"slack:ops": quietAroundNow(t, false)}
+	watcher, err := agent.NewRunner(agent.Config{Name: "watcher", When: "mentions", Command: agent.Command{"sh", "-c", "exit 0"}})
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+	t.Cleanup(watcher.Stop)
+	s.agents = []*agent.Runner{watcher}
+
+	publishText(s, "slack", "ops", "@ops the build is red")
+	publishText(s, "slack", "other", "@other the build is red")
+
+	notifications, _ := s.notifications.ListNotifications(store.NotificationFilter{Limit: 10})
+	if len(notifications) != 1 || notifications[0].Bot != "other" {
+		t.Fatalf("expected only the bot outside quiet hours to notify, got %+v", notifications)
+	}
+	events, _ := s.notifications.ListEvents(store.EventFilter{Bot: "ops", Limit: 10})
+	if len(events) != 1 || events[0].Notify {
+		t.Fatalf("expected the quiet event to be stored without notify, got %+v", events)
+	}
+	if _, pending := watcher.State(); pending != 1 {
+		t.Fatalf("expected only the event outside quiet hours to reach the agent, got %d pending", pending)
+	}
+}
+
+func TestQuietHours_DeferNotifications(t *testing.T) {
+	s := newReplayServer(t)
+	hours := quietAroundNow(t, true)
+	s.quietHours = map[string]*quiet.Hours{"slack:ops": hours}
+
+	publishText(s, "slack", "ops", "@ops the build is red")
+
+	if unseen, _ := s.notifications.ListNotifications(store.NotificationFilter{Unseen: true, Limit: 10}); len(unseen) != 0 {
+		t.Fatalf("expected the notification to be held, got %+v", unseen)
+	}
+
+	s.wakeSnoozed(hours.Ends(time.Now()))
+	unseen, _ := s.notifications.ListNotifications(store.NotificationFilter{Unseen: true, Limit: 10})
+	if len(unseen) != 1 || unseen[0].NotifyReason != protocol.NotifyMention {
+		t.Fatalf("expected the notification back when quiet hours end, got %+v", unseen)
+	}
+}
+
+func TestQuietHours_DeferredNotificationsStreamWhenTheyWake(t *testing.T) {
+	s := newReplayServer(t)
+	hours := quietAroundNow(t, true)
+	s.quietHours = map[string]*quiet.Hours{"slack:ops": hours}
+	decoder := subscribeStream(t, s, protocol.Request{Action: protocol.ActionSubscribe, Service: "slack", Notify: true})
+
+	publishText(s, "slack", "ops", "@ops the build is red")
+	publishText(s, "slack", "other", "@other the build is red")
+
+	if ev := nextEvent(t, decoder); ev.Bot != "other" {
+		t.Fatalf("expected nothing from the quiet bot during its window, got %+v", ev)
+	}
+	events, _ := s.notifications.ListEvents(store.EventFilter{Bot: "ops", Limit: 10})
+	if len(events) != 1 || events[0].Notify {
+		t.Fatalf("expected the deferred event stored without notify, got %+v", events)
+	}
+
+	s.wakeSnoozed(hours.Ends(time.Now()))
+	ev := nextEvent(t, decoder)
+	if ev.Bot != "ops" || !ev.Notify || ev.NotificationID == 0 || ev.Text != "@ops the build is red" {
+		t.Fatalf("expected the deferred notification once the window ends, got %+v", ev)
+	}
+}
+
+func TestQuietHours_SkipTicks(t *testing.T) {
+	s := newReplayServer(t)
+	s.clockQuiet = quietAroundNow(t, false)
+	clock, err := agent.NewRunner(agent.Config{Name: "clock", When: "tick", Command: agent.Command{"sh", "-c", "exit 0"}})
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+	t.Cleanup(clock.Stop)
+	s.agents = []*agent.Runner{clock}
+
+	s.dispatchTick()
+	if _, pending := clock.State(); pending != 0 {
+		t.Fatalf("expected ticks to be skipped during quiet hours, got %d pending", pending)
+	}
+
+	s.clockQuiet = nil
+	s.dispatchTick()
+	if _, pending := clock.State(); pending != 1 {
+		t.Fatalf("expected a tick outside quiet hours, got %d pending", pending)
+	}
+}
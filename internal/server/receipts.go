@@ -0,0 +1,38 @@
+package server
+
+import (
+	"log"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// recordReceipt records the delivery status a receipt reports on the
+// stored message it is about and streams the receipt to the bot's
+// subscribers. Receipts that don't move a stored message forward, such as
+// a delivery receipt arriving after the read one, are dropped.
+func (s *Server) recordReceipt(key string, event protocol.Event) {
+	if s.notifications != nil {
+		eventID, err := s.notifications.RecordStatus(event.Service, event.Bot, event.MessageID, event.Status, event.Text, event.Timestamp)
+		if err != nil {
+			log.Printf("[%s] warning: record receipt for %s: %v", key, event.MessageID, err)
+			return
+		}
+		if eventID == 0 {
+			return
+		}
+		s.recent.setStatus(key, eventID, event.Status)
+	}
+
+	if event.Status == protocol.StatusFailed {
+		log.Printf("[%s] message %s on %s failed: %s", key, event.MessageID, event.Channel, event.Text)
+	} else if s.debugging(key) {
+		log.Printf("[%s] debug: message %s on %s %s", key, event.MessageID, event.Channel, event.Status)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sub := range s.subsByBot[key] {
+		s.deliver(sub, key, event)
+	}
+}
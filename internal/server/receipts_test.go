@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func TestPublish_Receipt(t *testing.T) {
+	s := newReplayServer(t)
+	s.recent = newRecentEvents(10)
+
+	sub := s.subscribe([]string{"slack:ops"}, 0, false, false)
+	defer s.unsubscribe(sub)
+
+	s.publish(protocol.Event{Service: "slack", Bot: "ops", Kind: "message", Direction: "out", Channel: "C1", MessageID: "M1", Text: "shipped"})
+	<-sub.events
+
+	history := func() protocol.Event {
+		t.Helper()
+		resp := s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionHistory, Bot: "ops", Limit: 10})
+		if !resp.OK || len(resp.Events) != 1 {
+			t.Fatalf("expected the sent message in history, got %+v", resp)
+		}
+		return resp.Events[0]
+	}
+	// Load the in-memory history before the receipts arrive.
+	if got := history(); got.Status != "" {
+		t.Fatalf("expected no status before a receipt, got %q", got.Status)
+	}
+
+	receipt := func(status string) {
+		s.publish(protocol.Event{Service: "slack", Bot: "ops", Kind: protocol.KindReceipt, Direction: "out", Channel: "C1", MessageID: "M1", Status: status, Timestamp: time.Now().UTC()})
+	}
+	receipt(protocol.StatusDelivered)
+	receipt(protocol.StatusRead)
+	receipt(protocol.StatusDelivered) // another group member, after the read
+
+	if got := history(); got.Status != protocol.StatusRead {
+		t.Fatalf("expected the message read, got %q", got.Status)
+	}
+
+	var streamed []string
+	for len(sub.events) > 0 {
+		ev := <-sub.events
+		if ev.Kind != protocol.KindReceipt || ev.MessageID != "M1" {
+			t.Fatalf("unexpected event %+v", ev)
+		}
+		streamed = append(streamed, ev.Status)
+	}
+	if len(streamed) != 2 || streamed[0] != protocol.StatusDelivered || streamed[1] != protocol.StatusRead {
+		t.Fatalf("expected delivered and read streamed, got %v", streamed)
+	}
+
+	resp := s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionHistory, Bot: "ops", Limit: 10, Search: "shipped"})
+	if !resp.OK || len(resp.Events) != 1 || resp.Events[0].Status != protocol.StatusRead {
+		t.Fatalf("expected the stored message read, got %+v", resp)
+	}
+}
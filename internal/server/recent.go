@@ -0,0 +1,192 @@
+package server
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+)
+
+// recentEvents keeps the newest stored events of each bot in memory, up to
+// server.notification_history_size per bot, so the common "last few
+// messages" history reads don't go to SQLite.
+type recentEvents struct {
+	size int
+
+	mu    sync.Mutex
+	rings map[string]*eventRing
+}
+
+// eventRing holds the newest events of one bot in ID order. It is filled
+// from the store on first use and then by publish, so it has every stored
+// event of the bot from its oldest one on; complete is set while that
+// oldest one is also the bot's first.
+type eventRing struct {
+	mu       sync.Mutex
+	seeded   bool
+	complete bool
+	events   []protocol.Event
+}
+
+func newRecentEvents(size int) *recentEvents {
+	return &recentEvents{size: size, rings: make(map[string]*eventRing)}
+}
+
+func (r *recentEvents) ring(key string) *eventRing {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ring, ok := r.rings[key]
+	if !ok {
+		ring = &eventRing{}
+		r.rings[key] = ring
+	}
+	return ring
+}
+
+// add records an event publish just stored. Rings that haven't been read
+// yet skip it; they load it from the store with the rest.
+func (r *recentEvents) add(key string, event protocol.Event) {
+	if r == nil || r.size <= 0 || event.ID <= 0 {
+		return
+	}
+	ring := r.ring(key)
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+	if !ring.seeded {
+		return
+	}
+
+	// Connectors publish concurrently, so IDs can arrive slightly out of
+	// order; keep the ring sorted.
+	i := sort.Search(len(ring.events), func(i int) bool { return ring.events[i].ID >= event.ID })
+	if i < len(ring.events) && ring.events[i].ID == event.ID {
+		return
+	}
+	ring.events = append(ring.events, protocol.Event{})
+	copy(ring.events[i+1:], ring.events[i:])
+	ring.events[i] = storedEvent(event)
+
+	if over := len(ring.events) - r.size; over > 0 {
+		// Reslicing leaves the evicted events to the next reallocation by
+		// append, which keeps eviction amortised O(1).
+		ring.events = ring.events[over:]
+		ring.complete = false
+	}
+}
+
+// setStatus updates the delivery status of a stored event the bot's ring
+// holds.
+func (r *recentEvents) setStatus(key string, id int64, status string) {
+	if r == nil || r.size <= 0 {
+		return
+	}
+	ring := r.ring(key)
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+	i := sort.Search(len(ring.events), func(i int) bool { return ring.events[i].ID >= id })
+	if i < len(ring.events) && ring.events[i].ID == id {
+		ring.events[i].Status = status
+	}
+}
+
+// reset forgets every ring after events were deleted from the store.
+func (r *recentEvents) reset() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.rings = make(map[string]*eventRing)
+	r.mu.Unlock()
+}
+
+// read answers a history query for the bot key from memory, loading the
+// ring with load on first use. ok is false when the ring can't tell for
+// sure that it holds every event the query would return from the store:
+// text searches, and reads reaching further back than the ring.
+func (r *recentEvents) read(key string, filter store.EventFilter, load func(limit int) ([]protocol.Event, error)) ([]protocol.Event, bool, error) {
+	if r == nil || r.size <= 0 || filter.Search != "" || filter.BeforeID > 0 {
+		return nil, false, nil
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+
+	ring := r.ring(key)
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+
+	if !ring.seeded {
+		events, err := load(r.size)
+		if err != nil {
+			return nil, false, err
+		}
+		ring.events = make([]protocol.Event, 0, len(events))
+		for _, event := range events {
+			ring.events = append(ring.events, storedEvent(event))
+		}
+		ring.complete = len(events) < r.size
+		ring.seeded = true
+	}
+
+	// Everything after the cursor must be in the ring.
+	cursorKept := ring.complete || (len(ring.events) > 0 && ring.events[0].ID <= filter.SinceID+1)
+
+	if filter.SinceID > 0 && filter.Forward {
+		if !cursorKept {
+			return nil, false, nil
+		}
+		events := make([]protocol.Event, 0, limit)
+		for _, event := range ring.events {
+			if event.ID > filter.SinceID && matchesFilter(event, filter) {
+				events = append(events, event)
+				if len(events) == limit {
+					break
+				}
+			}
+		}
+		return events, true, nil
+	}
+
+	events := make([]protocol.Event, 0, limit)
+	for i := len(ring.events) - 1; i >= 0 && len(events) < limit && ring.events[i].ID > filter.SinceID; i-- {
+		if matchesFilter(ring.events[i], filter) {
+			events = append(events, ring.events[i])
+		}
+	}
+	if len(events) < limit && !cursorKept {
+		return nil, false, nil
+	}
+	for left, right := 0, len(events)-1; left < right; left, right = left+1, right-1 {
+		events[left], events[right] = events[right], events[left]
+	}
+	return events, true, nil
+}
+
+// matchesFilter applies the exact-match fields of an EventFilter the way
+// the store's query does.
+func matchesFilter(event protocol.Event, filter store.EventFilter) bool {
+	return (filter.Target == "" || event.Target == filter.Target) &&
+		(filter.Channel == "" || event.Channel == filter.Channel) &&
+		(filter.Thread == "" || event.Thread == filter.Thread) &&
+		(filter.Direction == "" || event.Direction == filter.Direction) &&
+		(filter.Kind == "" || event.Kind == filter.Kind) &&
+		(!filter.NotifyOnly || event.Notify)
+}
+
+// storedEvent is event as the store returns it: with the timestamp in UTC
+// and without the fields the events table doesn't keep - Self, which
+// publish works out per delivery, and the notification's own fields.
+func storedEvent(event protocol.Event) protocol.Event {
+	stored := event
+	stored.Timestamp = event.Timestamp.UTC()
+	stored.Self = false
+	stored.NotificationID = 0
+	stored.Collapsed = 0
+	stored.Seen = false
+	stored.SeenAt = nil
+	stored.Priority = ""
+	stored.Labels = nil
+	return stored
+}
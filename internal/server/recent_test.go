@@ -0,0 +1,243 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+)
+
+func ringEvents(ids ...int64) []protocol.Event {
+	events := make([]protocol.Event, 0, len(ids))
+	for _, id := range ids {
+		events = append(events, protocol.Event{ID: id, Service: "slack", Bot: "ops", Channel: fmt.Sprintf("C%d", id%2), Text: fmt.Sprint(id)})
+	}
+	return events
+}
+
+func eventIDs(events []protocol.Event) []int64 {
+	ids := make([]int64, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func TestRecentEvents_Read(t *testing.T) {
+	loads := 0
+	seed := func(events []protocol.Event) func(int) ([]protocol.Event, error) {
+		return func(int) ([]protocol.Event, error) {
+			loads++
+			return events, nil
+		}
+	}
+
+	t.Run("partial ring serves what it holds", func(t *testing.T) {
+		loads = 0
+		r := newRecentEvents(4)
+		load := seed(ringEvents(5, 6, 7, 8)) // full: older events may exist
+
+		events, ok, err := r.read("slack:ops", store.EventFilter{Limit: 3}, load)
+		if err != nil || !ok || !reflect.DeepEqual(eventIDs(events), []int64{6, 7, 8}) {
+			t.Fatalf("expected the newest 3 from memory, got %v ok=%v err=%v", eventIDs(events), ok, err)
+		}
+		if _, ok, _ := r.read("slack:ops", store.EventFilter{Limit: 10}, load); ok {
+			t.Fatal("expected a read past the ring to fall back to the store")
+		}
+		if _, ok, _ := r.read("slack:ops", store.EventFilter{Limit: 3, Channel: "C1"}, load); ok {
+			t.Fatal("expected a filtered read with too few matches to fall back")
+		}
+		if events, ok, _ := r.read("slack:ops", store.EventFilter{Limit: 10, SinceID: 4}, load); !ok || len(events) != 4 {
+			t.Fatalf("expected a cursor at the ring's start served, got %v ok=%v", eventIDs(events), ok)
+		}
+		if _, ok, _ := r.read("slack:ops", store.EventFilter{Limit: 10, SinceID: 2}, load); ok {
+			t.Fatal("expected a cursor before the ring to fall back")
+		}
+		if events, ok, _ := r.read("slack:ops", store.EventFilter{Limit: 3, SinceID: 2}, load); !ok || !reflect.DeepEqual(eventIDs(events), []int64{6, 7, 8}) {
+			t.Fatalf("expected the newest 3 after the cursor from memory, got %v ok=%v", eventIDs(events), ok)
+		}
+		if _, ok, _ := r.read("slack:ops", store.EventFilter{Limit: 3, SinceID: 2, Forward: true}, load); ok {
+			t.Fatal("expected a forward page from before the ring to fall back")
+		}
+		if _, ok, _ := r.read("slack:ops", store.EventFilter{Limit: 10, Search: "7"}, load); ok {
+			t.Fatal("expected a search to fall back")
+		}
+		if loads != 1 {
+			t.Fatalf("expected the ring loaded once, got %d loads", loads)
+		}
+	})
+
+	t.Run("complete ring answers everything", func(t *testing.T) {
+		r := newRecentEvents(10)
+		load := seed(ringEvents(1, 2, 3))
+
+		events, ok, _ := r.read("slack:ops", store.EventFilter{Limit: 50, Channel: "C1"}, load)
+		if !ok || !reflect.DeepEqual(eventIDs(events), []int64{1, 3}) {
+			t.Fatalf("expected channel C1 from memory, got %v ok=%v", eventIDs(events), ok)
+		}
+	})
+
+	t.Run("add keeps order and evicts", func(t *testing.T) {
+		r := newRecentEvents(3)
+		load := seed(ringEvents(1, 2))
+		r.add("slack:ops", ringEvents(3)[0]) // before the first read: ignored
+		if _, _, err := r.read("slack:ops", store.EventFilter{}, load); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, event := range ringEvents(5, 4, 4) {
+			r.add("slack:ops", event)
+		}
+		events, ok, _ := r.read("slack:ops", store.EventFilter{Limit: 3}, load)
+		if !ok || !reflect.DeepEqual(eventIDs(events), []int64{2, 4, 5}) {
+			t.Fatalf("expected 2, 4, 5 after eviction, got %v ok=%v", eventIDs(events), ok)
+		}
+		if _, ok, _ := r.read("slack:ops", store.EventFilter{Limit: 4}, load); ok {
+			t.Fatal("expected the ring to stop claiming completeness after evicting")
+		}
+	})
+
+	t.Run("load error", func(t *testing.T) {
+		r := newRecentEvents(3)
+		_, _, err := r.read("slack:ops", store.EventFilter{}, func(int) ([]protocol.Event, error) {
+			return nil, errors.New("disk gone")
+		})
+		if err == nil {
+			t.Fatal("expected the load error")
+		}
+	})
+}
+
+func TestReadEvents_RecentMatchesStore(t *testing.T) {
+	s := newReplayServer(t)
+	s.recent = newRecentEvents(5)
+
+	for i := 0; i < 3; i++ {
+		publishText(s, "slack", "ops", fmt.Sprintf("before %d", i))
+	}
+	// "ops" is a bot of two services, so this read goes to the store.
+	if events, err := s.readEvents(store.EventFilter{Bot: "ops", Limit: 10}); err != nil || len(events) != 3 {
+		t.Fatalf("expected 3 events from the store, got %d (%v)", len(events), err)
+	}
+	// The first read of slack:ops loads the ring; later events come from
+	// publish.
+	if _, err := s.readEvents(store.EventFilter{Service: "slack", Bot: "ops", Limit: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		publishText(s, "slack", "ops", fmt.Sprintf("after %d", i))
+		publishText(s, "slack", "other", fmt.Sprintf("other %d", i))
+	}
+
+	latest, err := s.notifications.ListEvents(store.EventFilter{Service: "slack", Bot: "ops", Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, limit := range []int{1, 3, 5, 20} {
+		for _, filter := range []store.EventFilter{
+			{Service: "slack", Bot: "ops", Limit: limit},
+			{Service: "slack", Bot: "ops", Limit: limit, SinceID: latest[0].ID},
+			{Service: "slack", Bot: "ops", Limit: limit, SinceID: latest[0].ID, Forward: true},
+		} {
+			got, err := s.readEvents(filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := s.notifications.ListEvents(filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("%+v: memory and store disagree:\n got %+v\nwant %+v", filter, got, want)
+			}
+		}
+	}
+
+	if _, err := s.clearHistory(protocol.Request{Service: "slack", Bot: "ops"}); err != nil {
+		t.Fatal(err)
+	}
+	events, err := s.readEvents(store.EventFilter{Service: "slack", Bot: "ops", Limit: 10})
+	if err != nil || len(events) != 0 {
+		t.Fatalf("expected no events after clearing history, got %d (%v)", len(events), err)
+	}
+}
+
+// fillValue sets every field of v, recursively, to a value other than its
+// zero value, so a field a copy drops shows up.
+func fillValue(v reflect.Value, name string) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString("x-" + name)
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int64:
+		v.SetInt(7)
+	case reflect.Float64:
+		v.SetFloat(1.5)
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+		fillValue(v.Elem(), name)
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fillValue(v.Index(0), name)
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			v.Set(reflect.ValueOf(time.Date(2026, 3, 4, 12, 0, 0, 123456789, time.FixedZone("CET", 3600))))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			fillValue(v.Field(i), v.Type().Field(i).Name)
+		}
+	}
+}
+
+func TestStoredEvent_MatchesStoreRow(t *testing.T) {
+	s := newReplayServer(t)
+
+	var event protocol.Event
+	fillValue(reflect.ValueOf(&event).Elem(), "")
+	event.Service, event.Bot, event.Kind, event.Direction = "slack", "ops", "message", "in"
+	id, err := s.notifications.InsertEvent(event)
+	if err != nil {
+		t.Fatalf("insert event: %v", err)
+	}
+	event.ID = id
+
+	rows, err := s.notifications.ListEvents(store.EventFilter{Service: "slack", Bot: "ops", Limit: 1})
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("list events: %+v, %v", rows, err)
+	}
+
+	ring, row := reflect.ValueOf(storedEvent(event)), reflect.ValueOf(rows[0])
+	for i := 0; i < ring.NumField(); i++ {
+		name := ring.Type().Field(i).Name
+		if got, want := ring.Field(i).Interface(), row.Field(i).Interface(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: ring has %#v, store row has %#v", name, got, want)
+		}
+	}
+}
+
+func TestHistory_DirectionAndKind(t *testing.T) {
+	s := newReplayServer(t)
+	publishText(s, "slack", "ops", "inbound")
+	s.publish(protocol.Event{Service: "slack", Bot: "ops", Kind: "message", Direction: "out", Channel: "C1", Text: "outbound"})
+	s.publish(protocol.Event{Service: "slack", Bot: "ops", Kind: protocol.KindReaction, Direction: "in", Channel: "C1", Text: "thumbsup"})
+
+	resp := s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionHistory, Service: "slack", Bot: "ops", Direction: "out"})
+	if !resp.OK || len(resp.Events) != 1 || resp.Events[0].Text != "outbound" {
+		t.Fatalf("expected only the outbound message, got %+v", resp)
+	}
+	resp = s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionHistory, Service: "slack", Bot: "ops", Kind: protocol.KindReaction})
+	if !resp.OK || len(resp.Events) != 1 || resp.Events[0].Text != "thumbsup" {
+		t.Fatalf("expected only the reaction, got %+v", resp)
+	}
+	resp = s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionHistory, Service: "slack", Bot: "ops", Direction: "sideways"})
+	if resp.OK || resp.Code != protocol.CodeInvalidRequest {
+		t.Fatalf("expected an invalid direction refused, got %+v", resp)
+	}
+}
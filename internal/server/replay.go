@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/agent"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+)
+
+// replayBatch is how many stored events each catch-up query reads.
+const replayBatch = 500
+
+// replay streams the stored events after req.SinceID for the bots in keys,
+// in id order. Ids are assigned on arrival, so this is strict chronological
+// order across all bots rather than per-bot batches. Sends are paced to
+// req.ReplayRate events per second when set. Events where rejects are read
+// but not sent.
+//
+// The caller subscribes before replaying so nothing published meanwhile is
+// missed; replay keeps querying until the store has nothing newer, and the
+// returned id lets the caller drop live events that were already replayed.
+func (s *Server) replay(ctx context.Context, req protocol.Request, keys []string, where *agent.Filter, encoder responseEncoder) (int64, int, error) {
+	lastID := req.SinceID
+	if s.notifications == nil {
+		return lastID, 0, nil
+	}
+
+	selected := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		selected[key] = struct{}{}
+	}
+
+	var pace <-chan time.Time
+	if req.ReplayRate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(req.ReplayRate))
+		defer ticker.Stop()
+		pace = ticker.C
+	}
+
+	sent := 0
+	for {
+		events, err := s.notifications.ListEvents(store.EventFilter{
+			Service:    req.Service,
+			Bot:        req.Bot,
+			Target:     req.Target,
+			Channel:    req.Channel,
+			Thread:     req.Thread,
+			NotifyOnly: req.Notify,
+			SinceID:    lastID,
+			Forward:    true,
+			Limit:      replayBatch,
+		})
+		if err != nil {
+			return lastID, sent, fmt.Errorf("read events for replay: %w", err)
+		}
+		if len(events) == 0 {
+			return lastID, sent, nil
+		}
+
+		for _, ev := range events {
+			lastID = ev.ID
+			if _, ok := selected[botKey(ev.Service, ev.Bot)]; !ok {
+				continue
+			}
+			if !matchEventFilters(ev, req.Target, req.Channel, req.Thread, req.Search) {
+				continue
+			}
+			if where != nil && !where.Match(ev) {
+				continue
+			}
+
+			if pace != nil {
+				select {
+				case <-ctx.Done():
+					return lastID, sent, ctx.Err()
+				case <-pace:
+				}
+			}
+
+			if err := encoder.Encode(protocol.Response{OK: true, Event: &ev}); err != nil {
+				return lastID, sent, err
+			}
+			sent++
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+func newReplayServer(t *testing.T) *Server {
+	t.Helper()
+	st, err := store.Open(filepath.Join(t.TempDir(), "pantalk-replay.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+
+	return &Server{
+		notifications: st,
+		bots: map[string]protocol.BotRef{
+			"slack:ops":   {Service: "slack", Name: "ops"},
+			"discord:ops": {Service: "discord", Name: "ops"},
+			"slack:other": {Service: "slack", Name: "other"},
+		},
+		connectors:  make(map[string]upstream.Connector),
+		routesByBot: make(map[string]map[string]struct{}),
+		subsByBot:   make(map[string]map[*subscriber]struct{}),
+	}
+}
+
+func publishText(s *Server, service string, bot string, text string) {
+	s.publish(protocol.Event{
+		Service:   service,
+		Bot:       bot,
+		Kind:      "message",
+		Direction: "in",
+		Channel:   "C1",
+		Text:      text,
+	})
+}
+
+// subscribeStream runs handleSubscribe over a pipe and returns a decoder for
+// its responses.
+func subscribeStream(t *testing.T, s *Server, req protocol.Request) *json.Decoder {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		_ = clientConn.Close()
+		_ = serverConn.Close()
+	})
+
+	go s.handleSubscribe(ctx, req, json.NewEncoder(serverConn))
+
+	_ = clientConn.SetDeadline(time.Now().Add(5 * time.Second))
+	decoder := json.NewDecoder(clientConn)
+
+	var ack protocol.Response
+	if err := decoder.Decode(&ack); err != nil || !ack.OK {
+		t.Fatalf("subscribe ack: %+v, %v", ack, err)
+	}
+	return decoder
+}
+
+func nextEvent(t *testing.T, decoder *json.Decoder) protocol.Event {
+	t.Helper()
+	var resp protocol.Response
+	if err := decoder.Decode(&resp); err != nil {
+		t.Fatalf("read event: %v", err)
+	}
+	if !resp.OK || resp.Event == nil {
+		t.Fatalf("expected event, got %+v", resp)
+	}
+	return *resp.Event
+}
+
+func TestHandleSubscribe_ReplaysInOrderThenLive(t *testing.T) {
+	s := newReplayServer(t)
+
+	publishText(s, "slack", "ops", "before")
+	publishText(s, "slack", "ops", "one")
+	publishText(s, "discord", "ops", "two")
+	publishText(s, "slack", "other", "not selected")
+	publishText(s, "slack", "ops", "three")
+
+	decoder := subscribeStream(t, s, protocol.Request{
+		Action:  protocol.ActionSubscribe,
+		Bot:     "ops",
+		SinceID: 1,
+	})
+
+	var got []string
+	var lastID int64
+	for _, want := range []string{"one", "two", "three"} {
+		ev := nextEvent(t, decoder)
+		if ev.ID <= lastID {
+			t.Fatalf("replay out of order: id %d after %d", ev.ID, lastID)
+		}
+		lastID = ev.ID
+		got = append(got, ev.Text)
+		if ev.Text != want {
+			t.Fatalf("expected replay %q, got %v", want, got)
+		}
+	}
+
+	marker := nextEvent(t, decoder)
+	if marker.Kind != protocol.KindReplayDone || marker.ID != lastID {
+		t.Fatalf("expected replay_done marker after replay, got %+v", marker)
+	}
+
+	publishText(s, "discord", "ops", "live")
+	if ev := nextEvent(t, decoder); ev.Text != "live" {
+		t.Fatalf("expected live event after marker, got %+v", ev)
+	}
+}
+
+func TestHandleSubscribe_ReplayRate(t *testing.T) {
+	s := newReplayServer(t)
+	for _, text := range []string{"a", "b", "c", "d", "e"} {
+		publishText(s, "slack", "ops", text)
+	}
+
+	decoder := subscribeStream(t, s, protocol.Request{
+		Action:     protocol.ActionSubscribe,
+		Service:    "slack",
+		Bot:        "ops",
+		SinceID:    1,
+		ReplayRate: 40,
+	})
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		nextEvent(t, decoder)
+	}
+	if elapsed := time.Since(start); elapsed < 75*time.Millisecond {
+		t.Fatalf("4 events at 40/s replayed in %s; expected pacing", elapsed)
+	}
+	if marker := nextEvent(t, decoder); marker.Kind != protocol.KindReplayDone || marker.Text != "replayed 4 events" {
+		t.Fatalf("unexpected marker: %+v", marker)
+	}
+}
+
+func TestHandleSubscribe_Where(t *testing.T) {
+	s := newReplayServer(t)
+	s.cfg.Lists = map[string][]string{"alerting": {"slack"}}
+
+	publishText(s, "slack", "ops", "start")
+	publishText(s, "slack", "ops", "disk error")
+	publishText(s, "discord", "ops", "another error")
+	publishText(s, "slack", "ops", "all good")
+
+	decoder := subscribeStream(t, s, protocol.Request{
+		Action:  protocol.ActionSubscribe,
+		SinceID: 1,
+		Where:   `text matches "error" && service in alerting`,
+	})
+
+	if ev := nextEvent(t, decoder); ev.Text != "disk error" {
+		t.Fatalf("expected replayed match, got %+v", ev)
+	}
+	if marker := nextEvent(t, decoder); marker.Kind != protocol.KindReplayDone || marker.Text != "replayed 1 events" {
+		t.Fatalf("unexpected marker: %+v", marker)
+	}
+
+	publishText(s, "discord", "ops", "live error")
+	publishText(s, "slack", "ops", "live ok")
+	publishText(s, "slack", "ops", "live error")
+	if ev := nextEvent(t, decoder); ev.Text != "live error" || ev.Service != "slack" {
+		t.Fatalf("expected live match, got %+v", ev)
+	}
+}
+
+func TestHandleSubscribe_InvalidWhere(t *testing.T) {
+	s := newReplayServer(t)
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+	go s.handleSubscribe(context.Background(), protocol.Request{
+		Action: protocol.ActionSubscribe,
+		Where:  "text +",
+	}, json.NewEncoder(serverConn))
+
+	_ = clientConn.SetDeadline(time.Now().Add(5 * time.Second))
+	var resp protocol.Response
+	if err := json.NewDecoder(clientConn).Decode(&resp); err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	if resp.OK || resp.Error == "" {
+		t.Fatalf("expected subscribe to fail, got %+v", resp)
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// threadOnto points a send with ReplyTo at the stored event it answers:
+// the event's bot and conversation unless the request names them, and
+// its thread, or one started from the message where the service has
+// threads. Services without threads get the reply in the conversation.
+func (s *Server) threadOnto(req *protocol.Request) error {
+	event, err := s.storedEvent(req.ReplyTo)
+	if err != nil {
+		return err
+	}
+
+	// A bot named without a service is the event's when the names match.
+	named := strings.TrimSpace(req.Bot)
+	if named == "" || named == event.Bot && strings.TrimSpace(req.Service) == "" {
+		req.Service, req.Bot = event.Service, event.Bot
+	} else {
+		service, bot, err := s.resolveBotService(req.Service, req.Bot)
+		if err != nil {
+			return err
+		}
+		if service != event.Service || bot != event.Bot {
+			return invalidRequest("event %d belongs to %s/%s, not %s/%s", event.ID, event.Service, event.Bot, service, bot)
+		}
+		req.Service, req.Bot = service, bot
+	}
+
+	if strings.TrimSpace(req.Target) == "" && strings.TrimSpace(req.Channel) == "" {
+		// Connectors set Target to the canonical reply address.
+		req.Target = event.Target
+		if req.Target == "" {
+			req.Channel = event.Channel
+		}
+	}
+
+	caps, _ := s.botCapabilities(botKey(req.Service, req.Bot))
+	if !caps.Threads {
+		req.Thread = ""
+		return nil
+	}
+	if strings.TrimSpace(req.Thread) == "" {
+		req.Thread = event.Thread
+		if req.Thread == "" {
+			req.Thread = event.MessageID
+		}
+	}
+	return nil
+}
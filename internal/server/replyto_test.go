@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+func TestSend_ReplyTo(t *testing.T) {
+	s := newReplayServer(t)
+	s.connectors["slack:ops"] = upstream.NewMockConnector("slack", "ops", s.publish)
+
+	s.publish(protocol.Event{Service: "slack", Bot: "ops", Kind: "message", Direction: "in", Channel: "C1", MessageID: "M1", Text: "is the build green?"})
+	s.publish(protocol.Event{Service: "slack", Bot: "ops", Kind: "message", Direction: "in", Channel: "C1", Thread: "T9", MessageID: "M2", Text: "and the deploy?"})
+	events, err := s.notifications.ListEvents(store.EventFilter{Bot: "ops", Limit: 10})
+	if err != nil || len(events) != 2 {
+		t.Fatalf("list events: %+v, %v", events, err)
+	}
+	ids := map[string]int64{}
+	for _, event := range events {
+		ids[event.MessageID] = event.ID
+	}
+
+	// A top-level message gets a thread of its own; the bot and channel
+	// come from the event.
+	resp := s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionSend, ReplyTo: ids["M1"], Text: "green"})
+	if !resp.OK || resp.Event == nil || resp.Event.Bot != "ops" || resp.Event.Channel != "C1" || resp.Event.Thread != "M1" {
+		t.Fatalf("expected a reply in a thread on M1, got %+v", resp)
+	}
+
+	// A message in a thread is answered there.
+	resp = s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionSend, Bot: "ops", ReplyTo: ids["M2"], Text: "deploying"})
+	if !resp.OK || resp.Event == nil || resp.Event.Thread != "T9" {
+		t.Fatalf("expected a reply in thread T9, got %+v", resp)
+	}
+
+	resp = s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionSend, Service: "slack", Bot: "other", ReplyTo: ids["M1"], Text: "green"})
+	if resp.OK || resp.Code != protocol.CodeInvalidRequest {
+		t.Fatalf("expected a reply from another bot to be refused, got %+v", resp)
+	}
+	resp = s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionSend, ReplyTo: 999, Text: "green"})
+	if resp.OK || resp.Code != protocol.CodeNotFound {
+		t.Fatalf("expected an unknown event to be refused, got %+v", resp)
+	}
+}
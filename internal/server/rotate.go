@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+// rotateTimeout bounds checking a new bot token with the platform.
+const rotateTimeout = 30 * time.Second
+
+// tokenRotation is a new bot_token a reload hands to a running connector.
+type tokenRotation struct {
+	key     string
+	rotator upstream.TokenRotator
+	prev    string // resolved tokens
+	next    string
+}
+
+// planRotation works out whether the running connector of prev can take
+// next's bot_token instead of being restarted: the token is all that
+// changed and the connector can switch. It reports false when the bot
+// needs a restart instead.
+func planRotation(connector upstream.Connector, prev config.BotConfig, next config.BotConfig) (tokenRotation, bool, error) {
+	if prev.BotToken == next.BotToken {
+		return tokenRotation{}, false, nil
+	}
+	rotator, ok := connector.(upstream.TokenRotator)
+	if !ok {
+		return tokenRotation{}, false, nil
+	}
+	changed := prev
+	changed.BotToken = next.BotToken
+	if botChanged(changed, next) {
+		return tokenRotation{}, false, nil
+	}
+
+	key := botKey(next.Type, next.Name)
+	rotation := tokenRotation{key: key, rotator: rotator}
+	var err error
+	if rotation.next, err = config.ResolveCredential(next.BotToken); err != nil {
+		return tokenRotation{}, false, fmt.Errorf("resolve bot_token for %s: %w", key, err)
+	}
+	if rotation.prev, err = config.ResolveCredential(prev.BotToken); err != nil {
+		return tokenRotation{}, false, fmt.Errorf("resolve previous bot_token for %s: %w", key, err)
+	}
+	return rotation, true, nil
+}
+
+// rotateTokens hands the new tokens to their connectors. It runs once
+// nothing else can fail the reload; when a connector refuses its token,
+// the ones already rotated go back to their old token and the reload
+// fails, leaving every bot as it was.
+func (s *Server) rotateTokens(rotations []tokenRotation) error {
+	parent := s.rootCtx
+	if parent == nil {
+		parent = context.Background()
+	}
+	rotate := func(rotator upstream.TokenRotator, token string) error {
+		ctx, cancel := context.WithTimeout(parent, rotateTimeout)
+		defer cancel()
+		return rotator.RotateToken(ctx, token)
+	}
+
+	for i, rotation := range rotations {
+		if err := rotate(rotation.rotator, rotation.next); err != nil {
+			for _, done := range rotations[:i] {
+				if err := rotate(done.rotator, done.prev); err != nil {
+					log.Printf("[%s] restore previous bot_token: %v", done.key, err)
+				}
+			}
+			return fmt.Errorf("rotate bot_token for %s: %w", rotation.key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+// rotatingConnector records the tokens handed to it.
+type rotatingConnector struct {
+	upstream.Connector
+	tokens []string
+	err    error
+}
+
+func (c *rotatingConnector) RotateToken(_ context.Context, token string) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.tokens = append(c.tokens, token)
+	return nil
+}
+
+// startRotatable starts bot and wraps its connector in a rotatingConnector.
+func startRotatable(t *testing.T, bot config.BotConfig) (*Server, *rotatingConnector) {
+	t.Helper()
+	s, rotators := startRotatables(t, bot)
+	return s, rotators[0]
+}
+
+// startRotatables starts bots and wraps their connectors in
+// rotatingConnectors, in the same order.
+func startRotatables(t *testing.T, bots ...config.BotConfig) (*Server, []*rotatingConnector) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	cfg := config.Config{Bots: bots}
+	s := New(cfg, "", "", "")
+	s.rootCtx = ctx
+	if err := s.startConnectors(cfg); err != nil {
+		t.Fatalf("start connectors: %v", err)
+	}
+
+	// The running connector goroutines still read the old map.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connectors = maps.Clone(s.connectors)
+	rotators := make([]*rotatingConnector, 0, len(bots))
+	for _, bot := range bots {
+		key := botKey(bot.Type, bot.Name)
+		rotator := &rotatingConnector{Connector: s.connectors[key]}
+		s.connectors[key] = rotator
+		rotators = append(rotators, rotator)
+	}
+	return s, rotators
+}
+
+func TestStartConnectors_RotatesTokenInPlace(t *testing.T) {
+	bot := mockBot("a", "mock://a")
+	bot.BotToken = "old-token"
+	s, rotator := startRotatable(t, bot)
+
+	t.Setenv("PANTALK_TEST_ROTATED", "new-token")
+	bot.BotToken = "$PANTALK_TEST_ROTATED"
+	if err := s.startConnectors(config.Config{Bots: []config.BotConfig{bot}}); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	s.mu.RLock()
+	connector := s.connectors["custom:a"]
+	s.mu.RUnlock()
+	if connector != rotator {
+		t.Fatal("expected the running connector to be kept")
+	}
+	if len(rotator.tokens) != 1 || rotator.tokens[0] != "new-token" {
+		t.Fatalf("expected the resolved token handed over, got %v", rotator.tokens)
+	}
+}
+
+func TestStartConnectors_RotationRejected(t *testing.T) {
+	bot := mockBot("a", "mock://a")
+	bot.BotToken = "old-token"
+	s, rotator := startRotatable(t, bot)
+	rotator.err = errors.New("invalid_auth")
+
+	next := bot
+	next.BotToken = "bad-token"
+	err := s.startConnectors(config.Config{Bots: []config.BotConfig{next}})
+	if err == nil || !strings.Contains(err.Error(), "invalid_auth") {
+		t.Fatalf("expected the rejection reported, got %v", err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.connectors["custom:a"] != rotator || s.cfg.Bots[0].BotToken != "old-token" {
+		t.Fatal("expected the bot left on its old token")
+	}
+}
+
+func TestStartConnectors_TokenAndOtherChangesRestart(t *testing.T) {
+	bot := mockBot("a", "mock://a")
+	bot.BotToken = "old-token"
+	s, rotator := startRotatable(t, bot)
+
+	bot.BotToken = "new-token"
+	bot.Endpoint = "mock://a2"
+	if err := s.startConnectors(config.Config{Bots: []config.BotConfig{bot}}); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.connectors["custom:a"] == rotator || len(rotator.tokens) != 0 {
+		t.Fatal("expected the connector restarted rather than rotated")
+	}
+}
+
+func TestStartConnectors_FailedReloadKeepsToken(t *testing.T) {
+	bot := mockBot("a", "mock://a")
+	bot.BotToken = "old-token"
+	s, rotator := startRotatable(t, bot)
+
+	next := bot
+	next.BotToken = "new-token"
+	broken := mockBot("b", "mock://b")
+	broken.NotifyOn = []config.NotifyRule{{Match: "("}}
+	if err := s.startConnectors(config.Config{Bots: []config.BotConfig{next, broken}}); err == nil {
+		t.Fatal("expected the reload to fail")
+	}
+	if len(rotator.tokens) != 0 {
+		t.Fatalf("expected no token handed over by a failed reload, got %v", rotator.tokens)
+	}
+}
+
+func TestStartConnectors_RotationRejectedRestoresOthers(t *testing.T) {
+	a, b := mockBot("a", "mock://a"), mockBot("b", "mock://b")
+	a.BotToken, b.BotToken = "old-a", "old-b"
+	s, rotators := startRotatables(t, a, b)
+	rotators[1].err = errors.New("invalid_auth")
+
+	a.BotToken, b.BotToken = "new-a", "new-b"
+	err := s.startConnectors(config.Config{Bots: []config.BotConfig{a, b}})
+	if err == nil || !strings.Contains(err.Error(), "invalid_auth") {
+		t.Fatalf("expected the rejection reported, got %v", err)
+	}
+	if got := strings.Join(rotators[0].tokens, ","); got != "new-a,old-a" {
+		t.Fatalf("expected a's token rotated and then restored, got %s", got)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.cfg.Bots[0].BotToken != "old-a" || s.cfg.Bots[1].BotToken != "old-b" {
+		t.Fatal("expected the old config kept")
+	}
+}
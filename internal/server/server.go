@@ -5,46 +5,105 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"reflect"
+	"runtime/pprof"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/pantalk/pantalk/internal/agent"
+	"github.com/pantalk/pantalk/internal/autoreply"
+	"github.com/pantalk/pantalk/internal/classify"
 	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/formatting"
+	"github.com/pantalk/pantalk/internal/ntfy"
 	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/quiet"
+	"github.com/pantalk/pantalk/internal/redact"
 	"github.com/pantalk/pantalk/internal/store"
+	"github.com/pantalk/pantalk/internal/trace"
+	"github.com/pantalk/pantalk/internal/translate"
+	"github.com/pantalk/pantalk/internal/unfurl"
 	"github.com/pantalk/pantalk/internal/upstream"
 )
 
 type Server struct {
-	cfg      config.Config
-	listener net.Listener
-	cfgPath  string
+	cfg          config.Config
+	listener     net.Listener
+	httpListener net.Listener
+	cfgPath      string
 
 	socketOverride string
 	dbOverride     string
-	debug          bool
+	debug          atomic.Bool // debug logging for every connector
 	allowExec      bool
+	takeover       bool
 
 	startedAt time.Time
 
-	rootCtx       context.Context
-	runtimeCancel context.CancelFunc
-
-	mu            sync.RWMutex
-	bots          map[string]protocol.BotRef
-	subsByBot     map[string]map[chan protocol.Event]struct{}
-	routesByBot   map[string]map[string]struct{}
-	connectors    map[string]upstream.Connector
-	notifications *store.Store
-	agents        []*agent.Runner
-	tickStop      chan struct{} // closed to stop the clock ticker
+	rootCtx  context.Context
+	reloadMu sync.Mutex // serialises reloads from the socket, SIGHUP and the watcher
+
+	handoff        *handoffState  // set while handing over to a successor; guarded by mu
+	streams        sync.WaitGroup // open subscriptions
+	streamsEnding  chan struct{}  // closed to end subscriptions for a handoff
+	endStreamsOnce sync.Once
+
+	debugMu   sync.Mutex
+	debugBots map[string]bool // connectors with debug logging turned on at runtime
+
+	traceMu     sync.Mutex
+	tracedSends map[string][]*tracedSend // connector calls of traced sends in flight, per bot
+
+	logs *logTail // recent log lines for the logs action
+
+	storeProbe func(time.Duration) // set by Bench to time each event write
+
+	mu               sync.RWMutex
+	bots             map[string]protocol.BotRef
+	subsByBot        map[string]map[*subscriber]struct{}
+	droppedEvents    int64 // live events publish couldn't queue for a subscriber
+	routesByBot      map[string]map[string]struct{}
+	connectors       map[string]upstream.Connector
+	redactors        map[string]*redact.Redactor // per-bot; nil when redaction is off
+	responders       map[string]*autoreply.Responder
+	keywords         map[string][]keywordRule           // notify_on rules per bot
+	ignores          map[string]*ignoreRule             // ignore_users and ignore_patterns per bot
+	quietHours       map[string]*quiet.Hours            // per bot; nil without quiet hours
+	mutes            map[string]protocol.Mute           // muted channels keyed by bot+channel
+	digests          map[string]digestRule              // bots whose pushes are batched
+	digestBatches    map[string]*digestBatch            // open digest windows keyed by bot+channel
+	clockQuiet       *quiet.Hours                       // top-level quiet hours, which pause agent ticks
+	ntfy             *ntfy.Publisher                    // nil when ntfy forwarding is off
+	classifier       *classify.Classifier               // nil when notifications aren't classified
+	translator       *translate.Translator              // nil when translation is off
+	translateTo      map[string]*config.TranslateConfig // bots whose inbound messages are translated
+	unfurler         *unfurl.Unfurler                   // nil when links aren't unfurled
+	tracing          tracing                            // trace export and slow request logging
+	middleware       []*middleware                      // what inbound events pass through in publish
+	alerts           *alertTarget                       // nil when connection alerts are off
+	connWatch        connWatch
+	notifyWindows    map[string]notifyWindow    // cool-down state keyed by bot+channel+thread+user
+	threadWindows    map[string]time.Duration   // bots that group messages into synthetic threads
+	syntheticThreads map[string]syntheticThread // open synthetic threads keyed by bot+conversation
+	notifications    *store.Store
+	recent           *recentEvents // newest events per bot; nil serves history from the store
+	agents           []*agent.Runner
+	gates            map[string]*sendGate          // admits sends and reactions per connector
+	cancels          map[string]context.CancelFunc // stops each running connector
+	tickStop         chan struct{}                 // closed to stop the clock ticker
 }
 
 func New(cfg config.Config, cfgPath string, socketOverride string, dbOverride string) *Server {
@@ -54,15 +113,17 @@ func New(cfg config.Config, cfgPath string, socketOverride string, dbOverride st
 		socketOverride: socketOverride,
 		dbOverride:     dbOverride,
 		bots:           make(map[string]protocol.BotRef),
-		subsByBot:      make(map[string]map[chan protocol.Event]struct{}),
+		subsByBot:      make(map[string]map[*subscriber]struct{}),
 		routesByBot:    make(map[string]map[string]struct{}),
 		connectors:     make(map[string]upstream.Connector),
+		streamsEnding:  make(chan struct{}),
+		logs:           newLogTail(),
 	}
 }
 
 // SetDebug enables verbose debug logging.
 func (s *Server) SetDebug(enabled bool) {
-	s.debug = enabled
+	s.debug.Store(enabled)
 }
 
 // SetAllowExec permits agent commands outside the default allowlist.
@@ -73,9 +134,33 @@ func (s *Server) SetAllowExec(enabled bool) {
 func (s *Server) Run() error {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
-	s.rootCtx = ctx
+
+	// Connectors and client connections run under serveCtx rather than the
+	// signal context so a shutdown can drain in-flight sends before
+	// cancelling them.
+	serveCtx, stopServing := context.WithCancel(context.Background())
+	defer stopServing()
+	s.rootCtx = serveCtx
 	s.startedAt = time.Now()
 
+	if s.logs != nil {
+		output := log.Writer()
+		log.SetOutput(io.MultiWriter(output, s.logs))
+		defer log.SetOutput(output)
+	}
+
+	// A successor takes the sockets first; the old daemon keeps the
+	// database and connectors until it has drained.
+	var previous *inherited
+	if s.takeover {
+		var err error
+		if previous, err = takeOver(s.cfg.Server.SocketPath); err != nil {
+			return fmt.Errorf("take over from running daemon: %w", err)
+		}
+		log.Printf("took over %s; waiting for the previous daemon to drain", s.cfg.Server.SocketPath)
+		previous.waitReleased()
+	}
+
 	log.Printf("opening database at %s", s.cfg.Server.DBPath)
 
 	notificationStore, err := store.Open(s.cfg.Server.DBPath)
@@ -84,21 +169,17 @@ func (s *Server) Run() error {
 	}
 	defer notificationStore.Close()
 	s.notifications = notificationStore
-
-	if err := os.RemoveAll(s.cfg.Server.SocketPath); err != nil {
-		return fmt.Errorf("remove stale socket: %w", err)
+	s.recent = newRecentEvents(s.cfg.Server.HistorySize)
+	if err := s.loadMutes(); err != nil {
+		return err
 	}
 
-	listener, err := net.Listen("unix", s.cfg.Server.SocketPath)
+	listener, err := s.listen(previous)
 	if err != nil {
-		return fmt.Errorf("listen on socket %s: %w", s.cfg.Server.SocketPath, err)
+		return err
 	}
 	defer listener.Close()
 
-	if err := os.Chmod(s.cfg.Server.SocketPath, 0600); err != nil {
-		return fmt.Errorf("chmod socket: %w", err)
-	}
-
 	s.listener = listener
 
 	log.Printf("listening on %s", s.cfg.Server.SocketPath)
@@ -107,6 +188,47 @@ func (s *Server) Run() error {
 		return err
 	}
 
+	if addr := strings.TrimSpace(s.cfg.Server.HTTPAddr); addr != "" {
+		token, err := config.ResolveCredential(s.cfg.Server.HTTPToken)
+		if err != nil {
+			return fmt.Errorf("resolve server.http_token: %w", err)
+		}
+		var httpListener net.Listener
+		if previous != nil && previous.http != nil && previous.http.Addr().String() == addr {
+			httpListener, previous.http = previous.http, nil
+		} else if httpListener, err = net.Listen("tcp", addr); err != nil {
+			return fmt.Errorf("listen on http_addr %s: %w", addr, err)
+		}
+		s.mu.Lock()
+		s.httpListener = httpListener
+		s.mu.Unlock()
+		if cert := s.cfg.Server.HTTPTLSCert; cert != "" {
+			go s.serveHTTPS(serveCtx, httpListener, token, cert, s.cfg.Server.HTTPTLSKey)
+		} else {
+			go s.serveHTTP(serveCtx, httpListener, token)
+		}
+		log.Printf("http api listening on %s", httpListener.Addr())
+	}
+
+	if previous != nil && previous.http != nil {
+		// http_addr changed or was removed along with the upgrade.
+		_ = previous.http.Close()
+	}
+
+	// The debug listener is only for diagnostics, so failing to bind it
+	// doesn't stop the daemon.
+	if addr := strings.TrimSpace(s.cfg.Server.DebugAddr); addr != "" {
+		if debugListener, err := net.Listen("tcp", addr); err != nil {
+			log.Printf("warning: debug listener disabled: listen on debug_addr %s: %v", addr, err)
+		} else {
+			go s.serveDebugHTTP(serveCtx, debugListener)
+			log.Printf("debug listener on %s", debugListener.Addr())
+		}
+	}
+
+	go s.runSnoozeWaker(serveCtx)
+	go s.runDigestFlusher(serveCtx)
+
 	log.Printf("pantalkd ready (%d bot(s) configured)", len(s.cfg.Bots))
 
 	go func() {
@@ -115,30 +237,158 @@ func (s *Server) Run() error {
 		_ = s.listener.Close()
 	}()
 
-	if s.debug {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				s.triggerReload("SIGHUP")
+			}
+		}
+	}()
+
+	if s.cfg.Server.WatchConfig {
+		if strings.TrimSpace(s.cfgPath) == "" {
+			log.Printf("warning: watch_config ignored: daemon has no --config path")
+		} else {
+			go s.watchConfig(ctx)
+		}
+	}
+
+	if s.debug.Load() {
 		log.Printf("debug mode enabled")
 	}
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			if errors.Is(err, net.ErrClosed) {
-				return nil
-			}
-			if ctx.Err() != nil {
+			if errors.Is(err, net.ErrClosed) || ctx.Err() != nil {
+				s.drainConnectors()
+				if handoff := s.handingOff(); handoff != nil {
+					s.release(handoff, stopServing, notificationStore)
+				}
 				return nil
 			}
 			continue
 		}
 
-		go s.handleConn(ctx, conn)
+		go s.handleConn(serveCtx, conn)
 	}
 }
 
+// listen returns the unix socket to serve: the one inherited from a
+// previous daemon, one passed by systemd socket activation, or a fresh one
+// at the configured path.
+func (s *Server) listen(previous *inherited) (net.Listener, error) {
+	if previous != nil {
+		return previous.listener, nil
+	}
+
+	listener, err := activatedListener()
+	if err != nil {
+		return nil, err
+	}
+	if listener != nil {
+		log.Printf("using socket passed by systemd")
+		return listener, nil
+	}
+
+	if err := os.RemoveAll(s.cfg.Server.SocketPath); err != nil {
+		return nil, fmt.Errorf("remove stale socket: %w", err)
+	}
+
+	listener, err = net.Listen("unix", s.cfg.Server.SocketPath)
+	if err != nil {
+		return nil, fmt.Errorf("listen on socket %s: %w", s.cfg.Server.SocketPath, err)
+	}
+
+	if err := os.Chmod(s.cfg.Server.SocketPath, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("chmod socket: %w", err)
+	}
+	return listener, nil
+}
+
 func (s *Server) startConnectors(cfg config.Config) error {
 	bots := make(map[string]protocol.BotRef)
 	connectors := make(map[string]upstream.Connector)
+	redactors := make(map[string]*redact.Redactor)
+	responders := make(map[string]*autoreply.Responder)
+	keywords := make(map[string][]keywordRule)
+	ignores := make(map[string]*ignoreRule)
+	quietHours := make(map[string]*quiet.Hours)
+	digests := make(map[string]digestRule)
+	threadWindows := make(map[string]time.Duration)
+	translateTo := make(map[string]*config.TranslateConfig)
+	gates := make(map[string]*sendGate)
+	cancels := make(map[string]context.CancelFunc)
+
+	redactor, err := redact.New(cfg.RedactRules())
+	if err != nil {
+		return fmt.Errorf("compile redact rules: %w", err)
+	}
+
+	clockQuiet, err := cfg.QuietHours.Hours()
+	if err != nil {
+		return fmt.Errorf("quiet_hours: %w", err)
+	}
 
+	publisher, err := newPublisher(cfg)
+	if err != nil {
+		return fmt.Errorf("configure ntfy: %w", err)
+	}
+
+	transcribeFunc, err := newTranscribeFunc(cfg)
+	if err != nil {
+		return fmt.Errorf("configure transcription: %w", err)
+	}
+
+	classifier, err := newClassifier(cfg)
+	if err != nil {
+		return fmt.Errorf("configure classifier: %w", err)
+	}
+
+	translator, err := newTranslator(cfg)
+	if err != nil {
+		return fmt.Errorf("configure translation: %w", err)
+	}
+
+	unfurler, err := newUnfurler(cfg)
+	if err != nil {
+		return fmt.Errorf("configure unfurl: %w", err)
+	}
+
+	tracer, err := newTracing(cfg)
+	if err != nil {
+		return fmt.Errorf("configure tracing: %w", err)
+	}
+
+	// Connectors whose bot config is unchanged keep running across a reload
+	// so the other bots don't drop their sessions.
+	s.mu.RLock()
+	prevBots := make(map[string]config.BotConfig, len(s.cfg.Bots))
+	for _, bot := range s.cfg.Bots {
+		prevBots[botKey(bot.Type, bot.Name)] = bot
+	}
+	prevConnectors := s.connectors
+	prevGates := s.gates
+	prevCancels := s.cancels
+	s.mu.RUnlock()
+
+	// Reused connectors keep the supervisor they were started with.
+	var supervision upstream.SupervisorConfig
+	if ac := cfg.ConnectionAlerts; ac != nil {
+		supervision.DownAlertAfter = time.Duration(ac.DownAfter) * time.Second
+	}
+	supervisors := make(map[string]*upstream.Supervisor)
+
+	var fresh []string
+	// Token rotations wait until nothing else can fail the reload.
+	var rotations []tokenRotation
 	for _, bot := range cfg.Bots {
 		key := botKey(bot.Type, bot.Name)
 
@@ -151,25 +401,111 @@ func (s *Server) startConnectors(cfg config.Config) error {
 			Service:     bot.Type,
 			Name:        bot.Name,
 			DisplayName: displayName,
+			Aliases:     bot.Aliases,
 		}
 		bots[key] = botRef
 
-		connector, err := upstream.NewConnector(bot, func(event protocol.Event) {
+		if bot.RedactEnabled() {
+			redactors[key] = redactor
+		}
+
+		responder, err := autoreply.New(bot.AutoReplyRules())
+		if err != nil {
+			return fmt.Errorf("compile auto_reply for %s: %w", key, err)
+		}
+		if responder != nil {
+			// Carry the cool-downs over, so a reload doesn't answer users
+			// again.
+			responder.Inherit(s.responder(key))
+			responders[key] = responder
+		}
+
+		if len(bot.NotifyOn) > 0 {
+			rules, err := compileKeywords(bot.NotifyOn)
+			if err != nil {
+				return fmt.Errorf("compile notify_on for %s: %w", key, err)
+			}
+			keywords[key] = rules
+		}
+
+		ignore, err := compileIgnore(bot)
+		if err != nil {
+			return fmt.Errorf("compile ignore filters for %s: %w", key, err)
+		}
+		if ignore != nil {
+			ignores[key] = ignore
+		}
+
+		hours, err := cfg.QuietHoursFor(bot).Hours()
+		if err != nil {
+			return fmt.Errorf("quiet_hours for %s: %w", key, err)
+		}
+		if hours != nil {
+			quietHours[key] = hours
+		}
+
+		if rule, ok := newDigestRule(bot.Digest); ok {
+			digests[key] = rule
+		}
+		if bot.ThreadWindow > 0 {
+			threadWindows[key] = time.Duration(bot.ThreadWindow) * time.Second
+		}
+		if bot.Translate != nil {
+			translateTo[key] = bot.Translate
+		}
+
+		if prev, ok := prevBots[key]; ok && prevConnectors[key] != nil {
+			// A new bot_token alone is handed to the running connector
+			// when it can take it.
+			reuse := !botChanged(prev, bot)
+			if !reuse {
+				rotation, ok, err := planRotation(prevConnectors[key], prev, bot)
+				if err != nil {
+					return err
+				}
+				if ok {
+					rotations = append(rotations, rotation)
+				}
+				reuse = ok
+			}
+			if reuse {
+				connectors[key] = prevConnectors[key]
+				gates[key] = prevGates[key]
+				cancels[key] = prevCancels[key]
+				continue
+			}
+		}
+
+		supervisor := upstream.NewSupervisor(supervision, func(event protocol.Event) {
 			event.Service = bot.Type
 			event.Bot = bot.Name
 			s.publish(event)
 		})
+		connector, err := upstream.NewConnector(bot, supervisor.Publish)
 		if err != nil {
 			return fmt.Errorf("create connector for %s: %w", key, err)
 		}
+		if home, ok := connector.(upstream.HomePublisher); ok {
+			home.SetHomeFunc(s.homeFunc(bot.Type, bot.Name))
+		}
+		if receiver, ok := connector.(upstream.ActionReceiver); ok {
+			if url, secret, ok := actionEndpoint(cfg, bot); ok {
+				receiver.SetActionEndpoint(url, secret)
+			}
+		}
+		if receiver, ok := connector.(upstream.WebhookReceiver); ok && bot.Transport == config.TransportWebhook {
+			if url, secret, ok := webhookEndpoint(cfg, bot); ok {
+				receiver.SetWebhookEndpoint(url, secret)
+			}
+		}
 
 		connectors[key] = connector
+		supervisors[key] = supervisor
+		fresh = append(fresh, key)
 
 		log.Printf("bot %s (%s) registered", bot.Name, bot.Type)
 	}
 
-	runtimeCtx, runtimeCancel := context.WithCancel(s.rootCtx)
-
 	// Build agent runners from config.
 	var runners []*agent.Runner
 	for _, acfg := range cfg.Agents {
@@ -181,24 +517,93 @@ func (s *Server) startConnectors(cfg config.Config) error {
 			Buffer:   acfg.Buffer,
 			Timeout:  acfg.Timeout,
 			Cooldown: acfg.Cooldown,
+
+			EventsFile: acfg.EventsFile,
+			Stdin:      acfg.Stdin,
+			Context:    acfg.Context,
+
+			Reply:         acfg.Reply,
+			ReplyTemplate: acfg.ReplyTemplate,
+			ThreadReplies: acfg.ThreadReplies,
+			MarkRead:      acfg.MarkRead,
+			IncludeSelf:   acfg.IncludeSelf,
+
+			Lists: cfg.Lists,
 		})
 		if err != nil {
-			runtimeCancel()
 			return fmt.Errorf("create agent %q: %w", acfg.Name, err)
 		}
+		r.SetReplyFunc(s.agentReply)
+		r.SetRecordFunc(s.recordAgentRun)
+		r.SetContextFunc(s.conversationContext)
+		r.SetMarkReadFunc(s.agentMarkRead)
 		runners = append(runners, r)
 		log.Printf("agent %s registered", acfg.Name)
 	}
 
+	if err := s.rotateTokens(rotations); err != nil {
+		return err
+	}
+
+	// Connectors that were replaced or removed stop admitting sends and get
+	// to finish the ones in flight before they are cancelled. New sends for
+	// those bots wait for the swap below.
+	var retiring []*sendGate
+	var stops []context.CancelFunc
+	for key, gate := range prevGates {
+		if connectors[key] != nil && connectors[key] == prevConnectors[key] {
+			continue
+		}
+		retiring = append(retiring, gate)
+		if cancel := prevCancels[key]; cancel != nil {
+			stops = append(stops, cancel)
+		}
+	}
+	if !drainGates(retiring, drainTimeout) {
+		log.Printf("warning: in-flight sends still running after %s; restarting connectors anyway", drainTimeout)
+	}
+
+	runtimeCtxs := make(map[string]context.Context, len(fresh))
+	for _, key := range fresh {
+		ctx, cancel := context.WithCancel(s.rootCtx)
+		runtimeCtxs[key] = ctx
+		cancels[key] = cancel
+		gates[key] = newSendGate()
+	}
+
 	s.mu.Lock()
-	oldCancel := s.runtimeCancel
 	oldAgents := s.agents
 	oldTickStop := s.tickStop
 	s.cfg = cfg
 	s.bots = bots
 	s.connectors = connectors
-	s.routesByBot = make(map[string]map[string]struct{})
-	s.runtimeCancel = runtimeCancel
+	s.redactors = redactors
+	s.responders = responders
+	s.keywords = keywords
+	s.ignores = ignores
+	s.quietHours = quietHours
+	s.digests = digests
+	s.threadWindows = threadWindows
+	s.clockQuiet = clockQuiet
+	s.ntfy = publisher
+	s.classifier = classifier
+	s.translator = translator
+	s.translateTo = translateTo
+	s.unfurler = unfurler
+	s.tracing = tracer
+	s.middleware = newMiddleware(cfg, s.middleware)
+	s.alerts = newAlertTarget(cfg)
+	s.gates = gates
+	s.cancels = cancels
+	// Reused connectors keep their thread participation; everything else
+	// starts fresh.
+	routes := make(map[string]map[string]struct{})
+	for key, connector := range connectors {
+		if connector == prevConnectors[key] && s.routesByBot[key] != nil {
+			routes[key] = s.routesByBot[key]
+		}
+	}
+	s.routesByBot = routes
 	s.agents = runners
 	s.tickStop = nil
 	s.mu.Unlock()
@@ -212,13 +617,26 @@ func (s *Server) startConnectors(cfg config.Config) error {
 		close(oldTickStop)
 	}
 
-	if oldCancel != nil {
-		oldCancel()
+	for _, stop := range stops {
+		stop()
 	}
 
-	for key, connector := range connectors {
+	// Reused connectors pick up a changed transcription section too.
+	for _, connector := range connectors {
+		if voice, ok := connector.(upstream.Transcribing); ok {
+			voice.SetTranscribeFunc(transcribeFunc)
+		}
+	}
+
+	for _, key := range fresh {
 		log.Printf("starting connector %s", key)
-		go connector.Run(runtimeCtx)
+		// The label lets /debug/vars count the connector's goroutines.
+		go pprof.Do(runtimeCtxs[key], pprof.Labels("bot", key), func(ctx context.Context) {
+			supervisors[key].Run(ctx, connectors[key])
+		})
+	}
+	for _, gate := range retiring {
+		gate.retire()
 	}
 
 	// Start the 1-minute clock ticker if any agent uses time expressions.
@@ -280,8 +698,13 @@ func (s *Server) dispatchTick() {
 
 	s.mu.RLock()
 	runners := s.agents
+	clockQuiet := s.clockQuiet
 	s.mu.RUnlock()
 
+	if clockQuiet.Active(tick.Timestamp) {
+		return
+	}
+
 	for _, runner := range runners {
 		if runner.Matches(tick) {
 			runner.Handle(tick)
@@ -289,11 +712,38 @@ func (s *Server) dispatchTick() {
 	}
 }
 
+// agentReply posts agent output through the regular send path, so it is
+// formatted, gated and marks participation exactly like pantalk send.
+func (s *Server) agentReply(ctx context.Context, req protocol.Request) error {
+	req.Action = protocol.ActionSend
+	// Triggers from services without threads can still carry a thread ID
+	// (a Matrix reply, say); answer in the conversation instead.
+	if caps, ok := s.botCapabilities(botKey(req.Service, req.Bot)); ok {
+		if !caps.Threads {
+			req.Thread = ""
+		}
+		req.Text = fitSendParts(req.Text, caps.MaxText)
+	}
+	resp := s.handleRequest(ctx, req)
+	if !resp.OK {
+		return errors.New(resp.Error)
+	}
+	return nil
+}
+
 func (s *Server) handleConn(ctx context.Context, conn net.Conn) {
 	defer conn.Close()
 
 	decoder := json.NewDecoder(conn)
-	encoder := json.NewEncoder(conn)
+	writer := &connWriter{enc: json.NewEncoder(conn)}
+
+	// Requests with an ID run concurrently and their responses carry the
+	// ID; requests without one are answered in order, and an untagged
+	// subscribe takes over the connection.
+	ctx, cancel := context.WithCancel(ctx)
+	mux := newConnMux(ctx, writer)
+	defer mux.wait()
+	defer cancel()
 
 	for {
 		var req protocol.Request
@@ -301,83 +751,234 @@ func (s *Server) handleConn(ctx context.Context, conn net.Conn) {
 			return
 		}
 
+		if req.ID != "" {
+			mux.handle(s, req)
+			continue
+		}
+
 		if req.Action == protocol.ActionSubscribe {
-			s.handleSubscribe(ctx, req, encoder)
+			s.handleSubscribe(ctx, req, writer)
+			return
+		}
+		if req.Action == protocol.ActionLogs && req.Follow {
+			s.handleLogs(ctx, req, writer)
+			return
+		}
+		if req.Action == protocol.ActionHandoff {
+			s.handOff(conn, writer)
 			return
 		}
 
 		resp := s.handleRequest(ctx, req)
-		if err := encoder.Encode(resp); err != nil {
+		if err := writer.Encode(resp); err != nil {
 			return
 		}
 	}
 }
 
-func (s *Server) handleSubscribe(ctx context.Context, req protocol.Request, encoder *json.Encoder) {
+func (s *Server) handleSubscribe(ctx context.Context, req protocol.Request, encoder responseEncoder) {
 	selector, err := s.resolveSelector(req.Service, req.Bot)
 	if err != nil {
-		_ = encoder.Encode(protocol.Response{OK: false, Error: err.Error()})
+		_ = encoder.Encode(failed(err))
+		return
+	}
+	if req.Buffer < 0 || req.Buffer > maxSubscriberBuffer {
+		_ = encoder.Encode(protocol.Response{OK: false, Error: fmt.Sprintf("buffer must be between 1 and %d events, or 0 for the default of %d", maxSubscriberBuffer, defaultSubscriberBuffer), Code: protocol.CodeInvalidRequest})
 		return
 	}
+	s.mu.RLock()
+	hasStore := s.notifications != nil
+	s.mu.RUnlock()
+	if req.CatchUp && !hasStore {
+		_ = encoder.Encode(protocol.Response{OK: false, Error: "catch-up needs the event store, which is not open", Code: protocol.CodeInvalidRequest})
+		return
+	}
+	bundleLimit := defaultContextLimit
+	if req.ByConversation && req.Limit != 0 {
+		if req.Limit < 0 || req.Limit > maxContextLimit {
+			_ = encoder.Encode(protocol.Response{OK: false, Error: fmt.Sprintf("limit must be between 1 and %d messages", maxContextLimit), Code: protocol.CodeInvalidRequest})
+			return
+		}
+		bundleLimit = req.Limit
+	}
 
-	channels := s.subscribe(selector)
-	defer s.unsubscribe(selector, channels)
+	var where *agent.Filter
+	if strings.TrimSpace(req.Where) != "" {
+		s.mu.RLock()
+		lists := s.cfg.Lists
+		s.mu.RUnlock()
+
+		where, err = agent.NewFilter(req.Where, lists)
+		if err != nil {
+			_ = encoder.Encode(failed(err))
+			return
+		}
+	}
+
+	// A resumed stream promises no gaps, but a long replay can overflow
+	// the live queue; those subscriptions always catch up.
+	sub := s.subscribe(selector, req.Buffer, req.CatchUp || req.SinceID > 0, req.Notify)
+	defer s.unsubscribe(sub)
+	s.streams.Add(1)
+	defer s.streams.Done()
+
+	// lastSent is where a client resumes after a handoff: the newest event
+	// this subscription has written, or the newest stored one when it
+	// subscribed.
+	var lastSent int64
+	if hasStore && req.SinceID == 0 {
+		lastSent, _ = s.notifications.LastEventID()
+	}
 
 	if err := encoder.Encode(protocol.Response{OK: true, Ack: "subscribed"}); err != nil {
 		return
 	}
+	if req.ByConversation {
+		encoder = s.newBundleEncoder(encoder, bundleLimit)
+	}
 
-	// Fan-in: merge all per-bot channels into a single channel so we can
-	// block cleanly instead of busy-polling.
-	merged := make(chan protocol.Event, 64)
-	var fanInDone sync.WaitGroup
-	fanInDone.Add(len(channels))
-	for _, ch := range channels {
-		go func(src chan protocol.Event) {
-			defer fanInDone.Done()
-			for ev := range src {
-				select {
-				case merged <- ev:
-				case <-ctx.Done():
-					return
-				}
+	// Catch up from the store first. Live events published meanwhile queue
+	// in the subscription and are skipped below if already replayed.
+	var replayedUpTo int64
+	if req.SinceID > 0 {
+		lastID, count, err := s.replay(ctx, req, selector, where, encoder)
+		if err != nil {
+			if ctx.Err() == nil {
+				_ = encoder.Encode(failed(err))
 			}
-		}(ch)
+			return
+		}
+		replayedUpTo = lastID
+		marker := protocol.Event{
+			ID:        lastID,
+			Timestamp: time.Now().UTC(),
+			Kind:      protocol.KindReplayDone,
+			Text:      fmt.Sprintf("replayed %d events", count),
+		}
+		if err := encoder.Encode(protocol.Response{OK: true, Event: &marker}); err != nil {
+			return
+		}
 	}
-	go func() {
-		fanInDone.Wait()
-		close(merged)
-	}()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case ev, ok := <-merged:
+		case <-s.streamsEnding:
+			s.endStream(req, where, sub, encoder, replayedUpTo, max(lastSent, replayedUpTo))
+			return
+		case ev, ok := <-sub.events:
 			if !ok {
 				return
 			}
-			if !matchEventFilters(ev, req.Target, req.Channel, req.Thread, req.Search) {
-				continue
+			if s.wantsLive(req, where, ev, replayedUpTo) {
+				if err := encoder.Encode(protocol.Response{OK: true, Event: &ev}); err != nil {
+					return
+				}
+				lastSent = max(lastSent, ev.ID)
 			}
-			if req.Notify && !ev.Notify {
+		}
+
+		if !sub.catchUp || len(sub.events) > 0 {
+			continue
+		}
+		from, missed := s.resumeLive(sub)
+		if !missed {
+			continue
+		}
+		// The subscriber has read everything queued before it fell behind;
+		// fill the gap from the store at full speed.
+		catchUp := req
+		catchUp.SinceID = max(from, replayedUpTo)
+		catchUp.ReplayRate = 0
+		lastID, count, err := s.replay(ctx, catchUp, selector, where, encoder)
+		if err != nil {
+			if ctx.Err() == nil {
+				_ = encoder.Encode(failed(err))
+			}
+			return
+		}
+		replayedUpTo = max(replayedUpTo, lastID)
+		marker := protocol.Event{
+			ID:        lastID,
+			Timestamp: time.Now().UTC(),
+			Kind:      protocol.KindReplayDone,
+			Text:      fmt.Sprintf("caught up on %d events missed while the subscriber was behind", count),
+		}
+		if err := encoder.Encode(protocol.Response{OK: true, Event: &marker}); err != nil {
+			return
+		}
+	}
+}
+
+// endStream writes what sub has queued, then the handoff event telling the
+// client where to resume on the successor.
+func (s *Server) endStream(req protocol.Request, where *agent.Filter, sub *subscriber, encoder responseEncoder, replayedUpTo int64, resumeAfter int64) {
+	for flushed := false; !flushed; {
+		select {
+		case ev := <-sub.events:
+			if !s.wantsLive(req, where, ev, replayedUpTo) {
 				continue
 			}
 			if err := encoder.Encode(protocol.Response{OK: true, Event: &ev}); err != nil {
 				return
 			}
+			resumeAfter = max(resumeAfter, ev.ID)
+		default:
+			flushed = true
 		}
 	}
+	// A catch-up subscriber that fell behind resumes from its gap instead.
+	if from, missed := s.resumeLive(sub); missed {
+		resumeAfter = max(from, replayedUpTo)
+	}
+
+	marker := protocol.Event{
+		ID:        resumeAfter,
+		Timestamp: time.Now().UTC(),
+		Kind:      protocol.KindHandoff,
+		Text:      "pantalkd is restarting; subscribe again with since to resume",
+	}
+	_ = encoder.Encode(protocol.Response{OK: true, Event: &marker})
 }
 
-func (s *Server) handleRequest(ctx context.Context, req protocol.Request) protocol.Response {
+// wantsLive reports whether a live event passes a subscribe request's
+// filters and wasn't already sent by a replay.
+func (s *Server) wantsLive(req protocol.Request, where *agent.Filter, ev protocol.Event, replayedUpTo int64) bool {
+	if ev.ID > 0 && ev.ID <= replayedUpTo {
+		return false
+	}
+	if !matchEventFilters(ev, req.Target, req.Channel, req.Thread, req.Search) {
+		return false
+	}
+	if req.Notify && !ev.Notify {
+		return false
+	}
+	return where == nil || where.Match(ev)
+}
+
+// dispatch answers a request; handleRequest wraps it in a trace span.
+func (s *Server) dispatch(ctx context.Context, req protocol.Request) protocol.Response {
 	switch req.Action {
+	case protocol.ActionHello:
+		return hello(req)
+	case protocol.ActionUnsubscribe:
+		return protocol.Response{OK: false, Error: "unsubscribe needs the id of a subscription on this connection", Code: protocol.CodeInvalidRequest}
+	case protocol.ActionHandoff:
+		return protocol.Response{OK: false, Error: "handoff must be an untagged request on the daemon's socket", Code: protocol.CodeInvalidRequest}
 	case protocol.ActionPing:
 		return protocol.Response{OK: true, Ack: "pong"}
+	case protocol.ActionLogs:
+		if req.Follow {
+			return protocol.Response{OK: false, Error: "follow needs the daemon's socket", Code: protocol.CodeInvalidRequest}
+		}
+		return s.recentLogs(req)
+	case protocol.ActionDebug:
+		return s.setDebug(req)
 	case protocol.ActionStatus:
 		return protocol.Response{OK: true, Status: s.daemonStatus()}
 	case protocol.ActionBots:
-		if s.debug {
+		if s.debugging("") {
 			log.Printf("debug: request action=%s service=%q bot=%q", req.Action, req.Service, req.Bot)
 		}
 		bots := s.listBots(req.Service)
@@ -385,108 +986,320 @@ func (s *Server) handleRequest(ctx context.Context, req protocol.Request) protoc
 	case protocol.ActionNotify:
 		events, err := s.listNotifications(req)
 		if err != nil {
-			return protocol.Response{OK: false, Error: err.Error()}
+			return failed(err)
 		}
 		return protocol.Response{OK: true, Events: events}
 	case protocol.ActionClearNotify:
 		cleared, err := s.clearNotifications(req)
 		if err != nil {
-			return protocol.Response{OK: false, Error: err.Error()}
+			return failed(err)
 		}
 		return protocol.Response{OK: true, Cleared: cleared, Ack: fmt.Sprintf("cleared %d notifications", cleared)}
 	case protocol.ActionClearHistory:
 		cleared, err := s.clearHistory(req)
 		if err != nil {
-			return protocol.Response{OK: false, Error: err.Error()}
+			return failed(err)
 		}
 		return protocol.Response{OK: true, Cleared: cleared, Ack: fmt.Sprintf("cleared %d events", cleared)}
 	case protocol.ActionHistory:
-		notifyOnly := req.Notify
-		events, err := s.readEvents(req.Service, req.Bot, req.Limit, req.SinceID, req.Target, req.Channel, req.Thread, req.Search, notifyOnly)
+		if err := checkDirection(req.Direction); err != nil {
+			return failed(err)
+		}
+		events, err := s.readEvents(store.EventFilter{
+			Service:    req.Service,
+			Bot:        req.Bot,
+			Target:     req.Target,
+			Channel:    req.Channel,
+			Thread:     req.Thread,
+			Search:     req.Search,
+			Direction:  req.Direction,
+			Kind:       req.Kind,
+			Limit:      req.Limit,
+			SinceID:    req.SinceID,
+			Forward:    req.Forward,
+			NotifyOnly: req.Notify,
+		})
 		if err != nil {
-			return protocol.Response{OK: false, Error: err.Error()}
+			return failed(err)
 		}
 		return protocol.Response{OK: true, Events: events}
 	case protocol.ActionSend:
-		if strings.TrimSpace(req.Text) == "" {
-			return protocol.Response{OK: false, Error: "text is required"}
-		}
-		if strings.TrimSpace(req.Target) == "" && strings.TrimSpace(req.Channel) == "" && strings.TrimSpace(req.Thread) == "" {
-			return protocol.Response{OK: false, Error: "at least one of target, channel, or thread is required"}
-		}
-
-		if s.debug {
-			log.Printf("debug: send request bot=%q target=%q channel=%q text=%q", req.Bot, req.Target, req.Channel, req.Text)
+		return s.send(ctx, req)
+	case protocol.ActionBroadcast:
+		return s.broadcast(ctx, req)
+	case protocol.ActionReact:
+		emoji := strings.TrimSpace(req.Emoji)
+		if emoji == "" {
+			return protocol.Response{OK: false, Error: "emoji is required", Code: protocol.CodeInvalidRequest}
 		}
 
 		resolvedService, resolvedBot, err := s.resolveBotService(req.Service, req.Bot)
 		if err != nil {
-			return protocol.Response{OK: false, Error: err.Error()}
+			return failed(err)
 		}
 
-		// Auto-resolve channel from thread when only --thread is provided.
-		if strings.TrimSpace(req.Channel) == "" && strings.TrimSpace(req.Target) == "" && strings.TrimSpace(req.Thread) != "" {
-			if s.notifications != nil {
-				if ch, lookupErr := s.notifications.LookupChannelByThread(resolvedService, resolvedBot, req.Thread); lookupErr == nil && ch != "" {
-					req.Channel = ch
-					if s.debug {
-						log.Printf("debug: resolved channel %q from thread %q", ch, req.Thread)
-					}
-				}
-			}
+		key := botKey(resolvedService, resolvedBot)
+		trace.FromContext(ctx).Set("pantalk.key", key)
+		connector, gate, err := s.acquireConnector(ctx, key)
+		if err != nil {
+			return failed(err)
+		}
+		if connector == nil {
+			return failed(unknownBot(resolvedService, resolvedBot))
 		}
+		defer gate.leave()
 
-		key := botKey(resolvedService, resolvedBot)
-		s.mu.RLock()
-		connector, ok := s.connectors[key]
-		s.mu.RUnlock()
-		if !ok {
-			return protocol.Response{OK: false, Error: fmt.Sprintf("unknown bot %q for service %q", resolvedBot, resolvedService)}
+		if !connector.Capabilities().Reactions {
+			return protocol.Response{OK: false, Error: unsupported(resolvedService, resolvedBot, "reactions"), Code: protocol.CodeUnsupported}
+		}
+		callCtx, call := trace.Start(ctx, "connector.react")
+		err = connector.React(callCtx, req)
+		call.Finish(err)
+		if err != nil {
+			return failed(withCode(protocol.CodeUpstream, err))
 		}
 
-		s.markParticipation(key, req.Target, req.Channel, req.Thread)
+		return protocol.Response{OK: true, Ack: "reacted"}
+	case protocol.ActionReload:
+		if err := s.reloadConfig(); err != nil {
+			return failed(err)
+		}
+		return protocol.Response{OK: true, Ack: "reloaded config and services"}
+	case protocol.ActionExamples:
+		examples, err := s.examples(req.Command)
+		if err != nil {
+			return failed(err)
+		}
+		return protocol.Response{OK: true, Examples: examples}
+	case protocol.ActionAgents:
+		return protocol.Response{OK: true, Agents: s.agentInfos(true)}
+	case protocol.ActionAgentRuns:
+		runs, err := s.agentRuns(req)
+		if err != nil {
+			return failed(err)
+		}
+		return protocol.Response{OK: true, Runs: runs}
+	case protocol.ActionRunAgent:
+		ack, event, err := s.runAgent(req)
+		if err != nil {
+			return failed(err)
+		}
+		return protocol.Response{OK: true, Ack: ack, Event: event}
+	case protocol.ActionTestAgent:
+		test, err := s.testAgent(req)
+		if err != nil {
+			return failed(err)
+		}
+		return protocol.Response{OK: true, Test: test}
+	case protocol.ActionMarkRead:
+		if err := s.markRead(ctx, req); err != nil {
+			return failed(err)
+		}
+		return protocol.Response{OK: true, Ack: "marked read"}
+	case protocol.ActionPresence:
+		if err := s.setPresence(ctx, req); err != nil {
+			return failed(err)
+		}
+		return protocol.Response{OK: true, Ack: "presence updated"}
+	case protocol.ActionJoinChannel, protocol.ActionLeaveChannel, protocol.ActionCreateChannel, protocol.ActionInviteChannel:
+		return s.manageChannel(ctx, req)
+	case protocol.ActionListTopics:
+		return s.listTopics(ctx, req)
+	case protocol.ActionMute:
+		return s.mute(req)
+	case protocol.ActionUnmute:
+		return s.unmute(req)
+	case protocol.ActionMutes:
+		return s.listMutes(req)
+	case protocol.ActionContext:
+		events, err := s.eventContext(req.EventID, req.Limit)
+		if err != nil {
+			return failed(err)
+		}
+		return protocol.Response{OK: true, Events: events}
+	default:
+		return protocol.Response{OK: false, Error: fmt.Sprintf("unsupported action: %s", req.Action), Code: protocol.CodeInvalidRequest}
+	}
+}
 
-		event, err := connector.Send(ctx, req)
+// send delivers req through its bot's connector for the send action.
+func (s *Server) send(ctx context.Context, req protocol.Request) protocol.Response {
+	if len(req.Blocks) > 0 {
+		if req.Interactive != nil {
+			return protocol.Response{OK: false, Error: "blocks and interactive cannot be combined; add an actions block instead", Code: protocol.CodeInvalidRequest}
+		}
+		blocks, fallback, err := upstream.NormalizeBlocks(req.Blocks)
 		if err != nil {
-			return protocol.Response{OK: false, Error: err.Error()}
+			return failed(err)
+		}
+		req.Blocks = blocks
+		if strings.TrimSpace(req.Text) == "" {
+			req.Text = fallback
+		}
+	}
+	if len(req.Embeds) > 0 {
+		if len(req.Blocks) > 0 {
+			return protocol.Response{OK: false, Error: "blocks and embeds cannot be combined", Code: protocol.CodeInvalidRequest}
+		}
+		if err := upstream.ValidateEmbeds(req.Embeds); err != nil {
+			return failed(err)
+		}
+	}
+	if err := validateFiles(req.Files); err != nil {
+		return failed(err)
+	}
+	if strings.TrimSpace(req.Text) == "" && len(req.Embeds) == 0 && len(req.Files) == 0 {
+		return protocol.Response{OK: false, Error: "text is required", Code: protocol.CodeInvalidRequest}
+	}
+	if req.ReplyTo < 0 {
+		return failed(invalidRequest("reply_to must be an event ID"))
+	}
+	if req.ReplyTo > 0 {
+		if err := s.threadOnto(&req); err != nil {
+			return failed(err)
 		}
+	}
+	if strings.TrimSpace(req.Target) == "" && strings.TrimSpace(req.Channel) == "" && strings.TrimSpace(req.Thread) == "" {
+		return protocol.Response{OK: false, Error: "at least one of target, channel, or thread is required", Code: protocol.CodeInvalidRequest}
+	}
 
-		// Annotate self flag on the send response (publish callback works on a copy).
-		event.Self = connector.Identity() != "" && event.User == connector.Identity()
+	if s.debugging(botKey(req.Service, req.Bot)) {
+		log.Printf("debug: send request trace=%s bot=%q target=%q channel=%q text=%q", trace.FromContext(ctx).ID(), req.Bot, req.Target, req.Channel, req.Text)
+	}
 
-		return protocol.Response{OK: true, Ack: fmt.Sprintf("sent event %d", event.ID), Event: &event}
-	case protocol.ActionReact:
-		emoji := strings.TrimSpace(req.Emoji)
-		if emoji == "" {
-			return protocol.Response{OK: false, Error: "emoji is required"}
+	if err := upstream.ValidateInteractive(req.Interactive); err != nil {
+		return failed(err)
+	}
+
+	resolvedService, resolvedBot, err := s.resolveBotService(req.Service, req.Bot)
+	if err != nil {
+		return failed(err)
+	}
+
+	// Auto-resolve channel from thread when only --thread is provided.
+	if strings.TrimSpace(req.Channel) == "" && strings.TrimSpace(req.Target) == "" && strings.TrimSpace(req.Thread) != "" {
+		if s.notifications != nil {
+			if ch, lookupErr := s.notifications.LookupChannelByThread(resolvedService, resolvedBot, req.Thread); lookupErr == nil && ch != "" {
+				req.Channel = ch
+				if s.debugging(botKey(req.Service, req.Bot)) {
+					log.Printf("debug: resolved channel %q from thread %q", ch, req.Thread)
+				}
+			}
 		}
+	}
 
-		resolvedService, resolvedBot, err := s.resolveBotService(req.Service, req.Bot)
+	// Translate before taking the bot's send slot, as the backend may be
+	// slow, and before the length check, as translations can be longer.
+	if strings.TrimSpace(req.Translate) != "" {
+		translateCtx, translating := trace.Start(ctx, "translate")
+		err := s.translateSend(translateCtx, &req)
+		translating.Finish(err)
 		if err != nil {
-			return protocol.Response{OK: false, Error: err.Error()}
+			return failed(err)
 		}
+	}
 
-		key := botKey(resolvedService, resolvedBot)
-		s.mu.RLock()
-		connector, ok := s.connectors[key]
-		s.mu.RUnlock()
-		if !ok {
-			return protocol.Response{OK: false, Error: fmt.Sprintf("unknown bot %q for service %q", resolvedBot, resolvedService)}
+	key := botKey(resolvedService, resolvedBot)
+	trace.FromContext(ctx).Set("pantalk.key", key)
+	// Waiting for the send slot is slow while the connector restarts.
+	_, waiting := trace.Start(ctx, "send.slot")
+	connector, gate, err := s.acquireConnector(ctx, key)
+	waiting.Finish(err)
+	if err != nil {
+		return failed(err)
+	}
+	if connector == nil {
+		return failed(unknownBot(resolvedService, resolvedBot))
+	}
+	defer gate.leave()
+
+	caps := connector.Capabilities()
+	if req.Interactive != nil && !caps.Interactive {
+		return protocol.Response{OK: false, Error: unsupported(resolvedService, resolvedBot, "interactive messages"), Code: protocol.CodeUnsupported}
+	}
+	if !caps.Blocks {
+		req.Blocks = nil
+	}
+	if len(req.Embeds) > 0 && !caps.Embeds {
+		req.Text = strings.TrimSpace(req.Text + "\n\n" + upstream.EmbedsText(req.Embeds))
+		req.Embeds = nil
+	}
+	if len(req.Files) > 0 && !caps.Files {
+		return protocol.Response{OK: false, Error: unsupported(resolvedService, resolvedBot, "file uploads"), Code: protocol.CodeUnsupported}
+	}
+	if strings.TrimSpace(req.StartThread) != "" && !caps.NewThreads {
+		return protocol.Response{OK: false, Error: unsupported(resolvedService, resolvedBot, "starting threads"), Code: protocol.CodeUnsupported}
+	}
+	if isSyntheticThread(req.Thread) && s.threadWindow(key) > 0 {
+		// Replies go to the conversation; the published message rejoins
+		// the thread.
+		s.resumeThread(key, req.Target, req.Channel, req.Thread, time.Now().UTC())
+		req.Thread = ""
+	}
+	if strings.TrimSpace(req.Thread) != "" && !caps.Threads {
+		return protocol.Response{OK: false, Error: unsupported(resolvedService, resolvedBot, "threads") + "; send to the channel without --thread", Code: protocol.CodeUnsupported}
+	}
+	if err := checkTextLength(req.Text, resolvedService, caps.MaxText); err != nil {
+		return failed(err)
+	}
+
+	if strings.TrimSpace(req.Author) != "" {
+		if !caps.Puppeting {
+			req.Text = formatting.Attribute(req.Author, req.Format, req.Text)
+			req.Author, req.AuthorAvatar = "", ""
 		}
+	}
 
-		if err := connector.React(ctx, req); err != nil {
-			return protocol.Response{OK: false, Error: err.Error()}
+	if req.DryRun {
+		req.Bot = resolvedBot
+		preview, err := upstream.Preview(resolvedService, req)
+		if err != nil {
+			return failed(err)
 		}
+		return protocol.Response{OK: true, Ack: "dry run, nothing sent", Preview: &preview}
+	}
 
-		return protocol.Response{OK: true, Ack: "reacted"}
-	case protocol.ActionReload:
-		if err := s.reloadConfig(); err != nil {
-			return protocol.Response{OK: false, Error: err.Error()}
+	s.markParticipation(key, req.Target, req.Channel, req.Thread)
+
+	callCtx, call := trace.Start(ctx, "connector.send")
+	call.Set("pantalk.key", key)
+	untrace := s.traceSend(key, req.Channel, call)
+	event, err := connector.Send(callCtx, req)
+	untrace()
+	call.Finish(err)
+	if err != nil {
+		return failed(withCode(protocol.CodeUpstream, err))
+	}
+	if strings.TrimSpace(req.StartThread) != "" {
+		// The thread didn't exist until now; follow replies in it.
+		s.markParticipation(key, event.Target, event.Channel, event.Thread)
+	}
+
+	// Annotate self flag on the send response (publish callback works on a copy).
+	event.Self = isSelf(connector, event.User)
+	s.redactEvent(key, &event)
+	event.Trace = trace.FromContext(ctx).ID()
+
+	return protocol.Response{OK: true, Ack: fmt.Sprintf("sent event %d", event.ID), Event: &event}
+}
+
+// validateFiles checks that the files of a send are readable regular files
+// named by absolute paths; relative paths would resolve against the
+// daemon's working directory rather than the caller's.
+func validateFiles(files []string) error {
+	for _, path := range files {
+		if !filepath.IsAbs(path) {
+			return invalidRequest("file path %q must be absolute", path)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return invalidRequest("file %s: %w", path, err)
+		}
+		if !info.Mode().IsRegular() {
+			return invalidRequest("file %s is not a regular file", path)
 		}
-		return protocol.Response{OK: true, Ack: "reloaded config and services"}
-	default:
-		return protocol.Response{OK: false, Error: fmt.Sprintf("unsupported action: %s", req.Action)}
 	}
+	return nil
 }
 
 // daemonStatus returns a snapshot of the daemon's current runtime state.
@@ -507,18 +1320,6 @@ func (s *Server) daemonStatus() *protocol.DaemonStatus {
 		return bots[i].Service < bots[j].Service
 	})
 
-	agents := make([]protocol.AgentInfo, 0, len(s.agents))
-	for _, r := range s.agents {
-		when := r.When()
-		if when == "" {
-			when = "notify"
-		}
-		agents = append(agents, protocol.AgentInfo{
-			Name: r.Name(),
-			When: when,
-		})
-	}
-
 	now := time.Now()
 	uptime := int64(0)
 	if !s.startedAt.IsZero() {
@@ -526,13 +1327,19 @@ func (s *Server) daemonStatus() *protocol.DaemonStatus {
 	}
 	startedAt := s.startedAt
 	notifications := s.notifications
+	subscribers := s.subscriberStatus()
+	dropped := s.droppedEvents
 	s.mu.RUnlock()
 
 	status := &protocol.DaemonStatus{
-		StartedAt: startedAt,
-		UptimeSec: uptime,
-		Bots:      bots,
-		Agents:    agents,
+		StartedAt:     startedAt,
+		UptimeSec:     uptime,
+		Bots:          bots,
+		Agents:        s.agentInfos(false),
+		Subscribers:   subscribers,
+		DroppedEvents: dropped,
+		Middleware:    s.middlewareStatus(),
+		Debug:         s.debugStatus(),
 	}
 
 	if notifications != nil {
@@ -559,6 +1366,11 @@ func (s *Server) listBots(service string) []protocol.BotRef {
 		}
 		if connector := s.connectors[key]; connector != nil {
 			bot.BotID = connector.Identity()
+			if user, ok := connector.(upstream.UserIdentifier); ok {
+				bot.UserID = user.UserIdentity()
+			}
+			caps := connector.Capabilities()
+			bot.Capabilities = &caps
 		}
 		result = append(result, bot)
 	}
@@ -573,27 +1385,44 @@ func (s *Server) listBots(service string) []protocol.BotRef {
 	return result
 }
 
-func (s *Server) readEvents(service string, bot string, limit int, sinceID int64, target string, channel string, thread string, search string, notifyOnly bool) ([]protocol.Event, error) {
+// checkDirection refuses a direction filter other than in or out.
+func checkDirection(direction string) error {
+	if direction != "" && direction != "in" && direction != "out" {
+		return invalidRequest("direction must be in or out, got %q", direction)
+	}
+	return nil
+}
+
+// readEvents answers history: the events filter selects, from the recent
+// events ring where it can.
+func (s *Server) readEvents(filter store.EventFilter) ([]protocol.Event, error) {
 	if s.notifications == nil {
 		return nil, errors.New("store is not available")
 	}
 
-	_, err := s.resolveSelector(service, bot)
+	keys, err := s.resolveSelector(filter.Service, filter.Bot)
 	if err != nil {
 		return nil, err
 	}
 
-	events, err := s.notifications.ListEvents(store.EventFilter{
-		Service:    service,
-		Bot:        bot,
-		Target:     target,
-		Channel:    channel,
-		Thread:     thread,
-		Search:     search,
-		Limit:      limit,
-		SinceID:    sinceID,
-		NotifyOnly: notifyOnly,
-	})
+	// Reads of one bot's recent events are served from memory.
+	if filter.Bot != "" && len(keys) == 1 {
+		s.mu.RLock()
+		filter.Service = s.bots[keys[0]].Service
+		s.mu.RUnlock()
+		events, ok, err := s.recent.read(keys[0], filter, func(size int) ([]protocol.Event, error) {
+			return s.notifications.ListEvents(store.EventFilter{Service: filter.Service, Bot: filter.Bot, Limit: size})
+		})
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			s.annotateSelf(events)
+			return events, nil
+		}
+	}
+
+	events, err := s.notifications.ListEvents(filter)
 	if err != nil {
 		return nil, err
 	}
@@ -608,22 +1437,87 @@ func (s *Server) publish(event protocol.Event) {
 	}
 
 	key := botKey(event.Service, event.Bot)
+	if event.Kind == protocol.KindRead {
+		s.syncReadMarker(key, event)
+		return
+	}
+	if event.Kind == protocol.KindReceipt {
+		s.recordReceipt(key, event)
+		return
+	}
+	// Ignored events are dropped before anything looks at them: they aren't
+	// stored, streamed, and don't notify or follow threads.
+	if s.ignored(key, event) {
+		return
+	}
+
 	s.mu.RLock()
 	botRef := s.bots[key]
 	connector := s.connectors[key]
 	s.mu.RUnlock()
 
+	// An outbound message published during a traced send joins its trace,
+	// so the store write shows up in it.
+	var sendSpan *trace.Span
+	if event.Direction == "out" && event.Trace == "" {
+		sendSpan = s.sendSpan(key, event.Channel)
+		event.Trace = sendSpan.ID()
+	}
+
 	if connector != nil {
 		botRef.BotID = connector.Identity()
+		if namer, ok := connector.(upstream.MentionNamer); ok {
+			botRef.Aliases = append(slices.Clone(botRef.Aliases), namer.MentionNames()...)
+		}
 	}
 
-	event.Self = botRef.BotID != "" && event.User == botRef.BotID
-	event.Mentions = mentionsAgent(event, botRef)
-	event.Direct = isDirectToAgent(event)
-	event.Notify = event.Direction == "in" && (event.Mentions || event.Direct || s.hasParticipation(key, event.Target, event.Channel, event.Thread))
+	event.Self = isSelf(connector, event.User)
+	// Connectors set Direct, since what makes a conversation private
+	// differs per platform. Edits, deletions and reactions are never
+	// addressed to the bot, so agents waiting for direct messages or
+	// mentions don't see them again.
+	if isLifecycleKind(event.Kind) {
+		event.Direct = false
+	} else {
+		event.Mentions = mentionsAgent(event, botRef)
+	}
+	event.NotifyReason = s.notifyReason(key, event)
+	// After the thread participation check, which for these platforms
+	// follows whole channels.
+	s.assignThread(key, &event)
+
+	// During quiet hours inbound events are stored and streamed but don't
+	// notify, unless deferred until the window ends, and don't reach agents.
+	now := time.Now()
+	var quietHours *quiet.Hours
+	if event.Direction == "in" {
+		quietHours = s.quietNow(key, now)
+	}
+	// Muted channels are stored and streamed too, but don't notify or
+	// reach agents until the mute ends.
+	muted := s.muted(key, event.Channel, now)
+	if muted || quietHours != nil && !quietHours.Defers() {
+		event.NotifyReason = ""
+	}
+	event.Notify = event.NotifyReason != ""
+
+	// Run the middleware - redaction, translation, unfurling,
+	// classification and custom filters - after mention/direct detection,
+	// which needs the raw text, but before the event is logged, stored, or
+	// handed to agents and subscribers.
+	if s.runMiddleware(key, &event) {
+		return
+	}
+	// Middleware after redaction fill in or rewrite fields, and what they
+	// add may carry a secret too.
+	s.redactEvent(key, &event)
+	if !event.Notify {
+		event.NotifyReason = ""
+	}
 
 	if event.Kind == "status" {
 		log.Printf("[%s] %s", key, event.Text)
+		s.watchConnection(key, event)
 	} else if event.Kind == "message" {
 		tag := event.Direction
 		if event.Notify {
@@ -635,26 +1529,75 @@ func (s *Server) publish(event protocol.Event) {
 				tag += " (notify)"
 			}
 		}
-		log.Printf("[%s] %s message on %s", key, tag, event.Channel)
-		if s.debug {
+		if quietHours != nil {
+			tag += " (quiet)"
+		}
+		if muted {
+			tag += " (muted)"
+		}
+		log.Printf("[%s] %s message on %s%s", key, tag, event.Channel, traceNote(event.Trace))
+		if s.debugging(key) {
 			log.Printf("[%s] debug: target=%s channel=%s thread=%s text=%q", key, event.Target, event.Channel, event.Thread, event.Text)
 		}
+	} else if event.Kind == protocol.KindInteraction {
+		log.Printf("[%s] interaction on %s by %s", key, event.Channel, event.User)
+	} else if isLifecycleKind(event.Kind) {
+		if s.debugging(key) {
+			log.Printf("[%s] debug: %s on %s target=%s by %s", key, event.Kind, event.Channel, event.Target, event.User)
+		}
 	} else if event.Kind == "heartbeat" {
-		if s.debug {
+		if s.debugging(key) {
 			log.Printf("[%s] debug: heartbeat", key)
 		}
 	}
 
-	if s.notifications != nil && event.Kind == "message" {
+	// A notification deferred by quiet hours isn't streamed or stored as
+	// one until the window ends, when wakeSnoozed delivers it.
+	deferredReason := ""
+	if quietHours != nil && event.Notify && s.notifications != nil {
+		deferredReason = event.NotifyReason
+		event.Notify, event.NotifyReason = false, ""
+	}
+
+	if s.notifications != nil && (event.Kind == "message" || event.Kind == protocol.KindInteraction || isLifecycleKind(event.Kind)) {
+		write := sendSpan.Child("store.insert_event")
+		began := time.Now()
 		eventID, err := s.notifications.InsertEvent(event)
+		if s.storeProbe != nil {
+			s.storeProbe(time.Since(began))
+		}
+		write.Finish(err)
 		if err == nil {
 			event.ID = eventID
+			s.recent.add(key, event)
 		}
 
-		if event.Notify {
-			notificationID, notifyErr := s.notifications.InsertNotification(event)
-			if notifyErr == nil {
-				event.NotificationID = notificationID
+		if event.Notify || deferredReason != "" {
+			notice := event
+			if deferredReason != "" {
+				notice.Notify, notice.NotifyReason = true, deferredReason
+			}
+			if survivorID := s.collapseTarget(key, notice); survivorID > 0 {
+				if ok, collapseErr := s.notifications.CollapseNotification(survivorID); collapseErr == nil && ok {
+					notice.NotificationID = survivorID
+				}
+			}
+			if notice.NotificationID == 0 {
+				notificationID, notifyErr := s.notifications.InsertNotification(notice)
+				if notifyErr == nil {
+					notice.NotificationID = notificationID
+					s.openNotifyWindow(key, notice, notificationID)
+					if deferredReason != "" {
+						s.deferNotification(key, notice, quietHours, now)
+					} else if !s.holdForDigest(key, notice, now) {
+						if publisher := s.publisher(); publisher != nil {
+							go s.forwardNotification(publisher, notice)
+						}
+					}
+				}
+			}
+			if deferredReason == "" {
+				event.NotificationID = notice.NotificationID
 			}
 		}
 	}
@@ -665,21 +1608,120 @@ func (s *Server) publish(event protocol.Event) {
 	s.mu.RUnlock()
 
 	for _, runner := range agents {
-		if runner.Matches(event) {
+		if quietHours == nil && !muted && runner.Matches(event) {
 			runner.Handle(event)
 		}
 	}
 
+	if reply, ok := s.responder(key).Reply(event, now); ok {
+		go s.sendAutoReply(key, event, reply)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	for ch := range s.subsByBot[key] {
-		select {
-		case ch <- event:
-		default:
-			log.Printf("warning: dropped event %d for subscriber on %s (buffer full)", event.ID, key)
+	for sub := range s.subsByBot[key] {
+		s.deliver(sub, key, event)
+	}
+}
+
+// isLifecycleKind reports whether kind is an edit, deletion or reaction.
+func isLifecycleKind(kind string) bool {
+	switch kind {
+	case protocol.KindEdit, protocol.KindDelete, protocol.KindReaction:
+		return true
+	}
+	return false
+}
+
+// notifyWindow tracks the notification that repeats are folded into while
+// the cool-down is active.
+type notifyWindow struct {
+	notificationID int64
+	openedAt       time.Time
+}
+
+// notifyWindowKey scopes the cool-down to a single speaker in a single
+// conversation so unrelated chatter still notifies independently.
+func notifyWindowKey(key string, event protocol.Event) string {
+	return key + "|c=" + event.Channel + "|th=" + event.Thread + "|u=" + event.User
+}
+
+// collapseTarget returns the notification ID a new notify event should be
+// folded into, or 0 when no cool-down window is open for its conversation.
+func (s *Server) collapseTarget(key string, event protocol.Event) int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Each click is a separate decision, so interactions never collapse.
+	cooldown := time.Duration(s.cfg.Server.NotifyCooldown) * time.Second
+	if cooldown <= 0 || event.Kind != "message" {
+		return 0
+	}
+
+	window, ok := s.notifyWindows[notifyWindowKey(key, event)]
+	if !ok || event.Timestamp.Sub(window.openedAt) >= cooldown {
+		return 0
+	}
+	return window.notificationID
+}
+
+// openNotifyWindow starts a cool-down window anchored on a freshly inserted
+// notification. Expired windows are swept opportunistically so the map stays
+// bounded by the number of conversations active within one cool-down.
+func (s *Server) openNotifyWindow(key string, event protocol.Event, notificationID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cooldown := time.Duration(s.cfg.Server.NotifyCooldown) * time.Second
+	if cooldown <= 0 || event.Kind != "message" {
+		return
+	}
+
+	if s.notifyWindows == nil {
+		s.notifyWindows = make(map[string]notifyWindow)
+	}
+
+	for k, w := range s.notifyWindows {
+		if event.Timestamp.Sub(w.openedAt) >= cooldown {
+			delete(s.notifyWindows, k)
 		}
 	}
+
+	s.notifyWindows[notifyWindowKey(key, event)] = notifyWindow{
+		notificationID: notificationID,
+		openedAt:       event.Timestamp,
+	}
+}
+
+// redactor returns the redaction rules for a bot, or nil when the bot has
+// redaction disabled or no rules are configured.
+func (s *Server) redactor(key string) *redact.Redactor {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.redactors[key]
+}
+
+// redactEvent applies key's redaction rules to every text-bearing field of
+// event: its text, the translation and link previews.
+func (s *Server) redactEvent(key string, event *protocol.Event) {
+	r := s.redactor(key)
+	if r == nil {
+		return
+	}
+	event.Text = r.Apply(event.Text)
+	event.TranslatedText = r.Apply(event.TranslatedText)
+	if len(event.Links) > 0 {
+		// The links may be shared with the connector's copy of the event.
+		links := slices.Clone(event.Links)
+		for i := range links {
+			links[i].URL = r.Apply(links[i].URL)
+			links[i].Title = r.Apply(links[i].Title)
+			links[i].Description = r.Apply(links[i].Description)
+			links[i].SiteName = r.Apply(links[i].SiteName)
+		}
+		event.Links = links
+	}
 }
 
 func (s *Server) reloadConfig() error {
@@ -687,6 +1729,9 @@ func (s *Server) reloadConfig() error {
 		return errors.New("reload requires daemon --config path")
 	}
 
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
 	cfg, err := config.LoadWithOptions(s.cfgPath, s.allowExec)
 	if err != nil {
 		return fmt.Errorf("reload config: %w", err)
@@ -702,6 +1747,7 @@ func (s *Server) reloadConfig() error {
 	s.mu.RLock()
 	currentSocket := s.cfg.Server.SocketPath
 	currentDB := s.cfg.Server.DBPath
+	currentBots := s.cfg.Bots
 	s.mu.RUnlock()
 
 	if cfg.Server.SocketPath != currentSocket {
@@ -713,15 +1759,98 @@ func (s *Server) reloadConfig() error {
 
 	log.Printf("reloading configuration from %s", s.cfgPath)
 
+	s.mu.RLock()
+	currentConnectors := s.connectors
+	s.mu.RUnlock()
+
 	if err := s.startConnectors(cfg); err != nil {
 		return fmt.Errorf("reload connectors: %w", err)
 	}
 
 	log.Printf("configuration reloaded (%d bot(s))", len(cfg.Bots))
 
+	added, removed, changed := diffBots(currentBots, cfg.Bots)
+	if len(added) > 0 {
+		log.Printf("bots added: %s", strings.Join(added, ", "))
+	}
+	if len(removed) > 0 {
+		log.Printf("bots removed: %s", strings.Join(removed, ", "))
+	}
+
+	// Changed bots whose connector kept running only got a new token.
+	s.mu.RLock()
+	var restarted, rotated []string
+	for _, key := range changed {
+		if s.connectors[key] != nil && s.connectors[key] == currentConnectors[key] {
+			rotated = append(rotated, key)
+		} else {
+			restarted = append(restarted, key)
+		}
+	}
+	s.mu.RUnlock()
+	if len(restarted) > 0 {
+		log.Printf("bots restarted: %s", strings.Join(restarted, ", "))
+	}
+	if len(rotated) > 0 {
+		log.Printf("bot tokens rotated in place: %s", strings.Join(rotated, ", "))
+	}
+
 	return nil
 }
 
+// diffBots returns the bot keys present only in next (added), only in prev
+// (removed), and in both with a different config (changed), each sorted.
+func diffBots(prev []config.BotConfig, next []config.BotConfig) ([]string, []string, []string) {
+	before := make(map[string]config.BotConfig, len(prev))
+	for _, bot := range prev {
+		before[botKey(bot.Type, bot.Name)] = bot
+	}
+
+	after := make(map[string]struct{}, len(next))
+	var added, changed []string
+	for _, bot := range next {
+		key := botKey(bot.Type, bot.Name)
+		after[key] = struct{}{}
+		old, ok := before[key]
+		if !ok {
+			added = append(added, key)
+		} else if botChanged(old, bot) {
+			changed = append(changed, key)
+		}
+	}
+
+	var removed []string
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+// botChanged reports whether a bot's connector must be rebuilt. Redaction,
+// auto-replies, notification rules, aliases, quiet hours, read sync and
+// digests are applied by the server at publish time, so editing them alone does not
+// restart the connector.
+func botChanged(prev config.BotConfig, next config.BotConfig) bool {
+	prev.Redact, next.Redact = nil, nil
+	prev.AutoReply, next.AutoReply = nil, nil
+	prev.QuietHours, next.QuietHours = nil, nil
+	prev.NotifyOn, next.NotifyOn = nil, nil
+	prev.IgnoreUsers, next.IgnoreUsers = nil, nil
+	prev.IgnorePatterns, next.IgnorePatterns = nil, nil
+	prev.Aliases, next.Aliases = nil, nil
+	prev.SyncRead, next.SyncRead = false, false
+	prev.Digest, next.Digest = nil, nil
+	prev.ThreadWindow, next.ThreadWindow = 0, 0
+	prev.Translate, next.Translate = nil, nil
+	return !reflect.DeepEqual(prev, next)
+}
+
 func (s *Server) resolveSelector(service string, bot string) ([]string, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -729,7 +1858,7 @@ func (s *Server) resolveSelector(service string, bot string) ([]string, error) {
 	if service != "" && bot != "" {
 		key := botKey(service, bot)
 		if _, ok := s.bots[key]; !ok {
-			return nil, fmt.Errorf("unknown bot %q for service %q", bot, service)
+			return nil, unknownBot(service, bot)
 		}
 		return []string{key}, nil
 	}
@@ -743,7 +1872,7 @@ func (s *Server) resolveSelector(service string, bot string) ([]string, error) {
 			}
 		}
 		if len(matches) == 0 {
-			return nil, fmt.Errorf("unknown bot %q", bot)
+			return nil, withCode(protocol.CodeUnknownBot, fmt.Errorf("unknown bot %q", bot))
 		}
 		sort.Strings(matches)
 		return matches, nil
@@ -759,7 +1888,7 @@ func (s *Server) resolveSelector(service string, bot string) ([]string, error) {
 
 	if len(keys) == 0 {
 		if service != "" {
-			return nil, fmt.Errorf("unknown service %q", service)
+			return nil, withCode(protocol.CodeUnknownBot, fmt.Errorf("unknown service %q", service))
 		}
 		return nil, errors.New("no bots configured")
 	}
@@ -777,7 +1906,7 @@ func (s *Server) resolveBotService(service string, bot string) (string, string,
 	}
 
 	if strings.TrimSpace(bot) == "" {
-		return "", "", errors.New("--bot is required")
+		return "", "", invalidRequest("--bot is required")
 	}
 
 	s.mu.RLock()
@@ -794,45 +1923,15 @@ func (s *Server) resolveBotService(service string, bot string) (string, string,
 	}
 
 	if count == 0 {
-		return "", "", fmt.Errorf("unknown bot %q", bot)
+		return "", "", withCode(protocol.CodeUnknownBot, fmt.Errorf("unknown bot %q", bot))
 	}
 	if count > 1 {
-		return "", "", fmt.Errorf("ambiguous bot %q exists in multiple services, use --service to disambiguate", bot)
+		return "", "", invalidRequest("ambiguous bot %q exists in multiple services, use --service to disambiguate", bot)
 	}
 
 	return match.Service, match.Name, nil
 }
 
-func (s *Server) subscribe(keys []string) []chan protocol.Event {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	channels := make([]chan protocol.Event, 0, len(keys))
-	for _, key := range keys {
-		if s.subsByBot[key] == nil {
-			s.subsByBot[key] = make(map[chan protocol.Event]struct{})
-		}
-		ch := make(chan protocol.Event, 64)
-		s.subsByBot[key][ch] = struct{}{}
-		channels = append(channels, ch)
-	}
-
-	return channels
-}
-
-func (s *Server) unsubscribe(keys []string, channels []chan protocol.Event) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	for i, key := range keys {
-		ch := channels[i]
-		if subs := s.subsByBot[key]; subs != nil {
-			delete(subs, ch)
-		}
-		close(ch)
-	}
-}
-
 func botKey(service string, bot string) string {
 	return service + ":" + bot
 }
@@ -888,36 +1987,73 @@ func routeKey(target string, channel string, thread string) string {
 	return "t=" + target + "|c=" + channel + "|th=" + thread
 }
 
+// mentionsAgent reports whether the text mentions the bot: @ followed by its
+// name, display name or an alias as a whole word, or its platform ID in
+// Slack or Discord markup (<@U123>, <@!123>, <@U123|name>).
 func mentionsAgent(event protocol.Event, bot protocol.BotRef) bool {
 	text := strings.ToLower(event.Text)
 	if text == "" {
 		return false
 	}
 
-	nameToken := "@" + strings.ToLower(bot.Name)
-	if bot.Name != "" && strings.Contains(text, nameToken) {
-		return true
+	names := append([]string{bot.Name, bot.DisplayName}, bot.Aliases...)
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimLeft(strings.TrimSpace(name), "@"))
+		if name != "" && containsWord(text, "@"+name) {
+			return true
+		}
 	}
 
-	idToken := "<@" + strings.ToLower(bot.BotID) + ">"
-	if bot.BotID != "" && strings.Contains(text, idToken) {
-		return true
+	if bot.BotID != "" {
+		id := strings.ToLower(bot.BotID)
+		for _, token := range []string{"<@" + id + ">", "<@!" + id + ">", "<@" + id + "|"} {
+			if strings.Contains(text, token) {
+				return true
+			}
+		}
 	}
 
 	return false
 }
 
-func isDirectToAgent(event protocol.Event) bool {
-	target := strings.ToLower(event.Target)
-	if strings.HasPrefix(target, "dm:") || strings.HasPrefix(target, "direct:") || strings.HasPrefix(target, "user:") {
-		return true
+// containsWord reports whether token occurs in text without a name
+// character directly before or after it, so @al doesn't match @alice.
+func containsWord(text string, token string) bool {
+	for offset := 0; offset < len(text); {
+		index := strings.Index(text[offset:], token)
+		if index < 0 {
+			return false
+		}
+		start := offset + index
+		end := start + len(token)
+
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if (start == 0 || !isNameRune(before)) && (end == len(text) || !isNameRune(after)) {
+			return true
+		}
+		offset = start + 1
 	}
+	return false
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-'
+}
 
-	if strings.HasPrefix(strings.ToUpper(event.Channel), "D") {
+// isSelf reports whether user is an account connector acts as: its
+// Identity, or the user account of a UserIdentifier.
+func isSelf(connector upstream.Connector, user string) bool {
+	if connector == nil || user == "" {
+		return false
+	}
+	if user == connector.Identity() {
 		return true
 	}
-
-	return event.Kind == "dm"
+	if identifier, ok := connector.(upstream.UserIdentifier); ok {
+		return user == identifier.UserIdentity()
+	}
+	return false
 }
 
 // annotateSelf sets the Self flag on events where User matches the bot's
@@ -930,11 +2066,11 @@ func (s *Server) annotateSelf(events []protocol.Event) {
 		key := botKey(events[i].Service, events[i].Bot)
 		if connector := s.connectors[key]; connector != nil {
 			identity := connector.Identity()
-			events[i].Self = identity != "" && events[i].User == identity
-			if s.debug {
+			events[i].Self = isSelf(connector, events[i].User)
+			if s.debugging(key) {
 				log.Printf("debug: annotateSelf event=%d user=%q identity=%q self=%t", events[i].ID, events[i].User, identity, events[i].Self)
 			}
-		} else if s.debug {
+		} else if s.debugging(key) {
 			log.Printf("debug: annotateSelf event=%d no connector for key=%q", events[i].ID, key)
 		}
 	}
@@ -949,16 +2085,23 @@ func (s *Server) listNotifications(req protocol.Request) ([]protocol.Event, erro
 		return nil, err
 	}
 
+	if err := checkDirection(req.Direction); err != nil {
+		return nil, err
+	}
+
 	events, err := s.notifications.ListNotifications(store.NotificationFilter{
-		Service: req.Service,
-		Bot:     req.Bot,
-		Target:  req.Target,
-		Channel: req.Channel,
-		Thread:  req.Thread,
-		Search:  req.Search,
-		Limit:   req.Limit,
-		SinceID: req.SinceID,
-		Unseen:  req.Unseen,
+		Service:   req.Service,
+		Bot:       req.Bot,
+		Target:    req.Target,
+		Channel:   req.Channel,
+		Thread:    req.Thread,
+		Search:    req.Search,
+		Direction: req.Direction,
+		Kind:      req.Kind,
+		Limit:     req.Limit,
+		SinceID:   req.SinceID,
+		Forward:   req.Forward,
+		Unseen:    req.Unseen,
 	})
 	if err != nil {
 		return nil, err
@@ -1005,6 +2148,7 @@ func (s *Server) clearHistory(req protocol.Request) (int64, error) {
 		return 0, errors.New("refusing broad clear without --all (or specific filters)")
 	}
 
+	defer s.recent.reset()
 	return s.notifications.DeleteEvents(store.EventFilter{
 		Service: req.Service,
 		Bot:     req.Bot,
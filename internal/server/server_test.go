@@ -1,12 +1,17 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/pantalk/pantalk/internal/config"
 	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/redact"
 	"github.com/pantalk/pantalk/internal/store"
 	"github.com/pantalk/pantalk/internal/upstream"
 )
@@ -95,8 +100,10 @@ func TestMatchEventFilters(t *testing.T) {
 
 func TestMentionsAgent(t *testing.T) {
 	bot := protocol.BotRef{
-		Name:  "helper-bot",
-		BotID: "U123ABC",
+		Name:        "helper-bot",
+		BotID:       "U123ABC",
+		DisplayName: "Ops Bot",
+		Aliases:     []string{"helper", "@hb"},
 	}
 
 	tests := []struct {
@@ -112,6 +119,15 @@ func TestMentionsAgent(t *testing.T) {
 		{"id mention case-insensitive", "hello <@u123abc> please help", true},
 		{"partial name no at", "helper-bot", false},
 		{"partial id no brackets", "@U123ABC", false},
+		{"id mention with label", "hello <@U123ABC|helper-bot>", true},
+		{"id mention discord nickname format", "hello <@!U123ABC>", true},
+		{"name at end of sentence", "thanks @helper-bot.", true},
+		{"longer name", "ping @helper-bot2", false},
+		{"display name", "@Ops Bot can you check", true},
+		{"alias", "@helper take a look", true},
+		{"alias written with at", "cc @hb", true},
+		{"alias prefix of another name", "ask @helpers", false},
+		{"email address", "mail hb@hb.example", false},
 	}
 
 	for _, tt := range tests {
@@ -133,41 +149,6 @@ func TestMentionsAgent_EmptyBot(t *testing.T) {
 	}
 }
 
-func TestIsDirectToAgent(t *testing.T) {
-	tests := []struct {
-		name    string
-		target  string
-		channel string
-		kind    string
-		want    bool
-	}{
-		{"dm prefix", "dm:user123", "", "", true},
-		{"direct prefix", "direct:user123", "", "", true},
-		{"user prefix", "user:someone", "", "", true},
-		{"channel prefix", "channel:C1", "", "", false},
-		{"slack DM channel", "", "D0123456", "", true},
-		{"slack DM channel lower", "", "d0123456", "", true},
-		{"normal channel", "", "C0123456", "", false},
-		{"dm kind", "", "", "dm", true},
-		{"message kind", "", "", "message", false},
-		{"no indicators", "", "", "", false},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			event := protocol.Event{
-				Target:  tt.target,
-				Channel: tt.channel,
-				Kind:    tt.kind,
-			}
-			got := isDirectToAgent(event)
-			if got != tt.want {
-				t.Errorf("isDirectToAgent() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
 func TestParticipation(t *testing.T) {
 	s := &Server{
 		routesByBot: make(map[string]map[string]struct{}),
@@ -404,7 +385,7 @@ func TestDaemonStatus_IncludesNotificationBacklog(t *testing.T) {
 		bots:           make(map[string]protocol.BotRef),
 		connectors:     make(map[string]upstream.Connector),
 		routesByBot:    make(map[string]map[string]struct{}),
-		subsByBot:      make(map[string]map[chan protocol.Event]struct{}),
+		subsByBot:      make(map[string]map[*subscriber]struct{}),
 	}
 
 	status := s.daemonStatus()
@@ -418,3 +399,453 @@ func TestDaemonStatus_IncludesNotificationBacklog(t *testing.T) {
 		t.Fatalf("expected unseen=1, got %d", status.Notifications.Unseen)
 	}
 }
+
+func TestPublish_RedactsBeforeStoreAndSubscribers(t *testing.T) {
+	st, err := store.Open(filepath.Join(t.TempDir(), "pantalk-redact.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+
+	redactor, err := redact.New([]redact.Rule{{Name: "email"}})
+	if err != nil {
+		t.Fatalf("compile rules: %v", err)
+	}
+
+	s := &Server{
+		notifications: st,
+		bots: map[string]protocol.BotRef{
+			"slack:ops-bot": {Service: "slack", Name: "ops-bot"},
+			"slack:raw-bot": {Service: "slack", Name: "raw-bot"},
+		},
+		connectors:  make(map[string]upstream.Connector),
+		redactors:   map[string]*redact.Redactor{"slack:ops-bot": redactor},
+		routesByBot: make(map[string]map[string]struct{}),
+		subsByBot:   make(map[string]map[*subscriber]struct{}),
+	}
+
+	sub := s.subscribe([]string{"slack:ops-bot"}, 0, false, false)
+	defer s.unsubscribe(sub)
+
+	for _, bot := range []string{"ops-bot", "raw-bot"} {
+		s.publish(protocol.Event{
+			Service:   "slack",
+			Bot:       bot,
+			Kind:      "message",
+			Direction: "in",
+			Channel:   "C1",
+			Text:      "ping jane@example.com",
+		})
+	}
+
+	select {
+	case ev := <-sub.events:
+		if ev.Text != "ping [REDACTED:email]" {
+			t.Fatalf("subscriber got unredacted text: %q", ev.Text)
+		}
+	default:
+		t.Fatal("expected event for subscriber")
+	}
+
+	events, err := st.ListEvents(store.EventFilter{Service: "slack", Bot: "ops-bot"})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 1 || events[0].Text != "ping [REDACTED:email]" {
+		t.Fatalf("expected redacted stored event, got %+v", events)
+	}
+
+	events, err = st.ListEvents(store.EventFilter{Service: "slack", Bot: "raw-bot"})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 1 || events[0].Text != "ping jane@example.com" {
+		t.Fatalf("expected raw text for bot with redaction disabled, got %+v", events)
+	}
+}
+
+func TestPublish_NotifyCooldownCollapsesRepeats(t *testing.T) {
+	st, err := store.Open(filepath.Join(t.TempDir(), "pantalk-cooldown.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+
+	s := &Server{
+		notifications: st,
+		bots: map[string]protocol.BotRef{
+			"slack:ops-bot": {Service: "slack", Name: "ops-bot"},
+		},
+		connectors:  make(map[string]upstream.Connector),
+		routesByBot: make(map[string]map[string]struct{}),
+		subsByBot:   make(map[string]map[*subscriber]struct{}),
+	}
+	s.cfg.Server.NotifyCooldown = 60
+
+	base := time.Now().UTC()
+	mention := func(user string, thread string, offset time.Duration) {
+		s.publish(protocol.Event{
+			Timestamp: base.Add(offset),
+			Service:   "slack",
+			Bot:       "ops-bot",
+			Kind:      "message",
+			Direction: "in",
+			User:      user,
+			Channel:   "C1",
+			Thread:    thread,
+			Text:      "@ops-bot ping",
+		})
+	}
+
+	mention("U1", "T1", 0)
+	mention("U1", "T1", 10*time.Second) // collapsed
+	mention("U1", "T1", 20*time.Second) // collapsed
+	mention("U2", "T1", 25*time.Second) // different user
+	mention("U1", "T2", 30*time.Second) // different thread
+	mention("U1", "T1", 90*time.Second) // window expired
+
+	notifs, err := st.ListNotifications(store.NotificationFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("list notifications: %v", err)
+	}
+	if len(notifs) != 4 {
+		t.Fatalf("expected 4 notifications, got %d", len(notifs))
+	}
+	if notifs[0].Collapsed != 2 {
+		t.Fatalf("expected first notification collapsed=2, got %d", notifs[0].Collapsed)
+	}
+	for _, n := range notifs[1:] {
+		if n.Collapsed != 0 {
+			t.Fatalf("expected no collapse on %+v", n)
+		}
+	}
+
+	events, err := st.ListEvents(store.EventFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 6 {
+		t.Fatalf("expected every message kept in history, got %d", len(events))
+	}
+}
+
+type puppetConnector struct{ recordingConnector }
+
+func (c *puppetConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{Threads: true, Puppeting: true}
+}
+
+func TestHandleRequest_SendAuthor(t *testing.T) {
+	plain := &recordingConnector{sent: make(chan protocol.Request, 1)}
+	puppet := &puppetConnector{recordingConnector{sent: make(chan protocol.Request, 1)}}
+
+	s := &Server{
+		connectors: map[string]upstream.Connector{
+			"irc:relay":   plain,
+			"slack:relay": puppet,
+		},
+		routesByBot: make(map[string]map[string]struct{}),
+	}
+
+	send := func(service string) {
+		resp := s.handleRequest(context.Background(), protocol.Request{
+			Action:       protocol.ActionSend,
+			Service:      service,
+			Bot:          "relay",
+			Channel:      "#general",
+			Text:         "deploy done",
+			Author:       "alice",
+			AuthorAvatar: "https://example.com/alice.png",
+		})
+		if !resp.OK {
+			t.Fatalf("send via %s failed: %s", service, resp.Error)
+		}
+	}
+
+	send("irc")
+	if req := <-plain.sent; req.Text != "<alice> deploy done" || req.Author != "" {
+		t.Fatalf("expected relay formatting for irc, got %+v", req)
+	}
+
+	send("slack")
+	if req := <-puppet.sent; req.Text != "deploy done" || req.Author != "alice" || req.AuthorAvatar == "" {
+		t.Fatalf("expected author passed through for slack, got %+v", req)
+	}
+}
+
+type blocksConnector struct{ recordingConnector }
+
+func (c *blocksConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{Threads: true, Blocks: true}
+}
+
+func TestHandleRequest_SendBlocks(t *testing.T) {
+	plain := &recordingConnector{sent: make(chan protocol.Request, 1)}
+	slackish := &blocksConnector{recordingConnector{sent: make(chan protocol.Request, 1)}}
+
+	s := &Server{
+		connectors: map[string]upstream.Connector{
+			"discord:ops": plain,
+			"slack:ops":   slackish,
+		},
+		routesByBot: make(map[string]map[string]struct{}),
+	}
+
+	send := func(service string, req protocol.Request) protocol.Response {
+		req.Action, req.Service, req.Bot, req.Channel = protocol.ActionSend, service, "ops", "C1"
+		return s.handleRequest(context.Background(), req)
+	}
+	report := json.RawMessage(`{"blocks": [{"type": "header", "text": {"type": "plain_text", "text": "Nightly report"}}, {"type": "divider"}]}`)
+
+	if resp := send("slack", protocol.Request{Blocks: report}); !resp.OK {
+		t.Fatalf("blocks send failed: %s", resp.Error)
+	}
+	if req := <-slackish.sent; !strings.HasPrefix(string(req.Blocks), "[") || req.Text != "Nightly report" {
+		t.Fatalf("expected normalized blocks and fallback text, got %+v", req)
+	}
+
+	if resp := send("discord", protocol.Request{Text: "3 jobs failed", Blocks: report}); !resp.OK {
+		t.Fatalf("blocks send to discord failed: %s", resp.Error)
+	}
+	if req := <-plain.sent; req.Blocks != nil || req.Text != "3 jobs failed" {
+		t.Fatalf("expected a text-only send, got %+v", req)
+	}
+
+	if resp := send("slack", protocol.Request{Blocks: json.RawMessage(`[{"type": "carousel"}]`)}); resp.OK || !strings.Contains(resp.Error, "unsupported block type") {
+		t.Fatalf("expected invalid blocks refused, got %+v", resp)
+	}
+	buttons := &protocol.Interactive{Buttons: []protocol.Button{{Label: "OK", Value: "ok"}}}
+	if resp := send("slack", protocol.Request{Blocks: report, Interactive: buttons}); resp.OK || !strings.Contains(resp.Error, "cannot be combined") {
+		t.Fatalf("expected blocks with interactive refused, got %+v", resp)
+	}
+}
+
+type embedsConnector struct{ recordingConnector }
+
+func (c *embedsConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{Threads: true, Embeds: true, NewThreads: true}
+}
+
+func TestHandleRequest_SendEmbeds(t *testing.T) {
+	plain := &recordingConnector{sent: make(chan protocol.Request, 1)}
+	discordish := &embedsConnector{recordingConnector{sent: make(chan protocol.Request, 1)}}
+
+	s := &Server{
+		connectors: map[string]upstream.Connector{
+			"slack:ops":   plain,
+			"discord:ops": discordish,
+		},
+		routesByBot: make(map[string]map[string]struct{}),
+	}
+
+	send := func(service string, req protocol.Request) protocol.Response {
+		req.Action, req.Service, req.Bot, req.Channel = protocol.ActionSend, service, "ops", "C1"
+		return s.handleRequest(context.Background(), req)
+	}
+	card := []protocol.Embed{{
+		Title:  "Deploy finished",
+		Color:  0x2ECC71,
+		Fields: []protocol.EmbedField{{Name: "Duration", Value: "4m12s", Inline: true}},
+	}}
+
+	if resp := send("discord", protocol.Request{Embeds: card, StartThread: "Deploy"}); !resp.OK {
+		t.Fatalf("embed send failed: %s", resp.Error)
+	}
+	if req := <-discordish.sent; len(req.Embeds) != 1 || req.Text != "" || req.StartThread != "Deploy" {
+		t.Fatalf("expected the embed and thread passed through, got %+v", req)
+	}
+
+	if resp := send("slack", protocol.Request{Text: "v2.3 is live", Embeds: card}); !resp.OK {
+		t.Fatalf("embed send to slack failed: %s", resp.Error)
+	}
+	if req := <-plain.sent; req.Embeds != nil || req.Text != "v2.3 is live\n\nDeploy finished\nDuration: 4m12s" {
+		t.Fatalf("expected the embed as text, got %+v", req)
+	}
+
+	if resp := send("slack", protocol.Request{Text: "hi", StartThread: "Deploy"}); resp.OK || !strings.Contains(resp.Error, "does not support starting threads") {
+		t.Fatalf("expected start_thread refused, got %+v", resp)
+	}
+	if resp := send("discord", protocol.Request{Embeds: []protocol.Embed{{Color: 0x2ECC71}}}); resp.OK || !strings.Contains(resp.Error, "needs a title") {
+		t.Fatalf("expected an empty embed refused, got %+v", resp)
+	}
+	blocks := json.RawMessage(`[{"type": "divider"}]`)
+	if resp := send("discord", protocol.Request{Text: "hi", Embeds: card, Blocks: blocks}); resp.OK || !strings.Contains(resp.Error, "cannot be combined") {
+		t.Fatalf("expected blocks with embeds refused, got %+v", resp)
+	}
+}
+
+type filesConnector struct{ recordingConnector }
+
+func (c *filesConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{Files: true}
+}
+
+func TestHandleRequest_SendFiles(t *testing.T) {
+	plain := &recordingConnector{sent: make(chan protocol.Request, 1)}
+	uploads := &filesConnector{recordingConnector{sent: make(chan protocol.Request, 1)}}
+
+	s := &Server{
+		connectors: map[string]upstream.Connector{
+			"irc:ops":      plain,
+			"whatsapp:ops": uploads,
+		},
+		routesByBot: make(map[string]map[string]struct{}),
+	}
+
+	send := func(service string, files ...string) protocol.Response {
+		return s.handleRequest(context.Background(), protocol.Request{
+			Action: protocol.ActionSend, Service: service, Bot: "ops", Channel: "C1", Files: files,
+		})
+	}
+	report := filepath.Join(t.TempDir(), "report.pdf")
+	if err := os.WriteFile(report, []byte("%PDF-1.7"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp := send("whatsapp", report); !resp.OK {
+		t.Fatalf("file send without text failed: %s", resp.Error)
+	}
+	if req := <-uploads.sent; len(req.Files) != 1 || req.Files[0] != report {
+		t.Fatalf("expected the file passed through, got %+v", req)
+	}
+	if resp := send("irc", report); resp.OK || !strings.Contains(resp.Error, "does not support file uploads") {
+		t.Fatalf("expected file send refused, got %+v", resp)
+	}
+	if resp := send("whatsapp", "report.pdf"); resp.OK || !strings.Contains(resp.Error, "must be absolute") {
+		t.Fatalf("expected relative path refused, got %+v", resp)
+	}
+	if resp := send("whatsapp", filepath.Dir(report)); resp.OK || !strings.Contains(resp.Error, "not a regular file") {
+		t.Fatalf("expected directory refused, got %+v", resp)
+	}
+}
+
+type interactiveConnector struct{ recordingConnector }
+
+func (c *interactiveConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{Threads: true, Interactive: true}
+}
+
+func TestHandleRequest_SendInteractive(t *testing.T) {
+	plain := &recordingConnector{sent: make(chan protocol.Request, 1)}
+	buttons := &interactiveConnector{recordingConnector{sent: make(chan protocol.Request, 1)}}
+
+	s := &Server{
+		connectors: map[string]upstream.Connector{
+			"irc:ops":   plain,
+			"slack:ops": buttons,
+		},
+		routesByBot: make(map[string]map[string]struct{}),
+	}
+
+	send := func(service string, interactive *protocol.Interactive) protocol.Response {
+		return s.handleRequest(context.Background(), protocol.Request{
+			Action:      protocol.ActionSend,
+			Service:     service,
+			Bot:         "ops",
+			Channel:     "C1",
+			Text:        "deploy to prod?",
+			Interactive: interactive,
+		})
+	}
+	approve := &protocol.Interactive{Buttons: []protocol.Button{
+		{Label: "Approve", Value: "approve", Style: "primary"},
+		{Label: "Reject", Value: "reject", Style: "danger"},
+	}}
+
+	if resp := send("slack", approve); !resp.OK {
+		t.Fatalf("interactive send failed: %s", resp.Error)
+	}
+	if req := <-buttons.sent; req.Interactive == nil || len(req.Interactive.Buttons) != 2 {
+		t.Fatalf("expected buttons passed to the connector, got %+v", req.Interactive)
+	}
+
+	if resp := send("irc", approve); resp.OK || !strings.Contains(resp.Error, "does not support interactive") {
+		t.Fatalf("expected irc to refuse buttons, got %+v", resp)
+	}
+
+	duplicate := &protocol.Interactive{Buttons: []protocol.Button{{Label: "A", Value: "x"}, {Label: "B", Value: "x"}}}
+	if resp := send("slack", duplicate); resp.OK || !strings.Contains(resp.Error, "duplicate") {
+		t.Fatalf("expected duplicate values to be refused, got %+v", resp)
+	}
+}
+
+func TestPublish_LifecycleEventsStoredWithoutNotifying(t *testing.T) {
+	s := newReplayServer(t)
+
+	for _, kind := range []string{protocol.KindEdit, protocol.KindDelete, protocol.KindReaction} {
+		s.publish(protocol.Event{
+			Service:   "slack",
+			Bot:       "ops",
+			Kind:      kind,
+			Direction: "in",
+			User:      "U1",
+			Target:    "post:P1",
+			Channel:   "D1",
+			Text:      "@ops please look",
+		})
+	}
+
+	events, err := s.notifications.ListEvents(store.EventFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected the edit, deletion and reaction in history, got %+v", events)
+	}
+	for _, event := range events {
+		if event.Notify || event.Mentions || event.Direct {
+			t.Fatalf("expected %s not addressed to the bot, got %+v", event.Kind, event)
+		}
+	}
+
+	notifications, err := s.notifications.ListNotifications(store.NotificationFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("list notifications: %v", err)
+	}
+	if len(notifications) != 0 {
+		t.Fatalf("expected no notifications, got %+v", notifications)
+	}
+}
+
+func TestPublish_StoresInteractionsAsNotifications(t *testing.T) {
+	s := newReplayServer(t)
+
+	s.publish(protocol.Event{
+		Service:   "slack",
+		Bot:       "ops",
+		Kind:      protocol.KindInteraction,
+		Direction: "in",
+		User:      "U1",
+		Channel:   "C1",
+		Text:      "approve",
+	})
+
+	notifications, err := s.notifications.ListNotifications(store.NotificationFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("list notifications: %v", err)
+	}
+	if len(notifications) != 1 || notifications[0].Kind != protocol.KindInteraction || notifications[0].Text != "approve" {
+		t.Fatalf("expected the click stored as a notification, got %+v", notifications)
+	}
+}
+
+func TestBotChanged_ServerSideSettings(t *testing.T) {
+	prev := config.BotConfig{Name: "ops", Type: "mattermost", BotToken: "tok"}
+	next := prev
+	next.NotifyOn = []config.NotifyRule{{Match: "deploy"}}
+	next.Aliases = []string{"oncall"}
+	next.SyncRead = true
+	next.QuietHours = &config.QuietHoursConfig{Start: "22:00", End: "07:00"}
+	next.Digest = &config.DigestConfig{Window: 600}
+	next.ThreadWindow = 600
+	next.Translate = &config.TranslateConfig{To: "en"}
+	next.IgnoreUsers = []string{"U0NOISY"}
+	next.IgnorePatterns = []string{"^\\[ci\\]"}
+	if botChanged(prev, next) {
+		t.Fatal("expected server-side settings not to restart the connector")
+	}
+	next.BotToken = "other"
+	if !botChanged(prev, next) {
+		t.Fatal("expected a new token to restart the connector")
+	}
+}
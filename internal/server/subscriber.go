@@ -0,0 +1,149 @@
+package server
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// defaultSubscriberBuffer is the number of live events a subscription
+// queues for a slow reader when the request doesn't ask for another size.
+const defaultSubscriberBuffer = 64
+
+// maxSubscriberBuffer caps the buffer a subscribe request can ask for.
+const maxSubscriberBuffer = 65536
+
+// subscriber is one subscribe connection. Events of all the bots it
+// selected are queued on events; when the queue is full publish drops the
+// event and counts it. With catchUp set the subscriber instead stops
+// taking live events at the first drop and, once the client has read what
+// was queued, handleSubscribe replays the gap from the store.
+//
+// The fields below events are guarded by Server.mu.
+type subscriber struct {
+	keys    []string
+	events  chan protocol.Event
+	catchUp bool
+	notify  bool // only notifications, which include deferred ones waking up
+	since   time.Time
+
+	dropped int64
+	lagging bool  // a catch-up subscriber missed events and awaits replay
+	gapFrom int64 // ID before the first event missed while lagging
+}
+
+// subscribe registers a subscriber for the bot keys with a queue of buffer
+// events (defaultSubscriberBuffer when zero). With notify set it also gets
+// the notifications quiet hours deferred once they wake up.
+func (s *Server) subscribe(keys []string, buffer int, catchUp bool, notify bool) *subscriber {
+	if buffer <= 0 {
+		buffer = defaultSubscriberBuffer
+	}
+	sub := &subscriber{
+		keys:    keys,
+		events:  make(chan protocol.Event, buffer),
+		catchUp: catchUp,
+		notify:  notify,
+		since:   time.Now().UTC(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		if s.subsByBot[key] == nil {
+			s.subsByBot[key] = make(map[*subscriber]struct{})
+		}
+		s.subsByBot[key][sub] = struct{}{}
+	}
+	return sub
+}
+
+func (s *Server) unsubscribe(sub *subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range sub.keys {
+		if subs := s.subsByBot[key]; subs != nil {
+			delete(subs, sub)
+		}
+	}
+	close(sub.events)
+}
+
+// deliver queues event for sub without blocking publish. The caller holds
+// s.mu for writing.
+func (s *Server) deliver(sub *subscriber, key string, event protocol.Event) {
+	if sub.lagging {
+		// The replay after the subscriber drains covers this event.
+		sub.dropped++
+		s.droppedEvents++
+		return
+	}
+
+	select {
+	case sub.events <- event:
+		return
+	default:
+	}
+
+	sub.dropped++
+	s.droppedEvents++
+	if sub.catchUp && event.ID > 0 {
+		sub.lagging = true
+		sub.gapFrom = event.ID - 1
+		log.Printf("warning: subscriber on %s fell behind at event %d (buffer of %d full); catching up from the store once it drains", key, event.ID, cap(sub.events))
+		return
+	}
+	log.Printf("warning: dropped event %d for subscriber on %s (buffer of %d full, %d dropped)", event.ID, key, cap(sub.events), sub.dropped)
+}
+
+// resumeLive takes sub out of lagging so publish queues live events again,
+// and returns the ID to replay the missed events from. ok is false when
+// sub hasn't missed anything. Live events queued from here on that the
+// replay also returns are skipped by ID.
+func (s *Server) resumeLive(sub *subscriber) (from int64, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !sub.lagging {
+		return 0, false
+	}
+	sub.lagging = false
+	return sub.gapFrom, true
+}
+
+// subscriberStatus lists the open subscriptions, oldest first, for the
+// status action. The caller holds s.mu.
+func (s *Server) subscriberStatus() []protocol.SubscriberStatus {
+	seen := make(map[*subscriber]struct{})
+	subs := make([]*subscriber, 0)
+	for _, set := range s.subsByBot {
+		for sub := range set {
+			if _, ok := seen[sub]; ok {
+				continue
+			}
+			seen[sub] = struct{}{}
+			subs = append(subs, sub)
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		if subs[i].since.Equal(subs[j].since) {
+			return strings.Join(subs[i].keys, ",") < strings.Join(subs[j].keys, ",")
+		}
+		return subs[i].since.Before(subs[j].since)
+	})
+
+	status := make([]protocol.SubscriberStatus, 0, len(subs))
+	for _, sub := range subs {
+		status = append(status, protocol.SubscriberStatus{
+			Bots:    append([]string(nil), sub.keys...),
+			Since:   sub.since,
+			Buffer:  cap(sub.events),
+			Queued:  len(sub.events),
+			Dropped: sub.dropped,
+			CatchUp: sub.catchUp,
+		})
+	}
+	return status
+}
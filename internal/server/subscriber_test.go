@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+)
+
+// fillSubscriber publishes "1" and waits for the subscriber to take it off
+// its queue (it then blocks writing to the unread pipe), then publishes
+// "2".."n", which fill the queue and overflow it.
+func fillSubscriber(t *testing.T, s *Server, n int) {
+	t.Helper()
+	publishText(s, "slack", "ops", "1")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		subs := s.daemonStatus().Subscribers
+		if len(subs) == 1 && subs[0].Queued == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("subscriber never took the first event: %+v", subs)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 2; i <= n; i++ {
+		publishText(s, "slack", "ops", fmt.Sprint(i))
+	}
+}
+
+func expectTexts(t *testing.T, events []protocol.Event, want ...string) {
+	t.Helper()
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), events)
+	}
+	for i, event := range events {
+		if event.Text != want[i] {
+			t.Fatalf("event %d: expected %q, got %q", i, want[i], event.Text)
+		}
+	}
+}
+
+func TestSubscribe_DropsCountedInStatus(t *testing.T) {
+	s := newReplayServer(t)
+	decoder := subscribeStream(t, s, protocol.Request{Action: protocol.ActionSubscribe, Service: "slack", Bot: "ops", Buffer: 2})
+
+	fillSubscriber(t, s, 6)
+
+	status := s.daemonStatus()
+	if status.DroppedEvents != 3 || len(status.Subscribers) != 1 {
+		t.Fatalf("expected 3 dropped events, got %+v", status)
+	}
+	sub := status.Subscribers[0]
+	if sub.Buffer != 2 || sub.Queued != 2 || sub.Dropped != 3 || sub.CatchUp || len(sub.Bots) != 1 || sub.Bots[0] != "slack:ops" {
+		t.Fatalf("unexpected subscriber status: %+v", sub)
+	}
+
+	var got []protocol.Event
+	for i := 0; i < 3; i++ {
+		got = append(got, nextEvent(t, decoder))
+	}
+	publishText(s, "slack", "ops", "7")
+	got = append(got, nextEvent(t, decoder))
+	expectTexts(t, got, "1", "2", "3", "7")
+}
+
+func TestSubscribe_CatchUpAfterDrops(t *testing.T) {
+	s := newReplayServer(t)
+	decoder := subscribeStream(t, s, protocol.Request{Action: protocol.ActionSubscribe, Service: "slack", Bot: "ops", Buffer: 2, CatchUp: true})
+
+	fillSubscriber(t, s, 6)
+	if sub := s.daemonStatus().Subscribers[0]; sub.Dropped != 3 || !sub.CatchUp {
+		t.Fatalf("unexpected subscriber status: %+v", sub)
+	}
+
+	var got []protocol.Event
+	for i := 0; i < 6; i++ {
+		got = append(got, nextEvent(t, decoder))
+	}
+	expectTexts(t, got, "1", "2", "3", "4", "5", "6")
+
+	marker := nextEvent(t, decoder)
+	if marker.Kind != protocol.KindReplayDone || marker.ID != got[5].ID {
+		t.Fatalf("expected a catch-up marker at event %d, got %+v", got[5].ID, marker)
+	}
+
+	publishText(s, "slack", "ops", "7")
+	expectTexts(t, []protocol.Event{nextEvent(t, decoder)}, "7")
+}
+
+func TestSubscribe_BufferValidation(t *testing.T) {
+	s := newReplayServer(t)
+	for _, req := range []protocol.Request{
+		{Action: protocol.ActionSubscribe, Bot: "other", Buffer: -1},
+		{Action: protocol.ActionSubscribe, Bot: "other", Buffer: maxSubscriberBuffer + 1},
+	} {
+		resp := subscribeError(t, s, req)
+		if resp.OK || !strings.Contains(resp.Error, "or 0 for the default") {
+			t.Fatalf("expected buffer %d rejected, got %+v", req.Buffer, resp)
+		}
+	}
+
+	s.notifications = nil
+	resp := subscribeError(t, s, protocol.Request{Action: protocol.ActionSubscribe, Bot: "other", CatchUp: true})
+	if resp.OK {
+		t.Fatal("expected catch-up without a store rejected")
+	}
+}
+
+// subscribeError runs a subscribe expected to fail and returns its response.
+func subscribeError(t *testing.T, s *Server, req protocol.Request) protocol.Response {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+	go s.handleSubscribe(context.Background(), req, json.NewEncoder(serverConn))
+
+	_ = clientConn.SetDeadline(time.Now().Add(5 * time.Second))
+	var resp protocol.Response
+	if err := json.NewDecoder(clientConn).Decode(&resp); err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	return resp
+}
+
+func TestSubscribe_SinceCatchesUpLiveOverflow(t *testing.T) {
+	s := newReplayServer(t)
+	publishText(s, "slack", "ops", "seen")
+	publishText(s, "slack", "ops", "stored")
+	stored, err := s.notifications.ListEvents(store.EventFilter{Service: "slack", Bot: "ops"})
+	if err != nil || len(stored) != 2 {
+		t.Fatalf("expected two stored events, got %d (%v)", len(stored), err)
+	}
+
+	decoder := subscribeStream(t, s, protocol.Request{Action: protocol.ActionSubscribe, Service: "slack", Bot: "ops", SinceID: stored[0].ID, Buffer: 2})
+
+	// The replay blocks writing the stored event while these arrive; three
+	// of them overflow the queue.
+	for i := 1; i <= 5; i++ {
+		publishText(s, "slack", "ops", fmt.Sprint(i))
+	}
+
+	var got []protocol.Event
+	for len(got) < 6 {
+		if event := nextEvent(t, decoder); event.Kind != protocol.KindReplayDone {
+			got = append(got, event)
+		}
+	}
+	expectTexts(t, got, "stored", "1", "2", "3", "4", "5")
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// syntheticThreadPrefix starts the thread IDs pantalk makes up for bots
+// with a thread_window, so sends can tell them from platform thread IDs.
+const syntheticThreadPrefix = "pt-"
+
+// syntheticThread is the open synthetic thread of one conversation.
+type syntheticThread struct {
+	id     string
+	last   time.Time     // newest message in the thread
+	window time.Duration // the bot's thread_window
+}
+
+func isSyntheticThread(thread string) bool {
+	return strings.HasPrefix(thread, syntheticThreadPrefix)
+}
+
+// conversationKey scopes a synthetic thread to one channel, or to one
+// target for platforms that only have direct conversations.
+func conversationKey(key string, target string, channel string) string {
+	if channel != "" {
+		return key + "|c=" + channel
+	}
+	if target != "" {
+		return key + "|t=" + target
+	}
+	return ""
+}
+
+func (s *Server) threadWindow(key string) time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.threadWindows[key]
+}
+
+// assignThread puts a message of a bot with a thread_window into a
+// synthetic thread: the open thread of its conversation if the previous
+// message was less than the window ago, otherwise a new one. Events that
+// already carry a thread keep it.
+func (s *Server) assignThread(key string, event *protocol.Event) {
+	if event.Thread != "" || event.Kind != "message" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	window := s.threadWindows[key]
+	conversation := conversationKey(key, event.Target, event.Channel)
+	if window <= 0 || conversation == "" {
+		return
+	}
+
+	if s.syntheticThreads == nil {
+		s.syntheticThreads = make(map[string]syntheticThread)
+	}
+	thread, ok := s.syntheticThreads[conversation]
+	if !ok || event.Timestamp.Sub(thread.last) >= window {
+		// Conversations that went quiet are swept as new threads open, so
+		// the map stays bounded by the recently active ones.
+		for k, open := range s.syntheticThreads {
+			if event.Timestamp.Sub(open.last) >= open.window {
+				delete(s.syntheticThreads, k)
+			}
+		}
+		thread.id = newSyntheticThreadID(conversation, event.Timestamp)
+	}
+	thread.last = event.Timestamp
+	thread.window = window
+	s.syntheticThreads[conversation] = thread
+	event.Thread = thread.id
+}
+
+// resumeThread makes thread the open synthetic thread of its conversation
+// again, so a reply to an older thread lands in it rather than in a new
+// one.
+func (s *Server) resumeThread(key string, target string, channel string, thread string, now time.Time) {
+	conversation := conversationKey(key, target, channel)
+	if conversation == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.syntheticThreads == nil {
+		s.syntheticThreads = make(map[string]syntheticThread)
+	}
+	s.syntheticThreads[conversation] = syntheticThread{id: thread, last: now, window: s.threadWindows[key]}
+}
+
+// newSyntheticThreadID names a thread after when it started, plus a hash of
+// its conversation so threads starting at once in two channels differ.
+func newSyntheticThreadID(conversation string, start time.Time) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(conversation))
+	return syntheticThreadPrefix + strconv.FormatInt(start.UnixMilli(), 36) + "-" + strconv.FormatUint(uint64(h.Sum32()), 36)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+)
+
+func TestPublish_SyntheticThreads(t *testing.T) {
+	s := newReplayServer(t)
+	s.threadWindows = map[string]time.Duration{"slack:ops": 2 * time.Minute}
+
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	for _, msg := range []struct {
+		after   time.Duration
+		channel string
+		thread  string
+		text    string
+	}{
+		{0, "C1", "", "is the build green?"},
+		{90 * time.Second, "C1", "", "yes, just now"},
+		{100 * time.Second, "C2", "", "lunch?"},
+		{3 * time.Minute, "C1", "", "thanks"},
+		{4 * time.Minute, "C1", "1700000000.000100", "native reply"},
+		{5*time.Minute + 30*time.Second, "C1", "", "new topic"},
+	} {
+		s.publish(protocol.Event{Service: "slack", Bot: "ops", Kind: "message", Direction: "in", Timestamp: start.Add(msg.after), Channel: msg.channel, Thread: msg.thread, Text: msg.text})
+	}
+
+	events, err := s.notifications.ListEvents(store.EventFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	thread := make(map[string]string)
+	for _, event := range events {
+		thread[event.Text] = event.Thread
+	}
+
+	if !isSyntheticThread(thread["is the build green?"]) || thread["yes, just now"] != thread["is the build green?"] || thread["thanks"] != thread["is the build green?"] {
+		t.Errorf("expected the first three C1 messages in one thread, got %v", thread)
+	}
+	if !isSyntheticThread(thread["lunch?"]) || thread["lunch?"] == thread["is the build green?"] {
+		t.Errorf("expected C2 in a thread of its own, got %v", thread)
+	}
+	if thread["native reply"] != "1700000000.000100" {
+		t.Errorf("expected a platform thread to be kept, got %v", thread)
+	}
+	// The native reply doesn't extend the synthetic thread, so this one
+	// came 2m30s after "thanks".
+	if !isSyntheticThread(thread["new topic"]) || thread["new topic"] == thread["thanks"] {
+		t.Errorf("expected a new thread after the window, got %v", thread)
+	}
+}
+
+func TestResumeThread(t *testing.T) {
+	s := newReplayServer(t)
+	s.threadWindows = map[string]time.Duration{"slack:ops": time.Minute}
+
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	old := protocol.Event{Service: "slack", Bot: "ops", Kind: "message", Direction: "in", Timestamp: start, Channel: "C1", Text: "question"}
+	s.assignThread("slack:ops", &old)
+	newer := protocol.Event{Service: "slack", Bot: "ops", Kind: "message", Direction: "in", Timestamp: start.Add(10 * time.Minute), Channel: "C1", Text: "other question"}
+	s.assignThread("slack:ops", &newer)
+	if old.Thread == newer.Thread {
+		t.Fatalf("expected two threads, got %q twice", old.Thread)
+	}
+
+	// An agent answers the first question a little later.
+	s.resumeThread("slack:ops", "", "C1", old.Thread, start.Add(11*time.Minute))
+	reply := protocol.Event{Service: "slack", Bot: "ops", Kind: "message", Direction: "out", Timestamp: start.Add(11 * time.Minute), Channel: "C1", Text: "answer"}
+	s.assignThread("slack:ops", &reply)
+	if reply.Thread != old.Thread {
+		t.Fatalf("expected the reply in %q, got %q", old.Thread, reply.Thread)
+	}
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/trace"
+)
+
+// defaultSlowRequest is how long a request may take before its spans are
+// logged when tracing.slow is not set.
+const defaultSlowRequest = 5 * time.Second
+
+// tracing is what the tracing section configures.
+type tracing struct {
+	exporter *trace.Exporter // nil when traces aren't exported
+	slow     time.Duration   // zero never logs slow requests
+}
+
+// newTracing builds the tracing settings for cfg. Without a tracing
+// section slow requests are still logged.
+func newTracing(cfg config.Config) (tracing, error) {
+	t := tracing{slow: defaultSlowRequest}
+	if cfg.Tracing == nil {
+		return t, nil
+	}
+	switch {
+	case cfg.Tracing.Slow < 0:
+		t.slow = 0
+	case cfg.Tracing.Slow > 0:
+		t.slow = time.Duration(cfg.Tracing.Slow) * time.Millisecond
+	}
+
+	if strings.TrimSpace(cfg.Tracing.Endpoint) != "" {
+		headers := make(map[string]string, len(cfg.Tracing.Headers))
+		for key, value := range cfg.Tracing.Headers {
+			resolved, err := config.ResolveCredential(value)
+			if err != nil {
+				return tracing{}, fmt.Errorf("tracing.headers.%s: %w", key, err)
+			}
+			headers[key] = resolved
+		}
+		exporter, err := trace.NewExporter(trace.ExporterConfig{
+			Endpoint:    cfg.Tracing.Endpoint,
+			Headers:     headers,
+			ServiceName: cfg.Tracing.ServiceName,
+			Timeout:     time.Duration(cfg.Tracing.Timeout) * time.Second,
+		})
+		if err != nil {
+			return tracing{}, err
+		}
+		t.exporter = exporter
+	}
+	return t, nil
+}
+
+func (s *Server) currentTracing() tracing {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tracing
+}
+
+// handleRequest answers req under a span: the root of a new trace for a
+// client request, under the client's trace ID when it sent one, or a child
+// when the request is made on behalf of another. The response carries the
+// trace ID either way.
+func (s *Server) handleRequest(ctx context.Context, req protocol.Request) protocol.Response {
+	parent := trace.FromContext(ctx)
+	span := parent.Child(req.Action)
+	if parent == nil {
+		if req.Trace != "" && !trace.ValidID(req.Trace) {
+			return failed(invalidRequest("trace must be 32 hex digits, got %q", req.Trace))
+		}
+		span = trace.Begin(req.Trace, req.Action)
+	}
+	span.Set("pantalk.action", req.Action)
+	span.Set("pantalk.service", req.Service)
+	span.Set("pantalk.bot", req.Bot)
+
+	resp := s.dispatch(trace.NewContext(ctx, span), req)
+	resp.Trace = span.TraceID
+	span.Finish(responseErr(resp))
+	if parent == nil {
+		s.finishTrace(span)
+	}
+	return resp
+}
+
+// responseErr is the error a failed response reports, for its span.
+func responseErr(resp protocol.Response) error {
+	if resp.OK {
+		return nil
+	}
+	return errors.New(resp.Error)
+}
+
+// finishTrace exports a finished trace and logs its spans when the request
+// was slow.
+func (s *Server) finishTrace(root *trace.Span) {
+	t := s.currentTracing()
+	if t.exporter != nil && !t.exporter.Export(root.Spans()) && s.debugging("") {
+		log.Printf("debug: trace %s not exported: too many exports in flight", root.TraceID)
+	}
+
+	took := root.Duration()
+	if t.slow <= 0 || took < t.slow {
+		return
+	}
+	prefix := ""
+	if key := root.Attr("pantalk.key"); key != "" {
+		prefix = "[" + key + "] "
+	}
+	summary := root.Summary()
+	if summary == "" {
+		summary = "no steps recorded"
+	}
+	log.Printf("%sslow request: %s took %s (trace %s): %s", prefix, root.Name, took.Round(time.Millisecond), root.TraceID, summary)
+}
+
+// tracedSend is a send in flight on a connector, which publish matches
+// with the outbound event the connector publishes.
+type tracedSend struct {
+	channel string
+	span    *trace.Span
+}
+
+// traceSend registers the connector call of a traced send on the bot key
+// until the returned func is called.
+func (s *Server) traceSend(key string, channel string, span *trace.Span) func() {
+	if span == nil {
+		return func() {}
+	}
+	entry := &tracedSend{channel: channel, span: span}
+	s.traceMu.Lock()
+	if s.tracedSends == nil {
+		s.tracedSends = make(map[string][]*tracedSend)
+	}
+	s.tracedSends[key] = append(s.tracedSends[key], entry)
+	s.traceMu.Unlock()
+
+	return func() {
+		s.traceMu.Lock()
+		defer s.traceMu.Unlock()
+		sends := s.tracedSends[key]
+		for i, other := range sends {
+			if other == entry {
+				sends = append(sends[:i], sends[i+1:]...)
+				break
+			}
+		}
+		if len(sends) == 0 {
+			delete(s.tracedSends, key)
+		} else {
+			s.tracedSends[key] = sends
+		}
+	}
+}
+
+// sendSpan returns the span of the send in flight on key that published an
+// outbound event on channel, or nil. With several in flight only one to
+// the same channel matches, since the event doesn't say which it is.
+func (s *Server) sendSpan(key string, channel string) *trace.Span {
+	s.traceMu.Lock()
+	defer s.traceMu.Unlock()
+	sends := s.tracedSends[key]
+	if len(sends) == 1 {
+		return sends[0].span
+	}
+	var match *trace.Span
+	for _, send := range sends {
+		if send.channel != "" && send.channel == channel {
+			if match != nil {
+				return nil
+			}
+			match = send.span
+		}
+	}
+	return match
+}
+
+// traceNote is appended to log lines about an event sent by a traced
+// request.
+func traceNote(traceID string) string {
+	if traceID == "" {
+		return ""
+	}
+	return " (trace " + traceID + ")"
+}
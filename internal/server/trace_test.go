@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+func TestHandleRequest_Trace(t *testing.T) {
+	s := newReplayServer(t)
+	s.connectors["slack:ops"] = upstream.NewMockConnector("slack", "ops", s.publish)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	resp := s.handleRequest(context.Background(), protocol.Request{
+		Action:  protocol.ActionSend,
+		Trace:   traceID,
+		Service: "slack",
+		Bot:     "ops",
+		Channel: "C1",
+		Text:    "deploy done",
+	})
+	if !resp.OK {
+		t.Fatalf("send failed: %s", resp.Error)
+	}
+	if resp.Trace != traceID || resp.Event == nil || resp.Event.Trace != traceID {
+		t.Fatalf("expected the response and event under trace %s, got %q and %+v", traceID, resp.Trace, resp.Event)
+	}
+
+	events, err := s.notifications.ListEvents(store.EventFilter{Service: "slack", Bot: "ops", Limit: 10})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 1 || events[0].Trace != traceID {
+		t.Fatalf("expected the stored event under trace %s, got %+v", traceID, events)
+	}
+
+	// Without a trace ID the daemon makes one up.
+	if resp := s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionPing}); len(resp.Trace) != 32 || resp.Trace == traceID {
+		t.Fatalf("expected a new trace ID, got %q", resp.Trace)
+	}
+	if resp := s.handleRequest(context.Background(), protocol.Request{Action: protocol.ActionPing, Trace: "abc"}); resp.OK || resp.Code != protocol.CodeInvalidRequest {
+		t.Fatalf("expected a malformed trace ID rejected, got %+v", resp)
+	}
+}
+
+func TestHandleRequest_SlowTraceLogged(t *testing.T) {
+	s := newReplayServer(t)
+	s.connectors["slack:ops"] = upstream.NewMockConnector("slack", "ops", s.publish)
+	s.tracing = tracing{slow: time.Nanosecond}
+
+	var out bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&out)
+	defer log.SetOutput(previous)
+
+	resp := s.handleRequest(context.Background(), protocol.Request{
+		Action:  protocol.ActionSend,
+		Service: "slack",
+		Bot:     "ops",
+		Channel: "C1",
+		Text:    "deploy done",
+	})
+	if !resp.OK {
+		t.Fatalf("send failed: %s", resp.Error)
+	}
+
+	logged := out.String()
+	for _, want := range []string{"[slack:ops] slow request: send took", "trace " + resp.Trace, "send.slot", "connector.send", "store.insert_event"} {
+		if !strings.Contains(logged, want) {
+			t.Fatalf("expected %q in the log, got:\n%s", want, logged)
+		}
+	}
+}
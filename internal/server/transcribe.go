@@ -0,0 +1,40 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/transcribe"
+	"github.com/pantalk/pantalk/internal/upstream"
+)
+
+// newTranscribeFunc builds the voice transcription hook for cfg, or returns
+// nil when transcription is not configured.
+func newTranscribeFunc(cfg config.Config) (upstream.TranscribeFunc, error) {
+	if cfg.Transcription == nil {
+		return nil, nil
+	}
+
+	tc := transcribe.Config{
+		Command:  cfg.Transcription.Command,
+		Endpoint: cfg.Transcription.Endpoint,
+		Model:    cfg.Transcription.Model,
+		Language: cfg.Transcription.Language,
+		Timeout:  time.Duration(cfg.Transcription.Timeout) * time.Second,
+	}
+	if strings.TrimSpace(cfg.Transcription.APIKey) != "" {
+		key, err := config.ResolveCredential(cfg.Transcription.APIKey)
+		if err != nil {
+			return nil, fmt.Errorf("resolve transcription api_key: %w", err)
+		}
+		tc.APIKey = key
+	}
+
+	transcriber, err := transcribe.New(tc)
+	if err != nil {
+		return nil, err
+	}
+	return transcriber.Transcribe, nil
+}
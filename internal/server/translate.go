@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/translate"
+)
+
+// newTranslator builds the translation backend for cfg, or returns nil
+// when translation is not configured.
+func newTranslator(cfg config.Config) (*translate.Translator, error) {
+	if cfg.Translation == nil {
+		return nil, nil
+	}
+
+	tc := translate.Config{
+		Provider: cfg.Translation.Provider,
+		Endpoint: cfg.Translation.Endpoint,
+		Timeout:  time.Duration(cfg.Translation.Timeout) * time.Second,
+	}
+	if strings.TrimSpace(cfg.Translation.APIKey) != "" {
+		key, err := config.ResolveCredential(cfg.Translation.APIKey)
+		if err != nil {
+			return nil, fmt.Errorf("resolve translation api_key: %w", err)
+		}
+		tc.APIKey = key
+	}
+	return translate.New(tc)
+}
+
+// translation returns the translator and the language messages of key in
+// channel are translated into; the language is "" when they aren't.
+func (s *Server) translation(key string, channel string) (*translate.Translator, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.translator, s.translateTo[key].Target(channel)
+}
+
+// translateEvent fills in the translation of an inbound message for bots
+// with translate. A message already in the target language is left alone.
+func (s *Server) translateEvent(key string, event *protocol.Event) error {
+	if event.Kind != "message" || event.Direction != "in" || strings.TrimSpace(event.Text) == "" {
+		return nil
+	}
+	translator, target := s.translation(key, event.Channel)
+	if translator == nil || target == "" {
+		return nil
+	}
+
+	parent := s.rootCtx
+	if parent == nil {
+		parent = context.Background()
+	}
+	result, err := translator.Translate(parent, event.Text, target)
+	if err != nil {
+		return err
+	}
+	if translate.SameLanguage(result.Source, target) || result.Text == event.Text {
+		return nil
+	}
+	event.TranslatedText = result.Text
+	event.Language = result.Source
+	return nil
+}
+
+// translateSend translates the text of a send into req.Translate.
+func (s *Server) translateSend(ctx context.Context, req *protocol.Request) error {
+	s.mu.RLock()
+	translator := s.translator
+	s.mu.RUnlock()
+	if translator == nil {
+		return invalidRequest("translate needs a translation backend in the config")
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		return nil
+	}
+
+	result, err := translator.Translate(ctx, req.Text, req.Translate)
+	if err != nil {
+		return withCode(protocol.CodeUpstream, err)
+	}
+	req.Text = result.Text
+	return nil
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+	"github.com/pantalk/pantalk/internal/translate"
+)
+
+// newFakeLibreTranslate answers every translation into target with
+// "<target>: <text>", detecting English for texts starting with "hi" and
+// Spanish for the rest.
+func newFakeLibreTranslate(t *testing.T) *translate.Translator {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		if strings.Contains(body["q"], "fail") {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		source := "es"
+		if strings.HasPrefix(body["q"], "@ops hi") || strings.HasPrefix(body["q"], "hi") {
+			source = "en"
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"translatedText":   body["target"] + ": " + body["q"],
+			"detectedLanguage": map[string]any{"language": source},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	translator, err := translate.New(translate.Config{Provider: translate.LibreTranslate, Endpoint: srv.URL})
+	if err != nil {
+		t.Fatalf("new translator: %v", err)
+	}
+	return translator
+}
+
+func TestPublish_TranslatesInboundMessages(t *testing.T) {
+	s := newReplayServer(t)
+	s.translator = newFakeLibreTranslate(t)
+	s.translateTo = map[string]*config.TranslateConfig{
+		"slack:ops": {To: "en", Channels: map[string]string{"C2": "de", "C3": config.TranslateOff}},
+	}
+
+	for _, event := range []protocol.Event{
+		{Service: "slack", Bot: "ops", Channel: "C1", Text: "@ops hola"},
+		{Service: "slack", Bot: "ops", Channel: "C1", Text: "@ops hi there"},
+		{Service: "slack", Bot: "ops", Channel: "C1", Text: "@ops fail"},
+		{Service: "slack", Bot: "ops", Channel: "C2", Text: "@ops buenas"},
+		{Service: "slack", Bot: "ops", Channel: "C3", Text: "@ops adiós"},
+		{Service: "slack", Bot: "other", Channel: "C1", Text: "@other hola"},
+	} {
+		event.Kind, event.Direction = "message", "in"
+		s.publish(event)
+	}
+
+	notifications, err := s.notifications.ListNotifications(store.NotificationFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("list notifications: %v", err)
+	}
+	got := make(map[string]protocol.Event)
+	for _, n := range notifications {
+		got[n.Text] = n
+	}
+	if n := got["@ops hola"]; n.TranslatedText != "en: @ops hola" || n.Language != "es" {
+		t.Errorf("expected an English translation, got %+v", n)
+	}
+	if n := got["@ops buenas"]; n.TranslatedText != "de: @ops buenas" {
+		t.Errorf("expected the channel's language, got %+v", n)
+	}
+	// Already English, a failed translation, a channel turned off and a bot
+	// without translate all stay untranslated.
+	for _, text := range []string{"@ops hi there", "@ops fail", "@ops adiós"} {
+		if n := got[text]; n.TranslatedText != "" || n.Language != "" {
+			t.Errorf("expected %q untranslated, got %+v", text, n)
+		}
+	}
+}
+
+func TestTranslateSend(t *testing.T) {
+	s := newReplayServer(t)
+	req := protocol.Request{Text: "your order shipped", Translate: "es"}
+	if err := s.translateSend(context.Background(), &req); err == nil || !strings.Contains(err.Error(), "translation backend") {
+		t.Fatalf("expected an error without a translation backend, got %v", err)
+	}
+
+	s.translator = newFakeLibreTranslate(t)
+	if err := s.translateSend(context.Background(), &req); err != nil {
+		t.Fatalf("translate send: %v", err)
+	}
+	if req.Text != "es: your order shipped" {
+		t.Fatalf("expected the translated text, got %q", req.Text)
+	}
+
+	req = protocol.Request{Text: "fail", Translate: "es"}
+	err := s.translateSend(context.Background(), &req)
+	if err == nil || errorCode(err) != protocol.CodeUpstream {
+		t.Fatalf("expected an upstream error, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/unfurl"
+)
+
+// newUnfurler builds the link unfurler for cfg, or returns nil when
+// unfurling is not configured.
+func newUnfurler(cfg config.Config) (*unfurl.Unfurler, error) {
+	if cfg.Unfurl == nil {
+		return nil, nil
+	}
+	return unfurl.New(unfurl.Config{
+		Domains:  cfg.Unfurl.Domains,
+		Timeout:  time.Duration(cfg.Unfurl.Timeout) * time.Second,
+		MaxLinks: cfg.Unfurl.MaxLinks,
+	})
+}
+
+func (s *Server) currentUnfurler() *unfurl.Unfurler {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.unfurler
+}
+
+// unfurlEvent fetches the metadata of the links in an inbound message.
+// The links that could be fetched are kept even when others failed.
+func (s *Server) unfurlEvent(key string, event *protocol.Event) error {
+	if event.Kind != "message" || event.Direction != "in" || event.Text == "" {
+		return nil
+	}
+	unfurler := s.currentUnfurler()
+	if unfurler == nil {
+		return nil
+	}
+
+	parent := s.rootCtx
+	if parent == nil {
+		parent = context.Background()
+	}
+	links, err := unfurler.Unfurl(parent, event.Text)
+	if len(links) > 0 {
+		event.Links = links
+		if err != nil {
+			log.Printf("[%s] unfurl link on %s failed: %v", key, event.Channel, err)
+		}
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/store"
+	"github.com/pantalk/pantalk/internal/unfurl"
+)
+
+func TestPublish_UnfurlsLinks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<html><head><meta property="og:title" content="Postmortem"><meta property="og:description" content="What broke on Friday."></head></html>`))
+	}))
+	defer srv.Close()
+
+	s := newReplayServer(t)
+	unfurler, err := unfurl.New(unfurl.Config{Domains: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatalf("new unfurler: %v", err)
+	}
+	s.unfurler = unfurler
+
+	publishText(s, "slack", "ops", "did you read "+srv.URL+"/postmortem ?")
+	publishText(s, "slack", "ops", "no links here")
+	s.publish(protocol.Event{Service: "slack", Bot: "ops", Kind: "message", Direction: "out", Channel: "C1", Text: "see " + srv.URL + "/mine"})
+
+	events, err := s.notifications.ListEvents(store.EventFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %+v", events)
+	}
+	links := events[0].Links
+	if len(links) != 1 || links[0].URL != srv.URL+"/postmortem" || links[0].Title != "Postmortem" || links[0].Description != "What broke on Friday." {
+		t.Fatalf("expected the postmortem link, got %+v", links)
+	}
+	if events[1].Links != nil || events[2].Links != nil {
+		t.Fatalf("expected no links on the other events, got %+v and %+v", events[1].Links, events[2].Links)
+	}
+}
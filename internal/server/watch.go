@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pantalk/pantalk/internal/config"
+)
+
+// configDebounce is how long the watcher waits after the last write before
+// reloading. Editors often emit several events (truncate, write, chmod,
+// rename) for a single save.
+const configDebounce = 500 * time.Millisecond
+
+// watchConfig reloads the daemon whenever the config file changes on disk.
+// The parent directory is watched rather than the file itself so that
+// atomic-rename saves (vim, most IDEs) keep being observed after the
+// original inode is replaced.
+func (s *Server) watchConfig(ctx context.Context) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("warning: config watcher unavailable: %v", err)
+		return
+	}
+	defer watcher.Close()
+
+	target := filepath.Clean(s.cfgPath)
+	if err := watcher.Add(filepath.Dir(target)); err != nil {
+		log.Printf("warning: watch %s: %v", filepath.Dir(target), err)
+		return
+	}
+
+	log.Printf("watching %s for changes", target)
+
+	// Fragments are watched too when the directory exists at startup. A
+	// config.d created later is picked up by the next reload but not
+	// watched until restart.
+	fragmentDir := filepath.Clean(config.FragmentDir(target))
+	if err := watcher.Add(fragmentDir); err == nil {
+		log.Printf("watching %s for changes", fragmentDir)
+	}
+
+	var debounce *time.Timer
+	defer func() {
+		if debounce != nil {
+			debounce.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !configEvent(ev, target, fragmentDir) {
+				continue
+			}
+			if debounce != nil {
+				debounce.Stop()
+			}
+			debounce = time.AfterFunc(configDebounce, func() {
+				s.triggerReload("config file change")
+			})
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("warning: config watcher: %v", err)
+		}
+	}
+}
+
+// configEvent reports whether ev changes the main config file or one of its
+// fragments. Removing a fragment counts, since its bots must go away.
+func configEvent(ev fsnotify.Event, target string, fragmentDir string) bool {
+	name := filepath.Clean(ev.Name)
+	if name == target {
+		return ev.Has(fsnotify.Write) || ev.Has(fsnotify.Create) || ev.Has(fsnotify.Rename)
+	}
+
+	if filepath.Dir(name) != fragmentDir {
+		return false
+	}
+	if ext := filepath.Ext(name); ext != ".yaml" && ext != ".yml" {
+		return false
+	}
+	return ev.Has(fsnotify.Write) || ev.Has(fsnotify.Create) || ev.Has(fsnotify.Rename) || ev.Has(fsnotify.Remove)
+}
+
+// triggerReload runs the same reload path as `pantalk reload`, logging the
+// outcome instead of returning it to a client.
+func (s *Server) triggerReload(reason string) {
+	log.Printf("reload triggered by %s", reason)
+	if err := s.reloadConfig(); err != nil {
+		log.Printf("reload failed: %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pantalk/pantalk/internal/config"
+)
+
+const watchTestConfig = `
+server:
+  socket_path: %s
+  db_path: %s
+bots:
+  - name: bot-a
+    type: custom
+    transport: mock
+    endpoint: mock://a
+`
+
+func TestDiffBots(t *testing.T) {
+	redact := true
+	prev := []config.BotConfig{
+		{Name: "ops", Type: "slack"},
+		{Name: "alerts", Type: "telegram"},
+		{Name: "bridge", Type: "matrix", AccessToken: "old"},
+	}
+	next := []config.BotConfig{
+		{Name: "ops", Type: "slack", Redact: &redact},
+		{Name: "ops", Type: "discord"},
+		{Name: "eng", Type: "slack"},
+		{Name: "bridge", Type: "matrix", AccessToken: "new"},
+	}
+
+	added, removed, changed := diffBots(prev, next)
+	if len(added) != 2 || added[0] != "discord:ops" || added[1] != "slack:eng" {
+		t.Fatalf("unexpected added: %v", added)
+	}
+	if len(removed) != 1 || removed[0] != "telegram:alerts" {
+		t.Fatalf("unexpected removed: %v", removed)
+	}
+	// Toggling redaction alone does not restart slack:ops.
+	if len(changed) != 1 || changed[0] != "matrix:bridge" {
+		t.Fatalf("unexpected changed: %v", changed)
+	}
+}
+
+func TestWatchConfig_ReloadsOnWrite(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "pantalk.yaml")
+	socketPath := filepath.Join(dir, "pantalk.sock")
+	dbPath := filepath.Join(dir, "pantalk.db")
+
+	initial := []byte(fmt.Sprintf(watchTestConfig, socketPath, dbPath))
+	if err := os.WriteFile(cfgPath, initial, 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := New(cfg, cfgPath, "", "")
+	s.rootCtx = ctx
+	if err := s.startConnectors(cfg); err != nil {
+		t.Fatalf("start connectors: %v", err)
+	}
+
+	go s.watchConfig(ctx)
+	time.Sleep(100 * time.Millisecond) // let the watcher register
+
+	updated := fmt.Sprintf(watchTestConfig, socketPath, dbPath) + `
+  - name: bot-b
+    type: custom
+    transport: mock
+    endpoint: mock://b
+`
+	if err := os.WriteFile(cfgPath, []byte(updated), 0o644); err != nil {
+		t.Fatalf("rewrite config: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := s.resolveSelector("custom", "bot-b"); err == nil {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("expected bot-b to be registered after config change")
+}
+
+func TestConfigEvent(t *testing.T) {
+	target := "/etc/pantalk/config.yaml"
+	fragments := "/etc/pantalk/config.d"
+
+	tests := []struct {
+		name string
+		ev   fsnotify.Event
+		want bool
+	}{
+		{"main write", fsnotify.Event{Name: target, Op: fsnotify.Write}, true},
+		{"main chmod", fsnotify.Event{Name: target, Op: fsnotify.Chmod}, false},
+		{"sibling file", fsnotify.Event{Name: "/etc/pantalk/other.yaml", Op: fsnotify.Write}, false},
+		{"fragment create", fsnotify.Event{Name: fragments + "/ops.yaml", Op: fsnotify.Create}, true},
+		{"fragment remove", fsnotify.Event{Name: fragments + "/ops.yml", Op: fsnotify.Remove}, true},
+		{"fragment swap file", fsnotify.Event{Name: fragments + "/.ops.yaml.swp", Op: fsnotify.Write}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := configEvent(tt.ev, target, fragments); got != tt.want {
+				t.Fatalf("configEvent(%s) = %v, want %v", tt.ev, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package skill
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// lockFile records what skill install last installed. It sits next to the
+// cache so skill update can keep a pinned ref and skill list can show the
+// installed versions.
+type lockFile struct {
+	Source      string        `json:"source"`           // git URL or local directory
+	Ref         string        `json:"ref,omitempty"`    // pinned tag, branch or commit; empty follows the latest
+	Commit      string        `json:"commit,omitempty"` // commit the skills were copied from
+	InstalledAt time.Time     `json:"installed_at"`
+	Skills      []lockedSkill `json:"skills"`
+}
+
+type lockedSkill struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"` // from the SKILL.md front matter
+}
+
+func lockPath(cachePath string) string {
+	return cachePath + ".lock.json"
+}
+
+// readLock returns the lockfile for cachePath, or a zero lockFile when
+// nothing was installed with one yet.
+func readLock(cachePath string) (lockFile, error) {
+	data, err := os.ReadFile(lockPath(cachePath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return lockFile{}, nil
+	}
+	if err != nil {
+		return lockFile{}, fmt.Errorf("read skills lockfile: %w", err)
+	}
+
+	var lock lockFile
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return lockFile{}, fmt.Errorf("parse skills lockfile %s: %w", lockPath(cachePath), err)
+	}
+	return lock, nil
+}
+
+func writeLock(cachePath string, source skillSource, ref string, skills []SkillEntry) error {
+	lock := lockFile{
+		Source:      source.Repo,
+		Ref:         ref,
+		Commit:      source.Commit,
+		InstalledAt: time.Now().UTC(),
+		Skills:      make([]lockedSkill, 0, len(skills)),
+	}
+	for _, s := range skills {
+		lock.Skills = append(lock.Skills, lockedSkill{
+			Name:    s.Name,
+			Version: skillVersion(filepath.Join(source.Dir, s.File)),
+		})
+	}
+
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(lockPath(cachePath)), 0o755); err != nil {
+		return fmt.Errorf("create lockfile directory: %w", err)
+	}
+	if err := os.WriteFile(lockPath(cachePath), append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write skills lockfile: %w", err)
+	}
+	return nil
+}
+
+// skillVersion returns the version field of a SKILL.md front matter, or ""
+// when it has none.
+func skillVersion(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != "---" {
+		return ""
+	}
+	var frontMatter strings.Builder
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "---" {
+			var fields struct {
+				Version  any `yaml:"version"`
+				Metadata struct {
+					Version any `yaml:"version"`
+				} `yaml:"metadata"`
+			}
+			if yaml.Unmarshal([]byte(frontMatter.String()), &fields) != nil {
+				return ""
+			}
+			if fields.Version == nil {
+				fields.Version = fields.Metadata.Version
+			}
+			if fields.Version == nil {
+				return ""
+			}
+			return fmt.Sprint(fields.Version)
+		}
+		frontMatter.WriteString(scanner.Text() + "\n")
+	}
+	return ""
+}
+
+// skillSource is where a set of skills was read from.
+type skillSource struct {
+	Repo   string // git URL or absolute local directory
+	Dir    string // directory holding the skills
+	Commit string // checked-out commit; empty for a directory outside git
+}
+
+// fetchSkills makes the skills of repo at ref available. A local directory
+// is used in place; with a ref it must be a git repository and is cloned
+// into the cache like a remote one.
+func fetchSkills(cachePath string, repo string, ref string) (skillSource, error) {
+	if dirExists(repo) {
+		dir, err := filepath.Abs(repo)
+		if err != nil {
+			return skillSource{}, err
+		}
+		if ref == "" {
+			return skillSource{Repo: dir, Dir: dir, Commit: gitHead(dir)}, nil
+		}
+		if !isGitRepo(dir) {
+			return skillSource{}, fmt.Errorf("--ref needs a git repository, and %s is a plain directory", dir)
+		}
+		repo = dir
+	}
+
+	if !gitAvailable() {
+		return skillSource{}, errors.New("git is required to install skills from a repository - please install git and try again")
+	}
+	if err := ensureCache(cachePath, repo, ref); err != nil {
+		return skillSource{}, err
+	}
+	return skillSource{Repo: repo, Dir: cachePath, Commit: gitHead(cachePath)}, nil
+}
+
+// gitHead returns the commit checked out in dir, or "" outside git.
+func gitHead(dir string) string {
+	if !gitAvailable() || !isGitRepo(dir) {
+		return ""
+	}
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
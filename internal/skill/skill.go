@@ -2,7 +2,6 @@ package skill
 
 import (
 	"errors"
-	"flag"
 	"fmt"
 	"io"
 	"io/fs"
@@ -12,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/manpage"
 )
 
 const defaultRepo = "https://github.com/pantalk/skills.git"
@@ -66,9 +66,11 @@ func Run(args []string) error {
 }
 
 func runInstall(args []string) error {
-	flags := flag.NewFlagSet("skill install", flag.ContinueOnError)
+	flags := manpage.NewFlagSet("skill install")
 	cache := flags.String("cache", defaultCachePath, "local cache directory for the skills repository")
-	repo := flags.String("repo", defaultRepo, "git repository URL to clone")
+	configPath := flags.String("config", config.DefaultConfigPath(), "config whose socket and bots the skills are rendered with")
+	repo := flags.String("repo", defaultRepo, "git repository URL or local directory to install from")
+	ref := flags.String("ref", "", "tag, branch or commit to pin the skills to (default: latest)")
 	scope := flags.String("scope", "project", "install scope: project, user, or all")
 	agents := flags.String("agents", "", "comma-separated agent targets (github,cursor,claude,codex); empty = auto-detect")
 	dryRun := flags.Bool("dry-run", false, "show what would be installed without writing files")
@@ -76,20 +78,17 @@ func runInstall(args []string) error {
 		return err
 	}
 
-	if !gitAvailable() {
-		return errors.New("git is required to install skills - please install git and try again")
-	}
-
-	// Step 1: Clone or update the skills repo cache.
+	// Step 1: Clone or update the skills repo cache, or use a local directory.
 	cachePath := strings.TrimSpace(*cache)
-	if err := ensureCache(cachePath, strings.TrimSpace(*repo)); err != nil {
+	source, err := fetchSkills(cachePath, strings.TrimSpace(*repo), strings.TrimSpace(*ref))
+	if err != nil {
 		return err
 	}
 
-	// Step 2: Discover skills from the cache.
-	skills, err := discoverSkills(cachePath)
+	// Step 2: Discover skills from the source.
+	skills, err := discoverSkills(source.Dir)
 	if err != nil {
-		return fmt.Errorf("discover skills in cache: %w", err)
+		return fmt.Errorf("discover skills in %s: %w", source.Dir, err)
 	}
 	if len(skills) == 0 {
 		return errors.New("no skills found in the repository")
@@ -104,7 +103,9 @@ func runInstall(args []string) error {
 		return errors.New("no agent directories found - use --scope user to install into home directory or --agents to specify targets")
 	}
 
-	// Step 4: Copy skills into each target directory.
+	// Step 4: Render skills with this install's values and copy them into
+	// each target directory.
+	data := loadTemplateData(*configPath)
 	installed := 0
 	for _, target := range targets {
 		dest := filepath.Join(target, skillsSubdir)
@@ -112,7 +113,7 @@ func runInstall(args []string) error {
 			fmt.Printf("[dry-run] would install %d skills into %s\n", len(skills), dest)
 			continue
 		}
-		if err := copySkills(cachePath, skills, dest); err != nil {
+		if err := copySkills(source.Dir, skills, dest, data); err != nil {
 			fmt.Fprintf(os.Stderr, "warning: failed to install into %s: %v\n", dest, err)
 			continue
 		}
@@ -128,35 +129,46 @@ func runInstall(args []string) error {
 		return errors.New("failed to install skills into any target directory")
 	}
 
-	return nil
+	return writeLock(cachePath, source, strings.TrimSpace(*ref), skills)
 }
 
 func runUpdate(args []string) error {
-	flags := flag.NewFlagSet("skill update", flag.ContinueOnError)
+	flags := manpage.NewFlagSet("skill update")
 	cache := flags.String("cache", defaultCachePath, "local cache directory for the skills repository")
+	configPath := flags.String("config", config.DefaultConfigPath(), "config whose socket and bots the skills are rendered with")
 	scope := flags.String("scope", "project", "update scope: project, user, or all")
 	agents := flags.String("agents", "", "comma-separated agent targets; empty = auto-detect")
+	latest := flags.Bool("latest", false, "update to the latest skills this once even if install pinned a --ref")
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
 
-	if !gitAvailable() {
-		return errors.New("git is required to update skills")
-	}
-
 	cachePath := strings.TrimSpace(*cache)
 
-	if !isGitRepo(cachePath) {
+	lock, err := readLock(cachePath)
+	if err != nil {
+		return err
+	}
+	// Caches from before the lockfile are updated from their own origin.
+	if lock.Source == "" && !isGitRepo(cachePath) {
 		return fmt.Errorf("no skills cache found at %s - run 'skill install' first", cachePath)
 	}
 
-	if err := gitPull(cachePath); err != nil {
+	ref := lock.Ref
+	if *latest {
+		ref = ""
+	} else if ref != "" {
+		fmt.Printf("skills are pinned to %s - use --latest to update past it\n", ref)
+	}
+
+	source, err := fetchSkills(cachePath, lock.Source, ref)
+	if err != nil {
 		return err
 	}
 
-	skills, err := discoverSkills(cachePath)
+	skills, err := discoverSkills(source.Dir)
 	if err != nil {
-		return fmt.Errorf("discover skills in cache: %w", err)
+		return fmt.Errorf("discover skills in %s: %w", source.Dir, err)
 	}
 
 	targets, err := resolveTargets(*scope, *agents)
@@ -164,10 +176,11 @@ func runUpdate(args []string) error {
 		return err
 	}
 
+	data := loadTemplateData(*configPath)
 	updated := 0
 	for _, target := range targets {
 		dest := filepath.Join(target, skillsSubdir)
-		if err := copySkills(cachePath, skills, dest); err != nil {
+		if err := copySkills(source.Dir, skills, dest, data); err != nil {
 			fmt.Fprintf(os.Stderr, "warning: failed to update %s: %v\n", dest, err)
 			continue
 		}
@@ -179,11 +192,12 @@ func runUpdate(args []string) error {
 		return errors.New("failed to update skills in any target directory")
 	}
 
-	return nil
+	// --latest moves past the pin this once; later updates keep to it.
+	return writeLock(cachePath, source, lock.Ref, skills)
 }
 
 func runList(args []string) error {
-	flags := flag.NewFlagSet("skill list", flag.ContinueOnError)
+	flags := manpage.NewFlagSet("skill list")
 	cache := flags.String("cache", defaultCachePath, "local cache directory for the skills repository")
 	if err := flags.Parse(args); err != nil {
 		return err
@@ -191,11 +205,20 @@ func runList(args []string) error {
 
 	cachePath := strings.TrimSpace(*cache)
 
-	if !dirExists(cachePath) {
+	lock, err := readLock(cachePath)
+	if err != nil {
+		return err
+	}
+	skillsDir := cachePath
+	if dirExists(lock.Source) {
+		skillsDir = lock.Source
+	}
+
+	if !dirExists(skillsDir) {
 		return errors.New("skills not installed - run 'pantalk skill install' first")
 	}
 
-	skills, err := discoverSkills(cachePath)
+	skills, err := discoverSkills(skillsDir)
 	if err != nil {
 		return err
 	}
@@ -205,9 +228,33 @@ func runList(args []string) error {
 		return nil
 	}
 
+	if lock.Source != "" {
+		fmt.Printf("source: %s", lock.Source)
+		if lock.Ref != "" {
+			fmt.Printf(" (pinned to %s)", lock.Ref)
+		}
+		if lock.Commit != "" {
+			fmt.Printf(" at %s", shortCommit(lock.Commit))
+		}
+		fmt.Println()
+	}
+
+	versions := make(map[string]string, len(lock.Skills))
+	for _, locked := range lock.Skills {
+		versions[locked.Name] = locked.Version
+	}
+
 	fmt.Println("available skills:")
 	for _, s := range skills {
-		fmt.Printf("  %s\t%s\n", s.Name, s.File)
+		version, installed := versions[s.Name]
+		switch {
+		case version != "":
+			fmt.Printf("  %s\t%s\tinstalled %s\n", s.Name, s.File, version)
+		case installed:
+			fmt.Printf("  %s\t%s\tinstalled\n", s.Name, s.File)
+		default:
+			fmt.Printf("  %s\t%s\n", s.Name, s.File)
+		}
 	}
 
 	fmt.Println()
@@ -325,7 +372,8 @@ type SkillEntry struct {
 	Dir  string // relative path to the skill directory
 }
 
-// discoverSkills walks the cache directory looking for SKILL.md files.
+// discoverSkills walks the cache directory looking for SKILL.md files, or
+// SKILL.md.tmpl ones rendered at install time.
 func discoverSkills(root string) ([]SkillEntry, error) {
 	var skills []SkillEntry
 
@@ -343,7 +391,7 @@ func discoverSkills(root string) ([]SkillEntry, error) {
 			return nil
 		}
 
-		if strings.ToUpper(d.Name()) == "SKILL.MD" {
+		if upper := strings.ToUpper(d.Name()); upper == "SKILL.MD" || upper == "SKILL.MD"+strings.ToUpper(templateExt) {
 			rel, relErr := filepath.Rel(root, path)
 			if relErr != nil {
 				rel = path
@@ -364,8 +412,9 @@ func discoverSkills(root string) ([]SkillEntry, error) {
 	return skills, err
 }
 
-// copySkills copies each skill directory from the cache into the destination.
-func copySkills(cacheRoot string, skills []SkillEntry, dest string) error {
+// copySkills copies each skill directory from the cache into the destination,
+// rendering markdown templates with data.
+func copySkills(cacheRoot string, skills []SkillEntry, dest string, data *templateData) error {
 	for _, s := range skills {
 		srcDir := filepath.Join(cacheRoot, s.Dir)
 		dstDir := filepath.Join(dest, s.Name)
@@ -374,7 +423,7 @@ func copySkills(cacheRoot string, skills []SkillEntry, dest string) error {
 			return fmt.Errorf("create directory %s: %w", dstDir, err)
 		}
 
-		if err := copyDir(srcDir, dstDir); err != nil {
+		if err := copyDir(srcDir, dstDir, data); err != nil {
 			return fmt.Errorf("copy skill %s: %w", s.Name, err)
 		}
 	}
@@ -382,8 +431,11 @@ func copySkills(cacheRoot string, skills []SkillEntry, dest string) error {
 	return nil
 }
 
-// copyDir recursively copies the contents of src into dst.
-func copyDir(src string, dst string) error {
+// copyDir recursively copies the contents of src into dst. Markdown
+// templates (.md.tmpl) are rendered with data, when it isn't nil, into the
+// .md file of the same name; other markdown is copied as it is, so a skill
+// doesn't have to escape shell snippets such as [[ -n "$x" ]].
+func copyDir(src string, dst string, data *templateData) error {
 	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -400,10 +452,25 @@ func copyDir(src string, dst string) error {
 			return os.MkdirAll(target, 0o755)
 		}
 
+		if data != nil && isTemplate(path) {
+			return renderFile(path, strings.TrimSuffix(target, filepath.Ext(target)), data)
+		}
 		return copyFile(path, target)
 	})
 }
 
+func renderFile(src string, dst string, data *templateData) error {
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	rendered, err := renderSkill(filepath.Base(src), content, data)
+	if err != nil {
+		return fmt.Errorf("render %s: %w", src, err)
+	}
+	return os.WriteFile(dst, rendered, 0o644)
+}
+
 // copyFile copies a single file from src to dst.
 func copyFile(src string, dst string) error {
 	in, err := os.Open(src)
@@ -425,12 +492,18 @@ func copyFile(src string, dst string) error {
 	return out.Close()
 }
 
-// ensureCache clones the skills repo into cachePath if not present, or pulls
-// latest if already cached.
-func ensureCache(cachePath string, repoURL string) error {
+// ensureCache clones the skills repo into cachePath if not present, or
+// fetches it if already cached, and checks out ref (the latest when empty).
+// An empty repoURL keeps the cache's origin.
+func ensureCache(cachePath string, repoURL string, ref string) error {
 	if isGitRepo(cachePath) {
 		fmt.Printf("updating skills cache at %s\n", cachePath)
-		return gitPull(cachePath)
+		if repoURL != "" {
+			if err := git(cachePath, "remote", "set-url", "origin", repoURL); err != nil {
+				return err
+			}
+		}
+		return gitCheckout(cachePath, ref)
 	}
 
 	if dirExists(cachePath) {
@@ -440,7 +513,16 @@ func ensureCache(cachePath string, repoURL string) error {
 		}
 	}
 
-	return gitClone(repoURL, cachePath)
+	if repoURL == "" {
+		repoURL = defaultRepo
+	}
+	if err := gitClone(repoURL, cachePath); err != nil {
+		return err
+	}
+	if ref == "" {
+		return nil
+	}
+	return gitCheckout(cachePath, ref)
 }
 
 // findProjectRoot walks up from the current working directory looking for a
@@ -497,18 +579,37 @@ func gitClone(repo string, dest string) error {
 	return nil
 }
 
-func gitPull(dir string) error {
-	cmd := exec.Command("git", "-C", dir, "pull", "--ff-only")
+// gitCheckout fetches ref from origin (its default branch when empty) and
+// checks it out detached, which works alike for tags, branches and commits.
+func gitCheckout(dir string, ref string) error {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if err := git(dir, "fetch", "--depth", "1", "origin", ref); err != nil {
+		return err
+	}
+	return git(dir, "checkout", "--quiet", "--detach", "FETCH_HEAD")
+}
+
+func git(dir string, args ...string) error {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("git pull failed: %w", err)
+		return fmt.Errorf("git %s failed: %w", args[0], err)
 	}
 
 	return nil
 }
 
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
+
 func parseCSV(value string) []string {
 	if strings.TrimSpace(value) == "" {
 		return nil
@@ -528,12 +629,12 @@ func printUsage() {
 	fmt.Print(`pantalk skill commands
 
 Usage:
-  pantalk skill install [--scope project|user|all] [--agents github,cursor,claude,codex] [--repo URL] [--dry-run]
-  pantalk skill update  [--scope project|user|all] [--agents github,cursor,claude,codex]
+  pantalk skill install [--scope project|user|all] [--agents github,cursor,claude,codex] [--repo URL|DIR] [--ref REF] [--config PATH] [--dry-run]
+  pantalk skill update  [--scope project|user|all] [--agents github,cursor,claude,codex] [--config PATH] [--latest]
   pantalk skill list
 
-The install command clones the pantalk skills repository and copies skill
-files into the appropriate AI agent directories:
+The install command clones the pantalk skills repository (or reads a local
+directory) and copies skill files into the appropriate AI agent directories:
 
   Project-level (relative to git root):
     .github/skills/    (GitHub Copilot)
@@ -556,7 +657,19 @@ limit to specific agents or --scope to choose between project and user level.
 Flags:
   --scope    project (default), user, or all
   --agents   comma-separated list: github, cursor, claude, codex
-  --repo     override skills repository URL
+  --repo     override skills repository URL, or install from a local directory
+  --ref      pin to a tag, branch or commit; skill update keeps the pin
+  --latest   (update) move past a pinned --ref to the latest skills; the pin is kept
+  --config   config whose socket path and bots the skills are rendered with
   --dry-run  show what would be installed without writing files
+
+Skill markdown named *.md.tmpl is rendered at install time into the .md
+file with [[ ]] template actions, so skills can show the real socket path
+and bots from --config: [[.Socket]], [[.Config]], [[.Bot.Name]],
+[[.Services]] and [[range .Bots]][[.Name]] ([[.Type]]) [[end]]. Plain .md
+files are copied as they are.
+
+What was installed, and from where, is recorded in a lockfile next to the
+cache (e.g. ~/.cache/pantalk/skills.lock.json).
 `)
 }
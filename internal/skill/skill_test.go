@@ -0,0 +1,257 @@
+package skill
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSkill(t *testing.T, dir string, name string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, name), 0o755); err != nil {
+		t.Fatalf("create skill dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name, "SKILL.md"), []byte(content), 0o644); err != nil {
+		t.Fatalf("write skill: %v", err)
+	}
+}
+
+func TestInstallFromLocalDirectory(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".claude"), 0o755); err != nil {
+		t.Fatalf("create agent dir: %v", err)
+	}
+
+	src := t.TempDir()
+	writeSkill(t, src, "pantalk-send", "---\nname: pantalk-send\nversion: 1.2.0\n---\nSend messages.\n")
+	writeSkill(t, src, "pantalk-read", "---\nname: pantalk-read\nmetadata:\n  version: \"0.3\"\n---\nRead messages.\n")
+	cache := filepath.Join(t.TempDir(), "skills")
+
+	if err := runInstall([]string{"--scope", "user", "--repo", src, "--cache", cache, "--config", filepath.Join(home, "none.yaml")}); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".claude", "skills", "pantalk-send", "SKILL.md")); err != nil {
+		t.Fatalf("skill not installed: %v", err)
+	}
+	if dirExists(cache) {
+		t.Fatal("a local directory should be used in place, not cached")
+	}
+
+	lock, err := readLock(cache)
+	if err != nil {
+		t.Fatalf("read lock: %v", err)
+	}
+	if lock.Source != src || lock.Ref != "" {
+		t.Fatalf("unexpected lock source: %+v", lock)
+	}
+	versions := map[string]string{}
+	for _, s := range lock.Skills {
+		versions[s.Name] = s.Version
+	}
+	if versions["pantalk-send"] != "1.2.0" || versions["pantalk-read"] != "0.3" {
+		t.Fatalf("unexpected versions: %v", versions)
+	}
+
+	// update reads the source from the lockfile.
+	writeSkill(t, src, "pantalk-send", "---\nname: pantalk-send\nversion: 1.3.0\n---\nSend messages.\n")
+	if err := runUpdate([]string{"--scope", "user", "--cache", cache, "--config", filepath.Join(home, "none.yaml")}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	lock, err = readLock(cache)
+	if err != nil {
+		t.Fatalf("read lock: %v", err)
+	}
+	for _, s := range lock.Skills {
+		if s.Name == "pantalk-send" && s.Version != "1.3.0" {
+			t.Fatalf("expected updated version, got %q", s.Version)
+		}
+	}
+}
+
+// skillsRepo makes a git repository with a pantalk-send skill at version
+// 1.0.0, tagged v1, and a later commit at 2.0.0.
+func skillsRepo(t *testing.T) string {
+	t.Helper()
+	if !gitAvailable() {
+		t.Skip("git not installed")
+	}
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	repo := t.TempDir()
+	run := func(args ...string) {
+		t.Helper()
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	run("init", "--quiet")
+	writeSkill(t, repo, "pantalk-send", "---\nname: pantalk-send\nversion: 1.0.0\n---\nSend messages.\n")
+	run("add", "-A")
+	run("commit", "--quiet", "-m", "v1")
+	run("tag", "v1")
+	writeSkill(t, repo, "pantalk-send", "---\nname: pantalk-send\nversion: 2.0.0\n---\nSend messages.\n")
+	run("commit", "--quiet", "-am", "v2")
+	return repo
+}
+
+// installedVersion returns the version of pantalk-send in the lockfile.
+func installedVersion(t *testing.T, cache string) (string, lockFile) {
+	t.Helper()
+	lock, err := readLock(cache)
+	if err != nil {
+		t.Fatalf("read lock: %v", err)
+	}
+	for _, s := range lock.Skills {
+		if s.Name == "pantalk-send" {
+			return s.Version, lock
+		}
+	}
+	t.Fatalf("pantalk-send not in lock %+v", lock)
+	return "", lock
+}
+
+func TestInstallPinnedRef(t *testing.T) {
+	repo := skillsRepo(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".claude"), 0o755); err != nil {
+		t.Fatalf("create agent dir: %v", err)
+	}
+	cache := filepath.Join(t.TempDir(), "skills")
+	noConfig := filepath.Join(home, "none.yaml")
+
+	if err := runInstall([]string{"--scope", "user", "--repo", repo, "--ref", "v1", "--cache", cache, "--config", noConfig}); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	if version, lock := installedVersion(t, cache); version != "1.0.0" || lock.Ref != "v1" || lock.Source != repo {
+		t.Fatalf("expected v1 installed and pinned, got version %q, lock %+v", version, lock)
+	}
+	installed, err := os.ReadFile(filepath.Join(home, ".claude", "skills", "pantalk-send", "SKILL.md"))
+	if err != nil || !strings.Contains(string(installed), "version: 1.0.0") {
+		t.Fatalf("expected the pinned skill installed, got %q (%v)", installed, err)
+	}
+
+	// update keeps to the pin.
+	if err := runUpdate([]string{"--scope", "user", "--cache", cache, "--config", noConfig}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if version, lock := installedVersion(t, cache); version != "1.0.0" || lock.Ref != "v1" {
+		t.Fatalf("expected update to stay on v1, got version %q, lock %+v", version, lock)
+	}
+
+	// --latest moves past it this once, and the pin stays for the next one.
+	if err := runUpdate([]string{"--scope", "user", "--cache", cache, "--config", noConfig, "--latest"}); err != nil {
+		t.Fatalf("update --latest: %v", err)
+	}
+	if version, lock := installedVersion(t, cache); version != "2.0.0" || lock.Ref != "v1" {
+		t.Fatalf("expected the latest skills with the pin kept, got version %q, lock %+v", version, lock)
+	}
+	if err := runUpdate([]string{"--scope", "user", "--cache", cache, "--config", noConfig}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if version, _ := installedVersion(t, cache); version != "1.0.0" {
+		t.Fatalf("expected the next update back on v1, got %q", version)
+	}
+}
+
+func TestInstallRefNeedsGit(t *testing.T) {
+	src := t.TempDir()
+	writeSkill(t, src, "pantalk-send", "Send messages.\n")
+
+	_, err := fetchSkills(filepath.Join(t.TempDir(), "skills"), src, "v1.0.0")
+	if err == nil {
+		t.Fatal("expected --ref on a plain directory to fail")
+	}
+}
+
+func TestRenderSkill(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	config := `
+server:
+  socket_path: /run/team/pantalk.sock
+bots:
+  - name: ops-bot
+    type: slack
+    bot_token: xoxb-test
+    app_level_token: xapp-test
+  - name: alerts
+    type: telegram
+    bot_token: tok
+`
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	data := loadTemplateData(configPath)
+	skill := "Socket: [[.Socket]]\nSend: pantalk send --bot [[.Bot.Name]]\nBots:[[range .Bots]] [[.Name]]/[[.Type]][[end]]\nReply template: {{.Output}}\n"
+	out, err := renderSkill("SKILL.md", []byte(skill), data)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+
+	want := "Socket: /run/team/pantalk.sock\nSend: pantalk send --bot ops-bot\nBots: ops-bot/slack alerts/telegram\nReply template: {{.Output}}\n"
+	if string(out) != want {
+		t.Fatalf("unexpected render:\n%s\nwant:\n%s", out, want)
+	}
+	if len(data.Services) != 2 || data.Services[0] != "slack" || data.Services[1] != "telegram" {
+		t.Fatalf("unexpected services: %v", data.Services)
+	}
+
+	if _, err := renderSkill("SKILL.md", []byte("[[.Missing]]"), data); err == nil {
+		t.Fatal("expected an error for an unknown field")
+	}
+}
+
+func TestCopyDir_RendersOnlyTemplates(t *testing.T) {
+	src := t.TempDir()
+	bash := "```bash\nif [[ -n \"$PANTALK_BOT\" ]]; then\n  pantalk send --bot \"$PANTALK_BOT\"\nfi\n```\n"
+	if err := os.WriteFile(filepath.Join(src, "SKILL.md"), []byte(bash), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "setup.md.tmpl"), []byte("Socket: [[.Socket]]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := t.TempDir()
+	if err := copyDir(src, dst, &templateData{Socket: "/run/pantalk.sock"}); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+
+	if got, _ := os.ReadFile(filepath.Join(dst, "SKILL.md")); string(got) != bash {
+		t.Fatalf("expected plain markdown copied as it is, got:\n%s", got)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dst, "setup.md")); string(got) != "Socket: /run/pantalk.sock\n" {
+		t.Fatalf("expected the template rendered into setup.md, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "setup.md.tmpl")); !os.IsNotExist(err) {
+		t.Fatalf("expected no template installed, got %v", err)
+	}
+}
+
+func TestDiscoverSkills_FindsTemplates(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "send-message"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "send-message", "SKILL.md.tmpl"), []byte("[[.Socket]]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	skills, err := discoverSkills(root)
+	if err != nil || len(skills) != 1 || skills[0].Name != "send-message" {
+		t.Fatalf("expected the templated skill found, got %+v, %v", skills, err)
+	}
+}
+
+func TestLoadTemplateData_WithoutConfig(t *testing.T) {
+	data := loadTemplateData(filepath.Join(t.TempDir(), "missing.yaml"))
+	if data.Socket == "" || len(data.Bots) != 0 {
+		t.Fatalf("unexpected fallback data: %+v", data)
+	}
+}
@@ -0,0 +1,89 @@
+package skill
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/pantalk/pantalk/internal/config"
+)
+
+// Skill markdown is rendered with [[ ]] delimiters so it can still show
+// {{ }} examples for pantalk's own templates, such as reply_template.
+const (
+	templateLeft  = "[["
+	templateRight = "]]"
+)
+
+// templateExt marks the markdown files that are templates: SKILL.md.tmpl
+// is installed rendered as SKILL.md. Templating is opt-in since plain
+// markdown often has [[ ]] of its own, as in bash conditionals.
+const templateExt = ".tmpl"
+
+// isTemplate reports whether the skill file at path is a markdown template.
+func isTemplate(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".md"+templateExt)
+}
+
+// templateData is what skill templates can refer to, e.g. [[.Socket]] or
+// [[range .Bots]]- [[.Name]] ([[.Type]])[[end]].
+type templateData struct {
+	Socket   string        // the daemon's socket path
+	Config   string        // the config file the values were read from
+	Bots     []templateBot // configured bots, in config order
+	Bot      templateBot   // the first bot, for examples; zero without bots
+	Services []string      // distinct bot types, e.g. slack and telegram
+}
+
+type templateBot struct {
+	Name        string
+	Type        string
+	DisplayName string
+	Channels    []string
+}
+
+// loadTemplateData reads the values skills are rendered with from the
+// config at path. Without a usable config (skills are often installed
+// before setup) it falls back to the default socket and no bots.
+func loadTemplateData(path string) *templateData {
+	data := &templateData{Socket: config.DefaultSocketPath(), Config: path}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "note: rendering skills without config values: %v\n", err)
+		return data
+	}
+
+	data.Socket = cfg.Server.SocketPath
+	for _, bot := range cfg.Bots {
+		data.Bots = append(data.Bots, templateBot{
+			Name:        bot.Name,
+			Type:        bot.Type,
+			DisplayName: bot.DisplayName,
+			Channels:    bot.Channels,
+		})
+		if !slices.Contains(data.Services, bot.Type) {
+			data.Services = append(data.Services, bot.Type)
+		}
+	}
+	if len(data.Bots) > 0 {
+		data.Bot = data.Bots[0]
+	}
+	return data
+}
+
+// renderSkill renders a skill markdown file with data.
+func renderSkill(name string, content []byte, data *templateData) ([]byte, error) {
+	tmpl, err := template.New(name).Delims(templateLeft, templateRight).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
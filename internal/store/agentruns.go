@@ -0,0 +1,127 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// agentRunsKept is how many runs are kept per agent; older ones are dropped
+// as new runs are recorded.
+const agentRunsKept = 500
+
+// InsertAgentRun records a finished agent run and returns its ID.
+func (s *Store) InsertAgentRun(run protocol.AgentRun) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.Exec(`
+INSERT INTO agent_runs (agent, started_utc, finished_utc, exit_code, triggers, error, output)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+`, run.Agent,
+		run.StartedAt.UTC().Format(time.RFC3339Nano),
+		run.FinishedAt.UTC().Format(time.RFC3339Nano),
+		run.ExitCode,
+		run.Triggers,
+		run.Error,
+		run.Output,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("insert agent run: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("read inserted agent run id: %w", err)
+	}
+
+	if _, err := s.db.Exec(`
+DELETE FROM agent_runs
+WHERE agent = ? AND id NOT IN (
+	SELECT id FROM agent_runs WHERE agent = ? ORDER BY id DESC LIMIT ?
+)
+`, run.Agent, run.Agent, agentRunsKept); err != nil {
+		return 0, fmt.Errorf("prune agent runs: %w", err)
+	}
+
+	return id, nil
+}
+
+// ListAgentRuns returns the most recent runs, oldest first, optionally for
+// one agent only.
+func (s *Store) ListAgentRuns(agent string, limit int) ([]protocol.AgentRun, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	query := `
+SELECT id, agent, started_utc, finished_utc, exit_code, triggers, error, output
+FROM agent_runs`
+	args := []any{}
+	if agent != "" {
+		query += `
+WHERE agent = ?`
+		args = append(args, agent)
+	}
+	query += `
+ORDER BY id DESC
+LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list agent runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []protocol.AgentRun
+	for rows.Next() {
+		run, err := scanAgentRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate agent runs: %w", err)
+	}
+
+	for left, right := 0, len(runs)-1; left < right; left, right = left+1, right-1 {
+		runs[left], runs[right] = runs[right], runs[left]
+	}
+
+	return runs, nil
+}
+
+func scanAgentRun(rows *sql.Rows) (protocol.AgentRun, error) {
+	var (
+		run         protocol.AgentRun
+		startedRaw  string
+		finishedRaw string
+	)
+
+	if err := rows.Scan(
+		&run.ID,
+		&run.Agent,
+		&startedRaw,
+		&finishedRaw,
+		&run.ExitCode,
+		&run.Triggers,
+		&run.Error,
+		&run.Output,
+	); err != nil {
+		return protocol.AgentRun{}, fmt.Errorf("scan agent run row: %w", err)
+	}
+
+	var err error
+	if run.StartedAt, err = time.Parse(time.RFC3339Nano, startedRaw); err != nil {
+		return protocol.AgentRun{}, fmt.Errorf("parse agent run start: %w", err)
+	}
+	if run.FinishedAt, err = time.Parse(time.RFC3339Nano, finishedRaw); err != nil {
+		return protocol.AgentRun{}, fmt.Errorf("parse agent run finish: %w", err)
+	}
+
+	return run, nil
+}
@@ -0,0 +1,75 @@
+package store
+
+import "fmt"
+
+// FsckReport describes the consistency problems found by Fsck.
+type FsckReport struct {
+	// OrphanNotifications reference an event that no longer exists. Older
+	// versions left them behind when history was cleared.
+	OrphanNotifications int64
+	// Integrity lists the problems reported by SQLite's integrity check;
+	// empty when the database file is sound.
+	Integrity []string
+	// Repaired is the number of orphans deleted.
+	Repaired int64
+	// Vacuumed is set when the file was compacted after a repair.
+	Vacuumed bool
+}
+
+// Clean reports whether nothing needed repair.
+func (r FsckReport) Clean() bool {
+	return r.OrphanNotifications == 0 && len(r.Integrity) == 0
+}
+
+// Fsck checks the database for orphaned notifications and file corruption.
+// With repair, orphans are deleted and the file is vacuumed to reclaim their
+// space. Corruption is only reported; restore from a backup instead.
+func (s *Store) Fsck(repair bool) (FsckReport, error) {
+	var report FsckReport
+
+	rows, err := s.db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return report, fmt.Errorf("integrity check: %w", err)
+	}
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			rows.Close()
+			return report, fmt.Errorf("integrity check: %w", err)
+		}
+		if line != "ok" {
+			report.Integrity = append(report.Integrity, line)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, fmt.Errorf("integrity check: %w", err)
+	}
+
+	const orphans = `FROM notifications WHERE NOT EXISTS (SELECT 1 FROM events WHERE events.id = notifications.event_id)`
+
+	if err := s.db.QueryRow(`SELECT COUNT(*) ` + orphans).Scan(&report.OrphanNotifications); err != nil {
+		return report, fmt.Errorf("count orphan notifications: %w", err)
+	}
+
+	if !repair || report.OrphanNotifications == 0 {
+		return report, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.Exec(`DELETE ` + orphans)
+	if err != nil {
+		return report, fmt.Errorf("delete orphan notifications: %w", err)
+	}
+	if report.Repaired, err = result.RowsAffected(); err != nil {
+		return report, fmt.Errorf("read affected rows: %w", err)
+	}
+
+	if _, err := s.db.Exec(`VACUUM`); err != nil {
+		return report, fmt.Errorf("vacuum: %w", err)
+	}
+	report.Vacuumed = true
+	return report, nil
+}
@@ -0,0 +1,314 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+)
+
+// migration is one numbered step of the schema. Steps are applied in order,
+// each in its own transaction together with its schema_version row, and are
+// never edited once released: change the schema by appending a step.
+type migration struct {
+	version int
+	name    string
+	apply   func(tx *sql.Tx) error
+}
+
+// migrations is the schema history. Databases created before versioning
+// have no schema_version table and already hold some of these changes, so
+// the first four steps are written to be no-ops on them.
+var migrations = []migration{
+	{1, "create events, notifications and agent_runs", execSQL(`
+CREATE TABLE IF NOT EXISTS events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp_utc TEXT NOT NULL,
+	service TEXT NOT NULL,
+	bot TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	direction TEXT NOT NULL,
+	user TEXT NOT NULL DEFAULT '',
+	target TEXT,
+	channel TEXT,
+	thread TEXT,
+	mentions_agent INTEGER NOT NULL DEFAULT 0,
+	direct_to_agent INTEGER NOT NULL DEFAULT 0,
+	notify INTEGER NOT NULL DEFAULT 0,
+	text TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_events_scope ON events(service, bot, id);
+CREATE INDEX IF NOT EXISTS idx_events_notify ON events(service, bot, notify, id);
+CREATE INDEX IF NOT EXISTS idx_events_direction ON events(service, bot, direction, id);
+CREATE INDEX IF NOT EXISTS idx_events_kind ON events(service, bot, kind, id);
+CREATE INDEX IF NOT EXISTS idx_events_channel ON events(service, bot, channel, id);
+CREATE INDEX IF NOT EXISTS idx_events_thread ON events(thread, service, bot);
+CREATE INDEX IF NOT EXISTS idx_events_notify_only ON events(id) WHERE notify = 1;
+
+CREATE TABLE IF NOT EXISTS notifications (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	event_id INTEGER NOT NULL,
+	timestamp_utc TEXT NOT NULL,
+	service TEXT NOT NULL,
+	bot TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	direction TEXT NOT NULL,
+	user TEXT NOT NULL DEFAULT '',
+	target TEXT,
+	channel TEXT,
+	thread TEXT,
+	text TEXT NOT NULL,
+	mentions_agent INTEGER NOT NULL DEFAULT 0,
+	direct_to_agent INTEGER NOT NULL DEFAULT 0,
+	notify INTEGER NOT NULL DEFAULT 1,
+	seen INTEGER NOT NULL DEFAULT 0,
+	seen_at TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_scope ON notifications(service, bot, id);
+CREATE INDEX IF NOT EXISTS idx_notifications_seen ON notifications(service, bot, seen, id);
+CREATE INDEX IF NOT EXISTS idx_notifications_event ON notifications(event_id);
+
+-- Clearing history takes the notifications of the deleted events with it.
+-- A trigger rather than a foreign key, which SQLite can't add to an
+-- existing table and only enforces per connection.
+CREATE TRIGGER IF NOT EXISTS events_delete_notifications AFTER DELETE ON events
+BEGIN
+	DELETE FROM notifications WHERE event_id = OLD.id;
+END;
+
+CREATE TABLE IF NOT EXISTS agent_runs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	agent TEXT NOT NULL,
+	started_utc TEXT NOT NULL,
+	finished_utc TEXT NOT NULL,
+	exit_code INTEGER NOT NULL DEFAULT 0,
+	triggers INTEGER NOT NULL DEFAULT 0,
+	error TEXT NOT NULL DEFAULT '',
+	output TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_agent_runs_agent ON agent_runs(agent, id);
+`)},
+	{2, "add notifications.collapsed", addColumn("notifications", "collapsed", "INTEGER NOT NULL DEFAULT 0")},
+	{3, "add notifications.snoozed_until", addColumn("notifications", "snoozed_until", "TEXT")},
+	{4, "add events.attachments", addColumn("events", "attachments", "TEXT NOT NULL DEFAULT ''")},
+	{5, "add events.notify_reason", addColumn("events", "notify_reason", "TEXT NOT NULL DEFAULT ''")},
+	{6, "add notifications.notify_reason", addColumn("notifications", "notify_reason", "TEXT NOT NULL DEFAULT ''")},
+	{7, "add events.message_id", addColumn("events", "message_id", "TEXT NOT NULL DEFAULT ''")},
+	{8, "add notifications.message_id", addColumn("notifications", "message_id", "TEXT NOT NULL DEFAULT ''")},
+	{9, "add notifications.priority", addColumn("notifications", "priority", "TEXT NOT NULL DEFAULT ''")},
+	{10, "add notifications.labels", addColumn("notifications", "labels", "TEXT NOT NULL DEFAULT ''")},
+	{11, "add events.translated_text", addColumn("events", "translated_text", "TEXT NOT NULL DEFAULT ''")},
+	{12, "add events.language", addColumn("events", "language", "TEXT NOT NULL DEFAULT ''")},
+	{13, "add notifications.translated_text", addColumn("notifications", "translated_text", "TEXT NOT NULL DEFAULT ''")},
+	{14, "add notifications.language", addColumn("notifications", "language", "TEXT NOT NULL DEFAULT ''")},
+	{15, "add events.links", addColumn("events", "links", "TEXT NOT NULL DEFAULT ''")},
+	{16, "add events.trace_id", addColumn("events", "trace_id", "TEXT NOT NULL DEFAULT ''")},
+	{17, "create message_statuses", execSQL(`
+CREATE TABLE IF NOT EXISTS message_statuses (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	event_id INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	timestamp_utc TEXT NOT NULL,
+	reason TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_statuses_event ON message_statuses(event_id, id);
+CREATE INDEX IF NOT EXISTS idx_events_message ON events(message_id, service, bot);
+
+CREATE TRIGGER IF NOT EXISTS events_delete_message_statuses AFTER DELETE ON events
+BEGIN
+	DELETE FROM message_statuses WHERE event_id = OLD.id;
+END;
+`)},
+	{18, "create channel_mutes", execSQL(`
+CREATE TABLE IF NOT EXISTS channel_mutes (
+	service TEXT NOT NULL,
+	bot TEXT NOT NULL,
+	channel TEXT NOT NULL,
+	until_utc TEXT NOT NULL,
+	PRIMARY KEY (service, bot, channel)
+);
+`)},
+}
+
+// MigrationStatus is one schema step and when it was applied to a
+// database.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time // zero while pending
+}
+
+// SchemaVersion is the schema version this build creates and expects.
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// Migrate applies the pending schema steps to the database at path, as Open
+// does, and returns the steps it applied.
+func Migrate(path string) ([]MigrationStatus, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("database %s: %w", path, err)
+	}
+	db, err := openDB(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return (&Store{db: db}).migrate()
+}
+
+// SchemaStatus lists every schema step with when it was applied to the
+// database at path, without changing the database.
+func SchemaStatus(path string) ([]MigrationStatus, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("database %s: %w", path, err)
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite db: %w", err)
+	}
+	defer db.Close()
+
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		statuses = append(statuses, MigrationStatus{Version: m.version, Name: m.name, AppliedAt: applied[m.version]})
+	}
+	return statuses, nil
+}
+
+// migrate brings the schema up to date, recording each applied step in
+// schema_version. It refuses databases written by a newer pantalk.
+func (s *Store) migrate() ([]MigrationStatus, error) {
+	if _, err := s.db.Exec(`
+CREATE TABLE IF NOT EXISTS schema_version (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_utc TEXT NOT NULL
+)`); err != nil {
+		return nil, fmt.Errorf("create schema_version table: %w", err)
+	}
+
+	applied, err := appliedVersions(s.db)
+	if err != nil {
+		return nil, err
+	}
+	for version := range applied {
+		if version > SchemaVersion() {
+			return nil, fmt.Errorf("database schema version %d is newer than this pantalk supports (%d); upgrade pantalk", version, SchemaVersion())
+		}
+	}
+
+	var done []MigrationStatus
+	for _, m := range migrations {
+		if _, ok := applied[m.version]; ok {
+			continue
+		}
+		now := time.Now().UTC()
+		if err := s.applyMigration(m, now); err != nil {
+			return done, err
+		}
+		done = append(done, MigrationStatus{Version: m.version, Name: m.name, AppliedAt: now})
+	}
+	return done, nil
+}
+
+func (s *Store) applyMigration(m migration, now time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("migration %d: begin: %w", m.version, err)
+	}
+	defer tx.Rollback()
+
+	if err := m.apply(tx); err != nil {
+		return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_version (version, name, applied_utc) VALUES (?, ?, ?)`, m.version, m.name, now.Format(time.RFC3339Nano)); err != nil {
+		return fmt.Errorf("migration %d: record version: %w", m.version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("migration %d: commit: %w", m.version, err)
+	}
+	return nil
+}
+
+// appliedVersions maps the versions recorded in schema_version to when
+// they were applied. A database without the table has none.
+func appliedVersions(db *sql.DB) (map[int]time.Time, error) {
+	applied := make(map[int]time.Time)
+
+	var exists int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'`).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("read schema version: %w", err)
+	}
+	if exists == 0 {
+		return applied, nil
+	}
+
+	rows, err := db.Query(`SELECT version, applied_utc FROM schema_version`)
+	if err != nil {
+		return nil, fmt.Errorf("read schema version: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var at string
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("read schema version: %w", err)
+		}
+		applied[version], _ = time.Parse(time.RFC3339Nano, at)
+	}
+	return applied, rows.Err()
+}
+
+func execSQL(statements string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(statements)
+		return err
+	}
+}
+
+// addColumn adds a column unless the table already has it, which databases
+// from before versioning may.
+func addColumn(table string, column string, definition string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+		if err != nil {
+			return fmt.Errorf("inspect %s columns: %w", table, err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var (
+				cid        int
+				name       string
+				colType    string
+				notNull    int
+				defaultVal sql.NullString
+				pk         int
+			)
+			if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &pk); err != nil {
+				return fmt.Errorf("scan %s columns: %w", table, err)
+			}
+			if name == column {
+				return nil
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("iterate %s columns: %w", table, err)
+		}
+		rows.Close()
+
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+			return fmt.Errorf("add %s.%s column: %w", table, column, err)
+		}
+		return nil
+	}
+}
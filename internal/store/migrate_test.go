@@ -0,0 +1,89 @@
+package store
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// A database from before versioning already has the first steps applied
+// by hand; migrating it must leave its data alone and record every step.
+func TestMigrate_UnversionedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if err := migrations[0].apply(tx); err != nil {
+		t.Fatalf("create legacy schema: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if _, err := db.Exec(`ALTER TABLE notifications ADD COLUMN collapsed INTEGER NOT NULL DEFAULT 0`); err != nil {
+		t.Fatalf("alter: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO events (timestamp_utc, service, bot, kind, direction, text) VALUES ('2024-01-01T00:00:00Z', 'slack', 'ops', 'message', 'in', 'old')`); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	db.Close()
+
+	status, err := SchemaStatus(path)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	for _, m := range status {
+		if !m.AppliedAt.IsZero() {
+			t.Fatalf("expected nothing recorded before migrating, got %+v", m)
+		}
+	}
+
+	applied, err := Migrate(path)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if len(applied) != len(migrations) {
+		t.Fatalf("expected %d steps applied, got %+v", len(migrations), applied)
+	}
+	if again, err := Migrate(path); err != nil || len(again) != 0 {
+		t.Fatalf("expected a second migrate to do nothing, got %+v, %v", again, err)
+	}
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer s.Close()
+	ev := makeEvent("slack", "ops", "new", "in")
+	ev.Attachments = []protocol.Attachment{{Name: "a.txt"}}
+	if _, err := s.InsertEvent(ev); err != nil {
+		t.Fatalf("insert after migrating: %v", err)
+	}
+	events, err := s.ListEvents(EventFilter{Service: "slack", Bot: "ops", Limit: 10})
+	if err != nil || len(events) != 2 || events[0].Text != "old" {
+		t.Fatalf("unexpected events after migrating: %+v, %v", events, err)
+	}
+}
+
+func TestOpen_RejectsNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "newer.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := s.db.Exec(`INSERT INTO schema_version (version, name, applied_utc) VALUES (?, 'from the future', '2030-01-01T00:00:00Z')`, SchemaVersion()+1); err != nil {
+		t.Fatalf("insert version: %v", err)
+	}
+	s.Close()
+
+	if _, err := Open(path); err == nil || !strings.Contains(err.Error(), "newer than this pantalk") {
+		t.Fatalf("expected a newer schema refused, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// SetMute records a channel mute, replacing any earlier one of the same
+// channel, and drops the mutes that have expired. until_utc is stored with
+// second precision so the string comparison orders correctly.
+func (s *Store) SetMute(mute protocol.Mute) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.db.Exec(`
+INSERT OR REPLACE INTO channel_mutes (service, bot, channel, until_utc)
+VALUES (?, ?, ?, ?)
+`, mute.Service, mute.Bot, mute.Channel, mute.Until.UTC().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("insert channel mute: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM channel_mutes WHERE until_utc <= ?`, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("prune channel mutes: %w", err)
+	}
+	return nil
+}
+
+// DeleteMutes lifts the mutes matching service, bot and channel, where an
+// empty field matches any, and returns how many it lifted.
+func (s *Store) DeleteMutes(service string, bot string, channel string) (int64, error) {
+	where := make([]string, 0, 3)
+	args := make([]any, 0, 3)
+	if service != "" {
+		where = append(where, "service = ?")
+		args = append(args, service)
+	}
+	if bot != "" {
+		where = append(where, "bot = ?")
+		args = append(args, bot)
+	}
+	if channel != "" {
+		where = append(where, "channel = ?")
+		args = append(args, channel)
+	}
+
+	query := "DELETE FROM channel_mutes"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("delete channel mutes: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// ListMutes returns the mutes still in force at now, soonest to expire
+// first.
+func (s *Store) ListMutes(now time.Time) ([]protocol.Mute, error) {
+	rows, err := s.db.Query(`
+SELECT service, bot, channel, until_utc
+FROM channel_mutes
+WHERE until_utc > ?
+ORDER BY until_utc, service, bot, channel
+`, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("list channel mutes: %w", err)
+	}
+	defer rows.Close()
+
+	var mutes []protocol.Mute
+	for rows.Next() {
+		var mute protocol.Mute
+		var until string
+		if err := rows.Scan(&mute.Service, &mute.Bot, &mute.Channel, &until); err != nil {
+			return nil, fmt.Errorf("scan channel mute: %w", err)
+		}
+		if mute.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return nil, fmt.Errorf("parse channel mute: %w", err)
+		}
+		mutes = append(mutes, mute)
+	}
+	return mutes, rows.Err()
+}
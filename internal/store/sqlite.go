@@ -2,6 +2,7 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -15,15 +16,18 @@ import (
 )
 
 type NotificationFilter struct {
-	Service string
-	Bot     string
-	Target  string
-	Channel string
-	Thread  string
-	Search  string
-	Limit   int
-	SinceID int64
-	Unseen  bool
+	Service   string
+	Bot       string
+	Target    string
+	Channel   string
+	Thread    string
+	Search    string
+	Direction string // "in" or "out"; empty matches both
+	Kind      string
+	Limit     int
+	SinceID   int64
+	Forward   bool // with SinceID: the Limit rows right after it, not the newest
+	Unseen    bool
 }
 
 type EventFilter struct {
@@ -33,14 +37,24 @@ type EventFilter struct {
 	Channel    string
 	Thread     string
 	Search     string
+	Direction  string // "in" or "out"; empty matches both
+	Kind       string
 	Limit      int
 	SinceID    int64
+	Forward    bool  // with SinceID: the Limit rows right after it, not the newest
+	BeforeID   int64 // only events with a lower id; ignored when zero
 	NotifyOnly bool
 }
 
 type Store struct {
 	db *sql.DB
-	mu sync.Mutex
+	mu sync.Mutex // serialises writes
+
+	// Events are inserted by the writer goroutine; see startWriter.
+	writes       chan eventWrite
+	writerDone   chan struct{}
+	writeMu      sync.RWMutex // guards writerClosed against sends on writes
+	writerClosed bool
 }
 
 type NotificationStats struct {
@@ -55,76 +69,57 @@ func Open(path string) (*Store, error) {
 		}
 	}
 
-	db, err := sql.Open("sqlite3", path)
+	db, err := openDB(path)
 	if err != nil {
-		return nil, fmt.Errorf("open sqlite db: %w", err)
+		return nil, err
 	}
 
 	s := &Store{db: db}
-	if err := s.initSchema(); err != nil {
+	if _, err := s.migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	if err := s.analyze(); err != nil {
 		_ = db.Close()
 		return nil, err
 	}
 
+	s.startWriter()
 	return s, nil
 }
 
+func openDB(path string) (*sql.DB, error) {
+	// WAL lets the CLI and agents read history while the daemon writes,
+	// and with synchronous=NORMAL a commit no longer waits for an fsync
+	// (a crash can lose the last commits, never corrupt the file). The busy
+	// timeout covers writers in other processes, such as pantalk db.
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite db: %w", err)
+	}
+	if path == ":memory:" {
+		// Every connection would get its own empty database.
+		db.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
+
 func (s *Store) Close() error {
 	if s == nil || s.db == nil {
 		return nil
 	}
+	s.stopWriter()
 	return s.db.Close()
 }
 
-func (s *Store) initSchema() error {
-	_, err := s.db.Exec(`
-CREATE TABLE IF NOT EXISTS events (
-	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	timestamp_utc TEXT NOT NULL,
-	service TEXT NOT NULL,
-	bot TEXT NOT NULL,
-	kind TEXT NOT NULL,
-	direction TEXT NOT NULL,
-	user TEXT NOT NULL DEFAULT '',
-	target TEXT,
-	channel TEXT,
-	thread TEXT,
-	mentions_agent INTEGER NOT NULL DEFAULT 0,
-	direct_to_agent INTEGER NOT NULL DEFAULT 0,
-	notify INTEGER NOT NULL DEFAULT 0,
-	text TEXT NOT NULL
-);
-
-CREATE INDEX IF NOT EXISTS idx_events_scope ON events(service, bot, id);
-CREATE INDEX IF NOT EXISTS idx_events_notify ON events(service, bot, notify, id);
-
-CREATE TABLE IF NOT EXISTS notifications (
-	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	event_id INTEGER NOT NULL,
-	timestamp_utc TEXT NOT NULL,
-	service TEXT NOT NULL,
-	bot TEXT NOT NULL,
-	kind TEXT NOT NULL,
-	direction TEXT NOT NULL,
-	user TEXT NOT NULL DEFAULT '',
-	target TEXT,
-	channel TEXT,
-	thread TEXT,
-	text TEXT NOT NULL,
-	mentions_agent INTEGER NOT NULL DEFAULT 0,
-	direct_to_agent INTEGER NOT NULL DEFAULT 0,
-	notify INTEGER NOT NULL DEFAULT 1,
-	seen INTEGER NOT NULL DEFAULT 0,
-	seen_at TEXT
-);
-
-CREATE INDEX IF NOT EXISTS idx_notifications_scope ON notifications(service, bot, id);
-CREATE INDEX IF NOT EXISTS idx_notifications_seen ON notifications(service, bot, seen, id);
-`)
-	if err != nil {
-		return fmt.Errorf("init sqlite schema: %w", err)
+// analyze refreshes the planner statistics so SQLite picks the narrow
+// composite indexes over idx_events_scope on large tables. analysis_limit
+// bounds the work per index, keeping startup fast on big databases.
+func (s *Store) analyze() error {
+	if _, err := s.db.Exec(`PRAGMA analysis_limit = 1000; ANALYZE;`); err != nil {
+		return fmt.Errorf("analyze sqlite db: %w", err)
 	}
-
 	return nil
 }
 
@@ -154,40 +149,27 @@ func (s *Store) LookupChannelByThread(service string, bot string, thread string)
 	return channel, nil
 }
 
+// InsertEvent stores event and returns its ID. Concurrent calls are
+// committed together; see startWriter.
 func (s *Store) InsertEvent(event protocol.Event) (int64, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	result, err := s.db.Exec(`
-INSERT INTO events (
-	timestamp_utc, service, bot, kind, direction, user,
-	target, channel, thread,
-	mentions_agent, direct_to_agent, notify, text
-) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-`,
-		event.Timestamp.UTC().Format(time.RFC3339Nano),
-		event.Service,
-		event.Bot,
-		event.Kind,
-		event.Direction,
-		event.User,
-		event.Target,
-		event.Channel,
-		event.Thread,
-		boolToInt(event.Mentions),
-		boolToInt(event.Direct),
-		boolToInt(event.Notify),
-		event.Text,
-	)
+	attachments, err := encodeAttachments(event.Attachments)
 	if err != nil {
-		return 0, fmt.Errorf("insert event: %w", err)
+		return 0, err
 	}
-
-	id, err := result.LastInsertId()
+	links, err := encodeLinks(event.Links)
 	if err != nil {
-		return 0, fmt.Errorf("read inserted event id: %w", err)
+		return 0, err
 	}
+	return s.queueEvent(event, attachments, links)
+}
 
+// LastEventID returns the ID of the newest stored event, or 0 when there
+// are none.
+func (s *Store) LastEventID() (int64, error) {
+	var id int64
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM events`).Scan(&id); err != nil {
+		return 0, fmt.Errorf("read last event id: %w", err)
+	}
 	return id, nil
 }
 
@@ -196,6 +178,49 @@ func (s *Store) ListEvents(filter EventFilter) ([]protocol.Event, error) {
 		filter.Limit = 50
 	}
 
+	query, args := eventsQuery(filter)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list events: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]protocol.Event, 0, filter.Limit)
+	for rows.Next() {
+		event, err := scanStoredEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate events: %w", err)
+	}
+
+	if !forward(filter.SinceID, filter.Forward) {
+		for left, right := 0, len(events)-1; left < right; left, right = left+1, right-1 {
+			events[left], events[right] = events[right], events[left]
+		}
+	}
+
+	return events, nil
+}
+
+// forward reports whether a listing walks up from the sinceID cursor in id
+// order rather than taking the newest rows after it.
+func forward(sinceID int64, walk bool) bool {
+	return sinceID > 0 && walk
+}
+
+// eventsQuery builds the SELECT for ListEvents. It returns the newest rows
+// (id DESC, reversed by the caller), after SinceID when set. With Forward it
+// walks up from the cursor in id order instead, so paging never skips rows
+// that fall between the cursor and the newest Limit events. Both shapes let
+// SQLite satisfy the ORDER BY straight from the trailing id column of the
+// scope indexes instead of sorting.
+func eventsQuery(filter EventFilter) (string, []any) {
 	query := `
 SELECT
 	id,
@@ -208,10 +233,18 @@ SELECT
 	target,
 	channel,
 	thread,
+	message_id,
 	mentions_agent,
 	direct_to_agent,
 	notify,
-	text
+	notify_reason,
+	text,
+	attachments,
+	translated_text,
+	language,
+	links,
+	trace_id,
+	COALESCE((SELECT status FROM message_statuses WHERE event_id = events.id ORDER BY id DESC LIMIT 1), '')
 FROM events`
 
 	where := make([]string, 0, 8)
@@ -237,10 +270,22 @@ FROM events`
 		where = append(where, "thread = ?")
 		args = append(args, filter.Thread)
 	}
+	if filter.Direction != "" {
+		where = append(where, "direction = ?")
+		args = append(args, filter.Direction)
+	}
+	if filter.Kind != "" {
+		where = append(where, "kind = ?")
+		args = append(args, filter.Kind)
+	}
 	if filter.SinceID > 0 {
 		where = append(where, "id > ?")
 		args = append(args, filter.SinceID)
 	}
+	if filter.BeforeID > 0 {
+		where = append(where, "id < ?")
+		args = append(args, filter.BeforeID)
+	}
 	if filter.NotifyOnly {
 		where = append(where, "notify = 1")
 	}
@@ -253,33 +298,14 @@ FROM events`
 		query += " WHERE " + strings.Join(where, " AND ")
 	}
 
-	query += " ORDER BY id DESC LIMIT ?"
-	args = append(args, filter.Limit)
-
-	rows, err := s.db.Query(query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("list events: %w", err)
-	}
-	defer rows.Close()
-
-	events := make([]protocol.Event, 0, filter.Limit)
-	for rows.Next() {
-		event, err := scanStoredEvent(rows)
-		if err != nil {
-			return nil, err
-		}
-		events = append(events, event)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("iterate events: %w", err)
-	}
-
-	for left, right := 0, len(events)-1; left < right; left, right = left+1, right-1 {
-		events[left], events[right] = events[right], events[left]
+	if forward(filter.SinceID, filter.Forward) {
+		query += " ORDER BY id ASC LIMIT ?"
+	} else {
+		query += " ORDER BY id DESC LIMIT ?"
 	}
+	args = append(args, filter.Limit)
 
-	return events, nil
+	return query, args
 }
 
 func (s *Store) InsertNotification(event protocol.Event) (int64, error) {
@@ -289,9 +315,10 @@ func (s *Store) InsertNotification(event protocol.Event) (int64, error) {
 	result, err := s.db.Exec(`
 INSERT INTO notifications (
 	event_id, timestamp_utc, service, bot, kind, direction, user,
-	target, channel, thread, text,
-	mentions_agent, direct_to_agent, notify, seen
-) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0)
+	target, channel, thread, message_id, text,
+	mentions_agent, direct_to_agent, notify, notify_reason, priority, labels,
+	translated_text, language, seen
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0)
 `,
 		event.ID,
 		event.Timestamp.UTC().Format(time.RFC3339Nano),
@@ -303,10 +330,16 @@ INSERT INTO notifications (
 		event.Target,
 		event.Channel,
 		event.Thread,
+		event.MessageID,
 		event.Text,
 		boolToInt(event.Mentions),
 		boolToInt(event.Direct),
 		boolToInt(event.Notify),
+		event.NotifyReason,
+		event.Priority,
+		strings.Join(event.Labels, "\n"),
+		event.TranslatedText,
+		event.Language,
 	)
 	if err != nil {
 		return 0, fmt.Errorf("insert notification: %w", err)
@@ -338,12 +371,19 @@ SELECT
 	target,
 	channel,
 	thread,
+	message_id,
 	text,
 	mentions_agent,
 	direct_to_agent,
 	notify,
+	notify_reason,
+	priority,
+	labels,
 	seen,
-	seen_at
+	seen_at,
+	collapsed,
+	translated_text,
+	language
 FROM notifications`
 
 	where := make([]string, 0, 8)
@@ -369,6 +409,14 @@ FROM notifications`
 		where = append(where, "thread = ?")
 		args = append(args, filter.Thread)
 	}
+	if filter.Direction != "" {
+		where = append(where, "direction = ?")
+		args = append(args, filter.Direction)
+	}
+	if filter.Kind != "" {
+		where = append(where, "kind = ?")
+		args = append(args, filter.Kind)
+	}
 	if filter.SinceID > 0 {
 		where = append(where, "id > ?")
 		args = append(args, filter.SinceID)
@@ -385,7 +433,11 @@ FROM notifications`
 		query += " WHERE " + strings.Join(where, " AND ")
 	}
 
-	query += " ORDER BY id DESC LIMIT ?"
+	if forward(filter.SinceID, filter.Forward) {
+		query += " ORDER BY id ASC LIMIT ?"
+	} else {
+		query += " ORDER BY id DESC LIMIT ?"
+	}
 	args = append(args, filter.Limit)
 
 	rows, err := s.db.Query(query, args...)
@@ -407,13 +459,45 @@ FROM notifications`
 		return nil, fmt.Errorf("iterate notifications: %w", err)
 	}
 
-	for left, right := 0, len(events)-1; left < right; left, right = left+1, right-1 {
-		events[left], events[right] = events[right], events[left]
+	if !forward(filter.SinceID, filter.Forward) {
+		for left, right := 0, len(events)-1; left < right; left, right = left+1, right-1 {
+			events[left], events[right] = events[right], events[left]
+		}
 	}
 
 	return events, nil
 }
 
+// CollapseNotification folds a repeat into an existing notification by bumping
+// its collapsed counter. It reports false when the notification no longer
+// exists or has already been seen, in which case the caller should record a
+// fresh notification instead.
+func (s *Store) CollapseNotification(id int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.Exec(`
+UPDATE notifications
+SET collapsed = collapsed + 1
+WHERE id = ? AND seen = 0
+`, id)
+	if err != nil {
+		return false, fmt.Errorf("collapse notification: %w", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("read affected rows: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// unseenOrSnoozed matches the notifications marking seen applies to: the
+// unseen ones and the snoozed ones, which are seen until they wake up. A
+// snoozed notification marked seen stays seen.
+const unseenOrSnoozed = "(seen = 0 OR snoozed_until IS NOT NULL)"
+
 func (s *Store) MarkSeenByID(id int64) (int64, error) {
 	if id <= 0 {
 		return 0, nil
@@ -424,9 +508,8 @@ func (s *Store) MarkSeenByID(id int64) (int64, error) {
 
 	result, err := s.db.Exec(`
 UPDATE notifications
-SET seen = 1, seen_at = ?
-WHERE id = ? AND seen = 0
-`, time.Now().UTC().Format(time.RFC3339Nano), id)
+SET seen = 1, seen_at = ?, snoozed_until = NULL
+WHERE id = ? AND `+unseenOrSnoozed, time.Now().UTC().Format(time.RFC3339Nano), id)
 	if err != nil {
 		return 0, fmt.Errorf("mark notification seen by id: %w", err)
 	}
@@ -439,6 +522,145 @@ WHERE id = ? AND seen = 0
 	return count, nil
 }
 
+// MarkSeenThrough marks the unseen notifications of one conversation seen
+// when they are no newer than through, for read markers synced from
+// upstream. Timestamps are compared parsed, as their RFC 3339 text doesn't
+// sort reliably.
+func (s *Store) MarkSeenThrough(service string, bot string, channel string, through time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows, err := s.db.Query(`
+SELECT id, timestamp_utc FROM notifications
+WHERE service = ? AND bot = ? AND channel = ? AND `+unseenOrSnoozed, service, bot, channel)
+	if err != nil {
+		return 0, fmt.Errorf("list unseen notifications: %w", err)
+	}
+	var ids []any
+	for rows.Next() {
+		var id int64
+		var timestamp string
+		if err := rows.Scan(&id, &timestamp); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan unseen notification: %w", err)
+		}
+		if at, err := time.Parse(time.RFC3339Nano, timestamp); err == nil && !at.After(through) {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("iterate unseen notifications: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	args := append([]any{time.Now().UTC().Format(time.RFC3339Nano)}, ids...)
+	result, err := s.db.Exec(`UPDATE notifications SET seen = 1, seen_at = ?, snoozed_until = NULL WHERE id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("mark notifications seen: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// SnoozeNotification marks a notification seen until the given time, after
+// which WakeSnoozed brings it back as unseen. It reports false when the
+// notification does not exist.
+func (s *Store) SnoozeNotification(id int64, until time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.Exec(`
+UPDATE notifications
+SET seen = 1, seen_at = ?, snoozed_until = ?
+WHERE id = ?
+`, time.Now().UTC().Format(time.RFC3339Nano), until.UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return false, fmt.Errorf("snooze notification: %w", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("read affected rows: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// WakeSnoozed marks notifications whose snooze expired at or before now as
+// unseen again and returns them. snoozed_until is stored with second
+// precision so the string comparison orders correctly.
+func (s *Store) WakeSnoozed(now time.Time) ([]protocol.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := now.UTC().Format(time.RFC3339)
+	rows, err := s.db.Query(`
+SELECT
+	id,
+	event_id,
+	timestamp_utc,
+	service,
+	bot,
+	kind,
+	direction,
+	user,
+	target,
+	channel,
+	thread,
+	message_id,
+	text,
+	mentions_agent,
+	direct_to_agent,
+	notify,
+	notify_reason,
+	priority,
+	labels,
+	seen,
+	seen_at,
+	collapsed,
+	translated_text,
+	language
+FROM notifications
+WHERE snoozed_until IS NOT NULL AND snoozed_until <= ?
+ORDER BY id ASC`, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("list snoozed notifications: %w", err)
+	}
+
+	var events []protocol.Event
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		event.Seen = false
+		event.SeenAt = nil
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("iterate snoozed notifications: %w", err)
+	}
+	rows.Close()
+
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	if _, err := s.db.Exec(`
+UPDATE notifications
+SET seen = 0, seen_at = NULL, snoozed_until = NULL
+WHERE snoozed_until IS NOT NULL AND snoozed_until <= ?
+`, cutoff); err != nil {
+		return nil, fmt.Errorf("wake snoozed notifications: %w", err)
+	}
+
+	return events, nil
+}
+
 func (s *Store) MarkSeen(filter NotificationFilter, all bool) (int64, error) {
 	where := make([]string, 0, 8)
 	args := make([]any, 0, 8)
@@ -464,14 +686,14 @@ func (s *Store) MarkSeen(filter NotificationFilter, all bool) (int64, error) {
 		args = append(args, filter.Thread)
 	}
 	if filter.Unseen {
-		where = append(where, "seen = 0")
+		where = append(where, unseenOrSnoozed)
 	}
 
 	if !all && len(where) == 0 {
 		return 0, nil
 	}
 
-	query := "UPDATE notifications SET seen = 1, seen_at = ?"
+	query := "UPDATE notifications SET seen = 1, seen_at = ?, snoozed_until = NULL"
 	args = append([]any{time.Now().UTC().Format(time.RFC3339Nano)}, args...)
 
 	if len(where) > 0 {
@@ -624,6 +846,15 @@ FROM notifications
 	return stats, nil
 }
 
+// UnseenCount returns how many notifications of one bot are unseen.
+func (s *Store) UnseenCount(service string, bot string) (int64, error) {
+	var count int64
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM notifications WHERE service = ? AND bot = ? AND seen = 0`, service, bot).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count unseen notifications: %w", err)
+	}
+	return count, nil
+}
+
 func scanEvent(rows *sql.Rows) (protocol.Event, error) {
 	var (
 		eventID        int64
@@ -637,12 +868,19 @@ func scanEvent(rows *sql.Rows) (protocol.Event, error) {
 		target         sql.NullString
 		channel        sql.NullString
 		thread         sql.NullString
+		messageID      string
 		text           string
 		mentions       int
 		direct         int
 		notify         int
+		reason         string
+		priority       string
+		labels         string
 		seen           int
 		seenAtRaw      sql.NullString
+		collapsed      int
+		translated     string
+		language       string
 	)
 
 	if err := rows.Scan(
@@ -657,12 +895,19 @@ func scanEvent(rows *sql.Rows) (protocol.Event, error) {
 		&target,
 		&channel,
 		&thread,
+		&messageID,
 		&text,
 		&mentions,
 		&direct,
 		&notify,
+		&reason,
+		&priority,
+		&labels,
 		&seen,
 		&seenAtRaw,
+		&collapsed,
+		&translated,
+		&language,
 	); err != nil {
 		return protocol.Event{}, fmt.Errorf("scan notification row: %w", err)
 	}
@@ -691,13 +936,20 @@ func scanEvent(rows *sql.Rows) (protocol.Event, error) {
 		Target:         target.String,
 		Channel:        channel.String,
 		Thread:         thread.String,
+		MessageID:      messageID,
 		NotificationID: notificationID,
+		Collapsed:      collapsed,
 		Seen:           seen == 1,
 		SeenAt:         seenAt,
 		Mentions:       mentions == 1,
 		Direct:         direct == 1,
 		Notify:         notify == 1,
+		NotifyReason:   reason,
+		Priority:       priority,
+		Labels:         splitLabels(labels),
 		Text:           text,
+		TranslatedText: translated,
+		Language:       language,
 	}, nil
 }
 
@@ -713,10 +965,18 @@ func scanStoredEvent(rows *sql.Rows) (protocol.Event, error) {
 		target       sql.NullString
 		channel      sql.NullString
 		thread       sql.NullString
+		messageID    string
 		mentions     int
 		direct       int
 		notify       int
+		reason       string
 		text         string
+		attachments  string
+		translated   string
+		language     string
+		links        string
+		traceID      string
+		status       string
 	)
 
 	if err := rows.Scan(
@@ -730,10 +990,18 @@ func scanStoredEvent(rows *sql.Rows) (protocol.Event, error) {
 		&target,
 		&channel,
 		&thread,
+		&messageID,
 		&mentions,
 		&direct,
 		&notify,
+		&reason,
 		&text,
+		&attachments,
+		&translated,
+		&language,
+		&links,
+		&traceID,
+		&status,
 	); err != nil {
 		return protocol.Event{}, fmt.Errorf("scan event row: %w", err)
 	}
@@ -743,6 +1011,19 @@ func scanStoredEvent(rows *sql.Rows) (protocol.Event, error) {
 		return protocol.Event{}, fmt.Errorf("parse event timestamp: %w", err)
 	}
 
+	var decoded []protocol.Attachment
+	if attachments != "" {
+		if err := json.Unmarshal([]byte(attachments), &decoded); err != nil {
+			return protocol.Event{}, fmt.Errorf("decode event attachments: %w", err)
+		}
+	}
+	var decodedLinks []protocol.Link
+	if links != "" {
+		if err := json.Unmarshal([]byte(links), &decodedLinks); err != nil {
+			return protocol.Event{}, fmt.Errorf("decode event links: %w", err)
+		}
+	}
+
 	return protocol.Event{
 		ID:        eventID,
 		Timestamp: timestamp,
@@ -754,13 +1035,56 @@ func scanStoredEvent(rows *sql.Rows) (protocol.Event, error) {
 		Target:    target.String,
 		Channel:   channel.String,
 		Thread:    thread.String,
+		MessageID: messageID,
 		Mentions:  mentions == 1,
 		Direct:    direct == 1,
 		Notify:    notify == 1,
 		Text:      text,
+
+		NotifyReason:   reason,
+		Attachments:    decoded,
+		Links:          decodedLinks,
+		TranslatedText: translated,
+		Language:       language,
+		Trace:          traceID,
+		Status:         status,
 	}, nil
 }
 
+// encodeAttachments stores attachments as a JSON array, or "" when there
+// are none, which is every event without media.
+func encodeAttachments(attachments []protocol.Attachment) (string, error) {
+	if len(attachments) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(attachments)
+	if err != nil {
+		return "", fmt.Errorf("encode attachments: %w", err)
+	}
+	return string(data), nil
+}
+
+// encodeLinks stores link metadata as a JSON array, or "" when there is
+// none.
+func encodeLinks(links []protocol.Link) (string, error) {
+	if len(links) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(links)
+	if err != nil {
+		return "", fmt.Errorf("encode links: %w", err)
+	}
+	return string(data), nil
+}
+
+// splitLabels reads the labels column, which holds one label per line.
+func splitLabels(labels string) []string {
+	if labels == "" {
+		return nil
+	}
+	return strings.Split(labels, "\n")
+}
+
 func boolToInt(value bool) int {
 	if value {
 		return 1
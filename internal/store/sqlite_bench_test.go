@@ -0,0 +1,193 @@
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+const benchRows = 20000
+
+// newBenchStore seeds a store spread over several bots with a realistic mix of
+// directions, kinds and notify flags. When dropIndexes is set, the indexes
+// added for direction/kind/channel/notify queries are removed so the same
+// query can be timed against the pre-index schema.
+func newBenchStore(b *testing.B, dropIndexes bool) *Store {
+	b.Helper()
+
+	s, err := Open(filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatalf("open bench store: %v", err)
+	}
+	b.Cleanup(func() { _ = s.Close() })
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		b.Fatalf("begin: %v", err)
+	}
+	stmt, err := tx.Prepare(`
+INSERT INTO events (
+	timestamp_utc, service, bot, kind, direction, user,
+	target, channel, thread,
+	mentions_agent, direct_to_agent, notify, text
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		b.Fatalf("prepare: %v", err)
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	for i := 0; i < benchRows; i++ {
+		direction := "in"
+		if i%10 == 0 {
+			direction = "out"
+		}
+		kind := "message"
+		if i%50 == 0 {
+			kind = "status"
+		}
+		notify := 0
+		if i%100 == 0 {
+			notify = 1
+		}
+		_, err := stmt.Exec(
+			now, "slack", fmt.Sprintf("bot-%d", i%4), kind, direction, "U1",
+			"", fmt.Sprintf("C%d", i%20), fmt.Sprintf("T%d", i),
+			0, 0, notify, "benchmark message",
+		)
+		if err != nil {
+			b.Fatalf("seed: %v", err)
+		}
+	}
+	_ = stmt.Close()
+	if err := tx.Commit(); err != nil {
+		b.Fatalf("commit: %v", err)
+	}
+
+	if dropIndexes {
+		for _, idx := range []string{"idx_events_direction", "idx_events_kind", "idx_events_channel", "idx_events_thread", "idx_events_notify_only"} {
+			if _, err := s.db.Exec("DROP INDEX " + idx); err != nil {
+				b.Fatalf("drop %s: %v", idx, err)
+			}
+		}
+	}
+
+	if err := s.analyze(); err != nil {
+		b.Fatalf("analyze: %v", err)
+	}
+
+	return s
+}
+
+func benchmarkListEvents(b *testing.B, filter EventFilter) {
+	for _, variant := range []struct {
+		name string
+		drop bool
+	}{{"indexed", false}, {"baseline", true}} {
+		b.Run(variant.name, func(b *testing.B) {
+			s := newBenchStore(b, variant.drop)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := s.ListEvents(filter); err != nil {
+					b.Fatalf("list events: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkListEvents_Direction(b *testing.B) {
+	benchmarkListEvents(b, EventFilter{Service: "slack", Bot: "bot-1", Direction: "out", Limit: 50})
+}
+
+func BenchmarkListEvents_Kind(b *testing.B) {
+	benchmarkListEvents(b, EventFilter{Service: "slack", Bot: "bot-2", Kind: "status", Limit: 50})
+}
+
+func BenchmarkListEvents_NotifyAllBots(b *testing.B) {
+	benchmarkListEvents(b, EventFilter{NotifyOnly: true, Limit: 50})
+}
+
+func BenchmarkListEvents_Channel(b *testing.B) {
+	benchmarkListEvents(b, EventFilter{Service: "slack", Bot: "bot-0", Channel: "C4", Limit: 50})
+}
+
+func BenchmarkLookupChannelByThread(b *testing.B) {
+	for _, variant := range []struct {
+		name string
+		drop bool
+	}{{"indexed", false}, {"baseline", true}} {
+		b.Run(variant.name, func(b *testing.B) {
+			s := newBenchStore(b, variant.drop)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := s.LookupChannelByThread("slack", "", "T19999"); err != nil {
+					b.Fatalf("lookup: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkInsertEvent times concurrent inserts, as from the connectors of a
+// busy daemon, with group commit against a transaction per event, both in
+// WAL mode and with the rollback journal and full sync the store used before.
+func BenchmarkInsertEvent(b *testing.B) {
+	event := protocol.Event{
+		Timestamp: time.Now().UTC(),
+		Service:   "discord",
+		Bot:       "guild",
+		Kind:      "message",
+		Direction: "in",
+		User:      "U1",
+		Channel:   "C1",
+		Text:      "benchmark message",
+	}
+
+	perEvent := func(s *Store) {
+		done := make(chan eventWriteResult, 1)
+		s.commitEvents([]eventWrite{{event: event, done: done}})
+		if result := <-done; result.err != nil {
+			b.Fatalf("insert: %v", result.err)
+		}
+	}
+
+	for _, variant := range []struct {
+		name     string
+		rollback bool
+		insert   func(s *Store)
+	}{
+		{"group_commit", false, func(s *Store) {
+			if _, err := s.InsertEvent(event); err != nil {
+				b.Fatalf("insert: %v", err)
+			}
+		}},
+		{"per_event", false, perEvent},
+		{"per_event_rollback_journal", true, perEvent},
+	} {
+		b.Run(variant.name, func(b *testing.B) {
+			s, err := Open(filepath.Join(b.TempDir(), "bench.db"))
+			if err != nil {
+				b.Fatalf("open bench store: %v", err)
+			}
+			b.Cleanup(func() { _ = s.Close() })
+			if variant.rollback {
+				// synchronous is per connection; keep to one.
+				s.db.SetMaxOpenConns(1)
+				if _, err := s.db.Exec(`PRAGMA journal_mode = DELETE; PRAGMA synchronous = FULL`); err != nil {
+					b.Fatalf("switch journal: %v", err)
+				}
+			}
+
+			b.SetParallelism(4)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					variant.insert(s)
+				}
+			})
+		})
+	}
+}
@@ -1,7 +1,12 @@
 package store
 
 import (
+	"database/sql"
+	"fmt"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -59,6 +64,33 @@ func TestInsertAndListEvents(t *testing.T) {
 	}
 }
 
+func TestInsertEvent_Attachments(t *testing.T) {
+	s := openTestStore(t)
+
+	voice := makeEvent("telegram", "bot-a", "call me back", "in")
+	voice.Attachments = []protocol.Attachment{{Kind: protocol.AttachmentAudio, ID: "file-1", MimeType: "audio/ogg", Duration: 7, Voice: true, Transcribed: true}}
+	if _, err := s.InsertEvent(voice); err != nil {
+		t.Fatalf("insert voice event: %v", err)
+	}
+	if _, err := s.InsertEvent(makeEvent("telegram", "bot-a", "plain", "in")); err != nil {
+		t.Fatalf("insert event: %v", err)
+	}
+
+	events, err := s.ListEvents(EventFilter{Bot: "bot-a", Limit: 10})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if got := events[0].Attachments; len(got) != 1 || got[0] != voice.Attachments[0] {
+		t.Fatalf("unexpected attachments: %+v", got)
+	}
+	if events[1].Attachments != nil {
+		t.Fatalf("expected no attachments, got %+v", events[1].Attachments)
+	}
+}
+
 func TestListEvents_DefaultLimit(t *testing.T) {
 	s := openTestStore(t)
 
@@ -117,6 +149,104 @@ func TestListEvents_SinceID(t *testing.T) {
 	}
 }
 
+func TestListEvents_SinceIDPagesForward(t *testing.T) {
+	s := openTestStore(t)
+
+	ids := make([]int64, 6)
+	for i := range ids {
+		id, _ := s.InsertEvent(makeEvent("slack", "bot", "msg", "in"))
+		ids[i] = id
+	}
+
+	// A forward page after ids[0] must start right after the cursor, not at the tail.
+	events, err := s.ListEvents(EventFilter{SinceID: ids[0], Forward: true, Limit: 2})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 2 || events[0].ID != ids[1] || events[1].ID != ids[2] {
+		t.Fatalf("expected ids %d,%d got %+v", ids[1], ids[2], events)
+	}
+
+	// Without Forward it is the newest events after the cursor, oldest first.
+	events, err = s.ListEvents(EventFilter{SinceID: ids[0], Limit: 2})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 2 || events[0].ID != ids[4] || events[1].ID != ids[5] {
+		t.Fatalf("expected ids %d,%d got %+v", ids[4], ids[5], events)
+	}
+}
+
+func TestListEvents_DirectionAndKindFilter(t *testing.T) {
+	s := openTestStore(t)
+
+	_, _ = s.InsertEvent(makeEvent("slack", "bot", "inbound", "in"))
+	_, _ = s.InsertEvent(makeEvent("slack", "bot", "outbound", "out"))
+	status := makeEvent("slack", "bot", "connected", "in")
+	status.Kind = "status"
+	_, _ = s.InsertEvent(status)
+
+	events, err := s.ListEvents(EventFilter{Direction: "out", Limit: 10})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 1 || events[0].Text != "outbound" {
+		t.Fatalf("expected only outbound event, got %+v", events)
+	}
+
+	events, err = s.ListEvents(EventFilter{Direction: "in", Kind: "message", Limit: 10})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 1 || events[0].Text != "inbound" {
+		t.Fatalf("expected only inbound message, got %+v", events)
+	}
+}
+
+func TestListEvents_QueryPlanUsesIndex(t *testing.T) {
+	s := openTestStore(t)
+
+	tests := []struct {
+		name   string
+		filter EventFilter
+		index  string
+	}{
+		{"direction", EventFilter{Service: "slack", Bot: "bot", Direction: "in", Limit: 50}, "idx_events_direction"},
+		{"kind", EventFilter{Service: "slack", Bot: "bot", Kind: "message", Limit: 50}, "idx_events_kind"},
+		{"channel", EventFilter{Service: "slack", Bot: "bot", Channel: "C1", Limit: 50}, "idx_events_channel"},
+		{"unscoped notify", EventFilter{NotifyOnly: true, Limit: 50}, "idx_events_notify_only"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := eventsQuery(tt.filter)
+			rows, err := s.db.Query("EXPLAIN QUERY PLAN "+query, args...)
+			if err != nil {
+				t.Fatalf("explain: %v", err)
+			}
+			defer rows.Close()
+
+			var plan []string
+			for rows.Next() {
+				var id, parent, notused int
+				var detail string
+				if err := rows.Scan(&id, &parent, &notused, &detail); err != nil {
+					t.Fatalf("scan plan: %v", err)
+				}
+				plan = append(plan, detail)
+			}
+
+			joined := strings.Join(plan, "; ")
+			if !strings.Contains(joined, tt.index) {
+				t.Fatalf("expected plan to use %s, got: %s", tt.index, joined)
+			}
+			if strings.Contains(joined, "TEMP B-TREE") {
+				t.Fatalf("expected no sort step, got: %s", joined)
+			}
+		})
+	}
+}
+
 func TestListEvents_FilterByChannel(t *testing.T) {
 	s := openTestStore(t)
 
@@ -163,6 +293,178 @@ func TestListEvents_NotifyOnly(t *testing.T) {
 	}
 }
 
+func TestInsertEvent_MessageID(t *testing.T) {
+	s := openTestStore(t)
+
+	ev := makeEvent("slack", "bot", "ping", "in")
+	ev.MessageID = "1700000000.000100"
+	ev.Notify = true
+	id, err := s.InsertEvent(ev)
+	if err != nil {
+		t.Fatalf("insert event: %v", err)
+	}
+	ev.ID = id
+	if _, err := s.InsertNotification(ev); err != nil {
+		t.Fatalf("insert notification: %v", err)
+	}
+
+	events, err := s.ListEvents(EventFilter{Bot: "bot", Limit: 10})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 1 || events[0].MessageID != ev.MessageID {
+		t.Fatalf("expected message id %q on the event, got %+v", ev.MessageID, events)
+	}
+
+	notifications, err := s.ListNotifications(NotificationFilter{Bot: "bot", Limit: 10})
+	if err != nil {
+		t.Fatalf("list notifications: %v", err)
+	}
+	if len(notifications) != 1 || notifications[0].MessageID != ev.MessageID {
+		t.Fatalf("expected message id %q on the notification, got %+v", ev.MessageID, notifications)
+	}
+}
+
+func TestInsertEvent_Trace(t *testing.T) {
+	s := openTestStore(t)
+
+	ev := makeEvent("slack", "bot", "pong", "out")
+	ev.Trace = "4bf92f3577b34da6a3ce929d0e0e4736"
+	if _, err := s.InsertEvent(ev); err != nil {
+		t.Fatalf("insert event: %v", err)
+	}
+
+	events, err := s.ListEvents(EventFilter{Bot: "bot", Limit: 10})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 1 || events[0].Trace != ev.Trace {
+		t.Fatalf("expected trace %q on the event, got %+v", ev.Trace, events)
+	}
+}
+
+func TestRecordStatus(t *testing.T) {
+	s := openTestStore(t)
+
+	ev := makeEvent("twilio", "bot", "your order shipped", "out")
+	ev.MessageID = "SM123"
+	id, err := s.InsertEvent(ev)
+	if err != nil {
+		t.Fatalf("insert event: %v", err)
+	}
+
+	now := time.Now()
+	for _, step := range []struct {
+		status string
+		want   int64
+	}{
+		{protocol.StatusQueued, id},
+		{protocol.StatusDelivered, id},
+		{protocol.StatusSent, 0}, // arrived late; delivered stays
+		{protocol.StatusRead, id},
+		{protocol.StatusFailed, 0}, // read is final
+	} {
+		got, err := s.RecordStatus("twilio", "bot", "SM123", step.status, "", now)
+		if err != nil {
+			t.Fatalf("record %s: %v", step.status, err)
+		}
+		if got != step.want {
+			t.Fatalf("record %s: expected event %d, got %d", step.status, step.want, got)
+		}
+	}
+
+	events, err := s.ListEvents(EventFilter{Bot: "bot", Limit: 10})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 1 || events[0].Status != protocol.StatusRead {
+		t.Fatalf("expected the message read, got %+v", events)
+	}
+
+	var transitions int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM message_statuses WHERE event_id = ?`, id).Scan(&transitions); err != nil {
+		t.Fatalf("count statuses: %v", err)
+	}
+	if transitions != 3 {
+		t.Fatalf("expected 3 recorded transitions, got %d", transitions)
+	}
+
+	if got, err := s.RecordStatus("twilio", "bot", "SM999", protocol.StatusSent, "", now); err != nil || got != 0 {
+		t.Fatalf("expected unknown messages to be skipped, got %d, %v", got, err)
+	}
+	if _, err := s.RecordStatus("twilio", "bot", "SM123", "bounced", "", now); err == nil {
+		t.Fatal("expected an error for an unknown status")
+	}
+
+	if _, err := s.DeleteEvents(EventFilter{Bot: "bot"}, false); err != nil {
+		t.Fatalf("delete events: %v", err)
+	}
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM message_statuses`).Scan(&transitions); err != nil {
+		t.Fatalf("count statuses: %v", err)
+	}
+	if transitions != 0 {
+		t.Fatalf("expected statuses deleted with their event, %d left", transitions)
+	}
+}
+
+func TestInsertEvent_Translation(t *testing.T) {
+	s := openTestStore(t)
+
+	ev := makeEvent("slack", "bot", "¿dónde está mi pedido?", "in")
+	ev.Notify = true
+	ev.TranslatedText = "where is my order?"
+	ev.Language = "es"
+	id, err := s.InsertEvent(ev)
+	if err != nil {
+		t.Fatalf("insert event: %v", err)
+	}
+	ev.ID = id
+	if _, err := s.InsertNotification(ev); err != nil {
+		t.Fatalf("insert notification: %v", err)
+	}
+
+	events, err := s.ListEvents(EventFilter{Bot: "bot", Limit: 10})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 1 || events[0].TranslatedText != ev.TranslatedText || events[0].Language != "es" {
+		t.Fatalf("expected the translation on the event, got %+v", events)
+	}
+
+	notifications, err := s.ListNotifications(NotificationFilter{Bot: "bot", Limit: 10})
+	if err != nil {
+		t.Fatalf("list notifications: %v", err)
+	}
+	if len(notifications) != 1 || notifications[0].TranslatedText != ev.TranslatedText || notifications[0].Language != "es" {
+		t.Fatalf("expected the translation on the notification, got %+v", notifications)
+	}
+}
+
+func TestInsertNotification_Classification(t *testing.T) {
+	s := openTestStore(t)
+
+	ev := makeEvent("slack", "bot", "prod is down", "in")
+	ev.Notify = true
+	ev.Priority = "urgent"
+	ev.Labels = []string{"outage", "needs reply"}
+	id, err := s.InsertEvent(ev)
+	if err != nil {
+		t.Fatalf("insert event: %v", err)
+	}
+	ev.ID = id
+	if _, err := s.InsertNotification(ev); err != nil {
+		t.Fatalf("insert notification: %v", err)
+	}
+
+	notifications, err := s.ListNotifications(NotificationFilter{Bot: "bot", Limit: 10})
+	if err != nil {
+		t.Fatalf("list notifications: %v", err)
+	}
+	if len(notifications) != 1 || notifications[0].Priority != "urgent" || !slices.Equal(notifications[0].Labels, ev.Labels) {
+		t.Fatalf("expected the classification on the notification, got %+v", notifications)
+	}
+}
+
 func TestInsertAndListNotifications(t *testing.T) {
 	s := openTestStore(t)
 
@@ -301,6 +603,34 @@ func TestMarkSeen_ByBot(t *testing.T) {
 	}
 }
 
+func TestMarkSeenThrough(t *testing.T) {
+	s := openTestStore(t)
+
+	base := time.Now().UTC().Add(-time.Hour)
+	for i, channel := range []string{"C1", "C1", "C2"} {
+		ev := makeEvent("mattermost", "ops", fmt.Sprintf("msg %d", i), "in")
+		ev.Channel = channel
+		ev.Timestamp = base.Add(time.Duration(i) * time.Minute)
+		ev.Notify = true
+		ev.ID, _ = s.InsertEvent(ev)
+		_, _ = s.InsertNotification(ev)
+	}
+
+	// Read up to the first message of C1 only.
+	count, err := s.MarkSeenThrough("mattermost", "ops", "C1", base)
+	if err != nil {
+		t.Fatalf("mark seen through: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 marked, got %d", count)
+	}
+
+	unseen, _ := s.ListNotifications(NotificationFilter{Unseen: true, Limit: 10})
+	if len(unseen) != 2 || unseen[0].Text != "msg 1" || unseen[1].Text != "msg 2" {
+		t.Fatalf("unexpected unseen notifications: %+v", unseen)
+	}
+}
+
 func TestMarkSeen_All(t *testing.T) {
 	s := openTestStore(t)
 
@@ -941,6 +1271,49 @@ func TestListNotifications_SinceID(t *testing.T) {
 	}
 }
 
+func TestListNotifications_SinceIDForwardAndFilters(t *testing.T) {
+	s := openTestStore(t)
+
+	nIDs := make([]int64, 4)
+	for i := range nIDs {
+		ev := makeEvent("slack", "bot", "msg", "in")
+		if i == 3 {
+			ev.Kind = "reaction"
+		}
+		ev.Notify = true
+		evID, _ := s.InsertEvent(ev)
+		ev.ID = evID
+		nIDs[i], _ = s.InsertNotification(ev)
+	}
+
+	notifs, err := s.ListNotifications(NotificationFilter{SinceID: nIDs[0], Limit: 2})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(notifs) != 2 || notifs[0].NotificationID != nIDs[2] || notifs[1].NotificationID != nIDs[3] {
+		t.Fatalf("expected the newest two after the cursor, got %+v", notifs)
+	}
+
+	notifs, err = s.ListNotifications(NotificationFilter{SinceID: nIDs[0], Forward: true, Limit: 2})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(notifs) != 2 || notifs[0].NotificationID != nIDs[1] || notifs[1].NotificationID != nIDs[2] {
+		t.Fatalf("expected the two right after the cursor, got %+v", notifs)
+	}
+
+	notifs, err = s.ListNotifications(NotificationFilter{Kind: "reaction", Direction: "in", Limit: 10})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(notifs) != 1 || notifs[0].NotificationID != nIDs[3] {
+		t.Fatalf("expected only the reaction, got %+v", notifs)
+	}
+	if notifs, _ = s.ListNotifications(NotificationFilter{Direction: "out", Limit: 10}); len(notifs) != 0 {
+		t.Fatalf("expected no outbound notifications, got %+v", notifs)
+	}
+}
+
 func TestListNotifications_Chronological(t *testing.T) {
 	s := openTestStore(t)
 
@@ -1142,6 +1515,110 @@ func TestOpen_CreatesDirectory(t *testing.T) {
 	defer s.Close()
 }
 
+func TestInsertEvent_Concurrent(t *testing.T) {
+	s := openTestStore(t)
+
+	const writers, perWriter = 16, 50
+	ids := make(chan int64, writers*perWriter)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				id, err := s.InsertEvent(makeEvent("discord", fmt.Sprintf("bot-%d", w), "busy guild", "in"))
+				if err != nil {
+					t.Errorf("insert event: %v", err)
+					return
+				}
+				ids <- id
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[int64]bool)
+	for id := range ids {
+		if id <= 0 || seen[id] {
+			t.Fatalf("expected unique positive ids, got %d twice or invalid", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) != writers*perWriter {
+		t.Fatalf("expected %d ids, got %d", writers*perWriter, len(seen))
+	}
+
+	var stored int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored != writers*perWriter {
+		t.Fatalf("expected %d stored events, got %d", writers*perWriter, stored)
+	}
+}
+
+func TestCommitEvents_StatusFailureKeepsNoEvent(t *testing.T) {
+	s := openTestStore(t)
+	if _, err := s.db.Exec(`CREATE TRIGGER refuse_status BEFORE INSERT ON message_statuses BEGIN SELECT RAISE(ABORT, 'status refused'); END`); err != nil {
+		t.Fatal(err)
+	}
+
+	withStatus := makeEvent("twilio", "bot", "with status", "out")
+	withStatus.Status = "sent"
+	batch := []eventWrite{
+		{event: withStatus, done: make(chan eventWriteResult, 1)},
+		{event: makeEvent("twilio", "bot", "plain", "in"), done: make(chan eventWriteResult, 1)},
+	}
+	s.commitEvents(batch)
+
+	if result := <-batch[0].done; result.err == nil || !strings.Contains(result.err.Error(), "status refused") {
+		t.Fatalf("expected the status failure reported, got %+v", result)
+	}
+	if result := <-batch[1].done; result.err != nil || result.id <= 0 {
+		t.Fatalf("expected the rest of the batch stored, got %+v", result)
+	}
+
+	events, err := s.ListEvents(EventFilter{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Text != "plain" {
+		t.Fatalf("expected only the event without a status stored, got %+v", events)
+	}
+}
+
+func TestOpen_WAL(t *testing.T) {
+	s := openTestStore(t)
+
+	var mode string
+	if err := s.db.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" {
+		t.Fatalf("expected WAL journal mode, got %q", mode)
+	}
+}
+
+func TestInsertEvent_AfterClose(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.InsertEvent(makeEvent("slack", "bot", "before", "in")); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err := s.InsertEvent(makeEvent("slack", "bot", "after", "in")); err == nil {
+		t.Fatal("expected insert after close to fail")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("second close: %v", err)
+	}
+}
+
 func TestOpen_InMemory(t *testing.T) {
 	// ":memory:" has dir "." - should work
 	s, err := Open(":memory:")
@@ -1197,3 +1674,335 @@ func TestNotificationStats(t *testing.T) {
 		t.Fatalf("expected unseen=1, got %d", stats.Unseen)
 	}
 }
+
+func TestCollapseNotification(t *testing.T) {
+	s := openTestStore(t)
+
+	ev := makeEvent("slack", "bot", "ping", "in")
+	ev.Notify = true
+	ev.ID, _ = s.InsertEvent(ev)
+	nid, err := s.InsertNotification(ev)
+	if err != nil {
+		t.Fatalf("insert notification: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		ok, err := s.CollapseNotification(nid)
+		if err != nil {
+			t.Fatalf("collapse: %v", err)
+		}
+		if !ok {
+			t.Fatal("expected collapse into unseen notification")
+		}
+	}
+
+	notifs, err := s.ListNotifications(NotificationFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("list notifications: %v", err)
+	}
+	if len(notifs) != 1 || notifs[0].Collapsed != 2 {
+		t.Fatalf("expected one notification with collapsed=2, got %+v", notifs)
+	}
+
+	if _, err := s.MarkSeenByID(nid); err != nil {
+		t.Fatalf("mark seen: %v", err)
+	}
+	ok, err := s.CollapseNotification(nid)
+	if err != nil {
+		t.Fatalf("collapse: %v", err)
+	}
+	if ok {
+		t.Fatal("expected no collapse into a seen notification")
+	}
+}
+
+func TestOpen_AddsCollapsedColumnToOldSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("open raw db: %v", err)
+	}
+	_, err = db.Exec(`CREATE TABLE notifications (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	event_id INTEGER NOT NULL,
+	timestamp_utc TEXT NOT NULL,
+	service TEXT NOT NULL,
+	bot TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	direction TEXT NOT NULL,
+	user TEXT NOT NULL DEFAULT '',
+	target TEXT,
+	channel TEXT,
+	thread TEXT,
+	text TEXT NOT NULL,
+	mentions_agent INTEGER NOT NULL DEFAULT 0,
+	direct_to_agent INTEGER NOT NULL DEFAULT 0,
+	notify INTEGER NOT NULL DEFAULT 1,
+	seen INTEGER NOT NULL DEFAULT 0,
+	seen_at TEXT
+)`)
+	if err != nil {
+		t.Fatalf("create old schema: %v", err)
+	}
+	_ = db.Close()
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("open upgraded store: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	ev := makeEvent("slack", "bot", "hi", "in")
+	if _, err := s.InsertNotification(ev); err != nil {
+		t.Fatalf("insert notification: %v", err)
+	}
+	if _, err := s.ListNotifications(NotificationFilter{}); err != nil {
+		t.Fatalf("list notifications: %v", err)
+	}
+}
+
+func TestSnoozeNotification_WakesAfterDeadline(t *testing.T) {
+	s := openTestStore(t)
+
+	ev := makeEvent("slack", "bot", "ping", "in")
+	ev.Notify = true
+	evID, _ := s.InsertEvent(ev)
+	ev.ID = evID
+	nID, _ := s.InsertNotification(ev)
+
+	now := time.Now()
+	ok, err := s.SnoozeNotification(nID, now.Add(time.Hour))
+	if err != nil || !ok {
+		t.Fatalf("snooze: ok=%v err=%v", ok, err)
+	}
+
+	unseen, _ := s.ListNotifications(NotificationFilter{Unseen: true, Limit: 10})
+	if len(unseen) != 0 {
+		t.Fatalf("snoozed notification still unseen: %+v", unseen)
+	}
+
+	woken, err := s.WakeSnoozed(now.Add(30 * time.Minute))
+	if err != nil {
+		t.Fatalf("wake early: %v", err)
+	}
+	if len(woken) != 0 {
+		t.Fatalf("woke before deadline: %+v", woken)
+	}
+
+	woken, err = s.WakeSnoozed(now.Add(time.Hour + time.Second))
+	if err != nil {
+		t.Fatalf("wake: %v", err)
+	}
+	if len(woken) != 1 || woken[0].NotificationID != nID || woken[0].Seen {
+		t.Fatalf("expected notification %d woken as unseen, got %+v", nID, woken)
+	}
+
+	unseen, _ = s.ListNotifications(NotificationFilter{Unseen: true, Limit: 10})
+	if len(unseen) != 1 {
+		t.Fatalf("expected woken notification to be unseen, got %d", len(unseen))
+	}
+
+	if woken, _ := s.WakeSnoozed(now.Add(2 * time.Hour)); len(woken) != 0 {
+		t.Fatalf("notification woke twice: %+v", woken)
+	}
+}
+
+func TestSnoozeNotification_MarkedSeenStaysSeen(t *testing.T) {
+	s := openTestStore(t)
+
+	now := time.Now()
+	snoozed := func(channel string) int64 {
+		t.Helper()
+		ev := makeEvent("slack", "bot", "ping", "in")
+		ev.Channel = channel
+		ev.Notify = true
+		ev.ID, _ = s.InsertEvent(ev)
+		id, _ := s.InsertNotification(ev)
+		if ok, err := s.SnoozeNotification(id, now.Add(time.Hour)); err != nil || !ok {
+			t.Fatalf("snooze: ok=%v err=%v", ok, err)
+		}
+		return id
+	}
+
+	byID := snoozed("C1")
+	if count, err := s.MarkSeenByID(byID); err != nil || count != 1 {
+		t.Fatalf("mark snoozed notification seen: count=%d err=%v", count, err)
+	}
+	snoozed("C2")
+	if count, err := s.MarkSeen(NotificationFilter{Channel: "C2", Unseen: true}, false); err != nil || count != 1 {
+		t.Fatalf("mark snoozed channel seen: count=%d err=%v", count, err)
+	}
+	snoozed("C3")
+	if count, err := s.MarkSeenThrough("slack", "bot", "C3", now.Add(time.Minute)); err != nil || count != 1 {
+		t.Fatalf("mark snoozed channel read: count=%d err=%v", count, err)
+	}
+
+	woken, err := s.WakeSnoozed(now.Add(2 * time.Hour))
+	if err != nil {
+		t.Fatalf("wake: %v", err)
+	}
+	if len(woken) != 0 {
+		t.Fatalf("expected notifications marked seen to stay dismissed, got %+v", woken)
+	}
+	if unseen, _ := s.ListNotifications(NotificationFilter{Unseen: true, Limit: 10}); len(unseen) != 0 {
+		t.Fatalf("expected no unseen notifications, got %+v", unseen)
+	}
+}
+
+func TestSnoozeNotification_Unknown(t *testing.T) {
+	s := openTestStore(t)
+	ok, err := s.SnoozeNotification(42, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok {
+		t.Fatal("expected false for unknown notification")
+	}
+}
+
+func TestAgentRuns_InsertAndList(t *testing.T) {
+	s := openTestStore(t)
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	for i, agent := range []string{"reviewer", "triage", "reviewer", "reviewer"} {
+		_, err := s.InsertAgentRun(protocol.AgentRun{
+			Agent:      agent,
+			StartedAt:  start.Add(time.Duration(i) * time.Minute),
+			FinishedAt: start.Add(time.Duration(i)*time.Minute + 5*time.Second),
+			ExitCode:   i,
+			Triggers:   2,
+			Output:     "run " + agent,
+		})
+		if err != nil {
+			t.Fatalf("insert run: %v", err)
+		}
+	}
+
+	runs, err := s.ListAgentRuns("reviewer", 2)
+	if err != nil {
+		t.Fatalf("list runs: %v", err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs, got %d", len(runs))
+	}
+	if runs[0].ExitCode != 2 || runs[1].ExitCode != 3 {
+		t.Fatalf("expected the latest runs oldest first, got exit codes %d, %d", runs[0].ExitCode, runs[1].ExitCode)
+	}
+	if !runs[1].FinishedAt.Equal(start.Add(3*time.Minute + 5*time.Second)) {
+		t.Fatalf("unexpected finish time: %s", runs[1].FinishedAt)
+	}
+
+	all, err := s.ListAgentRuns("", 0)
+	if err != nil {
+		t.Fatalf("list all runs: %v", err)
+	}
+	if len(all) != 4 || all[1].Agent != "triage" {
+		t.Fatalf("expected all 4 runs, got %+v", all)
+	}
+}
+
+func TestDeleteEvents_RemovesTheirNotifications(t *testing.T) {
+	s := openTestStore(t)
+
+	for _, text := range []string{"keep", "drop"} {
+		ev := makeEvent("slack", "bot", text, "in")
+		ev.Notify = true
+		ev.ID, _ = s.InsertEvent(ev)
+		if _, err := s.InsertNotification(ev); err != nil {
+			t.Fatalf("insert notification: %v", err)
+		}
+	}
+
+	if _, err := s.DeleteEvents(EventFilter{Search: "drop"}, false); err != nil {
+		t.Fatalf("delete events: %v", err)
+	}
+
+	notifications, err := s.ListNotifications(NotificationFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("list notifications: %v", err)
+	}
+	if len(notifications) != 1 || notifications[0].Text != "keep" {
+		t.Fatalf("expected only the notification of the remaining event, got %+v", notifications)
+	}
+}
+
+func TestFsck(t *testing.T) {
+	s := openTestStore(t)
+
+	ev := makeEvent("slack", "bot", "ping", "in")
+	ev.Notify = true
+	ev.ID, _ = s.InsertEvent(ev)
+	if _, err := s.InsertNotification(ev); err != nil {
+		t.Fatalf("insert notification: %v", err)
+	}
+	// Notifications of events deleted before the cleanup trigger existed.
+	for _, missing := range []int64{0, 999} {
+		orphan := ev
+		orphan.ID = missing
+		if _, err := s.InsertNotification(orphan); err != nil {
+			t.Fatalf("insert orphan: %v", err)
+		}
+	}
+
+	report, err := s.Fsck(false)
+	if err != nil {
+		t.Fatalf("fsck: %v", err)
+	}
+	if report.OrphanNotifications != 2 || report.Repaired != 0 || report.Clean() {
+		t.Fatalf("expected two orphans reported but not repaired, got %+v", report)
+	}
+
+	report, err = s.Fsck(true)
+	if err != nil {
+		t.Fatalf("fsck repair: %v", err)
+	}
+	if report.Repaired != 2 || !report.Vacuumed || len(report.Integrity) != 0 {
+		t.Fatalf("expected orphans repaired, got %+v", report)
+	}
+
+	report, err = s.Fsck(false)
+	if err != nil {
+		t.Fatalf("fsck: %v", err)
+	}
+	if !report.Clean() {
+		t.Fatalf("expected clean store after repair, got %+v", report)
+	}
+	if stats, _ := s.NotificationStats(); stats.Total != 1 {
+		t.Fatalf("expected the valid notification to survive, got %+v", stats)
+	}
+}
+
+func TestChannelMutes(t *testing.T) {
+	s := openTestStore(t)
+
+	now := time.Now()
+	for _, mute := range []protocol.Mute{
+		{Service: "slack", Bot: "ops", Channel: "C1", Until: now.Add(2 * time.Hour)},
+		{Service: "slack", Bot: "ops", Channel: "C2", Until: now.Add(time.Hour)},
+		{Service: "slack", Bot: "other", Channel: "C1", Until: now.Add(-time.Minute)},
+		{Service: "slack", Bot: "ops", Channel: "C1", Until: now.Add(3 * time.Hour)}, // replaces the first
+	} {
+		if err := s.SetMute(mute); err != nil {
+			t.Fatalf("set mute: %v", err)
+		}
+	}
+
+	mutes, err := s.ListMutes(now)
+	if err != nil {
+		t.Fatalf("list mutes: %v", err)
+	}
+	if len(mutes) != 2 || mutes[0].Channel != "C2" || mutes[1].Channel != "C1" {
+		t.Fatalf("expected the two mutes in force, soonest first, got %+v", mutes)
+	}
+	if want := now.Add(3 * time.Hour).UTC().Truncate(time.Second); !mutes[1].Until.Equal(want) {
+		t.Fatalf("expected C1 muted until %s, got %s", want, mutes[1].Until)
+	}
+
+	lifted, err := s.DeleteMutes("slack", "ops", "C2")
+	if err != nil || lifted != 1 {
+		t.Fatalf("delete mute: lifted %d, %v", lifted, err)
+	}
+	if lifted, _ := s.DeleteMutes("", "", ""); lifted != 1 {
+		t.Fatalf("expected the last mute lifted, got %d", lifted)
+	}
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// statusRank orders the delivery statuses. Read and failed are both final.
+var statusRank = map[string]int{
+	protocol.StatusQueued:    1,
+	protocol.StatusSent:      2,
+	protocol.StatusDelivered: 3,
+	protocol.StatusRead:      4,
+	protocol.StatusFailed:    4,
+}
+
+// RecordStatus records that the outbound message with the platform ID
+// messageID reached status, and returns the ID of its stored event. It
+// returns 0 when the message isn't stored or status doesn't move it
+// forward, as with a delivery receipt arriving after the read one.
+func (s *Store) RecordStatus(service string, bot string, messageID string, status string, reason string, at time.Time) (int64, error) {
+	rank, ok := statusRank[status]
+	if !ok {
+		return 0, fmt.Errorf("unknown message status %q", status)
+	}
+	if messageID == "" {
+		return 0, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var eventID int64
+	var current string
+	err := s.db.QueryRow(`
+SELECT id, COALESCE((SELECT status FROM message_statuses WHERE event_id = events.id ORDER BY id DESC LIMIT 1), '')
+FROM events
+WHERE message_id = ? AND service = ? AND bot = ? AND direction = 'out'
+ORDER BY id DESC
+LIMIT 1
+`, messageID, service, bot).Scan(&eventID, &current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("find sent message: %w", err)
+	}
+	if statusRank[current] >= rank {
+		return 0, nil
+	}
+
+	if _, err := s.db.Exec(`
+INSERT INTO message_statuses (event_id, status, timestamp_utc, reason)
+VALUES (?, ?, ?, ?)
+`, eventID, status, at.UTC().Format(time.RFC3339Nano), reason); err != nil {
+		return 0, fmt.Errorf("insert message status: %w", err)
+	}
+	return eventID, nil
+}
@@ -0,0 +1,200 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// maxEventBatch caps the events committed in one transaction.
+const maxEventBatch = 256
+
+// errStoreClosed is returned by InsertEvent after Close.
+var errStoreClosed = errors.New("store is closed")
+
+// eventWrite is an event queued for the writer goroutine. The result is
+// delivered on done once the transaction holding it commits.
+type eventWrite struct {
+	event       protocol.Event
+	attachments string
+	links       string
+	done        chan eventWriteResult
+}
+
+type eventWriteResult struct {
+	id  int64
+	err error
+}
+
+// startWriter starts the goroutine that inserts events. Busy connectors
+// publish from many goroutines at once; instead of a transaction (and a
+// WAL sync) per event, the writer commits whatever has queued up while the
+// previous transaction ran in one go, so throughput grows with load while a
+// lone event is still written immediately.
+func (s *Store) startWriter() {
+	s.writes = make(chan eventWrite, maxEventBatch)
+	s.writerDone = make(chan struct{})
+	go s.writeLoop()
+}
+
+func (s *Store) writeLoop() {
+	defer close(s.writerDone)
+
+	for first := range s.writes {
+		batch := []eventWrite{first}
+	collect:
+		for len(batch) < maxEventBatch {
+			select {
+			case write, ok := <-s.writes:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, write)
+			default:
+				break collect
+			}
+		}
+		s.commitEvents(batch)
+	}
+}
+
+// stopWriter lets the writer commit what is queued and waits for it. Later
+// InsertEvent calls fail with errStoreClosed.
+func (s *Store) stopWriter() {
+	s.writeMu.Lock()
+	if s.writes == nil || s.writerClosed {
+		s.writeMu.Unlock()
+		return
+	}
+	s.writerClosed = true
+	close(s.writes)
+	s.writeMu.Unlock()
+	<-s.writerDone
+}
+
+// queueEvent hands an event to the writer and waits for its row ID.
+func (s *Store) queueEvent(event protocol.Event, attachments string, links string) (int64, error) {
+	done := make(chan eventWriteResult, 1)
+
+	s.writeMu.RLock()
+	if s.writerClosed {
+		s.writeMu.RUnlock()
+		return 0, errStoreClosed
+	}
+	s.writes <- eventWrite{event: event, attachments: attachments, links: links, done: done}
+	s.writeMu.RUnlock()
+
+	result := <-done
+	return result.id, result.err
+}
+
+// commitEvents inserts batch in a single transaction and reports each
+// event's ID, or the error that kept it (or the whole batch) from being
+// stored.
+func (s *Store) commitEvents(batch []eventWrite) {
+	results := make([]eventWriteResult, len(batch))
+	fail := func(err error) {
+		for i := range results {
+			results[i] = eventWriteResult{err: err}
+		}
+	}
+
+	s.mu.Lock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		fail(fmt.Errorf("begin event batch: %w", err))
+	} else {
+		stmt, err := tx.Prepare(`
+INSERT INTO events (
+	timestamp_utc, service, bot, kind, direction, user,
+	target, channel, thread, message_id,
+	mentions_agent, direct_to_agent, notify, notify_reason, text, attachments,
+	translated_text, language, links, trace_id
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`)
+		if err != nil {
+			_ = tx.Rollback()
+			fail(fmt.Errorf("prepare event insert: %w", err))
+		} else {
+			for i, write := range batch {
+				results[i] = insertEvent(tx, stmt, write)
+			}
+			_ = stmt.Close()
+			if err := tx.Commit(); err != nil {
+				fail(fmt.Errorf("commit event batch: %w", err))
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	for i, write := range batch {
+		write.done <- results[i]
+	}
+}
+
+// insertEvent stores write's event and its first receipt together or not
+// at all: when the receipt fails, the savepoint takes the event row back
+// out without failing the rest of the batch.
+func insertEvent(tx *sql.Tx, stmt *sql.Stmt, write eventWrite) eventWriteResult {
+	if _, err := tx.Exec(`SAVEPOINT event`); err != nil {
+		return eventWriteResult{err: fmt.Errorf("begin event insert: %w", err)}
+	}
+	result := insertEventRows(tx, stmt, write)
+	if result.err != nil {
+		if _, err := tx.Exec(`ROLLBACK TO event`); err != nil {
+			result.err = fmt.Errorf("%w (and roll back: %v)", result.err, err)
+		}
+	}
+	if _, err := tx.Exec(`RELEASE event`); err != nil && result.err == nil {
+		return eventWriteResult{err: fmt.Errorf("release event insert: %w", err)}
+	}
+	return result
+}
+
+func insertEventRows(tx *sql.Tx, stmt *sql.Stmt, write eventWrite) eventWriteResult {
+	event := write.event
+	result, err := stmt.Exec(
+		event.Timestamp.UTC().Format(time.RFC3339Nano),
+		event.Service,
+		event.Bot,
+		event.Kind,
+		event.Direction,
+		event.User,
+		event.Target,
+		event.Channel,
+		event.Thread,
+		event.MessageID,
+		boolToInt(event.Mentions),
+		boolToInt(event.Direct),
+		boolToInt(event.Notify),
+		event.NotifyReason,
+		event.Text,
+		write.attachments,
+		event.TranslatedText,
+		event.Language,
+		write.links,
+		event.Trace,
+	)
+	if err != nil {
+		return eventWriteResult{err: fmt.Errorf("insert event: %w", err)}
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return eventWriteResult{err: fmt.Errorf("read inserted event id: %w", err)}
+	}
+
+	// A status the event already carries is its first receipt.
+	if event.Status != "" {
+		if _, err := tx.Exec(`
+INSERT INTO message_statuses (event_id, status, timestamp_utc, reason)
+VALUES (?, ?, ?, '')
+`, id, event.Status, event.Timestamp.UTC().Format(time.RFC3339Nano)); err != nil {
+			return eventWriteResult{err: fmt.Errorf("insert message status: %w", err)}
+		}
+	}
+	return eventWriteResult{id: id}
+}
@@ -0,0 +1,210 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds one export when ExporterConfig.Timeout is zero.
+const DefaultTimeout = 10 * time.Second
+
+// DefaultServiceName is the service.name exported spans carry when
+// ExporterConfig.ServiceName is empty.
+const DefaultServiceName = "pantalkd"
+
+// maxExports caps the exports in flight; traces finishing while they are
+// all busy are dropped rather than queued behind a slow collector.
+const maxExports = 4
+
+// ExporterConfig selects where finished traces are sent.
+type ExporterConfig struct {
+	// Endpoint is the collector's OTLP/HTTP traces URL, e.g.
+	// http://localhost:4318/v1/traces.
+	Endpoint    string
+	Headers     map[string]string // sent with every export, e.g. an API key
+	ServiceName string
+	Timeout     time.Duration
+}
+
+// Exporter sends finished traces to an OpenTelemetry collector as OTLP/HTTP
+// with JSON encoding. It is safe for concurrent use.
+type Exporter struct {
+	cfg        ExporterConfig
+	httpClient *http.Client
+	slots      chan struct{}
+}
+
+// NewExporter validates cfg and returns an Exporter.
+func NewExporter(cfg ExporterConfig) (*Exporter, error) {
+	cfg.Endpoint = strings.TrimSpace(cfg.Endpoint)
+	if cfg.Endpoint == "" {
+		return nil, errors.New("tracing requires an endpoint")
+	}
+	parsed, err := url.Parse(cfg.Endpoint)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid tracing endpoint %q (expected an http or https URL such as http://localhost:4318/v1/traces)", cfg.Endpoint)
+	}
+	if cfg.Timeout < 0 {
+		return nil, errors.New("tracing timeout must be >= 0")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if strings.TrimSpace(cfg.ServiceName) == "" {
+		cfg.ServiceName = DefaultServiceName
+	}
+	return &Exporter{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: cfg.Timeout},
+		slots:      make(chan struct{}, maxExports),
+	}, nil
+}
+
+// Export sends spans in the background. It reports false, without
+// sending, when too many exports are already in flight.
+func (e *Exporter) Export(spans []Span) bool {
+	if len(spans) == 0 {
+		return true
+	}
+	select {
+	case e.slots <- struct{}{}:
+	default:
+		return false
+	}
+	go func() {
+		defer func() { <-e.slots }()
+		_ = e.Send(context.Background(), spans)
+	}()
+	return true
+}
+
+// Send posts spans to the collector and waits for its answer.
+func (e *Exporter) Send(ctx context.Context, spans []Span) error {
+	body, err := json.Marshal(e.payload(spans))
+	if err != nil {
+		return fmt.Errorf("encode spans: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("export spans: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("export spans: collector returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// The OTLP/JSON request body: ExportTraceServiceRequest with IDs in hex and
+// times as nanosecond strings.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            *otlpStatus     `json:"status,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue string `json:"stringValue"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+// Span kinds and status codes of the OTLP protocol.
+const (
+	otlpKindInternal = 1
+	otlpKindServer   = 2
+	otlpStatusError  = 2
+)
+
+func (e *Exporter) payload(spans []Span) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		kind := otlpKindInternal
+		if span.ParentID == "" {
+			kind = otlpKindServer
+		}
+		exported := otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentID,
+			Name:              span.Name,
+			Kind:              kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        attributes(span.Attrs),
+		}
+		if span.Err != "" {
+			exported.Status = &otlpStatus{Code: otlpStatusError, Message: span.Err}
+		}
+		out = append(out, exported)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: attributes(map[string]string{"service.name": e.cfg.ServiceName})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "pantalk"}, Spans: out}},
+	}}}
+}
+
+func attributes(attrs map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	out := make([]otlpAttribute, 0, len(keys))
+	for _, key := range keys {
+		out = append(out, otlpAttribute{Key: key, Value: otlpValue{StringValue: attrs[key]}})
+	}
+	return out
+}
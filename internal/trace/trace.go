@@ -0,0 +1,221 @@
+// Package trace follows a client request through the daemon. The server
+// opens a span per request under a trace ID the client may choose; the
+// steps that can be slow - waiting for a bot's send slot, translation, the
+// connector call, the store write - add child spans, and the finished trace
+// is summarised in the log when it was slow and can be exported to an
+// OpenTelemetry collector.
+//
+// Spans are passed in a context. Every method accepts a nil *Span, which
+// is what Start returns outside a trace, so callers need no checks.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Span is one timed step of a trace.
+type Span struct {
+	TraceID  string
+	SpanID   string
+	ParentID string // empty for the root span
+	Name     string
+	Start    time.Time
+	End      time.Time
+	Attrs    map[string]string
+	Err      string
+
+	trace *recording
+}
+
+// recording collects the finished spans of one trace.
+type recording struct {
+	mu    sync.Mutex
+	spans []Span
+}
+
+// NewID returns a random trace ID: 32 lowercase hex digits, as OpenTelemetry
+// uses.
+func NewID() string {
+	return randomHex(16)
+}
+
+// ValidID reports whether id is a usable trace ID: 32 hex digits, not all
+// zero.
+func ValidID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	raw, err := hex.DecodeString(id)
+	if err != nil {
+		return false
+	}
+	for _, b := range raw {
+		if b != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Begin opens the root span of a trace. An empty traceID starts a new
+// trace; callers check client-supplied IDs with ValidID first.
+func Begin(traceID string, name string) *Span {
+	if traceID == "" {
+		traceID = NewID()
+	}
+	return &Span{
+		TraceID: strings.ToLower(traceID),
+		SpanID:  randomHex(8),
+		Name:    name,
+		Start:   time.Now(),
+		trace:   &recording{},
+	}
+}
+
+// Child opens a span under s.
+func (s *Span) Child(name string) *Span {
+	if s == nil {
+		return nil
+	}
+	return &Span{
+		TraceID:  s.TraceID,
+		SpanID:   randomHex(8),
+		ParentID: s.SpanID,
+		Name:     name,
+		Start:    time.Now(),
+		trace:    s.trace,
+	}
+}
+
+// Set records an attribute of the span, such as the bot it is about.
+func (s *Span) Set(key string, value string) {
+	if s == nil || value == "" {
+		return
+	}
+	s.trace.mu.Lock()
+	defer s.trace.mu.Unlock()
+	if s.Attrs == nil {
+		s.Attrs = make(map[string]string)
+	}
+	s.Attrs[key] = value
+}
+
+// Attr returns an attribute Set on the span.
+func (s *Span) Attr(key string) string {
+	if s == nil {
+		return ""
+	}
+	s.trace.mu.Lock()
+	defer s.trace.mu.Unlock()
+	return s.Attrs[key]
+}
+
+// Finish ends the span, failed when err is not nil, and adds it to its
+// trace. A span is finished once; later calls are ignored.
+func (s *Span) Finish(err error) {
+	if s == nil || !s.End.IsZero() {
+		return
+	}
+	s.End = time.Now()
+	if err != nil {
+		s.Err = err.Error()
+	}
+	s.trace.mu.Lock()
+	finished := *s
+	finished.Attrs = maps.Clone(s.Attrs)
+	s.trace.spans = append(s.trace.spans, finished)
+	s.trace.mu.Unlock()
+}
+
+// Duration is how long the span took, or has taken so far.
+func (s *Span) Duration() time.Duration {
+	if s == nil {
+		return 0
+	}
+	if s.End.IsZero() {
+		return time.Since(s.Start)
+	}
+	return s.End.Sub(s.Start)
+}
+
+// ID returns the span's trace ID, or "" outside a trace.
+func (s *Span) ID() string {
+	if s == nil {
+		return ""
+	}
+	return s.TraceID
+}
+
+// Spans returns the finished spans of the trace s belongs to, in the
+// order they started.
+func (s *Span) Spans() []Span {
+	if s == nil {
+		return nil
+	}
+	s.trace.mu.Lock()
+	spans := append([]Span(nil), s.trace.spans...)
+	s.trace.mu.Unlock()
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+	return spans
+}
+
+// Summary lists the finished spans of the trace below the root with their
+// durations, e.g. "send.slot 2ms, connector.send 7.9s, store.insert_event
+// 3ms", for a log line.
+func (s *Span) Summary() string {
+	var parts []string
+	for _, span := range s.Spans() {
+		if span.ParentID == "" {
+			continue
+		}
+		part := fmt.Sprintf("%s %s", span.Name, span.End.Sub(span.Start).Round(time.Millisecond))
+		if span.Err != "" {
+			part += " (failed)"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+type contextKey struct{}
+
+// NewContext returns ctx carrying span.
+func NewContext(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, contextKey{}, span)
+}
+
+// FromContext returns the span ctx carries, or nil. ctx may be nil.
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(contextKey{}).(*Span)
+	return span
+}
+
+// Start opens a child of the span ctx carries and returns a context
+// carrying the child. Outside a trace it returns ctx and a nil span.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	span := FromContext(ctx).Child(name)
+	return NewContext(ctx, span), span
+}
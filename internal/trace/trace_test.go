@@ -0,0 +1,118 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSpans(t *testing.T) {
+	root := Begin("", "send")
+	if !ValidID(root.TraceID) {
+		t.Fatalf("expected a valid trace ID, got %q", root.TraceID)
+	}
+
+	ctx := NewContext(context.Background(), root)
+	_, call := Start(ctx, "connector.send")
+	write := call.Child("store.insert_event")
+	write.Finish(nil)
+	call.Finish(errors.New("rate limited"))
+	root.Finish(nil)
+	root.Finish(errors.New("ignored"))
+
+	spans := root.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %+v", spans)
+	}
+	if spans[0].Name != "send" || spans[0].ParentID != "" || spans[0].Err != "" {
+		t.Fatalf("expected the root first, got %+v", spans[0])
+	}
+	if spans[1].ParentID != root.SpanID || spans[2].ParentID != call.SpanID || spans[2].TraceID != root.TraceID {
+		t.Fatalf("expected nested spans of one trace, got %+v", spans)
+	}
+	if summary := root.Summary(); !strings.HasPrefix(summary, "connector.send ") || !strings.Contains(summary, "(failed), store.insert_event ") {
+		t.Fatalf("unexpected summary %q", summary)
+	}
+}
+
+func TestSpans_OutsideTrace(t *testing.T) {
+	ctx, span := Start(context.Background(), "connector.send")
+	span.Set("bot", "slack:ops")
+	span.Finish(nil)
+	if span != nil || FromContext(ctx) != nil || span.ID() != "" || span.Summary() != "" {
+		t.Fatal("expected no span outside a trace")
+	}
+}
+
+func TestValidID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"4bf92f3577b34da6a3ce929d0e0e4736": true,
+		"4BF92F3577B34DA6A3CE929D0E0E4736": true,
+		"00000000000000000000000000000000": false,
+		"4bf92f3577b34da6":                 false,
+		"zzf92f3577b34da6a3ce929d0e0e4736": false,
+	} {
+		if got := ValidID(id); got != want {
+			t.Errorf("ValidID(%q) = %t, want %t", id, got, want)
+		}
+	}
+}
+
+func TestExporter_Send(t *testing.T) {
+	var body otlpRequest
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		raw, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(raw, &body); err != nil {
+			t.Errorf("decode export: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	exporter, err := NewExporter(ExporterConfig{Endpoint: srv.URL + "/v1/traces", Headers: map[string]string{"Authorization": "Bearer k"}})
+	if err != nil {
+		t.Fatalf("new exporter: %v", err)
+	}
+
+	root := Begin("4bf92f3577b34da6a3ce929d0e0e4736", "send")
+	root.Set("pantalk.bot", "ops")
+	call := root.Child("connector.send")
+	call.Finish(errors.New("rate limited"))
+	root.Finish(nil)
+
+	if err := exporter.Send(context.Background(), root.Spans()); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if auth != "Bearer k" {
+		t.Fatalf("expected the configured headers, got %q", auth)
+	}
+	if len(body.ResourceSpans) != 1 || body.ResourceSpans[0].Resource.Attributes[0].Value.StringValue != DefaultServiceName {
+		t.Fatalf("expected the pantalkd resource, got %+v", body)
+	}
+	spans := body.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 || spans[0].Kind != otlpKindServer || spans[0].Attributes[0].Key != "pantalk.bot" {
+		t.Fatalf("unexpected root span %+v", spans)
+	}
+	if spans[1].ParentSpanID != root.SpanID || spans[1].Status == nil || spans[1].Status.Code != otlpStatusError {
+		t.Fatalf("expected the failed child span, got %+v", spans[1])
+	}
+}
+
+func TestNewExporter_Invalid(t *testing.T) {
+	for _, cfg := range []ExporterConfig{
+		{},
+		{Endpoint: "localhost:4318"},
+		{Endpoint: "ftp://collector/v1/traces"},
+		{Endpoint: "http://collector/v1/traces", Timeout: -1},
+	} {
+		if _, err := NewExporter(cfg); err == nil {
+			t.Errorf("expected %+v rejected", cfg)
+		}
+	}
+}
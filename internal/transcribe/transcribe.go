@@ -0,0 +1,233 @@
+// Package transcribe turns voice messages into text, either with a local
+// command (whisper.cpp, faster-whisper, ...) or a Whisper-compatible HTTP
+// endpoint such as OpenAI's /v1/audio/transcriptions.
+package transcribe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultModel is sent to endpoints when Config.Model is empty.
+const DefaultModel = "whisper-1"
+
+// DefaultTimeout bounds one transcription when Config.Timeout is zero.
+const DefaultTimeout = 2 * time.Minute
+
+// MaxAudioSize is the largest recording connectors download for
+// transcription, matching the OpenAI upload limit.
+const MaxAudioSize = 25 << 20
+
+// FileArg in a command is replaced by the audio file's path. Commands
+// without it get the path as their last argument.
+const FileArg = "{file}"
+
+// Config selects the transcription backend. Exactly one of Command and
+// Endpoint must be set.
+type Config struct {
+	Command []string
+
+	Endpoint string
+	APIKey   string
+	Model    string
+	Language string // ISO-639-1 hint (optional)
+
+	Timeout time.Duration
+}
+
+// Transcriber runs transcriptions. It is safe for concurrent use.
+type Transcriber struct {
+	cfg        Config
+	httpClient *http.Client
+}
+
+// New validates cfg and returns a Transcriber.
+func New(cfg Config) (*Transcriber, error) {
+	hasCommand := len(cfg.Command) > 0
+	hasEndpoint := strings.TrimSpace(cfg.Endpoint) != ""
+	if hasCommand == hasEndpoint {
+		return nil, errors.New("transcription requires exactly one of command or endpoint")
+	}
+	if cfg.Timeout < 0 {
+		return nil, errors.New("transcription timeout must be >= 0")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.Model == "" {
+		cfg.Model = DefaultModel
+	}
+	cfg.Endpoint = strings.TrimSpace(cfg.Endpoint)
+
+	return &Transcriber{
+		cfg:        cfg,
+		httpClient: &http.Client{},
+	}, nil
+}
+
+// Transcribe returns the text spoken in audio. mimeType picks the file
+// extension backends use to detect the format.
+func (t *Transcriber) Transcribe(ctx context.Context, audio []byte, mimeType string) (string, error) {
+	if len(audio) == 0 {
+		return "", errors.New("audio is empty")
+	}
+	if len(audio) > MaxAudioSize {
+		return "", fmt.Errorf("audio is larger than %d bytes", MaxAudioSize)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.cfg.Timeout)
+	defer cancel()
+
+	var (
+		text string
+		err  error
+	)
+	if len(t.cfg.Command) > 0 {
+		text, err = t.runCommand(ctx, audio, mimeType)
+	} else {
+		text, err = t.postEndpoint(ctx, audio, mimeType)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(text), nil
+}
+
+func (t *Transcriber) runCommand(ctx context.Context, audio []byte, mimeType string) (string, error) {
+	file, err := os.CreateTemp("", "pantalk-audio-*"+Extension(mimeType))
+	if err != nil {
+		return "", fmt.Errorf("create audio file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(audio); err != nil {
+		file.Close()
+		return "", fmt.Errorf("write audio file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("write audio file: %w", err)
+	}
+
+	args := make([]string, 0, len(t.cfg.Command)+1)
+	substituted := false
+	for _, arg := range t.cfg.Command {
+		if strings.Contains(arg, FileArg) {
+			arg = strings.ReplaceAll(arg, FileArg, file.Name())
+			substituted = true
+		}
+		args = append(args, arg)
+	}
+	if !substituted {
+		args = append(args, file.Name())
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if detail := strings.TrimSpace(stderr.String()); detail != "" {
+			return "", fmt.Errorf("transcription command: %w: %s", err, lastLine(detail))
+		}
+		return "", fmt.Errorf("transcription command: %w", err)
+	}
+	return stdout.String(), nil
+}
+
+func (t *Transcriber) postEndpoint(ctx context.Context, audio []byte, mimeType string) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	part, err := form.CreateFormFile("file", "audio"+Extension(mimeType))
+	if err != nil {
+		return "", fmt.Errorf("build transcription request: %w", err)
+	}
+	if _, err := part.Write(audio); err != nil {
+		return "", fmt.Errorf("build transcription request: %w", err)
+	}
+	fields := [][2]string{{"model", t.cfg.Model}, {"response_format", "json"}}
+	if t.cfg.Language != "" {
+		fields = append(fields, [2]string{"language", t.cfg.Language})
+	}
+	for _, field := range fields {
+		if err := form.WriteField(field[0], field[1]); err != nil {
+			return "", fmt.Errorf("build transcription request: %w", err)
+		}
+	}
+	if err := form.Close(); err != nil {
+		return "", fmt.Errorf("build transcription request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.cfg.Endpoint, &body)
+	if err != nil {
+		return "", fmt.Errorf("build transcription request: %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if t.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+t.cfg.APIKey)
+	}
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("transcription request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("transcription request: %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decode transcription response: %w", err)
+	}
+	return result.Text, nil
+}
+
+// Extension returns the file extension for an audio MIME type, ".ogg" for
+// the Opus voice notes most platforms send when it is unknown.
+func Extension(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return ".ogg"
+	}
+	switch mediaType {
+	case "audio/ogg", "audio/opus":
+		return ".ogg"
+	case "audio/mpeg", "audio/mp3":
+		return ".mp3"
+	case "audio/mp4", "audio/m4a", "audio/x-m4a", "audio/aac":
+		return ".m4a"
+	case "audio/wav", "audio/x-wav", "audio/wave":
+		return ".wav"
+	case "audio/webm":
+		return ".webm"
+	case "audio/flac":
+		return ".flac"
+	}
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+		return exts[0]
+	}
+	return ".ogg"
+}
+
+func lastLine(text string) string {
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+		return text[i+1:]
+	}
+	return text
+}
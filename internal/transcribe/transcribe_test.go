@@ -0,0 +1,162 @@
+package transcribe
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{name: "no backend", cfg: Config{}, want: "exactly one of command or endpoint"},
+		{name: "both backends", cfg: Config{Command: []string{"whisper"}, Endpoint: "http://localhost"}, want: "exactly one of command or endpoint"},
+		{name: "negative timeout", cfg: Config{Command: []string{"whisper"}, Timeout: -time.Second}, want: "timeout must be >= 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestTranscribe_Command(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	tests := []struct {
+		name    string
+		command []string
+		want    string
+	}{
+		{name: "path appended", command: []string{"cat"}, want: "turn the lights off"},
+		{name: "path substituted", command: []string{"sh", "-c", "echo heard: $(cat {file})"}, want: "heard: turn the lights off"},
+		{name: "extension from mime type", command: []string{"sh", "-c", "basename {file} | sed 's/.*\\.//'"}, want: "ogg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transcriber, err := New(Config{Command: tt.command})
+			if err != nil {
+				t.Fatalf("new: %v", err)
+			}
+			text, err := transcriber.Transcribe(context.Background(), []byte("turn the lights off\n"), "audio/ogg; codecs=opus")
+			if err != nil {
+				t.Fatalf("transcribe: %v", err)
+			}
+			if text != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, text)
+			}
+		})
+	}
+}
+
+func TestTranscribe_CommandFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	transcriber, err := New(Config{Command: []string{"sh", "-c", "echo loading model >&2; echo no such model >&2; exit 3"}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	_, err = transcriber.Transcribe(context.Background(), []byte("audio"), "audio/ogg")
+	if err == nil || !strings.HasSuffix(err.Error(), "no such model") {
+		t.Fatalf("expected the last stderr line in the error, got %v", err)
+	}
+}
+
+func TestTranscribe_Endpoint(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-test" {
+			t.Errorf("unexpected authorization %q", got)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		if got := r.FormValue("model"); got != DefaultModel {
+			t.Errorf("expected default model, got %q", got)
+		}
+		if got := r.FormValue("language"); got != "de" {
+			t.Errorf("expected language hint, got %q", got)
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("form file: %v", err)
+			return
+		}
+		audio, _ := io.ReadAll(file)
+		if string(audio) != "opus bytes" || header.Filename != "audio.m4a" {
+			t.Errorf("unexpected upload %q (%s)", audio, header.Filename)
+		}
+		_, _ = w.Write([]byte(`{"text":" Licht aus. "}`))
+	}))
+	defer srv.Close()
+
+	transcriber, err := New(Config{Endpoint: srv.URL, APIKey: "sk-test", Language: "de"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	text, err := transcriber.Transcribe(context.Background(), []byte("opus bytes"), "audio/mp4")
+	if err != nil {
+		t.Fatalf("transcribe: %v", err)
+	}
+	if text != "Licht aus." {
+		t.Fatalf("unexpected transcript %q", text)
+	}
+}
+
+func TestTranscribe_EndpointError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid api key"}`, http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	transcriber, err := New(Config{Endpoint: srv.URL})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	_, err = transcriber.Transcribe(context.Background(), []byte("audio"), "audio/ogg")
+	if err == nil || !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "invalid api key") {
+		t.Fatalf("expected the status and body in the error, got %v", err)
+	}
+}
+
+func TestTranscribe_RejectsEmptyAudio(t *testing.T) {
+	transcriber, err := New(Config{Command: []string{"cat"}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if _, err := transcriber.Transcribe(context.Background(), nil, "audio/ogg"); err == nil {
+		t.Fatal("expected an error for empty audio")
+	}
+}
+
+func TestExtension(t *testing.T) {
+	tests := map[string]string{
+		"audio/ogg; codecs=opus": ".ogg",
+		"audio/mpeg":             ".mp3",
+		"audio/mp4":              ".m4a",
+		"audio/x-wav":            ".wav",
+		"":                       ".ogg",
+		"not a mime type":        ".ogg",
+	}
+	for mimeType, want := range tests {
+		if got := Extension(mimeType); got != want {
+			t.Errorf("Extension(%q) = %q, want %q", mimeType, got, want)
+		}
+	}
+}
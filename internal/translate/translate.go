@@ -0,0 +1,192 @@
+// Package translate translates message text through a LibreTranslate or
+// DeepL API, for support channels where people write in several languages.
+package translate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Providers.
+const (
+	LibreTranslate = "libretranslate"
+	DeepL          = "deepl"
+)
+
+// DefaultDeepLEndpoint is DeepL's free API, used when Config.Endpoint is
+// empty. Pro accounts use https://api.deepl.com.
+const DefaultDeepLEndpoint = "https://api-free.deepl.com"
+
+// DefaultTimeout bounds one translation when Config.Timeout is zero.
+const DefaultTimeout = 10 * time.Second
+
+// Config selects the translation backend.
+type Config struct {
+	Provider string // LibreTranslate or DeepL
+	Endpoint string // API base URL; required for LibreTranslate
+	APIKey   string
+
+	Timeout time.Duration
+}
+
+// Result is a translation.
+type Result struct {
+	Text   string // the translation
+	Source string // detected language of the original, lowercase ISO-639-1; may be empty
+}
+
+// Translator runs translations. It is safe for concurrent use.
+type Translator struct {
+	cfg        Config
+	httpClient *http.Client
+}
+
+// New validates cfg and returns a Translator.
+func New(cfg Config) (*Translator, error) {
+	cfg.Provider = strings.ToLower(strings.TrimSpace(cfg.Provider))
+	cfg.Endpoint = strings.TrimRight(strings.TrimSpace(cfg.Endpoint), "/")
+	switch cfg.Provider {
+	case LibreTranslate:
+		if cfg.Endpoint == "" {
+			return nil, errors.New("libretranslate requires an endpoint, e.g. http://localhost:5000")
+		}
+	case DeepL:
+		if strings.TrimSpace(cfg.APIKey) == "" {
+			return nil, errors.New("deepl requires an api_key")
+		}
+		if cfg.Endpoint == "" {
+			cfg.Endpoint = DefaultDeepLEndpoint
+		}
+	case "":
+		return nil, fmt.Errorf("translation requires a provider (%s or %s)", LibreTranslate, DeepL)
+	default:
+		return nil, fmt.Errorf("unknown translation provider %q (expected %s or %s)", cfg.Provider, LibreTranslate, DeepL)
+	}
+	if cfg.Timeout < 0 {
+		return nil, errors.New("translation timeout must be >= 0")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	return &Translator{
+		cfg:        cfg,
+		httpClient: &http.Client{},
+	}, nil
+}
+
+// Translate translates text into the target language, an ISO-639-1 code
+// such as "de".
+func (t *Translator) Translate(ctx context.Context, text string, target string) (Result, error) {
+	target = strings.ToLower(strings.TrimSpace(target))
+	if target == "" {
+		return Result{}, errors.New("target language is required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.cfg.Timeout)
+	defer cancel()
+
+	if t.cfg.Provider == DeepL {
+		return t.deepl(ctx, text, target)
+	}
+	return t.libreTranslate(ctx, text, target)
+}
+
+func (t *Translator) libreTranslate(ctx context.Context, text string, target string) (Result, error) {
+	body := map[string]string{"q": text, "source": "auto", "target": target, "format": "text"}
+	if t.cfg.APIKey != "" {
+		body["api_key"] = t.cfg.APIKey
+	}
+
+	var resp struct {
+		TranslatedText   string `json:"translatedText"`
+		DetectedLanguage struct {
+			Language string `json:"language"`
+		} `json:"detectedLanguage"`
+	}
+	if err := t.post(ctx, t.cfg.Endpoint+"/translate", body, nil, &resp); err != nil {
+		return Result{}, err
+	}
+	return Result{Text: resp.TranslatedText, Source: strings.ToLower(resp.DetectedLanguage.Language)}, nil
+}
+
+func (t *Translator) deepl(ctx context.Context, text string, target string) (Result, error) {
+	body := map[string]any{"text": []string{text}, "target_lang": deeplTarget(target)}
+	header := http.Header{"Authorization": {"DeepL-Auth-Key " + t.cfg.APIKey}}
+
+	var resp struct {
+		Translations []struct {
+			Text           string `json:"text"`
+			DetectedSource string `json:"detected_source_language"`
+		} `json:"translations"`
+	}
+	if err := t.post(ctx, t.cfg.Endpoint+"/v2/translate", body, header, &resp); err != nil {
+		return Result{}, err
+	}
+	if len(resp.Translations) == 0 {
+		return Result{}, errors.New("translation response has no translations")
+	}
+	return Result{Text: resp.Translations[0].Text, Source: strings.ToLower(resp.Translations[0].DetectedSource)}, nil
+}
+
+// deeplTarget maps a language code to DeepL's target_lang, which needs a
+// variant for English and Portuguese.
+func deeplTarget(lang string) string {
+	switch lang {
+	case "en":
+		return "EN-US"
+	case "pt":
+		return "PT-PT"
+	}
+	return strings.ToUpper(lang)
+}
+
+func (t *Translator) post(ctx context.Context, url string, body any, header http.Header, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("build translation request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("build translation request: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("translation request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("translation request: %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode translation response: %w", err)
+	}
+	return nil
+}
+
+// SameLanguage reports whether two language codes name the same language,
+// ignoring regional variants: "en" and "en-GB" do.
+func SameLanguage(a string, b string) bool {
+	base := func(lang string) string {
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		if i := strings.IndexAny(lang, "-_"); i >= 0 {
+			lang = lang[:i]
+		}
+		return lang
+	}
+	return a != "" && b != "" && base(a) == base(b)
+}
@@ -0,0 +1,119 @@
+package translate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{name: "no provider", cfg: Config{}, want: "requires a provider"},
+		{name: "unknown provider", cfg: Config{Provider: "babelfish"}, want: `unknown translation provider "babelfish"`},
+		{name: "libretranslate without endpoint", cfg: Config{Provider: LibreTranslate}, want: "requires an endpoint"},
+		{name: "deepl without key", cfg: Config{Provider: DeepL}, want: "requires an api_key"},
+		{name: "negative timeout", cfg: Config{Provider: DeepL, APIKey: "k", Timeout: -time.Second}, want: "timeout must be >= 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestTranslate_LibreTranslate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/translate" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		if body["q"] != "¿dónde está mi pedido?" || body["source"] != "auto" || body["target"] != "en" || body["api_key"] != "lt-key" {
+			t.Errorf("unexpected request %v", body)
+		}
+		_, _ = w.Write([]byte(`{"translatedText":"where is my order?","detectedLanguage":{"confidence":92,"language":"es"}}`))
+	}))
+	defer srv.Close()
+
+	translator, err := New(Config{Provider: LibreTranslate, Endpoint: srv.URL + "/", APIKey: "lt-key"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	got, err := translator.Translate(context.Background(), "¿dónde está mi pedido?", "EN")
+	if err != nil {
+		t.Fatalf("translate: %v", err)
+	}
+	if got.Text != "where is my order?" || got.Source != "es" {
+		t.Fatalf("unexpected result %+v", got)
+	}
+}
+
+func TestTranslate_DeepL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/translate" || r.Header.Get("Authorization") != "DeepL-Auth-Key dl-key" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Header)
+		}
+		var body struct {
+			Text       []string `json:"text"`
+			TargetLang string   `json:"target_lang"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		if len(body.Text) != 1 || body.TargetLang != "DE" {
+			t.Errorf("unexpected request %+v", body)
+		}
+		_, _ = w.Write([]byte(`{"translations":[{"detected_source_language":"EN","text":"Ihre Bestellung ist unterwegs."}]}`))
+	}))
+	defer srv.Close()
+
+	translator, err := New(Config{Provider: DeepL, Endpoint: srv.URL, APIKey: "dl-key"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	got, err := translator.Translate(context.Background(), "Your order is on its way.", "de")
+	if err != nil {
+		t.Fatalf("translate: %v", err)
+	}
+	if got.Text != "Ihre Bestellung ist unterwegs." || got.Source != "en" {
+		t.Fatalf("unexpected result %+v", got)
+	}
+}
+
+func TestTranslate_Error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"Quota exceeded"}`, 456)
+	}))
+	defer srv.Close()
+
+	translator, err := New(Config{Provider: DeepL, Endpoint: srv.URL, APIKey: "dl-key"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if _, err := translator.Translate(context.Background(), "hi", "de"); err == nil || !strings.Contains(err.Error(), "Quota exceeded") {
+		t.Fatalf("expected the API error, got %v", err)
+	}
+}
+
+func TestSameLanguage(t *testing.T) {
+	if !SameLanguage("en", "EN-GB") || !SameLanguage("pt_BR", "pt") {
+		t.Error("expected regional variants to match their language")
+	}
+	if SameLanguage("en", "de") || SameLanguage("", "") {
+		t.Error("expected different or unknown languages not to match")
+	}
+}
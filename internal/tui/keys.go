@@ -0,0 +1,110 @@
+package tui
+
+import "unicode/utf8"
+
+type keyKind int
+
+const (
+	keyRune keyKind = iota
+	keyEnter
+	keyBackspace
+	keyUp
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyTab
+	keyClearLine // Ctrl-U
+	keyQuit      // Ctrl-C
+	keyEOF       // Ctrl-D
+)
+
+type key struct {
+	kind keyKind
+	r    rune
+}
+
+// decodeKeys turns bytes read from a raw-mode terminal into keys. Escape
+// sequences it doesn't know are skipped; a sequence cut off at the end of
+// buf is returned as rest to be prefixed to the next read.
+func decodeKeys(buf []byte) (keys []key, rest []byte) {
+	for len(buf) > 0 {
+		b := buf[0]
+		switch {
+		case b == 0x1b:
+			k, n, ok := decodeEscape(buf)
+			if n == 0 {
+				return keys, buf
+			}
+			if ok {
+				keys = append(keys, k)
+			}
+			buf = buf[n:]
+			continue
+		case b == '\r' || b == '\n':
+			keys = append(keys, key{kind: keyEnter})
+		case b == 0x7f || b == 0x08:
+			keys = append(keys, key{kind: keyBackspace})
+		case b == '\t':
+			keys = append(keys, key{kind: keyTab})
+		case b == 0x03:
+			keys = append(keys, key{kind: keyQuit})
+		case b == 0x04:
+			keys = append(keys, key{kind: keyEOF})
+		case b == 0x0e: // Ctrl-N
+			keys = append(keys, key{kind: keyDown})
+		case b == 0x10: // Ctrl-P
+			keys = append(keys, key{kind: keyUp})
+		case b == 0x15:
+			keys = append(keys, key{kind: keyClearLine})
+		case b < 0x20:
+			// Other control characters have no binding.
+		default:
+			if !utf8.FullRune(buf) {
+				return keys, buf
+			}
+			r, n := utf8.DecodeRune(buf)
+			if r != utf8.RuneError {
+				keys = append(keys, key{kind: keyRune, r: r})
+			}
+			buf = buf[n:]
+			continue
+		}
+		buf = buf[1:]
+	}
+	return keys, nil
+}
+
+// decodeEscape decodes the escape sequence at the start of buf, returning
+// how many bytes it used (0 when it is incomplete) and whether it is a key
+// the TUI binds.
+func decodeEscape(buf []byte) (key, int, bool) {
+	if len(buf) < 2 {
+		// A lone Escape press; nothing is bound to it.
+		return key{}, 1, false
+	}
+	if buf[1] != '[' && buf[1] != 'O' {
+		return key{}, 1, false
+	}
+
+	// CSI: parameters, then a final byte in 0x40-0x7e.
+	end := 2
+	for end < len(buf) && (buf[end] < 0x40 || buf[end] > 0x7e) {
+		end++
+	}
+	if end == len(buf) {
+		return key{}, 0, false
+	}
+	n := end + 1
+
+	switch string(buf[2:n]) {
+	case "A":
+		return key{kind: keyUp}, n, true
+	case "B":
+		return key{kind: keyDown}, n, true
+	case "5~":
+		return key{kind: keyPageUp}, n, true
+	case "6~":
+		return key{kind: keyPageDown}, n, true
+	}
+	return key{}, n, false
+}
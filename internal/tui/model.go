@@ -0,0 +1,393 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// maxChannelMessages bounds the messages kept per conversation.
+const maxChannelMessages = 500
+
+// conversation is one channel (or DM target) of one bot.
+type conversation struct {
+	service, bot string
+	channel      string // the channel ID, or empty for target-only events
+	target       string
+	thread       string // replies go to this thread; set with /thread
+	messages     []protocol.Event
+	unseen       int
+}
+
+func (c *conversation) botKey() string { return c.service + ":" + c.bot }
+
+func (c *conversation) label() string {
+	if c.channel != "" {
+		return c.channel
+	}
+	return c.target
+}
+
+// model is the state of the TUI. It is only touched by the UI goroutine.
+type model struct {
+	bots          []protocol.BotRef
+	conversations []*conversation
+	selected      int
+	scroll        int // message lines scrolled up from the newest
+	input         []rune
+	status        string
+}
+
+func conversationKey(service, bot, channel, target string) string {
+	if channel != "" {
+		return service + ":" + bot + "\x00" + channel
+	}
+	return service + ":" + bot + "\x00target:" + target
+}
+
+// find returns the conversation of event, creating it (in list order) if
+// it is new.
+func (m *model) find(event protocol.Event) *conversation {
+	want := conversationKey(event.Service, event.Bot, event.Channel, event.Target)
+	for _, conv := range m.conversations {
+		if conversationKey(conv.service, conv.bot, conv.channel, conv.target) == want {
+			return conv
+		}
+	}
+
+	current := m.current()
+	conv := &conversation{service: event.Service, bot: event.Bot, channel: event.Channel, target: event.Target}
+	m.conversations = append(m.conversations, conv)
+	sort.SliceStable(m.conversations, func(i, j int) bool {
+		a, b := m.conversations[i], m.conversations[j]
+		if a.botKey() != b.botKey() {
+			return a.botKey() < b.botKey()
+		}
+		return a.label() < b.label()
+	})
+	// Keep the selection on the conversation the user is reading.
+	for i, c := range m.conversations {
+		if c == current {
+			m.selected = i
+		}
+	}
+	return conv
+}
+
+func (m *model) current() *conversation {
+	if m.selected < 0 || m.selected >= len(m.conversations) {
+		return nil
+	}
+	return m.conversations[m.selected]
+}
+
+// addEvent files event under its conversation. Live notifications count as
+// unseen unless their conversation is open.
+func (m *model) addEvent(event protocol.Event, live bool) {
+	if event.Kind == protocol.KindReplayDone || (event.Channel == "" && event.Target == "") {
+		return
+	}
+	conv := m.find(event)
+	for _, existing := range conv.messages {
+		if existing.ID != 0 && existing.ID == event.ID {
+			return
+		}
+	}
+
+	i := sort.Search(len(conv.messages), func(i int) bool { return conv.messages[i].ID > event.ID })
+	if event.ID == 0 {
+		i = len(conv.messages)
+	}
+	conv.messages = append(conv.messages, protocol.Event{})
+	copy(conv.messages[i+1:], conv.messages[i:])
+	conv.messages[i] = event
+	if over := len(conv.messages) - maxChannelMessages; over > 0 {
+		conv.messages = conv.messages[over:]
+	}
+
+	if live && event.Notify && conv != m.current() {
+		conv.unseen++
+	}
+}
+
+// addUnseen counts stored unseen notifications of a conversation.
+func (m *model) addUnseen(event protocol.Event) {
+	if event.Channel == "" && event.Target == "" {
+		return
+	}
+	m.find(event).unseen++
+}
+
+func (m *model) move(delta int) {
+	if len(m.conversations) == 0 {
+		return
+	}
+	m.selected = (m.selected + delta + len(m.conversations)) % len(m.conversations)
+	m.scroll = 0
+	m.current().unseen = 0
+}
+
+// handleKey applies a key press. It returns a request to send, if the key
+// submitted one, and whether the user asked to quit.
+func (m *model) handleKey(k key, pageLines int) (*protocol.Request, bool) {
+	switch k.kind {
+	case keyQuit:
+		return nil, true
+	case keyEOF:
+		return nil, len(m.input) == 0
+	case keyUp:
+		m.move(-1)
+	case keyDown, keyTab:
+		m.move(1)
+	case keyPageUp:
+		m.scroll += max(pageLines/2, 1)
+	case keyPageDown:
+		m.scroll = max(m.scroll-max(pageLines/2, 1), 0)
+	case keyBackspace:
+		if len(m.input) > 0 {
+			m.input = m.input[:len(m.input)-1]
+		}
+	case keyClearLine:
+		m.input = m.input[:0]
+	case keyRune:
+		m.input = append(m.input, k.r)
+	case keyEnter:
+		line := strings.TrimSpace(string(m.input))
+		m.input = m.input[:0]
+		return m.submit(line)
+	}
+	return nil, false
+}
+
+// submit handles an entered line: a /command or a message for the open
+// conversation.
+func (m *model) submit(line string) (*protocol.Request, bool) {
+	if line == "" {
+		return nil, false
+	}
+	conv := m.current()
+
+	if strings.HasPrefix(line, "/") {
+		command, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+		switch command {
+		case "/quit", "/q":
+			return nil, true
+		case "/thread":
+			if conv == nil {
+				m.status = "no conversation selected"
+				return nil, false
+			}
+			conv.thread = arg
+			if arg == "" {
+				m.status = "replying in the channel"
+			} else {
+				m.status = "replying in thread " + arg
+			}
+		default:
+			m.status = fmt.Sprintf("unknown command %s (try /thread ID, /thread, /quit)", command)
+		}
+		return nil, false
+	}
+
+	if conv == nil {
+		m.status = "no conversation selected"
+		return nil, false
+	}
+	m.scroll = 0
+	return &protocol.Request{
+		Action:  protocol.ActionSend,
+		Service: conv.service,
+		Bot:     conv.bot,
+		Channel: conv.channel,
+		Target:  conv.target,
+		Thread:  conv.thread,
+		Text:    line,
+	}, false
+}
+
+// render draws the screen as width x height cells, one string per row.
+func (m *model) render(width, height int) []string {
+	if width < 20 || height < 5 {
+		rows := []string{fit("terminal too small", width)}
+		for len(rows) < height {
+			rows = append(rows, fit("", width))
+		}
+		return rows
+	}
+
+	listWidth := min(28, width/3)
+	paneWidth := width - listWidth - 1
+	bodyHeight := height - 3
+	rows := make([]string, 0, height)
+
+	title := " pantalk"
+	if conv := m.current(); conv != nil {
+		title += "  " + conv.botKey() + "  " + conv.label()
+		if conv.thread != "" {
+			title += "  thread " + conv.thread
+		}
+	}
+	rows = append(rows, "\x1b[7m"+fit(title, width)+"\x1b[0m")
+
+	list := m.listLines(listWidth, bodyHeight)
+	messages := m.messageLines(paneWidth, bodyHeight)
+	for i := 0; i < bodyHeight; i++ {
+		rows = append(rows, list[i]+"│"+fit(messages[i], paneWidth))
+	}
+
+	rows = append(rows, "\x1b[2m"+fit(" "+m.status, width)+"\x1b[0m")
+	rows = append(rows, fit("> "+tail(string(m.input), width-3), width))
+	return rows
+}
+
+// listLines renders the conversation list, bot headings included, scrolled
+// so the selection is visible.
+func (m *model) listLines(width, height int) []string {
+	var lines []string
+	selectedLine := 0
+	lastBot := ""
+	for i, conv := range m.conversations {
+		if conv.botKey() != lastBot {
+			lastBot = conv.botKey()
+			lines = append(lines, "\x1b[1m"+fit(lastBot, width)+"\x1b[0m")
+		}
+		label := " " + conv.label()
+		badge := ""
+		if conv.unseen > 0 {
+			badge = fmt.Sprintf(" (%d)", conv.unseen)
+		}
+		text := fit(truncate(label, width-utf8.RuneCountInString(badge))+badge, width)
+		if i == m.selected {
+			selectedLine = len(lines)
+			text = "\x1b[7m" + text + "\x1b[0m"
+		} else if conv.unseen > 0 {
+			text = "\x1b[1m" + text + "\x1b[0m"
+		}
+		lines = append(lines, text)
+	}
+	if len(m.conversations) == 0 {
+		lines = append(lines, fit(" no conversations yet", width))
+	}
+
+	start := 0
+	if selectedLine >= height {
+		start = selectedLine - height + 1
+	}
+	lines = lines[start:]
+	for len(lines) < height {
+		lines = append(lines, strings.Repeat(" ", width))
+	}
+	return lines[:height]
+}
+
+// messageLines renders the open conversation's messages, wrapped to width
+// and ending at the newest unless scrolled up.
+func (m *model) messageLines(width, height int) []string {
+	var lines []string
+	if conv := m.current(); conv != nil {
+		for _, event := range conv.messages {
+			lines = append(lines, wrap(formatMessage(event), width)...)
+		}
+	}
+
+	m.scroll = min(m.scroll, max(len(lines)-height, 0))
+	end := len(lines) - m.scroll
+	start := max(end-height, 0)
+	lines = lines[start:end]
+	for len(lines) < height {
+		lines = append([]string{""}, lines...)
+	}
+	return lines
+}
+
+func formatMessage(event protocol.Event) string {
+	who := event.User
+	if event.Direction == "out" || event.Self {
+		who = "me"
+	}
+	if who == "" {
+		who = "?"
+	}
+	text := strings.ReplaceAll(event.Text, "\n", " ")
+	if event.Kind != "" && event.Kind != "message" {
+		text = "[" + event.Kind + "] " + text
+	}
+	for _, attachment := range event.Attachments {
+		name := attachment.Name
+		if name == "" {
+			name = attachment.Kind
+		}
+		text += " <" + name + ">"
+	}
+	if event.Thread != "" {
+		text += " (thread " + event.Thread + ")"
+	}
+	return event.Timestamp.Local().Format("15:04") + " " + who + ": " + text
+}
+
+// wrap splits s into lines of at most width runes.
+func wrap(s string, width int) []string {
+	runes := []rune(StripControls(s))
+	if len(runes) == 0 {
+		return []string{""}
+	}
+	var lines []string
+	for len(runes) > width {
+		cut := width
+		for i := width; i > width/2; i-- {
+			if runes[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		lines = append(lines, string(runes[:cut]))
+		runes = runes[cut:]
+		if len(runes) > 0 && runes[0] == ' ' {
+			runes = runes[1:]
+		}
+	}
+	return append(lines, string(runes))
+}
+
+// fit pads or truncates s to exactly width runes. s must not contain
+// escape sequences.
+func fit(s string, width int) string {
+	s = truncate(StripControls(s), width)
+	return s + strings.Repeat(" ", max(width-utf8.RuneCountInString(s), 0))
+}
+
+func truncate(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:width-1]) + "…"
+}
+
+// tail keeps the last width runes of s, for an input line longer than the
+// screen.
+func tail(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	return string(runes[len(runes)-width:])
+}
+
+// StripControls drops control characters (escape sequences from chat
+// messages among them) that would corrupt the screen.
+func StripControls(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || (r >= 0x80 && r < 0xa0) {
+			return -1
+		}
+		return r
+	}, s)
+}
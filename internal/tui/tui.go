@@ -0,0 +1,267 @@
+// Package tui implements `pantalk tui`, a small terminal chat client over
+// the daemon socket: conversations per bot, their messages, unseen
+// notification badges and a line to send from.
+package tui
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// Options configure Run.
+type Options struct {
+	Socket  string
+	Service string // only show bots of this service
+	Bot     string // only show this bot
+	History int    // stored messages loaded per bot
+}
+
+// liveID tags the subscription on the multiplexed connection.
+const liveID = "live"
+
+// client is the TUI's single multiplexed connection to the daemon.
+type client struct {
+	conn    net.Conn
+	encoder *json.Encoder
+	decoder *json.Decoder
+	nextID  int
+}
+
+// call sends req and waits for its response. It is only used before the
+// subscription starts, while nothing else is in flight.
+func (c *client) call(req protocol.Request) (protocol.Response, error) {
+	req.ID = c.tag()
+	if err := c.encoder.Encode(req); err != nil {
+		return protocol.Response{}, fmt.Errorf("send request: %w", err)
+	}
+	for {
+		var resp protocol.Response
+		if err := c.decoder.Decode(&resp); err != nil {
+			return protocol.Response{}, fmt.Errorf("read response: %w", err)
+		}
+		if resp.ID == req.ID {
+			if !resp.OK {
+				return resp, errors.New(resp.Error)
+			}
+			return resp, nil
+		}
+	}
+}
+
+func (c *client) tag() string {
+	c.nextID++
+	return fmt.Sprintf("r%d", c.nextID)
+}
+
+// Run opens the TUI on the terminal and returns when the user quits.
+func Run(opts Options) error {
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return errors.New("pantalk tui needs a terminal")
+	}
+
+	conn, err := net.Dial("unix", opts.Socket)
+	if err != nil {
+		return fmt.Errorf("connect socket: %w", err)
+	}
+	defer conn.Close()
+	c := &client{conn: conn, encoder: json.NewEncoder(conn), decoder: json.NewDecoder(conn)}
+
+	m := &model{}
+	resumeID, err := load(c, m, opts)
+	if err != nil {
+		return err
+	}
+	if err := c.encoder.Encode(protocol.Request{
+		ID:      liveID,
+		Action:  protocol.ActionSubscribe,
+		Service: opts.Service,
+		Bot:     opts.Bot,
+		SinceID: resumeID,
+	}); err != nil {
+		return fmt.Errorf("subscribe: %w", err)
+	}
+
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return fmt.Errorf("enter raw mode: %w", err)
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state)
+	// Alternate screen, hidden cursor; restored on the way out.
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	return loop(c, m)
+}
+
+// load fills m with the bots, their recent history and the unseen
+// notifications, and returns the event ID the subscription resumes after:
+// the oldest of the bots' newest events, so nothing published while the
+// bots loaded one by one is missed. Events replayed twice are dropped by
+// ID.
+func load(c *client, m *model, opts Options) (int64, error) {
+	resp, err := c.call(protocol.Request{Action: protocol.ActionHello, Version: protocol.ProtocolVersion})
+	if err != nil {
+		return 0, fmt.Errorf("protocol mismatch: %w", err)
+	}
+	if resp.Hello == nil || !slices.Contains(resp.Hello.Actions, protocol.ActionUnsubscribe) {
+		return 0, errors.New("protocol mismatch: pantalkd is too old for the TUI; upgrade pantalkd and restart it")
+	}
+
+	resp, err = c.call(protocol.Request{Action: protocol.ActionBots, Service: opts.Service})
+	if err != nil {
+		return 0, err
+	}
+	for _, bot := range resp.Bots {
+		if opts.Bot == "" || bot.Name == opts.Bot {
+			m.bots = append(m.bots, bot)
+		}
+	}
+	if len(m.bots) == 0 {
+		return 0, errors.New("no bots to show")
+	}
+
+	var resumeID int64
+	for _, bot := range m.bots {
+		resp, err := c.call(protocol.Request{Action: protocol.ActionHistory, Service: bot.Service, Bot: bot.Name, Limit: opts.History})
+		if err != nil {
+			return 0, fmt.Errorf("history of %s:%s: %w", bot.Service, bot.Name, err)
+		}
+		var newest int64
+		for _, event := range resp.Events {
+			m.addEvent(event, false)
+			newest = max(newest, event.ID)
+		}
+		if newest > 0 && (resumeID == 0 || newest < resumeID) {
+			resumeID = newest
+		}
+
+		resp, err = c.call(protocol.Request{Action: protocol.ActionNotify, Service: bot.Service, Bot: bot.Name, Unseen: true, Limit: 1000})
+		if err != nil {
+			return 0, fmt.Errorf("notifications of %s:%s: %w", bot.Service, bot.Name, err)
+		}
+		for _, event := range resp.Events {
+			m.addUnseen(event)
+		}
+	}
+	if len(m.conversations) > 0 {
+		m.current().unseen = 0
+	}
+	m.status = "↑/↓ switch conversation · PgUp/PgDn scroll · Enter send · /thread ID reply in a thread · Ctrl-C quit"
+	return resumeID, nil
+}
+
+// loop runs the UI until the user quits or the connection drops.
+func loop(c *client, m *model) error {
+	responses := make(chan protocol.Response)
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			var resp protocol.Response
+			if err := c.decoder.Decode(&resp); err != nil {
+				readErr <- err
+				return
+			}
+			responses <- resp
+		}
+	}()
+
+	keys := make(chan []key)
+	go readKeys(os.Stdin, keys)
+
+	// The size is polled rather than taken from SIGWINCH so this works the
+	// same on every platform.
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	width, height := terminalSize()
+	draw(m, width, height)
+	for {
+		select {
+		case resp := <-responses:
+			switch {
+			case resp.ID == liveID && !resp.OK:
+				return fmt.Errorf("stream ended: %s", resp.Error)
+			case resp.ID == liveID && resp.Event != nil:
+				m.addEvent(*resp.Event, true)
+			case !resp.OK:
+				m.status = "error: " + resp.Error
+			case resp.Ack != "" && resp.Ack != "subscribed":
+				m.status = resp.Ack
+			}
+		case err := <-readErr:
+			if errors.Is(err, io.EOF) {
+				return errors.New("pantalkd closed the connection")
+			}
+			return err
+		case batch, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			for _, k := range batch {
+				req, quit := m.handleKey(k, height-3)
+				if quit {
+					return nil
+				}
+				if req != nil {
+					req.ID = c.tag()
+					if err := c.encoder.Encode(req); err != nil {
+						return fmt.Errorf("send request: %w", err)
+					}
+					m.status = "sending…"
+				}
+			}
+		case <-ticker.C:
+			w, h := terminalSize()
+			if w == width && h == height {
+				continue
+			}
+			width, height = w, h
+		}
+		draw(m, width, height)
+	}
+}
+
+func readKeys(r io.Reader, out chan<- []key) {
+	defer close(out)
+	buf := make([]byte, 256)
+	var pending []byte
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		var batch []key
+		batch, pending = decodeKeys(append(pending, buf[:n]...))
+		if len(batch) > 0 {
+			out <- batch
+		}
+	}
+}
+
+func terminalSize() (int, int) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 80, 24
+	}
+	return width, height
+}
+
+func draw(m *model, width, height int) {
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for i, row := range m.render(width, height) {
+		fmt.Fprintf(&b, "\x1b[%d;1H%s", i+1, row)
+	}
+	os.Stdout.WriteString(b.String())
+}
@@ -0,0 +1,175 @@
+package tui
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+func TestDecodeKeys(t *testing.T) {
+	keys, rest := decodeKeys([]byte("hé\x1b[A\x1b[B\x1b[5~\x1b[6~\x1b[C\r\x7f\x03\x1b["))
+	want := []key{
+		{kind: keyRune, r: 'h'},
+		{kind: keyRune, r: 'é'},
+		{kind: keyUp},
+		{kind: keyDown},
+		{kind: keyPageUp},
+		{kind: keyPageDown},
+		{kind: keyEnter},
+		{kind: keyBackspace},
+		{kind: keyQuit},
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("unexpected keys:\n got %+v\nwant %+v", keys, want)
+	}
+	if string(rest) != "\x1b[" {
+		t.Fatalf("expected the cut-off sequence kept, got %q", rest)
+	}
+
+	keys, rest = decodeKeys(append(rest, 'A'))
+	if len(keys) != 1 || keys[0].kind != keyUp || len(rest) != 0 {
+		t.Fatalf("expected the sequence completed by the next read, got %+v %q", keys, rest)
+	}
+
+	// A multi-byte rune split across reads.
+	if keys, rest := decodeKeys([]byte{0xc3}); len(keys) != 0 || len(rest) != 1 {
+		t.Fatalf("expected a partial rune kept, got %+v %q", keys, rest)
+	}
+}
+
+func event(id int64, bot, channel, text string, notify bool) protocol.Event {
+	return protocol.Event{
+		ID:        id,
+		Timestamp: time.Date(2026, 1, 2, 9, 30, 0, 0, time.Local),
+		Service:   "slack",
+		Bot:       bot,
+		Kind:      "message",
+		Direction: "in",
+		User:      "alice",
+		Channel:   channel,
+		Notify:    notify,
+		Text:      text,
+	}
+}
+
+func TestModel_EventsAndBadges(t *testing.T) {
+	m := &model{}
+	m.addEvent(event(2, "ops", "C2", "second", false), false)
+	m.addEvent(event(1, "ops", "C1", "first", false), false)
+	m.addUnseen(event(1, "ops", "C1", "first", true))
+
+	if len(m.conversations) != 2 || m.conversations[0].channel != "C1" {
+		t.Fatalf("expected conversations sorted by channel, got %+v", m.conversations)
+	}
+	// The selection stayed on C2, the first conversation seen.
+	if m.current().channel != "C2" {
+		t.Fatalf("expected C2 still selected, got %s", m.current().channel)
+	}
+
+	m.addEvent(event(4, "ops", "C1", "ping", true), true)
+	m.addEvent(event(3, "ops", "C1", "late", false), true)
+	m.addEvent(event(4, "ops", "C1", "ping", true), true) // replayed twice
+	c1 := m.conversations[0]
+	if c1.unseen != 2 {
+		t.Fatalf("expected 2 unseen in C1, got %d", c1.unseen)
+	}
+	var ids []int64
+	for _, e := range c1.messages {
+		ids = append(ids, e.ID)
+	}
+	if !reflect.DeepEqual(ids, []int64{1, 3, 4}) {
+		t.Fatalf("expected messages in ID order without duplicates, got %v", ids)
+	}
+
+	m.addEvent(event(5, "ops", "C2", "open", true), true)
+	if m.current().unseen != 0 {
+		t.Fatal("expected no badge for the open conversation")
+	}
+
+	m.handleKey(key{kind: keyUp}, 10)
+	if m.current() != c1 || c1.unseen != 0 {
+		t.Fatalf("expected moving to C1 to clear its badge, got %+v", m.current())
+	}
+}
+
+func TestModel_Submit(t *testing.T) {
+	m := &model{}
+	if req, _ := m.handleKey(key{kind: keyEnter}, 10); req != nil {
+		t.Fatal("expected an empty line to send nothing")
+	}
+	for _, r := range "hi" {
+		m.handleKey(key{kind: keyRune, r: r}, 10)
+	}
+	if req, _ := m.handleKey(key{kind: keyEnter}, 10); req != nil || !strings.Contains(m.status, "no conversation") {
+		t.Fatalf("expected a send without a conversation refused, got %+v (%s)", req, m.status)
+	}
+
+	m.addEvent(event(1, "ops", "C1", "hello", false), false)
+	for _, r := range "/thread 171.5" {
+		m.handleKey(key{kind: keyRune, r: r}, 10)
+	}
+	m.handleKey(key{kind: keyEnter}, 10)
+	for _, r := range " hello there " {
+		m.handleKey(key{kind: keyRune, r: r}, 10)
+	}
+	m.handleKey(key{kind: keyBackspace}, 10)
+	req, quit := m.handleKey(key{kind: keyEnter}, 10)
+	want := &protocol.Request{Action: protocol.ActionSend, Service: "slack", Bot: "ops", Channel: "C1", Thread: "171.5", Text: "hello there"}
+	if quit || !reflect.DeepEqual(req, want) {
+		t.Fatalf("unexpected send request: %+v", req)
+	}
+	if len(m.input) != 0 {
+		t.Fatal("expected the input cleared after sending")
+	}
+
+	for _, r := range "/quit" {
+		m.handleKey(key{kind: keyRune, r: r}, 10)
+	}
+	if _, quit := m.handleKey(key{kind: keyEnter}, 10); !quit {
+		t.Fatal("expected /quit to quit")
+	}
+}
+
+func TestModel_Render(t *testing.T) {
+	m := &model{}
+	m.addEvent(event(1, "ops", "C1", "a message long enough to wrap over two lines \x1b[31mred", false), false)
+	m.addUnseen(event(2, "ops", "C2", "", true))
+
+	rows := m.render(60, 8)
+	if len(rows) != 8 {
+		t.Fatalf("expected 8 rows, got %d", len(rows))
+	}
+	screen := strings.Join(rows, "\n")
+	for _, want := range []string{"slack:ops", " C1", " C2 (1)", "09:30 alice: a message", "> "} {
+		if !strings.Contains(screen, want) {
+			t.Fatalf("expected %q on screen:\n%s", want, screen)
+		}
+	}
+	if strings.Contains(screen, "\x1b[31m") {
+		t.Fatal("expected escape sequences from messages stripped")
+	}
+	for i, row := range rows[1 : len(rows)-2] {
+		if n := len([]rune(stripEscapes(row))); n != 60 {
+			t.Fatalf("row %d is %d cells wide: %q", i+1, n, row)
+		}
+	}
+
+	if rows := m.render(10, 3); len(rows) != 3 {
+		t.Fatalf("expected a too-small screen to still fill its rows, got %d", len(rows))
+	}
+}
+
+// stripEscapes removes the SGR sequences render adds.
+func stripEscapes(s string) string {
+	for {
+		start := strings.Index(s, "\x1b[")
+		if start < 0 {
+			return s
+		}
+		end := strings.IndexByte(s[start:], 'm')
+		s = s[:start] + s[start+end+1:]
+	}
+}
@@ -0,0 +1,266 @@
+// Package unfurl fetches the title and description of pages linked from
+// messages, so agents know what a link is about without fetching it.
+//
+// Only pages on allowlisted domains are fetched: unfurling follows links
+// that anyone in a channel can post, so an open unfurler would let them
+// make the daemon request arbitrary URLs, including ones on its network.
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// DefaultTimeout bounds fetching one page when Config.Timeout is zero.
+const DefaultTimeout = 5 * time.Second
+
+// DefaultMaxLinks is how many links of a message are unfurled when
+// Config.MaxLinks is zero.
+const DefaultMaxLinks = 3
+
+// maxPage bounds what is read of a page; the metadata is in its head.
+const maxPage = 512 << 10
+
+// maxField bounds the length of a title or description.
+const maxField = 500
+
+// Config selects what is unfurled.
+type Config struct {
+	// Domains are the hosts whose pages are fetched. An entry also allows
+	// its subdomains: "github.com" allows "gist.github.com".
+	Domains []string
+
+	Timeout  time.Duration // per page
+	MaxLinks int           // per message
+}
+
+// Unfurler fetches link metadata. It is safe for concurrent use.
+type Unfurler struct {
+	cfg        Config
+	httpClient *http.Client
+}
+
+// New validates cfg and returns an Unfurler.
+func New(cfg Config) (*Unfurler, error) {
+	domains := make([]string, 0, len(cfg.Domains))
+	for _, domain := range cfg.Domains {
+		domain = strings.ToLower(strings.Trim(strings.TrimSpace(domain), "."))
+		if domain == "" || strings.ContainsAny(domain, "/:*") {
+			return nil, fmt.Errorf("invalid unfurl domain %q (expected a host name such as github.com)", domain)
+		}
+		domains = append(domains, domain)
+	}
+	if len(domains) == 0 {
+		return nil, errors.New("unfurl requires at least one domain")
+	}
+	cfg.Domains = domains
+
+	if cfg.Timeout < 0 {
+		return nil, errors.New("unfurl timeout must be >= 0")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.MaxLinks < 0 {
+		return nil, errors.New("unfurl max_links must be >= 0")
+	}
+	if cfg.MaxLinks == 0 {
+		cfg.MaxLinks = DefaultMaxLinks
+	}
+
+	u := &Unfurler{cfg: cfg}
+	u.httpClient = &http.Client{
+		// Redirects must stay on allowlisted domains too.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			if !u.Allowed(req.URL) {
+				return fmt.Errorf("redirect to %s is not on an unfurl domain", req.URL.Host)
+			}
+			return nil
+		},
+	}
+	return u, nil
+}
+
+// Allowed reports whether link is an http(s) URL on an allowlisted domain.
+func (u *Unfurler) Allowed(link *url.URL) bool {
+	if link.Scheme != "http" && link.Scheme != "https" {
+		return false
+	}
+	host := strings.ToLower(link.Hostname())
+	for _, domain := range u.cfg.Domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unfurl returns the metadata of the allowlisted links in text, in the
+// order they appear. Links whose page can't be fetched are left out; the
+// error reports the first failure.
+func (u *Unfurler) Unfurl(ctx context.Context, text string) ([]protocol.Link, error) {
+	var links []protocol.Link
+	var firstErr error
+	for _, raw := range URLs(text) {
+		if len(links) >= u.cfg.MaxLinks {
+			break
+		}
+		parsed, err := url.Parse(raw)
+		if err != nil || !u.Allowed(parsed) {
+			continue
+		}
+		link, err := u.fetch(ctx, parsed.String())
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		links = append(links, link)
+	}
+	return links, firstErr
+}
+
+func (u *Unfurler) fetch(ctx context.Context, link string) (protocol.Link, error) {
+	ctx, cancel := context.WithTimeout(ctx, u.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return protocol.Link{}, fmt.Errorf("build unfurl request: %w", err)
+	}
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", "pantalk-unfurl (+https://github.com/pantalk/pantalk)")
+
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return protocol.Link{}, fmt.Errorf("unfurl %s: %w", link, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return protocol.Link{}, fmt.Errorf("unfurl %s: %s", link, resp.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "" && mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return protocol.Link{}, fmt.Errorf("unfurl %s: not a web page (%s)", link, mediaType)
+	}
+
+	meta := Parse(io.LimitReader(resp.Body, maxPage))
+	meta.URL = link
+	if meta.Image != "" {
+		if ref, err := resp.Request.URL.Parse(meta.Image); err == nil {
+			meta.Image = ref.String()
+		}
+	}
+	return meta, nil
+}
+
+// Parse reads the metadata of an HTML page: its OpenGraph tags, falling
+// back to the title element and the description meta tag.
+func Parse(page io.Reader) protocol.Link {
+	var link protocol.Link
+	var title, description string
+
+	tokens := html.NewTokenizer(page)
+	for {
+		switch tokens.Next() {
+		case html.ErrorToken:
+			return finish(link, title, description)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokens.TagName()
+			switch string(name) {
+			case "title":
+				if title == "" && tokens.Next() == html.TextToken {
+					title = string(tokens.Text())
+				}
+			case "meta":
+				var key, content string
+				for more := hasAttr; more; {
+					var attr, value []byte
+					attr, value, more = tokens.TagAttr()
+					switch string(attr) {
+					case "property", "name":
+						key = strings.ToLower(string(value))
+					case "content":
+						content = string(value)
+					}
+				}
+				switch key {
+				case "og:title":
+					link.Title = content
+				case "og:description":
+					link.Description = content
+				case "og:site_name":
+					link.SiteName = content
+				case "og:image":
+					link.Image = content
+				case "description":
+					description = content
+				}
+			}
+		case html.EndTagToken:
+			// Everything of interest is in the head.
+			if name, _ := tokens.TagName(); string(name) == "head" {
+				return finish(link, title, description)
+			}
+		}
+	}
+}
+
+func finish(link protocol.Link, title string, description string) protocol.Link {
+	if link.Title == "" {
+		link.Title = title
+	}
+	if link.Description == "" {
+		link.Description = description
+	}
+	link.Title = clean(link.Title)
+	link.Description = clean(link.Description)
+	link.SiteName = clean(link.SiteName)
+	link.Image = strings.TrimSpace(link.Image)
+	return link
+}
+
+// clean collapses whitespace and bounds the length of a field.
+func clean(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > maxField {
+		text = string(runes[:maxField-1]) + "…"
+	}
+	return text
+}
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"'|]+`)
+
+// URLs returns the distinct http(s) URLs in text. Punctuation ending a
+// sentence and Slack's <url|label> markup are not part of them.
+func URLs(text string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, match := range urlPattern.FindAllString(text, -1) {
+		match = strings.TrimRight(match, ".,;:!?*_~`")
+		if strings.HasSuffix(match, ")") && !strings.Contains(match, "(") {
+			match = strings.TrimRight(match, ")")
+		}
+		if !seen[match] {
+			seen[match] = true
+			urls = append(urls, match)
+		}
+	}
+	return urls
+}
@@ -0,0 +1,136 @@
+package unfurl
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNew_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{name: "no domains", cfg: Config{}, want: "at least one domain"},
+		{name: "url as domain", cfg: Config{Domains: []string{"https://github.com"}}, want: `invalid unfurl domain "https://github.com"`},
+		{name: "wildcard", cfg: Config{Domains: []string{"*.github.com"}}, want: "invalid unfurl domain"},
+		{name: "negative max links", cfg: Config{Domains: []string{"github.com"}, MaxLinks: -1}, want: "max_links must be >= 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestURLs(t *testing.T) {
+	text := "see https://example.com/a, and <https://example.com/b|the docs> (https://example.com/c). " +
+		"https://en.wikipedia.org/wiki/Go_(programming_language) again https://example.com/a! ftp://example.com/x"
+	want := []string{
+		"https://example.com/a",
+		"https://example.com/b",
+		"https://example.com/c",
+		"https://en.wikipedia.org/wiki/Go_(programming_language)",
+	}
+	if got := URLs(text); !slices.Equal(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	u, err := New(Config{Domains: []string{"GitHub.com."}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	for link, want := range map[string]bool{
+		"https://github.com/pantalk":       true,
+		"http://gist.github.com/x":         true,
+		"https://notgithub.com/":           false,
+		"https://github.com.evil.example/": false,
+		"file://github.com/etc/passwd":     false,
+	} {
+		parsed, _ := url.Parse(link)
+		if got := u.Allowed(parsed); got != want {
+			t.Errorf("Allowed(%s) = %t, want %t", link, got, want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	page := `<!doctype html><html><head>
+<title>Fallback</title>
+<meta property="og:title" content="Release v2 &amp; more">
+<meta property="og:site_name" content="Example Blog">
+<meta name="description" content="  What changed
+  in v2. ">
+<meta property="og:image" content="/cover.png">
+</head><body><meta property="og:title" content="ignored"></body></html>`
+
+	got := Parse(strings.NewReader(page))
+	if got.Title != "Release v2 & more" || got.Description != "What changed in v2." || got.SiteName != "Example Blog" || got.Image != "/cover.png" {
+		t.Fatalf("unexpected metadata %+v", got)
+	}
+
+	if got := Parse(strings.NewReader(`<html><head><title> Plain page </title></head></html>`)); got.Title != "Plain page" || got.Description != "" {
+		t.Fatalf("expected the title element, got %+v", got)
+	}
+}
+
+func TestUnfurl(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/post", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<html><head><meta property="og:title" content="A post"><meta property="og:image" content="/img.png"></head></html>`))
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.HandleFunc("/report.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		_, _ = w.Write([]byte("%PDF-1.7"))
+	})
+	mux.HandleFunc("/away", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://localhost.invalid/", http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	u, err := New(Config{Domains: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	text := "read " + srv.URL + "/post and " + srv.URL + "/missing, " + srv.URL + "/report.pdf, " + srv.URL + "/away and https://elsewhere.example/post"
+	links, err := u.Unfurl(context.Background(), text)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected the first failure, got %v", err)
+	}
+	if len(links) != 1 || links[0].URL != srv.URL+"/post" || links[0].Title != "A post" || links[0].Image != srv.URL+"/img.png" {
+		t.Fatalf("expected only the post, got %+v", links)
+	}
+}
+
+func TestUnfurl_MaxLinks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<title>` + r.URL.Path + `</title>`))
+	}))
+	defer srv.Close()
+
+	u, err := New(Config{Domains: []string{"127.0.0.1"}, MaxLinks: 2})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	links, err := u.Unfurl(context.Background(), srv.URL+"/a "+srv.URL+"/b "+srv.URL+"/c")
+	if err != nil {
+		t.Fatalf("unfurl: %v", err)
+	}
+	if len(links) != 2 || links[0].Title != "/a" || links[1].Title != "/b" {
+		t.Fatalf("expected the first two links, got %+v", links)
+	}
+}
@@ -0,0 +1,95 @@
+package upstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// maxSlackBlocks is Slack's limit on blocks in one message.
+const maxSlackBlocks = 50
+
+// slackBlockTypes are the layout blocks a send can carry. Other types would
+// not survive the round trip through slack-go.
+var slackBlockTypes = map[string]bool{
+	"actions": true, "context": true, "divider": true, "file": true, "header": true,
+	"image": true, "input": true, "markdown": true, "rich_text": true, "section": true, "video": true,
+}
+
+// NormalizeBlocks checks the Block Kit payload of a send and returns it as a
+// JSON array of blocks; the {"blocks": [...]} form Block Kit Builder exports
+// is accepted too. fallback is the text of the header, section, context and
+// markdown blocks, for services without Block Kit and for notifications.
+func NormalizeBlocks(raw json.RawMessage) (blocks json.RawMessage, fallback string, err error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var wrapper struct {
+			Blocks json.RawMessage `json:"blocks"`
+		}
+		if err := json.Unmarshal(trimmed, &wrapper); err != nil {
+			return nil, "", fmt.Errorf("invalid blocks: %w", err)
+		}
+		trimmed = bytes.TrimSpace(wrapper.Blocks)
+	}
+
+	var parsed []struct {
+		Type     string          `json:"type"`
+		Text     json.RawMessage `json:"text"`
+		Fields   []slackText     `json:"fields"`
+		Elements []slackText     `json:"elements"`
+	}
+	if err := json.Unmarshal(trimmed, &parsed); err != nil {
+		return nil, "", fmt.Errorf("blocks must be a JSON array of Block Kit blocks: %w", err)
+	}
+	if len(parsed) == 0 {
+		return nil, "", errors.New("blocks cannot be empty")
+	}
+	if len(parsed) > maxSlackBlocks {
+		return nil, "", fmt.Errorf("blocks allows at most %d blocks, got %d", maxSlackBlocks, len(parsed))
+	}
+
+	var lines []string
+	for i, block := range parsed {
+		if !slackBlockTypes[block.Type] {
+			return nil, "", fmt.Errorf("block %d: unsupported block type %q", i+1, block.Type)
+		}
+		switch block.Type {
+		case "markdown":
+			var text string
+			if json.Unmarshal(block.Text, &text) == nil {
+				lines = append(lines, text)
+			}
+		case "header", "section":
+			var text slackText
+			if json.Unmarshal(block.Text, &text) == nil && text.Text != "" {
+				lines = append(lines, text.Text)
+			}
+			for _, field := range block.Fields {
+				lines = append(lines, field.Text)
+			}
+		case "context":
+			for _, element := range block.Elements {
+				if element.Type == "mrkdwn" || element.Type == "plain_text" {
+					lines = append(lines, element.Text)
+				}
+			}
+		}
+	}
+
+	var decoded slack.Blocks
+	if err := json.Unmarshal(trimmed, &decoded); err != nil {
+		return nil, "", fmt.Errorf("invalid blocks: %w", err)
+	}
+
+	return json.RawMessage(trimmed), strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
+
+// slackText is a Block Kit text object, or a context element.
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
@@ -3,6 +3,8 @@ package upstream
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/pantalk/pantalk/internal/config"
 	"github.com/pantalk/pantalk/internal/protocol"
@@ -13,6 +15,143 @@ type Connector interface {
 	Send(ctx context.Context, request protocol.Request) (protocol.Event, error)
 	React(ctx context.Context, request protocol.Request) error
 	Identity() string
+
+	// Capabilities reports the optional features the connector supports.
+	// The server refuses requests that need a missing one, and a connector
+	// that reports MarkRead, Presence or Channels implements ReadMarker,
+	// PresenceSetter or ChannelManager. Puppeting connectors post
+	// Request.Author under that name and avatar; for the others the server
+	// prefixes the author into the text. Interactive connectors render
+	// Request.Interactive and publish clicks as KindInteraction events.
+	Capabilities() protocol.Capabilities
+}
+
+// HomeSummary is what a bot's home surface, such as the Slack App Home tab,
+// shows: its unseen notifications and the state of the configured agents.
+type HomeSummary struct {
+	Unseen int64
+	Recent []protocol.Event // newest unseen notifications first, capped
+	Agents []protocol.AgentInfo
+}
+
+// HomeFunc builds the home summary for a bot on demand.
+type HomeFunc func(ctx context.Context) (HomeSummary, error)
+
+// HomePublisher is implemented by connectors that can render a home surface
+// for users who open it. The server supplies the summary.
+type HomePublisher interface {
+	SetHomeFunc(fn HomeFunc)
+}
+
+// ActionReceiver is implemented by connectors whose platform reports clicks
+// with an HTTP callback instead of over the connector's own session. The
+// server passes the callback URL on its HTTP API and a secret to embed in
+// the buttons, and hands the callbacks to HandleAction.
+type ActionReceiver interface {
+	SetActionEndpoint(url string, secret string)
+	HandleAction(ctx context.Context, body []byte) error
+}
+
+// WebhookReceiver is implemented by connectors that can take their
+// platform's events as HTTP callbacks, for bots with transport: webhook
+// where Socket Mode or long polling can't get out. The server passes the
+// URL the platform must call on its HTTP API and a secret, and hands each
+// callback to HandleWebhook, which authenticates it and returns the body
+// to answer with, if any. HandleWebhook returns before the event is
+// handled, since platforms retry callbacks that aren't answered quickly,
+// and drops the retries of deliveries it already took.
+type WebhookReceiver interface {
+	SetWebhookEndpoint(url string, secret string)
+	HandleWebhook(ctx context.Context, header http.Header, body []byte) ([]byte, error)
+}
+
+// TranscribeFunc returns the text spoken in a recording.
+type TranscribeFunc func(ctx context.Context, audio []byte, mimeType string) (string, error)
+
+// Transcribing is implemented by connectors that receive voice messages.
+// With a TranscribeFunc set they download each recording and publish its
+// transcript as the event text; without one (nil) the event only carries
+// the audio attachment.
+type Transcribing interface {
+	SetTranscribeFunc(fn TranscribeFunc)
+}
+
+// ReadMarker is implemented by connectors that can tell the platform the
+// bot has read a conversation, such as WhatsApp read receipts or Slack's
+// conversations.mark. MarkRead covers the messages the connector received in
+// channel up to through, or all of them when through is zero.
+type ReadMarker interface {
+	MarkRead(ctx context.Context, channel string, through time.Time) error
+}
+
+// MentionNamer is implemented by connectors that learn the names people
+// type after @ to mention the bot's account, such as its username and
+// display name. The server matches them besides the configured name and
+// aliases.
+type MentionNamer interface {
+	MentionNames() []string
+}
+
+// UserIdentifier is implemented by connectors that also act as a user
+// account, such as a Slack bot with a user_token. UserIdentity returns that
+// account's ID, or "" when there is none; its messages are the bot's own,
+// like those from Identity.
+type UserIdentifier interface {
+	UserIdentity() string
+}
+
+// PresenceSetter is implemented by connectors that can change the bot's
+// availability (PresenceOnline, PresenceAway, PresenceDND) and status text.
+type PresenceSetter interface {
+	SetPresence(ctx context.Context, presence protocol.Presence) error
+}
+
+// ChannelManager is implemented by connectors that can manage the bot's
+// channel membership. Operations the platform doesn't offer bots return an
+// error wrapping errors.ErrUnsupported.
+type ChannelManager interface {
+	JoinChannel(ctx context.Context, channel string) error
+	LeaveChannel(ctx context.Context, channel string) error
+	// CreateChannel returns the new channel's ID. scope is the Discord
+	// server or Mattermost team, and may be empty when the bot is in one.
+	CreateChannel(ctx context.Context, name string, private bool, scope string) (string, error)
+	InviteToChannel(ctx context.Context, channel string, users []string) error
+}
+
+// TopicLister is implemented by connectors whose channels hold named
+// threads (Zulip stream topics) that can be listed.
+type TopicLister interface {
+	ListTopics(ctx context.Context, channel string) ([]protocol.Topic, error)
+}
+
+// SessionlessSender is implemented by connectors whose Send is a plain API
+// call that works on a connector that was never Run. One-shot sends skip
+// connecting them, which for some platforms would also take updates meant
+// for a running daemon.
+type SessionlessSender interface {
+	SendsWithoutSession()
+}
+
+// Verification is who a bot's credentials authenticate as.
+type Verification struct {
+	User   string   // the account's username, or email for Zulip
+	UserID string   // the platform's ID for the account
+	Team   string   // Slack workspace, Mattermost server or Zulip realm, when known
+	Scopes []string // OAuth scopes granted to the token (Slack only)
+}
+
+// Verifier is implemented by connectors that can check their credentials
+// with the platform's auth-test call, without connecting a session.
+type Verifier interface {
+	Verify(ctx context.Context) (Verification, error)
+}
+
+// TokenRotator is implemented by connectors that can switch to a new bot
+// token while running. RotateToken checks the token with the platform and
+// that it belongs to the same account before later calls use it; on error
+// the old token stays in use.
+type TokenRotator interface {
+	RotateToken(ctx context.Context, token string) error
 }
 
 func NewConnector(bot config.BotConfig, publish func(protocol.Event)) (Connector, error) {
@@ -37,10 +176,15 @@ func NewConnector(bot config.BotConfig, publish func(protocol.Event)) (Connector
 		return NewZulipConnector(bot, publish)
 	case "imessage":
 		return NewIMessageConnector(bot, publish)
+	case "mock":
+		return NewMockBotConnector(bot, publish)
 	default:
 		if bot.Transport == "" {
 			return nil, fmt.Errorf("bot %q requires either supported type or transport", bot.Name)
 		}
+		if bot.Transport == "exec" {
+			return NewExecConnector(bot, publish)
+		}
 		return NewMockConnector(bot.Type, bot.Name, publish), nil
 	}
 }
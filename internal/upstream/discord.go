@@ -2,11 +2,14 @@ package upstream
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/bwmarrin/discordgo"
 
@@ -20,14 +23,32 @@ type DiscordConnector struct {
 	botName      string
 	publish      func(protocol.Event)
 	session      *discordgo.Session
+	intents      discordgo.Intent
 	disconnected chan struct{}
+	echoes       *echoFilter // nil unless include_self
 
 	mu        sync.RWMutex
 	channels  map[string]struct{}
 	selfUser  string
 	selfBotID string
+	selfNames []string                      // username and global display name, for mention matching
+	webhooks  map[string]*discordgo.Webhook // channel ID -> pantalk webhook used for puppeting
+	parents   map[string]string             // channel ID -> parent channel of a thread, "" if not a thread
+	presence  protocol.Presence             // last presence set, re-applied on reconnect
 }
 
+// discordWebhookName names the per-channel webhook pantalk creates (or
+// reuses) to post bridged messages under their original author.
+const discordWebhookName = "pantalk"
+
+// maxDiscordThreadName is Discord's limit on thread names, and
+// discordThreadArchiveMinutes how long threads pantalk starts stay active
+// without messages.
+const (
+	maxDiscordThreadName        = 100
+	discordThreadArchiveMinutes = 1440
+)
+
 func NewDiscordConnector(bot config.BotConfig, publish func(protocol.Event)) (*DiscordConnector, error) {
 	token, err := config.ResolveCredential(bot.BotToken)
 	if err != nil {
@@ -39,15 +60,35 @@ func NewDiscordConnector(bot config.BotConfig, publish func(protocol.Event)) (*D
 		return nil, fmt.Errorf("create discord session: %w", err)
 	}
 
-	session.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentsDirectMessages | discordgo.IntentMessageContent
+	proxy, err := proxyFor(bot)
+	if err != nil {
+		return nil, err
+	}
+	// discordgo retries and waits out rate limits itself.
+	httpOpts := bot.HTTPOptions()
+	session.Client.Timeout = httpOpts.TimeoutOr(session.Client.Timeout)
+	session.Client.Transport = newTransport(proxy, httpOpts)
+	session.MaxRestRetries = httpOpts.RetryCount()
+	session.Dialer = newProxyDialer(proxy)
+
+	intents := discordIntentsFor(bot.DiscordIntentNames())
+	session.Identify.Intents = intents
+
+	if intents&discordgo.IntentsGuildMessages != 0 && intents&discordgo.IntentMessageContent == 0 {
+		log.Printf("[discord:%s] message_content intent not requested: guild messages that don't mention the bot arrive without text", bot.Name)
+	}
 
 	connector := &DiscordConnector{
 		serviceName:  bot.Type,
 		botName:      bot.Name,
 		publish:      publish,
 		session:      session,
+		intents:      intents,
 		disconnected: make(chan struct{}, 1),
+		echoes:       newEchoFilter(bot.IncludeSelf),
 		channels:     make(map[string]struct{}),
+		webhooks:     make(map[string]*discordgo.Webhook),
+		parents:      make(map[string]string),
 	}
 
 	for _, channel := range bot.Channels {
@@ -59,6 +100,7 @@ func NewDiscordConnector(bot config.BotConfig, publish func(protocol.Event)) (*D
 	}
 
 	session.AddHandler(connector.onMessageCreate)
+	session.AddHandler(connector.onInteractionCreate)
 	session.AddHandler(func(_ *discordgo.Session, _ *discordgo.Disconnect) {
 		select {
 		case connector.disconnected <- struct{}{}:
@@ -102,6 +144,13 @@ func (d *DiscordConnector) Run(ctx context.Context) {
 }
 
 func (d *DiscordConnector) connectAndRun(ctx context.Context) error {
+	// The gateway closes the connection (code 4014) when a privileged intent
+	// isn't enabled, which discordgo only logs while retrying. Checking the
+	// application flags first turns that into a clear error.
+	if err := d.checkPrivilegedIntents(); err != nil {
+		return err
+	}
+
 	if err := d.session.Open(); err != nil {
 		log.Printf("[discord:%s] connect failed: %v", d.botName, err)
 		return fmt.Errorf("connect failed: %w", err)
@@ -111,11 +160,13 @@ func (d *DiscordConnector) connectAndRun(ctx context.Context) error {
 		d.mu.Lock()
 		d.selfUser = stateUser.ID
 		d.selfBotID = stateUser.ID
+		d.selfNames = []string{stateUser.Username, stateUser.GlobalName}
 		d.mu.Unlock()
 		log.Printf("[discord:%s] authenticated (user=%s)", d.botName, stateUser.ID)
 	}
 
 	d.resolveChannelNames()
+	d.restorePresence()
 
 	d.publishStatus("connector online")
 
@@ -136,9 +187,72 @@ func (d *DiscordConnector) connectAndRun(ctx context.Context) error {
 	}
 }
 
+// discordIntentGroups maps the intents: names to gateway intents.
+var discordIntentGroups = map[string]discordgo.Intent{
+	"guild_messages":  discordgo.IntentsGuildMessages,
+	"direct_messages": discordgo.IntentsDirectMessages,
+	"message_content": discordgo.IntentMessageContent,
+	"guild_members":   discordgo.IntentGuildMembers,
+	"reactions":       discordgo.IntentGuildMessageReactions | discordgo.IntentDirectMessageReactions,
+}
+
+func discordIntentsFor(names []string) discordgo.Intent {
+	var intents discordgo.Intent
+	for _, name := range names {
+		intents |= discordIntentGroups[strings.TrimSpace(name)]
+	}
+	return intents
+}
+
+// Application flags that show a privileged intent is enabled in the
+// developer portal. The _LIMITED variants apply to unverified bots in
+// fewer than 100 servers.
+const (
+	discordFlagGatewayGuildMembers          = 1 << 14
+	discordFlagGatewayGuildMembersLimited   = 1 << 15
+	discordFlagGatewayMessageContent        = 1 << 18
+	discordFlagGatewayMessageContentLimited = 1 << 19
+)
+
+// missingPrivilegedIntents lists the privileged intents requested but not
+// enabled according to the application flags, by their portal names.
+func missingPrivilegedIntents(intents discordgo.Intent, flags int) []string {
+	var missing []string
+	if intents&discordgo.IntentGuildMembers != 0 && flags&(discordFlagGatewayGuildMembers|discordFlagGatewayGuildMembersLimited) == 0 {
+		missing = append(missing, "Server Members Intent")
+	}
+	if intents&discordgo.IntentMessageContent != 0 && flags&(discordFlagGatewayMessageContent|discordFlagGatewayMessageContentLimited) == 0 {
+		missing = append(missing, "Message Content Intent")
+	}
+	return missing
+}
+
+func (d *DiscordConnector) checkPrivilegedIntents() error {
+	if d.intents&(discordgo.IntentGuildMembers|discordgo.IntentMessageContent) == 0 {
+		return nil
+	}
+
+	app, err := d.session.Application("@me")
+	if err != nil {
+		// Not fatal: the gateway still enforces the intents.
+		log.Printf("[discord:%s] could not check privileged intents: %v", d.botName, err)
+		return nil
+	}
+
+	if missing := missingPrivilegedIntents(d.intents, app.Flags); len(missing) > 0 {
+		return fmt.Errorf("privileged intents not enabled for application %s: turn on %s under Bot > Privileged Gateway Intents in the Discord developer portal, or remove them from intents:",
+			app.ID, strings.Join(missing, " and "))
+	}
+	return nil
+}
+
+// Send posts a message. Thread is either a Discord thread (a thread
+// channel's ID), which the message is posted into, or a message ID, which
+// it replies to. StartThread opens a thread from the Thread message, or in
+// the channel, and posts into it.
 func (d *DiscordConnector) Send(_ context.Context, request protocol.Request) (protocol.Event, error) {
 	trimmed := strings.TrimSpace(request.Text)
-	if trimmed == "" {
+	if trimmed == "" && len(request.Embeds) == 0 {
 		return protocol.Event{}, fmt.Errorf("text cannot be empty")
 	}
 
@@ -146,12 +260,57 @@ func (d *DiscordConnector) Send(_ context.Context, request protocol.Request) (pr
 	if channel == "" {
 		return protocol.Event{}, fmt.Errorf("discord send requires channel or target")
 	}
+	// A thread given as the channel posts into it all the same.
+	if parent := d.threadParent(channel); parent != "" {
+		channel, request.Thread = parent, channel
+	}
 
 	d.rememberChannel(channel)
 
-	segments, err := prepareDiscordSegments(request.Format, request.Text)
-	if err != nil {
-		return protocol.Event{}, err
+	// postTo is the channel the message goes to: a thread channel, or the
+	// channel itself with reply set when Thread is a message.
+	postTo, thread := channel, request.Thread
+	var reply *discordgo.MessageReference
+	switch {
+	case strings.TrimSpace(request.StartThread) != "":
+		started, err := d.startThread(channel, request.Thread, strings.TrimSpace(request.StartThread))
+		if err != nil {
+			return protocol.Event{}, err
+		}
+		postTo, thread = started.ID, started.ID
+	case request.Thread != "":
+		if d.threadParent(request.Thread) != "" {
+			postTo = request.Thread
+		} else {
+			reply = &discordgo.MessageReference{MessageID: request.Thread, ChannelID: channel}
+		}
+	}
+
+	// Puppeting goes through a channel webhook, which can't reply to a
+	// message or carry the bot's components; it can post into a thread of
+	// its channel. Replies, interactive sends and channels where the bot
+	// lacks Manage Webhooks fall back to prefixing the author's name.
+	var webhook *discordgo.Webhook
+	if author := strings.TrimSpace(request.Author); author != "" {
+		if reply == nil && request.Interactive == nil {
+			hook, hookErr := d.channelWebhook(channel)
+			if hookErr != nil {
+				log.Printf("[discord:%s] webhook unavailable for %s, prefixing author instead: %v", d.botName, channel, hookErr)
+			}
+			webhook = hook
+		}
+		if webhook == nil {
+			request.Text = formatting.Attribute(author, request.Format, request.Text)
+		}
+	}
+
+	segments := []string{""}
+	if strings.TrimSpace(request.Text) != "" {
+		var err error
+		segments, err = prepareDiscordSegments(request.Format, request.Text)
+		if err != nil {
+			return protocol.Event{}, err
+		}
 	}
 
 	if len(segments) == 0 {
@@ -159,21 +318,48 @@ func (d *DiscordConnector) Send(_ context.Context, request protocol.Request) (pr
 	}
 
 	var lastEvent protocol.Event
-	for _, segmentText := range segments {
-		message := &discordgo.MessageSend{Content: segmentText}
-
-		if request.Thread != "" {
-			message.Reference = &discordgo.MessageReference{MessageID: request.Thread, ChannelID: channel}
+	for i, segmentText := range segments {
+		last := i == len(segments)-1
+		var embeds []*discordgo.MessageEmbed
+		if last {
+			embeds = discordEmbeds(request.Embeds)
 		}
 
-		posted, sendErr := d.session.ChannelMessageSendComplex(channel, message)
+		var posted *discordgo.Message
+		var sendErr error
+		if webhook != nil {
+			params := &discordgo.WebhookParams{
+				Content:   segmentText,
+				Username:  strings.TrimSpace(request.Author),
+				AvatarURL: strings.TrimSpace(request.AuthorAvatar),
+				Embeds:    embeds,
+			}
+			if postTo != channel {
+				posted, sendErr = d.session.WebhookThreadExecute(webhook.ID, webhook.Token, true, postTo, params)
+			} else {
+				posted, sendErr = d.session.WebhookExecute(webhook.ID, webhook.Token, true, params)
+			}
+		} else {
+			message := &discordgo.MessageSend{Content: segmentText, Reference: reply, Embeds: embeds}
+			if request.Interactive != nil && last {
+				message.Components = discordComponents(request.Interactive)
+			}
+
+			posted, sendErr = d.session.ChannelMessageSendComplex(postTo, message)
+		}
 		if sendErr != nil {
 			return protocol.Event{}, sendErr
 		}
+		d.echoes.claim(posted.ID)
 
 		target := request.Target
 		if target == "" {
-			target = "channel:" + posted.ChannelID
+			target = "channel:" + channel
+		}
+
+		text := segmentText
+		if last && len(request.Embeds) > 0 {
+			text = strings.TrimSpace(strings.Join([]string{segmentText, EmbedsText(request.Embeds)}, "\n\n"))
 		}
 
 		event := protocol.Event{
@@ -184,9 +370,10 @@ func (d *DiscordConnector) Send(_ context.Context, request protocol.Request) (pr
 			Direction: "out",
 			User:      d.Identity(),
 			Target:    target,
-			Channel:   posted.ChannelID,
-			Thread:    request.Thread,
-			Text:      segmentText,
+			Channel:   channel,
+			Thread:    thread,
+			MessageID: posted.ID,
+			Text:      text,
 		}
 
 		d.publish(event)
@@ -196,22 +383,92 @@ func (d *DiscordConnector) Send(_ context.Context, request protocol.Request) (pr
 	return lastEvent, nil
 }
 
-func (d *DiscordConnector) onMessageCreate(_ *discordgo.Session, message *discordgo.MessageCreate) {
-	if message == nil || message.Message == nil {
-		return
+// startThread opens a public thread named name, from message when set or
+// as a standalone thread in channel.
+func (d *DiscordConnector) startThread(channel string, message string, name string) (*discordgo.Channel, error) {
+	if utf8.RuneCountInString(name) > maxDiscordThreadName {
+		return nil, fmt.Errorf("thread name is longer than %d characters", maxDiscordThreadName)
 	}
 
-	if d.isSelfMessage(message) {
-		return
+	data := &discordgo.ThreadStart{Name: name, AutoArchiveDuration: discordThreadArchiveMinutes}
+	var started *discordgo.Channel
+	var err error
+	if message != "" {
+		started, err = d.session.MessageThreadStartComplex(channel, message, data)
+	} else {
+		data.Type = discordgo.ChannelTypeGuildPublicThread
+		started, err = d.session.ThreadStartComplex(channel, data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("start discord thread: %w", err)
 	}
 
-	if !d.acceptsChannel(message.ChannelID) {
+	d.mu.Lock()
+	d.parents[started.ID] = channel
+	d.mu.Unlock()
+	return started, nil
+}
+
+// threadParent returns the parent channel when id is a thread, or "" for
+// other channels and for IDs that aren't channels at all (message IDs).
+func (d *DiscordConnector) threadParent(id string) string {
+	if d.session == nil || !isDiscordChannelID(id) {
+		return ""
+	}
+
+	d.mu.RLock()
+	parent, known := d.parents[id]
+	d.mu.RUnlock()
+	if known {
+		return parent
+	}
+
+	var found *discordgo.Channel
+	if d.session.State != nil {
+		found, _ = d.session.State.Channel(id)
+	}
+	if found == nil {
+		fetched, err := d.session.Channel(id)
+		var restErr *discordgo.RESTError
+		if err != nil && !(errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusNotFound) {
+			// Don't remember the answer to a failed lookup.
+			log.Printf("[discord:%s] look up channel %s: %v", d.botName, id, err)
+			return ""
+		}
+		found = fetched
+	}
+
+	parent = ""
+	if found != nil && found.IsThread() {
+		parent = found.ParentID
+	}
+	d.mu.Lock()
+	d.parents[id] = parent
+	d.mu.Unlock()
+	return parent
+}
+
+// location maps where a Discord message is to pantalk's Channel and
+// Thread: a message in a thread is in the thread's parent channel, and a
+// reply elsewhere is in the thread of the message it replies to.
+func (d *DiscordConnector) location(channelID string, reference *discordgo.MessageReference) (channel string, thread string) {
+	if parent := d.threadParent(channelID); parent != "" {
+		return parent, channelID
+	}
+	if reference != nil {
+		return channelID, reference.MessageID
+	}
+	return channelID, ""
+}
+
+func (d *DiscordConnector) onMessageCreate(_ *discordgo.Session, message *discordgo.MessageCreate) {
+	if message == nil || message.Message == nil {
 		return
 	}
 
-	thread := ""
-	if message.MessageReference != nil {
-		thread = message.MessageReference.MessageID
+	channel, thread := d.location(message.ChannelID, message.MessageReference)
+	if !d.acceptsChannel(channel) {
+		return
 	}
 
 	event := protocol.Event{
@@ -221,10 +478,18 @@ func (d *DiscordConnector) onMessageCreate(_ *discordgo.Session, message *discor
 		Kind:      "message",
 		Direction: "in",
 		User:      message.Author.ID,
-		Target:    "channel:" + message.ChannelID,
-		Channel:   message.ChannelID,
+		Target:    "channel:" + channel,
+		Channel:   channel,
 		Thread:    thread,
+		MessageID: message.ID,
 		Text:      message.Content,
+		Direct:    message.GuildID == "", // only DMs arrive outside a server
+	}
+
+	if d.isSelfMessage(message) {
+		event.Direction, event.User, event.Direct = "out", d.Identity(), false
+		d.echoes.echo(message.ID, func() { d.publish(event) })
+		return
 	}
 
 	d.publish(event)
@@ -270,12 +535,28 @@ func (d *DiscordConnector) acceptsChannel(channel string) bool {
 	return ok
 }
 
+// Verify implements Verifier with /users/@me.
+func (d *DiscordConnector) Verify(ctx context.Context) (Verification, error) {
+	user, err := d.session.User("@me", discordgo.WithContext(ctx))
+	if err != nil {
+		return Verification{}, fmt.Errorf("users/@me: %w", err)
+	}
+	return Verification{User: user.Username, UserID: user.ID}, nil
+}
+
 func (d *DiscordConnector) Identity() string {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
 	return d.selfUser
 }
 
+// MentionNames returns the bot's username and display name.
+func (d *DiscordConnector) MentionNames() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.selfNames
+}
+
 // React adds an emoji reaction to a Discord message. Channel and Target
 // (message ID) are required. Emoji can be a unicode character (e.g. "✅") or
 // a custom emoji in "name:id" format (e.g. "thumbsup:123456789").
@@ -298,10 +579,78 @@ func (d *DiscordConnector) React(_ context.Context, request protocol.Request) er
 	return d.session.MessageReactionAdd(channel, messageID, emoji)
 }
 
+// Capabilities reports Discord's features. Threads are Discord threads or
+// message replies, puppeting goes through a channel webhook and
+// interactive messages use message components.
+func (d *DiscordConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{
+		Threads:     true,
+		Reactions:   true,
+		Interactive: true,
+		Embeds:      true,
+		NewThreads:  true,
+		Puppeting:   true,
+		Presence:    true,
+		Channels:    true,
+		MaxText:     discordMaxText,
+	}
+}
+
+// SendsWithoutSession implements SessionlessSender: Discord messages are
+// posted over REST; the gateway session only receives.
+func (d *DiscordConnector) SendsWithoutSession() {}
+
+// channelWebhook returns the pantalk webhook for channel, reusing one the
+// bot created earlier (including before a restart) or creating it.
+func (d *DiscordConnector) channelWebhook(channel string) (*discordgo.Webhook, error) {
+	d.mu.RLock()
+	hook := d.webhooks[channel]
+	d.mu.RUnlock()
+	if hook != nil {
+		return hook, nil
+	}
+
+	hooks, err := d.session.ChannelWebhooks(channel)
+	if err != nil {
+		return nil, fmt.Errorf("list webhooks: %w", err)
+	}
+
+	self := d.Identity()
+	for _, candidate := range hooks {
+		if candidate.Name == discordWebhookName && candidate.Token != "" && candidate.User != nil && candidate.User.ID == self {
+			hook = candidate
+			break
+		}
+	}
+
+	if hook == nil {
+		hook, err = d.session.WebhookCreate(channel, discordWebhookName, "")
+		if err != nil {
+			return nil, fmt.Errorf("create webhook: %w", err)
+		}
+	}
+
+	d.mu.Lock()
+	d.webhooks[channel] = hook
+	d.mu.Unlock()
+
+	return hook, nil
+}
+
 func (d *DiscordConnector) isSelfMessage(message *discordgo.MessageCreate) bool {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
 
+	// Messages posted through our puppeting webhook carry the bridged
+	// author's name; treat them as ours so bridges don't echo them back.
+	if message.WebhookID != "" {
+		for _, hook := range d.webhooks {
+			if hook.ID == message.WebhookID {
+				return true
+			}
+		}
+	}
+
 	if message.Author == nil {
 		return false
 	}
@@ -336,6 +685,40 @@ func resolveDiscordChannel(request protocol.Request) string {
 	return target
 }
 
+// discordEmbeds converts embeds to Discord's message embeds.
+func discordEmbeds(embeds []protocol.Embed) []*discordgo.MessageEmbed {
+	if len(embeds) == 0 {
+		return nil
+	}
+
+	converted := make([]*discordgo.MessageEmbed, 0, len(embeds))
+	for _, embed := range embeds {
+		message := &discordgo.MessageEmbed{
+			Type:        discordgo.EmbedTypeRich,
+			Title:       embed.Title,
+			Description: embed.Description,
+			URL:         embed.URL,
+			Color:       embed.Color,
+		}
+		for _, field := range embed.Fields {
+			message.Fields = append(message.Fields, &discordgo.MessageEmbedField{
+				Name:   field.Name,
+				Value:  field.Value,
+				Inline: field.Inline,
+			})
+		}
+		if embed.Footer != "" {
+			message.Footer = &discordgo.MessageEmbedFooter{Text: embed.Footer}
+		}
+		converted = append(converted, message)
+	}
+	return converted
+}
+
+// discordMaxText is how much text goes in one Discord message, under the
+// 2000-character limit; longer text is split.
+const discordMaxText = 1900
+
 func prepareDiscordSegments(format string, text string) ([]string, error) {
 	normalizedFormat, err := formatting.NormalizeFormat(format)
 	if err != nil {
@@ -352,7 +735,7 @@ func prepareDiscordSegments(format string, text string) ([]string, error) {
 		trimmed = formatting.StripHTML(trimmed)
 	}
 
-	return formatting.SplitText(trimmed, 1900), nil
+	return formatting.SplitText(trimmed, discordMaxText), nil
 }
 
 // resolveChannelNames resolves any friendly channel names (e.g. "#general",
@@ -417,3 +800,124 @@ func isDiscordChannelID(s string) bool {
 	}
 	return true
 }
+
+// SetPresence updates the bot's gateway presence. Discord has no "away",
+// so it maps to "idle". The gateway forgets presence on reconnect, so the
+// merged state and status are kept and re-sent after each login.
+func (d *DiscordConnector) SetPresence(_ context.Context, presence protocol.Presence) error {
+	d.mu.Lock()
+	if presence.State != "" {
+		d.presence.State = presence.State
+	}
+	if presence.Status != nil {
+		status := *presence.Status
+		d.presence.Status = &status
+	}
+	merged := d.presence
+	d.mu.Unlock()
+
+	if err := d.session.UpdateStatusComplex(discordStatusData(merged)); err != nil {
+		return fmt.Errorf("discord update presence: %w", err)
+	}
+	return nil
+}
+
+func (d *DiscordConnector) restorePresence() {
+	d.mu.RLock()
+	presence := d.presence
+	d.mu.RUnlock()
+	if presence.State == "" && presence.Status == nil {
+		return
+	}
+	if err := d.session.UpdateStatusComplex(discordStatusData(presence)); err != nil {
+		log.Printf("[discord:%s] restore presence failed: %v", d.botName, err)
+	}
+}
+
+func discordStatusData(presence protocol.Presence) discordgo.UpdateStatusData {
+	data := discordgo.UpdateStatusData{Status: "online", Activities: []*discordgo.Activity{}}
+	switch presence.State {
+	case PresenceAway:
+		data.Status = "idle"
+	case PresenceDND:
+		data.Status = "dnd"
+	}
+	if presence.Status != nil && *presence.Status != "" {
+		data.Activities = append(data.Activities, &discordgo.Activity{
+			Name:  "Custom Status",
+			Type:  discordgo.ActivityTypeCustom,
+			State: *presence.Status,
+		})
+	}
+	return data
+}
+
+// discordMemberAccess is what an invite grants on a channel.
+const discordMemberAccess = discordgo.PermissionViewChannel | discordgo.PermissionSendMessages | discordgo.PermissionReadMessageHistory
+
+// JoinChannel is not possible on Discord: bots see every channel their
+// roles allow.
+func (d *DiscordConnector) JoinChannel(context.Context, string) error {
+	return fmt.Errorf("discord bots join channels through role permissions: %w", errors.ErrUnsupported)
+}
+
+func (d *DiscordConnector) LeaveChannel(context.Context, string) error {
+	return fmt.Errorf("discord bots leave channels through role permissions: %w", errors.ErrUnsupported)
+}
+
+// CreateChannel creates a text channel in guild, or in the bot's only
+// server when guild is empty. Private channels are hidden from @everyone
+// and shared with members through InviteToChannel.
+func (d *DiscordConnector) CreateChannel(_ context.Context, name string, private bool, guild string) (string, error) {
+	if guild == "" {
+		guilds, err := d.session.UserGuilds(2, "", "", false)
+		if err != nil {
+			return "", fmt.Errorf("discord list servers: %w", err)
+		}
+		if len(guilds) != 1 {
+			return "", fmt.Errorf("discord bot is in more than one server; pass the server ID as the target")
+		}
+		guild = guilds[0].ID
+	}
+
+	d.mu.RLock()
+	self := d.selfUser
+	d.mu.RUnlock()
+
+	channel, err := d.session.GuildChannelCreateComplex(guild, discordgo.GuildChannelCreateData{
+		Name:                 name,
+		Type:                 discordgo.ChannelTypeGuildText,
+		PermissionOverwrites: discordChannelOverwrites(guild, self, private),
+	})
+	if err != nil {
+		return "", fmt.Errorf("discord create channel: %w", err)
+	}
+	d.rememberChannel(channel.ID)
+	return channel.ID, nil
+}
+
+// InviteToChannel gives each user a member overwrite to see and post in
+// channel.
+func (d *DiscordConnector) InviteToChannel(_ context.Context, channel string, users []string) error {
+	for _, user := range users {
+		if err := d.session.ChannelPermissionSet(channel, user, discordgo.PermissionOverwriteTypeMember, discordMemberAccess, 0); err != nil {
+			return fmt.Errorf("discord add %s to channel: %w", user, err)
+		}
+	}
+	return nil
+}
+
+// discordChannelOverwrites hides a private channel from @everyone (the
+// role sharing the guild's ID) while keeping the bot itself in it.
+func discordChannelOverwrites(guild string, self string, private bool) []*discordgo.PermissionOverwrite {
+	if !private {
+		return nil
+	}
+	overwrites := []*discordgo.PermissionOverwrite{
+		{ID: guild, Type: discordgo.PermissionOverwriteTypeRole, Deny: discordgo.PermissionViewChannel},
+	}
+	if self != "" {
+		overwrites = append(overwrites, &discordgo.PermissionOverwrite{ID: self, Type: discordgo.PermissionOverwriteTypeMember, Allow: discordMemberAccess})
+	}
+	return overwrites
+}
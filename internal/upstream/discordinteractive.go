@@ -0,0 +1,140 @@
+package upstream
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// discordCustomIDPrefix marks pantalk's components. A button's custom id is
+// the prefix and its value; the select menu uses discordSelectID.
+const (
+	discordCustomIDPrefix = "pantalk:"
+	discordSelectID       = discordCustomIDPrefix + "select"
+	discordButtonsPerRow  = 5
+)
+
+// discordComponents lays the buttons out five to a row, followed by the
+// select menu in a row of its own.
+func discordComponents(interactive *protocol.Interactive) []discordgo.MessageComponent {
+	var rows []discordgo.MessageComponent
+
+	var row []discordgo.MessageComponent
+	for _, button := range interactive.Buttons {
+		style := discordgo.SecondaryButton
+		switch button.Style {
+		case "primary":
+			style = discordgo.PrimaryButton
+		case "danger":
+			style = discordgo.DangerButton
+		}
+		row = append(row, discordgo.Button{
+			Label:    button.Label,
+			Style:    style,
+			CustomID: discordCustomIDPrefix + "b:" + button.Value,
+		})
+		if len(row) == discordButtonsPerRow {
+			rows = append(rows, discordgo.ActionsRow{Components: row})
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, discordgo.ActionsRow{Components: row})
+	}
+
+	if sel := interactive.Select; sel != nil && len(sel.Options) > 0 {
+		options := make([]discordgo.SelectMenuOption, 0, len(sel.Options))
+		for _, option := range sel.Options {
+			options = append(options, discordgo.SelectMenuOption{Label: option.Label, Value: option.Value})
+		}
+		rows = append(rows, discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{
+				MenuType:    discordgo.StringSelectMenu,
+				CustomID:    discordSelectID,
+				Placeholder: selectPlaceholder(sel),
+				Options:     options,
+			},
+		}})
+	}
+
+	return rows
+}
+
+// onInteractionCreate publishes clicks on pantalk's components and
+// acknowledges them so Discord doesn't show the interaction as failed.
+func (d *DiscordConnector) onInteractionCreate(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
+	if interaction == nil || interaction.Interaction == nil || interaction.Type != discordgo.InteractionMessageComponent {
+		return
+	}
+
+	event, ok := d.interactionEvent(interaction.Interaction)
+	if !ok {
+		return
+	}
+
+	if err := session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	}); err != nil {
+		log.Printf("[discord:%s] acknowledge interaction failed: %v", d.botName, err)
+	}
+
+	d.publish(event)
+}
+
+// interactionEvent converts a component interaction on one of pantalk's
+// messages to an event. ok is false for other components.
+func (d *DiscordConnector) interactionEvent(interaction *discordgo.Interaction) (protocol.Event, bool) {
+	data := interaction.MessageComponentData()
+
+	var value string
+	switch {
+	case data.CustomID == discordSelectID:
+		if len(data.Values) == 0 {
+			return protocol.Event{}, false
+		}
+		value = data.Values[0]
+	case strings.HasPrefix(data.CustomID, discordCustomIDPrefix+"b:"):
+		value = strings.TrimPrefix(data.CustomID, discordCustomIDPrefix+"b:")
+	default:
+		return protocol.Event{}, false
+	}
+
+	user := ""
+	switch {
+	case interaction.Member != nil && interaction.Member.User != nil:
+		user = interaction.Member.User.ID
+	case interaction.User != nil:
+		user = interaction.User.ID
+	}
+
+	var (
+		reference *discordgo.MessageReference
+		messageID string
+	)
+	if interaction.Message != nil {
+		reference = interaction.Message.MessageReference
+		messageID = interaction.Message.ID
+	}
+	channel, thread := d.location(interaction.ChannelID, reference)
+	if !d.acceptsChannel(channel) {
+		return protocol.Event{}, false
+	}
+
+	return protocol.Event{
+		Timestamp: time.Now().UTC(),
+		Service:   d.serviceName,
+		Bot:       d.botName,
+		Kind:      protocol.KindInteraction,
+		Direction: "in",
+		User:      user,
+		Target:    "channel:" + channel,
+		Channel:   channel,
+		Thread:    thread,
+		MessageID: messageID,
+		Text:      value,
+	}, true
+}
@@ -0,0 +1,89 @@
+package upstream
+
+import (
+	"sync"
+	"time"
+)
+
+// echoGrace is how long a self-authored message is held before it is
+// published, so the Send call that posted it can claim it first; platforms
+// often deliver the echo before the send request returns.
+const echoGrace = 2 * time.Second
+
+// echoFilter tells apart the platform's echoes of a connector's own sends,
+// which Send already published, from messages the bot's account posted
+// through another client (a phone, the web app). Those are published as
+// outbound events when the bot sets include_self. A nil filter drops every
+// self-authored message.
+type echoFilter struct {
+	grace time.Duration
+
+	mu      sync.Mutex
+	sent    map[string]time.Time   // IDs Send reported, until their echo arrives
+	pending map[string]*time.Timer // echoes waiting out the grace period
+}
+
+// newEchoFilter returns a filter, or nil when include self is off.
+func newEchoFilter(includeSelf bool) *echoFilter {
+	if !includeSelf {
+		return nil
+	}
+	return &echoFilter{
+		grace:   echoGrace,
+		sent:    make(map[string]time.Time),
+		pending: make(map[string]*time.Timer),
+	}
+}
+
+// claim records that Send posted the message with id, dropping its echo
+// whether it is still on its way or already waiting.
+func (f *echoFilter) claim(id string) {
+	if f == nil || id == "" {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if timer, ok := f.pending[id]; ok {
+		timer.Stop()
+		delete(f.pending, id)
+		return
+	}
+
+	// Echoes that never come (e.g. for channels the bot doesn't follow)
+	// would otherwise keep their IDs forever.
+	now := time.Now()
+	for sentID, at := range f.sent {
+		if now.Sub(at) > time.Minute {
+			delete(f.sent, sentID)
+		}
+	}
+	f.sent[id] = now
+}
+
+// echo handles a self-authored message: publish runs after the grace period
+// unless Send claims the message by then.
+func (f *echoFilter) echo(id string, publish func()) {
+	if f == nil || id == "" {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.sent[id]; ok {
+		delete(f.sent, id)
+		return
+	}
+	if _, ok := f.pending[id]; ok {
+		return
+	}
+	f.pending[id] = time.AfterFunc(f.grace, func() {
+		f.mu.Lock()
+		_, ok := f.pending[id]
+		delete(f.pending, id)
+		f.mu.Unlock()
+		if ok {
+			publish()
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package upstream
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// Embed limits, from Discord's, which are the strictest of the services
+// that render embeds.
+const (
+	maxEmbeds           = 10
+	maxEmbedTitle       = 256
+	maxEmbedDescription = 4096
+	maxEmbedFields      = 25
+	maxEmbedFieldName   = 256
+	maxEmbedFieldValue  = 1024
+	maxEmbedFooter      = 2048
+	maxEmbedTotal       = 6000
+)
+
+// ValidateEmbeds checks the embeds of a send against the platform limits.
+func ValidateEmbeds(embeds []protocol.Embed) error {
+	if len(embeds) > maxEmbeds {
+		return fmt.Errorf("embeds allows at most %d embeds, got %d", maxEmbeds, len(embeds))
+	}
+
+	total := 0
+	limit := func(n int, what string, value string, max int) error {
+		count := utf8.RuneCountInString(value)
+		total += count
+		if count > max {
+			return fmt.Errorf("embed %d: %s is longer than %d characters", n, what, max)
+		}
+		return nil
+	}
+
+	for i, embed := range embeds {
+		n := i + 1
+		if strings.TrimSpace(embed.Title) == "" && strings.TrimSpace(embed.Description) == "" && len(embed.Fields) == 0 {
+			return fmt.Errorf("embed %d needs a title, description or fields", n)
+		}
+		if embed.Color < 0 || embed.Color > 0xFFFFFF {
+			return fmt.Errorf("embed %d: color must be an RGB value between 0 and 0xFFFFFF", n)
+		}
+		if embed.URL != "" && !strings.HasPrefix(embed.URL, "https://") && !strings.HasPrefix(embed.URL, "http://") {
+			return fmt.Errorf("embed %d: url must be http or https", n)
+		}
+		if err := limit(n, "title", embed.Title, maxEmbedTitle); err != nil {
+			return err
+		}
+		if err := limit(n, "description", embed.Description, maxEmbedDescription); err != nil {
+			return err
+		}
+		if err := limit(n, "footer", embed.Footer, maxEmbedFooter); err != nil {
+			return err
+		}
+		if len(embed.Fields) > maxEmbedFields {
+			return fmt.Errorf("embed %d allows at most %d fields", n, maxEmbedFields)
+		}
+		for _, field := range embed.Fields {
+			if strings.TrimSpace(field.Name) == "" || strings.TrimSpace(field.Value) == "" {
+				return fmt.Errorf("embed %d: fields need a name and a value", n)
+			}
+			if err := limit(n, "field name", field.Name, maxEmbedFieldName); err != nil {
+				return err
+			}
+			if err := limit(n, "field value", field.Value, maxEmbedFieldValue); err != nil {
+				return err
+			}
+		}
+	}
+
+	if total > maxEmbedTotal {
+		return fmt.Errorf("embeds are %d characters in total, the limit is %d", total, maxEmbedTotal)
+	}
+	return nil
+}
+
+// EmbedsText renders embeds as plain text for services without them.
+func EmbedsText(embeds []protocol.Embed) string {
+	var parts []string
+	for _, embed := range embeds {
+		var lines []string
+		if title := strings.TrimSpace(embed.Title); title != "" {
+			lines = append(lines, title)
+		}
+		if description := strings.TrimSpace(embed.Description); description != "" {
+			lines = append(lines, description)
+		}
+		for _, field := range embed.Fields {
+			lines = append(lines, strings.TrimSpace(field.Name)+": "+strings.TrimSpace(field.Value))
+		}
+		if embed.URL != "" {
+			lines = append(lines, embed.URL)
+		}
+		if footer := strings.TrimSpace(embed.Footer); footer != "" {
+			lines = append(lines, footer)
+		}
+		parts = append(parts, strings.Join(lines, "\n"))
+	}
+	return strings.Join(parts, "\n\n")
+}
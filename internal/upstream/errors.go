@@ -0,0 +1,41 @@
+package upstream
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/slack-go/slack"
+	"maunium.net/go/mautrix"
+)
+
+// ErrRateLimited is wrapped by errors of platform calls refused for going
+// too fast.
+var ErrRateLimited = errors.New("rate limited")
+
+// IsRateLimited reports whether err is a platform throttling a call, from
+// a connector's own HTTP calls or from a platform SDK.
+func IsRateLimited(err error) bool {
+	var slackErr *slack.RateLimitedError
+	var discordErr *discordgo.RateLimitError
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, mautrix.MLimitExceeded) ||
+		errors.As(err, &slackErr) || errors.As(err, &discordErr)
+}
+
+// ErrWebhookUnauthorized is wrapped by HandleWebhook errors for callbacks
+// whose signature or secret doesn't check out.
+var ErrWebhookUnauthorized = errors.New("webhook signature or secret invalid")
+
+// ErrNotWebhook is returned by HandleWebhook of a bot that doesn't use
+// transport: webhook.
+var ErrNotWebhook = errors.New("bot doesn't use transport: webhook")
+
+// statusError is the error of a platform call answered with a non-2xx
+// status, e.g. "twilio send failed: status 500".
+func statusError(call string, status int) error {
+	if status == http.StatusTooManyRequests {
+		return fmt.Errorf("%s failed: status %d: %w", call, status, ErrRateLimited)
+	}
+	return fmt.Errorf("%s failed: status %d", call, status)
+}
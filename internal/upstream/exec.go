@@ -0,0 +1,336 @@
+package upstream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/config"
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// Exec connector messages. The daemon writes requests to the plugin's stdin
+// and the plugin writes everything else to stdout, one JSON object per line.
+// See docs/exec-connectors.md.
+const (
+	execHello  = "hello"  // plugin → daemon: identity and capabilities
+	execEvent  = "event"  // plugin → daemon: an event to publish
+	execResult = "result" // plugin → daemon: the answer to a request
+	execSend   = "send"   // daemon → plugin
+	execReact  = "react"  // daemon → plugin
+)
+
+// execRequestTimeout bounds how long a request waits for the plugin's
+// result when the caller's context has no deadline.
+const execRequestTimeout = 30 * time.Second
+
+// execMessage is one line of the exec connector protocol.
+type execMessage struct {
+	Type         string                 `json:"type"`
+	ID           int64                  `json:"id,omitempty"`
+	Request      *protocol.Request      `json:"request,omitempty"`
+	Event        *protocol.Event        `json:"event,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+	Identity     string                 `json:"identity,omitempty"`
+	Capabilities *protocol.Capabilities `json:"capabilities,omitempty"`
+}
+
+// ExecConnector runs an out-of-tree connector as a subprocess (transport:
+// exec). Run lasts as long as the process does, so the supervisor restarts
+// plugins that exit or crash.
+type ExecConnector struct {
+	serviceName string
+	botName     string
+	command     []string
+	env         []string
+	publish     func(protocol.Event)
+
+	mu       sync.Mutex
+	stdin    io.Writer // nil while the plugin isn't running
+	nextID   int64
+	pending  map[int64]chan execMessage
+	identity string
+	caps     protocol.Capabilities
+}
+
+func NewExecConnector(bot config.BotConfig, publish func(protocol.Event)) (*ExecConnector, error) {
+	if len(bot.Command) == 0 {
+		return nil, fmt.Errorf("bot %q requires command for exec transport", bot.Name)
+	}
+
+	env := []string{
+		"PANTALK_SERVICE=" + bot.Type,
+		"PANTALK_BOT=" + bot.Name,
+		"PANTALK_DISPLAY_NAME=" + bot.DisplayName,
+		"PANTALK_ENDPOINT=" + bot.Endpoint,
+		"PANTALK_CHANNELS=" + strings.Join(bot.Channels, ","),
+	}
+	for _, cred := range []struct{ name, value string }{
+		{"PANTALK_BOT_TOKEN", bot.BotToken},
+		{"PANTALK_API_KEY", bot.APIKey},
+		{"PANTALK_PASSWORD", bot.Password},
+	} {
+		if strings.TrimSpace(cred.value) == "" {
+			continue
+		}
+		resolved, err := config.ResolveCredential(cred.value)
+		if err != nil {
+			return nil, fmt.Errorf("resolve %s for bot %q: %w", strings.ToLower(strings.TrimPrefix(cred.name, "PANTALK_")), bot.Name, err)
+		}
+		env = append(env, cred.name+"="+resolved)
+	}
+
+	return &ExecConnector{
+		serviceName: bot.Type,
+		botName:     bot.Name,
+		command:     bot.Command,
+		env:         env,
+		publish:     publish,
+		pending:     make(map[int64]chan execMessage),
+	}, nil
+}
+
+func (e *ExecConnector) Run(ctx context.Context) {
+	cmd := exec.CommandContext(ctx, e.command[0], e.command[1:]...)
+	cmd.Env = append(os.Environ(), e.env...)
+	// Give the plugin a chance to log out before it is killed.
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = 5 * time.Second
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		e.publishStatus(fmt.Sprintf("plugin failed to start: %v", err))
+		return
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		e.publishStatus(fmt.Sprintf("plugin failed to start: %v", err))
+		return
+	}
+	cmd.Stderr = &pluginLog{prefix: fmt.Sprintf("[%s:%s] plugin: ", e.serviceName, e.botName)}
+	if err := cmd.Start(); err != nil {
+		e.publishStatus(fmt.Sprintf("plugin failed to start: %v", err))
+		return
+	}
+	log.Printf("[%s:%s] started plugin %s (pid %d)", e.serviceName, e.botName, e.command[0], cmd.Process.Pid)
+
+	e.mu.Lock()
+	e.stdin = stdin
+	e.mu.Unlock()
+
+	if err := e.readStdout(stdout); err != nil {
+		// The plugin can't be understood any more; stop it rather than
+		// leave it blocked on a full pipe.
+		log.Printf("[%s:%s] read plugin output: %v", e.serviceName, e.botName, err)
+		_ = cmd.Process.Kill()
+	}
+
+	err = cmd.Wait()
+
+	e.mu.Lock()
+	e.stdin = nil
+	for id, ch := range e.pending {
+		ch <- execMessage{Type: execResult, ID: id, Error: "plugin exited"}
+		delete(e.pending, id)
+	}
+	e.mu.Unlock()
+
+	switch {
+	case ctx.Err() != nil:
+		e.publishStatus("connector offline")
+	case err != nil:
+		e.publishStatus(fmt.Sprintf("plugin exited: %v", err))
+	default:
+		e.publishStatus("plugin exited")
+	}
+}
+
+// readStdout handles the plugin's messages until it closes stdout.
+func (e *ExecConnector) readStdout(stdout io.Reader) error {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		var msg execMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			log.Printf("[%s:%s] invalid plugin message: %v", e.serviceName, e.botName, err)
+			continue
+		}
+
+		switch msg.Type {
+		case execHello:
+			e.mu.Lock()
+			e.identity = msg.Identity
+			if msg.Capabilities != nil {
+				// Only sends and reactions are forwarded to plugins so far.
+				e.caps = *msg.Capabilities
+				e.caps.MarkRead, e.caps.Presence, e.caps.Channels = false, false, false
+			}
+			e.mu.Unlock()
+			e.publishStatus("connector online")
+		case execEvent:
+			if msg.Event == nil {
+				continue
+			}
+			event := *msg.Event
+			event.Service, event.Bot = e.serviceName, e.botName
+			e.publish(event)
+		case execResult:
+			e.mu.Lock()
+			ch := e.pending[msg.ID]
+			delete(e.pending, msg.ID)
+			e.mu.Unlock()
+			if ch != nil {
+				ch <- msg
+			}
+		default:
+			log.Printf("[%s:%s] unknown plugin message type %q", e.serviceName, e.botName, msg.Type)
+		}
+	}
+	return scanner.Err()
+}
+
+// pluginLog writes a plugin's stderr to the daemon log line by line.
+type pluginLog struct {
+	prefix string
+	buf    []byte
+}
+
+func (l *pluginLog) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		log.Print(l.prefix + strings.TrimRight(string(l.buf[:i]), "\r"))
+		l.buf = l.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// call writes a request to the plugin and waits for its result.
+func (e *ExecConnector) call(ctx context.Context, kind string, request protocol.Request) (execMessage, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, execRequestTimeout)
+		defer cancel()
+	}
+
+	result := make(chan execMessage, 1)
+
+	e.mu.Lock()
+	if e.stdin == nil {
+		e.mu.Unlock()
+		return execMessage{}, errors.New("plugin is not running")
+	}
+	e.nextID++
+	id := e.nextID
+	line, err := json.Marshal(execMessage{Type: kind, ID: id, Request: &request})
+	if err != nil {
+		e.mu.Unlock()
+		return execMessage{}, fmt.Errorf("encode plugin request: %w", err)
+	}
+	e.pending[id] = result
+	_, err = e.stdin.Write(append(line, '\n'))
+	if err != nil {
+		delete(e.pending, id)
+	}
+	e.mu.Unlock()
+	if err != nil {
+		return execMessage{}, fmt.Errorf("write to plugin: %w", err)
+	}
+
+	select {
+	case msg := <-result:
+		if msg.Error != "" {
+			return execMessage{}, errors.New(msg.Error)
+		}
+		return msg, nil
+	case <-ctx.Done():
+		e.mu.Lock()
+		delete(e.pending, id)
+		e.mu.Unlock()
+		return execMessage{}, fmt.Errorf("plugin did not answer: %w", ctx.Err())
+	}
+}
+
+func (e *ExecConnector) Send(ctx context.Context, request protocol.Request) (protocol.Event, error) {
+	msg, err := e.call(ctx, execSend, request)
+	if err != nil {
+		return protocol.Event{}, err
+	}
+
+	var event protocol.Event
+	if msg.Event != nil {
+		event = *msg.Event
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	event.Service, event.Bot = e.serviceName, e.botName
+	if event.Kind == "" {
+		event.Kind = "message"
+	}
+	if event.Direction == "" {
+		event.Direction = "out"
+	}
+	if event.Target == "" {
+		event.Target = request.Target
+	}
+	if event.Channel == "" {
+		event.Channel = request.Channel
+	}
+	if event.Thread == "" {
+		event.Thread = request.Thread
+	}
+	if event.Text == "" {
+		event.Text = request.Text
+	}
+	e.publish(event)
+	return event, nil
+}
+
+func (e *ExecConnector) React(ctx context.Context, request protocol.Request) error {
+	_, err := e.call(ctx, execReact, request)
+	return err
+}
+
+func (e *ExecConnector) Identity() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.identity
+}
+
+// Capabilities reports what the plugin announced in its hello message.
+func (e *ExecConnector) Capabilities() protocol.Capabilities {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.caps
+}
+
+func (e *ExecConnector) publishStatus(text string) {
+	e.publish(protocol.Event{
+		Timestamp: time.Now().UTC(),
+		Service:   e.serviceName,
+		Bot:       e.botName,
+		Kind:      "status",
+		Direction: "system",
+		Text:      text,
+	})
+}
@@ -1442,7 +1442,7 @@ func TestIMessage_ControlCharsInInput(t *testing.T) {
 	if len(segs) == 0 {
 		t.Fatal("expected segments")
 	}
-	// Verify the content passes through (actual escaping happens in sendViaAppleScript).
+	// Verify the content passes through (actual escaping happens in imessageBuddyScript).
 	if !strings.Contains(segs[0], "line1") {
 		t.Fatalf("expected text preserved, got %q", segs[0])
 	}
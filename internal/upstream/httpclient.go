@@ -0,0 +1,130 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/config"
+)
+
+// maxRetryAfter caps how long a Retry-After header can hold a retry back.
+const maxRetryAfter = time.Minute
+
+// pollMargin is how much longer than the long poll itself a poll request
+// may take before it is abandoned.
+const pollMargin = 20 * time.Second
+
+// newTransport returns the transport of a bot's HTTP clients: through its
+// proxy, keeping idle connections as its http: block says.
+func newTransport(proxy proxyFunc, opts config.HTTPConfig) *http.Transport {
+	transport := newProxyTransport(proxy)
+	switch {
+	case opts.KeepAlive < 0:
+		transport.DisableKeepAlives = true
+	case opts.KeepAlive > 0:
+		transport.IdleConnTimeout = time.Duration(opts.KeepAlive) * time.Second
+	}
+	return transport
+}
+
+// newHTTPClient returns the client of a bot's API calls, which retries
+// failed requests and gives up after the http: timeout, or fallback.
+func newHTTPClient(proxy proxyFunc, opts config.HTTPConfig, fallback time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: opts.TimeoutOr(fallback),
+		Transport: &retryTransport{
+			base:    newTransport(proxy, opts),
+			retries: opts.RetryCount(),
+			backoff: opts.BackoffDuration(),
+		},
+	}
+}
+
+// newPollClient returns the client of long polls that wait up to poll for
+// events. Failed polls aren't retried: the poll loop starts the next one.
+func newPollClient(proxy proxyFunc, opts config.HTTPConfig, poll time.Duration) *http.Client {
+	return &http.Client{Timeout: poll + pollMargin, Transport: newTransport(proxy, opts)}
+}
+
+// retryTransport retries requests that failed in a way that is safe to
+// repeat: any request the server turned away with 429 or 503 or that
+// never reached it, and idempotent ones after other 5xx answers and
+// network errors. Waits double from backoff, or follow Retry-After.
+type retryTransport struct {
+	base    http.RoundTripper
+	retries int
+	backoff time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if attempt >= t.retries || !shouldRetry(req, resp, err) {
+			return resp, err
+		}
+		if req.Body != nil && req.GetBody == nil {
+			return resp, err
+		}
+
+		wait := t.backoff << attempt
+		if resp != nil {
+			if after := retryAfter(resp); after > wait {
+				wait = after
+			}
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return true
+		}
+		return idempotent
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// retryAfter reads a Retry-After header given in seconds.
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return min(time.Duration(seconds)*time.Second, maxRetryAfter)
+}
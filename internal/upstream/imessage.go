@@ -1,12 +1,16 @@
 package upstream
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -44,6 +48,9 @@ type IMessageConnector struct {
 	channels   map[string]struct{}
 	lastRowID  int64
 	selfHandle string
+	// chatGUIDs maps group chat identifiers and display names to the chat
+	// GUIDs AppleScript addresses them by.
+	chatGUIDs map[string]string
 
 	// osascriptCmd is the command used to run AppleScript. Overridable for
 	// testing so we don't actually invoke osascript in unit tests.
@@ -61,9 +68,28 @@ type chatDBRow struct {
 	IsFromMe    int
 	HandleID    string // sender phone/email
 	ChatID      string // chat identifier (e.g. "+15551234567" or "chat123456")
+	ChatGUID    string // chat GUID (e.g. "iMessage;+;chat123456")
 	ServiceName string // "iMessage" or "SMS"
 	RoomName    string // non-empty for group chats
 	DisplayName string // group chat display name
+
+	// AssociatedType and AssociatedGUID link a tapback to the message it
+	// reacts to; see imessageTapbacks.
+	AssociatedType int
+	AssociatedGUID string
+	HasAttachments bool
+	Attachments    []protocol.Attachment
+}
+
+// imessageTapbacks maps associated_message_type values of added tapbacks to
+// emoji names. The same reactions are removed with 3000-3005.
+var imessageTapbacks = map[int]string{
+	2000: "heart",
+	2001: "thumbsup",
+	2002: "thumbsdown",
+	2003: "laughing",
+	2004: "bangbang",
+	2005: "question",
 }
 
 func NewIMessageConnector(bot config.BotConfig, publish func(protocol.Event)) (*IMessageConnector, error) {
@@ -84,6 +110,7 @@ func NewIMessageConnector(bot config.BotConfig, publish func(protocol.Event)) (*
 		dbPath:       dbPath,
 		publish:      publish,
 		channels:     make(map[string]struct{}),
+		chatGUIDs:    make(map[string]string),
 		osascriptCmd: "osascript",
 	}
 
@@ -182,20 +209,33 @@ func (c *IMessageConnector) Send(ctx context.Context, request protocol.Request)
 
 	recipient := resolveIMessageChannel(request)
 	if recipient == "" {
-		return protocol.Event{}, fmt.Errorf("imessage send requires channel or target (phone number or email)")
+		return protocol.Event{}, fmt.Errorf("imessage send requires channel or target (phone number, email or group chat)")
+	}
+
+	// Group chats have no single buddy to send to; address the chat itself.
+	var chatGUID string
+	target := request.Target
+	if isIMessageGroup(request, recipient) {
+		chatGUID, err = c.resolveChatGUID(ctx, recipient)
+		if err != nil {
+			return protocol.Event{}, err
+		}
+		recipient = imessageChatIdentifier(chatGUID)
+		target = "group:" + recipient
+	} else if target == "" {
+		target = "dm:" + recipient
 	}
 
 	c.rememberChannel(recipient)
 
 	var lastEvent protocol.Event
 	for _, segmentText := range segments {
-		if sendErr := c.sendViaAppleScript(ctx, recipient, segmentText); sendErr != nil {
-			return protocol.Event{}, fmt.Errorf("imessage send failed: %w", sendErr)
+		script := imessageBuddyScript(recipient, segmentText)
+		if chatGUID != "" {
+			script = imessageChatScript(chatGUID, segmentText)
 		}
-
-		target := request.Target
-		if target == "" {
-			target = "dm:" + recipient
+		if sendErr := c.runAppleScript(ctx, script); sendErr != nil {
+			return protocol.Event{}, fmt.Errorf("imessage send failed: %w", sendErr)
 		}
 
 		event := protocol.Event{
@@ -269,9 +309,14 @@ func (c *IMessageConnector) fetchNewMessages(db *sql.DB) ([]chatDBRow, error) {
 			m.is_from_me,
 			COALESCE(h.id, ''),
 			COALESCE(c.chat_identifier, ''),
+			COALESCE(c.guid, ''),
 			COALESCE(c.service_name, ''),
 			COALESCE(c.room_name, ''),
-			COALESCE(c.display_name, '')
+			COALESCE(c.display_name, ''),
+			m.attributedBody,
+			COALESCE(m.associated_message_type, 0),
+			COALESCE(m.associated_message_guid, ''),
+			COALESCE(m.cache_has_attachments, 0)
 		FROM message m
 		LEFT JOIN handle h ON m.handle_id = h.ROWID
 		LEFT JOIN chat_message_join cmj ON m.ROWID = cmj.message_id
@@ -292,6 +337,7 @@ func (c *IMessageConnector) fetchNewMessages(db *sql.DB) ([]chatDBRow, error) {
 
 	for sqlRows.Next() {
 		var row chatDBRow
+		var attributedBody []byte
 		if err := sqlRows.Scan(
 			&row.RowID,
 			&row.GUID,
@@ -300,9 +346,14 @@ func (c *IMessageConnector) fetchNewMessages(db *sql.DB) ([]chatDBRow, error) {
 			&row.IsFromMe,
 			&row.HandleID,
 			&row.ChatID,
+			&row.ChatGUID,
 			&row.ServiceName,
 			&row.RoomName,
 			&row.DisplayName,
+			&attributedBody,
+			&row.AssociatedType,
+			&row.AssociatedGUID,
+			&row.HasAttachments,
 		); err != nil {
 			return nil, fmt.Errorf("scan message row: %w", err)
 		}
@@ -316,8 +367,22 @@ func (c *IMessageConnector) fetchNewMessages(db *sql.DB) ([]chatDBRow, error) {
 			continue
 		}
 
-		// Skip empty messages (attachments-only, reactions, etc.).
-		if strings.TrimSpace(row.Text) == "" {
+		// Newer macOS leaves text NULL and keeps it only in attributedBody.
+		if row.Text == "" && len(attributedBody) > 0 {
+			row.Text = decodeAttributedBody(attributedBody)
+		}
+
+		// Tapbacks carry a "Loved “…”" summary as text; keep added ones as
+		// reactions and skip removals and other associated messages.
+		if row.AssociatedType != 0 {
+			if _, ok := imessageTapbacks[row.AssociatedType]; ok {
+				rows = append(rows, row)
+			}
+			continue
+		}
+
+		// Skip rows with nothing to report.
+		if strings.TrimSpace(row.Text) == "" && !row.HasAttachments {
 			continue
 		}
 
@@ -327,6 +392,18 @@ func (c *IMessageConnector) fetchNewMessages(db *sql.DB) ([]chatDBRow, error) {
 	if err := sqlRows.Err(); err != nil {
 		return nil, fmt.Errorf("iterate message rows: %w", err)
 	}
+	sqlRows.Close()
+
+	for i := range rows {
+		if !rows[i].HasAttachments {
+			continue
+		}
+		attachments, err := fetchIMessageAttachments(db, rows[i].RowID)
+		if err != nil {
+			return nil, err
+		}
+		rows[i].Attachments = attachments
+	}
 
 	// Advance the high-water mark.
 	if maxRowID > 0 {
@@ -350,17 +427,17 @@ func (c *IMessageConnector) handleIncomingMessage(row chatDBRow) {
 	}
 
 	text := strings.TrimSpace(row.Text)
-	if text == "" {
+	tapback, isTapback := imessageTapbacks[row.AssociatedType]
+	if text == "" && len(row.Attachments) == 0 && !isTapback {
 		return
 	}
 
 	target := "dm:" + sender
 	if isGroup {
-		if row.DisplayName != "" {
-			target = "group:" + row.DisplayName
-		} else {
-			target = "group:" + row.RoomName
-		}
+		// Display names change when the group is renamed; the chat
+		// identifier does not.
+		target = "group:" + chatID
+		c.rememberChatGUID(row)
 	}
 
 	channel := chatID
@@ -368,43 +445,152 @@ func (c *IMessageConnector) handleIncomingMessage(row chatDBRow) {
 		channel = sender
 	}
 
+	if isTapback {
+		c.publish(protocol.Event{
+			Timestamp: appleTimestampToTime(row.Date),
+			Service:   c.serviceName,
+			Bot:       c.botName,
+			Kind:      protocol.KindReaction,
+			Direction: "in",
+			User:      sender,
+			Target:    "post:" + imessageAssociatedGUID(row.AssociatedGUID),
+			Channel:   channel,
+			MessageID: imessageAssociatedGUID(row.AssociatedGUID),
+			Text:      tapback,
+		})
+		return
+	}
+
 	c.publish(protocol.Event{
-		Timestamp: appleTimestampToTime(row.Date),
-		Service:   c.serviceName,
-		Bot:       c.botName,
-		Kind:      "message",
-		Direction: "in",
-		User:      sender,
-		Target:    target,
-		Channel:   channel,
-		Text:      text,
-		Direct:    !isGroup,
+		Timestamp:   appleTimestampToTime(row.Date),
+		Service:     c.serviceName,
+		Bot:         c.botName,
+		Kind:        "message",
+		Direction:   "in",
+		User:        sender,
+		Target:      target,
+		Channel:     channel,
+		MessageID:   row.GUID,
+		Text:        text,
+		Direct:      !isGroup,
+		Attachments: row.Attachments,
 	})
 }
 
-// sendViaAppleScript sends a message through Messages.app using osascript.
-// The script tries the modern AppleScript syntax (account/participant, macOS
-// Monterey+) first and falls back to the legacy syntax (service/buddy) if
-// the modern form fails. This covers macOS 10.13 through Sequoia+.
-func (c *IMessageConnector) sendViaAppleScript(ctx context.Context, recipient, text string) error {
-	// Escape backslashes and quotes for AppleScript string literals.
-	escapedText := strings.ReplaceAll(text, `\`, `\\`)
-	escapedText = strings.ReplaceAll(escapedText, `"`, `\"`)
-	// Newlines and carriage returns must be escaped to AppleScript \n / \r
-	// so they stay within the quoted string rather than breaking the script
-	// across lines.
-	escapedText = strings.ReplaceAll(escapedText, "\n", `\n`)
-	escapedText = strings.ReplaceAll(escapedText, "\r", `\r`)
-	escapedText = strings.ReplaceAll(escapedText, "\t", `\t`)
+// fetchIMessageAttachments reads the attachments of a message. Files are
+// in ~/Library/Messages/Attachments and need the same Full Disk Access as
+// chat.db.
+func fetchIMessageAttachments(db *sql.DB, messageRowID int64) ([]protocol.Attachment, error) {
+	sqlRows, err := db.Query(`
+		SELECT
+			COALESCE(a.guid, ''),
+			COALESCE(a.filename, ''),
+			COALESCE(a.transfer_name, ''),
+			COALESCE(a.mime_type, ''),
+			COALESCE(a.uti, ''),
+			COALESCE(a.total_bytes, 0)
+		FROM message_attachment_join maj
+		JOIN attachment a ON a.ROWID = maj.attachment_id
+		WHERE maj.message_id = ?
+		ORDER BY a.ROWID ASC
+	`, messageRowID)
+	if err != nil {
+		return nil, fmt.Errorf("query attachments: %w", err)
+	}
+	defer sqlRows.Close()
+
+	var attachments []protocol.Attachment
+	for sqlRows.Next() {
+		var attachment protocol.Attachment
+		if err := sqlRows.Scan(&attachment.ID, &attachment.Path, &attachment.Name, &attachment.MimeType, &attachment.UTI, &attachment.Size); err != nil {
+			return nil, fmt.Errorf("scan attachment row: %w", err)
+		}
+		attachment.Path = expandHome(attachment.Path)
+		if attachment.Name == "" {
+			attachment.Name = filepath.Base(attachment.Path)
+		}
+		attachment.Kind = imessageAttachmentKind(attachment.MimeType)
+		// Audio messages recorded in Messages are Core Audio files.
+		attachment.Voice = attachment.UTI == "com.apple.coreaudio-format"
+		attachments = append(attachments, attachment)
+	}
+	if err := sqlRows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate attachment rows: %w", err)
+	}
+	return attachments, nil
+}
+
+func imessageAttachmentKind(mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return protocol.AttachmentImage
+	case strings.HasPrefix(mimeType, "video/"):
+		return protocol.AttachmentVideo
+	case strings.HasPrefix(mimeType, "audio/"):
+		return protocol.AttachmentAudio
+	default:
+		return protocol.AttachmentFile
+	}
+}
 
-	escapedRecipient := strings.ReplaceAll(recipient, `\`, `\\`)
-	escapedRecipient = strings.ReplaceAll(escapedRecipient, `"`, `\"`)
+// imessageAssociatedGUID strips the part prefix of an
+// associated_message_guid: "p:0/<guid>" for a part of a message, "bp:<guid>"
+// for a message with a link preview.
+func imessageAssociatedGUID(guid string) string {
+	if _, rest, ok := strings.Cut(guid, "/"); ok {
+		return rest
+	}
+	if _, rest, ok := strings.Cut(guid, ":"); ok {
+		return rest
+	}
+	return guid
+}
+
+// decodeAttributedBody extracts the text of an attributedBody, an
+// NSAttributedString archived as a typedstream. The string follows the
+// NSString class name and a five-byte preamble, prefixed by its length:
+// one byte, or 0x81 and a 16-bit or 0x82 and a 32-bit little-endian value.
+func decodeAttributedBody(body []byte) string {
+	_, rest, ok := bytes.Cut(body, []byte("NSString"))
+	if !ok || len(rest) < 6 {
+		return ""
+	}
+	rest = rest[5:]
+
+	var length int
+	switch rest[0] {
+	case 0x81:
+		if len(rest) < 3 {
+			return ""
+		}
+		length, rest = int(binary.LittleEndian.Uint16(rest[1:3])), rest[3:]
+	case 0x82:
+		if len(rest) < 5 {
+			return ""
+		}
+		length, rest = int(binary.LittleEndian.Uint32(rest[1:5])), rest[5:]
+	default:
+		length, rest = int(rest[0]), rest[1:]
+	}
+	if length > len(rest) {
+		return ""
+	}
+	return strings.ToValidUTF8(string(rest[:length]), "")
+}
+
+// imessageBuddyScript builds the AppleScript that sends text to a phone
+// number or email address. It tries the modern syntax (account/participant,
+// macOS Monterey+) first and falls back to the legacy syntax (service/buddy)
+// if the modern form fails. This covers macOS 10.13 through Sequoia+.
+func imessageBuddyScript(recipient, text string) string {
+	escapedText := appleScriptString(text)
+	escapedRecipient := appleScriptString(recipient)
 
 	// Modern syntax (macOS Monterey / Ventura / Sonoma / Sequoia):
 	//   id of 1st account  →  account id  →  participant
 	// Legacy fallback (macOS High Sierra – Big Sur):
 	//   1st service  →  buddy
-	script := fmt.Sprintf(`
+	return fmt.Sprintf(`
 		tell application "Messages"
 			try
 				set iMessageAccount to id of 1st account whose service type = iMessage
@@ -417,7 +603,34 @@ func (c *IMessageConnector) sendViaAppleScript(ctx context.Context, recipient, t
 			end try
 		end tell
 	`, escapedRecipient, escapedText, escapedRecipient, escapedText)
+}
+
+// imessageChatScript builds the AppleScript that sends text to an existing
+// chat by its GUID, which is how group chats are addressed.
+func imessageChatScript(chatGUID, text string) string {
+	return fmt.Sprintf(`
+		tell application "Messages"
+			send "%s" to chat id "%s"
+		end tell
+	`, appleScriptString(text), appleScriptString(chatGUID))
+}
+
+// appleScriptString escapes s for use inside an AppleScript string literal.
+func appleScriptString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	// Newlines and carriage returns must be escaped to AppleScript \n / \r
+	// so they stay within the quoted string rather than breaking the script
+	// across lines.
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	s = strings.ReplaceAll(s, "\r", `\r`)
+	s = strings.ReplaceAll(s, "\t", `\t`)
+	return s
+}
 
+// runAppleScript runs a script built by imessageBuddyScript or
+// imessageChatScript through osascript.
+func (c *IMessageConnector) runAppleScript(ctx context.Context, script string) error {
 	cmd := exec.CommandContext(ctx, c.osascriptCmd, "-e", script)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -427,6 +640,98 @@ func (c *IMessageConnector) sendViaAppleScript(ctx context.Context, recipient, t
 	return nil
 }
 
+// rememberChatGUID records the GUID of a group chat seen in chat.db so that
+// replies can address it by identifier or display name.
+func (c *IMessageConnector) rememberChatGUID(row chatDBRow) {
+	if row.ChatGUID == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.chatGUIDs == nil {
+		c.chatGUIDs = make(map[string]string)
+	}
+	c.chatGUIDs[row.ChatID] = row.ChatGUID
+	if row.DisplayName != "" {
+		c.chatGUIDs[row.DisplayName] = row.ChatGUID
+	}
+}
+
+// resolveChatGUID finds the GUID of a group chat given its GUID, chat
+// identifier or display name. Chats not seen since startup are looked up
+// in chat.db.
+func (c *IMessageConnector) resolveChatGUID(ctx context.Context, name string) (string, error) {
+	if strings.Contains(name, ";") {
+		c.rememberChatGUID(chatDBRow{ChatID: imessageChatIdentifier(name), ChatGUID: name})
+		return name, nil
+	}
+
+	c.mu.RLock()
+	guid, ok := c.chatGUIDs[name]
+	c.mu.RUnlock()
+	if ok {
+		return guid, nil
+	}
+
+	db, err := sql.Open("sqlite3", c.dbPath+"?mode=ro&_journal_mode=WAL")
+	if err != nil {
+		return "", fmt.Errorf("open imessage database: %w", err)
+	}
+	defer db.Close()
+
+	var row chatDBRow
+	err = db.QueryRowContext(ctx, `
+		SELECT guid, chat_identifier, COALESCE(display_name, '')
+		FROM chat
+		WHERE chat_identifier = ? OR display_name = ?
+		ORDER BY ROWID DESC
+		LIMIT 1
+	`, name, name).Scan(&row.ChatGUID, &row.ChatID, &row.DisplayName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("imessage group chat %q not found", name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("look up imessage group chat %q: %w", name, err)
+	}
+
+	c.rememberChatGUID(row)
+	return row.ChatGUID, nil
+}
+
+// isIMessageGroup reports whether a send is addressed to a group chat:
+// through a group: target, a chat GUID, or a chat identifier such as
+// "chat123456789".
+func isIMessageGroup(request protocol.Request, recipient string) bool {
+	if request.Channel == "" {
+		target := strings.TrimPrefix(strings.TrimSpace(request.Target), "imessage:")
+		if strings.HasPrefix(target, "group:") {
+			return true
+		}
+	}
+	if strings.Contains(recipient, ";+;") {
+		return true
+	}
+	digits := strings.TrimPrefix(recipient, "chat")
+	if digits == recipient || digits == "" {
+		return false
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// imessageChatIdentifier returns the chat identifier part of a chat GUID,
+// "chat123456" for "iMessage;+;chat123456".
+func imessageChatIdentifier(guid string) string {
+	if i := strings.LastIndex(guid, ";"); i >= 0 {
+		return guid[i+1:]
+	}
+	return guid
+}
+
 func (c *IMessageConnector) rememberChannel(channel string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -474,6 +779,10 @@ func (c *IMessageConnector) sleepOrDone(ctx context.Context, wait time.Duration)
 	}
 }
 
+// imessageMaxText is how much text goes in one iMessage; longer text is
+// split.
+const imessageMaxText = 20000
+
 // prepareIMessageSegments converts the message to plain text (iMessage via
 // AppleScript has no markup support) and splits it at a safe length.
 func prepareIMessageSegments(format string, text string) ([]string, error) {
@@ -497,7 +806,7 @@ func prepareIMessageSegments(format string, text string) ([]string, error) {
 
 	// iMessage has generous limits but AppleScript argument length is
 	// bounded; use 20000 characters as a safe limit.
-	return formatting.SplitText(trimmed, 20000), nil
+	return formatting.SplitText(trimmed, imessageMaxText), nil
 }
 
 // resolveIMessageChannel extracts a recipient (phone number or email) from
@@ -580,6 +889,12 @@ func parseIMessageRowID(s string) int64 {
 	return v
 }
 
+// Capabilities reports that the iMessage connector has none of the optional
+// features.
+func (c *IMessageConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{MaxText: imessageMaxText}
+}
+
 // React is not supported by the iMessage connector.
 func (c *IMessageConnector) React(_ context.Context, _ protocol.Request) error {
 	return fmt.Errorf("reactions are not supported by the imessage connector")
@@ -0,0 +1,87 @@
+package upstream
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// Interactive limits, set by the strictest platform: Telegram callback data
+// is at most 64 bytes, Slack button text 75 characters, and Discord fits 25
+// components in five rows, one of which the select menu takes.
+const (
+	maxInteractiveButtons = 20
+	maxSelectOptions      = 25
+	maxInteractiveValue   = 64
+	maxInteractiveLabel   = 75
+)
+
+// ValidateInteractive checks that an interactive payload can be rendered on
+// every platform that supports it. Values identify the choice in the
+// interaction event, so they must be unique.
+func ValidateInteractive(interactive *protocol.Interactive) error {
+	if interactive == nil {
+		return nil
+	}
+	if len(interactive.Buttons) == 0 && (interactive.Select == nil || len(interactive.Select.Options) == 0) {
+		return fmt.Errorf("interactive needs at least one button or select option")
+	}
+	if len(interactive.Buttons) > maxInteractiveButtons {
+		return fmt.Errorf("interactive allows at most %d buttons", maxInteractiveButtons)
+	}
+
+	seen := make(map[string]struct{})
+	check := func(what string, label string, value string) error {
+		if strings.TrimSpace(label) == "" {
+			return fmt.Errorf("%s label cannot be empty", what)
+		}
+		if utf8.RuneCountInString(label) > maxInteractiveLabel {
+			return fmt.Errorf("%s label %q is longer than %d characters", what, label, maxInteractiveLabel)
+		}
+		if value == "" {
+			return fmt.Errorf("%s %q needs a value", what, label)
+		}
+		if len(value) > maxInteractiveValue {
+			return fmt.Errorf("%s value %q is longer than %d bytes", what, value, maxInteractiveValue)
+		}
+		if _, dup := seen[value]; dup {
+			return fmt.Errorf("duplicate interactive value %q", value)
+		}
+		seen[value] = struct{}{}
+		return nil
+	}
+
+	for _, button := range interactive.Buttons {
+		if err := check("button", button.Label, button.Value); err != nil {
+			return err
+		}
+		switch button.Style {
+		case "", "primary", "danger":
+		default:
+			return fmt.Errorf("button %q: style must be primary, danger or empty, got %q", button.Label, button.Style)
+		}
+	}
+
+	if interactive.Select != nil {
+		if len(interactive.Select.Options) > maxSelectOptions {
+			return fmt.Errorf("select allows at most %d options", maxSelectOptions)
+		}
+		for _, option := range interactive.Select.Options {
+			if err := check("option", option.Label, option.Value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// selectPlaceholder is the placeholder for a select menu without one.
+func selectPlaceholder(sel *protocol.Select) string {
+	if placeholder := strings.TrimSpace(sel.Placeholder); placeholder != "" {
+		return placeholder
+	}
+	return "Choose…"
+}
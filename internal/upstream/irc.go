@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"crypto/tls"
+	"encoding/base64"
 	"fmt"
 	"log"
 	"net"
@@ -19,19 +20,40 @@ import (
 const defaultIRCPort = "6667"
 const defaultIRCSPort = "6697"
 
+// identifyJoinTimeout is how long the connector holds off joining channels
+// for NickServ to confirm the login, so cloaks apply before the first JOIN.
+const identifyJoinTimeout = 10 * time.Second
+
+// ircRejoinDelay spaces a rejoin after a kick; many networks treat an
+// instant rejoin as abuse.
+const ircRejoinDelay = 3 * time.Second
+
 type IRCConnector struct {
-	serviceName string
-	botName     string
-	nick        string
-	realname    string
-	endpoint    string
-	password    string
-	useTLS      bool
-	publish     func(protocol.Event)
+	serviceName      string
+	botName          string
+	nicks            []string // the bot name, then irc.alt_nicks
+	realname         string
+	endpoint         string
+	password         string
+	tlsConfig        *tls.Config // nil for plain TCP
+	proxy            proxyFunc   // nil dials directly
+	sasl             string      // config.SASLPlain, config.SASLExternal or ""
+	saslUser         string
+	saslPassword     string
+	nickservPassword string
+	rejoinOnKick     bool
+	publish          func(protocol.Event)
 
 	mu       sync.RWMutex
 	channels map[string]struct{}
 	conn     net.Conn
+
+	// Per-connection state, reset by connectAndRun.
+	nick       string // nick in use
+	nickTry    int    // index into nicks of the nick last tried
+	registered bool   // the server sent RPL_WELCOME
+	joined     bool   // channels have been joined
+	failure    error  // ends the connection with an error, e.g. SASL failure
 }
 
 func NewIRCConnector(bot config.BotConfig, publish func(protocol.Event)) (*IRCConnector, error) {
@@ -40,23 +62,40 @@ func NewIRCConnector(bot config.BotConfig, publish func(protocol.Event)) (*IRCCo
 		return nil, fmt.Errorf("bot %q requires endpoint for irc", bot.Name)
 	}
 
-	nick := bot.Name
+	opts := bot.IRCOptions()
+
+	nicks := []string{bot.Name}
+	for _, nick := range opts.AltNicks {
+		nicks = append(nicks, strings.TrimSpace(nick))
+	}
 	realname := bot.DisplayName
 	if realname == "" {
-		realname = nick
-	}
-
-	// Resolve optional server password.
-	var password string
-	if strings.TrimSpace(bot.Password) != "" {
-		resolved, err := config.ResolveCredential(bot.Password)
+		realname = bot.Name
+	}
+
+	// Resolve the optional server, SASL and NickServ passwords.
+	var password, saslPassword, nickservPassword string
+	for _, cred := range []struct {
+		name  string
+		value string
+		dst   *string
+	}{
+		{"password", bot.Password, &password},
+		{"sasl_password", opts.SASLPassword, &saslPassword},
+		{"nickserv_password", opts.NickServPassword, &nickservPassword},
+	} {
+		if strings.TrimSpace(cred.value) == "" {
+			continue
+		}
+		resolved, err := config.ResolveCredential(cred.value)
 		if err != nil {
-			return nil, fmt.Errorf("resolve irc password for bot %q: %w", bot.Name, err)
+			return nil, fmt.Errorf("resolve irc %s for bot %q: %w", cred.name, bot.Name, err)
 		}
-		password = resolved
+		*cred.dst = resolved
 	}
 
-	// Determine TLS usage from port. Default to TLS on port 6697.
+	// Determine TLS usage from port unless set explicitly. Default to TLS
+	// on port 6697.
 	useTLS := false
 	_, port, err := net.SplitHostPort(endpoint)
 	if err != nil {
@@ -66,17 +105,53 @@ func NewIRCConnector(bot config.BotConfig, publish func(protocol.Event)) (*IRCCo
 	} else if port == defaultIRCSPort {
 		useTLS = true
 	}
+	if opts.TLS != nil {
+		useTLS = *opts.TLS
+	}
+
+	var tlsConfig *tls.Config
+	if useTLS {
+		host, _, _ := net.SplitHostPort(endpoint)
+		tlsConfig = &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: opts.TLSVerify != nil && !*opts.TLSVerify,
+		}
+		if opts.ClientCert != "" {
+			cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+			if err != nil {
+				return nil, fmt.Errorf("load irc client certificate for bot %q: %w", bot.Name, err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
+
+	saslUser := strings.TrimSpace(opts.SASLUser)
+	if saslUser == "" {
+		saslUser = bot.Name
+	}
+
+	proxy, err := proxyFor(bot)
+	if err != nil {
+		return nil, err
+	}
 
 	connector := &IRCConnector{
-		serviceName: bot.Type,
-		botName:     bot.Name,
-		nick:        nick,
-		realname:    realname,
-		endpoint:    endpoint,
-		password:    password,
-		useTLS:      useTLS,
-		publish:     publish,
-		channels:    make(map[string]struct{}),
+		serviceName:      bot.Type,
+		botName:          bot.Name,
+		nicks:            nicks,
+		nick:             bot.Name,
+		realname:         realname,
+		endpoint:         endpoint,
+		password:         password,
+		tlsConfig:        tlsConfig,
+		proxy:            proxy,
+		sasl:             strings.ToLower(strings.TrimSpace(opts.SASL)),
+		saslUser:         saslUser,
+		saslPassword:     saslPassword,
+		nickservPassword: nickservPassword,
+		rejoinOnKick:     opts.RejoinOnKick == nil || *opts.RejoinOnKick,
+		publish:          publish,
+		channels:         make(map[string]struct{}),
 	}
 
 	for _, channel := range bot.Channels {
@@ -124,21 +199,28 @@ func (c *IRCConnector) connectAndRun(ctx context.Context) error {
 
 	dialer := &net.Dialer{Timeout: 15 * time.Second}
 
-	if c.useTLS {
-		host, _, _ := net.SplitHostPort(c.endpoint)
-		conn, err = tls.DialWithDialer(dialer, "tcp", c.endpoint, &tls.Config{
-			ServerName: host,
-		})
-	} else {
-		conn, err = dialer.DialContext(ctx, "tcp", c.endpoint)
-	}
+	conn, err = dialThroughProxy(ctx, c.proxy, dialer, c.endpoint)
 	if err != nil {
 		return fmt.Errorf("dial: %w", err)
 	}
+	if c.tlsConfig != nil {
+		tlsConn := tls.Client(conn, c.tlsConfig)
+		handshakeCtx, cancel := context.WithTimeout(ctx, dialer.Timeout)
+		err = tlsConn.HandshakeContext(handshakeCtx)
+		cancel()
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("dial: %w", err)
+		}
+		conn = tlsConn
+	}
 	defer conn.Close()
 
 	c.mu.Lock()
 	c.conn = conn
+	c.nick, c.nickTry = c.nicks[0], 0
+	c.registered, c.joined = false, false
+	c.failure = nil
 	c.mu.Unlock()
 
 	defer func() {
@@ -147,12 +229,16 @@ func (c *IRCConnector) connectAndRun(ctx context.Context) error {
 		c.mu.Unlock()
 	}()
 
-	// Register with the server.
+	// Register with the server. With SASL, registration stays open until
+	// the CAP negotiation ends.
+	if c.sasl != "" {
+		c.sendRaw("CAP REQ :sasl")
+	}
 	if c.password != "" {
 		c.sendRaw("PASS " + c.password)
 	}
-	c.sendRaw("NICK " + c.nick)
-	c.sendRaw("USER " + c.nick + " 0 * :" + c.realname)
+	c.sendRaw("NICK " + c.nicks[0])
+	c.sendRaw("USER " + c.nicks[0] + " 0 * :" + c.realname)
 
 	log.Printf("[irc:%s] connected to %s", c.botName, c.endpoint)
 	c.publishStatus("connector online")
@@ -179,6 +265,12 @@ func (c *IRCConnector) readLoop(ctx context.Context) error {
 		c.handleLine(line)
 	}
 
+	c.mu.RLock()
+	failure := c.failure
+	c.mu.RUnlock()
+	if failure != nil {
+		return failure
+	}
 	return scanner.Err()
 }
 
@@ -194,8 +286,50 @@ func (c *IRCConnector) handleLine(line string) {
 	prefix, command, params := parseIRCMessage(line)
 
 	switch command {
-	case "001": // RPL_WELCOME - registration complete, join channels.
-		c.joinChannels()
+	case "CAP":
+		c.handleCap(params)
+
+	case "AUTHENTICATE":
+		if len(params) > 0 && params[0] == "+" {
+			c.authenticate()
+		}
+
+	case "903": // RPL_SASLSUCCESS
+		log.Printf("[irc:%s] sasl %s authentication succeeded", c.botName, c.sasl)
+		c.sendRaw("CAP END")
+
+	case "902", "904", "905", "906", "908": // SASL failures
+		reason := command
+		if len(params) > 0 {
+			reason = params[len(params)-1]
+		}
+		c.fail(fmt.Errorf("sasl authentication failed: %s", reason))
+
+	case "001": // RPL_WELCOME - registration complete.
+		c.mu.Lock()
+		c.registered = true
+		if len(params) > 0 {
+			c.nick = params[0]
+		}
+		conn := c.conn
+		c.mu.Unlock()
+		if c.nickservPassword == "" {
+			c.joinChannels(conn)
+			break
+		}
+		// Identify first and join once NickServ confirms (900), or after
+		// a timeout on networks that don't send it.
+		c.sendRaw("PRIVMSG NickServ :IDENTIFY " + c.saslUser + " " + c.nickservPassword)
+		time.AfterFunc(identifyJoinTimeout, func() { c.joinChannels(conn) })
+
+	case "900": // RPL_LOGGEDIN - SASL or NickServ login.
+		log.Printf("[irc:%s] logged in", c.botName)
+		if c.nickservPassword != "" {
+			c.mu.RLock()
+			conn := c.conn
+			c.mu.RUnlock()
+			c.joinChannels(conn)
+		}
 
 	case "PRIVMSG":
 		c.handlePrivmsg(prefix, params)
@@ -203,8 +337,15 @@ func (c *IRCConnector) handleLine(line string) {
 	case "NOTICE":
 		// Notices are logged but not published as messages.
 
+	case "NICK":
+		if extractNick(prefix) == c.Identity() && len(params) > 0 {
+			c.mu.Lock()
+			c.nick = strings.TrimPrefix(params[0], ":")
+			c.mu.Unlock()
+		}
+
 	case "JOIN":
-		if nick := extractNick(prefix); nick == c.nick {
+		if nick := extractNick(prefix); nick == c.Identity() {
 			channel := ""
 			if len(params) > 0 {
 				channel = strings.TrimPrefix(params[0], ":")
@@ -213,16 +354,102 @@ func (c *IRCConnector) handleLine(line string) {
 		}
 
 	case "KICK":
-		if len(params) >= 2 && params[1] == c.nick {
+		if len(params) >= 2 && params[1] == c.Identity() {
 			channel := params[0]
+			if !c.rejoinOnKick {
+				log.Printf("[irc:%s] kicked from %s", c.botName, channel)
+				c.publishStatus("warning: kicked from " + channel)
+				break
+			}
 			log.Printf("[irc:%s] kicked from %s, rejoining", c.botName, channel)
-			c.sendRaw("JOIN " + channel)
+			time.AfterFunc(ircRejoinDelay, func() { c.sendRaw("JOIN " + channel) })
+		}
+
+	case "471", "473", "474", "475": // channel full, invite only, banned, bad key
+		if len(params) >= 3 {
+			log.Printf("[irc:%s] cannot join %s: %s", c.botName, params[1], params[2])
+			c.publishStatus(fmt.Sprintf("warning: cannot join %s: %s", params[1], params[2]))
 		}
 
-	case "433": // ERR_NICKNAMEINUSE
-		log.Printf("[irc:%s] nick %q in use, trying %s_", c.botName, c.nick, c.nick)
-		c.nick = c.nick + "_"
-		c.sendRaw("NICK " + c.nick)
+	case "432", "433", "436": // erroneous nick, nick in use, nick collision
+		c.mu.Lock()
+		taken := c.nick
+		c.nick = c.nextNick()
+		next := c.nick
+		c.mu.Unlock()
+		log.Printf("[irc:%s] nick %q unavailable, trying %s", c.botName, taken, next)
+		c.sendRaw("NICK " + next)
+	}
+}
+
+// nextNick picks the nick to try after the current one was refused: the
+// alternate nicks in order, then the last one with underscores appended.
+// Callers hold c.mu.
+func (c *IRCConnector) nextNick() string {
+	if c.nickTry+1 < len(c.nicks) {
+		c.nickTry++
+		return c.nicks[c.nickTry]
+	}
+	return c.nick + "_"
+}
+
+// handleCap continues SASL negotiation once the server answers CAP REQ.
+func (c *IRCConnector) handleCap(params []string) {
+	if len(params) < 3 || c.sasl == "" {
+		return
+	}
+	caps := strings.Fields(params[2])
+	switch params[1] {
+	case "ACK":
+		for _, capability := range caps {
+			if capability == "sasl" {
+				c.sendRaw("AUTHENTICATE " + strings.ToUpper(c.sasl))
+				return
+			}
+		}
+	case "NAK":
+		c.fail(fmt.Errorf("server does not support sasl"))
+	}
+}
+
+// authenticate answers the server's AUTHENTICATE challenge.
+func (c *IRCConnector) authenticate() {
+	if c.sasl == config.SASLExternal {
+		// The client certificate is the credential.
+		c.sendRaw("AUTHENTICATE +")
+		return
+	}
+	for _, chunk := range saslPlainChunks(c.saslUser, c.saslPassword) {
+		c.sendRaw("AUTHENTICATE " + chunk)
+	}
+}
+
+// saslPlainChunks encodes a SASL PLAIN response as AUTHENTICATE payloads:
+// base64 split into 400-byte chunks, with "+" ending a response whose last
+// chunk is full.
+func saslPlainChunks(user, password string) []string {
+	encoded := base64.StdEncoding.EncodeToString([]byte(user + "\x00" + user + "\x00" + password))
+	var chunks []string
+	for len(encoded) >= 400 {
+		chunks = append(chunks, encoded[:400])
+		encoded = encoded[400:]
+	}
+	if encoded == "" {
+		encoded = "+"
+	}
+	return append(chunks, encoded)
+}
+
+// fail ends the connection with err, so Run reconnects with backoff.
+func (c *IRCConnector) fail(err error) {
+	log.Printf("[irc:%s] %v", c.botName, err)
+	c.mu.Lock()
+	c.failure = err
+	conn := c.conn
+	c.mu.Unlock()
+	c.sendRaw("QUIT")
+	if conn != nil {
+		conn.Close()
 	}
 }
 
@@ -232,7 +459,7 @@ func (c *IRCConnector) handlePrivmsg(prefix string, params []string) {
 	}
 
 	sender := extractNick(prefix)
-	if sender == c.nick {
+	if sender == c.Identity() {
 		return
 	}
 
@@ -269,6 +496,7 @@ func (c *IRCConnector) handlePrivmsg(prefix string, params []string) {
 		Target:    eventTarget,
 		Channel:   channel,
 		Text:      text,
+		Direct:    isDirect,
 	})
 }
 
@@ -335,13 +563,20 @@ func (c *IRCConnector) sendRaw(line string) {
 	}
 }
 
-func (c *IRCConnector) joinChannels() {
-	c.mu.RLock()
+// joinChannels joins the configured channels once conn is registered, and
+// only once per connection.
+func (c *IRCConnector) joinChannels(conn net.Conn) {
+	c.mu.Lock()
+	if conn == nil || c.conn != conn || !c.registered || c.joined {
+		c.mu.Unlock()
+		return
+	}
+	c.joined = true
 	channels := make([]string, 0, len(c.channels))
 	for ch := range c.channels {
 		channels = append(channels, ch)
 	}
-	c.mu.RUnlock()
+	c.mu.Unlock()
 
 	for _, ch := range channels {
 		c.sendRaw("JOIN " + ch)
@@ -422,6 +657,10 @@ func extractNick(prefix string) string {
 	return prefix
 }
 
+// ircMaxText is the text budget of one IRC line: the protocol limits a
+// line to 512 bytes, prefix included.
+const ircMaxText = 400
+
 // prepareIRCSegments converts the message to plain text (IRC has no markup
 // support) and splits it into lines that respect the 512-byte IRC protocol
 // limit.  Newlines in the input produce separate PRIVMSG commands.
@@ -456,7 +695,7 @@ func prepareIRCSegments(format string, text string) ([]string, error) {
 		}
 		// Each IRC line has a 512-byte protocol limit; use 400 runes as
 		// a conservative text budget after prefix overhead.
-		segments = append(segments, formatting.SplitText(line, 400)...)
+		segments = append(segments, formatting.SplitText(line, ircMaxText)...)
 	}
 
 	return segments, nil
@@ -496,6 +735,12 @@ func resolveIRCChannel(request protocol.Request) string {
 	return target
 }
 
+// Capabilities reports that the IRC connector has none of the optional
+// features.
+func (c *IRCConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{MaxText: ircMaxText}
+}
+
 // React is not supported by the IRC connector.
 func (c *IRCConnector) React(_ context.Context, _ protocol.Request) error {
 	return fmt.Errorf("reactions are not supported by the irc connector")
@@ -2,8 +2,10 @@ package upstream
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
@@ -18,26 +20,40 @@ import (
 )
 
 // MatrixConnector bridges a Matrix homeserver account to the PanTalk event
-// stream using the mautrix-go library. It authenticates with an access token
-// and uses the /sync long-poll loop to receive room events. Messages are sent
-// via the client-server REST API.
+// stream using the mautrix-go library. It authenticates with a static access
+// token from the config or, without one, with the session stored by
+// `pantalk pair`, refreshing its token before it expires. It uses the /sync
+// long-poll loop to receive room events. Messages are sent via the
+// client-server REST API.
+// defaultMatrixTimeout bounds every request of a matrix bot, including the
+// sync long poll mautrix holds open for 30s.
+const defaultMatrixTimeout = 180 * time.Second
+
 type MatrixConnector struct {
 	serviceName   string
 	botName       string
 	homeserverURL string
-	accessToken   string
+	auth          *matrixAuth
+	httpOpts      config.HTTPConfig
 	publish       func(protocol.Event)
+	echoes        *echoFilter // nil unless include_self
 
 	mu       sync.RWMutex
 	client   *mautrix.Client
 	channels map[string]struct{}
 	selfUser string
+	direct   map[string]struct{} // rooms the account's m.direct or an is_direct invite marks as DMs
 }
 
 func NewMatrixConnector(bot config.BotConfig, publish func(protocol.Event)) (*MatrixConnector, error) {
-	token, err := config.ResolveCredential(bot.AccessToken)
-	if err != nil {
-		return nil, fmt.Errorf("resolve matrix access_token for bot %q: %w", bot.Name, err)
+	// Without access_token the bot uses the session from pantalk pair.
+	token := ""
+	if strings.TrimSpace(bot.AccessToken) != "" {
+		resolved, err := config.ResolveCredential(bot.AccessToken)
+		if err != nil {
+			return nil, fmt.Errorf("resolve matrix access_token for bot %q: %w", bot.Name, err)
+		}
+		token = resolved
 	}
 
 	homeserver := strings.TrimSpace(bot.Endpoint)
@@ -45,12 +61,25 @@ func NewMatrixConnector(bot config.BotConfig, publish func(protocol.Event)) (*Ma
 		return nil, fmt.Errorf("matrix bot %q requires endpoint (homeserver URL)", bot.Name)
 	}
 
+	proxy, err := proxyFor(bot)
+	if err != nil {
+		return nil, err
+	}
+
+	auth := &matrixAuth{path: MatrixSessionPath(bot)}
+	if token != "" {
+		auth = &matrixAuth{session: &MatrixSession{Homeserver: homeserver, AccessToken: token}}
+	}
+	auth.transport = newTransport(proxy, bot.HTTPOptions())
+
 	connector := &MatrixConnector{
 		serviceName:   bot.Type,
 		botName:       bot.Name,
 		homeserverURL: homeserver,
-		accessToken:   token,
+		auth:          auth,
+		httpOpts:      bot.HTTPOptions(),
 		publish:       publish,
+		echoes:        newEchoFilter(bot.IncludeSelf),
 		channels:      make(map[string]struct{}),
 	}
 
@@ -96,13 +125,37 @@ func (m *MatrixConnector) Run(ctx context.Context) {
 }
 
 func (m *MatrixConnector) connectAndRun(ctx context.Context) error {
-	client, err := mautrix.NewClient(m.homeserverURL, "", m.accessToken)
+	if _, err := m.auth.load(); err != nil {
+		return err
+	}
+	if refreshed, err := m.auth.refresh(ctx, false); err != nil {
+		return err
+	} else if refreshed {
+		log.Printf("[matrix:%s] refreshed access token", m.botName)
+	}
+
+	// The token is added per request by m.auth so it can be refreshed
+	// without restarting the sync loop.
+	client, err := mautrix.NewClient(m.homeserverURL, "", "")
 	if err != nil {
 		return fmt.Errorf("create matrix client: %w", err)
 	}
-
-	// Verify credentials and discover our own user ID.
+	// The sync long poll goes through the same client, so the timeout
+	// covers it; mautrix retries failed requests itself.
+	client.Client = &http.Client{Timeout: m.httpOpts.TimeoutOr(defaultMatrixTimeout), Transport: m.auth}
+	client.DefaultHTTPRetries = m.httpOpts.RetryCount()
+	client.DefaultHTTPBackoff = m.httpOpts.BackoffDuration()
+
+	// Verify credentials and discover our own user ID. A token the server
+	// no longer accepts gets one forced refresh.
 	resp, err := client.Whoami(ctx)
+	if errors.Is(err, mautrix.MUnknownToken) {
+		if refreshed, refreshErr := m.auth.refresh(ctx, true); refreshErr != nil {
+			log.Printf("[matrix:%s] token refresh failed: %v", m.botName, refreshErr)
+		} else if refreshed {
+			resp, err = client.Whoami(ctx)
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("matrix whoami: %w", err)
 	}
@@ -123,6 +176,15 @@ func (m *MatrixConnector) connectAndRun(ctx context.Context) error {
 	syncer.OnEventType(event.EventMessage, func(_ context.Context, evt *event.Event) {
 		m.handleMessage(evt)
 	})
+	syncer.OnEventType(event.EphemeralEventReceipt, func(_ context.Context, evt *event.Event) {
+		m.handleReceipt(evt)
+	})
+	syncer.OnEventType(event.AccountDataDirectChats, func(_ context.Context, evt *event.Event) {
+		m.handleDirectChats(evt)
+	})
+	syncer.OnEventType(event.StateMember, func(_ context.Context, evt *event.Event) {
+		m.handleMembership(evt)
+	})
 
 	// Run the sync loop; blocks until context cancellation or a fatal error.
 	syncCtx, syncCancel := context.WithCancel(ctx)
@@ -136,6 +198,15 @@ func (m *MatrixConnector) connectAndRun(ctx context.Context) error {
 	heartbeatTicker := time.NewTicker(45 * time.Second)
 	defer heartbeatTicker.Stop()
 
+	refreshTimer := time.NewTimer(0)
+	if !refreshTimer.Stop() {
+		<-refreshTimer.C
+	}
+	defer refreshTimer.Stop()
+	if next := m.auth.nextRefresh(); !next.IsZero() {
+		refreshTimer.Reset(time.Until(next))
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -143,22 +214,33 @@ func (m *MatrixConnector) connectAndRun(ctx context.Context) error {
 			client.StopSync()
 			return ctx.Err()
 		case syncErr := <-errCh:
+			if errors.Is(syncErr, mautrix.MUnknownToken) {
+				// Refresh now so the reconnect starts with a valid token.
+				if _, err := m.auth.refresh(ctx, true); err != nil {
+					log.Printf("[matrix:%s] token refresh failed: %v", m.botName, err)
+				}
+			}
 			return fmt.Errorf("sync loop: %w", syncErr)
 		case <-heartbeatTicker.C:
 			m.publishHeartbeat()
+		case <-refreshTimer.C:
+			refreshed, err := m.auth.refresh(ctx, false)
+			if err != nil {
+				syncCancel()
+				client.StopSync()
+				return err
+			}
+			if refreshed {
+				log.Printf("[matrix:%s] refreshed access token", m.botName)
+			}
+			if next := m.auth.nextRefresh(); !next.IsZero() {
+				refreshTimer.Reset(time.Until(next))
+			}
 		}
 	}
 }
 
 func (m *MatrixConnector) handleMessage(evt *event.Event) {
-	// Ignore messages from ourselves.
-	m.mu.RLock()
-	self := m.selfUser
-	m.mu.RUnlock()
-	if string(evt.Sender) == self {
-		return
-	}
-
 	roomID := string(evt.RoomID)
 	if !m.acceptsChannel(roomID) {
 		return
@@ -179,7 +261,7 @@ func (m *MatrixConnector) handleMessage(evt *event.Event) {
 		thread = string(content.RelatesTo.InReplyTo.EventID)
 	}
 
-	m.publish(protocol.Event{
+	message := protocol.Event{
 		Timestamp: time.UnixMilli(evt.Timestamp),
 		Service:   m.serviceName,
 		Bot:       m.botName,
@@ -189,7 +271,102 @@ func (m *MatrixConnector) handleMessage(evt *event.Event) {
 		Target:    "room:" + roomID,
 		Channel:   roomID,
 		Thread:    thread,
+		MessageID: string(evt.ID),
 		Text:      text,
+		Direct:    m.isDirectRoom(roomID),
+	}
+
+	m.mu.RLock()
+	self := m.selfUser
+	m.mu.RUnlock()
+	if string(evt.Sender) == self {
+		message.Direction, message.Direct = "out", false
+		m.echoes.echo(string(evt.ID), func() { m.publish(message) })
+		return
+	}
+
+	m.publish(message)
+}
+
+// handleDirectChats records the rooms listed in the account's m.direct
+// account data.
+func (m *MatrixConnector) handleDirectChats(evt *event.Event) {
+	content, ok := evt.Content.Parsed.(*event.DirectChatsEventContent)
+	if !ok || content == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, rooms := range *content {
+		for _, room := range rooms {
+			m.markDirectLocked(string(room))
+		}
+	}
+}
+
+// handleMembership records rooms the account was invited to as a DM, which
+// clients mark with is_direct on the invite.
+func (m *MatrixConnector) handleMembership(evt *event.Event) {
+	content, ok := evt.Content.Parsed.(*event.MemberEventContent)
+	if !ok || content == nil || !content.IsDirect || evt.StateKey == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if *evt.StateKey == m.selfUser {
+		m.markDirectLocked(string(evt.RoomID))
+	}
+}
+
+func (m *MatrixConnector) markDirectLocked(room string) {
+	if m.direct == nil {
+		m.direct = make(map[string]struct{})
+	}
+	m.direct[room] = struct{}{}
+}
+
+func (m *MatrixConnector) isDirectRoom(room string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.direct[room]
+	return ok
+}
+
+// handleReceipt publishes the account's own read receipts, sent when it
+// reads a room on another client, as read events up to the receipt time.
+func (m *MatrixConnector) handleReceipt(evt *event.Event) {
+	m.mu.RLock()
+	self := id.UserID(m.selfUser)
+	m.mu.RUnlock()
+
+	roomID := string(evt.RoomID)
+	if !m.acceptsChannel(roomID) {
+		return
+	}
+	content, ok := evt.Content.Parsed.(*event.ReceiptEventContent)
+	if !ok || content == nil {
+		return
+	}
+
+	var through time.Time
+	for _, receipts := range *content {
+		for _, receiptType := range []event.ReceiptType{event.ReceiptTypeRead, event.ReceiptTypeReadPrivate} {
+			if receipt, ok := receipts[receiptType][self]; ok && receipt.Timestamp.After(through) {
+				through = receipt.Timestamp
+			}
+		}
+	}
+	if through.IsZero() {
+		return
+	}
+
+	m.publish(protocol.Event{
+		Timestamp: through.UTC(),
+		Service:   m.serviceName,
+		Bot:       m.botName,
+		Kind:      protocol.KindRead,
+		Target:    "room:" + roomID,
+		Channel:   roomID,
 	})
 }
 
@@ -233,6 +410,7 @@ func (m *MatrixConnector) Send(ctx context.Context, request protocol.Request) (p
 		if sendErr != nil {
 			return protocol.Event{}, fmt.Errorf("matrix send: %w", sendErr)
 		}
+		m.echoes.claim(string(resp.EventID))
 
 		target := request.Target
 		if target == "" {
@@ -249,6 +427,7 @@ func (m *MatrixConnector) Send(ctx context.Context, request protocol.Request) (p
 			Target:    target,
 			Channel:   roomID,
 			Thread:    string(resp.EventID),
+			MessageID: string(resp.EventID),
 			Text:      segment.Body,
 		}
 		m.publish(evt)
@@ -325,17 +504,16 @@ func prepareMatrixSegments(format string, text string) ([]matrixOutboundSegment,
 		return nil, fmt.Errorf("text cannot be empty")
 	}
 
-	const maxLen = 60000
 	var segments []matrixOutboundSegment
 
 	switch normalizedFormat {
 	case formatting.FormatPlain:
-		for _, chunk := range formatting.SplitText(trimmed, maxLen) {
+		for _, chunk := range formatting.SplitText(trimmed, matrixMaxText) {
 			segments = append(segments, matrixOutboundSegment{Body: chunk})
 		}
 
 	case formatting.FormatHTML:
-		for _, chunk := range formatting.SplitHTML(trimmed, maxLen) {
+		for _, chunk := range formatting.SplitHTML(trimmed, matrixMaxText) {
 			segments = append(segments, matrixOutboundSegment{
 				Body:          formatting.StripHTML(chunk),
 				Format:        "org.matrix.custom.html",
@@ -348,7 +526,7 @@ func prepareMatrixSegments(format string, text string) ([]matrixOutboundSegment,
 		if convertErr != nil {
 			return nil, fmt.Errorf("convert markdown to matrix html: %w", convertErr)
 		}
-		for _, chunk := range formatting.SplitHTML(htmlText, maxLen) {
+		for _, chunk := range formatting.SplitHTML(htmlText, matrixMaxText) {
 			segments = append(segments, matrixOutboundSegment{
 				Body:          formatting.StripHTML(chunk),
 				Format:        "org.matrix.custom.html",
@@ -415,6 +593,16 @@ func (m *MatrixConnector) resolveChannelNames(ctx context.Context) {
 	}
 }
 
+// matrixMaxText is how much text goes in one Matrix event, well under the
+// 65536-byte event size limit.
+const matrixMaxText = 60000
+
+// Capabilities reports that the Matrix connector has none of the optional
+// features.
+func (m *MatrixConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{MaxText: matrixMaxText}
+}
+
 // React is not supported by the Matrix connector.
 func (m *MatrixConnector) React(_ context.Context, _ protocol.Request) error {
 	return fmt.Errorf("reactions are not supported by the matrix connector")
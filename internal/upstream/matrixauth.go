@@ -0,0 +1,320 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"maunium.net/go/mautrix"
+
+	"github.com/pantalk/pantalk/internal/config"
+)
+
+// matrixRefreshMargin is how long before expiry an access token is
+// refreshed.
+const matrixRefreshMargin = time.Minute
+
+// MatrixSession holds credentials obtained by `pantalk pair` for a Matrix
+// bot without a static access_token. Homeservers using OIDC/SSO issue
+// short-lived access tokens; the refresh token is used to renew them.
+type MatrixSession struct {
+	Homeserver   string    `json:"homeserver"`
+	UserID       string    `json:"user_id"`
+	DeviceID     string    `json:"device_id,omitempty"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"` // zero when the token does not expire
+}
+
+// needsRefresh reports whether the access token expires within margin and
+// can be refreshed.
+func (s *MatrixSession) needsRefresh(now time.Time, margin time.Duration) bool {
+	return s.RefreshToken != "" && !s.ExpiresAt.IsZero() && !now.Add(margin).Before(s.ExpiresAt)
+}
+
+// MatrixSessionPath returns where the session for a Matrix bot is stored:
+// db_path when set, otherwise matrix-<name>.json next to the main database.
+func MatrixSessionPath(bot config.BotConfig) string {
+	if path := strings.TrimSpace(bot.DBPath); path != "" {
+		return path
+	}
+	dataDir := filepath.Dir(config.DefaultDBPath())
+	return filepath.Join(dataDir, fmt.Sprintf("matrix-%s.json", bot.Name))
+}
+
+// LoadMatrixSession reads a stored session. A missing file is reported with
+// os.ErrNotExist.
+func LoadMatrixSession(path string) (*MatrixSession, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var session MatrixSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("parse matrix session %s: %w", path, err)
+	}
+	if session.AccessToken == "" {
+		return nil, fmt.Errorf("matrix session %s has no access token", path)
+	}
+	return &session, nil
+}
+
+// SaveMatrixSession writes the session with owner-only permissions. The file
+// is replaced atomically so a crash never leaves a half-written token.
+func SaveMatrixSession(path string, session *MatrixSession) error {
+	if err := config.EnsureDir(path); err != nil {
+		return fmt.Errorf("create matrix session dir: %w", err)
+	}
+
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode matrix session: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".matrix-session-*")
+	if err != nil {
+		return fmt.Errorf("write matrix session: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write matrix session: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write matrix session: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write matrix session: %w", err)
+	}
+	return nil
+}
+
+// MatrixLoginFlows returns the login types the homeserver offers, e.g.
+// m.login.password and m.login.sso.
+func MatrixLoginFlows(ctx context.Context, homeserver string) ([]string, error) {
+	client, err := mautrix.NewClient(homeserver, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("create matrix client: %w", err)
+	}
+
+	resp, err := client.GetLoginFlows(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("matrix login flows: %w", err)
+	}
+
+	flows := make([]string, 0, len(resp.Flows))
+	for _, flow := range resp.Flows {
+		flows = append(flows, string(flow.Type))
+	}
+	return flows, nil
+}
+
+// MatrixSSOURL returns the URL that starts an SSO login in the browser. The
+// homeserver redirects back to redirectURL with a loginToken parameter.
+func MatrixSSOURL(homeserver string, redirectURL string) string {
+	return strings.TrimRight(homeserver, "/") + "/_matrix/client/v3/login/sso/redirect?redirectUrl=" + url.QueryEscape(redirectURL)
+}
+
+// MatrixPasswordLogin logs in with a user name and password.
+func MatrixPasswordLogin(ctx context.Context, homeserver string, user string, password string) (*MatrixSession, error) {
+	return matrixLogin(ctx, homeserver, &mautrix.ReqLogin{
+		Type:       mautrix.AuthTypePassword,
+		Identifier: mautrix.UserIdentifier{Type: mautrix.IdentifierTypeUser, User: user},
+		Password:   password,
+	})
+}
+
+// MatrixTokenLogin completes an SSO login with the loginToken the homeserver
+// redirected back with.
+func MatrixTokenLogin(ctx context.Context, homeserver string, loginToken string) (*MatrixSession, error) {
+	return matrixLogin(ctx, homeserver, &mautrix.ReqLogin{
+		Type:  mautrix.AuthTypeToken,
+		Token: loginToken,
+	})
+}
+
+func matrixLogin(ctx context.Context, homeserver string, req *mautrix.ReqLogin) (*MatrixSession, error) {
+	client, err := mautrix.NewClient(homeserver, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("create matrix client: %w", err)
+	}
+
+	req.InitialDeviceDisplayName = "pantalk"
+	req.RefreshToken = true
+
+	resp, err := client.Login(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("matrix login: %w", err)
+	}
+
+	session := &MatrixSession{
+		Homeserver:   homeserver,
+		UserID:       string(resp.UserID),
+		DeviceID:     string(resp.DeviceID),
+		AccessToken:  resp.AccessToken,
+		RefreshToken: resp.RefreshToken,
+	}
+	if resp.ExpiresInMS > 0 {
+		session.ExpiresAt = time.Now().UTC().Add(time.Duration(resp.ExpiresInMS) * time.Millisecond)
+	}
+	return session, nil
+}
+
+type matrixRefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type matrixRefreshResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresInMS  int64  `json:"expires_in_ms,omitempty"`
+}
+
+// refreshMatrixSession exchanges the refresh token for a new access token.
+// The homeserver may rotate the refresh token too; the old one stays valid
+// only when it doesn't.
+func refreshMatrixSession(ctx context.Context, session *MatrixSession, transport http.RoundTripper) (*MatrixSession, error) {
+	if session.RefreshToken == "" {
+		return nil, fmt.Errorf("matrix session has no refresh token - run pantalk pair again")
+	}
+
+	client, err := mautrix.NewClient(session.Homeserver, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("create matrix client: %w", err)
+	}
+	if transport != nil {
+		client.Client = &http.Client{Timeout: 180 * time.Second, Transport: transport}
+	}
+
+	var resp matrixRefreshResponse
+	_, err = client.MakeFullRequest(ctx, mautrix.FullRequest{
+		Method:           http.MethodPost,
+		URL:              client.BuildClientURL("v3", "refresh"),
+		RequestJSON:      matrixRefreshRequest{RefreshToken: session.RefreshToken},
+		ResponseJSON:     &resp,
+		SensitiveContent: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("matrix token refresh: %w", err)
+	}
+	if resp.AccessToken == "" {
+		return nil, fmt.Errorf("matrix token refresh: no access token in response")
+	}
+
+	refreshed := *session
+	refreshed.AccessToken = resp.AccessToken
+	if resp.RefreshToken != "" {
+		refreshed.RefreshToken = resp.RefreshToken
+	}
+	refreshed.ExpiresAt = time.Time{}
+	if resp.ExpiresInMS > 0 {
+		refreshed.ExpiresAt = time.Now().UTC().Add(time.Duration(resp.ExpiresInMS) * time.Millisecond)
+	}
+	return &refreshed, nil
+}
+
+// matrixAuth supplies the current access token to every request, so a
+// refreshed token takes effect without restarting the sync loop. Static
+// tokens from the config never change.
+type matrixAuth struct {
+	path      string            // session file; empty for a static access_token
+	transport http.RoundTripper // nil is http.DefaultTransport
+
+	mu      sync.Mutex
+	session *MatrixSession
+}
+
+func (a *matrixAuth) token() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.session == nil {
+		return ""
+	}
+	return a.session.AccessToken
+}
+
+// load reads the stored session on first use, so pairing after the daemon
+// started only needs a reload or reconnect.
+func (a *matrixAuth) load() (*MatrixSession, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.session != nil {
+		return a.session, nil
+	}
+	session, err := LoadMatrixSession(a.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no matrix session at %s - run pantalk pair --bot NAME", a.path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.session = session
+	return session, nil
+}
+
+// refresh renews the access token and persists the result. With force it
+// refreshes even if the token is not near expiry, e.g. after the server
+// rejected it.
+func (a *matrixAuth) refresh(ctx context.Context, force bool) (bool, error) {
+	if a.path == "" {
+		return false, nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	session := a.session
+	if session == nil || session.RefreshToken == "" {
+		return false, nil
+	}
+	if !force && !session.needsRefresh(time.Now(), matrixRefreshMargin) {
+		return false, nil
+	}
+
+	refreshed, err := refreshMatrixSession(ctx, session, a.transport)
+	if err != nil {
+		return false, err
+	}
+	if err := SaveMatrixSession(a.path, refreshed); err != nil {
+		return false, err
+	}
+	a.session = refreshed
+	return true, nil
+}
+
+// nextRefresh returns when the token should be refreshed, or zero if it
+// doesn't expire.
+func (a *matrixAuth) nextRefresh() time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.path == "" || a.session == nil || a.session.RefreshToken == "" || a.session.ExpiresAt.IsZero() {
+		return time.Time{}
+	}
+	return a.session.ExpiresAt.Add(-matrixRefreshMargin)
+}
+
+// RoundTrip adds the current access token to requests mautrix sends without
+// one.
+func (a *matrixAuth) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") == "" {
+		if token := a.token(); token != "" {
+			req = req.Clone(req.Context())
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	if a.transport != nil {
+		return a.transport.RoundTrip(req)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
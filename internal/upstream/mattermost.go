@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
@@ -23,14 +24,19 @@ type MattermostConnector struct {
 	serviceName string
 	botName     string
 	endpoint    string
-	token       string
 	publish     func(protocol.Event)
 	httpClient  *http.Client
-
-	mu       sync.RWMutex
-	channels map[string]struct{}
-	selfUser string
-	nextSeq  int64
+	dialer      *websocket.Dialer // nil dials directly
+	echoes      *echoFilter       // nil unless include_self
+
+	mu           sync.RWMutex
+	token        string
+	channels     map[string]struct{}
+	selfUser     string
+	selfNames    []string // username and nickname, for mention matching
+	nextSeq      int64
+	actionURL    string // callback URL for message actions, see SetActionEndpoint
+	actionSecret string
 }
 
 type mmPost struct {
@@ -40,18 +46,35 @@ type mmPost struct {
 	RootID    string `json:"root_id"`
 	UserID    string `json:"user_id"`
 	CreateAt  int64  `json:"create_at"`
+	EditAt    int64  `json:"edit_at"`
+	DeleteAt  int64  `json:"delete_at"`
+}
+
+type mmReaction struct {
+	UserID    string `json:"user_id"`
+	PostID    string `json:"post_id"`
+	EmojiName string `json:"emoji_name"`
+	CreateAt  int64  `json:"create_at"`
 }
 
 type mmCreatePostRequest struct {
-	ChannelID string `json:"channel_id"`
-	Message   string `json:"message"`
-	RootID    string `json:"root_id,omitempty"`
+	ChannelID string         `json:"channel_id"`
+	Message   string         `json:"message"`
+	RootID    string         `json:"root_id,omitempty"`
+	Props     map[string]any `json:"props,omitempty"`
 }
 
 type mmWebSocketEvent struct {
-	Event string                 `json:"event"`
-	Data  map[string]interface{} `json:"data"`
-	Seq   int64                  `json:"seq"`
+	Event     string                 `json:"event"`
+	Data      map[string]interface{} `json:"data"`
+	Broadcast mmBroadcast            `json:"broadcast"`
+	Seq       int64                  `json:"seq"`
+}
+
+// mmBroadcast says who a websocket event was sent to; reactions only carry
+// their channel here.
+type mmBroadcast struct {
+	ChannelID string `json:"channel_id"`
 }
 
 type mmWebSocketClientMessage struct {
@@ -61,7 +84,9 @@ type mmWebSocketClientMessage struct {
 }
 
 type mmUser struct {
-	ID string `json:"id"`
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Nickname string `json:"nickname"`
 }
 
 func NewMattermostConnector(bot config.BotConfig, publish func(protocol.Event)) (*MattermostConnector, error) {
@@ -70,13 +95,20 @@ func NewMattermostConnector(bot config.BotConfig, publish func(protocol.Event))
 		return nil, fmt.Errorf("resolve mattermost bot_token for bot %q: %w", bot.Name, err)
 	}
 
+	proxy, err := proxyFor(bot)
+	if err != nil {
+		return nil, err
+	}
+
 	connector := &MattermostConnector{
 		serviceName: bot.Type,
 		botName:     bot.Name,
 		endpoint:    strings.TrimRight(strings.TrimSpace(bot.Endpoint), "/"),
 		token:       token,
 		publish:     publish,
-		httpClient:  &http.Client{Timeout: 20 * time.Second},
+		httpClient:  newHTTPClient(proxy, bot.HTTPOptions(), 20*time.Second),
+		dialer:      newProxyDialer(proxy),
+		echoes:      newEchoFilter(bot.IncludeSelf),
 		channels:    make(map[string]struct{}),
 	}
 
@@ -143,11 +175,14 @@ func (m *MattermostConnector) Send(ctx context.Context, request protocol.Request
 	}
 
 	var lastEvent protocol.Event
-	for _, segmentText := range segments {
+	for i, segmentText := range segments {
 		bodyPayload := mmCreatePostRequest{ChannelID: channel, Message: segmentText}
 		if request.Thread != "" {
 			bodyPayload.RootID = request.Thread
 		}
+		if request.Interactive != nil && i == len(segments)-1 {
+			bodyPayload.Props = m.mattermostActionProps(request.Interactive)
+		}
 
 		body, marshalErr := json.Marshal(bodyPayload)
 		if marshalErr != nil {
@@ -158,7 +193,7 @@ func (m *MattermostConnector) Send(ctx context.Context, request protocol.Request
 		if reqErr != nil {
 			return protocol.Event{}, reqErr
 		}
-		httpReq.Header.Set("Authorization", "Bearer "+m.token)
+		httpReq.Header.Set("Authorization", "Bearer "+m.authToken())
 		httpReq.Header.Set("Content-Type", "application/json")
 
 		resp, doErr := m.httpClient.Do(httpReq)
@@ -168,7 +203,7 @@ func (m *MattermostConnector) Send(ctx context.Context, request protocol.Request
 
 		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 			resp.Body.Close()
-			return protocol.Event{}, fmt.Errorf("mattermost post failed: status %d", resp.StatusCode)
+			return protocol.Event{}, statusError("mattermost post", resp.StatusCode)
 		}
 
 		var posted mmPost
@@ -177,6 +212,7 @@ func (m *MattermostConnector) Send(ctx context.Context, request protocol.Request
 		if decodeErr != nil {
 			return protocol.Event{}, decodeErr
 		}
+		m.echoes.claim(posted.ID)
 
 		target := request.Target
 		if target == "" {
@@ -193,6 +229,7 @@ func (m *MattermostConnector) Send(ctx context.Context, request protocol.Request
 			Target:    target,
 			Channel:   posted.ChannelID,
 			Thread:    posted.RootID,
+			MessageID: posted.ID,
 			Text:      segmentText,
 		}
 		m.publish(event)
@@ -258,9 +295,13 @@ func (m *MattermostConnector) openWebsocket(_ context.Context) (*websocket.Conn,
 	}
 
 	header := http.Header{}
-	header.Set("Authorization", "Bearer "+m.token)
+	header.Set("Authorization", "Bearer "+m.authToken())
 
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL.String(), header)
+	dialer := m.dialer
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+	conn, _, err := dialer.Dial(wsURL.String(), header)
 	if err != nil {
 		return nil, err
 	}
@@ -273,7 +314,7 @@ func (m *MattermostConnector) authenticateWebsocket(conn *websocket.Conn) error
 	msg := mmWebSocketClientMessage{
 		Action: "authentication_challenge",
 		Seq:    m.nextSequence(),
-		Data:   map[string]interface{}{"token": m.token},
+		Data:   map[string]interface{}{"token": m.authToken()},
 	}
 	return conn.WriteJSON(msg)
 }
@@ -292,29 +333,31 @@ func (m *MattermostConnector) readWebsocketLoop(ctx context.Context, conn *webso
 			return
 		}
 
-		if wsEvent.Event != "posted" {
-			continue
+		if event, ok := m.websocketEvent(wsEvent); ok {
+			m.publish(event)
 		}
-
-		postRaw, ok := wsEvent.Data["post"].(string)
-		if !ok || strings.TrimSpace(postRaw) == "" {
-			continue
+		for _, marker := range m.readMarkers(wsEvent) {
+			m.publish(marker)
 		}
+	}
+}
 
+// websocketEvent converts a websocket event to a protocol event: new posts
+// become messages, and edits, deletions and added reactions the lifecycle
+// kinds. ok is false for other events, the bot's own, and unwatched
+// channels; new posts of the bot's own are handed to the echo filter.
+func (m *MattermostConnector) websocketEvent(wsEvent mmWebSocketEvent) (protocol.Event, bool) {
+	switch wsEvent.Event {
+	case "posted", "post_edited", "post_deleted":
 		var post mmPost
-		if err := json.Unmarshal([]byte(postRaw), &post); err != nil {
-			continue
-		}
-
-		if m.isSelfUser(post.UserID) {
-			continue
+		if !decodeMattermostData(wsEvent.Data, "post", &post) {
+			return protocol.Event{}, false
 		}
-
 		if !m.acceptsChannel(post.ChannelID) {
-			continue
+			return protocol.Event{}, false
 		}
 
-		protocolEvent := protocol.Event{
+		event := protocol.Event{
 			Timestamp: time.UnixMilli(post.CreateAt).UTC(),
 			Service:   m.serviceName,
 			Bot:       m.botName,
@@ -324,40 +367,188 @@ func (m *MattermostConnector) readWebsocketLoop(ctx context.Context, conn *webso
 			Target:    "channel:" + post.ChannelID,
 			Channel:   post.ChannelID,
 			Thread:    post.RootID,
+			MessageID: post.ID,
 			Text:      post.Message,
+			Direct:    mattermostDirect(wsEvent.Data),
+		}
+		if m.isSelfUser(post.UserID) {
+			if wsEvent.Event == "posted" {
+				event.Direction, event.Direct = "out", false
+				m.echoes.echo(post.ID, func() { m.publish(event) })
+			}
+			return protocol.Event{}, false
 		}
+		switch wsEvent.Event {
+		case "post_edited":
+			event.Kind, event.Target = protocol.KindEdit, "post:"+post.ID
+			event.Timestamp = mattermostTime(post.EditAt)
+		case "post_deleted":
+			event.Kind, event.Target, event.Text = protocol.KindDelete, "post:"+post.ID, ""
+			event.Timestamp = mattermostTime(post.DeleteAt)
+		}
+		return event, true
+
+	case "reaction_added":
+		var reaction mmReaction
+		if !decodeMattermostData(wsEvent.Data, "reaction", &reaction) {
+			return protocol.Event{}, false
+		}
+		channel := wsEvent.Broadcast.ChannelID
+		if m.isSelfUser(reaction.UserID) || !m.acceptsChannel(channel) {
+			return protocol.Event{}, false
+		}
+
+		return protocol.Event{
+			Timestamp: mattermostTime(reaction.CreateAt),
+			Service:   m.serviceName,
+			Bot:       m.botName,
+			Kind:      protocol.KindReaction,
+			Direction: "in",
+			User:      reaction.UserID,
+			Target:    "post:" + reaction.PostID,
+			Channel:   channel,
+			MessageID: reaction.PostID,
+			Text:      reaction.EmojiName,
+		}, true
+	}
+	return protocol.Event{}, false
+}
+
+// readMarkers converts the account viewing channels on another client
+// (channel_viewed, or multiple_channels_viewed on newer servers) to read
+// events.
+func (m *MattermostConnector) readMarkers(wsEvent mmWebSocketEvent) []protocol.Event {
+	viewed := make(map[string]time.Time)
+	switch wsEvent.Event {
+	case "channel_viewed":
+		if channel, ok := wsEvent.Data["channel_id"].(string); ok {
+			viewed[channel] = time.Now().UTC()
+		}
+	case "multiple_channels_viewed":
+		times, _ := wsEvent.Data["channel_times"].(map[string]interface{})
+		for channel, at := range times {
+			ms, _ := at.(float64)
+			viewed[channel] = mattermostTime(int64(ms))
+		}
+	}
+
+	var events []protocol.Event
+	for channel, at := range viewed {
+		if channel == "" || !m.acceptsChannel(channel) {
+			continue
+		}
+		events = append(events, protocol.Event{
+			Timestamp: at,
+			Service:   m.serviceName,
+			Bot:       m.botName,
+			Kind:      protocol.KindRead,
+			Target:    "channel:" + channel,
+			Channel:   channel,
+		})
+	}
+	return events
+}
 
-		m.publish(protocolEvent)
+// decodeMattermostData decodes the JSON string Mattermost sends as
+// data[key] of a websocket event.
+func decodeMattermostData(data map[string]interface{}, key string, v any) bool {
+	raw, ok := data[key].(string)
+	if !ok || strings.TrimSpace(raw) == "" {
+		return false
 	}
+	return json.Unmarshal([]byte(raw), v) == nil
+}
+
+// mattermostDirect reports whether a posted event is in a direct ("D") or
+// group message ("G") channel.
+func mattermostDirect(data map[string]interface{}) bool {
+	channelType, _ := data["channel_type"].(string)
+	return channelType == "D" || channelType == "G"
+}
+
+// mattermostTime converts a Mattermost millisecond timestamp, using now
+// when it is unset.
+func mattermostTime(ms int64) time.Time {
+	if ms == 0 {
+		return time.Now().UTC()
+	}
+	return time.UnixMilli(ms).UTC()
 }
 
 func (m *MattermostConnector) loadSelfUser(ctx context.Context) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.endpoint+"/api/v4/users/me", nil)
+	user, err := m.getMe(ctx)
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Authorization", "Bearer "+m.token)
 
-	resp, err := m.httpClient.Do(req)
+	m.mu.Lock()
+	m.selfUser = user.ID
+	m.selfNames = []string{user.Username, user.Nickname}
+	m.mu.Unlock()
+
+	return nil
+}
+
+// authToken returns the token API calls authenticate with.
+func (m *MattermostConnector) authToken() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.token
+}
+
+// RotateToken implements TokenRotator. The new token must belong to the
+// bot's account. The websocket stays on its session and authenticates
+// with the new token when it reconnects.
+func (m *MattermostConnector) RotateToken(ctx context.Context, token string) error {
+	user, err := m.getMeWith(ctx, token)
 	if err != nil {
 		return err
 	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.selfUser != "" && user.ID != m.selfUser {
+		return fmt.Errorf("new token belongs to %s (%s), not the bot's account %s", user.Username, user.ID, m.selfUser)
+	}
+	m.token = token
+	return nil
+}
+
+func (m *MattermostConnector) getMe(ctx context.Context) (mmUser, error) {
+	return m.getMeWith(ctx, m.authToken())
+}
+
+func (m *MattermostConnector) getMeWith(ctx context.Context, token string) (mmUser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.endpoint+"/api/v4/users/me", nil)
+	if err != nil {
+		return mmUser{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return mmUser{}, err
+	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("users/me failed: status %d", resp.StatusCode)
+		return mmUser{}, fmt.Errorf("users/me failed: status %d", resp.StatusCode)
 	}
 
 	var user mmUser
 	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
-		return err
+		return mmUser{}, err
 	}
+	return user, nil
+}
 
-	m.mu.Lock()
-	m.selfUser = user.ID
-	m.mu.Unlock()
-
-	return nil
+// Verify implements Verifier with users/me.
+func (m *MattermostConnector) Verify(ctx context.Context) (Verification, error) {
+	user, err := m.getMe(ctx)
+	if err != nil {
+		return Verification{}, err
+	}
+	return Verification{User: user.Username, UserID: user.ID, Team: m.endpoint}, nil
 }
 
 func (m *MattermostConnector) publishStatus(text string) {
@@ -413,6 +604,13 @@ func (m *MattermostConnector) Identity() string {
 	return m.selfUser
 }
 
+// MentionNames returns the account's username and nickname.
+func (m *MattermostConnector) MentionNames() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.selfNames
+}
+
 func (m *MattermostConnector) isSelfUser(userID string) bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -438,6 +636,10 @@ func resolveMattermostChannel(request protocol.Request) string {
 	return target
 }
 
+// mattermostMaxText is how much text goes in one Mattermost post, under the
+// server's 16383-character limit; longer text is split.
+const mattermostMaxText = 12000
+
 func prepareMattermostSegments(format string, text string) ([]string, error) {
 	normalizedFormat, err := formatting.NormalizeFormat(format)
 	if err != nil {
@@ -454,7 +656,7 @@ func prepareMattermostSegments(format string, text string) ([]string, error) {
 		trimmed = formatting.StripHTML(trimmed)
 	}
 
-	return formatting.SplitText(trimmed, 12000), nil
+	return formatting.SplitText(trimmed, mattermostMaxText), nil
 }
 
 // resolveChannelNames resolves any friendly channel names (e.g. "town-square",
@@ -480,22 +682,27 @@ func (m *MattermostConnector) resolveChannelNames(ctx context.Context) {
 		return
 	}
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	resolvedIDs := make(map[string]string, len(toResolve))
 	for _, name := range toResolve {
-		resolved := false
 		for _, teamID := range teamIDs {
 			if channelID, err := m.getChannelByName(ctx, teamID, name); err == nil {
-				delete(m.channels, name)
-				m.channels[channelID] = struct{}{}
-				log.Printf("[mattermost:%s] resolved channel %q → %s", m.botName, name, channelID)
-				resolved = true
+				resolvedIDs[name] = channelID
 				break
 			}
 		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range toResolve {
+		channelID, resolved := resolvedIDs[name]
 		if !resolved {
 			log.Printf("[mattermost:%s] could not resolve channel %q – keeping as-is", m.botName, name)
+			continue
 		}
+		delete(m.channels, name)
+		m.channels[channelID] = struct{}{}
+		log.Printf("[mattermost:%s] resolved channel %q → %s", m.botName, name, channelID)
 	}
 }
 
@@ -504,7 +711,7 @@ func (m *MattermostConnector) getTeamIDs(ctx context.Context) ([]string, error)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", "Bearer "+m.token)
+	req.Header.Set("Authorization", "Bearer "+m.authToken())
 
 	resp, err := m.httpClient.Do(req)
 	if err != nil {
@@ -536,7 +743,7 @@ func (m *MattermostConnector) getChannelByName(ctx context.Context, teamID, name
 	if err != nil {
 		return "", err
 	}
-	req.Header.Set("Authorization", "Bearer "+m.token)
+	req.Header.Set("Authorization", "Bearer "+m.authToken())
 
 	resp, err := m.httpClient.Do(req)
 	if err != nil {
@@ -571,6 +778,203 @@ func isMattermostChannelID(s string) bool {
 	return true
 }
 
+type mmViewChannelRequest struct {
+	ChannelID string `json:"channel_id"`
+}
+
+// MarkRead views channel as the bot user, which marks everything in it read.
+// Mattermost keeps no per-post read state, so through is ignored.
+func (m *MattermostConnector) MarkRead(ctx context.Context, channel string, _ time.Time) error {
+	if err := m.callJSON(ctx, http.MethodPost, "/api/v4/channels/members/me/view", mmViewChannelRequest{ChannelID: channel}, nil); err != nil {
+		return fmt.Errorf("mattermost view channel: %w", err)
+	}
+	return nil
+}
+
+type mmStatusRequest struct {
+	UserID string `json:"user_id"`
+	Status string `json:"status"`
+}
+
+type mmCustomStatusRequest struct {
+	Text string `json:"text"`
+}
+
+// SetPresence sets the bot user's status (online, away, dnd) and custom
+// status text. An empty text removes the custom status.
+func (m *MattermostConnector) SetPresence(ctx context.Context, presence protocol.Presence) error {
+	if presence.State != "" {
+		userID, err := m.selfUserID()
+		if err != nil {
+			return err
+		}
+		if err := m.callJSON(ctx, http.MethodPut, "/api/v4/users/"+url.PathEscape(userID)+"/status", mmStatusRequest{UserID: userID, Status: presence.State}, nil); err != nil {
+			return fmt.Errorf("mattermost set status: %w", err)
+		}
+	}
+	if presence.Status != nil {
+		var err error
+		if *presence.Status == "" {
+			err = m.callJSON(ctx, http.MethodDelete, "/api/v4/users/me/status/custom", nil, nil)
+		} else {
+			err = m.callJSON(ctx, http.MethodPut, "/api/v4/users/me/status/custom", mmCustomStatusRequest{Text: *presence.Status}, nil)
+		}
+		if err != nil {
+			return fmt.Errorf("mattermost set custom status: %w", err)
+		}
+	}
+	return nil
+}
+
+type mmChannelMemberRequest struct {
+	UserID string `json:"user_id"`
+}
+
+type mmCreateChannelRequest struct {
+	TeamID      string `json:"team_id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Type        string `json:"type"` // "O" open, "P" private
+}
+
+func (m *MattermostConnector) JoinChannel(ctx context.Context, channel string) error {
+	userID, err := m.selfUserID()
+	if err != nil {
+		return err
+	}
+	if err := m.callJSON(ctx, http.MethodPost, "/api/v4/channels/"+url.PathEscape(channel)+"/members", mmChannelMemberRequest{UserID: userID}, nil); err != nil {
+		return fmt.Errorf("mattermost join channel: %w", err)
+	}
+	m.rememberChannel(channel)
+	return nil
+}
+
+func (m *MattermostConnector) LeaveChannel(ctx context.Context, channel string) error {
+	userID, err := m.selfUserID()
+	if err != nil {
+		return err
+	}
+	if err := m.callJSON(ctx, http.MethodDelete, "/api/v4/channels/"+url.PathEscape(channel)+"/members/"+url.PathEscape(userID), nil, nil); err != nil {
+		return fmt.Errorf("mattermost leave channel: %w", err)
+	}
+	return nil
+}
+
+// CreateChannel creates a channel in team, or in the bot's only team when
+// team is empty. name becomes the display name; the URL name is derived
+// from it.
+func (m *MattermostConnector) CreateChannel(ctx context.Context, name string, private bool, team string) (string, error) {
+	if team == "" {
+		teams, err := m.getTeamIDs(ctx)
+		if err != nil {
+			return "", fmt.Errorf("mattermost create channel: %w", err)
+		}
+		if len(teams) != 1 {
+			return "", fmt.Errorf("mattermost bot is in %d teams; pass the team ID as the target", len(teams))
+		}
+		team = teams[0]
+	}
+
+	req := mmCreateChannelRequest{TeamID: team, Name: mattermostChannelName(name), DisplayName: name, Type: "O"}
+	if private {
+		req.Type = "P"
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := m.callJSON(ctx, http.MethodPost, "/api/v4/channels", req, &created); err != nil {
+		return "", fmt.Errorf("mattermost create channel: %w", err)
+	}
+	m.rememberChannel(created.ID)
+	return created.ID, nil
+}
+
+func (m *MattermostConnector) InviteToChannel(ctx context.Context, channel string, users []string) error {
+	for _, user := range users {
+		if err := m.callJSON(ctx, http.MethodPost, "/api/v4/channels/"+url.PathEscape(channel)+"/members", mmChannelMemberRequest{UserID: user}, nil); err != nil {
+			return fmt.Errorf("mattermost add %s to channel: %w", user, err)
+		}
+	}
+	return nil
+}
+
+func (m *MattermostConnector) selfUserID() (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.selfUser == "" {
+		return "", fmt.Errorf("mattermost user not authenticated yet")
+	}
+	return m.selfUser, nil
+}
+
+// mattermostChannelName turns a display name into a channel URL name:
+// lowercase letters, digits, '-' and '_'.
+func mattermostChannelName(display string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(display)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			b.WriteRune(r)
+		case r == ' ' || r == '.':
+			b.WriteByte('-')
+		}
+	}
+	return strings.Trim(b.String(), "-_")
+}
+
+// callJSON sends payload (nil for none) to the Mattermost API, checks the
+// status code and decodes the response into result unless it is nil.
+func (m *MattermostConnector) callJSON(ctx context.Context, method string, path string, payload any, result any) error {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, m.endpoint+path, body)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+m.authToken())
+	if payload != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := m.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+// Capabilities reports Mattermost's features. Interactive messages need
+// the daemon's HTTP API; see interactiveEnabled.
+func (m *MattermostConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{
+		Threads:     true,
+		Interactive: m.interactiveEnabled(),
+		MarkRead:    true,
+		Presence:    true,
+		Channels:    true,
+		MaxText:     mattermostMaxText,
+	}
+}
+
+// SendsWithoutSession implements SessionlessSender: posts go through the
+// REST API; the websocket only receives.
+func (m *MattermostConnector) SendsWithoutSession() {}
+
 // React is not supported by the Mattermost connector.
 func (m *MattermostConnector) React(_ context.Context, _ protocol.Request) error {
 	return fmt.Errorf("reactions are not supported by the mattermost connector")
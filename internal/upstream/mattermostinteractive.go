@@ -0,0 +1,169 @@
+package upstream
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// mmActionRequest is the callback Mattermost posts to an action's
+// integration URL when a button is clicked or an option selected.
+type mmActionRequest struct {
+	UserID    string         `json:"user_id"`
+	ChannelID string         `json:"channel_id"`
+	PostID    string         `json:"post_id"`
+	Context   map[string]any `json:"context"`
+}
+
+// SetActionEndpoint sets the URL Mattermost calls back on clicks and the
+// secret the callbacks must carry. Without it, interactive sends are
+// refused.
+func (m *MattermostConnector) SetActionEndpoint(url string, secret string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.actionURL = url
+	m.actionSecret = secret
+}
+
+// interactiveEnabled reports whether message actions can be used, which
+// needs the daemon's HTTP API for the callbacks.
+func (m *MattermostConnector) interactiveEnabled() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.actionURL != ""
+}
+
+// mattermostActionProps renders the buttons and select menu as message
+// actions in an attachment. Each action calls back with its value and the
+// secret in the integration context, which Mattermost keeps from clients.
+func (m *MattermostConnector) mattermostActionProps(interactive *protocol.Interactive) map[string]any {
+	m.mu.RLock()
+	actionURL, secret := m.actionURL, m.actionSecret
+	m.mu.RUnlock()
+
+	integration := func(value string) map[string]any {
+		ctx := map[string]any{"secret": secret}
+		if value != "" {
+			ctx["value"] = value
+		}
+		return map[string]any{"url": actionURL, "context": ctx}
+	}
+
+	actions := make([]map[string]any, 0, len(interactive.Buttons)+1)
+	for i, button := range interactive.Buttons {
+		style := "default"
+		if button.Style != "" {
+			style = button.Style
+		}
+		actions = append(actions, map[string]any{
+			"id":          "pantalk" + strconv.Itoa(i),
+			"type":        "button",
+			"name":        button.Label,
+			"style":       style,
+			"integration": integration(button.Value),
+		})
+	}
+	if sel := interactive.Select; sel != nil && len(sel.Options) > 0 {
+		options := make([]map[string]string, 0, len(sel.Options))
+		for _, option := range sel.Options {
+			options = append(options, map[string]string{"text": option.Label, "value": option.Value})
+		}
+		// The chosen value arrives as selected_option in the context.
+		actions = append(actions, map[string]any{
+			"id":          "pantalkselect",
+			"type":        "select",
+			"name":        selectPlaceholder(sel),
+			"options":     options,
+			"integration": integration(""),
+		})
+	}
+
+	return map[string]any{
+		"attachments": []map[string]any{{"actions": actions}},
+	}
+}
+
+// HandleAction publishes a click that Mattermost reported to the action
+// callback. Callbacks without the secret are rejected.
+func (m *MattermostConnector) HandleAction(ctx context.Context, body []byte) error {
+	var action mmActionRequest
+	if err := json.Unmarshal(body, &action); err != nil {
+		return fmt.Errorf("decode action: %w", err)
+	}
+
+	m.mu.RLock()
+	secret := m.actionSecret
+	m.mu.RUnlock()
+
+	got, _ := action.Context["secret"].(string)
+	if secret == "" || subtle.ConstantTimeCompare([]byte(got), []byte(secret)) != 1 {
+		return fmt.Errorf("action callback has an invalid secret")
+	}
+
+	value, _ := action.Context["selected_option"].(string)
+	if value == "" {
+		value, _ = action.Context["value"].(string)
+	}
+	if value == "" || action.ChannelID == "" {
+		return fmt.Errorf("action callback has no value or channel")
+	}
+	if !m.acceptsChannel(action.ChannelID) {
+		return nil
+	}
+
+	// The callback doesn't say which thread the post is in.
+	thread, err := m.postRootID(ctx, action.PostID)
+	if err != nil {
+		return fmt.Errorf("look up post %s: %w", action.PostID, err)
+	}
+
+	m.publish(protocol.Event{
+		Timestamp: time.Now().UTC(),
+		Service:   m.serviceName,
+		Bot:       m.botName,
+		Kind:      protocol.KindInteraction,
+		Direction: "in",
+		User:      action.UserID,
+		Target:    "channel:" + action.ChannelID,
+		Channel:   action.ChannelID,
+		Thread:    thread,
+		MessageID: action.PostID,
+		Text:      value,
+	})
+	return nil
+}
+
+func (m *MattermostConnector) postRootID(ctx context.Context, postID string) (string, error) {
+	if postID == "" {
+		return "", nil
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, m.endpoint+"/api/v4/posts/"+url.PathEscape(postID), nil)
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+m.authToken())
+
+	resp, err := m.httpClient.Do(httpReq)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	var post mmPost
+	if err := json.NewDecoder(resp.Body).Decode(&post); err != nil {
+		return "", err
+	}
+	return post.RootID, nil
+}
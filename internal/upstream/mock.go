@@ -2,17 +2,40 @@ package upstream
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/pantalk/pantalk/internal/config"
 	"github.com/pantalk/pantalk/internal/protocol"
 )
 
+// mockUser is who scripted and injected messages come from by default.
+const mockUser = "mock-user"
+
+// mockReplyDelay is how long the mock waits before answering a send.
+const mockReplyDelay = 300 * time.Millisecond
+
+// MockConnector stands in for a platform. It echoes what is sent through
+// it and, for type: mock bots, answers from a scenario and accepts inbound
+// messages over HTTP.
 type MockConnector struct {
 	service string
 	bot     string
 	publish func(protocol.Event)
+
+	scenario config.MockScenario
+	silent   bool   // don't echo sends that no scenario reply matches
+	listen   string // address of the inject endpoint, if any
+
+	lastID atomic.Int64 // numbers the messages, standing in for platform IDs
 }
 
 func NewMockConnector(service string, bot string, publish func(protocol.Event)) *MockConnector {
@@ -23,7 +46,39 @@ func NewMockConnector(service string, bot string, publish func(protocol.Event))
 	}
 }
 
+// NewMockBotConnector returns the connector of a type: mock bot, with its
+// scenario loaded.
+func NewMockBotConnector(bot config.BotConfig, publish func(protocol.Event)) (*MockConnector, error) {
+	opts := bot.MockOptions()
+	m := NewMockConnector(bot.Type, bot.Name, publish)
+	m.silent = !opts.EchoEnabled()
+	m.listen = opts.Listen
+	if opts.Scenario != "" {
+		scenario, err := config.LoadMockScenario(opts.Scenario)
+		if err != nil {
+			return nil, err
+		}
+		m.scenario = scenario
+	}
+	return m, nil
+}
+
 func (m *MockConnector) Run(ctx context.Context) {
+	if m.listen != "" {
+		listener, err := net.Listen("tcp", m.listen)
+		if err != nil {
+			m.publishStatus("mock inject endpoint failed: " + err.Error())
+			return
+		}
+		server := &http.Server{Handler: m, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("mock %s: inject endpoint: %v", m.bot, err)
+			}
+		}()
+		defer server.Close()
+	}
+
 	connected := protocol.Event{
 		Timestamp: time.Now().UTC(),
 		Service:   m.service,
@@ -34,6 +89,8 @@ func (m *MockConnector) Run(ctx context.Context) {
 	}
 	m.publish(connected)
 
+	go m.playInbound(ctx)
+
 	ticker := time.NewTicker(45 * time.Second)
 	defer ticker.Stop()
 
@@ -64,10 +121,111 @@ func (m *MockConnector) Run(ctx context.Context) {
 	}
 }
 
+func (m *MockConnector) publishStatus(text string) {
+	m.publish(protocol.Event{
+		Timestamp: time.Now().UTC(),
+		Service:   m.service,
+		Bot:       m.bot,
+		Kind:      "status",
+		Direction: "system",
+		Text:      text,
+	})
+}
+
+// playInbound posts the scenario's inbound messages in order.
+func (m *MockConnector) playInbound(ctx context.Context) {
+	for _, message := range m.scenario.Inbound {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(message.Delay) * time.Millisecond):
+		}
+		m.Inject(message)
+	}
+}
+
+// Inject publishes message as received from the platform.
+func (m *MockConnector) Inject(message config.MockMessage) protocol.Event {
+	user := message.User
+	if user == "" {
+		user = mockUser
+	}
+	channel := message.Channel
+	target := "channel:" + channel
+	if message.Direct {
+		if channel == "" {
+			channel = user
+		}
+		target = "dm:" + user
+	}
+
+	event := protocol.Event{
+		Timestamp: time.Now().UTC(),
+		Service:   m.service,
+		Bot:       m.bot,
+		Kind:      "message",
+		Direction: "in",
+		User:      user,
+		Target:    target,
+		Channel:   channel,
+		Thread:    message.Thread,
+		MessageID: m.nextID(),
+		Text:      message.Text,
+		Direct:    message.Direct,
+	}
+	m.publish(event)
+	return event
+}
+
+// ServeHTTP is the inject endpoint: POST /messages with a JSON
+// config.MockMessage publishes it as an inbound message and answers with
+// the event.
+func (m *MockConnector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/messages" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var message config.MockMessage
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&message); err != nil {
+		http.Error(w, "invalid message: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(message.Text) == "" {
+		http.Error(w, "text cannot be empty", http.StatusBadRequest)
+		return
+	}
+	if message.Channel == "" && !message.Direct {
+		http.Error(w, "channel is required unless direct is true", http.StatusBadRequest)
+		return
+	}
+
+	event := m.Inject(message)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(event)
+}
+
+func (m *MockConnector) nextID() string {
+	return strconv.FormatInt(m.lastID.Add(1), 10)
+}
+
 func (m *MockConnector) Identity() string {
 	return ""
 }
 
+// Capabilities reports that the mock connector passes threads through.
+func (m *MockConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{Threads: true}
+}
+
 // React is not supported by the mock connector.
 func (m *MockConnector) React(_ context.Context, _ protocol.Request) error {
 	return fmt.Errorf("reactions are not supported by the mock connector")
@@ -93,25 +251,58 @@ func (m *MockConnector) Send(_ context.Context, request protocol.Request) (proto
 		Target:    target,
 		Channel:   request.Channel,
 		Thread:    request.Thread,
+		MessageID: m.nextID(),
 		Text:      trimmed,
 	}
 	m.publish(outbound)
 
+	text, user, delay, ok := m.answer(trimmed)
+	if !ok {
+		return outbound, nil
+	}
 	go func() {
-		time.Sleep(300 * time.Millisecond)
+		time.Sleep(delay)
 		echo := protocol.Event{
 			Timestamp: time.Now().UTC(),
 			Service:   m.service,
 			Bot:       m.bot,
 			Kind:      "message",
 			Direction: "in",
+			User:      user,
 			Target:    target,
 			Channel:   request.Channel,
 			Thread:    request.Thread,
-			Text:      "echo: " + trimmed,
+			MessageID: m.nextID(),
+			Text:      text,
+			Direct:    strings.HasPrefix(target, "dm:"),
 		}
 		m.publish(echo)
 	}()
 
 	return outbound, nil
 }
+
+// answer picks the reply to sent text: the first scenario reply that
+// matches it, else the echo unless that is turned off.
+func (m *MockConnector) answer(text string) (string, string, time.Duration, bool) {
+	for _, reply := range m.scenario.Replies {
+		pattern := reply.Pattern()
+		match := pattern.FindStringSubmatchIndex(text)
+		if match == nil {
+			continue
+		}
+		user := reply.User
+		if user == "" {
+			user = mockUser
+		}
+		delay := mockReplyDelay
+		if reply.Delay > 0 {
+			delay = time.Duration(reply.Delay) * time.Millisecond
+		}
+		return string(pattern.ExpandString(nil, reply.Reply, text, match)), user, delay, true
+	}
+	if m.silent {
+		return "", "", 0, false
+	}
+	return "echo: " + text, "", mockReplyDelay, true
+}
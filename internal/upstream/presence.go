@@ -0,0 +1,37 @@
+package upstream
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// Presence states understood by every PresenceSetter. Connectors map them
+// to the closest platform state.
+const (
+	PresenceOnline = "online"
+	PresenceAway   = "away"
+	PresenceDND    = "dnd"
+)
+
+// maxPresenceStatus is the shortest status limit among the platforms
+// (Slack's 100 characters).
+const maxPresenceStatus = 100
+
+// ValidatePresence checks a presence request before any platform sees it.
+func ValidatePresence(presence *protocol.Presence) error {
+	if presence == nil || (presence.State == "" && presence.Status == nil) {
+		return errors.New("presence needs a state or a status")
+	}
+	switch presence.State {
+	case "", PresenceOnline, PresenceAway, PresenceDND:
+	default:
+		return fmt.Errorf("presence state must be %q, %q or %q, got %q", PresenceOnline, PresenceAway, PresenceDND, presence.State)
+	}
+	if presence.Status != nil && utf8.RuneCountInString(*presence.Status) > maxPresenceStatus {
+		return fmt.Errorf("presence status is longer than %d characters", maxPresenceStatus)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package upstream
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pantalk/pantalk/internal/formatting"
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// Preview works out what the connector for service would post for request:
+// the destination it resolves and the messages the text is converted and
+// split into, as in its Send. Nothing is sent, and destinations that need
+// the platform to resolve (an iMessage group chat, a Discord thread started
+// by the send) are shown as given.
+func Preview(service string, request protocol.Request) (protocol.SendPreview, error) {
+	preview := protocol.SendPreview{
+		Service: service,
+		Bot:     request.Bot,
+		Target:  request.Target,
+		Thread:  request.Thread,
+		Files:   request.Files,
+	}
+
+	var (
+		segments []string
+		err      error
+	)
+	switch service {
+	case "slack":
+		preview.Channel = resolveSlackChannel(request)
+		segments, err = prepareSlackSegments(request.Format, request.Text)
+		if err == nil && len(segments) > 0 {
+			if len(request.Blocks) > 0 {
+				segments = segments[:1]
+			} else if request.Interactive != nil {
+				last := segments[len(segments)-1]
+				segments = append(segments[:len(segments)-1], formatting.SplitText(last, slackSectionLimit)...)
+			}
+		}
+	case "discord":
+		preview.Channel = resolveDiscordChannel(request)
+		segments = []string{""} // embeds only
+		if strings.TrimSpace(request.Text) != "" {
+			segments, err = prepareDiscordSegments(request.Format, request.Text)
+		}
+	case "mattermost":
+		preview.Channel = resolveMattermostChannel(request)
+		segments, err = prepareMattermostSegments(request.Format, request.Text)
+	case "telegram":
+		preview.Channel = resolveTelegramChat(request)
+		var telegramSegments []telegramOutboundSegment
+		telegramSegments, err = prepareTelegramSegments(request.Format, request.Text)
+		for _, segment := range telegramSegments {
+			preview.Messages = append(preview.Messages, protocol.PreviewMessage{Text: segment.Text, Format: segment.ParseMode})
+		}
+	case "whatsapp":
+		jid, jidErr := resolveWhatsAppJID(request)
+		if jidErr != nil {
+			return protocol.SendPreview{}, jidErr
+		}
+		preview.Channel = jid.String()
+		if len(request.Files) == 0 || strings.TrimSpace(request.Text) != "" {
+			segments, err = prepareWhatsAppSegments(request.Format, request.Text)
+		}
+	case "irc":
+		preview.Channel = resolveIRCChannel(request)
+		segments, err = prepareIRCSegments(request.Format, request.Text)
+	case "matrix":
+		preview.Channel = resolveMatrixRoom(request)
+		var matrixSegments []matrixOutboundSegment
+		matrixSegments, err = prepareMatrixSegments(request.Format, request.Text)
+		for _, segment := range matrixSegments {
+			message := protocol.PreviewMessage{Text: segment.Body}
+			if segment.Format != "" {
+				message = protocol.PreviewMessage{Text: segment.FormattedBody, Format: segment.Format}
+			}
+			preview.Messages = append(preview.Messages, message)
+		}
+	case "twilio":
+		preview.Channel = resolveTwilioChannel(request)
+		segments, err = prepareTwilioSegments(request.Format, request.Text)
+	case "zulip":
+		preview.Channel = resolveZulipChannel(request)
+		segments, err = prepareZulipSegments(request.Format, request.Text)
+	case "imessage":
+		preview.Channel = resolveIMessageChannel(request)
+		segments, err = prepareIMessageSegments(request.Format, request.Text)
+	default:
+		// Exec plugins and the mock connector get the request as it is.
+		preview.Channel = request.Channel
+		if strings.TrimSpace(request.Text) != "" {
+			preview.Messages = []protocol.PreviewMessage{{Text: request.Text, Format: request.Format}}
+		}
+	}
+	if err != nil {
+		return protocol.SendPreview{}, err
+	}
+
+	for _, segment := range segments {
+		preview.Messages = append(preview.Messages, protocol.PreviewMessage{Text: segment})
+	}
+	if preview.Channel == "" && preview.Target == "" {
+		return protocol.SendPreview{}, fmt.Errorf("%s send requires channel or target", service)
+	}
+	if len(preview.Messages) == 0 && len(preview.Files) == 0 && len(request.Embeds) == 0 {
+		return protocol.SendPreview{}, fmt.Errorf("text cannot be empty")
+	}
+	return preview, nil
+}
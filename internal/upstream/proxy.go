@@ -0,0 +1,162 @@
+package upstream
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/proxy"
+
+	"github.com/pantalk/pantalk/internal/config"
+)
+
+// proxyFunc picks the proxy of a request, as http.Transport.Proxy does.
+type proxyFunc = func(*http.Request) (*url.URL, error)
+
+// proxyFor returns the proxy a bot's connections go through: its proxy:
+// URL, or the one HTTPS_PROXY, HTTP_PROXY and NO_PROXY name.
+func proxyFor(bot config.BotConfig) (proxyFunc, error) {
+	proxyURL, err := botProxyURL(bot)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL == nil {
+		return http.ProxyFromEnvironment, nil
+	}
+	return http.ProxyURL(proxyURL), nil
+}
+
+// botProxyURL returns the bot's proxy: URL, or nil when it has none.
+func botProxyURL(bot config.BotConfig) (*url.URL, error) {
+	if strings.TrimSpace(bot.Proxy) == "" {
+		return nil, nil
+	}
+	raw, err := config.ResolveCredential(bot.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("resolve proxy for bot %q: %w", bot.Name, err)
+	}
+	proxyURL, err := config.ParseProxy(raw)
+	if err != nil {
+		return nil, fmt.Errorf("bot %q: %w", bot.Name, err)
+	}
+	return proxyURL, nil
+}
+
+// newProxyTransport returns a copy of http.DefaultTransport that goes
+// through proxy.
+func newProxyTransport(proxy proxyFunc) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	return transport
+}
+
+// newProxyDialer returns a copy of websocket.DefaultDialer that goes
+// through proxy.
+func newProxyDialer(proxy proxyFunc) *websocket.Dialer {
+	dialer := *websocket.DefaultDialer
+	dialer.Proxy = proxy
+	return &dialer
+}
+
+// dialThroughProxy opens a TCP connection to addr (host:port) through the
+// proxy, for protocols other than HTTP. The environment is consulted as for
+// an https:// request to addr, so HTTPS_PROXY and NO_PROXY apply.
+func dialThroughProxy(ctx context.Context, pick proxyFunc, dialer *net.Dialer, addr string) (net.Conn, error) {
+	var proxyURL *url.URL
+	if pick != nil {
+		var err error
+		proxyURL, err = pick(&http.Request{URL: &url.URL{Scheme: "https", Host: addr}})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if proxyURL == nil {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		socks, err := proxy.FromURL(proxyURL, dialer)
+		if err != nil {
+			return nil, err
+		}
+		if socks, ok := socks.(proxy.ContextDialer); ok {
+			return socks.DialContext(ctx, "tcp", addr)
+		}
+		return socks.Dial("tcp", addr)
+	case "http":
+		return dialHTTPConnect(ctx, proxyURL, dialer, addr)
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+}
+
+// dialHTTPConnect tunnels to addr through an HTTP proxy with CONNECT.
+func dialHTTPConnect(ctx context.Context, proxyURL *url.URL, dialer *net.Dialer, addr string) (net.Conn, error) {
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "80")
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("dial proxy: %w", err)
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	} else if dialer.Timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(dialer.Timeout))
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT: %w", err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT: %s", resp.Status)
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	// The server may already have spoken; keep what was read past the
+	// proxy's response.
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn reads what a bufio.Reader holds before the connection.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
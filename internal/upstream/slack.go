@@ -2,14 +2,17 @@ package upstream
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 	"github.com/slack-go/slack/socketmode"
@@ -23,14 +26,30 @@ type SlackConnector struct {
 	serviceName string
 	botName     string
 	publish     func(protocol.Event)
-	api         *slack.Client
+	appToken    string
+	api         *slack.Client // replaced by RotateToken; read through client()
+	userAPI     *slack.Client // user_token client, nil without one
 	socket      *socketmode.Client
+	// signingSecret verifies the Events API callbacks of a bot with
+	// transport: webhook, which takes events from them instead of socket.
+	signingSecret string
+	appHome       bool
+	echoes        *echoFilter // nil unless include_self
+	scopes        *slackScopes
+	dialer        *websocket.Dialer // Socket Mode dials through the bot's proxy
 
 	mu            sync.RWMutex
 	channels      map[string]struct{}
 	selfUser      string
 	selfBotID     string
+	selfAccount   string   // the user_token's user, whose messages are the bot's own too
+	selfNames     []string // username, display name and real name, for mention matching
 	receivedEvent bool
+	home          HomeFunc
+	lastReceived  map[string]string // channel -> ts of the newest inbound message, for MarkRead
+	webhookURL    string            // where Slack delivers events with transport: webhook
+
+	deliveries deliveryLog // event_ids of webhook callbacks, to drop Slack's retries
 }
 
 func NewSlackConnector(bot config.BotConfig, publish func(protocol.Event)) (*SlackConnector, error) {
@@ -44,15 +63,46 @@ func NewSlackConnector(bot config.BotConfig, publish func(protocol.Event)) (*Sla
 		return nil, fmt.Errorf("resolve slack app_level_token for bot %q: %w", bot.Name, err)
 	}
 
-	apiClient := slack.New(token, slack.OptionAppLevelToken(appToken))
+	proxy, err := proxyFor(bot)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := newHTTPClient(proxy, bot.HTTPOptions(), 60*time.Second)
+	dialer := newProxyDialer(proxy)
+
+	var userAPI *slack.Client
+	if strings.TrimSpace(bot.UserToken) != "" {
+		userToken, err := config.ResolveCredential(bot.UserToken)
+		if err != nil {
+			return nil, fmt.Errorf("resolve slack user_token for bot %q: %w", bot.Name, err)
+		}
+		userAPI = slack.New(userToken, slack.OptionHTTPClient(httpClient))
+	}
+
+	var signingSecret string
+	if bot.Transport == config.TransportWebhook {
+		if signingSecret, err = config.ResolveCredential(bot.SigningSecret); err != nil {
+			return nil, fmt.Errorf("resolve slack signing_secret for bot %q: %w", bot.Name, err)
+		}
+	}
+
+	scopes := &slackScopes{client: httpClient}
+	apiClient := slack.New(token, slack.OptionAppLevelToken(appToken), slack.OptionHTTPClient(scopes))
 
 	connector := &SlackConnector{
-		serviceName: bot.Type,
-		botName:     bot.Name,
-		publish:     publish,
-		api:         apiClient,
-		socket:      socketmode.New(apiClient),
-		channels:    make(map[string]struct{}),
+		serviceName:   bot.Type,
+		botName:       bot.Name,
+		publish:       publish,
+		appToken:      appToken,
+		api:           apiClient,
+		userAPI:       userAPI,
+		socket:        socketmode.New(apiClient, socketmode.OptionDialer(dialer)),
+		dialer:        dialer,
+		signingSecret: signingSecret,
+		appHome:       bot.AppHome,
+		echoes:        newEchoFilter(bot.IncludeSelf),
+		scopes:        scopes,
+		channels:      make(map[string]struct{}),
 	}
 
 	for _, channel := range bot.Channels {
@@ -98,28 +148,60 @@ func (s *SlackConnector) Run(ctx context.Context) {
 
 		// Re-create the socket-mode client for a fresh connection
 		s.mu.Lock()
-		s.socket = socketmode.New(s.api)
+		s.socket = socketmode.New(s.api, socketmode.OptionDialer(s.dialer))
 		s.mu.Unlock()
 	}
 }
 
 func (s *SlackConnector) connectAndRun(ctx context.Context) error {
-	auth, err := s.api.AuthTestContext(ctx)
+	auth, err := s.client().AuthTestContext(ctx)
 	if err != nil {
 		log.Printf("[slack:%s] auth failed: %v", s.botName, err)
 		return fmt.Errorf("auth failed: %w", err)
 	}
 
+	names := []string{auth.User}
+	// Needs users:read; without it only the username is known.
+	if profile, err := s.client().GetUserInfoContext(ctx, auth.UserID); err == nil {
+		names = append(names, profile.Profile.DisplayName, profile.Profile.RealName)
+	}
+
+	var account string
+	if s.userAPI != nil {
+		userAuth, err := s.userAPI.AuthTestContext(ctx)
+		if err != nil {
+			log.Printf("[slack:%s] user_token auth failed: %v", s.botName, err)
+			return fmt.Errorf("user_token auth failed: %w", err)
+		}
+		account = userAuth.UserID
+	}
+
 	s.mu.Lock()
 	s.selfUser = auth.UserID
 	s.selfBotID = auth.BotID
+	s.selfAccount = account
+	s.selfNames = names
 	s.mu.Unlock()
 
-	log.Printf("[slack:%s] authenticated (user=%s)", s.botName, auth.UserID)
+	if account != "" {
+		log.Printf("[slack:%s] authenticated (user=%s, user_token user=%s)", s.botName, auth.UserID, account)
+	} else {
+		log.Printf("[slack:%s] authenticated (user=%s)", s.botName, auth.UserID)
+	}
 
 	s.resolveChannelNames(ctx)
 
-	go s.socket.RunContext(ctx)
+	// With transport: webhook events come through HandleWebhook, and the
+	// nil channel leaves the socket case below idle.
+	var socketEvents chan socketmode.Event
+	if s.signingSecret == "" {
+		go s.socket.RunContext(ctx)
+		socketEvents = s.socket.Events
+	} else {
+		s.mu.RLock()
+		log.Printf("[slack:%s] taking events at %s", s.botName, s.webhookURL)
+		s.mu.RUnlock()
+	}
 
 	s.publishStatus("connector online")
 
@@ -146,7 +228,7 @@ func (s *SlackConnector) connectAndRun(ctx context.Context) error {
 			}
 		case <-heartbeatTicker.C:
 			s.publishHeartbeat()
-		case event, ok := <-s.socket.Events:
+		case event, ok := <-socketEvents:
 			if !ok {
 				return fmt.Errorf("socket mode event channel closed")
 			}
@@ -176,23 +258,52 @@ func (s *SlackConnector) Send(ctx context.Context, request protocol.Request) (pr
 	if len(segments) == 0 {
 		return protocol.Event{}, fmt.Errorf("text cannot be empty")
 	}
+	if request.Interactive != nil {
+		last := segments[len(segments)-1]
+		segments = append(segments[:len(segments)-1], formatting.SplitText(last, slackSectionLimit)...)
+	}
+
+	// A Block Kit layout is posted once, with the start of the text as the
+	// notification fallback.
+	var blocks slack.Blocks
+	if len(request.Blocks) > 0 {
+		if err := json.Unmarshal(request.Blocks, &blocks); err != nil {
+			return protocol.Event{}, fmt.Errorf("invalid blocks: %w", err)
+		}
+		segments = segments[:1]
+	}
 
 	parameters := slack.PostMessageParameters{}
 	if request.Thread != "" {
 		parameters.ThreadTimestamp = request.Thread
 	}
+	// Requires the chat:write.customize scope; without it Slack silently
+	// posts under the bot's own name.
+	if author := strings.TrimSpace(request.Author); author != "" {
+		parameters.Username = author
+		parameters.IconURL = strings.TrimSpace(request.AuthorAvatar)
+	}
 
 	var lastEvent protocol.Event
-	for _, segmentText := range segments {
+	for i, segmentText := range segments {
 		messageOptions := []slack.MsgOption{
 			slack.MsgOptionText(segmentText, false),
 			slack.MsgOptionPostMessageParameters(parameters),
 		}
+		// The buttons go under the last segment; the text stays as the
+		// notification fallback.
+		if request.Interactive != nil && i == len(segments)-1 {
+			messageOptions = append(messageOptions, slack.MsgOptionBlocks(slackInteractiveBlocks(segmentText, request.Interactive)...))
+		}
+		if len(blocks.BlockSet) > 0 {
+			messageOptions = append(messageOptions, slack.MsgOptionBlocks(blocks.BlockSet...))
+		}
 
-		postedChannel, postedTS, postErr := s.api.PostMessageContext(ctx, channel, messageOptions...)
+		postedChannel, postedTS, postErr := s.client().PostMessageContext(ctx, channel, messageOptions...)
 		if postErr != nil {
 			return protocol.Event{}, postErr
 		}
+		s.echoes.claim(postedTS)
 
 		target := request.Target
 		if target == "" {
@@ -209,6 +320,7 @@ func (s *SlackConnector) Send(ctx context.Context, request protocol.Request) (pr
 			Target:    target,
 			Channel:   postedChannel,
 			Thread:    request.Thread,
+			MessageID: postedTS,
 			Text:      segmentText,
 		}
 
@@ -238,7 +350,7 @@ func (s *SlackConnector) React(ctx context.Context, request protocol.Request) er
 		return fmt.Errorf("slack react requires thread (message timestamp)")
 	}
 
-	return s.api.AddReactionContext(ctx, emoji, slack.ItemRef{
+	return s.client().AddReactionContext(ctx, emoji, slack.ItemRef{
 		Channel:   channel,
 		Timestamp: ts,
 	})
@@ -273,6 +385,14 @@ func (s *SlackConnector) handleSocketEvent(event socketmode.Event) {
 		}
 
 		s.handleInnerEvent(eventsAPIEvent.InnerEvent)
+	case socketmode.EventTypeInteractive:
+		if event.Request != nil {
+			s.socket.Ack(*event.Request)
+		}
+
+		if callback, ok := event.Data.(slack.InteractionCallback); ok {
+			s.handleInteraction(callback)
+		}
 	}
 }
 
@@ -282,6 +402,8 @@ func (s *SlackConnector) handleInnerEvent(inner slackevents.EventsAPIInnerEvent)
 		s.handleMessageEvent(ev)
 	case *slackevents.AppMentionEvent:
 		s.handleAppMentionEvent(ev)
+	case *slackevents.AppHomeOpenedEvent:
+		s.handleAppHomeOpened(ev)
 	}
 }
 
@@ -298,11 +420,10 @@ func (s *SlackConnector) handleMessageEvent(message *slackevents.MessageEvent) {
 		return
 	}
 
-	if s.isSelfMessage(message) {
-		return
-	}
-
-	if !s.acceptsChannel(message.Channel) {
+	// With app_home, the App Home messages tab is a DM with the app and is
+	// accepted even when channels restricts the bot.
+	homeMessage := s.appHome && message.ChannelType == "im"
+	if !homeMessage && !s.acceptsChannel(message.Channel) {
 		return
 	}
 
@@ -316,9 +437,18 @@ func (s *SlackConnector) handleMessageEvent(message *slackevents.MessageEvent) {
 		Target:    "channel:" + message.Channel,
 		Channel:   message.Channel,
 		Thread:    message.ThreadTimeStamp,
+		MessageID: message.TimeStamp,
 		Text:      message.Text,
+		Direct:    message.ChannelType == "im" || message.ChannelType == "mpim",
+	}
+
+	if s.isSelfMessage(message) {
+		event.Direction, event.User, event.Direct = "out", s.Identity(), false
+		s.echoes.echo(message.TimeStamp, func() { s.publish(event) })
+		return
 	}
 
+	s.rememberReceived(message.Channel, message.TimeStamp)
 	s.publish(event)
 }
 
@@ -354,9 +484,11 @@ func (s *SlackConnector) handleAppMentionEvent(mention *slackevents.AppMentionEv
 		Target:    "channel:" + mention.Channel,
 		Channel:   mention.Channel,
 		Thread:    mention.ThreadTimeStamp,
+		MessageID: mention.TimeStamp,
 		Text:      mention.Text,
 	}
 
+	s.rememberReceived(mention.Channel, mention.TimeStamp)
 	s.publish(event)
 }
 
@@ -425,15 +557,103 @@ func (s *SlackConnector) isSelfMessage(message *slackevents.MessageEvent) bool {
 		return true
 	}
 
+	if s.selfAccount != "" && message.User == s.selfAccount {
+		return true
+	}
+
 	return false
 }
 
+// Capabilities reports Slack's features. Puppeting overrides the posting
+// name and icon per message; interactive messages use Block Kit.
+func (s *SlackConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{
+		Threads:     true,
+		Reactions:   true,
+		Interactive: true,
+		Blocks:      true,
+		Puppeting:   true,
+		MarkRead:    true,
+		Presence:    true,
+		Channels:    true,
+		MaxText:     slackMaxText,
+	}
+}
+
+// SendsWithoutSession implements SessionlessSender: Slack sends go through
+// the Web API, which needs no Socket Mode session.
+func (s *SlackConnector) SendsWithoutSession() {}
+
+// Verify implements Verifier with auth.test.
+func (s *SlackConnector) Verify(ctx context.Context) (Verification, error) {
+	auth, err := s.client().AuthTestContext(ctx)
+	if err != nil {
+		return Verification{}, fmt.Errorf("auth.test: %w", err)
+	}
+	return Verification{
+		User:   auth.User,
+		UserID: auth.UserID,
+		Team:   auth.Team,
+		Scopes: s.scopes.get(),
+	}, nil
+}
+
+// client returns the Web API client for the current bot token.
+func (s *SlackConnector) client() *slack.Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.api
+}
+
+// RotateToken implements TokenRotator once auth.test accepts the new bot
+// token for the same bot user. Socket Mode runs on the app-level token, so
+// the session stays up.
+func (s *SlackConnector) RotateToken(ctx context.Context, token string) error {
+	api := slack.New(token, slack.OptionAppLevelToken(s.appToken), slack.OptionHTTPClient(s.scopes))
+	auth, err := api.AuthTestContext(ctx)
+	if err != nil {
+		return fmt.Errorf("auth.test: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.selfUser != "" && auth.UserID != s.selfUser {
+		return fmt.Errorf("new token authenticates as %s (%s), not the bot's user %s", auth.User, auth.UserID, s.selfUser)
+	}
+	s.api = api
+	return nil
+}
+
+// userClient returns the client for calls made as a user: the user_token
+// one when the bot has it, the bot's otherwise.
+func (s *SlackConnector) userClient() *slack.Client {
+	if s.userAPI != nil {
+		return s.userAPI
+	}
+	return s.client()
+}
+
 func (s *SlackConnector) Identity() string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	return s.selfUser
 }
 
+// UserIdentity implements UserIdentifier with the user_token's user.
+func (s *SlackConnector) UserIdentity() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.selfAccount
+}
+
+// MentionNames returns the names people can type after @ for the bot's
+// user, as learned at connect.
+func (s *SlackConnector) MentionNames() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.selfNames
+}
+
 func resolveSlackChannel(request protocol.Request) string {
 	if request.Channel != "" {
 		return request.Channel
@@ -453,6 +673,10 @@ func resolveSlackChannel(request protocol.Request) string {
 	return target
 }
 
+// slackMaxText is how much text goes in one Slack message; Slack truncates
+// text past 40000 characters.
+const slackMaxText = 30000
+
 func prepareSlackSegments(format string, text string) ([]string, error) {
 	normalizedFormat, err := formatting.NormalizeFormat(format)
 	if err != nil {
@@ -469,7 +693,7 @@ func prepareSlackSegments(format string, text string) ([]string, error) {
 		trimmed = formatting.StripHTML(trimmed)
 	}
 
-	return formatting.SplitText(trimmed, 30000), nil
+	return formatting.SplitText(trimmed, slackMaxText), nil
 }
 
 func parseSlackTimestamp(ts string) time.Time {
@@ -510,7 +734,7 @@ func (s *SlackConnector) resolveChannelNames(ctx context.Context) {
 			Cursor:          cursor,
 			ExcludeArchived: true,
 		}
-		channels, nextCursor, err := s.api.GetConversationsContext(ctx, params)
+		channels, nextCursor, err := s.client().GetConversationsContext(ctx, params)
 		if err != nil {
 			log.Printf("[slack:%s] channel resolution: failed to list conversations: %v", s.botName, err)
 			return
@@ -554,3 +778,147 @@ func isSlackChannelID(s string) bool {
 	}
 	return true
 }
+
+func (s *SlackConnector) rememberReceived(channel string, ts string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastReceived == nil {
+		s.lastReceived = make(map[string]string)
+	}
+	if slackTimestampBefore(s.lastReceived[channel], ts) {
+		s.lastReceived[channel] = ts
+	}
+}
+
+// MarkRead moves the read cursor in channel with conversations.mark, to
+// through or to the newest message received there; with a user_token it is
+// the user's cursor. Channels with no received message since the connector
+// started are left alone.
+func (s *SlackConnector) MarkRead(ctx context.Context, channel string, through time.Time) error {
+	s.mu.RLock()
+	ts := s.lastReceived[channel]
+	s.mu.RUnlock()
+
+	if !through.IsZero() {
+		ts = formatSlackTimestamp(through)
+	}
+	if ts == "" {
+		return nil
+	}
+	if err := s.userClient().MarkConversationContext(ctx, channel, ts); err != nil {
+		return fmt.Errorf("slack conversations.mark: %w", err)
+	}
+	return nil
+}
+
+// slackTimestampBefore reports whether Slack ts a is older than b; an
+// empty a is older than everything.
+func slackTimestampBefore(a string, b string) bool {
+	if a == "" {
+		return true
+	}
+	return parseSlackTimestamp(a).Before(parseSlackTimestamp(b))
+}
+
+// formatSlackTimestamp is the inverse of parseSlackTimestamp, rounding away
+// the float error so the ts of a parsed message comes back unchanged.
+func formatSlackTimestamp(t time.Time) string {
+	t = t.Round(time.Microsecond)
+	return fmt.Sprintf("%d.%06d", t.Unix(), t.Nanosecond()/1000)
+}
+
+// SetPresence maps online to Slack's "auto" presence and away and dnd to
+// "away"; bots cannot snooze notifications. The status text goes through
+// users.profile.set, which Slack only accepts for tokens with the
+// users.profile:write scope. Both are made as the user_token's user when
+// the bot has one.
+func (s *SlackConnector) SetPresence(ctx context.Context, presence protocol.Presence) error {
+	if presence.State != "" {
+		state := "away"
+		if presence.State == PresenceOnline {
+			state = "auto"
+		}
+		if err := s.userClient().SetUserPresenceContext(ctx, state); err != nil {
+			return fmt.Errorf("slack users.setPresence: %w", err)
+		}
+	}
+	if presence.Status != nil {
+		if err := s.userClient().SetUserCustomStatusContext(ctx, *presence.Status, "", 0); err != nil {
+			return fmt.Errorf("slack users.profile.set: %w", err)
+		}
+	}
+	return nil
+}
+
+// JoinChannel joins a public channel with conversations.join. Private
+// channels need an invite from a member instead.
+func (s *SlackConnector) JoinChannel(ctx context.Context, channel string) error {
+	if _, _, _, err := s.client().JoinConversationContext(ctx, channel); err != nil {
+		return fmt.Errorf("slack conversations.join: %w", err)
+	}
+	s.rememberChannel(channel)
+	return nil
+}
+
+func (s *SlackConnector) LeaveChannel(ctx context.Context, channel string) error {
+	if _, err := s.client().LeaveConversationContext(ctx, channel); err != nil {
+		return fmt.Errorf("slack conversations.leave: %w", err)
+	}
+	return nil
+}
+
+// CreateChannel creates a channel with conversations.create; the bot is
+// its first member. Slack workspaces have no scope to pick.
+func (s *SlackConnector) CreateChannel(ctx context.Context, name string, private bool, _ string) (string, error) {
+	channel, err := s.client().CreateConversationContext(ctx, slack.CreateConversationParams{ChannelName: name, IsPrivate: private})
+	if err != nil {
+		return "", fmt.Errorf("slack conversations.create: %w", err)
+	}
+	s.rememberChannel(channel.ID)
+	return channel.ID, nil
+}
+
+func (s *SlackConnector) InviteToChannel(ctx context.Context, channel string, users []string) error {
+	if _, err := s.client().InviteUsersToConversationContext(ctx, channel, users...); err != nil {
+		return fmt.Errorf("slack conversations.invite: %w", err)
+	}
+	return nil
+}
+
+// slackScopes is the Web API client's HTTP client. It keeps the scopes
+// Slack lists in the X-OAuth-Scopes header of each response.
+type slackScopes struct {
+	client *http.Client // nil is http.DefaultClient
+
+	mu     sync.Mutex
+	scopes string
+}
+
+func (c *slackScopes) Do(req *http.Request) (*http.Response, error) {
+	client := c.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err == nil && resp.Header.Get("X-OAuth-Scopes") != "" {
+		c.mu.Lock()
+		c.scopes = resp.Header.Get("X-OAuth-Scopes")
+		c.mu.Unlock()
+	}
+	return resp, err
+}
+
+func (c *slackScopes) get() []string {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var scopes []string
+	for _, scope := range strings.Split(c.scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
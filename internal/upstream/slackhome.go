@@ -0,0 +1,137 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// homePublishTimeout bounds building and publishing one App Home view.
+const homePublishTimeout = 15 * time.Second
+
+// homeTextLimit is how much of a notification's text the home tab shows.
+const homeTextLimit = 150
+
+// homeMaxAgents keeps the view under Slack's block limit.
+const homeMaxAgents = 40
+
+// SetHomeFunc sets where the App Home tab gets its summary from.
+func (s *SlackConnector) SetHomeFunc(fn HomeFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.home = fn
+}
+
+// handleAppHomeOpened publishes a fresh home tab for the user who opened it.
+// The messages tab needs nothing here; its messages arrive as IMs.
+func (s *SlackConnector) handleAppHomeOpened(opened *slackevents.AppHomeOpenedEvent) {
+	if opened == nil || opened.Tab != "home" || opened.User == "" || !s.appHome {
+		return
+	}
+
+	s.mu.RLock()
+	home := s.home
+	s.mu.RUnlock()
+	if home == nil {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), homePublishTimeout)
+		defer cancel()
+
+		summary, err := home(ctx)
+		if err != nil {
+			log.Printf("[slack:%s] app home summary failed: %v", s.botName, err)
+			return
+		}
+
+		if _, err := s.client().PublishViewContext(ctx, slack.PublishViewContextRequest{
+			UserID: opened.User,
+			View:   slackHomeView(summary),
+		}); err != nil {
+			log.Printf("[slack:%s] publish app home for %s failed: %v", s.botName, opened.User, err)
+		}
+	}()
+}
+
+// slackHomeView renders the summary as a home tab: the unseen notifications,
+// newest first, followed by the agents.
+func slackHomeView(summary HomeSummary) slack.HomeTabViewRequest {
+	blocks := []slack.Block{
+		slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, "pantalk", false, false)),
+		slackMarkdownSection(fmt.Sprintf("*%d* unseen notification(s)", summary.Unseen)),
+	}
+
+	for _, event := range summary.Recent {
+		where := "<#" + event.Channel + ">"
+		if strings.HasPrefix(event.Channel, "D") {
+			where = "DM"
+		}
+		if event.User != "" {
+			where += " <@" + event.User + ">"
+		}
+		line := fmt.Sprintf("%s <!date^%d^{date_short_pretty} {time}|%s>\n%s",
+			where, event.Timestamp.Unix(), event.Timestamp.UTC().Format(time.RFC3339),
+			escapeSlackText(truncateRunes(event.Text, homeTextLimit)))
+		blocks = append(blocks, slackMarkdownSection(line))
+	}
+	if more := summary.Unseen - int64(len(summary.Recent)); more > 0 && len(summary.Recent) > 0 {
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType,
+			fmt.Sprintf("and %d more - run `pantalk notifications --unseen` to read them", more), false, false)))
+	}
+
+	blocks = append(blocks, slack.NewDividerBlock(), slackMarkdownSection("*Agents*"))
+	if len(summary.Agents) == 0 {
+		blocks = append(blocks, slackMarkdownSection("No agents configured."))
+	}
+	for i, agent := range summary.Agents {
+		if i == homeMaxAgents {
+			blocks = append(blocks, slackMarkdownSection(fmt.Sprintf("and %d more", len(summary.Agents)-i)))
+			break
+		}
+
+		state := "idle"
+		if agent.Running {
+			state = "running"
+		}
+		if agent.Pending > 0 {
+			state += fmt.Sprintf(", %d pending", agent.Pending)
+		}
+		last := "never run"
+		if run := agent.LastRun; run != nil {
+			last = fmt.Sprintf("last run <!date^%d^{date_short_pretty} {time}|%s> exit %d",
+				run.StartedAt.Unix(), run.StartedAt.UTC().Format(time.RFC3339), run.ExitCode)
+		}
+		blocks = append(blocks, slackMarkdownSection(fmt.Sprintf("*%s* - %s - %s\n`%s`",
+			escapeSlackText(agent.Name), state, last, escapeSlackText(agent.When))))
+	}
+
+	return slack.HomeTabViewRequest{
+		Type:   slack.VTHomeTab,
+		Blocks: slack.Blocks{BlockSet: blocks},
+	}
+}
+
+func slackMarkdownSection(text string) *slack.SectionBlock {
+	return slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil)
+}
+
+// escapeSlackText escapes the characters Slack treats as control sequences
+// in mrkdwn.
+func escapeSlackText(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+func truncateRunes(text string, limit int) string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) <= limit {
+		return string(runes)
+	}
+	return string(runes[:limit]) + "…"
+}
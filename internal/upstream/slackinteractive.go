@@ -0,0 +1,92 @@
+package upstream
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/slack-go/slack"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// slackSectionLimit is the most text a section block holds. Interactive
+// sends are split to it so the last segment can carry the buttons.
+const slackSectionLimit = 3000
+
+// slackActionPrefix marks the action ids of pantalk's own components.
+const slackActionPrefix = "pantalk_"
+
+// slackInteractiveBlocks renders text as a section followed by an actions
+// block with the buttons and select menu.
+func slackInteractiveBlocks(text string, interactive *protocol.Interactive) []slack.Block {
+	elements := make([]slack.BlockElement, 0, len(interactive.Buttons)+1)
+	for i, button := range interactive.Buttons {
+		element := slack.NewButtonBlockElement(slackActionPrefix+"button_"+strconv.Itoa(i), button.Value,
+			slack.NewTextBlockObject(slack.PlainTextType, button.Label, false, false))
+		switch button.Style {
+		case "primary":
+			element.WithStyle(slack.StylePrimary)
+		case "danger":
+			element.WithStyle(slack.StyleDanger)
+		}
+		elements = append(elements, element)
+	}
+	if sel := interactive.Select; sel != nil && len(sel.Options) > 0 {
+		options := make([]*slack.OptionBlockObject, 0, len(sel.Options))
+		for _, option := range sel.Options {
+			options = append(options, slack.NewOptionBlockObject(option.Value,
+				slack.NewTextBlockObject(slack.PlainTextType, option.Label, false, false), nil))
+		}
+		elements = append(elements, slack.NewOptionsSelectBlockElement(slack.OptTypeStatic,
+			slack.NewTextBlockObject(slack.PlainTextType, selectPlaceholder(sel), false, false),
+			slackActionPrefix+"select", options...))
+	}
+
+	return []slack.Block{
+		slackMarkdownSection(text),
+		slack.NewActionBlock(slackActionPrefix+"actions", elements...),
+	}
+}
+
+// handleInteraction publishes clicks on pantalk's buttons and menus.
+// Interactions with components of other apps are ignored.
+func (s *SlackConnector) handleInteraction(callback slack.InteractionCallback) {
+	if callback.Type != slack.InteractionTypeBlockActions {
+		return
+	}
+
+	channel := callback.Channel.ID
+	if channel == "" {
+		channel = callback.Container.ChannelID
+	}
+	if channel == "" || !s.acceptsChannel(channel) {
+		return
+	}
+
+	for _, action := range callback.ActionCallback.BlockActions {
+		if action == nil || !strings.HasPrefix(action.ActionID, slackActionPrefix) {
+			continue
+		}
+		value := action.Value
+		if action.SelectedOption.Value != "" {
+			value = action.SelectedOption.Value
+		}
+		if value == "" {
+			continue
+		}
+
+		s.publish(protocol.Event{
+			Timestamp: parseSlackTimestamp(action.ActionTs),
+			Service:   s.serviceName,
+			Bot:       s.botName,
+			Kind:      protocol.KindInteraction,
+			Direction: "in",
+			User:      callback.User.ID,
+			Target:    "channel:" + channel,
+			Channel:   channel,
+			Thread:    callback.Message.ThreadTimestamp,
+			MessageID: callback.Message.Timestamp,
+			Text:      value,
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// SetWebhookEndpoint records the URL Slack should deliver events to. It is
+// entered as the app's Event Subscriptions and Interactivity request URL;
+// Slack signs its callbacks with the app's signing secret, so secret is
+// unused.
+func (s *SlackConnector) SetWebhookEndpoint(url string, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhookURL = url
+}
+
+// HandleWebhook takes an Events API or interactivity callback, checked
+// against the signing secret: it answers URL verification challenges and
+// handles events as they would arrive over Socket Mode. Events are handled
+// after it returns, so Slack gets its answer within its three seconds, and
+// retries of an event_id already taken are dropped.
+func (s *SlackConnector) HandleWebhook(_ context.Context, header http.Header, body []byte) ([]byte, error) {
+	if s.signingSecret == "" {
+		return nil, ErrNotWebhook
+	}
+
+	verifier, err := slack.NewSecretsVerifier(header, s.signingSecret)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebhookUnauthorized, err)
+	}
+	_, _ = verifier.Write(body)
+	if err := verifier.Ensure(); err != nil {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrWebhookUnauthorized)
+	}
+
+	// Interactivity callbacks are form posts carrying JSON in payload.
+	if strings.HasPrefix(header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, fmt.Errorf("parse slack interaction: %w", err)
+		}
+		var callback slack.InteractionCallback
+		if err := json.Unmarshal([]byte(form.Get("payload")), &callback); err != nil {
+			return nil, fmt.Errorf("parse slack interaction: %w", err)
+		}
+		go s.handleInteraction(callback)
+		return nil, nil
+	}
+
+	event, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
+	if err != nil {
+		return nil, fmt.Errorf("parse slack event: %w", err)
+	}
+	switch event.Type {
+	case slackevents.URLVerification:
+		verification, ok := event.Data.(*slackevents.EventsAPIURLVerificationEvent)
+		if !ok {
+			return nil, fmt.Errorf("parse slack url verification")
+		}
+		return []byte(verification.Challenge), nil
+	case slackevents.CallbackEvent:
+		if callback, ok := event.Data.(*slackevents.EventsAPICallbackEvent); ok && s.deliveries.seen(callback.EventID) {
+			return nil, nil
+		}
+		s.mu.Lock()
+		s.receivedEvent = true
+		s.mu.Unlock()
+		go s.handleInnerEvent(event.InnerEvent)
+	}
+	return nil, nil
+}
@@ -0,0 +1,239 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// Status classes returned by ClassifyStatus.
+const (
+	StatusOnline  = "online"  // a session started or a transport recovered
+	StatusStopped = "stopped" // the connector was stopped on purpose
+	StatusInfo    = "info"    // informational warning
+	StatusDown    = "down"    // a failure
+	StatusUnknown = "unknown" // none of the above; changes nothing
+)
+
+// downMarkers are what the status texts of failures contain: errors,
+// ended sessions, reconnects and stopped plugins.
+var downMarkers = []string{
+	" failed", " error", " ended", "disconnected", "reconnecting", "exited",
+	"logged out", "not paired", "connector stopped",
+}
+
+// StatusDownAlert starts the status text a Supervisor publishes once a
+// connector has been down for SupervisorConfig.DownAlertAfter.
+const StatusDownAlert = "connector down for "
+
+// ClassifyStatus sorts connector status texts. Connectors publish
+// "connector online" when a session starts and "connector offline" only
+// when they are stopped; a "... connected" notice means a transport
+// recovered on its own. Texts it doesn't recognize, from exec plugins
+// say, are StatusUnknown rather than taken for an outage.
+func ClassifyStatus(text string) string {
+	switch {
+	case text == "connector online" || strings.HasSuffix(text, " connected"):
+		return StatusOnline
+	case text == "connector offline":
+		return StatusStopped
+	case strings.HasPrefix(text, "warning:"):
+		return StatusInfo
+	case strings.HasPrefix(text, StatusDownAlert):
+		return StatusDown
+	}
+	for _, marker := range downMarkers {
+		if strings.Contains(text, marker) {
+			return StatusDown
+		}
+	}
+	return StatusUnknown
+}
+
+// Supervision defaults, used for zero SupervisorConfig fields.
+const (
+	DefaultRestartBackoff    = time.Second
+	DefaultMaxRestartBackoff = 5 * time.Minute
+	DefaultMaxRestarts       = 10
+	DefaultRestartWindow     = time.Hour
+	DefaultDownAlertAfter    = 10 * time.Minute
+)
+
+// stableRun is how long Run has to last for the next restart to start over
+// from the base backoff.
+const stableRun = 5 * time.Minute
+
+// SupervisorConfig tunes a Supervisor.
+type SupervisorConfig struct {
+	Backoff     time.Duration // first restart delay, doubled per failure
+	MaxBackoff  time.Duration
+	MaxRestarts int           // restarts allowed per Window before waiting for the window to clear
+	Window      time.Duration // sliding window MaxRestarts applies to
+
+	DownAlertAfter time.Duration // outage length before the down alert
+}
+
+// Supervisor keeps one connector running. Connectors reconnect their own
+// sessions, but some give up and return from Run (an auth failure at
+// start, for example); the supervisor restarts those with exponential
+// backoff and jitter. It also sits between the connector and its publish
+// func to follow its status events and report outages that outlast
+// DownAlertAfter.
+type Supervisor struct {
+	cfg     SupervisorConfig
+	publish func(protocol.Event)
+
+	mu         sync.Mutex
+	down       bool
+	downSince  time.Time
+	downReason string
+	outage     int // bumped per outage so a stale alert timer doesn't fire
+	alertTimer *time.Timer
+}
+
+// NewSupervisor returns a supervisor that forwards events to publish.
+func NewSupervisor(cfg SupervisorConfig, publish func(protocol.Event)) *Supervisor {
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = DefaultRestartBackoff
+	}
+	if cfg.MaxBackoff < cfg.Backoff {
+		cfg.MaxBackoff = max(DefaultMaxRestartBackoff, cfg.Backoff)
+	}
+	if cfg.MaxRestarts <= 0 {
+		cfg.MaxRestarts = DefaultMaxRestarts
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultRestartWindow
+	}
+	if cfg.DownAlertAfter <= 0 {
+		cfg.DownAlertAfter = DefaultDownAlertAfter
+	}
+	return &Supervisor{cfg: cfg, publish: publish}
+}
+
+// Publish is the publish func to hand the supervised connector.
+func (s *Supervisor) Publish(event protocol.Event) {
+	if event.Kind == "status" {
+		s.observe(event.Text)
+	}
+	s.publish(event)
+}
+
+// Run runs connector until ctx is done, restarting it whenever Run returns
+// early.
+func (s *Supervisor) Run(ctx context.Context, connector Connector) {
+	defer s.stopAlert()
+
+	backoff := s.cfg.Backoff
+	var restarts []time.Time
+	for {
+		started := time.Now()
+		connector.Run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		now := time.Now()
+		if now.Sub(started) >= stableRun {
+			backoff = s.cfg.Backoff
+		}
+
+		kept := restarts[:0]
+		for _, at := range restarts {
+			if now.Sub(at) < s.cfg.Window {
+				kept = append(kept, at)
+			}
+		}
+		restarts = kept
+
+		wait := jitter(backoff)
+		text := fmt.Sprintf("connector stopped; restarting in %s", wait.Round(time.Second))
+		if len(restarts) >= s.cfg.MaxRestarts {
+			wait = restarts[0].Add(s.cfg.Window).Sub(now)
+			text = fmt.Sprintf("connector stopped; %d restarts in %s, next attempt in %s", len(restarts), s.cfg.Window, wait.Round(time.Second))
+		}
+		s.Publish(protocol.Event{
+			Timestamp: now.UTC(),
+			Kind:      "status",
+			Direction: "system",
+			Text:      text,
+		})
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		restarts = append(restarts, time.Now())
+		backoff = min(backoff*2, s.cfg.MaxBackoff)
+	}
+}
+
+// observe follows the connector's health through a status text.
+func (s *Supervisor) observe(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch ClassifyStatus(text) {
+	case StatusDown:
+		if s.down || strings.HasPrefix(text, StatusDownAlert) {
+			return
+		}
+		s.down = true
+		s.downSince = time.Now()
+		s.downReason = text
+		s.outage++
+		outage := s.outage
+		s.alertTimer = time.AfterFunc(s.cfg.DownAlertAfter, func() { s.alertDown(outage) })
+	case StatusOnline, StatusStopped:
+		s.down = false
+		if s.alertTimer != nil {
+			s.alertTimer.Stop()
+			s.alertTimer = nil
+		}
+	}
+}
+
+// alertDown publishes the down alert if the outage it was armed for is
+// still going on.
+func (s *Supervisor) alertDown(outage int) {
+	s.mu.Lock()
+	if !s.down || s.outage != outage {
+		s.mu.Unlock()
+		return
+	}
+	text := fmt.Sprintf("%s%s (%s)", StatusDownAlert, time.Since(s.downSince).Round(time.Second), s.downReason)
+	s.mu.Unlock()
+
+	s.publish(protocol.Event{
+		Timestamp: time.Now().UTC(),
+		Kind:      "status",
+		Direction: "system",
+		Text:      text,
+	})
+}
+
+func (s *Supervisor) stopAlert() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.alertTimer != nil {
+		s.alertTimer.Stop()
+		s.alertTimer = nil
+	}
+}
+
+// jitter spreads d by ±20% so bots that failed together don't retry in
+// lockstep.
+func jitter(d time.Duration) time.Duration {
+	spread := int64(d) / 5
+	if spread <= 0 {
+		return d
+	}
+	return d + time.Duration(rand.Int64N(2*spread+1)-spread)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -19,18 +20,32 @@ import (
 
 const defaultTelegramEndpoint = "https://api.telegram.org"
 
+// defaultTelegramPoll is how long getUpdates waits for updates.
+const defaultTelegramPoll = 50 * time.Second
+
 type TelegramConnector struct {
 	serviceName string
 	botName     string
-	baseURL     string
-	token       string
+	endpoint    string
 	publish     func(protocol.Event)
 	httpClient  *http.Client
+	pollClient  *http.Client  // getUpdates; nil uses httpClient
+	pollTimeout time.Duration // how long getUpdates waits for updates
+	echoes      *echoFilter   // nil unless include_self
+	webhook     bool          // updates come through HandleWebhook instead of getUpdates
 
 	mu           sync.RWMutex
 	channels     map[string]struct{}
 	selfBotID    int64
+	selfUsername string
 	nextUpdateID int64
+	baseURL      string // the Bot API URL, ending in /bot<token>
+	webhookURL   string // with webhook, where Telegram delivers updates
+	secret       string // with webhook, the secret_token its callbacks carry
+
+	deliveries deliveryLog // update_ids of webhook callbacks, to drop redeliveries
+
+	voiceTranscriber
 }
 
 type tgGetMeResponse struct {
@@ -39,7 +54,8 @@ type tgGetMeResponse struct {
 }
 
 type tgBotUser struct {
-	ID int64 `json:"id"`
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
 }
 
 type tgGetUpdatesRequest struct {
@@ -54,11 +70,12 @@ type tgGetUpdatesResponse struct {
 }
 
 type tgUpdate struct {
-	UpdateID          int64      `json:"update_id"`
-	Message           *tgMessage `json:"message,omitempty"`
-	EditedMessage     *tgMessage `json:"edited_message,omitempty"`
-	ChannelPost       *tgMessage `json:"channel_post,omitempty"`
-	EditedChannelPost *tgMessage `json:"edited_channel_post,omitempty"`
+	UpdateID          int64            `json:"update_id"`
+	Message           *tgMessage       `json:"message,omitempty"`
+	EditedMessage     *tgMessage       `json:"edited_message,omitempty"`
+	ChannelPost       *tgMessage       `json:"channel_post,omitempty"`
+	EditedChannelPost *tgMessage       `json:"edited_channel_post,omitempty"`
+	CallbackQuery     *tgCallbackQuery `json:"callback_query,omitempty"`
 }
 
 type tgMessage struct {
@@ -70,10 +87,13 @@ type tgMessage struct {
 	From            *tgUser    `json:"from,omitempty"`
 	MessageThreadID int64      `json:"message_thread_id,omitempty"`
 	ReplyToMessage  *tgMessage `json:"reply_to_message,omitempty"`
+	Voice           *tgAudio   `json:"voice,omitempty"`
+	Audio           *tgAudio   `json:"audio,omitempty"`
 }
 
 type tgChat struct {
-	ID int64 `json:"id"`
+	ID   int64  `json:"id"`
+	Type string `json:"type"` // private, group, supergroup or channel
 }
 
 type tgUser struct {
@@ -87,6 +107,8 @@ type tgSendMessageRequest struct {
 	ParseMode        string `json:"parse_mode,omitempty"`
 	MessageThreadID  int64  `json:"message_thread_id,omitempty"`
 	ReplyToMessageID int64  `json:"reply_to_message_id,omitempty"`
+
+	ReplyMarkup *tgInlineKeyboard `json:"reply_markup,omitempty"`
 }
 
 type tgSendMessageResponse struct {
@@ -110,13 +132,24 @@ func NewTelegramConnector(bot config.BotConfig, publish func(protocol.Event)) (*
 		endpoint = defaultTelegramEndpoint
 	}
 
+	proxy, err := proxyFor(bot)
+	if err != nil {
+		return nil, err
+	}
+	httpOpts := bot.HTTPOptions()
+	pollTimeout := httpOpts.PollTimeoutOr(defaultTelegramPoll)
+
 	connector := &TelegramConnector{
 		serviceName: bot.Type,
 		botName:     bot.Name,
+		endpoint:    strings.TrimRight(endpoint, "/"),
 		baseURL:     strings.TrimRight(endpoint, "/") + "/bot" + token,
-		token:       token,
 		publish:     publish,
-		httpClient:  &http.Client{Timeout: 70 * time.Second},
+		httpClient:  newHTTPClient(proxy, httpOpts, 60*time.Second),
+		pollClient:  newPollClient(proxy, httpOpts, pollTimeout),
+		pollTimeout: pollTimeout,
+		echoes:      newEchoFilter(bot.IncludeSelf),
+		webhook:     bot.Transport == config.TransportWebhook,
 		channels:    make(map[string]struct{}),
 	}
 
@@ -152,9 +185,30 @@ func (t *TelegramConnector) Run(ctx context.Context) {
 			continue
 		}
 
-		backoff = time.Second
 		log.Printf("[telegram:%s] authenticated (bot_id=%d)", t.botName, t.selfBotID)
 		t.resolveChannelNames(ctx)
+
+		if t.webhook {
+			url, err := t.setWebhook(ctx)
+			if err != nil {
+				log.Printf("[telegram:%s] setWebhook failed: %v", t.botName, err)
+				t.publishStatus("telegram setWebhook failed: " + err.Error())
+				t.sleepOrDone(ctx, backoff)
+				if backoff < 30*time.Second {
+					backoff *= 2
+				}
+				continue
+			}
+			backoff = time.Second
+			log.Printf("[telegram:%s] taking updates at %s", t.botName, url)
+			t.publishStatus("connector online")
+			// The webhook stays set while pantalkd is down, so Telegram
+			// keeps the updates until it is back.
+			<-ctx.Done()
+			continue
+		}
+
+		backoff = time.Second
 		t.publishStatus("connector online")
 		t.pollLoop(ctx)
 	}
@@ -169,6 +223,13 @@ func (t *TelegramConnector) pollLoop(ctx context.Context) {
 		}
 
 		updates, err := t.getUpdates(ctx)
+		if errors.Is(err, errTelegramWebhookSet) {
+			// Left behind by an earlier run with transport: webhook.
+			log.Printf("[telegram:%s] removing the webhook set for this bot so getUpdates works", t.botName)
+			if err := t.deleteWebhook(ctx); err == nil {
+				continue
+			}
+		}
 		if err != nil {
 			t.publishStatus("telegram getUpdates error: " + err.Error())
 			t.sleepOrDone(ctx, 2*time.Second)
@@ -177,51 +238,67 @@ func (t *TelegramConnector) pollLoop(ctx context.Context) {
 
 		for _, update := range updates {
 			t.advanceOffset(update.UpdateID + 1)
-			message := selectTelegramMessage(update)
-			if message == nil {
-				continue
-			}
+			t.handleUpdate(ctx, update)
+		}
+	}
+}
 
-			if t.isSelfMessage(message) {
-				continue
-			}
+// handleUpdate publishes an update from getUpdates or the webhook.
+func (t *TelegramConnector) handleUpdate(ctx context.Context, update tgUpdate) {
+	if update.CallbackQuery != nil {
+		t.handleCallbackQuery(ctx, update.CallbackQuery)
+		return
+	}
+	message := selectTelegramMessage(update)
+	if message == nil {
+		return
+	}
 
-			channelID := strconv.FormatInt(message.Chat.ID, 10)
-			if !t.acceptsChannel(channelID) {
-				continue
-			}
+	channelID := strconv.FormatInt(message.Chat.ID, 10)
+	if !t.acceptsChannel(channelID) {
+		return
+	}
 
-			text := strings.TrimSpace(message.Text)
-			if text == "" {
-				text = strings.TrimSpace(message.Caption)
-			}
+	text := strings.TrimSpace(message.Text)
+	if text == "" {
+		text = strings.TrimSpace(message.Caption)
+	}
 
-			thread := ""
-			if message.MessageThreadID > 0 {
-				thread = strconv.FormatInt(message.MessageThreadID, 10)
-			} else if message.ReplyToMessage != nil && message.ReplyToMessage.MessageID > 0 {
-				thread = strconv.FormatInt(message.ReplyToMessage.MessageID, 10)
-			}
+	userID := ""
+	if message.From != nil {
+		userID = strconv.FormatInt(message.From.ID, 10)
+	}
 
-			userID := ""
-			if message.From != nil {
-				userID = strconv.FormatInt(message.From.ID, 10)
-			}
+	event := protocol.Event{
+		Timestamp: time.Unix(message.Date, 0).UTC(),
+		Service:   t.serviceName,
+		Bot:       t.botName,
+		Kind:      "message",
+		Direction: "in",
+		User:      userID,
+		Target:    "chat:" + channelID,
+		Channel:   channelID,
+		Thread:    telegramThread(message),
+		MessageID: strconv.FormatInt(message.MessageID, 10),
+		Text:      text,
+		Direct:    message.Chat.Type == "private",
+	}
+
+	if t.isSelfMessage(message) {
+		event.Direction, event.Direct = "out", false
+		t.echoes.echo(telegramMessageKey(message), func() { t.publish(event) })
+		return
+	}
 
-			t.publish(protocol.Event{
-				Timestamp: time.Unix(message.Date, 0).UTC(),
-				Service:   t.serviceName,
-				Bot:       t.botName,
-				Kind:      "message",
-				Direction: "in",
-				User:      userID,
-				Target:    "chat:" + channelID,
-				Channel:   channelID,
-				Thread:    thread,
-				Text:      text,
-			})
+	if audio, ok := telegramAudio(message); ok {
+		event.Attachments = []protocol.Attachment{audio}
+		download := func(ctx context.Context) ([]byte, error) {
+			return t.downloadFile(ctx, audio.ID)
 		}
+		t.publishVoice(ctx, event, download, t.publish)
+		return
 	}
+	t.publish(event)
 }
 
 func (t *TelegramConnector) Send(ctx context.Context, request protocol.Request) (protocol.Event, error) {
@@ -246,8 +323,11 @@ func (t *TelegramConnector) Send(ctx context.Context, request protocol.Request)
 	}
 
 	var lastEvent protocol.Event
-	for _, segment := range segments {
+	for i, segment := range segments {
 		payload := tgSendMessageRequest{ChatID: chatID, Text: segment.Text, ParseMode: segment.ParseMode}
+		if request.Interactive != nil && i == len(segments)-1 {
+			payload.ReplyMarkup = telegramKeyboard(request.Interactive)
+		}
 		if request.Thread != "" {
 			if threadID, parseErr := strconv.ParseInt(request.Thread, 10, 64); parseErr == nil {
 				payload.ReplyToMessageID = threadID
@@ -259,7 +339,7 @@ func (t *TelegramConnector) Send(ctx context.Context, request protocol.Request)
 			return protocol.Event{}, marshalErr
 		}
 
-		httpReq, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, t.baseURL+"/sendMessage", bytes.NewReader(body))
+		httpReq, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, t.apiURL()+"/sendMessage", bytes.NewReader(body))
 		if reqErr != nil {
 			return protocol.Event{}, reqErr
 		}
@@ -272,7 +352,7 @@ func (t *TelegramConnector) Send(ctx context.Context, request protocol.Request)
 
 		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 			resp.Body.Close()
-			return protocol.Event{}, fmt.Errorf("telegram sendMessage failed: status %d", resp.StatusCode)
+			return protocol.Event{}, statusError("telegram sendMessage", resp.StatusCode)
 		}
 
 		var sendResponse tgSendMessageResponse
@@ -284,6 +364,7 @@ func (t *TelegramConnector) Send(ctx context.Context, request protocol.Request)
 		if !sendResponse.OK {
 			return protocol.Event{}, fmt.Errorf("telegram sendMessage returned not ok")
 		}
+		t.echoes.claim(telegramMessageKey(&sendResponse.Result))
 
 		channel := strconv.FormatInt(sendResponse.Result.Chat.ID, 10)
 		thread := request.Thread
@@ -306,6 +387,7 @@ func (t *TelegramConnector) Send(ctx context.Context, request protocol.Request)
 			Target:    target,
 			Channel:   channel,
 			Thread:    thread,
+			MessageID: strconv.FormatInt(sendResponse.Result.MessageID, 10),
 			Text:      segment.Text,
 		}
 		t.publish(event)
@@ -316,60 +398,113 @@ func (t *TelegramConnector) Send(ctx context.Context, request protocol.Request)
 }
 
 func (t *TelegramConnector) loadSelf(ctx context.Context) error {
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, t.baseURL+"/getMe", nil)
+	me, err := t.getMe(ctx)
 	if err != nil {
 		return err
 	}
 
-	resp, err := t.httpClient.Do(httpReq)
+	t.mu.Lock()
+	t.selfBotID = me.ID
+	t.selfUsername = me.Username
+	t.mu.Unlock()
+
+	return nil
+}
+
+// apiURL returns the Bot API URL for the current token.
+func (t *TelegramConnector) apiURL() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.baseURL
+}
+
+// RotateToken implements TokenRotator. The new token must belong to the
+// same bot; the poll in flight finishes on the old one.
+func (t *TelegramConnector) RotateToken(ctx context.Context, token string) error {
+	baseURL := t.endpoint + "/bot" + token
+	me, err := t.getMeAt(ctx, baseURL)
 	if err != nil {
 		return err
 	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.selfBotID != 0 && me.ID != t.selfBotID {
+		return fmt.Errorf("new token belongs to bot %d (@%s), not %d", me.ID, me.Username, t.selfBotID)
+	}
+	t.baseURL = baseURL
+	return nil
+}
+
+func (t *TelegramConnector) getMe(ctx context.Context) (tgBotUser, error) {
+	return t.getMeAt(ctx, t.apiURL())
+}
+
+func (t *TelegramConnector) getMeAt(ctx context.Context, baseURL string) (tgBotUser, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/getMe", nil)
+	if err != nil {
+		return tgBotUser{}, err
+	}
+
+	resp, err := t.httpClient.Do(httpReq)
+	if err != nil {
+		return tgBotUser{}, err
+	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("getMe failed: status %d", resp.StatusCode)
+		return tgBotUser{}, fmt.Errorf("getMe failed: status %d", resp.StatusCode)
 	}
 
 	var me tgGetMeResponse
 	if err := json.NewDecoder(resp.Body).Decode(&me); err != nil {
-		return err
+		return tgBotUser{}, err
 	}
 	if !me.OK {
-		return fmt.Errorf("getMe returned not ok")
+		return tgBotUser{}, fmt.Errorf("getMe returned not ok")
 	}
+	return me.Result, nil
+}
 
-	t.mu.Lock()
-	t.selfBotID = me.Result.ID
-	t.mu.Unlock()
-
-	return nil
+// Verify implements Verifier with getMe.
+func (t *TelegramConnector) Verify(ctx context.Context) (Verification, error) {
+	me, err := t.getMe(ctx)
+	if err != nil {
+		return Verification{}, err
+	}
+	return Verification{User: me.Username, UserID: strconv.FormatInt(me.ID, 10)}, nil
 }
 
+// telegramAllowedUpdates are the update types the connector handles.
+var telegramAllowedUpdates = []string{"message", "edited_message", "channel_post", "edited_channel_post", "callback_query"}
+
 func (t *TelegramConnector) getUpdates(ctx context.Context) ([]tgUpdate, error) {
 	offset := t.currentOffset()
 	payload := tgGetUpdatesRequest{
 		Offset:         offset,
-		Timeout:        50,
-		AllowedUpdates: []string{"message", "edited_message", "channel_post", "edited_channel_post"},
+		Timeout:        int(t.pollTimeout / time.Second),
+		AllowedUpdates: telegramAllowedUpdates,
 	}
 	body, err := json.Marshal(payload)
 	if err != nil {
 		return nil, err
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.baseURL+"/getUpdates", bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.apiURL()+"/getUpdates", bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := t.httpClient.Do(httpReq)
+	resp, err := t.poller().Do(httpReq)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusConflict {
+		return nil, errTelegramWebhookSet
+	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		return nil, fmt.Errorf("getUpdates failed: status %d", resp.StatusCode)
 	}
@@ -385,6 +520,13 @@ func (t *TelegramConnector) getUpdates(ctx context.Context) ([]tgUpdate, error)
 	return updatesResponse.Result, nil
 }
 
+func (t *TelegramConnector) poller() *http.Client {
+	if t.pollClient != nil {
+		return t.pollClient
+	}
+	return t.httpClient
+}
+
 func (t *TelegramConnector) currentOffset() int64 {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
@@ -426,6 +568,19 @@ func (t *TelegramConnector) Identity() string {
 	return ""
 }
 
+// MentionNames returns the bot's @username.
+func (t *TelegramConnector) MentionNames() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return []string{t.selfUsername}
+}
+
+// telegramMessageKey identifies a message; message IDs are only unique
+// within their chat.
+func telegramMessageKey(message *tgMessage) string {
+	return strconv.FormatInt(message.Chat.ID, 10) + ":" + strconv.FormatInt(message.MessageID, 10)
+}
+
 func (t *TelegramConnector) isSelfMessage(message *tgMessage) bool {
 	if message == nil || message.From == nil {
 		return false
@@ -454,6 +609,18 @@ func (t *TelegramConnector) sleepOrDone(ctx context.Context, wait time.Duration)
 	}
 }
 
+// telegramThread is the thread of a message: its forum topic, or the
+// message it replies to.
+func telegramThread(message *tgMessage) string {
+	if message.MessageThreadID > 0 {
+		return strconv.FormatInt(message.MessageThreadID, 10)
+	}
+	if message.ReplyToMessage != nil && message.ReplyToMessage.MessageID > 0 {
+		return strconv.FormatInt(message.ReplyToMessage.MessageID, 10)
+	}
+	return ""
+}
+
 func selectTelegramMessage(update tgUpdate) *tgMessage {
 	if update.Message != nil {
 		return update.Message
@@ -489,6 +656,10 @@ func resolveTelegramChat(request protocol.Request) string {
 	return target
 }
 
+// telegramMaxText is how much text goes in one Telegram message, under the
+// 4096-character limit with room for entities; longer text is split.
+const telegramMaxText = 3500
+
 func prepareTelegramSegments(format string, text string) ([]telegramOutboundSegment, error) {
 	normalizedFormat, err := formatting.NormalizeFormat(format)
 	if err != nil {
@@ -504,10 +675,10 @@ func prepareTelegramSegments(format string, text string) ([]telegramOutboundSegm
 
 	switch normalizedFormat {
 	case formatting.FormatPlain:
-		chunks = formatting.SplitText(trimmed, 3500)
+		chunks = formatting.SplitText(trimmed, telegramMaxText)
 	case formatting.FormatHTML:
 		// Split HTML at block-element boundaries so tags are never torn apart.
-		chunks = formatting.SplitHTML(trimmed, 3500)
+		chunks = formatting.SplitHTML(trimmed, telegramMaxText)
 	case formatting.FormatMarkdown:
 		// Convert the entire document to HTML first so that multi-paragraph
 		// constructs (fenced code blocks, lists with blank lines, etc.) are
@@ -550,16 +721,24 @@ func (t *TelegramConnector) resolveChannelNames(ctx context.Context) {
 		return
 	}
 
-	t.mu.Lock()
-	defer t.mu.Unlock()
+	resolvedIDs := make(map[string]string, len(toResolve))
 	for _, name := range toResolve {
 		chatID, err := t.getChatID(ctx, name)
 		if err != nil {
 			log.Printf("[telegram:%s] could not resolve channel %q: %v – keeping as-is", t.botName, name, err)
 			continue
 		}
+		resolvedIDs[name] = strconv.FormatInt(chatID, 10)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, name := range toResolve {
+		resolved, ok := resolvedIDs[name]
+		if !ok {
+			continue
+		}
 		delete(t.channels, name)
-		resolved := strconv.FormatInt(chatID, 10)
 		t.channels[resolved] = struct{}{}
 		log.Printf("[telegram:%s] resolved channel %q → %s", t.botName, name, resolved)
 	}
@@ -571,7 +750,7 @@ func (t *TelegramConnector) getChatID(ctx context.Context, chatRef string) (int6
 		return 0, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.baseURL+"/getChat", bytes.NewReader(payload))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.apiURL()+"/getChat", bytes.NewReader(payload))
 	if err != nil {
 		return 0, err
 	}
@@ -605,7 +784,64 @@ func isTelegramChatID(s string) bool {
 	return err == nil
 }
 
+// Capabilities reports Telegram's features. Threads are replies or forum
+// topics, buttons render as an inline keyboard, and of the channel
+// operations only leaving is available to bots.
+func (t *TelegramConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{Threads: true, Interactive: true, Channels: true, MaxText: telegramMaxText}
+}
+
+// SendsWithoutSession implements SessionlessSender: sends are Bot API calls,
+// and Run only polls getUpdates, which a one-shot send must not take from a
+// running daemon.
+func (t *TelegramConnector) SendsWithoutSession() {}
+
 // React is not supported by the Telegram connector.
 func (t *TelegramConnector) React(_ context.Context, _ protocol.Request) error {
 	return fmt.Errorf("reactions are not supported by the telegram connector")
 }
+
+// JoinChannel is not possible on Telegram; of the channel operations, bots
+// can only leave chats.
+func (t *TelegramConnector) JoinChannel(context.Context, string) error {
+	return fmt.Errorf("telegram bots are added to chats by their members: %w", errors.ErrUnsupported)
+}
+
+func (t *TelegramConnector) LeaveChannel(ctx context.Context, channel string) error {
+	payload, err := json.Marshal(map[string]string{"chat_id": channel})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.apiURL()+"/leaveChat", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.OK {
+		return fmt.Errorf("leaveChat failed for %q: %s", channel, result.Description)
+	}
+	return nil
+}
+
+func (t *TelegramConnector) CreateChannel(context.Context, string, bool, string) (string, error) {
+	return "", fmt.Errorf("telegram bots cannot create chats: %w", errors.ErrUnsupported)
+}
+
+func (t *TelegramConnector) InviteToChannel(context.Context, string, []string) error {
+	return fmt.Errorf("telegram bots cannot add members to chats: %w", errors.ErrUnsupported)
+}
@@ -0,0 +1,129 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// telegramButtonsPerRow keeps button rows readable on phones.
+const telegramButtonsPerRow = 3
+
+type tgInlineKeyboard struct {
+	InlineKeyboard [][]tgInlineButton `json:"inline_keyboard"`
+}
+
+type tgInlineButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+type tgCallbackQuery struct {
+	ID      string     `json:"id"`
+	From    tgUser     `json:"from"`
+	Message *tgMessage `json:"message,omitempty"`
+	Data    string     `json:"data"`
+}
+
+type tgAnswerCallbackQueryRequest struct {
+	CallbackQueryID string `json:"callback_query_id"`
+}
+
+// telegramKeyboard renders the buttons three to a row. Telegram has no
+// select menu, so its options follow as one button per row; button styles
+// have no equivalent and are dropped.
+func telegramKeyboard(interactive *protocol.Interactive) *tgInlineKeyboard {
+	keyboard := &tgInlineKeyboard{}
+
+	var row []tgInlineButton
+	for _, button := range interactive.Buttons {
+		row = append(row, tgInlineButton{Text: button.Label, CallbackData: button.Value})
+		if len(row) == telegramButtonsPerRow {
+			keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, row)
+	}
+
+	if sel := interactive.Select; sel != nil {
+		for _, option := range sel.Options {
+			keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, []tgInlineButton{{Text: option.Label, CallbackData: option.Value}})
+		}
+	}
+
+	return keyboard
+}
+
+// handleCallbackQuery publishes a click on an inline keyboard button and
+// answers the query so the client stops showing a spinner.
+func (t *TelegramConnector) handleCallbackQuery(ctx context.Context, query *tgCallbackQuery) {
+	if err := t.answerCallbackQuery(ctx, query.ID); err != nil {
+		log.Printf("[telegram:%s] answer callback query failed: %v", t.botName, err)
+	}
+
+	event, ok := t.callbackEvent(query)
+	if !ok {
+		return
+	}
+	t.publish(event)
+}
+
+// callbackEvent converts a callback query to an interaction event. ok is
+// false for queries without data or a message, or from unwatched chats.
+func (t *TelegramConnector) callbackEvent(query *tgCallbackQuery) (protocol.Event, bool) {
+	if query.Data == "" || query.Message == nil {
+		return protocol.Event{}, false
+	}
+
+	channelID := strconv.FormatInt(query.Message.Chat.ID, 10)
+	if !t.acceptsChannel(channelID) {
+		return protocol.Event{}, false
+	}
+
+	return protocol.Event{
+		Timestamp: time.Now().UTC(),
+		Service:   t.serviceName,
+		Bot:       t.botName,
+		Kind:      protocol.KindInteraction,
+		Direction: "in",
+		User:      strconv.FormatInt(query.From.ID, 10),
+		Target:    "chat:" + channelID,
+		Channel:   channelID,
+		Thread:    telegramThread(query.Message),
+		MessageID: strconv.FormatInt(query.Message.MessageID, 10),
+		Text:      query.Data,
+	}, true
+}
+
+func (t *TelegramConnector) answerCallbackQuery(ctx context.Context, id string) error {
+	body, err := json.Marshal(tgAnswerCallbackQueryRequest{CallbackQueryID: id})
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.apiURL()+"/answerCallbackQuery", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("answerCallbackQuery failed: status %d", resp.StatusCode)
+	}
+	return nil
+}
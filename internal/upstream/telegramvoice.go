@@ -0,0 +1,110 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/transcribe"
+)
+
+// tgAudio is a voice note (Message.Voice) or an uploaded audio file
+// (Message.Audio); the two share these fields.
+type tgAudio struct {
+	FileID   string `json:"file_id"`
+	Duration int    `json:"duration"`
+	MimeType string `json:"mime_type,omitempty"`
+	FileSize int64  `json:"file_size,omitempty"`
+	FileName string `json:"file_name,omitempty"`
+}
+
+type tgGetFileRequest struct {
+	FileID string `json:"file_id"`
+}
+
+type tgGetFileResponse struct {
+	OK     bool `json:"ok"`
+	Result struct {
+		FilePath string `json:"file_path"`
+	} `json:"result"`
+	Description string `json:"description,omitempty"`
+}
+
+// telegramAudio returns the audio attachment of message, if any.
+func telegramAudio(message *tgMessage) (protocol.Attachment, bool) {
+	audio, voice := message.Voice, true
+	if audio == nil {
+		audio, voice = message.Audio, false
+	}
+	if audio == nil {
+		return protocol.Attachment{}, false
+	}
+
+	mimeType := audio.MimeType
+	if mimeType == "" && voice {
+		mimeType = "audio/ogg"
+	}
+	return protocol.Attachment{
+		Kind:     protocol.AttachmentAudio,
+		ID:       audio.FileID,
+		Name:     audio.FileName,
+		MimeType: mimeType,
+		Size:     audio.FileSize,
+		Duration: float64(audio.Duration),
+		Voice:    voice,
+	}, true
+}
+
+// downloadFile fetches a file the bot received, resolving its download
+// path with getFile first.
+func (t *TelegramConnector) downloadFile(ctx context.Context, fileID string) ([]byte, error) {
+	body, err := json.Marshal(tgGetFileRequest{FileID: fileID})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.apiURL()+"/getFile", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var file tgGetFileResponse
+	if err := json.NewDecoder(resp.Body).Decode(&file); err != nil {
+		return nil, fmt.Errorf("decode getFile response: %w", err)
+	}
+	if !file.OK || file.Result.FilePath == "" {
+		return nil, fmt.Errorf("getFile failed: %s", file.Description)
+	}
+
+	// Files are served from /file/bot<token>/<path> next to /bot<token>.
+	base := t.apiURL()
+	i := strings.LastIndex(base, "/bot")
+	fileURL := base[:i] + "/file" + base[i:] + "/" + file.Result.FilePath
+	fileReq, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	fileResp, err := t.httpClient.Do(fileReq)
+	if err != nil {
+		return nil, err
+	}
+	defer fileResp.Body.Close()
+
+	if fileResp.StatusCode < 200 || fileResp.StatusCode >= 300 {
+		return nil, fmt.Errorf("file download failed: status %d", fileResp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(fileResp.Body, transcribe.MaxAudioSize))
+}
@@ -0,0 +1,110 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// errTelegramWebhookSet is what getUpdates fails with while the bot has a
+// webhook set: Telegram answers 409 Conflict.
+var errTelegramWebhookSet = errors.New("getUpdates conflicts with a webhook set for the bot")
+
+// telegramSecretHeader carries the secret_token given to setWebhook.
+const telegramSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// SetWebhookEndpoint records the URL Telegram should deliver updates to and
+// the secret_token its callbacks must carry. Run registers them with
+// setWebhook.
+func (t *TelegramConnector) SetWebhookEndpoint(url string, secret string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.webhookURL = url
+	t.secret = secret
+}
+
+// HandleWebhook takes an update Telegram posted to the webhook and handles
+// it as one returned by getUpdates, after returning so Telegram isn't kept
+// waiting. Redeliveries of an update_id already taken are dropped.
+func (t *TelegramConnector) HandleWebhook(ctx context.Context, header http.Header, body []byte) ([]byte, error) {
+	if !t.webhook {
+		return nil, ErrNotWebhook
+	}
+
+	t.mu.RLock()
+	secret := t.secret
+	t.mu.RUnlock()
+	if secret == "" || subtle.ConstantTimeCompare([]byte(header.Get(telegramSecretHeader)), []byte(secret)) != 1 {
+		return nil, fmt.Errorf("%w: secret token mismatch", ErrWebhookUnauthorized)
+	}
+
+	var update tgUpdate
+	if err := json.Unmarshal(body, &update); err != nil {
+		return nil, fmt.Errorf("parse telegram update: %w", err)
+	}
+	if update.UpdateID != 0 && t.deliveries.seen(strconv.FormatInt(update.UpdateID, 10)) {
+		return nil, nil
+	}
+	// Handling, with voice transcription and callback answers, outlives
+	// the request.
+	go t.handleUpdate(context.WithoutCancel(ctx), update)
+	return nil, nil
+}
+
+// setWebhook points the bot's updates at the webhook URL and returns it.
+func (t *TelegramConnector) setWebhook(ctx context.Context) (string, error) {
+	t.mu.RLock()
+	url, secret := t.webhookURL, t.secret
+	t.mu.RUnlock()
+	if url == "" {
+		return "", errors.New("no webhook URL: set server.http_addr")
+	}
+
+	err := t.callWebhookMethod(ctx, "setWebhook", map[string]any{
+		"url":             url,
+		"secret_token":    secret,
+		"allowed_updates": telegramAllowedUpdates,
+	})
+	return url, err
+}
+
+// deleteWebhook removes the bot's webhook so getUpdates works again.
+func (t *TelegramConnector) deleteWebhook(ctx context.Context) error {
+	return t.callWebhookMethod(ctx, "deleteWebhook", map[string]any{})
+}
+
+func (t *TelegramConnector) callWebhookMethod(ctx context.Context, method string, params map[string]any) error {
+	payload, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.apiURL()+"/"+method, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.OK {
+		return fmt.Errorf("%s failed: %s", method, result.Description)
+	}
+	return nil
+}
@@ -35,20 +35,34 @@ type TwilioConnector struct {
 	channels     map[string]struct{}
 	lastPollTime time.Time
 	seenMessages map[string]struct{}
+	pending      map[string]twilioPending // SID -> sent message still on its way
 }
 
+// twilioPending is a sent message whose status is polled until it is
+// read, delivered as SMS, or fails.
+type twilioPending struct {
+	channel string
+	status  string
+	sentAt  time.Time
+}
+
+// twilioReceiptWindow is how long a sent message's status is polled for.
+const twilioReceiptWindow = time.Hour
+
 type twilioMessageList struct {
 	Messages []twilioMessage `json:"messages"`
 }
 
 type twilioMessage struct {
-	SID         string `json:"sid"`
-	Body        string `json:"body"`
-	From        string `json:"from"`
-	To          string `json:"to"`
-	Status      string `json:"status"`
-	Direction   string `json:"direction"`
-	DateCreated string `json:"date_created"`
+	SID          string `json:"sid"`
+	Body         string `json:"body"`
+	From         string `json:"from"`
+	To           string `json:"to"`
+	Status       string `json:"status"`
+	Direction    string `json:"direction"`
+	DateCreated  string `json:"date_created"`
+	ErrorCode    int    `json:"error_code"`
+	ErrorMessage string `json:"error_message"`
 }
 
 type twilioSendResponse struct {
@@ -76,6 +90,11 @@ func NewTwilioConnector(bot config.BotConfig, publish func(protocol.Event)) (*Tw
 		return nil, fmt.Errorf("twilio bot %q requires phone_number (Twilio phone number in E.164 format)", bot.Name)
 	}
 
+	proxy, err := proxyFor(bot)
+	if err != nil {
+		return nil, err
+	}
+
 	connector := &TwilioConnector{
 		serviceName:  bot.Type,
 		botName:      bot.Name,
@@ -84,9 +103,10 @@ func NewTwilioConnector(bot config.BotConfig, publish func(protocol.Event)) (*Tw
 		authToken:    authToken,
 		phoneNumber:  phoneNumber,
 		publish:      publish,
-		httpClient:   &http.Client{Timeout: 30 * time.Second},
+		httpClient:   newHTTPClient(proxy, bot.HTTPOptions(), 30*time.Second),
 		channels:     make(map[string]struct{}),
 		seenMessages: make(map[string]struct{}),
+		pending:      make(map[string]twilioPending),
 	}
 
 	for _, channel := range bot.Channels {
@@ -156,6 +176,10 @@ func (t *TwilioConnector) pollLoop(ctx context.Context) {
 			for _, msg := range messages {
 				t.handleIncomingMessage(msg)
 			}
+
+			if err := t.pollStatuses(ctx); err != nil {
+				t.publishStatus("twilio status poll error: " + err.Error())
+			}
 		}
 	}
 }
@@ -200,7 +224,7 @@ func (t *TwilioConnector) Send(ctx context.Context, request protocol.Request) (p
 
 		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 			resp.Body.Close()
-			return protocol.Event{}, fmt.Errorf("twilio send failed: status %d", resp.StatusCode)
+			return protocol.Event{}, statusError("twilio send", resp.StatusCode)
 		}
 
 		var sendResp twilioSendResponse
@@ -225,9 +249,11 @@ func (t *TwilioConnector) Send(ctx context.Context, request protocol.Request) (p
 			Target:    target,
 			Channel:   toNumber,
 			Thread:    sendResp.SID,
+			MessageID: sendResp.SID,
 			Text:      segmentText,
 		}
 		t.publish(event)
+		t.trackStatus(sendResp.SID, toNumber, sendResp.Status, "")
 		lastEvent = event
 	}
 
@@ -315,6 +341,122 @@ func (t *TwilioConnector) fetchNewMessages(ctx context.Context) ([]twilioMessage
 	return newMessages, nil
 }
 
+// pollStatuses lists the messages sent recently and reports the status
+// changes of those still on their way.
+func (t *TwilioConnector) pollStatuses(ctx context.Context) error {
+	t.mu.Lock()
+	for sid, pending := range t.pending {
+		if time.Since(pending.sentAt) > twilioReceiptWindow {
+			delete(t.pending, sid)
+		}
+	}
+	waiting := len(t.pending)
+	t.mu.Unlock()
+	if waiting == 0 {
+		return nil
+	}
+
+	params := url.Values{}
+	params.Set("From", t.phoneNumber)
+	params.Set("PageSize", "100")
+	apiURL := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json?%s", t.baseURL, t.accountSID, params.Encode())
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return err
+	}
+	httpReq.SetBasicAuth(t.accountSID, t.authToken)
+
+	resp, err := t.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("twilio list messages failed: status %d", resp.StatusCode)
+	}
+
+	var msgList twilioMessageList
+	if err := json.NewDecoder(resp.Body).Decode(&msgList); err != nil {
+		return err
+	}
+	for _, msg := range msgList.Messages {
+		reason := msg.ErrorMessage
+		if reason == "" && msg.ErrorCode != 0 {
+			reason = fmt.Sprintf("error %d", msg.ErrorCode)
+		}
+		t.trackStatus(msg.SID, "", msg.Status, reason)
+	}
+	return nil
+}
+
+// trackStatus publishes a receipt when a sent message's Twilio status maps
+// to a new delivery status, and keeps polling it until it is read or fails.
+// Messages sent as SMS go no further than delivered, so those stop there;
+// WhatsApp ones (to a whatsapp: address) are followed on to read. channel
+// is only needed when the message is first tracked.
+func (t *TwilioConnector) trackStatus(sid string, channel string, twilioStatus string, reason string) {
+	status := twilioDeliveryStatus(twilioStatus)
+
+	t.mu.Lock()
+	pending, tracked := t.pending[sid]
+	if !tracked {
+		if channel == "" {
+			t.mu.Unlock()
+			return
+		}
+		pending = twilioPending{channel: channel, sentAt: time.Now()}
+	}
+	if status == "" || status == pending.status {
+		t.pending[sid] = pending
+		t.mu.Unlock()
+		return
+	}
+	pending.status = status
+	readable := strings.HasPrefix(pending.channel, "whatsapp:")
+	if status == protocol.StatusQueued || status == protocol.StatusSent || (status == protocol.StatusDelivered && readable) {
+		t.pending[sid] = pending
+	} else {
+		delete(t.pending, sid)
+	}
+	t.mu.Unlock()
+
+	if status != protocol.StatusFailed {
+		reason = ""
+	}
+	t.publish(protocol.Event{
+		Timestamp: time.Now().UTC(),
+		Service:   t.serviceName,
+		Bot:       t.botName,
+		Kind:      protocol.KindReceipt,
+		Direction: "out",
+		Target:    "phone:" + pending.channel,
+		Channel:   pending.channel,
+		MessageID: sid,
+		Status:    status,
+		Text:      reason,
+	})
+}
+
+// twilioDeliveryStatus maps a Twilio message status to a delivery status,
+// or "" for those that aren't one, such as received.
+func twilioDeliveryStatus(status string) string {
+	switch status {
+	case "accepted", "scheduled", "queued", "sending":
+		return protocol.StatusQueued
+	case "sent":
+		return protocol.StatusSent
+	case "delivered":
+		return protocol.StatusDelivered
+	case "read":
+		return protocol.StatusRead
+	case "undelivered", "failed", "canceled":
+		return protocol.StatusFailed
+	}
+	return ""
+}
+
 func (t *TwilioConnector) handleIncomingMessage(msg twilioMessage) {
 	from := msg.From
 	if !t.acceptsChannel(from) {
@@ -336,7 +478,9 @@ func (t *TwilioConnector) handleIncomingMessage(msg twilioMessage) {
 		Target:    "phone:" + from,
 		Channel:   from,
 		Thread:    msg.SID,
+		MessageID: msg.SID,
 		Text:      text,
+		Direct:    true, // every SMS is one-to-one
 	})
 }
 
@@ -387,6 +531,9 @@ func (t *TwilioConnector) sleepOrDone(ctx context.Context, wait time.Duration) {
 	}
 }
 
+// twilioMaxText is Twilio's limit on one message body.
+const twilioMaxText = 1600
+
 // prepareTwilioSegments converts the message to plain text (SMS has no markup
 // support) and splits it to respect the Twilio 1600-character body limit.
 func prepareTwilioSegments(format string, text string) ([]string, error) {
@@ -409,7 +556,7 @@ func prepareTwilioSegments(format string, text string) ([]string, error) {
 	}
 
 	// Twilio SMS body limit is 1600 characters.
-	return formatting.SplitText(trimmed, 1600), nil
+	return formatting.SplitText(trimmed, twilioMaxText), nil
 }
 
 // resolveTwilioChannel extracts a phone number from the request's channel or
@@ -452,6 +599,16 @@ func parseTwilioDate(dateStr string) time.Time {
 	return time.Now().UTC()
 }
 
+// Capabilities reports that the Twilio connector has receipts and none of
+// the other optional features.
+func (t *TwilioConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{Receipts: true, MaxText: twilioMaxText}
+}
+
+// SendsWithoutSession implements SessionlessSender: Twilio messages are sent
+// with the REST API alone.
+func (t *TwilioConnector) SendsWithoutSession() {}
+
 // React is not supported by the Twilio connector.
 func (t *TwilioConnector) React(_ context.Context, _ protocol.Request) error {
 	return fmt.Errorf("reactions are not supported by the twilio connector")
@@ -1,22 +1,43 @@
 package upstream
 
 import (
+	"bufio"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/bwmarrin/discordgo"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/proto/waE2E"
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 	"google.golang.org/protobuf/proto"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
 
 	"github.com/pantalk/pantalk/internal/config"
 	"github.com/pantalk/pantalk/internal/protocol"
@@ -161,15 +182,20 @@ func TestMockConnector_Send(t *testing.T) {
 	if event.Direction != "out" {
 		t.Fatalf("expected direction 'out', got %q", event.Direction)
 	}
+	if event.MessageID == "" {
+		t.Fatal("expected a message id")
+	}
 
 	// Wait for the async echo event from the mock goroutine.
 	time.Sleep(500 * time.Millisecond)
 
 	mu.Lock()
-	count := len(published)
-	mu.Unlock()
-	if count < 1 {
-		t.Fatal("expected at least 1 published event")
+	defer mu.Unlock()
+	if len(published) != 2 {
+		t.Fatalf("expected the send and its echo, got %d events", len(published))
+	}
+	if published[0].MessageID != event.MessageID || published[1].MessageID == event.MessageID {
+		t.Fatalf("unexpected message ids: %q then %q", published[0].MessageID, published[1].MessageID)
 	}
 }
 
@@ -189,6 +215,82 @@ func TestMockConnector_ReactNotSupported(t *testing.T) {
 	}
 }
 
+func TestMockBotConnector_Scenario(t *testing.T) {
+	scenario := filepath.Join(t.TempDir(), "scenario.yaml")
+	script := "replies:\n  - match: '^deploy (\\S+)'\n    reply: 'deploying $1'\n    user: U0RELEASE\n    delay: 10\n"
+	if err := os.WriteFile(scenario, []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan protocol.Event, 4)
+	echo := false
+	mock, err := NewMockBotConnector(config.BotConfig{
+		Name: "bot",
+		Type: "mock",
+		Mock: &config.MockConfig{Scenario: scenario, Echo: &echo},
+	}, func(ev protocol.Event) { events <- ev })
+	if err != nil {
+		t.Fatalf("new mock: %v", err)
+	}
+
+	if _, err := mock.Send(context.Background(), protocol.Request{Channel: "C1", Thread: "7", Text: "deploy api"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	<-events // the send itself
+	select {
+	case reply := <-events:
+		if reply.Text != "deploying api" || reply.User != "U0RELEASE" || reply.Thread != "7" || reply.Direction != "in" {
+			t.Fatalf("unexpected reply: %+v", reply)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the scripted reply")
+	}
+
+	if _, err := mock.Send(context.Background(), protocol.Request{Channel: "C1", Text: "hello"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	<-events
+	select {
+	case reply := <-events:
+		t.Fatalf("expected no echo with echo: false, got %+v", reply)
+	case <-time.After(400 * time.Millisecond):
+	}
+}
+
+func TestMockBotConnector_Inject(t *testing.T) {
+	events := make(chan protocol.Event, 1)
+	mock, err := NewMockBotConnector(config.BotConfig{Name: "bot", Type: "mock"}, func(ev protocol.Event) { events <- ev })
+	if err != nil {
+		t.Fatalf("new mock: %v", err)
+	}
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/messages", "application/json", strings.NewReader(`{"user":"U1","text":"@bot status?","direct":true}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	event := <-events
+	if event.Direction != "in" || !event.Direct || event.Target != "dm:U1" || event.User != "U1" || event.Text != "@bot status?" {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+
+	for _, body := range []string{`{"text":"no channel"}`, `{"channel":"C1","text":" "}`, `{"channel":"C1","text":"x","bogus":1}`} {
+		resp, err := http.Post(srv.URL+"/messages", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d, want 400", body, resp.StatusCode)
+		}
+	}
+}
+
 // --- WhatsApp tests ---
 
 func TestResolveWhatsAppJID(t *testing.T) {
@@ -544,6 +646,162 @@ func TestIRCAcceptsChannel(t *testing.T) {
 	})
 }
 
+// ircTestServer accepts one connection and lets the test script the server
+// side: expect checks the next line from the client, reply sends one.
+type ircTestServer struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newIRCTestServer(t *testing.T) (string, <-chan *ircTestServer) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	accepted := make(chan *ircTestServer, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		t.Cleanup(func() { conn.Close() })
+		accepted <- &ircTestServer{t: t, conn: conn, reader: bufio.NewReader(conn)}
+	}()
+	return listener.Addr().String(), accepted
+}
+
+func (s *ircTestServer) expect(want string) {
+	s.t.Helper()
+	_ = s.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := s.reader.ReadString('\n')
+	if err != nil {
+		s.t.Fatalf("waiting for %q: %v", want, err)
+	}
+	if got := strings.TrimRight(line, "\r\n"); got != want {
+		s.t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func (s *ircTestServer) reply(line string) {
+	s.t.Helper()
+	if _, err := fmt.Fprintf(s.conn, "%s\r\n", line); err != nil {
+		s.t.Fatalf("write %q: %v", line, err)
+	}
+}
+
+func TestIRCConnector_SASLNickServAndAltNick(t *testing.T) {
+	endpoint, accepted := newIRCTestServer(t)
+	plain := false
+	connector, err := NewIRCConnector(config.BotConfig{
+		Name:     "bot",
+		Type:     "irc",
+		Endpoint: endpoint,
+		Channels: []string{"#ops"},
+		IRC: &config.IRCConfig{
+			TLS:              &plain,
+			SASL:             "plain",
+			SASLUser:         "acct",
+			SASLPassword:     "secret",
+			NickServPassword: "ns-secret",
+			AltNicks:         []string{"bot-alt"},
+		},
+	}, func(protocol.Event) {})
+	if err != nil {
+		t.Fatalf("new irc connector: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go connector.Run(ctx)
+
+	srv := <-accepted
+	srv.expect("CAP REQ :sasl")
+	srv.expect("NICK bot")
+	srv.expect("USER bot 0 * :bot")
+
+	srv.reply(":srv 433 * bot :Nickname is already in use")
+	srv.expect("NICK bot-alt")
+
+	srv.reply(":srv CAP * ACK :sasl")
+	srv.expect("AUTHENTICATE PLAIN")
+	srv.reply("AUTHENTICATE +")
+	srv.expect("AUTHENTICATE " + base64.StdEncoding.EncodeToString([]byte("acct\x00acct\x00secret")))
+	srv.reply(":srv 903 bot-alt :SASL authentication successful")
+	srv.expect("CAP END")
+
+	srv.reply(":srv 001 bot-alt :Welcome")
+	srv.expect("PRIVMSG NickServ :IDENTIFY acct ns-secret")
+	srv.reply(":srv 900 bot-alt bot-alt!u@h acct :You are now logged in as acct")
+	srv.expect("JOIN #ops")
+
+	if got := connector.Identity(); got != "bot-alt" {
+		t.Fatalf("expected the alternate nick in use, got %q", got)
+	}
+}
+
+func TestIRCConnector_SASLFailure(t *testing.T) {
+	endpoint, accepted := newIRCTestServer(t)
+	plain := false
+	connector, err := NewIRCConnector(config.BotConfig{
+		Name:     "bot",
+		Type:     "irc",
+		Endpoint: endpoint,
+		IRC:      &config.IRCConfig{TLS: &plain, SASL: "plain", SASLPassword: "wrong"},
+	}, func(protocol.Event) {})
+	if err != nil {
+		t.Fatalf("new irc connector: %v", err)
+	}
+
+	result := make(chan error, 1)
+	go func() { result <- connector.connectAndRun(context.Background()) }()
+
+	srv := <-accepted
+	srv.expect("CAP REQ :sasl")
+	srv.expect("NICK bot")
+	srv.expect("USER bot 0 * :bot")
+	srv.reply(":srv CAP * ACK :sasl")
+	srv.expect("AUTHENTICATE PLAIN")
+	srv.reply("AUTHENTICATE +")
+	srv.expect("AUTHENTICATE " + base64.StdEncoding.EncodeToString([]byte("bot\x00bot\x00wrong")))
+	srv.reply(":srv 904 bot :SASL authentication failed")
+
+	select {
+	case err := <-result:
+		if err == nil || !strings.Contains(err.Error(), "sasl authentication failed") {
+			t.Fatalf("expected a sasl error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not closed after sasl failure")
+	}
+}
+
+func TestIRCNextNick(t *testing.T) {
+	c := &IRCConnector{nicks: []string{"bot", "bot2"}, nick: "bot"}
+	for _, want := range []string{"bot2", "bot2_", "bot2__"} {
+		c.nick = c.nextNick()
+		if c.nick != want {
+			t.Fatalf("expected %q, got %q", want, c.nick)
+		}
+	}
+}
+
+func TestSASLPlainChunks(t *testing.T) {
+	if got := saslPlainChunks("bot", "pw"); len(got) != 1 || got[0] != base64.StdEncoding.EncodeToString([]byte("bot\x00bot\x00pw")) {
+		t.Fatalf("unexpected short payload: %q", got)
+	}
+
+	// 298 bytes encode to exactly 400 base64 characters, so a "+" has to
+	// mark the end of the response.
+	got := saslPlainChunks("u", strings.Repeat("p", 294))
+	if len(got) != 2 || len(got[0]) != 400 || got[1] != "+" {
+		t.Fatalf("expected a full chunk and a terminator, got %d chunks (%q)", len(got), got[len(got)-1])
+	}
+}
+
 func TestWhatsAppAcceptsChannel(t *testing.T) {
 	t.Run("empty allowlist accepts all", func(t *testing.T) {
 		c := &WhatsAppConnector{channels: map[string]struct{}{}}
@@ -575,6 +833,76 @@ func TestWhatsAppAcceptsChannel(t *testing.T) {
 	})
 }
 
+func TestWhatsAppMediaDownload(t *testing.T) {
+	published := make(chan protocol.Event, 1)
+	mediaDir := filepath.Join(t.TempDir(), "media")
+	c := &WhatsAppConnector{
+		serviceName: "whatsapp",
+		botName:     "test",
+		channels:    map[string]struct{}{},
+		mediaDir:    mediaDir,
+		publish:     func(ev protocol.Event) { published <- ev },
+		download: func(_ context.Context, message *waE2E.Message) ([]byte, error) {
+			if message.GetDocumentMessage().GetFileName() == "broken.pdf" {
+				return nil, errors.New("media expired")
+			}
+			return []byte("media bytes"), nil
+		},
+	}
+	chat := types.NewJID("15551234567", types.DefaultUserServer)
+	receive := func(id string, message *waE2E.Message) protocol.Event {
+		c.handleMessage(&events.Message{
+			Info:    types.MessageInfo{ID: id, MessageSource: types.MessageSource{Chat: chat, Sender: chat}},
+			Message: message,
+		})
+		select {
+		case ev := <-published:
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event published")
+			return protocol.Event{}
+		}
+	}
+
+	ev := receive("3EB0IMAGE", &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+		Mimetype:   proto.String("image/jpeg"),
+		FileLength: proto.Uint64(11),
+		Caption:    proto.String("the whiteboard"),
+	}})
+	if ev.Text != "the whiteboard" || len(ev.Attachments) != 1 {
+		t.Fatalf("unexpected image event: %+v", ev)
+	}
+	image := ev.Attachments[0]
+	if image.Kind != protocol.AttachmentImage || image.Path != filepath.Join(mediaDir, "3EB0IMAGE.jpg") {
+		t.Errorf("unexpected image attachment: %+v", image)
+	}
+	if data, err := os.ReadFile(image.Path); err != nil || string(data) != "media bytes" {
+		t.Errorf("expected the media saved, got %q (%v)", data, err)
+	}
+
+	ev = receive("3EB0DOC", &waE2E.Message{DocumentMessage: &waE2E.DocumentMessage{
+		FileName: proto.String("broken.pdf"),
+		Mimetype: proto.String("application/pdf"),
+	}})
+	if doc := ev.Attachments[0]; doc.Kind != protocol.AttachmentFile || doc.Name != "broken.pdf" || doc.Path != "" {
+		t.Errorf("expected the document reported without a path, got %+v", doc)
+	}
+}
+
+func TestWhatsAppMediaMessage(t *testing.T) {
+	uploaded := whatsmeow.UploadResponse{URL: "https://mmg.whatsapp.net/x", DirectPath: "/v/x", MediaKey: []byte{1}, FileLength: 42}
+
+	image := whatsAppMediaMessage(protocol.Attachment{Kind: protocol.AttachmentImage, MimeType: "image/png"}, uploaded, "chart")
+	if img := image.GetImageMessage(); img.GetCaption() != "chart" || img.GetDirectPath() != "/v/x" || img.GetFileLength() != 42 {
+		t.Errorf("unexpected image message: %v", image)
+	}
+
+	doc := whatsAppMediaMessage(protocol.Attachment{Kind: protocol.AttachmentFile, Name: "report.pdf", MimeType: "application/pdf"}, uploaded, "")
+	if d := doc.GetDocumentMessage(); d.GetFileName() != "report.pdf" || d.Caption != nil || d.GetMimetype() != "application/pdf" {
+		t.Errorf("unexpected document message: %v", doc)
+	}
+}
+
 // --- Matrix tests ---
 
 func TestResolveMatrixRoom(t *testing.T) {
@@ -709,6 +1037,155 @@ func TestTwilioAcceptsChannel(t *testing.T) {
 	})
 }
 
+func TestTwilioReceipts(t *testing.T) {
+	status := "sent"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			fmt.Fprint(w, `{"sid":"SM1","status":"queued","date_created":"Thu, 01 Feb 2024 12:30:00 +0000"}`)
+		case http.MethodGet:
+			if r.URL.Query().Get("From") != "+15550000000" {
+				t.Errorf("expected sent messages listed, got %s", r.URL.RawQuery)
+			}
+			fmt.Fprintf(w, `{"messages":[{"sid":"SM1","status":%q,"direction":"outbound-api","error_code":30003,"error_message":null}]}`, status)
+		}
+	}))
+	defer srv.Close()
+
+	var events []protocol.Event
+	c := &TwilioConnector{
+		serviceName: "twilio",
+		botName:     "sms",
+		baseURL:     srv.URL,
+		phoneNumber: "+15550000000",
+		httpClient:  srv.Client(),
+		publish:     func(event protocol.Event) { events = append(events, event) },
+		channels:    map[string]struct{}{},
+		pending:     map[string]twilioPending{},
+	}
+
+	if _, err := c.Send(context.Background(), protocol.Request{Channel: "+15551234567", Text: "hi"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	for _, next := range []string{"sent", "sent", "undelivered"} {
+		status = next
+		if err := c.pollStatuses(context.Background()); err != nil {
+			t.Fatalf("poll statuses: %v", err)
+		}
+	}
+
+	var receipts []string
+	for _, event := range events {
+		if event.Kind == protocol.KindReceipt {
+			if event.MessageID != "SM1" || event.Channel != "+15551234567" {
+				t.Errorf("unexpected receipt %+v", event)
+			}
+			receipts = append(receipts, event.Status+":"+event.Text)
+		}
+	}
+	want := []string{"queued:", "sent:", "failed:error 30003"}
+	if !reflect.DeepEqual(receipts, want) {
+		t.Fatalf("expected receipts %v, got %v", want, receipts)
+	}
+	if len(c.pending) != 0 {
+		t.Fatalf("expected the failed message no longer polled, got %v", c.pending)
+	}
+}
+
+func TestTwilioReceipts_WhatsAppUntilRead(t *testing.T) {
+	status := "sent"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			fmt.Fprint(w, `{"sid":"SM1","status":"queued","date_created":"Thu, 01 Feb 2024 12:30:00 +0000"}`)
+		case http.MethodGet:
+			fmt.Fprintf(w, `{"messages":[{"sid":"SM1","status":%q,"direction":"outbound-api"}]}`, status)
+		}
+	}))
+	defer srv.Close()
+
+	var receipts []string
+	c := &TwilioConnector{
+		serviceName: "twilio",
+		botName:     "wa",
+		baseURL:     srv.URL,
+		phoneNumber: "whatsapp:+15550000000",
+		httpClient:  srv.Client(),
+		publish: func(event protocol.Event) {
+			if event.Kind == protocol.KindReceipt {
+				receipts = append(receipts, event.Status)
+			}
+		},
+		channels: map[string]struct{}{},
+		pending:  map[string]twilioPending{},
+	}
+
+	if _, err := c.Send(context.Background(), protocol.Request{Channel: "whatsapp:+15551234567", Text: "hi"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	for _, next := range []string{"delivered", "delivered", "read"} {
+		status = next
+		if err := c.pollStatuses(context.Background()); err != nil {
+			t.Fatalf("poll statuses: %v", err)
+		}
+		if next == "delivered" && len(c.pending) != 1 {
+			t.Fatal("expected a delivered WhatsApp message still polled for read")
+		}
+	}
+
+	if want := []string{"queued", "delivered", "read"}; !reflect.DeepEqual(receipts, want) {
+		t.Fatalf("expected receipts %v, got %v", want, receipts)
+	}
+	if len(c.pending) != 0 {
+		t.Fatalf("expected the read message no longer polled, got %v", c.pending)
+	}
+
+	// SMS is done once delivered.
+	receipts = nil
+	status = "delivered"
+	if _, err := c.Send(context.Background(), protocol.Request{Channel: "+15551234567", Text: "hi"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if err := c.pollStatuses(context.Background()); err != nil {
+		t.Fatalf("poll statuses: %v", err)
+	}
+	if len(c.pending) != 0 || !reflect.DeepEqual(receipts, []string{"queued", "delivered"}) {
+		t.Fatalf("expected a delivered SMS no longer polled, got receipts %v, pending %v", receipts, c.pending)
+	}
+}
+
+func TestWhatsAppReceipt(t *testing.T) {
+	var published []protocol.Event
+	c := &WhatsAppConnector{
+		serviceName: "whatsapp",
+		botName:     "wa",
+		channels:    map[string]struct{}{},
+		publish:     func(event protocol.Event) { published = append(published, event) },
+	}
+	chat := types.NewJID("15551234567", types.DefaultUserServer)
+
+	c.handleEvent(&events.Receipt{
+		MessageSource: types.MessageSource{Chat: chat, Sender: chat},
+		MessageIDs:    []types.MessageID{"A1", "A2"},
+		Type:          types.ReceiptTypeRead,
+	})
+	// The account's own devices acknowledging a message aren't receipts.
+	c.handleEvent(&events.Receipt{
+		MessageSource: types.MessageSource{Chat: chat, IsFromMe: true},
+		MessageIDs:    []types.MessageID{"A3"},
+		Type:          types.ReceiptTypeDelivered,
+	})
+
+	if len(published) != 2 {
+		t.Fatalf("expected 2 receipts, got %+v", published)
+	}
+	for i, id := range []string{"A1", "A2"} {
+		if published[i].Kind != protocol.KindReceipt || published[i].MessageID != id || published[i].Status != protocol.StatusRead || published[i].Channel != chat.String() {
+			t.Errorf("unexpected receipt %+v", published[i])
+		}
+	}
+}
+
 // --- Zulip tests ---
 
 func TestResolveZulipChannel(t *testing.T) {
@@ -726,6 +1203,9 @@ func TestResolveZulipChannel(t *testing.T) {
 		{"channel takes precedence", protocol.Request{Channel: "aaa", Target: "bbb"}, "aaa"},
 		{"empty", protocol.Request{}, ""},
 		{"whitespace target", protocol.Request{Target: "  "}, ""},
+		{"direct message", protocol.Request{Channel: "alice@example.com"}, "alice@example.com"},
+		{"group DM sorted", protocol.Request{Channel: "carol@example.com, alice@example.com,bob@example.com"}, "alice@example.com,bob@example.com,carol@example.com"},
+		{"group DM duplicates and blanks", protocol.Request{Target: "bob@example.com,,Bob@example.com,alice@example.com"}, "alice@example.com,bob@example.com"},
 	}
 
 	for _, tt := range tests {
@@ -812,6 +1292,84 @@ func TestIsSlackChannelID(t *testing.T) {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// Slack App Home tests
+// ---------------------------------------------------------------------------
+
+func TestSlackHomeView(t *testing.T) {
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	view := slackHomeView(HomeSummary{
+		Unseen: 12,
+		Recent: []protocol.Event{
+			{Channel: "C0123456789", User: "U1", Timestamp: at, Text: "deploy <prod> & rollback?"},
+			{Channel: "D0123456789", User: "U2", Timestamp: at, Text: strings.Repeat("x", 400)},
+		},
+		Agents: []protocol.AgentInfo{
+			{Name: "triage", When: "notify", Running: true, Pending: 2},
+			{Name: "digest", When: `at("9:00")`, LastRun: &protocol.AgentRun{StartedAt: at, ExitCode: 1}},
+		},
+	})
+
+	var lines []string
+	for _, block := range view.Blocks.BlockSet {
+		switch b := block.(type) {
+		case *slack.SectionBlock:
+			lines = append(lines, b.Text.Text)
+		case *slack.ContextBlock:
+			lines = append(lines, b.ContextElements.Elements[0].(*slack.TextBlockObject).Text)
+		}
+	}
+	text := strings.Join(lines, "\n")
+
+	if view.Type != slack.VTHomeTab {
+		t.Errorf("expected home tab view, got %s", view.Type)
+	}
+	for _, want := range []string{
+		"*12* unseen notification(s)",
+		"<#C0123456789> <@U1>",
+		"deploy &lt;prod&gt; &amp; rollback?",
+		"DM <@U2>",
+		"and 10 more",
+		"*triage* - running, 2 pending - never run",
+		"exit 1",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("view is missing %s:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, strings.Repeat("x", homeTextLimit+1)) {
+		t.Error("expected long notification text to be truncated")
+	}
+}
+
+func TestSlackAppHomeMessages(t *testing.T) {
+	var published []protocol.Event
+	connector := &SlackConnector{
+		serviceName: "slack",
+		botName:     "ops",
+		publish:     func(event protocol.Event) { published = append(published, event) },
+		channels:    map[string]struct{}{"C0123456789": {}},
+	}
+
+	home := &slackevents.MessageEvent{Channel: "D0123456789", ChannelType: "im", User: "U1", TimeStamp: "1700000000.000100", Text: "hi"}
+
+	connector.handleMessageEvent(home)
+	if len(published) != 0 {
+		t.Fatalf("expected DM outside channels to be dropped without app_home, got %+v", published)
+	}
+
+	connector.appHome = true
+	connector.handleMessageEvent(home)
+	if len(published) != 1 || published[0].Channel != "D0123456789" || published[0].Target != "channel:D0123456789" || !published[0].Direct {
+		t.Fatalf("expected App Home message to be published as direct, got %+v", published)
+	}
+
+	connector.handleMessageEvent(&slackevents.MessageEvent{Channel: "C0999999999", ChannelType: "channel", User: "U1", TimeStamp: "1700000000.000200", Text: "hi"})
+	if len(published) != 1 {
+		t.Fatalf("expected channel filter to still apply to channels, got %+v", published)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // isDiscordChannelID tests
 // ---------------------------------------------------------------------------
@@ -1117,6 +1675,94 @@ func TestTelegramResolveChannelNames(t *testing.T) {
 // Zulip resolveChannelNames integration test (with httptest)
 // ---------------------------------------------------------------------------
 
+func TestZulipGroupDirectMessages(t *testing.T) {
+	var sentTo string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/messages", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.PostForm.Get("type") != "direct" {
+			http.Error(w, "expected a direct message", http.StatusBadRequest)
+			return
+		}
+		sentTo = r.PostForm.Get("to")
+		fmt.Fprint(w, `{"result":"success","id":7}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	z := &ZulipConnector{
+		serviceName: "zulip",
+		botName:     "ops",
+		endpoint:    srv.URL,
+		httpClient:  srv.Client(),
+		publish:     func(protocol.Event) {},
+		channels:    map[string]struct{}{},
+		selfUser:    "bot@example.com",
+	}
+
+	event, err := z.Send(context.Background(), protocol.Request{Channel: "bob@example.com, alice@example.com", Text: "hi both"})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if sentTo != `["alice@example.com","bob@example.com"]` || event.Channel != "alice@example.com,bob@example.com" {
+		t.Fatalf("sent to %s with channel %q", sentTo, event.Channel)
+	}
+
+	// Blank entries and stray spaces in a target are dropped.
+	if _, err := z.Send(context.Background(), protocol.Request{Target: " alice@example.com , ,bob@example.com,", Text: "hi again"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if sentTo != `["alice@example.com","bob@example.com"]` {
+		t.Fatalf("sent to %s", sentTo)
+	}
+	if got := zulipRecipients(" a@example.com,, b@example.com ,"); !reflect.DeepEqual(got, []string{"a@example.com", "b@example.com"}) {
+		t.Fatalf("recipients = %q", got)
+	}
+
+	// An incoming group DM maps back to the same channel, so a reply reaches
+	// the whole group; a 1:1 DM is just the sender.
+	group := &zulipMessage{
+		Type:             "private",
+		SenderEmail:      "bob@example.com",
+		DisplayRecipient: json.RawMessage(`[{"email":"bob@example.com"},{"email":"bot@example.com"},{"email":"alice@example.com"}]`),
+	}
+	if got := z.extractChannel(group); got != event.Channel {
+		t.Fatalf("group DM channel = %q, want %q", got, event.Channel)
+	}
+	direct := &zulipMessage{
+		Type:             "private",
+		SenderEmail:      "bob@example.com",
+		DisplayRecipient: json.RawMessage(`[{"email":"bob@example.com"},{"email":"bot@example.com"}]`),
+	}
+	if got := z.extractChannel(direct); got != "bob@example.com" {
+		t.Fatalf("DM channel = %q, want the sender", got)
+	}
+}
+
+func TestZulipListTopics(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/get_stream_id", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"result":"success","stream_id":42}`)
+	})
+	mux.HandleFunc("/api/v1/users/me/42/topics", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"result":"success","topics":[{"name":"deploys","max_id":10},{"name":"incidents","max_id":30},{"name":"lunch","max_id":20}]}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	z := &ZulipConnector{endpoint: srv.URL, httpClient: srv.Client()}
+	for _, stream := range []string{"42", "engineering"} {
+		topics, err := z.ListTopics(context.Background(), stream)
+		if err != nil {
+			t.Fatalf("ListTopics(%q): %v", stream, err)
+		}
+		want := []protocol.Topic{{Name: "incidents", LastMessage: "30"}, {Name: "lunch", LastMessage: "20"}, {Name: "deploys", LastMessage: "10"}}
+		if !reflect.DeepEqual(topics, want) {
+			t.Fatalf("ListTopics(%q) = %+v, want %+v", stream, topics, want)
+		}
+	}
+}
+
 func TestZulipResolveChannelNames(t *testing.T) {
 	mux := http.NewServeMux()
 
@@ -1354,8 +2000,8 @@ func TestIMessageHandleIncomingMessage(t *testing.T) {
 			t.Fatalf("expected 1 event, got %d", len(published))
 		}
 		ev := published[0]
-		if ev.Target != "group:Family Chat" {
-			t.Errorf("expected target 'group:Family Chat', got %q", ev.Target)
+		if ev.Target != "group:chat123456" {
+			t.Errorf("expected target 'group:chat123456', got %q", ev.Target)
 		}
 		if ev.Direct {
 			t.Error("expected Direct to be false for group")
@@ -1418,43 +2064,190 @@ func TestIMessageHandleIncomingMessage(t *testing.T) {
 	})
 }
 
-func TestAppleTimestampToTime(t *testing.T) {
-	t.Run("nanoseconds", func(t *testing.T) {
-		// 700000000000000000 ns since 2001-01-01 ≈ 2023-03-09
-		ts := appleTimestampToTime(700000000000000000)
-		if ts.Year() < 2020 || ts.Year() > 2030 {
-			t.Errorf("expected year ~2023, got %d", ts.Year())
-		}
-	})
+func TestIMessageHandleTapbacksAndAttachments(t *testing.T) {
+	var published []protocol.Event
+	c := &IMessageConnector{
+		serviceName: "imessage",
+		botName:     "test",
+		channels:    map[string]struct{}{},
+		publish:     func(ev protocol.Event) { published = append(published, ev) },
+	}
 
-	t.Run("zero returns now", func(t *testing.T) {
-		before := time.Now().UTC()
-		ts := appleTimestampToTime(0)
-		after := time.Now().UTC()
-		if ts.Before(before) || ts.After(after) {
-			t.Errorf("expected zero timestamp to return ~now, got %v", ts)
-		}
+	c.handleIncomingMessage(chatDBRow{
+		RowID:          5,
+		GUID:           "msg-005",
+		Text:           "Loved “Hello!”",
+		HandleID:       "+15551234567",
+		ChatID:         "+15551234567",
+		AssociatedType: 2000,
+		AssociatedGUID: "p:0/msg-001",
 	})
-
-	t.Run("seconds (legacy)", func(t *testing.T) {
-		// 700000000 seconds since 2001-01-01 ≈ 2023-03-09
-		ts := appleTimestampToTime(700000000)
-		if ts.Year() < 2020 || ts.Year() > 2030 {
-			t.Errorf("expected year ~2023, got %d", ts.Year())
-		}
+	c.handleIncomingMessage(chatDBRow{
+		RowID:    6,
+		GUID:     "msg-006",
+		HandleID: "+15551234567",
+		ChatID:   "+15551234567",
+		Attachments: []protocol.Attachment{
+			{Kind: protocol.AttachmentImage, ID: "att-1", Path: "/tmp/IMG_0001.heic", UTI: "public.heic"},
+		},
 	})
+
+	if len(published) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(published))
+	}
+	reaction := published[0]
+	if reaction.Kind != protocol.KindReaction || reaction.Text != "heart" || reaction.Target != "post:msg-001" {
+		t.Errorf("unexpected tapback event: kind=%q text=%q target=%q", reaction.Kind, reaction.Text, reaction.Target)
+	}
+	if reaction.Direct {
+		t.Error("expected tapback not to be marked direct")
+	}
+	message := published[1]
+	if message.Kind != "message" || len(message.Attachments) != 1 || message.Attachments[0].UTI != "public.heic" {
+		t.Errorf("unexpected attachment event: %+v", message)
+	}
 }
 
-func TestIMessageSend(t *testing.T) {
-	var mu sync.Mutex
-	var published []protocol.Event
+func TestDecodeAttributedBody(t *testing.T) {
+	archive := func(text string) []byte {
+		body := []byte("\x04\x0bstreamtyped\x81\xe8\x03\x84\x01@\x84\x84\x84\x12NSAttributedString\x00\x84\x84\x08NSObject\x00\x85\x92\x84\x84\x84\x08NSString\x01\x94\x84\x01+")
+		if n := len(text); n < 0x80 {
+			body = append(body, byte(n))
+		} else {
+			body = append(body, 0x81, byte(n), byte(n>>8))
+		}
+		body = append(body, text...)
+		return append(body, "\x86\x84\x02iI\x01"...)
+	}
 
-	c := &IMessageConnector{
-		serviceName:  "imessage",
-		botName:      "test",
-		channels:     map[string]struct{}{},
-		osascriptCmd: "echo", // mock osascript - echo just prints and succeeds
-		publish: func(ev protocol.Event) {
+	long := strings.Repeat("a", 300)
+	tests := []struct {
+		name string
+		body []byte
+		want string
+	}{
+		{"short", archive("Hello from Ventura"), "Hello from Ventura"},
+		{"long", archive(long), long},
+		{"unicode", archive("café 👋"), "café 👋"},
+		{"no NSString", []byte("streamtyped"), ""},
+		{"truncated", archive("Hello")[:60], ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeAttributedBody(tt.body); got != tt.want {
+				t.Errorf("decodeAttributedBody() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIMessageFetchNewMessages(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "chat.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// The subset of the chat.db schema the connector reads.
+	for _, stmt := range []string{
+		`CREATE TABLE handle (ROWID INTEGER PRIMARY KEY, id TEXT)`,
+		`CREATE TABLE chat (ROWID INTEGER PRIMARY KEY, guid TEXT, chat_identifier TEXT, service_name TEXT, room_name TEXT, display_name TEXT)`,
+		`CREATE TABLE message (ROWID INTEGER PRIMARY KEY, guid TEXT, text TEXT, date INTEGER, is_from_me INTEGER, handle_id INTEGER,
+			attributedBody BLOB, associated_message_type INTEGER, associated_message_guid TEXT, cache_has_attachments INTEGER)`,
+		`CREATE TABLE chat_message_join (chat_id INTEGER, message_id INTEGER)`,
+		`CREATE TABLE attachment (ROWID INTEGER PRIMARY KEY, guid TEXT, filename TEXT, mime_type TEXT, uti TEXT, transfer_name TEXT, total_bytes INTEGER)`,
+		`CREATE TABLE message_attachment_join (message_id INTEGER, attachment_id INTEGER)`,
+		`INSERT INTO handle VALUES (1, '+15551234567')`,
+		`INSERT INTO chat VALUES (1, 'iMessage;-;+15551234567', '+15551234567', 'iMessage', NULL, NULL)`,
+		`INSERT INTO message VALUES (1, 'msg-1', 'plain', 1, 0, 1, NULL, 0, NULL, 0)`,
+		`INSERT INTO message VALUES (2, 'msg-2', NULL, 2, 0, 1, X'` + fmt.Sprintf("%x", []byte("\x84\x84\x84\x08NSString\x01\x94\x84\x01+\x05typed\x86")) + `', 0, NULL, 0)`,
+		`INSERT INTO message VALUES (3, 'msg-3', NULL, 3, 0, 1, NULL, 0, NULL, 1)`,
+		`INSERT INTO message VALUES (4, 'msg-4', 'Liked “plain”', 4, 0, 1, NULL, 2001, 'p:0/msg-1', 0)`,
+		`INSERT INTO message VALUES (5, 'msg-5', 'Removed a like from “plain”', 5, 0, 1, NULL, 3001, 'p:0/msg-1', 0)`,
+		`INSERT INTO message VALUES (6, 'msg-6', 'mine', 6, 1, 1, NULL, 0, NULL, 0)`,
+		`INSERT INTO chat_message_join SELECT 1, ROWID FROM message`,
+		`INSERT INTO attachment VALUES (1, 'att-1', '~/Library/Messages/Attachments/ab/IMG_0001.heic', 'image/heic', 'public.heic', 'IMG_0001.heic', 2048)`,
+		`INSERT INTO attachment VALUES (2, 'att-2', '~/Library/Messages/Attachments/cd/Audio Message.caf', 'audio/x-caf', 'com.apple.coreaudio-format', 'Audio Message.caf', 512)`,
+		`INSERT INTO message_attachment_join VALUES (3, 1), (3, 2)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	c := &IMessageConnector{botName: "test", channels: map[string]struct{}{}}
+	rows, err := c.fetchNewMessages(db)
+	if err != nil {
+		t.Fatalf("fetchNewMessages: %v", err)
+	}
+
+	var guids []string
+	for _, row := range rows {
+		guids = append(guids, row.GUID)
+	}
+	if want := []string{"msg-1", "msg-2", "msg-3", "msg-4"}; !reflect.DeepEqual(guids, want) {
+		t.Fatalf("rows = %v, want %v", guids, want)
+	}
+	if rows[1].Text != "typed" {
+		t.Errorf("expected attributedBody text %q, got %q", "typed", rows[1].Text)
+	}
+	if rows[3].AssociatedType != 2001 || rows[3].AssociatedGUID != "p:0/msg-1" {
+		t.Errorf("unexpected tapback row: %+v", rows[3])
+	}
+
+	attachments := rows[2].Attachments
+	if len(attachments) != 2 {
+		t.Fatalf("expected 2 attachments, got %d", len(attachments))
+	}
+	image, voice := attachments[0], attachments[1]
+	if image.Kind != protocol.AttachmentImage || image.UTI != "public.heic" || image.Name != "IMG_0001.heic" || image.Size != 2048 {
+		t.Errorf("unexpected image attachment: %+v", image)
+	}
+	if strings.HasPrefix(image.Path, "~") || !strings.HasSuffix(image.Path, "/IMG_0001.heic") {
+		t.Errorf("expected expanded attachment path, got %q", image.Path)
+	}
+	if voice.Kind != protocol.AttachmentAudio || !voice.Voice {
+		t.Errorf("expected voice note, got %+v", voice)
+	}
+}
+
+func TestAppleTimestampToTime(t *testing.T) {
+	t.Run("nanoseconds", func(t *testing.T) {
+		// 700000000000000000 ns since 2001-01-01 ≈ 2023-03-09
+		ts := appleTimestampToTime(700000000000000000)
+		if ts.Year() < 2020 || ts.Year() > 2030 {
+			t.Errorf("expected year ~2023, got %d", ts.Year())
+		}
+	})
+
+	t.Run("zero returns now", func(t *testing.T) {
+		before := time.Now().UTC()
+		ts := appleTimestampToTime(0)
+		after := time.Now().UTC()
+		if ts.Before(before) || ts.After(after) {
+			t.Errorf("expected zero timestamp to return ~now, got %v", ts)
+		}
+	})
+
+	t.Run("seconds (legacy)", func(t *testing.T) {
+		// 700000000 seconds since 2001-01-01 ≈ 2023-03-09
+		ts := appleTimestampToTime(700000000)
+		if ts.Year() < 2020 || ts.Year() > 2030 {
+			t.Errorf("expected year ~2023, got %d", ts.Year())
+		}
+	})
+}
+
+func TestIMessageSend(t *testing.T) {
+	var mu sync.Mutex
+	var published []protocol.Event
+
+	c := &IMessageConnector{
+		serviceName:  "imessage",
+		botName:      "test",
+		channels:     map[string]struct{}{},
+		osascriptCmd: "echo", // mock osascript - echo just prints and succeeds
+		publish: func(ev protocol.Event) {
 			mu.Lock()
 			published = append(published, ev)
 			mu.Unlock()
@@ -1504,6 +2297,100 @@ func TestIMessageSend(t *testing.T) {
 	})
 }
 
+func TestIMessageGroupSend(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "chat.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE chat (ROWID INTEGER PRIMARY KEY, guid TEXT, chat_identifier TEXT, display_name TEXT)`,
+		`INSERT INTO chat VALUES (1, 'iMessage;+;chat111', 'chat111', 'Family Chat')`,
+		`INSERT INTO chat VALUES (2, 'any;+;chat222', 'chat222', '')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	c := &IMessageConnector{
+		serviceName:  "imessage",
+		botName:      "test",
+		dbPath:       dbPath,
+		channels:     map[string]struct{}{},
+		chatGUIDs:    map[string]string{},
+		osascriptCmd: "echo",
+		publish:      func(protocol.Event) {},
+	}
+
+	// Seen in an incoming message, so resolved without chat.db.
+	c.rememberChatGUID(chatDBRow{ChatID: "chat333", ChatGUID: "SMS;+;chat333"})
+
+	tests := []struct {
+		name    string
+		request protocol.Request
+		guid    string
+	}{
+		{"identifier from chat.db", protocol.Request{Channel: "chat222"}, "any;+;chat222"},
+		{"display name target", protocol.Request{Target: "group:Family Chat"}, "iMessage;+;chat111"},
+		{"prefixed target", protocol.Request{Target: "imessage:group:chat111"}, "iMessage;+;chat111"},
+		{"remembered chat", protocol.Request{Channel: "chat333"}, "SMS;+;chat333"},
+		{"chat guid", protocol.Request{Channel: "iMessage;+;chat444"}, "iMessage;+;chat444"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.request.Text = "hello group"
+			event, err := c.Send(context.Background(), tt.request)
+			if err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			want := imessageChatIdentifier(tt.guid)
+			if event.Channel != want || event.Target != "group:"+want {
+				t.Errorf("expected channel %q and target group:%s, got %q and %q", want, want, event.Channel, event.Target)
+			}
+			if got, _ := c.resolveChatGUID(context.Background(), want); got != tt.guid {
+				t.Errorf("resolveChatGUID(%q) = %q, want %q", want, got, tt.guid)
+			}
+		})
+	}
+
+	t.Run("unknown group", func(t *testing.T) {
+		_, err := c.Send(context.Background(), protocol.Request{Target: "group:Nobody", Text: "hello"})
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Fatalf("expected not found error, got %v", err)
+		}
+	})
+
+	t.Run("chat script", func(t *testing.T) {
+		script := imessageChatScript("iMessage;+;chat111", `say "hi"`)
+		if !strings.Contains(script, `send "say \"hi\"" to chat id "iMessage;+;chat111"`) {
+			t.Errorf("unexpected script: %s", script)
+		}
+	})
+}
+
+func TestIsIMessageGroup(t *testing.T) {
+	tests := []struct {
+		request protocol.Request
+		want    bool
+	}{
+		{protocol.Request{Channel: "+15551234567"}, false},
+		{protocol.Request{Channel: "alice@example.com"}, false},
+		{protocol.Request{Channel: "chat123456789"}, true},
+		{protocol.Request{Channel: "chatty@example.com"}, false},
+		{protocol.Request{Channel: "iMessage;+;chat123"}, true},
+		{protocol.Request{Target: "group:Family Chat"}, true},
+		{protocol.Request{Target: "imessage:group:chat123"}, true},
+		{protocol.Request{Target: "dm:+15551234567"}, false},
+	}
+	for _, tt := range tests {
+		if got := isIMessageGroup(tt.request, resolveIMessageChannel(tt.request)); got != tt.want {
+			t.Errorf("isIMessageGroup(%+v) = %v, want %v", tt.request, got, tt.want)
+		}
+	}
+}
+
 func TestNewIMessageConnectorOSCheck(t *testing.T) {
 	if runtime.GOOS == "darwin" {
 		t.Skip("OS check only fails on non-darwin")
@@ -1550,3 +2437,2260 @@ func TestExpandHome(t *testing.T) {
 		}
 	})
 }
+
+func TestDiscordIsSelfMessage_PuppetWebhook(t *testing.T) {
+	d := &DiscordConnector{
+		selfUser: "B0T",
+		webhooks: map[string]*discordgo.Webhook{"C1": {ID: "W1", Token: "tok"}},
+	}
+
+	tests := []struct {
+		name    string
+		message *discordgo.Message
+		want    bool
+	}{
+		{"bot user", &discordgo.Message{Author: &discordgo.User{ID: "B0T"}}, true},
+		{"own webhook", &discordgo.Message{WebhookID: "W1", Author: &discordgo.User{ID: "W1", Username: "alice"}}, true},
+		{"foreign webhook", &discordgo.Message{WebhookID: "W2", Author: &discordgo.User{ID: "W2"}}, false},
+		{"other user", &discordgo.Message{Author: &discordgo.User{ID: "U1"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := d.isSelfMessage(&discordgo.MessageCreate{Message: tt.message}); got != tt.want {
+				t.Fatalf("isSelfMessage = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Discord threads and embeds
+// ---------------------------------------------------------------------------
+
+func TestDiscordLocation(t *testing.T) {
+	const (
+		channelID      = "200000000000000001"
+		threadID       = "200000000000000002"
+		messageID      = "200000000000000003"
+		otherMessageID = "200000000000000004"
+	)
+	state := discordgo.NewState()
+	if err := state.GuildAdd(&discordgo.Guild{
+		ID:       "100000000000000000",
+		Channels: []*discordgo.Channel{{ID: channelID, GuildID: "100000000000000000", Type: discordgo.ChannelTypeGuildText}},
+		Threads:  []*discordgo.Channel{{ID: threadID, GuildID: "100000000000000000", ParentID: channelID, Type: discordgo.ChannelTypeGuildPublicThread}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	d := &DiscordConnector{
+		session: &discordgo.Session{State: state},
+		// messageID is a message, looked up earlier.
+		parents: map[string]string{messageID: ""},
+	}
+
+	tests := []struct {
+		name        string
+		channelID   string
+		reference   *discordgo.MessageReference
+		wantChannel string
+		wantThread  string
+	}{
+		{"channel message", channelID, nil, channelID, ""},
+		{"reply in channel", channelID, &discordgo.MessageReference{MessageID: messageID}, channelID, messageID},
+		{"message in thread", threadID, nil, channelID, threadID},
+		{"reply in thread", threadID, &discordgo.MessageReference{MessageID: otherMessageID}, channelID, threadID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel, thread := d.location(tt.channelID, tt.reference)
+			if channel != tt.wantChannel || thread != tt.wantThread {
+				t.Fatalf("location = %q, %q, want %q, %q", channel, thread, tt.wantChannel, tt.wantThread)
+			}
+		})
+	}
+
+	if parent := d.threadParent(messageID); parent != "" {
+		t.Fatalf("message ID reported as a thread of %q", parent)
+	}
+}
+
+func TestValidateEmbeds(t *testing.T) {
+	valid := protocol.Embed{
+		Title:  "Deploy finished",
+		URL:    "https://ci.example.com/runs/42",
+		Color:  0x2ECC71,
+		Fields: []protocol.EmbedField{{Name: "Duration", Value: "4m12s", Inline: true}},
+	}
+	if err := ValidateEmbeds([]protocol.Embed{valid}); err != nil {
+		t.Fatalf("valid embed refused: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		embeds []protocol.Embed
+		want   string
+	}{
+		{"empty embed", []protocol.Embed{{Color: 1}}, "needs a title"},
+		{"too many embeds", make([]protocol.Embed, maxEmbeds+1), "at most 10 embeds"},
+		{"color out of range", []protocol.Embed{{Title: "x", Color: 0x1000000}}, "color must be"},
+		{"bad url", []protocol.Embed{{Title: "x", URL: "ftp://example.com"}}, "url must be"},
+		{"long title", []protocol.Embed{{Title: strings.Repeat("a", maxEmbedTitle+1)}}, "title is longer"},
+		{"field without value", []protocol.Embed{{Fields: []protocol.EmbedField{{Name: "x"}}}}, "need a name and a value"},
+		{"total too long", []protocol.Embed{
+			{Description: strings.Repeat("a", maxEmbedDescription)},
+			{Description: strings.Repeat("a", maxEmbedDescription)},
+		}, "characters in total"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateEmbeds(tt.embeds)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ValidateEmbeds error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscordEmbeds(t *testing.T) {
+	embeds := []protocol.Embed{{
+		Title:       "Deploy finished",
+		Description: "v2.3 is live",
+		Color:       0x2ECC71,
+		Fields:      []protocol.EmbedField{{Name: "Duration", Value: "4m12s", Inline: true}},
+		Footer:      "ci",
+	}}
+
+	converted := discordEmbeds(embeds)
+	if len(converted) != 1 {
+		t.Fatalf("expected 1 embed, got %d", len(converted))
+	}
+	got := converted[0]
+	if got.Title != "Deploy finished" || got.Color != 0x2ECC71 || got.Footer == nil || got.Footer.Text != "ci" {
+		t.Fatalf("unexpected embed: %+v", got)
+	}
+	if len(got.Fields) != 1 || !got.Fields[0].Inline || got.Fields[0].Value != "4m12s" {
+		t.Fatalf("unexpected fields: %+v", got.Fields)
+	}
+
+	if text := EmbedsText(embeds); text != "Deploy finished\nv2.3 is live\nDuration: 4m12s\nci" {
+		t.Fatalf("EmbedsText = %q", text)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Matrix session login and token refresh
+// ---------------------------------------------------------------------------
+
+func TestMatrixDirectRooms(t *testing.T) {
+	var published []protocol.Event
+	m := &MatrixConnector{
+		serviceName: "matrix",
+		botName:     "ops",
+		selfUser:    "@ops:example.org",
+		channels:    map[string]struct{}{},
+		publish:     func(e protocol.Event) { published = append(published, e) },
+	}
+
+	m.handleDirectChats(&event.Event{Content: event.Content{Parsed: &event.DirectChatsEventContent{
+		"@alice:example.org": {"!dm:example.org"},
+	}}})
+	self := "@ops:example.org"
+	m.handleMembership(&event.Event{RoomID: "!invite:example.org", StateKey: &self, Content: event.Content{Parsed: &event.MemberEventContent{
+		Membership: event.MembershipInvite,
+		IsDirect:   true,
+	}}})
+
+	for _, room := range []id.RoomID{"!dm:example.org", "!invite:example.org", "!team:example.org"} {
+		m.handleMessage(&event.Event{
+			Type:    event.EventMessage,
+			Sender:  "@alice:example.org",
+			RoomID:  room,
+			Content: event.Content{Parsed: &event.MessageEventContent{MsgType: event.MsgText, Body: "hi"}},
+		})
+	}
+
+	if len(published) != 3 || !published[0].Direct || !published[1].Direct || published[2].Direct {
+		t.Fatalf("expected only the DM rooms to be direct, got %+v", published)
+	}
+}
+
+func TestMatrixPasswordLogin_RequestsRefreshToken(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_matrix/client/v3/login", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["refresh_token"] != true || body["password"] != "hunter2" {
+			http.Error(w, `{"errcode":"M_FORBIDDEN"}`, http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"at1","refresh_token":"rt1","expires_in_ms":300000,"user_id":"@bot:example.org","device_id":"DEV"}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	session, err := MatrixPasswordLogin(context.Background(), srv.URL, "bot", "hunter2")
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if session.AccessToken != "at1" || session.RefreshToken != "rt1" || session.UserID != "@bot:example.org" || session.Homeserver != srv.URL {
+		t.Fatalf("unexpected session: %+v", session)
+	}
+	if until := time.Until(session.ExpiresAt); until < 4*time.Minute || until > 5*time.Minute {
+		t.Fatalf("unexpected expiry: %s", session.ExpiresAt)
+	}
+}
+
+func TestMatrixAuth_RefreshPersistsAndAuthorizes(t *testing.T) {
+	var refreshes int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_matrix/client/v3/refresh", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["refresh_token"] != "rt1" {
+			http.Error(w, `{"errcode":"M_UNKNOWN_TOKEN"}`, http.StatusUnauthorized)
+			return
+		}
+		refreshes++
+		fmt.Fprint(w, `{"access_token":"at2","refresh_token":"rt2","expires_in_ms":3600000}`)
+	})
+	mux.HandleFunc("/whoami", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	path := t.TempDir() + "/matrix-bot.json"
+	if err := SaveMatrixSession(path, &MatrixSession{
+		Homeserver:   srv.URL,
+		UserID:       "@bot:example.org",
+		AccessToken:  "at1",
+		RefreshToken: "rt1",
+		ExpiresAt:    time.Now().Add(30 * time.Second),
+	}); err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("session file should be private: %v, %v", info.Mode(), err)
+	}
+
+	auth := &matrixAuth{path: path}
+	if _, err := auth.load(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if next := auth.nextRefresh(); time.Until(next) > 0 {
+		t.Fatalf("token within the refresh margin should be due, next=%s", next)
+	}
+
+	refreshed, err := auth.refresh(context.Background(), false)
+	if err != nil || !refreshed {
+		t.Fatalf("refresh: %v, %v", refreshed, err)
+	}
+	if refreshed, _ := auth.refresh(context.Background(), false); refreshed || refreshes != 1 {
+		t.Fatalf("fresh token should not be refreshed again (refreshes=%d)", refreshes)
+	}
+
+	stored, err := LoadMatrixSession(path)
+	if err != nil {
+		t.Fatalf("reload session: %v", err)
+	}
+	if stored.AccessToken != "at2" || stored.RefreshToken != "rt2" || stored.UserID != "@bot:example.org" {
+		t.Fatalf("refreshed session not persisted: %+v", stored)
+	}
+
+	client := &http.Client{Transport: auth}
+	resp, err := client.Get(srv.URL + "/whoami")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	if header, _ := io.ReadAll(resp.Body); string(header) != "Bearer at2" {
+		t.Fatalf("expected refreshed bearer token, got %q", header)
+	}
+}
+
+func TestMatrixAuth_MissingSession(t *testing.T) {
+	auth := &matrixAuth{path: t.TempDir() + "/missing.json"}
+	if _, err := auth.load(); err == nil || !strings.Contains(err.Error(), "pantalk pair") {
+		t.Fatalf("expected hint to run pantalk pair, got %v", err)
+	}
+}
+
+func TestDiscordIntents(t *testing.T) {
+	defaults := discordIntentsFor([]string{"guild_messages", "direct_messages", "message_content"})
+	if defaults != discordgo.IntentsGuildMessages|discordgo.IntentsDirectMessages|discordgo.IntentMessageContent {
+		t.Fatalf("unexpected default intents: %d", defaults)
+	}
+
+	tests := []struct {
+		name    string
+		intents discordgo.Intent
+		flags   int
+		missing []string
+	}{
+		{name: "not privileged", intents: discordgo.IntentsGuildMessages},
+		{name: "message content enabled", intents: defaults, flags: discordFlagGatewayMessageContent},
+		{name: "message content limited", intents: defaults, flags: discordFlagGatewayMessageContentLimited},
+		{name: "message content missing", intents: defaults, missing: []string{"Message Content Intent"}},
+		{
+			name:    "both missing",
+			intents: defaults | discordgo.IntentGuildMembers,
+			flags:   1 << 23, // APPLICATION_COMMAND_BADGE, unrelated
+			missing: []string{"Server Members Intent", "Message Content Intent"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := missingPrivilegedIntents(tt.intents, tt.flags)
+			if strings.Join(got, ",") != strings.Join(tt.missing, ",") {
+				t.Fatalf("missing = %v, want %v", got, tt.missing)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Interactive messages
+// ---------------------------------------------------------------------------
+
+func approvalInteractive() *protocol.Interactive {
+	return &protocol.Interactive{
+		Buttons: []protocol.Button{
+			{Label: "Approve", Value: "approve", Style: "primary"},
+			{Label: "Reject", Value: "reject", Style: "danger"},
+		},
+		Select: &protocol.Select{Options: []protocol.Option{
+			{Label: "In an hour", Value: "1h"},
+			{Label: "Tomorrow", Value: "1d"},
+		}},
+	}
+}
+
+func TestValidateInteractive(t *testing.T) {
+	manyButtons := &protocol.Interactive{}
+	for i := 0; i <= maxInteractiveButtons; i++ {
+		manyButtons.Buttons = append(manyButtons.Buttons, protocol.Button{Label: "b", Value: fmt.Sprint(i)})
+	}
+
+	tests := []struct {
+		name        string
+		interactive *protocol.Interactive
+		want        string
+	}{
+		{name: "none", interactive: nil},
+		{name: "valid", interactive: approvalInteractive()},
+		{name: "empty", interactive: &protocol.Interactive{}, want: "at least one"},
+		{name: "too many buttons", interactive: manyButtons, want: "at most 20 buttons"},
+		{name: "missing value", interactive: &protocol.Interactive{Buttons: []protocol.Button{{Label: "OK"}}}, want: "needs a value"},
+		{name: "missing label", interactive: &protocol.Interactive{Buttons: []protocol.Button{{Value: "ok"}}}, want: "label cannot be empty"},
+		{name: "long value", interactive: &protocol.Interactive{Buttons: []protocol.Button{{Label: "OK", Value: strings.Repeat("v", 65)}}}, want: "longer than 64 bytes"},
+		{name: "bad style", interactive: &protocol.Interactive{Buttons: []protocol.Button{{Label: "OK", Value: "ok", Style: "green"}}}, want: "style must be"},
+		{
+			name: "value shared by button and option",
+			interactive: &protocol.Interactive{
+				Buttons: []protocol.Button{{Label: "OK", Value: "ok"}},
+				Select:  &protocol.Select{Options: []protocol.Option{{Label: "Fine", Value: "ok"}}},
+			},
+			want: "duplicate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateInteractive(tt.interactive)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestSlackInteractiveBlocks(t *testing.T) {
+	blocks := slackInteractiveBlocks("Deploy to prod?", approvalInteractive())
+	if len(blocks) != 2 {
+		t.Fatalf("expected a section and an actions block, got %d blocks", len(blocks))
+	}
+	section, ok := blocks[0].(*slack.SectionBlock)
+	if !ok || section.Text.Text != "Deploy to prod?" {
+		t.Fatalf("unexpected section: %+v", blocks[0])
+	}
+
+	actions, ok := blocks[1].(*slack.ActionBlock)
+	if !ok || len(actions.Elements.ElementSet) != 3 {
+		t.Fatalf("expected two buttons and a select, got %+v", blocks[1])
+	}
+	approve := actions.Elements.ElementSet[0].(*slack.ButtonBlockElement)
+	if approve.Value != "approve" || approve.Style != slack.StylePrimary || !strings.HasPrefix(approve.ActionID, slackActionPrefix) {
+		t.Fatalf("unexpected approve button: %+v", approve)
+	}
+	menu := actions.Elements.ElementSet[2].(*slack.SelectBlockElement)
+	if len(menu.Options) != 2 || menu.Options[1].Value != "1d" || menu.Placeholder.Text != "Choose…" {
+		t.Fatalf("unexpected select: %+v", menu)
+	}
+}
+
+func TestSlackHandleInteraction(t *testing.T) {
+	var published []protocol.Event
+	connector := &SlackConnector{
+		serviceName: "slack",
+		botName:     "ops",
+		publish:     func(event protocol.Event) { published = append(published, event) },
+		channels:    map[string]struct{}{"C1": {}},
+	}
+
+	callback := slack.InteractionCallback{
+		Type:    slack.InteractionTypeBlockActions,
+		Channel: slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: "C1"}}},
+		User:    slack.User{ID: "U1"},
+		Message: slack.Message{Msg: slack.Msg{ThreadTimestamp: "1700000000.000100"}},
+		ActionCallback: slack.ActionCallbacks{BlockActions: []*slack.BlockAction{
+			{ActionID: "other_app", Value: "ignored"},
+			{ActionID: slackActionPrefix + "button_0", Value: "approve", ActionTs: "1700000001.000000"},
+			{ActionID: slackActionPrefix + "select", SelectedOption: slack.OptionBlockObject{Value: "1h"}},
+		}},
+	}
+	connector.handleInteraction(callback)
+
+	if len(published) != 2 {
+		t.Fatalf("expected two interactions, got %+v", published)
+	}
+	click := published[0]
+	if click.Kind != protocol.KindInteraction || click.Direction != "in" || click.Text != "approve" ||
+		click.User != "U1" || click.Channel != "C1" || click.Thread != "1700000000.000100" {
+		t.Fatalf("unexpected click event: %+v", click)
+	}
+	if published[1].Text != "1h" {
+		t.Fatalf("expected the selected option, got %+v", published[1])
+	}
+}
+
+func TestDiscordComponents(t *testing.T) {
+	interactive := approvalInteractive()
+	for i := 0; i < 4; i++ {
+		interactive.Buttons = append(interactive.Buttons, protocol.Button{Label: "More", Value: fmt.Sprint("more", i)})
+	}
+
+	rows := discordComponents(interactive)
+	if len(rows) != 3 {
+		t.Fatalf("expected two button rows and a select row, got %d", len(rows))
+	}
+	first := rows[0].(discordgo.ActionsRow)
+	if len(first.Components) != discordButtonsPerRow {
+		t.Fatalf("expected a full first row, got %d", len(first.Components))
+	}
+	reject := first.Components[1].(discordgo.Button)
+	if reject.Style != discordgo.DangerButton || reject.CustomID != discordCustomIDPrefix+"b:reject" {
+		t.Fatalf("unexpected reject button: %+v", reject)
+	}
+	menu := rows[2].(discordgo.ActionsRow).Components[0].(discordgo.SelectMenu)
+	if menu.CustomID != discordSelectID || len(menu.Options) != 2 {
+		t.Fatalf("unexpected select menu: %+v", menu)
+	}
+}
+
+func TestDiscordInteractionEvent(t *testing.T) {
+	connector := &DiscordConnector{serviceName: "discord", botName: "ops", channels: map[string]struct{}{}}
+
+	component := func(data discordgo.MessageComponentInteractionData) *discordgo.Interaction {
+		return &discordgo.Interaction{
+			Type:      discordgo.InteractionMessageComponent,
+			ChannelID: "100",
+			Member:    &discordgo.Member{User: &discordgo.User{ID: "U1"}},
+			Message:   &discordgo.Message{MessageReference: &discordgo.MessageReference{MessageID: "99"}},
+			Data:      data,
+		}
+	}
+
+	event, ok := connector.interactionEvent(component(discordgo.MessageComponentInteractionData{CustomID: discordCustomIDPrefix + "b:approve"}))
+	if !ok || event.Kind != protocol.KindInteraction || event.Text != "approve" || event.User != "U1" || event.Channel != "100" || event.Thread != "99" {
+		t.Fatalf("unexpected button event: %+v (ok=%v)", event, ok)
+	}
+
+	event, ok = connector.interactionEvent(component(discordgo.MessageComponentInteractionData{CustomID: discordSelectID, Values: []string{"1d"}}))
+	if !ok || event.Text != "1d" {
+		t.Fatalf("unexpected select event: %+v (ok=%v)", event, ok)
+	}
+
+	if _, ok := connector.interactionEvent(component(discordgo.MessageComponentInteractionData{CustomID: "another-bot"})); ok {
+		t.Fatal("expected components of other apps to be ignored")
+	}
+}
+
+func TestTelegramKeyboard(t *testing.T) {
+	keyboard := telegramKeyboard(approvalInteractive())
+	if len(keyboard.InlineKeyboard) != 3 {
+		t.Fatalf("expected a button row and one row per option, got %+v", keyboard.InlineKeyboard)
+	}
+	if row := keyboard.InlineKeyboard[0]; len(row) != 2 || row[0].CallbackData != "approve" || row[1].Text != "Reject" {
+		t.Fatalf("unexpected button row: %+v", row)
+	}
+	if row := keyboard.InlineKeyboard[2]; len(row) != 1 || row[0].CallbackData != "1d" {
+		t.Fatalf("unexpected option row: %+v", row)
+	}
+}
+
+func TestTelegramCallbackQuery(t *testing.T) {
+	var answered []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bottok/answerCallbackQuery", func(w http.ResponseWriter, r *http.Request) {
+		var req tgAnswerCallbackQueryRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		answered = append(answered, req.CallbackQueryID)
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var published []protocol.Event
+	connector := &TelegramConnector{
+		serviceName: "telegram",
+		botName:     "ops",
+		baseURL:     srv.URL + "/bottok",
+		publish:     func(event protocol.Event) { published = append(published, event) },
+		httpClient:  srv.Client(),
+		channels:    map[string]struct{}{},
+	}
+
+	connector.handleCallbackQuery(context.Background(), &tgCallbackQuery{
+		ID:      "q1",
+		From:    tgUser{ID: 42},
+		Message: &tgMessage{MessageID: 7, Chat: tgChat{ID: -100}, ReplyToMessage: &tgMessage{MessageID: 5}},
+		Data:    "approve",
+	})
+
+	if len(answered) != 1 || answered[0] != "q1" {
+		t.Fatalf("expected the query to be answered, got %v", answered)
+	}
+	if len(published) != 1 {
+		t.Fatalf("expected one interaction, got %+v", published)
+	}
+	if event := published[0]; event.Kind != protocol.KindInteraction || event.Text != "approve" ||
+		event.User != "42" || event.Channel != "-100" || event.Thread != "5" {
+		t.Fatalf("unexpected interaction: %+v", event)
+	}
+}
+
+func TestTelegramInteractiveRoundTrip(t *testing.T) {
+	var markups []*tgInlineKeyboard
+	var answered []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bottok/sendMessage", func(w http.ResponseWriter, r *http.Request) {
+		var req tgSendMessageRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		markups = append(markups, req.ReplyMarkup)
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":9,"chat":{"id":-100}}}`))
+	})
+	mux.HandleFunc("/bottok/answerCallbackQuery", func(w http.ResponseWriter, r *http.Request) {
+		var req tgAnswerCallbackQueryRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		answered = append(answered, req.CallbackQueryID)
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var published []protocol.Event
+	connector := &TelegramConnector{
+		serviceName: "telegram",
+		botName:     "ops",
+		baseURL:     srv.URL + "/bottok",
+		publish:     func(event protocol.Event) { published = append(published, event) },
+		httpClient:  srv.Client(),
+		channels:    map[string]struct{}{},
+	}
+
+	// A message split in segments carries the keyboard on its last one.
+	text := strings.Repeat("approve the deploy? ", telegramMaxText/10)
+	if _, err := connector.Send(context.Background(), protocol.Request{Channel: "-100", Text: text, Interactive: approvalInteractive()}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if len(markups) < 2 {
+		t.Fatalf("expected the text split in segments, got %d", len(markups))
+	}
+	for i, markup := range markups {
+		if last := i == len(markups)-1; (markup != nil) != last {
+			t.Fatalf("segment %d of %d has keyboard %+v", i+1, len(markups), markup)
+		}
+	}
+	if keyboard := markups[len(markups)-1].InlineKeyboard; len(keyboard) != 3 || keyboard[0][0].CallbackData != "approve" {
+		t.Fatalf("unexpected keyboard %+v", keyboard)
+	}
+
+	published = nil
+
+	// The click comes back as a callback_query update, which both polling
+	// and the webhook ask for.
+	if !slices.Contains(telegramAllowedUpdates, "callback_query") {
+		t.Fatalf("callback_query missing from allowed updates %v", telegramAllowedUpdates)
+	}
+	connector.handleUpdate(context.Background(), tgUpdate{UpdateID: 1, CallbackQuery: &tgCallbackQuery{
+		ID:      "q1",
+		From:    tgUser{ID: 42},
+		Message: &tgMessage{MessageID: 9, Chat: tgChat{ID: -100}},
+		Data:    "reject",
+	}})
+	if len(answered) != 1 || answered[0] != "q1" {
+		t.Fatalf("expected the query answered, got %v", answered)
+	}
+	if len(published) != 1 || published[0].Kind != protocol.KindInteraction || published[0].Text != "reject" || published[0].MessageID != "9" {
+		t.Fatalf("unexpected interaction %+v", published)
+	}
+}
+
+func TestMattermostActions(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/posts/P1", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(mmPost{ID: "P1", ChannelID: "CH1", RootID: "ROOT"})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var published []protocol.Event
+	connector := &MattermostConnector{
+		serviceName: "mattermost",
+		botName:     "ops",
+		endpoint:    srv.URL,
+		publish:     func(event protocol.Event) { published = append(published, event) },
+		httpClient:  srv.Client(),
+		channels:    map[string]struct{}{},
+	}
+
+	if connector.Capabilities().Interactive {
+		t.Fatal("expected no interactive support without an action endpoint")
+	}
+	connector.SetActionEndpoint("http://pantalk:8750/v1/actions/mattermost/ops", "s3cret")
+	if !connector.Capabilities().Interactive {
+		t.Fatal("expected interactive support with an action endpoint")
+	}
+
+	props := connector.mattermostActionProps(approvalInteractive())
+	encoded, err := json.Marshal(props)
+	if err != nil {
+		t.Fatalf("marshal props: %v", err)
+	}
+	for _, want := range []string{`"type":"button"`, `"style":"danger"`, `"type":"select"`, `"url":"http://pantalk:8750/v1/actions/mattermost/ops"`, `"value":"approve"`, `"secret":"s3cret"`} {
+		if !strings.Contains(string(encoded), want) {
+			t.Errorf("props missing %s: %s", want, encoded)
+		}
+	}
+
+	callback := func(ctx string) error {
+		return connector.HandleAction(context.Background(), []byte(`{"user_id":"U1","channel_id":"CH1","post_id":"P1","context":`+ctx+`}`))
+	}
+
+	if err := callback(`{"secret":"wrong","value":"approve"}`); err == nil {
+		t.Fatal("expected a callback with the wrong secret to be rejected")
+	}
+	if err := callback(`{"secret":"s3cret","value":"approve"}`); err != nil {
+		t.Fatalf("button callback: %v", err)
+	}
+	if err := callback(`{"secret":"s3cret","selected_option":"1h"}`); err != nil {
+		t.Fatalf("select callback: %v", err)
+	}
+
+	if len(published) != 2 {
+		t.Fatalf("expected two interactions, got %+v", published)
+	}
+	if event := published[0]; event.Kind != protocol.KindInteraction || event.Text != "approve" ||
+		event.User != "U1" || event.Channel != "CH1" || event.Thread != "ROOT" {
+		t.Fatalf("unexpected interaction: %+v", event)
+	}
+	if published[1].Text != "1h" {
+		t.Fatalf("expected the selected option, got %+v", published[1])
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Voice messages
+// ---------------------------------------------------------------------------
+
+func TestTelegramAudio(t *testing.T) {
+	voice, ok := telegramAudio(&tgMessage{Voice: &tgAudio{FileID: "v1", Duration: 7, FileSize: 2048}})
+	if !ok || voice.Kind != protocol.AttachmentAudio || !voice.Voice || voice.MimeType != "audio/ogg" || voice.Duration != 7 || voice.ID != "v1" {
+		t.Fatalf("unexpected voice attachment: %+v (ok=%v)", voice, ok)
+	}
+
+	file, ok := telegramAudio(&tgMessage{Audio: &tgAudio{FileID: "a1", FileName: "memo.mp3", MimeType: "audio/mpeg"}})
+	if !ok || file.Voice || file.Name != "memo.mp3" || file.MimeType != "audio/mpeg" {
+		t.Fatalf("unexpected audio attachment: %+v (ok=%v)", file, ok)
+	}
+
+	if _, ok := telegramAudio(&tgMessage{Text: "hi"}); ok {
+		t.Fatal("expected no attachment on a text message")
+	}
+}
+
+func TestTelegramVoiceTranscription(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bottok/getFile", func(w http.ResponseWriter, r *http.Request) {
+		var req tgGetFileRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.FileID != "v1" {
+			t.Errorf("unexpected file id %q", req.FileID)
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"file_path":"voice/file_1.oga"}}`))
+	})
+	mux.HandleFunc("/file/bottok/voice/file_1.oga", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("opus bytes"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	published := make(chan protocol.Event, 1)
+	connector := &TelegramConnector{
+		serviceName: "telegram",
+		botName:     "ops",
+		baseURL:     srv.URL + "/bottok",
+		publish:     func(event protocol.Event) { published <- event },
+		httpClient:  srv.Client(),
+		channels:    map[string]struct{}{},
+	}
+	connector.SetTranscribeFunc(func(_ context.Context, audio []byte, mimeType string) (string, error) {
+		if string(audio) != "opus bytes" || mimeType != "audio/ogg" {
+			return "", fmt.Errorf("unexpected audio %q (%s)", audio, mimeType)
+		}
+		return "restart the build please", nil
+	})
+
+	event := protocol.Event{Service: "telegram", Bot: "ops", Kind: "message", Direction: "in", Channel: "-100"}
+	audio, _ := telegramAudio(&tgMessage{Voice: &tgAudio{FileID: "v1", Duration: 3}})
+	event.Attachments = []protocol.Attachment{audio}
+	connector.publishVoice(context.Background(), event, func(ctx context.Context) ([]byte, error) {
+		return connector.downloadFile(ctx, audio.ID)
+	}, connector.publish)
+
+	select {
+	case got := <-published:
+		if got.Text != "restart the build please" || len(got.Attachments) != 1 || !got.Attachments[0].Transcribed {
+			t.Fatalf("unexpected event: %+v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the transcribed event")
+	}
+}
+
+func TestPublishVoice_WithoutTranscriber(t *testing.T) {
+	var v voiceTranscriber
+	var published []protocol.Event
+	event := protocol.Event{Text: "caption", Attachments: []protocol.Attachment{{Kind: protocol.AttachmentAudio}}}
+
+	v.publishVoice(context.Background(), event, func(context.Context) ([]byte, error) {
+		t.Fatal("audio must not be downloaded without a transcriber")
+		return nil, nil
+	}, func(event protocol.Event) { published = append(published, event) })
+
+	if len(published) != 1 || published[0].Text != "caption" || published[0].Attachments[0].Transcribed {
+		t.Fatalf("expected the event unchanged, got %+v", published)
+	}
+}
+
+func TestPublishVoice_TranscriptionFailure(t *testing.T) {
+	var v voiceTranscriber
+	v.SetTranscribeFunc(func(context.Context, []byte, string) (string, error) {
+		return "", fmt.Errorf("endpoint unavailable")
+	})
+
+	published := make(chan protocol.Event, 1)
+	event := protocol.Event{Text: "caption", Attachments: []protocol.Attachment{{Kind: protocol.AttachmentAudio}}}
+	v.publishVoice(context.Background(), event, func(context.Context) ([]byte, error) {
+		return []byte("audio"), nil
+	}, func(event protocol.Event) { published <- event })
+
+	select {
+	case got := <-published:
+		if got.Text != "caption" || got.Attachments[0].Transcribed {
+			t.Fatalf("expected the event without a transcript, got %+v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the event")
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Mark read
+// ---------------------------------------------------------------------------
+
+func TestSlackTimestampRoundTrip(t *testing.T) {
+	for _, ts := range []string{"1700000000.000100", "1711234567.999999", "1711234567.000001"} {
+		if got := formatSlackTimestamp(parseSlackTimestamp(ts)); got != ts {
+			t.Errorf("round trip of %s gave %s", ts, got)
+		}
+	}
+}
+
+func TestSlackMarkRead(t *testing.T) {
+	var marks []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/conversations.mark" {
+			t.Errorf("unexpected call to %s", r.URL.Path)
+		}
+		_ = r.ParseForm()
+		marks = append(marks, r.FormValue("channel")+"@"+r.FormValue("ts"))
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	connector := &SlackConnector{
+		serviceName: "slack",
+		botName:     "ops",
+		api:         slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")),
+		publish:     func(protocol.Event) {},
+		channels:    map[string]struct{}{},
+	}
+
+	connector.rememberReceived("C1", "1700000002.000200")
+	connector.rememberReceived("C1", "1700000001.000100") // late delivery of an older message
+
+	ctx := context.Background()
+	if err := connector.MarkRead(ctx, "C1", time.Time{}); err != nil {
+		t.Fatalf("mark read: %v", err)
+	}
+	if err := connector.MarkRead(ctx, "C1", parseSlackTimestamp("1700000001.000100")); err != nil {
+		t.Fatalf("mark read through: %v", err)
+	}
+	if err := connector.MarkRead(ctx, "C2", time.Time{}); err != nil {
+		t.Fatalf("mark read of an idle channel: %v", err)
+	}
+
+	want := []string{"C1@1700000002.000200", "C1@1700000001.000100"}
+	if strings.Join(marks, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected marks %v, got %v", want, marks)
+	}
+}
+
+func TestMattermostMarkRead(t *testing.T) {
+	var viewed []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/channels/members/me/view", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			t.Errorf("missing bearer token")
+		}
+		var req mmViewChannelRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		viewed = append(viewed, req.ChannelID)
+		_, _ = w.Write([]byte(`{"status":"OK"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	connector := &MattermostConnector{
+		serviceName: "mattermost",
+		botName:     "ops",
+		endpoint:    srv.URL,
+		token:       "tok",
+		httpClient:  srv.Client(),
+		channels:    map[string]struct{}{},
+	}
+	if err := connector.MarkRead(context.Background(), "CH1", time.Now()); err != nil {
+		t.Fatalf("mark read: %v", err)
+	}
+	if len(viewed) != 1 || viewed[0] != "CH1" {
+		t.Fatalf("expected CH1 viewed, got %v", viewed)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Presence
+// ---------------------------------------------------------------------------
+
+func TestValidatePresence(t *testing.T) {
+	empty := ""
+	long := strings.Repeat("x", maxPresenceStatus+1)
+	tests := []struct {
+		name     string
+		presence *protocol.Presence
+		want     string
+	}{
+		{name: "state only", presence: &protocol.Presence{State: PresenceAway}},
+		{name: "clear status", presence: &protocol.Presence{Status: &empty}},
+		{name: "missing", presence: nil, want: "needs a state or a status"},
+		{name: "empty", presence: &protocol.Presence{}, want: "needs a state or a status"},
+		{name: "unknown state", presence: &protocol.Presence{State: "busy"}, want: "presence state must be"},
+		{name: "long status", presence: &protocol.Presence{Status: &long}, want: "longer than 100 characters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePresence(tt.presence)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestSlackSetPresence(t *testing.T) {
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		switch r.URL.Path {
+		case "/users.setPresence":
+			calls = append(calls, "presence="+r.FormValue("presence"))
+		case "/users.profile.set":
+			var profile struct {
+				StatusText string `json:"status_text"`
+			}
+			_ = json.Unmarshal([]byte(r.FormValue("profile")), &profile)
+			calls = append(calls, "status="+profile.StatusText)
+		default:
+			t.Errorf("unexpected call to %s", r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	connector := &SlackConnector{
+		serviceName: "slack",
+		botName:     "ops",
+		api:         slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")),
+		publish:     func(protocol.Event) {},
+		channels:    map[string]struct{}{},
+	}
+
+	status := "Reviewing PRs"
+	ctx := context.Background()
+	if err := connector.SetPresence(ctx, protocol.Presence{State: PresenceDND, Status: &status}); err != nil {
+		t.Fatalf("set presence: %v", err)
+	}
+	if err := connector.SetPresence(ctx, protocol.Presence{State: PresenceOnline}); err != nil {
+		t.Fatalf("set presence: %v", err)
+	}
+
+	want := []string{"presence=away", "status=Reviewing PRs", "presence=auto"}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected calls %v, got %v", want, calls)
+	}
+}
+
+func TestMattermostSetPresence(t *testing.T) {
+	var calls []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/users/U1/status", func(w http.ResponseWriter, r *http.Request) {
+		var req mmStatusRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		calls = append(calls, r.Method+" status "+req.UserID+"="+req.Status)
+		_, _ = w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("/api/v4/users/me/status/custom", func(w http.ResponseWriter, r *http.Request) {
+		var req mmCustomStatusRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		calls = append(calls, r.Method+" custom "+req.Text)
+		_, _ = w.Write([]byte(`{}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	connector := &MattermostConnector{
+		serviceName: "mattermost",
+		botName:     "ops",
+		endpoint:    srv.URL,
+		token:       "tok",
+		httpClient:  srv.Client(),
+		channels:    map[string]struct{}{},
+		selfUser:    "U1",
+	}
+
+	status := "Reviewing PRs"
+	empty := ""
+	ctx := context.Background()
+	if err := connector.SetPresence(ctx, protocol.Presence{State: PresenceDND, Status: &status}); err != nil {
+		t.Fatalf("set presence: %v", err)
+	}
+	if err := connector.SetPresence(ctx, protocol.Presence{Status: &empty}); err != nil {
+		t.Fatalf("clear status: %v", err)
+	}
+
+	want := []string{"PUT status U1=dnd", "PUT custom Reviewing PRs", "DELETE custom "}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected calls %v, got %v", want, calls)
+	}
+}
+
+func TestDiscordStatusData(t *testing.T) {
+	status := "Reviewing PRs"
+	data := discordStatusData(protocol.Presence{State: PresenceAway, Status: &status})
+	if data.Status != "idle" {
+		t.Fatalf("expected away to map to idle, got %q", data.Status)
+	}
+	if len(data.Activities) != 1 || data.Activities[0].Type != discordgo.ActivityTypeCustom || data.Activities[0].State != status {
+		t.Fatalf("expected a custom status activity, got %+v", data.Activities)
+	}
+
+	if data := discordStatusData(protocol.Presence{State: PresenceDND}); data.Status != "dnd" || len(data.Activities) != 0 {
+		t.Fatalf("expected dnd without activities, got %+v", data)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Channel management
+// ---------------------------------------------------------------------------
+
+func TestSlackChannelManagement(t *testing.T) {
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		switch r.URL.Path {
+		case "/conversations.join", "/conversations.leave":
+			calls = append(calls, r.URL.Path+" "+r.FormValue("channel"))
+			_, _ = w.Write([]byte(`{"ok":true,"channel":{"id":"` + r.FormValue("channel") + `"}}`))
+		case "/conversations.create":
+			calls = append(calls, r.URL.Path+" "+r.FormValue("name")+" private="+r.FormValue("is_private"))
+			_, _ = w.Write([]byte(`{"ok":true,"channel":{"id":"C9"}}`))
+		case "/conversations.invite":
+			calls = append(calls, r.URL.Path+" "+r.FormValue("channel")+" "+r.FormValue("users"))
+			_, _ = w.Write([]byte(`{"ok":true,"channel":{"id":"C9"}}`))
+		default:
+			t.Errorf("unexpected call to %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	connector := &SlackConnector{
+		serviceName: "slack",
+		botName:     "ops",
+		api:         slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")),
+		publish:     func(protocol.Event) {},
+		channels:    map[string]struct{}{"C0": {}},
+	}
+
+	ctx := context.Background()
+	if err := connector.JoinChannel(ctx, "C1"); err != nil {
+		t.Fatalf("join: %v", err)
+	}
+	id, err := connector.CreateChannel(ctx, "release-train", true, "")
+	if err != nil || id != "C9" {
+		t.Fatalf("create: %q, %v", id, err)
+	}
+	if err := connector.InviteToChannel(ctx, "C9", []string{"U1", "U2"}); err != nil {
+		t.Fatalf("invite: %v", err)
+	}
+	if err := connector.LeaveChannel(ctx, "C1"); err != nil {
+		t.Fatalf("leave: %v", err)
+	}
+
+	want := []string{
+		"/conversations.join C1",
+		"/conversations.create release-train private=true",
+		"/conversations.invite C9 U1,U2",
+		"/conversations.leave C1",
+	}
+	if strings.Join(calls, "|") != strings.Join(want, "|") {
+		t.Fatalf("expected calls %v, got %v", want, calls)
+	}
+	if !connector.acceptsChannel("C1") || !connector.acceptsChannel("C9") {
+		t.Fatal("expected joined and created channels to be accepted")
+	}
+}
+
+func TestMattermostChannelManagement(t *testing.T) {
+	var calls []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/users/me/teams", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"id":"T1"}]`))
+	})
+	mux.HandleFunc("/api/v4/channels", func(w http.ResponseWriter, r *http.Request) {
+		var req mmCreateChannelRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		calls = append(calls, "create "+req.TeamID+" "+req.Name+" "+req.DisplayName+" "+req.Type)
+		_, _ = w.Write([]byte(`{"id":"CH9"}`))
+	})
+	mux.HandleFunc("/api/v4/channels/CH9/members", func(w http.ResponseWriter, r *http.Request) {
+		var req mmChannelMemberRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		calls = append(calls, "add "+req.UserID)
+		_, _ = w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("/api/v4/channels/CH9/members/U1", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" U1")
+		_, _ = w.Write([]byte(`{}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	connector := &MattermostConnector{
+		serviceName: "mattermost",
+		botName:     "ops",
+		endpoint:    srv.URL,
+		token:       "tok",
+		httpClient:  srv.Client(),
+		channels:    map[string]struct{}{},
+		selfUser:    "U1",
+	}
+
+	ctx := context.Background()
+	id, err := connector.CreateChannel(ctx, "Release Train", true, "")
+	if err != nil || id != "CH9" {
+		t.Fatalf("create: %q, %v", id, err)
+	}
+	if err := connector.InviteToChannel(ctx, "CH9", []string{"U2", "U3"}); err != nil {
+		t.Fatalf("invite: %v", err)
+	}
+	if err := connector.JoinChannel(ctx, "CH9"); err != nil {
+		t.Fatalf("join: %v", err)
+	}
+	if err := connector.LeaveChannel(ctx, "CH9"); err != nil {
+		t.Fatalf("leave: %v", err)
+	}
+
+	want := []string{"create T1 release-train Release Train P", "add U2", "add U3", "add U1", "DELETE U1"}
+	if strings.Join(calls, "|") != strings.Join(want, "|") {
+		t.Fatalf("expected calls %v, got %v", want, calls)
+	}
+}
+
+func TestMattermostWebsocketEvent(t *testing.T) {
+	m := &MattermostConnector{
+		serviceName: "mattermost",
+		botName:     "ops",
+		selfUser:    "BOT",
+		channels:    map[string]struct{}{"CH1": {}},
+	}
+	postData := func(post string) map[string]interface{} { return map[string]interface{}{"post": post} }
+
+	tests := []struct {
+		name    string
+		wsEvent mmWebSocketEvent
+		want    protocol.Event
+		ok      bool
+	}{
+		{
+			name:    "posted",
+			wsEvent: mmWebSocketEvent{Event: "posted", Data: postData(`{"id":"P1","message":"hi","channel_id":"CH1","root_id":"R1","user_id":"U1","create_at":1700000000000}`)},
+			want:    protocol.Event{Kind: "message", Target: "channel:CH1", Channel: "CH1", Thread: "R1", MessageID: "P1", User: "U1", Text: "hi"},
+			ok:      true,
+		},
+		{
+			name: "posted in a direct channel",
+			wsEvent: mmWebSocketEvent{Event: "posted", Data: map[string]interface{}{
+				"post":         `{"id":"P2","message":"psst","channel_id":"CH1","user_id":"U1","create_at":1700000000000}`,
+				"channel_type": "D",
+			}},
+			want: protocol.Event{Kind: "message", Target: "channel:CH1", Channel: "CH1", MessageID: "P2", User: "U1", Text: "psst", Direct: true},
+			ok:   true,
+		},
+		{
+			name:    "edited",
+			wsEvent: mmWebSocketEvent{Event: "post_edited", Data: postData(`{"id":"P1","message":"hi again","channel_id":"CH1","root_id":"R1","user_id":"U1","edit_at":1700000060000}`)},
+			want:    protocol.Event{Kind: protocol.KindEdit, Target: "post:P1", Channel: "CH1", Thread: "R1", MessageID: "P1", User: "U1", Text: "hi again"},
+			ok:      true,
+		},
+		{
+			name:    "deleted",
+			wsEvent: mmWebSocketEvent{Event: "post_deleted", Data: postData(`{"id":"P1","message":"hi again","channel_id":"CH1","user_id":"U1","delete_at":1700000120000}`)},
+			want:    protocol.Event{Kind: protocol.KindDelete, Target: "post:P1", Channel: "CH1", MessageID: "P1", User: "U1"},
+			ok:      true,
+		},
+		{
+			name: "reaction",
+			wsEvent: mmWebSocketEvent{
+				Event:     "reaction_added",
+				Data:      map[string]interface{}{"reaction": `{"user_id":"U2","post_id":"P1","emoji_name":"white_check_mark","create_at":1700000180000}`},
+				Broadcast: mmBroadcast{ChannelID: "CH1"},
+			},
+			want: protocol.Event{Kind: protocol.KindReaction, Target: "post:P1", Channel: "CH1", MessageID: "P1", User: "U2", Text: "white_check_mark"},
+			ok:   true,
+		},
+		{
+			name:    "own edit",
+			wsEvent: mmWebSocketEvent{Event: "post_edited", Data: postData(`{"id":"P2","message":"x","channel_id":"CH1","user_id":"BOT"}`)},
+		},
+		{
+			name: "reaction in unwatched channel",
+			wsEvent: mmWebSocketEvent{
+				Event:     "reaction_added",
+				Data:      map[string]interface{}{"reaction": `{"user_id":"U2","post_id":"P9","emoji_name":"eyes"}`},
+				Broadcast: mmBroadcast{ChannelID: "CH2"},
+			},
+		},
+		{
+			name:    "other event",
+			wsEvent: mmWebSocketEvent{Event: "typing", Data: map[string]interface{}{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := m.websocketEvent(tt.wsEvent)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if got.Timestamp.IsZero() || got.Direction != "in" || got.Service != "mattermost" || got.Bot != "ops" {
+				t.Fatalf("unexpected event envelope: %+v", got)
+			}
+			got.Timestamp, got.Direction, got.Service, got.Bot = time.Time{}, "", "", ""
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("event = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMattermostReadMarkers(t *testing.T) {
+	m := &MattermostConnector{
+		serviceName: "mattermost",
+		botName:     "ops",
+		channels:    map[string]struct{}{"CH1": {}},
+	}
+
+	viewed := m.readMarkers(mmWebSocketEvent{Event: "channel_viewed", Data: map[string]interface{}{"channel_id": "CH1"}})
+	if len(viewed) != 1 || viewed[0].Kind != protocol.KindRead || viewed[0].Channel != "CH1" || viewed[0].Timestamp.IsZero() {
+		t.Fatalf("unexpected channel_viewed markers: %+v", viewed)
+	}
+
+	multiple := m.readMarkers(mmWebSocketEvent{
+		Event: "multiple_channels_viewed",
+		Data:  map[string]interface{}{"channel_times": map[string]interface{}{"CH1": float64(1700000000000), "CH2": float64(1700000000000)}},
+	})
+	if len(multiple) != 1 || !multiple[0].Timestamp.Equal(time.UnixMilli(1700000000000)) {
+		t.Fatalf("expected one marker for the watched channel at its view time, got %+v", multiple)
+	}
+
+	if got := m.readMarkers(mmWebSocketEvent{Event: "posted", Data: map[string]interface{}{}}); len(got) != 0 {
+		t.Fatalf("expected no markers for a post, got %+v", got)
+	}
+}
+
+func TestMattermostIncludeSelf(t *testing.T) {
+	published := make(chan protocol.Event, 2)
+	m := &MattermostConnector{
+		serviceName: "mattermost",
+		botName:     "ops",
+		selfUser:    "BOT",
+		publish:     func(event protocol.Event) { published <- event },
+		echoes:      &echoFilter{grace: 10 * time.Millisecond, sent: map[string]time.Time{}, pending: map[string]*time.Timer{}},
+		channels:    map[string]struct{}{"CH1": {}},
+	}
+	own := func(id string) mmWebSocketEvent {
+		return mmWebSocketEvent{Event: "posted", Data: map[string]interface{}{
+			"post": `{"id":"` + id + `","message":"from my phone","channel_id":"CH1","user_id":"BOT","create_at":1700000000000}`,
+		}}
+	}
+
+	// Posts the connector sent itself were published by Send already.
+	m.echoes.claim("P1")
+	if _, ok := m.websocketEvent(own("P1")); ok {
+		t.Fatal("expected the bot's own post not to be returned as inbound")
+	}
+	if _, ok := m.websocketEvent(own("P2")); ok {
+		t.Fatal("expected the bot's own post not to be returned as inbound")
+	}
+
+	select {
+	case event := <-published:
+		if event.Direction != "out" || event.User != "BOT" || event.Text != "from my phone" {
+			t.Fatalf("unexpected echo event: %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the post from another client to be published")
+	}
+	select {
+	case event := <-published:
+		t.Fatalf("expected the claimed post to be dropped, got %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestEchoFilter(t *testing.T) {
+	f := &echoFilter{grace: time.Hour, sent: map[string]time.Time{}, pending: map[string]*time.Timer{}}
+
+	// The echo can arrive before Send returns; the claim still wins.
+	f.echo("E1", func() { t.Error("expected the claimed echo not to be published") })
+	f.claim("E1")
+	if len(f.pending) != 0 || len(f.sent) != 0 {
+		t.Fatalf("expected the claim to settle the echo, got pending=%v sent=%v", f.pending, f.sent)
+	}
+
+	var disabled *echoFilter
+	disabled.claim("E2")
+	disabled.echo("E2", func() { t.Error("expected a nil filter to drop self messages") })
+}
+
+func TestMattermostChannelName(t *testing.T) {
+	tests := map[string]string{
+		"Release Train":    "release-train",
+		"  ops_alerts  ":   "ops_alerts",
+		"v1.2 rollout!":    "v1-2-rollout",
+		"-- weird name --": "weird-name",
+	}
+	for display, want := range tests {
+		if got := mattermostChannelName(display); got != want {
+			t.Errorf("mattermostChannelName(%q) = %q, want %q", display, got, want)
+		}
+	}
+}
+
+func TestDiscordChannelOverwrites(t *testing.T) {
+	if overwrites := discordChannelOverwrites("G1", "B1", false); overwrites != nil {
+		t.Fatalf("expected no overwrites for a public channel, got %+v", overwrites)
+	}
+
+	overwrites := discordChannelOverwrites("G1", "B1", true)
+	if len(overwrites) != 2 {
+		t.Fatalf("expected two overwrites, got %+v", overwrites)
+	}
+	if everyone := overwrites[0]; everyone.ID != "G1" || everyone.Type != discordgo.PermissionOverwriteTypeRole || everyone.Deny&discordgo.PermissionViewChannel == 0 {
+		t.Fatalf("expected @everyone to be hidden, got %+v", everyone)
+	}
+	if self := overwrites[1]; self.ID != "B1" || self.Allow != discordMemberAccess {
+		t.Fatalf("expected the bot to keep access, got %+v", self)
+	}
+}
+
+func TestUnsupportedChannelOperations(t *testing.T) {
+	ctx := context.Background()
+	discord := &DiscordConnector{}
+	if err := discord.JoinChannel(ctx, "C1"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("expected discord join to be unsupported, got %v", err)
+	}
+	telegram := &TelegramConnector{}
+	if _, err := telegram.CreateChannel(ctx, "ops", false, ""); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("expected telegram create to be unsupported, got %v", err)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Supervisor
+// ---------------------------------------------------------------------------
+
+// flakyConnector returns from Run at once the first fails times, then runs
+// until cancelled.
+type flakyConnector struct {
+	MockConnector
+	fails int32
+	runs  atomic.Int32
+}
+
+func (c *flakyConnector) Run(ctx context.Context) {
+	if c.runs.Add(1) <= c.fails {
+		return
+	}
+	<-ctx.Done()
+}
+
+func TestClassifyStatus(t *testing.T) {
+	tests := map[string]string{
+		"connector online":                         StatusOnline,
+		"socket mode connected":                    StatusOnline,
+		"connector offline":                        StatusStopped,
+		"warning: slow server":                     StatusInfo,
+		"zulip auth failed: 401":                   StatusDown,
+		StatusDownAlert + "10m0s (x)":              StatusDown,
+		"slack reconnecting...":                    StatusDown,
+		"socket mode connection error":             StatusDown,
+		"mattermost websocket disconnected: EOF":   StatusDown,
+		"plugin exited: exit status 3":             StatusDown,
+		"not paired - run: pantalk pair --bot wa":  StatusDown,
+		"connector stopped; restarting in 2s":      StatusDown,
+		"logged out - restart pantalkd to re-pair": StatusDown,
+		"syncing 40 channels":                      StatusUnknown,
+		"":                                         StatusUnknown,
+	}
+	for text, want := range tests {
+		if got := ClassifyStatus(text); got != want {
+			t.Errorf("ClassifyStatus(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestSupervisor_RestartsConnector(t *testing.T) {
+	var mu sync.Mutex
+	var statuses []string
+	sup := NewSupervisor(SupervisorConfig{Backoff: time.Millisecond, MaxBackoff: 4 * time.Millisecond}, func(event protocol.Event) {
+		mu.Lock()
+		statuses = append(statuses, event.Text)
+		mu.Unlock()
+	})
+
+	connector := &flakyConnector{fails: 3}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sup.Run(ctx, connector)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for connector.runs.Load() < 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 4 runs, got %d", connector.runs.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if got := connector.runs.Load(); got != 4 {
+		t.Fatalf("expected no restart after cancel, got %d runs", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(statuses) != 3 || !strings.HasPrefix(statuses[0], "connector stopped; restarting in") {
+		t.Fatalf("expected one status per restart, got %q", statuses)
+	}
+}
+
+func TestSupervisor_CapsRestartsPerWindow(t *testing.T) {
+	var mu sync.Mutex
+	var statuses []string
+	sup := NewSupervisor(SupervisorConfig{Backoff: time.Millisecond, MaxRestarts: 2, Window: time.Hour}, func(event protocol.Event) {
+		mu.Lock()
+		statuses = append(statuses, event.Text)
+		mu.Unlock()
+	})
+
+	connector := &flakyConnector{fails: 100}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sup.Run(ctx, connector)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(statuses)
+		mu.Unlock()
+		if n >= 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the restart limit to be reached, got %q", statuses)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if got := connector.runs.Load(); got != 3 {
+		t.Fatalf("expected the first run plus 2 restarts, got %d runs", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !strings.Contains(statuses[2], "2 restarts in 1h0m0s, next attempt in") {
+		t.Fatalf("expected a restart limit notice, got %q", statuses[2])
+	}
+}
+
+func TestSupervisor_DownAlert(t *testing.T) {
+	alerts := make(chan string, 4)
+	sup := NewSupervisor(SupervisorConfig{DownAlertAfter: 20 * time.Millisecond}, func(event protocol.Event) {
+		if strings.HasPrefix(event.Text, StatusDownAlert) {
+			alerts <- event.Text
+		}
+	})
+
+	// A short outage doesn't alert.
+	sup.Publish(protocol.Event{Kind: "status", Text: "session ended: EOF"})
+	sup.Publish(protocol.Event{Kind: "status", Text: "connector online"})
+	select {
+	case text := <-alerts:
+		t.Fatalf("unexpected alert after recovery: %q", text)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	sup.Publish(protocol.Event{Kind: "status", Text: "auth failed: 401"})
+	sup.Publish(protocol.Event{Kind: "status", Text: "reconnecting..."})
+	select {
+	case text := <-alerts:
+		if !strings.HasSuffix(text, "(auth failed: 401)") {
+			t.Fatalf("expected the first failure as the reason, got %q", text)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no down alert")
+	}
+	select {
+	case text := <-alerts:
+		t.Fatalf("expected one alert per outage, got %q", text)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Capabilities
+// ---------------------------------------------------------------------------
+
+func TestCapabilitiesMatchInterfaces(t *testing.T) {
+	connectors := map[string]Connector{
+		"slack":      &SlackConnector{},
+		"discord":    &DiscordConnector{},
+		"mattermost": &MattermostConnector{},
+		"telegram":   &TelegramConnector{},
+		"whatsapp":   &WhatsAppConnector{},
+		"zulip":      &ZulipConnector{},
+		"irc":        &IRCConnector{},
+		"matrix":     &MatrixConnector{},
+		"twilio":     &TwilioConnector{},
+		"imessage":   &IMessageConnector{},
+		"mock":       &MockConnector{},
+	}
+
+	for name, connector := range connectors {
+		caps := connector.Capabilities()
+		if _, ok := connector.(ReadMarker); caps.MarkRead && !ok {
+			t.Errorf("%s reports mark_read but is not a ReadMarker", name)
+		}
+		if _, ok := connector.(PresenceSetter); caps.Presence && !ok {
+			t.Errorf("%s reports presence but is not a PresenceSetter", name)
+		}
+		if _, ok := connector.(ChannelManager); caps.Channels && !ok {
+			t.Errorf("%s reports channels but is not a ChannelManager", name)
+		}
+		if _, ok := connector.(TopicLister); caps.Topics && !ok {
+			t.Errorf("%s reports topics but is not a TopicLister", name)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Exec connector
+// ---------------------------------------------------------------------------
+
+// execPlugin is a minimal connector plugin: it greets with the bot name as
+// its identity, reports one inbound message, echoes sends and refuses
+// reactions.
+const execPlugin = `
+echo '{"type":"hello","identity":"'"$PANTALK_BOT"'","capabilities":{"threads":true,"mark_read":true}}'
+echo '{"type":"event","event":{"kind":"message","direction":"in","channel":"C1","user":"U1","text":"hi"}}'
+while read -r line; do
+  id=$(printf '%s' "$line" | sed 's/^{"type":"[a-z]*","id":\([0-9]*\).*/\1/')
+  case "$line" in
+    '{"type":"react"'*) echo '{"type":"result","id":'"$id"',"error":"no reactions here"}' ;;
+    *) echo '{"type":"result","id":'"$id"',"event":{"user":"'"$PANTALK_BOT"'"}}' ;;
+  esac
+done
+`
+
+func TestExecConnector(t *testing.T) {
+	events := make(chan protocol.Event, 16)
+	connector, err := NewExecConnector(config.BotConfig{
+		Name:      "plugin-bot",
+		Type:      "rocketchat",
+		Transport: "exec",
+		Command:   []string{"sh", "-c", execPlugin},
+	}, func(event protocol.Event) { events <- event })
+	if err != nil {
+		t.Fatalf("new exec connector: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		connector.Run(ctx)
+		close(done)
+	}()
+
+	next := func() protocol.Event {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for an event")
+			return protocol.Event{}
+		}
+	}
+
+	if event := next(); event.Kind != "status" || event.Text != "connector online" {
+		t.Fatalf("expected online status, got %+v", event)
+	}
+	if event := next(); event.Service != "rocketchat" || event.Bot != "plugin-bot" || event.Text != "hi" || event.Direction != "in" {
+		t.Fatalf("unexpected inbound event: %+v", event)
+	}
+	if got := connector.Identity(); got != "plugin-bot" {
+		t.Fatalf("expected identity from hello, got %q", got)
+	}
+	if caps := connector.Capabilities(); !caps.Threads || caps.MarkRead {
+		t.Fatalf("expected threads and no mark_read, got %+v", caps)
+	}
+
+	sent, err := connector.Send(ctx, protocol.Request{Channel: "C1", Thread: "T1", Text: "hello"})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if sent.Direction != "out" || sent.Channel != "C1" || sent.Thread != "T1" || sent.Text != "hello" || sent.User != "plugin-bot" {
+		t.Fatalf("unexpected send event: %+v", sent)
+	}
+	if event := next(); event.Text != "hello" {
+		t.Fatalf("expected the sent message published, got %+v", event)
+	}
+
+	if err := connector.React(ctx, protocol.Request{Channel: "C1", Thread: "1", Emoji: "eyes"}); err == nil || err.Error() != "no reactions here" {
+		t.Fatalf("expected the plugin's error, got %v", err)
+	}
+
+	cancel()
+	<-done
+	if event := next(); event.Text != "connector offline" {
+		t.Fatalf("expected offline status, got %+v", event)
+	}
+	if _, err := connector.Send(context.Background(), protocol.Request{Channel: "C1", Text: "late"}); err == nil {
+		t.Fatal("expected send to fail once the plugin stopped")
+	}
+}
+
+func TestExecConnector_PluginExit(t *testing.T) {
+	events := make(chan protocol.Event, 4)
+	connector, err := NewExecConnector(config.BotConfig{
+		Name:    "plugin-bot",
+		Type:    "rocketchat",
+		Command: []string{"sh", "-c", "echo bad credentials >&2; exit 3"},
+	}, func(event protocol.Event) { events <- event })
+	if err != nil {
+		t.Fatalf("new exec connector: %v", err)
+	}
+
+	connector.Run(context.Background())
+	if event := <-events; event.Text != "plugin exited: exit status 3" || ClassifyStatus(event.Text) != StatusDown {
+		t.Fatalf("expected a down status, got %+v", event)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Block Kit
+// ---------------------------------------------------------------------------
+
+func TestNormalizeBlocks(t *testing.T) {
+	report := `[
+		{"type": "header", "text": {"type": "plain_text", "text": "Nightly report"}},
+		{"type": "section", "text": {"type": "mrkdwn", "text": "*3* jobs failed"}, "fields": [{"type": "mrkdwn", "text": "build: ok"}]},
+		{"type": "divider"},
+		{"type": "context", "elements": [{"type": "image", "image_url": "https://example.com/x.png", "alt_text": "x"}, {"type": "mrkdwn", "text": "ran 02:00 UTC"}]}
+	]`
+
+	tests := []struct {
+		name         string
+		raw          string
+		wantFallback string
+		wantErr      string
+	}{
+		{name: "array", raw: report, wantFallback: "Nightly report\n*3* jobs failed\nbuild: ok\nran 02:00 UTC"},
+		{name: "block kit builder export", raw: `{"blocks": [{"type": "section", "text": {"type": "mrkdwn", "text": "hi"}}]}`, wantFallback: "hi"},
+		{name: "no text", raw: `[{"type": "divider"}]`},
+		{name: "not json", raw: `blocks`, wantErr: "JSON array"},
+		{name: "empty", raw: `[]`, wantErr: "cannot be empty"},
+		{name: "unknown type", raw: `[{"type": "carousel"}]`, wantErr: `unsupported block type "carousel"`},
+		{name: "too many", raw: "[" + strings.TrimSuffix(strings.Repeat(`{"type": "divider"},`, 51), ",") + "]", wantErr: "at most 50"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, fallback, err := NormalizeBlocks(json.RawMessage(tt.raw))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fallback != tt.wantFallback {
+				t.Fatalf("expected fallback %q, got %q", tt.wantFallback, fallback)
+			}
+			if !strings.HasPrefix(string(blocks), "[") {
+				t.Fatalf("expected a block array, got %s", blocks)
+			}
+		})
+	}
+}
+
+func TestSlackSendBlocks(t *testing.T) {
+	var posts []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.URL.Path != "/chat.postMessage" {
+			t.Errorf("unexpected call to %s", r.URL.Path)
+		}
+		posts = append(posts, r.PostForm)
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1700000000.000100"}`))
+	}))
+	defer srv.Close()
+
+	connector := &SlackConnector{
+		serviceName: "slack",
+		botName:     "ops",
+		api:         slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")),
+		publish:     func(protocol.Event) {},
+		channels:    map[string]struct{}{},
+	}
+
+	blocks := json.RawMessage(`[{"type":"section","text":{"type":"mrkdwn","text":"*deploy* done"}},{"type":"divider"}]`)
+	if _, err := connector.Send(context.Background(), protocol.Request{Channel: "C1", Text: strings.Repeat("long fallback ", 500), Blocks: blocks}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	if len(posts) != 1 {
+		t.Fatalf("expected the layout posted once, got %d posts", len(posts))
+	}
+	var sent []map[string]any
+	if err := json.Unmarshal([]byte(posts[0].Get("blocks")), &sent); err != nil {
+		t.Fatalf("decode posted blocks: %v", err)
+	}
+	if len(sent) != 2 || sent[0]["type"] != "section" || sent[1]["type"] != "divider" {
+		t.Fatalf("unexpected posted blocks: %s", posts[0].Get("blocks"))
+	}
+	if posts[0].Get("text") == "" {
+		t.Fatal("expected the text as notification fallback")
+	}
+}
+
+func TestPreview(t *testing.T) {
+	long := strings.Repeat("word ", 1000) // 5000 characters, over Telegram's limit
+
+	tests := []struct {
+		name     string
+		service  string
+		request  protocol.Request
+		channel  string
+		messages int
+		format   string
+		err      string
+	}{
+		{name: "slack target", service: "slack", request: protocol.Request{Target: "channel:C1", Text: "hi"}, channel: "C1", messages: 1},
+		{name: "telegram split", service: "telegram", request: protocol.Request{Channel: "42", Text: long}, channel: "42", messages: 2},
+		{name: "telegram markdown", service: "telegram", request: protocol.Request{Channel: "42", Text: "**hi**", Format: "markdown"}, channel: "42", messages: 1, format: "HTML"},
+		{name: "whatsapp number", service: "whatsapp", request: protocol.Request{Target: "chat:15551234567", Text: "hi"}, channel: "15551234567@s.whatsapp.net", messages: 1},
+		{name: "exec plugin", service: "rocketchat", request: protocol.Request{Channel: "general", Text: "hi", Format: "markdown"}, channel: "general", messages: 1, format: "markdown"},
+		{name: "no destination", service: "mattermost", request: protocol.Request{Text: "hi"}, err: "mattermost send requires channel or target"},
+		{name: "bad format", service: "zulip", request: protocol.Request{Channel: "ops", Text: "hi", Format: "rtf"}, err: "unsupported format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preview, err := Preview(tt.service, tt.request)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("preview: %v", err)
+			}
+			if preview.Service != tt.service || preview.Channel != tt.channel || len(preview.Messages) != tt.messages {
+				t.Fatalf("unexpected preview: %+v", preview)
+			}
+			if got := preview.Messages[0].Format; got != tt.format {
+				t.Fatalf("format = %q, want %q", got, tt.format)
+			}
+		})
+	}
+}
+
+func TestTelegramRotateToken(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/botnew/getMe", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"id":42,"username":"ops_bot"}}`))
+	})
+	mux.HandleFunc("/botother/getMe", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"id":7,"username":"someone_bot"}}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	connector := &TelegramConnector{
+		serviceName: "telegram",
+		botName:     "ops",
+		endpoint:    srv.URL,
+		baseURL:     srv.URL + "/botold",
+		httpClient:  srv.Client(),
+		channels:    map[string]struct{}{},
+		selfBotID:   42,
+	}
+
+	if err := connector.RotateToken(context.Background(), "other"); err == nil {
+		t.Fatal("expected a token of another bot to be refused")
+	}
+	if err := connector.RotateToken(context.Background(), "revoked"); err == nil {
+		t.Fatal("expected a token getMe rejects to be refused")
+	}
+	if got := connector.apiURL(); got != srv.URL+"/botold" {
+		t.Fatalf("expected the old token kept after failures, got %s", got)
+	}
+
+	if err := connector.RotateToken(context.Background(), "new"); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if got := connector.apiURL(); got != srv.URL+"/botnew" {
+		t.Fatalf("expected the new token in use, got %s", got)
+	}
+}
+
+func TestMattermostRotateToken(t *testing.T) {
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		calls = append(calls, auth)
+		switch auth {
+		case "Bearer new":
+			_, _ = w.Write([]byte(`{"id":"u1","username":"ops"}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	connector := &MattermostConnector{
+		serviceName: "mattermost",
+		botName:     "ops",
+		endpoint:    srv.URL,
+		token:       "old",
+		httpClient:  srv.Client(),
+		channels:    map[string]struct{}{},
+		selfUser:    "u1",
+	}
+
+	if err := connector.RotateToken(context.Background(), "revoked"); err == nil || connector.authToken() != "old" {
+		t.Fatalf("expected a rejected token to leave the old one, got %v", err)
+	}
+	if err := connector.RotateToken(context.Background(), "new"); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if _, err := connector.getMe(context.Background()); err != nil {
+		t.Fatalf("expected later calls to use the new token: %v", err)
+	}
+	if last := calls[len(calls)-1]; last != "Bearer new" {
+		t.Fatalf("expected the new token sent, got %q", last)
+	}
+}
+
+func TestSlackUserToken(t *testing.T) {
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		calls = append(calls, r.URL.Path+" "+r.FormValue("token"))
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	connector := &SlackConnector{
+		serviceName: "slack",
+		botName:     "ops",
+		api:         slack.New("xoxb-bot", slack.OptionAPIURL(srv.URL+"/")),
+		userAPI:     slack.New("xoxp-user", slack.OptionAPIURL(srv.URL+"/")),
+		channels:    map[string]struct{}{},
+		selfUser:    "UBOT",
+		selfAccount: "UHUMAN",
+	}
+
+	if err := connector.MarkRead(context.Background(), "C1", time.Unix(1700000000, 0)); err != nil {
+		t.Fatalf("mark read: %v", err)
+	}
+	if len(calls) != 1 || calls[0] != "/conversations.mark xoxp-user" {
+		t.Fatalf("expected conversations.mark made with the user token, got %v", calls)
+	}
+
+	for user, want := range map[string]bool{"UBOT": true, "UHUMAN": true, "UOTHER": false} {
+		if got := connector.isSelfMessage(&slackevents.MessageEvent{User: user}); got != want {
+			t.Fatalf("isSelfMessage(%s) = %v, want %v", user, got, want)
+		}
+	}
+	if connector.Identity() != "UBOT" || connector.UserIdentity() != "UHUMAN" {
+		t.Fatalf("expected both identities, got %q and %q", connector.Identity(), connector.UserIdentity())
+	}
+}
+
+func signSlackWebhook(secret string, body []byte) http.Header {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + string(body)))
+	header := http.Header{}
+	header.Set("X-Slack-Request-Timestamp", timestamp)
+	header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	header.Set("Content-Type", "application/json")
+	return header
+}
+
+// nextWebhookEvent waits for an event a webhook handled after answering.
+func nextWebhookEvent(t *testing.T, events <-chan protocol.Event) protocol.Event {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the webhook's event")
+		return protocol.Event{}
+	}
+}
+
+func TestSlackHandleWebhook(t *testing.T) {
+	events := make(chan protocol.Event, 4)
+	connector := &SlackConnector{
+		serviceName:   "slack",
+		botName:       "ops",
+		signingSecret: "shh",
+		channels:      map[string]struct{}{},
+		selfUser:      "UBOT",
+		publish:       func(event protocol.Event) { events <- event },
+	}
+	ctx := context.Background()
+
+	challenge := []byte(`{"type":"url_verification","challenge":"abc123"}`)
+	reply, err := connector.HandleWebhook(ctx, signSlackWebhook("shh", challenge), challenge)
+	if err != nil || string(reply) != "abc123" {
+		t.Fatalf("expected the challenge back, got %q, %v", reply, err)
+	}
+
+	if _, err := connector.HandleWebhook(ctx, signSlackWebhook("wrong", challenge), challenge); !errors.Is(err, ErrWebhookUnauthorized) {
+		t.Fatalf("expected ErrWebhookUnauthorized for a bad signature, got %v", err)
+	}
+
+	message := []byte(`{"type":"event_callback","event_id":"Ev01","event":{"type":"message","channel":"C1","channel_type":"channel","user":"U1","text":"hello","ts":"1700000000.000100"}}`)
+	if _, err := connector.HandleWebhook(ctx, signSlackWebhook("shh", message), message); err != nil {
+		t.Fatalf("handle message: %v", err)
+	}
+	if event := nextWebhookEvent(t, events); event.Text != "hello" || event.Channel != "C1" || event.User != "U1" {
+		t.Fatalf("expected the message published, got %+v", event)
+	}
+
+	socket := &SlackConnector{serviceName: "slack", botName: "ops"}
+	if _, err := socket.HandleWebhook(ctx, signSlackWebhook("", message), message); !errors.Is(err, ErrNotWebhook) {
+		t.Fatalf("expected ErrNotWebhook without a signing secret, got %v", err)
+	}
+}
+
+func TestSlackHandleWebhook_DropsRetries(t *testing.T) {
+	events := make(chan protocol.Event, 4)
+	connector := &SlackConnector{
+		serviceName:   "slack",
+		botName:       "ops",
+		signingSecret: "shh",
+		channels:      map[string]struct{}{},
+		selfUser:      "UBOT",
+		publish:       func(event protocol.Event) { events <- event },
+	}
+	ctx := context.Background()
+
+	first := []byte(`{"type":"event_callback","event_id":"Ev01","event":{"type":"message","channel":"C1","channel_type":"channel","user":"U1","text":"one","ts":"1700000000.000100"}}`)
+	second := []byte(`{"type":"event_callback","event_id":"Ev02","event":{"type":"message","channel":"C1","channel_type":"channel","user":"U1","text":"two","ts":"1700000000.000200"}}`)
+	for i, body := range [][]byte{first, first, second} {
+		header := signSlackWebhook("shh", body)
+		if i == 1 {
+			header.Set("X-Slack-Retry-Num", "1")
+		}
+		if _, err := connector.HandleWebhook(ctx, header, body); err != nil {
+			t.Fatalf("handle message: %v", err)
+		}
+	}
+
+	got := []string{nextWebhookEvent(t, events).Text, nextWebhookEvent(t, events).Text}
+	slices.Sort(got)
+	if !slices.Equal(got, []string{"one", "two"}) {
+		t.Fatalf("expected each event once, got %v", got)
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("expected the retry dropped, got %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSlackHandleWebhook_AnswersBeforeHandling(t *testing.T) {
+	release := make(chan struct{})
+	published := make(chan protocol.Event, 1)
+	connector := &SlackConnector{
+		serviceName:   "slack",
+		botName:       "ops",
+		signingSecret: "shh",
+		channels:      map[string]struct{}{},
+		selfUser:      "UBOT",
+		publish: func(event protocol.Event) {
+			<-release // slow middleware
+			published <- event
+		},
+	}
+
+	message := []byte(`{"type":"event_callback","event_id":"Ev01","event":{"type":"message","channel":"C1","channel_type":"channel","user":"U1","text":"hello","ts":"1700000000.000100"}}`)
+	done := make(chan error, 1)
+	go func() {
+		_, err := connector.HandleWebhook(context.Background(), signSlackWebhook("shh", message), message)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("handle message: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the webhook answered while the event is still being handled")
+	}
+
+	close(release)
+	if event := nextWebhookEvent(t, published); event.Text != "hello" {
+		t.Fatalf("expected the message published, got %+v", event)
+	}
+}
+
+func TestDeliveryLog_EvictsOldest(t *testing.T) {
+	var deliveries deliveryLog
+	for i := 0; i < webhookDeliveries+1; i++ {
+		if deliveries.seen(strconv.Itoa(i)) {
+			t.Fatalf("delivery %d reported seen", i)
+		}
+	}
+	if !deliveries.seen(strconv.Itoa(webhookDeliveries)) {
+		t.Fatal("expected the latest delivery remembered")
+	}
+	if deliveries.seen("0") {
+		t.Fatal("expected the oldest delivery forgotten")
+	}
+	if deliveries.seen("") || deliveries.seen("") {
+		t.Fatal("expected deliveries without an ID never to be duplicates")
+	}
+}
+
+func TestTelegramWebhook(t *testing.T) {
+	var setWebhook map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bottest-token/setWebhook", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&setWebhook)
+		_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	events := make(chan protocol.Event, 4)
+	connector := &TelegramConnector{
+		serviceName: "telegram",
+		botName:     "ops",
+		baseURL:     srv.URL + "/bottest-token",
+		httpClient:  srv.Client(),
+		webhook:     true,
+		channels:    map[string]struct{}{},
+		publish:     func(event protocol.Event) { events <- event },
+	}
+	connector.SetWebhookEndpoint("https://pantalk.example.com/v1/webhooks/telegram/ops", "s3cret")
+
+	ctx := context.Background()
+	url, err := connector.setWebhook(ctx)
+	if err != nil {
+		t.Fatalf("setWebhook: %v", err)
+	}
+	if url != "https://pantalk.example.com/v1/webhooks/telegram/ops" || setWebhook["url"] != url || setWebhook["secret_token"] != "s3cret" {
+		t.Fatalf("unexpected setWebhook call %v", setWebhook)
+	}
+
+	update := []byte(`{"update_id":7,"message":{"message_id":3,"date":1700000000,"chat":{"id":-100,"type":"group"},"from":{"id":42},"text":"hi"}}`)
+	header := http.Header{}
+	header.Set("X-Telegram-Bot-Api-Secret-Token", "wrong")
+	if _, err := connector.HandleWebhook(ctx, header, update); !errors.Is(err, ErrWebhookUnauthorized) {
+		t.Fatalf("expected ErrWebhookUnauthorized for a bad secret, got %v", err)
+	}
+	header.Set("X-Telegram-Bot-Api-Secret-Token", "s3cret")
+	if _, err := connector.HandleWebhook(ctx, header, update); err != nil {
+		t.Fatalf("handle update: %v", err)
+	}
+	if event := nextWebhookEvent(t, events); event.Text != "hi" || event.Channel != "-100" || event.User != "42" {
+		t.Fatalf("expected the message published, got %+v", event)
+	}
+
+	// Telegram redelivers an update it got no answer for.
+	if _, err := connector.HandleWebhook(ctx, header, update); err != nil {
+		t.Fatalf("handle redelivered update: %v", err)
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("expected the redelivery dropped, got %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	connector.webhook = false
+	if _, err := connector.HandleWebhook(ctx, header, update); !errors.Is(err, ErrNotWebhook) {
+		t.Fatalf("expected ErrNotWebhook when polling, got %v", err)
+	}
+}
+
+func TestTelegramConnector_Proxy(t *testing.T) {
+	var hosts []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy sees the absolute URL of the upstream request.
+		hosts = append(hosts, r.URL.Host+" "+r.Header.Get("Proxy-Authorization"))
+		_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	proxyURL.User = url.UserPassword("user", "pass")
+	connector, err := NewTelegramConnector(config.BotConfig{
+		Name:     "ops",
+		Type:     "telegram",
+		BotToken: "tok",
+		Endpoint: "http://telegram.invalid",
+		Proxy:    proxyURL.String(),
+	}, func(protocol.Event) {})
+	if err != nil {
+		t.Fatalf("new connector: %v", err)
+	}
+
+	if err := connector.LeaveChannel(context.Background(), "-100"); err != nil {
+		t.Fatalf("leave channel: %v", err)
+	}
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
+	if len(hosts) != 1 || hosts[0] != "telegram.invalid "+auth {
+		t.Fatalf("expected the call to go through the proxy with its credentials, got %v", hosts)
+	}
+
+	if _, err := NewTelegramConnector(config.BotConfig{Name: "ops", Type: "telegram", BotToken: "tok", Proxy: "$PANTALK_TEST_UNSET_PROXY"}, func(protocol.Event) {}); err == nil {
+		t.Fatal("expected an unset proxy variable to fail")
+	}
+}
+
+func TestDialThroughProxy_Connect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	requests := make(chan *http.Request, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			return
+		}
+		requests <- req
+		// The tunnelled server greets right away, in the same write as
+		// the proxy's answer.
+		_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n:irc.example.net NOTICE * :hello\r\n"))
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	proxyURL := &url.URL{Scheme: "http", Host: listener.Addr().String(), User: url.UserPassword("user", "pass")}
+	conn, err := dialThroughProxy(context.Background(), http.ProxyURL(proxyURL), &net.Dialer{Timeout: 5 * time.Second}, "irc.example.net:6697")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	req := <-requests
+	if req.Method != http.MethodConnect || req.Host != "irc.example.net:6697" {
+		t.Fatalf("unexpected proxy request %s %s", req.Method, req.Host)
+	}
+	if user, password, ok := req.BasicAuth(); ok || req.Header.Get("Proxy-Authorization") == "" {
+		t.Fatalf("expected Proxy-Authorization rather than Authorization, got %q %q", user, password)
+	}
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != ":irc.example.net NOTICE * :hello\r\n" {
+		t.Fatalf("expected the server's greeting, got %q, %v", line, err)
+	}
+
+	refused := &url.URL{Scheme: "http", Host: listener.Addr().String()}
+	listener.Close()
+	if _, err := dialThroughProxy(context.Background(), http.ProxyURL(refused), &net.Dialer{Timeout: time.Second}, "irc.example.net:6697"); err == nil {
+		t.Fatal("expected an error when the proxy is unreachable")
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		attempts[r.Method+" "+r.URL.Path]++
+		n := attempts[r.Method+" "+r.URL.Path]
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/limited":
+			if n == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			_, _ = w.Write(body)
+		case "/broken":
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	retries := 2
+	client := newHTTPClient(nil, config.HTTPConfig{Retries: &retries, Backoff: 1}, 5*time.Second)
+
+	// A 429 is retried even for a POST, with the body sent again.
+	resp, err := client.Post(srv.URL+"/limited", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "hello" || attempts["POST /limited"] != 2 {
+		t.Fatalf("expected one retry with the body, got %d %q after %d attempts", resp.StatusCode, body, attempts["POST /limited"])
+	}
+
+	// A 502 may have been processed: only idempotent requests retry it.
+	resp, err = client.Post(srv.URL+"/broken", "text/plain", strings.NewReader("x"))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || attempts["POST /broken"] != 1 {
+		t.Fatalf("expected a POST not to be retried after 502, got %d attempts", attempts["POST /broken"])
+	}
+	resp, err = client.Get(srv.URL + "/broken")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if attempts["GET /broken"] != 1+retries {
+		t.Fatalf("expected a GET to be tried %d times, got %d", 1+retries, attempts["GET /broken"])
+	}
+
+	if got := retryAfter(&http.Response{Header: http.Header{"Retry-After": {"3600"}}}); got != maxRetryAfter {
+		t.Fatalf("expected Retry-After to be capped at %s, got %s", maxRetryAfter, got)
+	}
+}
+
+func TestTelegramConnector_HTTPOptions(t *testing.T) {
+	var timeouts []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req tgGetUpdatesRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		timeouts = append(timeouts, req.Timeout)
+		_, _ = w.Write([]byte(`{"ok":true,"result":[]}`))
+	}))
+	defer srv.Close()
+
+	retries := 0
+	connector, err := NewTelegramConnector(config.BotConfig{
+		Name:     "ops",
+		Type:     "telegram",
+		BotToken: "tok",
+		Endpoint: srv.URL,
+		HTTP:     &config.HTTPConfig{Timeout: 10, PollTimeout: 25, Retries: &retries},
+	}, func(protocol.Event) {})
+	if err != nil {
+		t.Fatalf("new connector: %v", err)
+	}
+
+	if connector.httpClient.Timeout != 10*time.Second {
+		t.Fatalf("expected sends to time out after 10s, got %s", connector.httpClient.Timeout)
+	}
+	if connector.pollClient.Timeout != 25*time.Second+pollMargin {
+		t.Fatalf("expected polls to time out after 25s and the margin, got %s", connector.pollClient.Timeout)
+	}
+	if _, err := connector.getUpdates(context.Background()); err != nil {
+		t.Fatalf("getUpdates: %v", err)
+	}
+	if len(timeouts) != 1 || timeouts[0] != 25 {
+		t.Fatalf("expected getUpdates to wait 25s, got %v", timeouts)
+	}
+}
@@ -0,0 +1,74 @@
+package upstream
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+	"github.com/pantalk/pantalk/internal/transcribe"
+)
+
+// voiceTimeout bounds downloading and transcribing one recording.
+const voiceTimeout = 5 * time.Minute
+
+// voiceTranscriber holds a connector's TranscribeFunc. The server replaces
+// it on every reload, while the connector keeps running.
+type voiceTranscriber struct {
+	mu sync.RWMutex
+	fn TranscribeFunc
+}
+
+func (v *voiceTranscriber) SetTranscribeFunc(fn TranscribeFunc) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.fn = fn
+}
+
+func (v *voiceTranscriber) transcribeFunc() TranscribeFunc {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.fn
+}
+
+// publishVoice publishes event, whose first attachment is a recording. With
+// a transcriber the recording is downloaded and transcribed in the
+// background first and the transcript appended to the event text. Failures
+// are logged and the event is published without it, so a voice message is
+// never lost to a transcription outage.
+func (v *voiceTranscriber) publishVoice(ctx context.Context, event protocol.Event, download func(context.Context) ([]byte, error), publish func(protocol.Event)) {
+	fn := v.transcribeFunc()
+	event.Attachments = append([]protocol.Attachment(nil), event.Attachments...)
+	attachment := &event.Attachments[0]
+	if fn == nil || attachment.Size > transcribe.MaxAudioSize {
+		publish(event)
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, voiceTimeout)
+		defer cancel()
+
+		audio, err := download(ctx)
+		if err != nil {
+			log.Printf("[%s:%s] download of voice message in %s failed: %v", event.Service, event.Bot, event.Channel, err)
+			publish(event)
+			return
+		}
+
+		text, err := fn(ctx, audio, attachment.MimeType)
+		if err != nil {
+			log.Printf("[%s:%s] transcription of voice message in %s failed: %v", event.Service, event.Bot, event.Channel, err)
+			publish(event)
+			return
+		}
+
+		if text != "" {
+			attachment.Transcribed = true
+			event.Text = strings.TrimSpace(event.Text + "\n\n" + text)
+		}
+		publish(event)
+	}()
+}
@@ -0,0 +1,44 @@
+package upstream
+
+import (
+	"container/list"
+	"sync"
+)
+
+// webhookDeliveries is how many delivery IDs a webhook connector remembers
+// to drop the platform's retries. Slack retries within minutes and Telegram
+// redelivers until it gets an answer, so recent ones are enough.
+const webhookDeliveries = 1024
+
+// deliveryLog remembers the IDs of the latest webhook deliveries, least
+// recently seen first out. The zero value is ready to use.
+type deliveryLog struct {
+	mu    sync.Mutex
+	order list.List // of string, most recent at the front
+	ids   map[string]*list.Element
+}
+
+// seen records id and reports whether it was already there. Deliveries
+// without an ID are never duplicates.
+func (d *deliveryLog) seen(id string) bool {
+	if id == "" {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if elem, ok := d.ids[id]; ok {
+		d.order.MoveToFront(elem)
+		return true
+	}
+	if d.ids == nil {
+		d.ids = make(map[string]*list.Element)
+	}
+	d.ids[id] = d.order.PushFront(id)
+	if d.order.Len() > webhookDeliveries {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.ids, oldest.Value.(string))
+	}
+	return false
+}
@@ -35,27 +35,59 @@ type WhatsAppConnector struct {
 	botName     string
 	container   *sqlstore.Container
 	publish     func(protocol.Event)
+	echoes      *echoFilter // nil unless include_self
+	proxy       string      // the bot's proxy: URL; whatsmeow reads HTTPS_PROXY itself
 
 	mu       sync.RWMutex
 	client   *whatsmeow.Client
 	channels map[string]struct{}
 	selfJID  types.JID
+	unread   map[string][]whatsAppUnread // chat JID -> received messages not yet marked read
+
+	// mediaDir is where received images, videos and documents are saved.
+	mediaDir string
+	// download fetches and decrypts the media of a message. Overridable for
+	// testing; nil uses the connected client.
+	download func(context.Context, *waE2E.Message) ([]byte, error)
+
+	voiceTranscriber
+}
+
+// whatsAppUnread is a received message MarkRead can send a receipt for.
+type whatsAppUnread struct {
+	id        types.MessageID
+	sender    types.JID
+	timestamp time.Time
 }
 
+// maxWhatsAppUnread caps the receipts remembered per chat; older messages
+// are dropped, as WhatsApp clients treat a receipt for a newer message as
+// having read the chat anyway.
+const maxWhatsAppUnread = 100
+
 func NewWhatsAppConnector(bot config.BotConfig, publish func(protocol.Event)) (*WhatsAppConnector, error) {
 	// The db_path field specifies where whatsmeow stores encryption keys and
 	// session state. When omitted the database is placed next to the main
 	// PanTalk database.
+	dataDir := filepath.Dir(config.DefaultDBPath())
 	dbPath := strings.TrimSpace(bot.DBPath)
 	if dbPath == "" {
-		dataDir := filepath.Dir(config.DefaultDBPath())
 		dbPath = filepath.Join(dataDir, fmt.Sprintf("whatsapp-%s.db", bot.Name))
 	}
+	mediaDir := strings.TrimSpace(bot.MediaDir)
+	if mediaDir == "" {
+		mediaDir = filepath.Join(dataDir, fmt.Sprintf("whatsapp-%s-media", bot.Name))
+	}
 
 	if err := config.EnsureDir(dbPath); err != nil {
 		return nil, fmt.Errorf("create whatsapp data dir for bot %q: %w", bot.Name, err)
 	}
 
+	proxyURL, err := botProxyURL(bot)
+	if err != nil {
+		return nil, err
+	}
+
 	logger := waLog.Stdout("WhatsApp", "ERROR", true)
 	dsn := fmt.Sprintf("file:%s?_foreign_keys=on", dbPath)
 	container, err := sqlstore.New(context.Background(), "sqlite3", dsn, logger)
@@ -68,7 +100,12 @@ func NewWhatsAppConnector(bot config.BotConfig, publish func(protocol.Event)) (*
 		botName:     bot.Name,
 		container:   container,
 		publish:     publish,
+		echoes:      newEchoFilter(bot.IncludeSelf),
 		channels:    make(map[string]struct{}),
+		mediaDir:    mediaDir,
+	}
+	if proxyURL != nil {
+		connector.proxy = proxyURL.String()
 	}
 
 	for _, ch := range bot.Channels {
@@ -129,6 +166,11 @@ func (w *WhatsAppConnector) connect(ctx context.Context) error {
 	logger := waLog.Stdout("WhatsApp", "ERROR", true)
 	client := whatsmeow.NewClient(device, logger)
 	client.AddEventHandler(w.handleEvent)
+	if w.proxy != "" {
+		if err := client.SetProxyAddress(w.proxy); err != nil {
+			return fmt.Errorf("set whatsapp proxy: %w", err)
+		}
+	}
 
 	if client.Store.ID == nil {
 		// Not paired yet - tell the user how to pair and return an error
@@ -159,6 +201,8 @@ func (w *WhatsAppConnector) handleEvent(evt interface{}) {
 	switch v := evt.(type) {
 	case *events.Message:
 		w.handleMessage(v)
+	case *events.Receipt:
+		w.handleReceipt(v)
 	case *events.Connected:
 		log.Printf("[whatsapp:%s] connected event", w.botName)
 		w.publishStatus("connector online")
@@ -172,17 +216,15 @@ func (w *WhatsAppConnector) handleEvent(evt interface{}) {
 }
 
 func (w *WhatsAppConnector) handleMessage(msg *events.Message) {
-	if msg.Info.IsFromMe {
-		return
-	}
-
 	chatJID := msg.Info.Chat.String()
 	if !w.acceptsChannel(chatJID) {
 		return
 	}
 
 	text := extractWhatsAppText(msg)
-	if text == "" {
+	audio := msg.Message.GetAudioMessage()
+	media, hasMedia := whatsAppMedia(msg.Info.ID, msg.Message)
+	if text == "" && audio == nil && !hasMedia {
 		return
 	}
 
@@ -194,8 +236,14 @@ func (w *WhatsAppConnector) handleMessage(msg *events.Message) {
 			}
 		}
 	}
+	if audio != nil {
+		thread = audio.GetContextInfo().GetStanzaID()
+	}
+	if hasMedia {
+		thread = whatsAppMediaContext(msg.Message).GetStanzaID()
+	}
 
-	w.publish(protocol.Event{
+	event := protocol.Event{
 		Timestamp: msg.Info.Timestamp,
 		Service:   w.serviceName,
 		Bot:       w.botName,
@@ -205,18 +253,182 @@ func (w *WhatsAppConnector) handleMessage(msg *events.Message) {
 		Target:    "chat:" + chatJID,
 		Channel:   chatJID,
 		Thread:    thread,
+		MessageID: msg.Info.ID,
 		Text:      text,
+		Direct:    msg.Info.Chat.Server == types.DefaultUserServer || msg.Info.Chat.Server == types.HiddenUserServer,
+	}
+
+	// Messages the account sent from the phone or another linked device.
+	// Their media stays on that device.
+	if msg.Info.IsFromMe {
+		event.Direction, event.User, event.Direct = "out", w.Identity(), false
+		w.echoes.echo(msg.Info.ID, func() { w.publish(event) })
+		return
+	}
+
+	w.rememberUnread(chatJID, whatsAppUnread{id: msg.Info.ID, sender: msg.Info.Sender, timestamp: msg.Info.Timestamp})
+
+	if audio != nil {
+		event.Attachments = []protocol.Attachment{whatsAppAudio(msg.Info.ID, audio)}
+		download := func(ctx context.Context) ([]byte, error) {
+			w.mu.RLock()
+			client := w.client
+			w.mu.RUnlock()
+			if client == nil {
+				return nil, fmt.Errorf("whatsapp client not connected")
+			}
+			return client.Download(ctx, audio)
+		}
+		w.publishVoice(context.Background(), event, download, w.publish)
+		return
+	}
+	if hasMedia {
+		event.Attachments = []protocol.Attachment{media}
+		w.publishMedia(event, msg.Message)
+		return
+	}
+	w.publish(event)
+}
+
+// handleReceipt reports the delivery and read receipts for messages the
+// account sent. In groups every member sends their own; the furthest one
+// counts.
+func (w *WhatsAppConnector) handleReceipt(receipt *events.Receipt) {
+	var status, reason string
+	switch receipt.Type {
+	case types.ReceiptTypeDelivered:
+		status = protocol.StatusDelivered
+	case types.ReceiptTypeRead, types.ReceiptTypePlayed:
+		status = protocol.StatusRead
+	case types.ReceiptTypeServerError:
+		status, reason = protocol.StatusFailed, "whatsapp server error"
+	default:
+		return
+	}
+	// The account's other devices acknowledge messages too, and read-self
+	// receipts are about messages others sent.
+	if receipt.IsFromMe && status != protocol.StatusFailed {
+		return
+	}
+
+	chat := receipt.Chat.String()
+	if !w.acceptsChannel(chat) {
+		return
+	}
+	for _, id := range receipt.MessageIDs {
+		w.publishReceipt(chat, id, status, reason, receipt.Timestamp)
+	}
+}
+
+// publishReceipt reports a new delivery status of the message id the
+// account sent to chat.
+func (w *WhatsAppConnector) publishReceipt(chat string, id string, status string, reason string, at time.Time) {
+	w.publish(protocol.Event{
+		Timestamp: at,
+		Service:   w.serviceName,
+		Bot:       w.botName,
+		Kind:      protocol.KindReceipt,
+		Direction: "out",
+		Target:    "chat:" + chat,
+		Channel:   chat,
+		MessageID: id,
+		Status:    status,
+		Text:      reason,
 	})
 }
 
-func (w *WhatsAppConnector) Send(ctx context.Context, request protocol.Request) (protocol.Event, error) {
-	segments, err := prepareWhatsAppSegments(request.Format, request.Text)
+func (w *WhatsAppConnector) rememberUnread(chat string, message whatsAppUnread) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.unread == nil {
+		w.unread = make(map[string][]whatsAppUnread)
+	}
+	pending := append(w.unread[chat], message)
+	if len(pending) > maxWhatsAppUnread {
+		pending = pending[len(pending)-maxWhatsAppUnread:]
+	}
+	w.unread[chat] = pending
+}
+
+// MarkRead sends read receipts (blue ticks) for the messages received in
+// channel up to through, or all of them when through is zero.
+func (w *WhatsAppConnector) MarkRead(ctx context.Context, channel string, through time.Time) error {
+	chat, err := types.ParseJID(channel)
 	if err != nil {
-		return protocol.Event{}, err
+		return fmt.Errorf("invalid whatsapp chat %q: %w", channel, err)
+	}
+
+	w.mu.Lock()
+	client := w.client
+	var marked, kept []whatsAppUnread
+	for _, message := range w.unread[channel] {
+		if through.IsZero() || !message.timestamp.After(through) {
+			marked = append(marked, message)
+		} else {
+			kept = append(kept, message)
+		}
+	}
+	if client != nil {
+		w.unread[channel] = kept
+	}
+	w.mu.Unlock()
+
+	if client == nil {
+		return fmt.Errorf("whatsapp client not connected")
+	}
+
+	// Receipts are per sender, which only differs in group chats.
+	bySender := make(map[types.JID][]whatsAppUnread)
+	var senders []types.JID
+	for _, message := range marked {
+		if _, ok := bySender[message.sender]; !ok {
+			senders = append(senders, message.sender)
+		}
+		bySender[message.sender] = append(bySender[message.sender], message)
+	}
+	for _, sender := range senders {
+		messages := bySender[sender]
+		ids := make([]types.MessageID, 0, len(messages))
+		for _, message := range messages {
+			ids = append(ids, message.id)
+		}
+		if err := client.MarkRead(ctx, ids, messages[len(messages)-1].timestamp, chat, sender); err != nil {
+			return fmt.Errorf("whatsapp read receipt: %w", err)
+		}
+	}
+	return nil
+}
+
+// whatsAppAudio describes an audio message. PTT ("push to talk") marks
+// voice notes recorded in the app.
+func whatsAppAudio(id types.MessageID, audio *waE2E.AudioMessage) protocol.Attachment {
+	return protocol.Attachment{
+		Kind:     protocol.AttachmentAudio,
+		ID:       id,
+		MimeType: audio.GetMimetype(),
+		Size:     int64(audio.GetFileLength()),
+		Duration: float64(audio.GetSeconds()),
+		Voice:    audio.GetPTT(),
+	}
+}
+
+func (w *WhatsAppConnector) Send(ctx context.Context, request protocol.Request) (protocol.Event, error) {
+	var segments []string
+	if len(request.Files) == 0 || strings.TrimSpace(request.Text) != "" {
+		var err error
+		segments, err = prepareWhatsAppSegments(request.Format, request.Text)
+		if err != nil {
+			return protocol.Event{}, err
+		}
+		if len(segments) == 0 {
+			return protocol.Event{}, fmt.Errorf("text cannot be empty")
+		}
 	}
 
-	if len(segments) == 0 {
-		return protocol.Event{}, fmt.Errorf("text cannot be empty")
+	// Text that fits one message becomes the caption of the first file.
+	caption := ""
+	if len(request.Files) > 0 && len(segments) == 1 {
+		caption, segments = segments[0], nil
 	}
 
 	chatJID, jidErr := resolveWhatsAppJID(request)
@@ -241,32 +453,67 @@ func (w *WhatsAppConnector) Send(ctx context.Context, request protocol.Request)
 		if sendErr != nil {
 			return protocol.Event{}, fmt.Errorf("whatsapp send: %w", sendErr)
 		}
+		w.echoes.claim(resp.ID)
 
-		channel := chatJID.String()
-		target := request.Target
-		if target == "" {
-			target = "chat:" + channel
-		}
+		event := w.outboundEvent(request, chatJID, resp.ID, resp.Timestamp, segmentText)
+		w.publish(event)
+		w.publishReceipt(event.Channel, resp.ID, protocol.StatusSent, "", resp.Timestamp)
+		lastEvent = event
+	}
 
-		event := protocol.Event{
-			Timestamp: resp.Timestamp,
-			Service:   w.serviceName,
-			Bot:       w.botName,
-			Kind:      "message",
-			Direction: "out",
-			User:      w.Identity(),
-			Target:    target,
-			Channel:   channel,
-			Thread:    request.Thread,
-			Text:      segmentText,
+	for _, path := range request.Files {
+		resp, attachment, sendErr := w.sendFile(ctx, client, chatJID, path, caption)
+		if sendErr != nil {
+			return protocol.Event{}, fmt.Errorf("whatsapp send file: %w", sendErr)
 		}
+		w.echoes.claim(resp.ID)
+
+		event := w.outboundEvent(request, chatJID, resp.ID, resp.Timestamp, caption)
+		event.Attachments = []protocol.Attachment{attachment}
 		w.publish(event)
+		w.publishReceipt(event.Channel, resp.ID, protocol.StatusSent, "", resp.Timestamp)
 		lastEvent = event
+		caption = ""
 	}
 
 	return lastEvent, nil
 }
 
+// outboundEvent is the event for the message with id the bot sent to chat.
+func (w *WhatsAppConnector) outboundEvent(request protocol.Request, chat types.JID, id string, timestamp time.Time, text string) protocol.Event {
+	channel := chat.String()
+	target := request.Target
+	if target == "" {
+		target = "chat:" + channel
+	}
+
+	return protocol.Event{
+		Timestamp: timestamp,
+		Service:   w.serviceName,
+		Bot:       w.botName,
+		Kind:      "message",
+		Direction: "out",
+		User:      w.Identity(),
+		Target:    target,
+		Channel:   channel,
+		Thread:    request.Thread,
+		MessageID: id,
+		Text:      text,
+	}
+}
+
+// whatsAppMediaContext returns the context (quoted message) of the media of
+// a message.
+func whatsAppMediaContext(message *waE2E.Message) *waE2E.ContextInfo {
+	if img := message.GetImageMessage(); img != nil {
+		return img.GetContextInfo()
+	}
+	if vid := message.GetVideoMessage(); vid != nil {
+		return vid.GetContextInfo()
+	}
+	return message.GetDocumentMessage().GetContextInfo()
+}
+
 func (w *WhatsAppConnector) Identity() string {
 	w.mu.RLock()
 	defer w.mu.RUnlock()
@@ -333,6 +580,10 @@ func extractWhatsAppText(msg *events.Message) string {
 	return ""
 }
 
+// whatsappMaxText is how much text goes in one WhatsApp message, under the
+// 65536-character limit.
+const whatsappMaxText = 65000
+
 // prepareWhatsAppSegments converts the message to plain text and splits it.
 // WhatsApp has its own markdown dialect (*bold*, _italic_, ~strike~, ```code```)
 // that differs from CommonMark.  Rather than risk garbled output, formatted
@@ -357,7 +608,7 @@ func prepareWhatsAppSegments(format string, text string) ([]string, error) {
 	}
 
 	// WhatsApp messages can be up to ~65536 characters.
-	return formatting.SplitText(trimmed, 65000), nil
+	return formatting.SplitText(trimmed, whatsappMaxText), nil
 }
 
 // resolveWhatsAppJID parses a WhatsApp JID from the request's channel or
@@ -396,6 +647,11 @@ func resolveWhatsAppJID(request protocol.Request) (types.JID, error) {
 	return types.NewJID(raw, types.DefaultUserServer), nil
 }
 
+// Capabilities reports WhatsApp's features: file sends and read receipts.
+func (w *WhatsAppConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{Files: true, MarkRead: true, Receipts: true, MaxText: whatsappMaxText}
+}
+
 // React is not supported by the WhatsApp connector.
 func (w *WhatsAppConnector) React(_ context.Context, _ protocol.Request) error {
 	return fmt.Errorf("reactions are not supported by the whatsapp connector")
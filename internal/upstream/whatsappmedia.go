@@ -0,0 +1,231 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/pantalk/pantalk/internal/protocol"
+)
+
+// maxWhatsAppMediaDownload is the largest received file saved to the media
+// directory; bigger documents are reported without a path. Downloads are
+// held in memory while they are decrypted.
+const maxWhatsAppMediaDownload = 100 << 20
+
+// whatsAppMediaTimeout bounds the download of one received file.
+const whatsAppMediaTimeout = 2 * time.Minute
+
+// whatsAppMediaExtensions picks the usual extension for the media types
+// WhatsApp sends, where mime.ExtensionsByType would return an obscure one
+// first (".jfif" for JPEG).
+var whatsAppMediaExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/webp":      ".webp",
+	"image/gif":       ".gif",
+	"video/mp4":       ".mp4",
+	"video/3gpp":      ".3gp",
+	"application/pdf": ".pdf",
+}
+
+// whatsAppMedia describes the image, video or document of a message, if it
+// has one.
+func whatsAppMedia(id types.MessageID, message *waE2E.Message) (protocol.Attachment, bool) {
+	if img := message.GetImageMessage(); img != nil {
+		return protocol.Attachment{
+			Kind:     protocol.AttachmentImage,
+			ID:       id,
+			MimeType: img.GetMimetype(),
+			Size:     int64(img.GetFileLength()),
+		}, true
+	}
+	if vid := message.GetVideoMessage(); vid != nil {
+		return protocol.Attachment{
+			Kind:     protocol.AttachmentVideo,
+			ID:       id,
+			MimeType: vid.GetMimetype(),
+			Size:     int64(vid.GetFileLength()),
+			Duration: float64(vid.GetSeconds()),
+		}, true
+	}
+	if doc := message.GetDocumentMessage(); doc != nil {
+		return protocol.Attachment{
+			Kind:     protocol.AttachmentFile,
+			ID:       id,
+			Name:     doc.GetFileName(),
+			MimeType: doc.GetMimetype(),
+			Size:     int64(doc.GetFileLength()),
+		}, true
+	}
+	return protocol.Attachment{}, false
+}
+
+// publishMedia publishes event, whose first attachment is the media of
+// message, once the media is saved to the media directory. The download
+// runs in the background; when it fails the event is published without a
+// path rather than dropped.
+func (w *WhatsAppConnector) publishMedia(event protocol.Event, message *waE2E.Message) {
+	attachment := event.Attachments[0]
+	if w.mediaDir == "" || attachment.Size > maxWhatsAppMediaDownload {
+		w.publish(event)
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), whatsAppMediaTimeout)
+		defer cancel()
+
+		path, err := w.saveMedia(ctx, attachment, message)
+		if err != nil {
+			log.Printf("[whatsapp:%s] download of %s %s in %s failed: %v", w.botName, attachment.Kind, attachment.ID, event.Channel, err)
+		} else {
+			event.Attachments = append([]protocol.Attachment(nil), event.Attachments...)
+			event.Attachments[0].Path = path
+		}
+		w.publish(event)
+	}()
+}
+
+// saveMedia downloads and decrypts the media of message and writes it to
+// the media directory, returning the file's path.
+func (w *WhatsAppConnector) saveMedia(ctx context.Context, attachment protocol.Attachment, message *waE2E.Message) (string, error) {
+	download := w.download
+	if download == nil {
+		w.mu.RLock()
+		client := w.client
+		w.mu.RUnlock()
+		if client == nil {
+			return "", fmt.Errorf("whatsapp client not connected")
+		}
+		download = client.DownloadAny
+	}
+
+	data, err := download(ctx, message)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(w.mediaDir, 0o700); err != nil {
+		return "", fmt.Errorf("create media dir: %w", err)
+	}
+	path := filepath.Join(w.mediaDir, whatsAppMediaFileName(attachment))
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", fmt.Errorf("save media: %w", err)
+	}
+	return path, nil
+}
+
+// whatsAppMediaFileName names a downloaded file after its message ID, which
+// is unique, with the extension of the document name or the media type.
+func whatsAppMediaFileName(attachment protocol.Attachment) string {
+	ext := filepath.Ext(attachment.Name)
+	if ext == "" {
+		mediaType, _, _ := strings.Cut(attachment.MimeType, ";")
+		ext = whatsAppMediaExtensions[mediaType]
+		if ext == "" {
+			if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+				ext = exts[0]
+			}
+		}
+	}
+	return filepath.Base(attachment.ID) + ext
+}
+
+// sendFile uploads the file at path and sends it to chat as an image, video
+// or document message.
+func (w *WhatsAppConnector) sendFile(ctx context.Context, client *whatsmeow.Client, chat types.JID, path, caption string) (whatsmeow.SendResponse, protocol.Attachment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return whatsmeow.SendResponse{}, protocol.Attachment{}, err
+	}
+
+	attachment := protocol.Attachment{
+		Kind:     protocol.AttachmentFile,
+		Name:     filepath.Base(path),
+		Path:     path,
+		MimeType: mime.TypeByExtension(filepath.Ext(path)),
+		Size:     int64(len(data)),
+	}
+	if attachment.MimeType == "" {
+		attachment.MimeType = http.DetectContentType(data)
+	}
+
+	mediaType := whatsmeow.MediaDocument
+	switch {
+	case strings.HasPrefix(attachment.MimeType, "image/"):
+		attachment.Kind, mediaType = protocol.AttachmentImage, whatsmeow.MediaImage
+	case strings.HasPrefix(attachment.MimeType, "video/"):
+		attachment.Kind, mediaType = protocol.AttachmentVideo, whatsmeow.MediaVideo
+	}
+
+	uploaded, err := client.Upload(ctx, data, mediaType)
+	if err != nil {
+		return whatsmeow.SendResponse{}, protocol.Attachment{}, fmt.Errorf("upload %s: %w", attachment.Name, err)
+	}
+
+	resp, err := client.SendMessage(ctx, chat, whatsAppMediaMessage(attachment, uploaded, caption))
+	if err != nil {
+		return whatsmeow.SendResponse{}, protocol.Attachment{}, err
+	}
+	attachment.ID = resp.ID
+	return resp, attachment, nil
+}
+
+// whatsAppMediaMessage builds the message for an uploaded file. Files that
+// are neither images nor videos are sent as documents.
+func whatsAppMediaMessage(attachment protocol.Attachment, uploaded whatsmeow.UploadResponse, caption string) *waE2E.Message {
+	var captionField *string
+	if caption != "" {
+		captionField = proto.String(caption)
+	}
+
+	switch attachment.Kind {
+	case protocol.AttachmentImage:
+		return &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+			Caption:       captionField,
+			Mimetype:      proto.String(attachment.MimeType),
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uploaded.FileLength),
+		}}
+	case protocol.AttachmentVideo:
+		return &waE2E.Message{VideoMessage: &waE2E.VideoMessage{
+			Caption:       captionField,
+			Mimetype:      proto.String(attachment.MimeType),
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uploaded.FileLength),
+		}}
+	default:
+		return &waE2E.Message{DocumentMessage: &waE2E.DocumentMessage{
+			Caption:       captionField,
+			Title:         proto.String(attachment.Name),
+			FileName:      proto.String(attachment.Name),
+			Mimetype:      proto.String(attachment.MimeType),
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uploaded.FileLength),
+		}}
+	}
+}
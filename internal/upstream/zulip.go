@@ -7,6 +7,7 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -17,6 +18,10 @@ import (
 	"github.com/pantalk/pantalk/internal/protocol"
 )
 
+// defaultZulipPoll is how long a request for events waits for them; the
+// server sends a heartbeat well before.
+const defaultZulipPoll = 90 * time.Second
+
 type ZulipConnector struct {
 	serviceName string
 	botName     string
@@ -25,6 +30,8 @@ type ZulipConnector struct {
 	apiKey      string
 	publish     func(protocol.Event)
 	httpClient  *http.Client
+	pollClient  *http.Client // the events long poll; nil uses httpClient
+	echoes      *echoFilter  // nil unless include_self
 
 	mu       sync.RWMutex
 	channels map[string]struct{}
@@ -92,6 +99,12 @@ func NewZulipConnector(bot config.BotConfig, publish func(protocol.Event)) (*Zul
 		return nil, fmt.Errorf("resolve zulip bot_email for bot %q: %w", bot.Name, err)
 	}
 
+	proxy, err := proxyFor(bot)
+	if err != nil {
+		return nil, err
+	}
+	httpOpts := bot.HTTPOptions()
+
 	connector := &ZulipConnector{
 		serviceName: bot.Type,
 		botName:     bot.Name,
@@ -99,7 +112,9 @@ func NewZulipConnector(bot config.BotConfig, publish func(protocol.Event)) (*Zul
 		email:       email,
 		apiKey:      apiKey,
 		publish:     publish,
-		httpClient:  &http.Client{Timeout: 90 * time.Second},
+		httpClient:  newHTTPClient(proxy, httpOpts, 60*time.Second),
+		pollClient:  newPollClient(proxy, httpOpts, httpOpts.PollTimeoutOr(defaultZulipPoll)),
+		echoes:      newEchoFilter(bot.IncludeSelf),
 		channels:    make(map[string]struct{}),
 	}
 
@@ -230,10 +245,6 @@ func (z *ZulipConnector) pollEvents(ctx context.Context, queueID string, lastEve
 
 			msg := evt.Message
 
-			if z.isSelfMessage(msg.SenderID) {
-				continue
-			}
-
 			channelID := z.extractChannel(msg)
 			if !z.acceptsChannel(channelID) {
 				continue
@@ -244,7 +255,7 @@ func (z *ZulipConnector) pollEvents(ctx context.Context, queueID string, lastEve
 				continue
 			}
 
-			z.publish(protocol.Event{
+			event := protocol.Event{
 				Timestamp: time.Unix(msg.Timestamp, 0).UTC(),
 				Service:   z.serviceName,
 				Bot:       z.botName,
@@ -254,12 +265,27 @@ func (z *ZulipConnector) pollEvents(ctx context.Context, queueID string, lastEve
 				Target:    "channel:" + channelID,
 				Channel:   channelID,
 				Thread:    msg.Subject,
+				MessageID: strconv.FormatInt(msg.ID, 10),
 				Text:      text,
-			})
+				Direct:    msg.Type == "private",
+			}
+			if z.isSelfMessage(msg.SenderID) {
+				event.Direction, event.Direct = "out", false
+				z.echoes.echo(strconv.FormatInt(msg.ID, 10), func() { z.publish(event) })
+				continue
+			}
+			z.publish(event)
 		}
 	}
 }
 
+func (z *ZulipConnector) poller() *http.Client {
+	if z.pollClient != nil {
+		return z.pollClient
+	}
+	return z.httpClient
+}
+
 func (z *ZulipConnector) getEvents(ctx context.Context, queueID string, lastEventID int64) ([]zulipEvent, int64, error) {
 	params := url.Values{}
 	params.Set("queue_id", queueID)
@@ -272,7 +298,7 @@ func (z *ZulipConnector) getEvents(ctx context.Context, queueID string, lastEven
 	}
 	req.SetBasicAuth(z.email, z.apiKey)
 
-	resp, err := z.httpClient.Do(req)
+	resp, err := z.poller().Do(req)
 	if err != nil {
 		return nil, lastEventID, err
 	}
@@ -329,9 +355,10 @@ func (z *ZulipConnector) Send(ctx context.Context, request protocol.Request) (pr
 
 		// Determine message type based on channel format
 		if strings.Contains(channel, "@") {
-			// Direct message
+			// Direct message, to one person or a group
+			to, _ := json.Marshal(zulipRecipients(channel))
 			form.Set("type", "direct")
-			form.Set("to", channel)
+			form.Set("to", string(to))
 		} else {
 			// Stream message
 			form.Set("type", "stream")
@@ -355,7 +382,7 @@ func (z *ZulipConnector) Send(ctx context.Context, request protocol.Request) (pr
 
 		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 			resp.Body.Close()
-			return protocol.Event{}, fmt.Errorf("zulip send failed: status %d", resp.StatusCode)
+			return protocol.Event{}, statusError("zulip send", resp.StatusCode)
 		}
 
 		var sendResp zulipSendMessageResponse
@@ -368,6 +395,7 @@ func (z *ZulipConnector) Send(ctx context.Context, request protocol.Request) (pr
 		if sendResp.Result != "success" {
 			return protocol.Event{}, fmt.Errorf("zulip send: %s", sendResp.Msg)
 		}
+		z.echoes.claim(strconv.FormatInt(sendResp.ID, 10))
 
 		target := request.Target
 		if target == "" {
@@ -384,6 +412,7 @@ func (z *ZulipConnector) Send(ctx context.Context, request protocol.Request) (pr
 			Target:    target,
 			Channel:   channel,
 			Thread:    request.Thread,
+			MessageID: strconv.FormatInt(sendResp.ID, 10),
 			Text:      segmentText,
 		}
 		z.publish(event)
@@ -394,37 +423,54 @@ func (z *ZulipConnector) Send(ctx context.Context, request protocol.Request) (pr
 }
 
 func (z *ZulipConnector) loadSelfUser(ctx context.Context) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, z.endpoint+"/api/v1/users/me", nil)
+	profile, err := z.getProfile(ctx)
 	if err != nil {
 		return err
 	}
+
+	z.mu.Lock()
+	z.selfUser = profile.Email
+	z.selfID = profile.UserID
+	z.mu.Unlock()
+
+	return nil
+}
+
+func (z *ZulipConnector) getProfile(ctx context.Context) (zulipGetProfileResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, z.endpoint+"/api/v1/users/me", nil)
+	if err != nil {
+		return zulipGetProfileResponse{}, err
+	}
 	req.SetBasicAuth(z.email, z.apiKey)
 
 	resp, err := z.httpClient.Do(req)
 	if err != nil {
-		return err
+		return zulipGetProfileResponse{}, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("users/me failed: status %d", resp.StatusCode)
+		return zulipGetProfileResponse{}, fmt.Errorf("users/me failed: status %d", resp.StatusCode)
 	}
 
 	var profile zulipGetProfileResponse
 	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
-		return err
+		return zulipGetProfileResponse{}, err
 	}
 
 	if profile.Result != "success" {
-		return fmt.Errorf("users/me returned: %s", profile.Result)
+		return zulipGetProfileResponse{}, fmt.Errorf("users/me returned: %s", profile.Result)
 	}
+	return profile, nil
+}
 
-	z.mu.Lock()
-	z.selfUser = profile.Email
-	z.selfID = profile.UserID
-	z.mu.Unlock()
-
-	return nil
+// Verify implements Verifier with users/me.
+func (z *ZulipConnector) Verify(ctx context.Context) (Verification, error) {
+	profile, err := z.getProfile(ctx)
+	if err != nil {
+		return Verification{}, err
+	}
+	return Verification{User: profile.Email, UserID: strconv.FormatInt(profile.UserID, 10), Team: z.endpoint}, nil
 }
 
 func (z *ZulipConnector) Identity() string {
@@ -433,11 +479,59 @@ func (z *ZulipConnector) Identity() string {
 	return z.selfUser
 }
 
+// extractChannel returns the stream ID of a stream message and the other
+// participants of a direct message, as the comma-separated list of emails
+// Send takes, so replies to a group DM reach the whole group.
 func (z *ZulipConnector) extractChannel(msg *zulipMessage) string {
 	if msg.Type == "stream" {
 		return strconv.FormatInt(msg.StreamID, 10)
 	}
-	return msg.SenderEmail
+
+	var recipients []zulipUser
+	if err := json.Unmarshal(msg.DisplayRecipient, &recipients); err != nil {
+		return msg.SenderEmail
+	}
+	self := z.Identity()
+	var emails []string
+	for _, recipient := range recipients {
+		if recipient.Email != "" && !strings.EqualFold(recipient.Email, self) {
+			emails = append(emails, recipient.Email)
+		}
+	}
+	if len(emails) == 0 {
+		return msg.SenderEmail
+	}
+	return zulipDirectChannel(strings.Join(emails, ","))
+}
+
+// zulipRecipients splits a comma-separated list of emails, trimming each
+// and dropping empty ones.
+func zulipRecipients(list string) []string {
+	var emails []string
+	for _, email := range strings.Split(list, ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
+
+// zulipDirectChannel normalizes a comma-separated list of emails to the
+// sorted list without blanks and duplicates, so a group DM has one channel
+// whichever order its members are given in.
+func zulipDirectChannel(list string) string {
+	seen := make(map[string]struct{})
+	var emails []string
+	for _, email := range zulipRecipients(list) {
+		key := strings.ToLower(email)
+		if _, dup := seen[key]; dup {
+			continue
+		}
+		seen[key] = struct{}{}
+		emails = append(emails, email)
+	}
+	sort.Slice(emails, func(i, j int) bool { return strings.ToLower(emails[i]) < strings.ToLower(emails[j]) })
+	return strings.Join(emails, ",")
 }
 
 func (z *ZulipConnector) isSelfMessage(senderID int64) bool {
@@ -491,6 +585,9 @@ func (z *ZulipConnector) sleepOrDone(ctx context.Context, wait time.Duration) {
 	}
 }
 
+// zulipMaxText is Zulip's default limit on one message.
+const zulipMaxText = 10000
+
 // prepareZulipSegments formats and splits a message for Zulip.  Zulip renders
 // Markdown natively, so markdown input passes through unchanged.  HTML is not
 // supported in Zulip message content and is stripped to plain text.
@@ -513,26 +610,27 @@ func prepareZulipSegments(format string, text string) ([]string, error) {
 	// FormatMarkdown and FormatPlain pass through unchanged.
 
 	// Zulip message limit is ~10000 characters.
-	return formatting.SplitText(trimmed, 10000), nil
+	return formatting.SplitText(trimmed, zulipMaxText), nil
 }
 
+// resolveZulipChannel returns the stream, or for direct messages the
+// recipient emails (comma-separated for a group DM), of a request.
 func resolveZulipChannel(request protocol.Request) string {
-	if request.Channel != "" {
-		return request.Channel
-	}
-
-	target := strings.TrimSpace(request.Target)
-	if target == "" {
-		return ""
-	}
-
-	for _, prefix := range []string{"channel:", "zulip:channel:", "stream:", "zulip:stream:"} {
-		if strings.HasPrefix(target, prefix) {
-			return strings.TrimPrefix(target, prefix)
+	channel := request.Channel
+	if channel == "" {
+		channel = strings.TrimSpace(request.Target)
+		for _, prefix := range []string{"channel:", "zulip:channel:", "stream:", "zulip:stream:"} {
+			if strings.HasPrefix(channel, prefix) {
+				channel = strings.TrimPrefix(channel, prefix)
+				break
+			}
 		}
 	}
 
-	return target
+	if strings.Contains(channel, "@") {
+		return zulipDirectChannel(channel)
+	}
+	return channel
 }
 
 // resolveChannelNames resolves any friendly stream names (e.g. "general",
@@ -600,6 +698,62 @@ func isZulipStreamID(s string) bool {
 	return err == nil
 }
 
+// ListTopics returns the topics of a stream, given by ID or name, most
+// recently active first.
+func (z *ZulipConnector) ListTopics(ctx context.Context, channel string) ([]protocol.Topic, error) {
+	streamID, err := strconv.ParseInt(channel, 10, 64)
+	if err != nil {
+		if streamID, err = z.getStreamID(ctx, strings.TrimPrefix(channel, "#")); err != nil {
+			return nil, err
+		}
+	}
+
+	reqURL := fmt.Sprintf("%s/api/v1/users/me/%d/topics", z.endpoint, streamID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(z.email, z.apiKey)
+
+	resp, err := z.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Result string `json:"result"`
+		Msg    string `json:"msg"`
+		Topics []struct {
+			Name  string `json:"name"`
+			MaxID int64  `json:"max_id"`
+		} `json:"topics"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if result.Result != "success" {
+		return nil, fmt.Errorf("get_stream_topics failed for stream %s: %s", channel, result.Msg)
+	}
+
+	sort.SliceStable(result.Topics, func(i, j int) bool { return result.Topics[i].MaxID > result.Topics[j].MaxID })
+	topics := make([]protocol.Topic, 0, len(result.Topics))
+	for _, topic := range result.Topics {
+		topics = append(topics, protocol.Topic{Name: topic.Name, LastMessage: strconv.FormatInt(topic.MaxID, 10)})
+	}
+	return topics, nil
+}
+
+// Capabilities reports Zulip's features. Threads are stream topics, which
+// can be listed.
+func (z *ZulipConnector) Capabilities() protocol.Capabilities {
+	return protocol.Capabilities{Threads: true, Topics: true, MaxText: zulipMaxText}
+}
+
+// SendsWithoutSession implements SessionlessSender: messages are sent with
+// the REST API; Run only registers an event queue.
+func (z *ZulipConnector) SendsWithoutSession() {}
+
 // React is not supported by the Zulip connector.
 func (z *ZulipConnector) React(_ context.Context, _ protocol.Request) error {
 	return fmt.Errorf("reactions are not supported by the zulip connector")